@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package chaosbat
+
+import (
+	"context"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ciao-project/ciao/bat"
+)
+
+const standardTimeout = time.Second * 300
+
+var chaos = flag.Bool("chaos", false, "Run the chaos tests, which disrupt the services of the cluster")
+var chaosRounds = flag.Int("chaos-rounds", 5, "Number of failures injected by the chaos tests")
+var chaosInterval = flag.Duration("chaos-interval", 10*time.Second, "Time between two failures injected by the chaos tests")
+var chaosSeed = flag.Int64("chaos-seed", 0, "Seed used to choose the failures injected by the chaos tests, random if 0")
+
+// Check that the controller reconciles the state of the cluster after
+// random failures.
+//
+// Start a number of instances and wait for them to launch.  Then randomly
+// kill launchers, disconnect the SSNTP clients by restarting the scheduler
+// and delete instances.  Once done, wait for the cluster to recover.  The
+// test is only run if the -chaos flag is set as it disrupts the other users
+// of the cluster.  It must be run on the master node, with passwordless ssh
+// and sudo access to the compute nodes.
+//
+// All the compute nodes should return to the READY state, the deleted
+// instances should disappear and the other instances should all be
+// scheduled.
+func TestChaos(t *testing.T) {
+	if !*chaos {
+		t.Skip("Chaos tests not enabled")
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(),
+		standardTimeout+time.Duration(*chaosRounds)*(*chaosInterval+time.Minute))
+	defer cancelFunc()
+
+	instances, err := bat.StartRandomInstances(ctx, "", 3)
+	if err != nil {
+		t.Fatalf("Failed to launch instances: %v", err)
+	}
+
+	defer func() {
+		_, err := bat.DeleteInstances(ctx, "", instances)
+		if err != nil {
+			t.Errorf("Failed to delete instances: %v", err)
+		}
+	}()
+
+	scheduled, err := bat.WaitForInstancesLaunch(ctx, "", instances, false)
+	if err != nil {
+		t.Fatalf("Instances failed to launch: %v", err)
+	}
+
+	report, err := bat.RunChaos(ctx, "", scheduled, bat.ChaosOptions{
+		Rounds:   *chaosRounds,
+		Interval: *chaosInterval,
+		Seed:     *chaosSeed,
+	})
+	if report != nil {
+		instances = report.Surviving
+		for _, e := range report.Events {
+			t.Logf("%s %s %s: %v", e.Time.Format(time.RFC3339), e.Action, e.Target, e.Err)
+		}
+	}
+	if err != nil {
+		t.Fatalf("Chaos run interrupted: %v", err)
+	}
+
+	err = bat.WaitForReconciliation(ctx, "", report)
+	if err != nil {
+		t.Fatalf("Cluster did not recover from chaos run with seed %d: %v", report.Seed, err)
+	}
+}
+
+// TestMain ensures that all instances have been deleted when the tests finish.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	err := m.Run()
+
+	if *chaos {
+		ctx, cancelFunc := context.WithTimeout(context.Background(), standardTimeout)
+		_ = bat.DeleteAllInstances(ctx, "")
+		cancelFunc()
+	}
+
+	os.Exit(err)
+}
@@ -17,8 +17,12 @@
 package bat
 
 import (
+	"context"
+	"errors"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var instances = []string{
@@ -88,6 +92,35 @@ func TestMissingCheckStatuses(t *testing.T) {
 	}
 }
 
+func TestCheckReconciled(t *testing.T) {
+	statuses := map[string]string{
+		"d258443c-72c7-4971-8c2b-cb9925522c3e": "active",
+		"64a0cca9-85a2-4733-988b-b4fe9a72dd0e": "exited",
+	}
+
+	finished, err := checkReconciled(instances, nil, statuses)
+	if !finished || err != nil {
+		t.Errorf("reconciled check failed")
+	}
+
+	finished, err = checkReconciled(instances[:1], instances[1:], statuses)
+	if finished || err != nil {
+		t.Errorf("pending deletion check failed")
+	}
+
+	statuses["d258443c-72c7-4971-8c2b-cb9925522c3e"] = "pending"
+	finished, err = checkReconciled(instances, nil, statuses)
+	if finished || err != nil {
+		t.Errorf("pending instance check failed")
+	}
+
+	delete(statuses, "64a0cca9-85a2-4733-988b-b4fe9a72dd0e")
+	_, err = checkReconciled(instances, nil, statuses)
+	if err == nil {
+		t.Errorf("lost instance check failed")
+	}
+}
+
 func TestImageOptions(t *testing.T) {
 	opts := &ImageOptions{
 		ID:         "test-id",
@@ -105,3 +138,94 @@ func TestImageOptions(t *testing.T) {
 		t.Fatalf("Compute image arguments are incorrect: %s vs %s", computedArgs, expectedArgs)
 	}
 }
+
+func TestVolumeOptions(t *testing.T) {
+	opts := &VolumeOptions{
+		Size:        10,
+		Name:        "test-name",
+		Description: "test-description",
+	}
+
+	computedArgs := computeVolumeAddArgs("source-id", "volume", opts)
+	expectedArgs := []string{
+		"create", "volume", "-f", "{{ tojson . }}",
+		"--source-type", "volume",
+		"--source", "source-id",
+		"--name", "test-name",
+		"--description", "test-description",
+		"--size", "10",
+	}
+
+	if !reflect.DeepEqual(computedArgs, expectedArgs) {
+		t.Fatalf("Compute volume arguments are incorrect: %s vs %s", computedArgs, expectedArgs)
+	}
+
+	computedArgs = computeVolumeAddArgs("", "", &VolumeOptions{})
+	expectedArgs = []string{"create", "volume", "-f", "{{ tojson . }}"}
+	if !reflect.DeepEqual(computedArgs, expectedArgs) {
+		t.Fatalf("Compute volume arguments are incorrect: %s vs %s", computedArgs, expectedArgs)
+	}
+}
+
+func serveBanner(t *testing.T, banner string) (string, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	go func() {
+		defer func() { _ = l.Close() }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte(banner))
+		_ = conn.Close()
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestCheckSSH(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip, port := serveBanner(t, "SSH-2.0-OpenSSH_7.4\r\n")
+	if err := CheckSSH(ctx, ip, port); err != nil {
+		t.Errorf("SSH check failed: %v", err)
+	}
+
+	ip, port = serveBanner(t, "HTTP/1.1 400 Bad Request\r\n")
+	if err := CheckSSH(ctx, ip, port); err == nil {
+		t.Errorf("SSH check succeeded against non SSH server")
+	}
+}
+
+func TestRunConcurrently(t *testing.T) {
+	errFail := errors.New("failed")
+
+	result := runConcurrently(context.Background(), 20, 4,
+		func(ctx context.Context, i int) error {
+			time.Sleep(time.Duration(i) * time.Millisecond)
+			if i%5 == 0 {
+				return errFail
+			}
+			return nil
+		})
+
+	if result.Operations != 20 || result.Failures != 4 {
+		t.Fatalf("Unexpected result: %s", result)
+	}
+
+	for i, err := range result.Errors {
+		if (i%5 == 0) != (err == errFail) {
+			t.Errorf("Error %d not recorded at the correct index", i)
+		}
+	}
+
+	if result.Min > result.Mean || result.Mean > result.P95 ||
+		result.P95 > result.Max || result.Max < 19*time.Millisecond {
+		t.Errorf("Inconsistent latency statistics: %s", result)
+	}
+}
@@ -0,0 +1,294 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package bat
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// ChaosAction identifies a type of failure injected into a cluster by
+// RunChaos
+type ChaosAction string
+
+const (
+	// ChaosKillLauncher kills the launcher of a random compute node and
+	// then starts it again, as systemd would after a crash.
+	ChaosKillLauncher ChaosAction = "kill-launcher"
+
+	// ChaosDisconnectClients restarts the scheduler, disconnecting all
+	// the SSNTP clients of the cluster.
+	ChaosDisconnectClients ChaosAction = "disconnect-clients"
+
+	// ChaosDeleteInstance deletes a random instance without waiting for
+	// the deletion to complete.
+	ChaosDeleteInstance ChaosAction = "delete-instance"
+)
+
+// ChaosActions contains all the supported chaos actions
+var ChaosActions = []ChaosAction{
+	ChaosKillLauncher,
+	ChaosDisconnectClients,
+	ChaosDeleteInstance,
+}
+
+// NodeCommand runs a command as root on the node with the given hostname.
+// It is used by the chaos actions that need to interfere with the services
+// running on the nodes.  By default the command is run over ssh, clusters
+// that cannot be reached this way should replace it.
+var NodeCommand = func(ctx context.Context, hostname string, args ...string) error {
+	sshArgs := append([]string{"-o", "BatchMode=yes", hostname, "sudo"}, args...)
+	out, err := exec.CommandContext(ctx, "ssh", sshArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error running %v on %s: %v: %s", args, hostname, err, out)
+	}
+	return nil
+}
+
+// MasterCommand runs a command as root on the master node, which is
+// assumed to be the node the BAT tests are running on.
+var MasterCommand = func(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "sudo", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error running %v: %v: %s", args, err, out)
+	}
+	return nil
+}
+
+// ChaosOptions controls the failures injected by RunChaos
+type ChaosOptions struct {
+	// Actions are the actions to choose from.  All the actions are used
+	// if empty.
+	Actions []ChaosAction
+
+	// Rounds is the number of actions to perform
+	Rounds int
+
+	// Interval is the time to wait between two actions
+	Interval time.Duration
+
+	// Seed seeds the random choice of actions and of their targets.  The
+	// current time is used if zero.  The seed used is reported in the
+	// ChaosReport so that failing runs can be reproduced.
+	Seed int64
+}
+
+// ChaosEvent records an action performed by RunChaos
+type ChaosEvent struct {
+	Time   time.Time
+	Action ChaosAction
+	Target string
+	Err    error
+}
+
+// ChaosReport describes the actions performed by RunChaos
+type ChaosReport struct {
+	Seed   int64
+	Events []ChaosEvent
+
+	// Deleted contains the UUIDs of the instances deleted by RunChaos
+	Deleted []string
+
+	// Surviving contains the UUIDs of the instances that were not deleted
+	Surviving []string
+}
+
+// KillLauncher kills the launcher running on the compute node with the
+// given hostname and then starts it again.
+func KillLauncher(ctx context.Context, hostname string) error {
+	err := NodeCommand(ctx, hostname, "systemctl", "kill", "--signal=KILL", "ciao-launcher")
+	if err != nil {
+		return err
+	}
+
+	return NodeCommand(ctx, hostname, "systemctl", "restart", "ciao-launcher")
+}
+
+// DisconnectClients restarts the scheduler, forcing all the SSNTP clients of
+// the cluster, including the controller and the launchers, to reconnect.
+func DisconnectClients(ctx context.Context) error {
+	return MasterCommand(ctx, "systemctl", "restart", "ciao-scheduler")
+}
+
+func runChaosAction(ctx context.Context, r *rand.Rand, tenant string, action ChaosAction,
+	report *ChaosReport) ChaosEvent {
+	event := ChaosEvent{
+		Time:   time.Now(),
+		Action: action,
+	}
+
+	switch action {
+	case ChaosKillLauncher:
+		nodes, err := GetComputeNodes(ctx)
+		if err != nil {
+			event.Err = err
+			break
+		}
+
+		var hostnames []string
+		for _, n := range nodes {
+			hostnames = append(hostnames, n.Hostname)
+		}
+		if len(hostnames) == 0 {
+			event.Err = fmt.Errorf("No compute nodes")
+			break
+		}
+		sort.Strings(hostnames)
+
+		event.Target = hostnames[r.Intn(len(hostnames))]
+		event.Err = KillLauncher(ctx, event.Target)
+	case ChaosDisconnectClients:
+		event.Target = "ciao-scheduler"
+		event.Err = DisconnectClients(ctx)
+	case ChaosDeleteInstance:
+		if len(report.Surviving) == 0 {
+			event.Err = fmt.Errorf("No instances left to delete")
+			break
+		}
+
+		i := r.Intn(len(report.Surviving))
+		event.Target = report.Surviving[i]
+		event.Err = DeleteInstance(ctx, tenant, event.Target)
+		if event.Err == nil {
+			report.Deleted = append(report.Deleted, event.Target)
+			report.Surviving = append(report.Surviving[:i], report.Surviving[i+1:]...)
+		}
+	default:
+		event.Err = fmt.Errorf("Unknown chaos action %s", action)
+	}
+
+	return event
+}
+
+// RunChaos performs opts.Rounds actions chosen at random from opts.Actions
+// on a cluster running the given instances of tenant.  The failures of the
+// actions themselves are recorded in the returned report rather than
+// aborting the run, as an unreachable service is an expected consequence of
+// the preceding actions.  An error is returned if ctx expires.  Once RunChaos
+// returns, WaitForReconciliation can be used to check that the controller
+// recovers.  An error will be returned if the following environment
+// variables are not set; CIAO_ADMIN_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func RunChaos(ctx context.Context, tenant string, instances []string,
+	opts ChaosOptions) (*ChaosReport, error) {
+	actions := opts.Actions
+	if len(actions) == 0 {
+		actions = ChaosActions
+	}
+
+	report := &ChaosReport{
+		Seed:      opts.Seed,
+		Surviving: append([]string(nil), instances...),
+	}
+	if report.Seed == 0 {
+		report.Seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(report.Seed))
+
+	for i := 0; i < opts.Rounds; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(opts.Interval):
+			case <-ctx.Done():
+				return report, ctx.Err()
+			}
+		}
+
+		action := actions[r.Intn(len(actions))]
+		report.Events = append(report.Events,
+			runChaosAction(ctx, r, tenant, action, report))
+	}
+
+	return report, nil
+}
+
+// checkReconciled checks that none of the deleted instances are still
+// listed and that all the surviving instances have been scheduled.  It
+// returns an error if a surviving instance has been lost.
+func checkReconciled(surviving, deleted []string, statuses map[string]string) (bool, error) {
+	finished := true
+
+	for _, instance := range deleted {
+		if _, ok := statuses[instance]; ok {
+			finished = false
+		}
+	}
+
+	for _, instance := range surviving {
+		status, ok := statuses[instance]
+		if !ok {
+			return false, fmt.Errorf("Instance %s has been lost", instance)
+		}
+
+		if status == "pending" {
+			finished = false
+		}
+	}
+
+	return finished, nil
+}
+
+// WaitForReconciliation waits for the controller to recover from the actions
+// performed by RunChaos.  The state of the cluster is reconciled once all
+// the compute nodes are ready, the instances deleted by RunChaos are gone
+// and the surviving instances are either active or exited.  An error is
+// returned if a surviving instance disappears or if the cluster has not
+// been reconciled by the time ctx expires.  An error will be returned if
+// the following environment variables are not set;
+// CIAO_ADMIN_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func WaitForReconciliation(ctx context.Context, tenant string, report *ChaosReport) error {
+	for {
+		var pending string
+
+		nodes, err := GetComputeNodes(ctx)
+		if err != nil {
+			pending = err.Error()
+		}
+
+		for _, n := range nodes {
+			if n.Status != "READY" {
+				pending = fmt.Sprintf("Node %s is %s", n.ID, n.Status)
+			}
+		}
+
+		if pending == "" {
+			statuses, err := RetrieveInstancesStatuses(ctx, tenant)
+			if err != nil {
+				pending = err.Error()
+			} else {
+				finished, err := checkReconciled(report.Surviving, report.Deleted, statuses)
+				if err != nil {
+					return err
+				}
+
+				if finished {
+					return nil
+				}
+				pending = "Instances have not been reconciled"
+			}
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("Cluster not reconciled (seed %d): %s", report.Seed, pending)
+		}
+	}
+}
@@ -337,11 +337,11 @@ func DeleteInstances(ctx context.Context, tenant string, instances []string) ([]
 }
 
 // DeleteAllInstances deletes all the instances created for the specified tenant
-// by calling ciao delete instance --all. It returns an error if the ciao
-// command fails. An error will be returned if the following environment
+// by calling ciao delete instance --all --force. It returns an error if the
+// ciao command fails. An error will be returned if the following environment
 // variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
 func DeleteAllInstances(ctx context.Context, tenant string) error {
-	args := []string{"delete", "instance", "--all"}
+	args := []string{"delete", "instance", "--all", "--force"}
 	_, err := RunCIAOCmd(ctx, tenant, args)
 	return err
 }
@@ -0,0 +1,202 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package bat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetTenantCNCI returns the ID and the details of the CNCI serving a given
+// tenant. The information is retrieved using the ciao list cncis command.
+// An error will be returned if the tenant has no CNCI or if the following
+// environment variables are not set; CIAO_ADMIN_CLIENT_CERT_FILE,
+// CIAO_CONTROLLER.
+func GetTenantCNCI(ctx context.Context, tenant string) (string, *CNCI, error) {
+	CNCIs, err := GetCNCIs(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for ID, cnci := range CNCIs {
+		if cnci.TenantID == tenant {
+			return ID, cnci, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("No CNCI found for tenant %s", tenant)
+}
+
+// WaitForTenantCNCI blocks until the CNCI of the given tenant has been
+// assigned an IP address or the context is cancelled. An error will be
+// returned if the following environment variables are not set;
+// CIAO_ADMIN_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func WaitForTenantCNCI(ctx context.Context, tenant string) (*CNCI, error) {
+	for {
+		_, cnci, err := GetTenantCNCI(ctx, tenant)
+		if err == nil && cnci.IPv4 != "" {
+			return cnci, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Test timed out waiting for CNCI of tenant %s",
+				tenant)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// GetInstanceExternalIP returns the external ip mapped to the specified
+// instance. An error will be returned if no address is mapped to the
+// instance or if the following environment variables are not set;
+// CIAO_ADMIN_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func GetInstanceExternalIP(ctx context.Context, tenant, instance string) (*ExternalIP, error) {
+	IPs, err := ListExternalIPs(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, IP := range IPs {
+		if IP.InstanceID == instance {
+			return IP, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No external IP mapped to instance %s", instance)
+}
+
+// MapExternalIPAndWait maps an external ip from a given pool to an instance
+// and waits for the mapping to be reported by the controller. The mapped
+// address is returned. An error will be returned if the following
+// environment variables are not set; CIAO_CLIENT_CERT_FILE,
+// CIAO_ADMIN_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func MapExternalIPAndWait(ctx context.Context, tenant, pool, instance string) (*ExternalIP, error) {
+	err := MapExternalIP(ctx, tenant, pool, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		IP, err := GetInstanceExternalIP(ctx, tenant, instance)
+		if err == nil {
+			return IP, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Test timed out waiting for external IP of instance %s",
+				instance)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// PingAddress sends a single ICMP echo request to address using the ping
+// command and returns an error if no reply is received.
+func PingAddress(ctx context.Context, address string) error {
+	cmd := exec.CommandContext(ctx, "ping", "-c", "1", "-W", "1", address)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Unable to ping %s : %v\n%s", address, err,
+			string(out))
+	}
+
+	return nil
+}
+
+// WaitForPing blocks until address replies to an ICMP echo request or the
+// context is cancelled.
+func WaitForPing(ctx context.Context, address string) error {
+	for {
+		err := PingAddress(ctx, address)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Test timed out waiting for %s to reply to ping : %v",
+				address, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// CheckSSH connects to the SSH server listening at address:port and verifies
+// that it sends an SSH protocol identification string.
+func CheckSSH(ctx context.Context, address string, port int) error {
+	var d net.Dialer
+
+	hostPort := net.JoinHostPort(address, strconv.Itoa(port))
+	conn, err := d.DialContext(ctx, "tcp", hostPort)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s : %v", hostPort, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Unable to read SSH banner from %s : %v", hostPort, err)
+	}
+
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("Unexpected SSH banner from %s : %s", hostPort,
+			strings.TrimSpace(banner))
+	}
+
+	return nil
+}
+
+// WaitForInstanceSSH blocks until the SSH server of an instance can be
+// reached through the ssh ip and port reported by the controller or the
+// context is cancelled. An error will be returned if the following
+// environment variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func WaitForInstanceSSH(ctx context.Context, tenant, instance string) error {
+	for {
+		i, err := GetInstance(ctx, tenant, instance)
+		if err != nil {
+			return err
+		}
+
+		if i.SSHIP != "" && i.SSHPort != 0 {
+			err = CheckSSH(ctx, i.SSHIP, i.SSHPort)
+			if err == nil {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Test timed out waiting for SSH access to instance %s : %v",
+				instance, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
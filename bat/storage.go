@@ -19,6 +19,8 @@ package bat
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/types"
@@ -64,11 +66,7 @@ func DeleteVolume(ctx context.Context, tenant, ID string) error {
 	return err
 }
 
-// AddVolume adds a new volume to a tenant. The volume is added using ciao
-// create volume. An error will be returned if the following environment
-// variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
-func AddVolume(ctx context.Context, tenant, source, sourceType string,
-	options *VolumeOptions) (string, error) {
+func computeVolumeAddArgs(source, sourceType string, options *VolumeOptions) []string {
 	args := []string{"create", "volume", "-f", "{{ tojson . }}"}
 
 	if sourceType != "" {
@@ -94,6 +92,16 @@ func AddVolume(ctx context.Context, tenant, source, sourceType string,
 		args = append(args, "--size", fmt.Sprintf("%d", options.Size))
 	}
 
+	return args
+}
+
+// AddVolume adds a new volume to a tenant. The volume is added using ciao
+// create volume. An error will be returned if the following environment
+// variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func AddVolume(ctx context.Context, tenant, source, sourceType string,
+	options *VolumeOptions) (string, error) {
+	args := computeVolumeAddArgs(source, sourceType, options)
+
 	var vol types.Volume
 	err := RunCIAOCmdJS(ctx, tenant, args, &vol)
 	if err != nil {
@@ -103,6 +111,24 @@ func AddVolume(ctx context.Context, tenant, source, sourceType string,
 	return vol.ID, nil
 }
 
+// CreateVolumeFromImage creates a new bootable volume whose contents are
+// cloned from an existing image. An error will be returned if the following
+// environment variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func CreateVolumeFromImage(ctx context.Context, tenant, image string,
+	options *VolumeOptions) (string, error) {
+	return AddVolume(ctx, tenant, image, "image", options)
+}
+
+// CloneVolume creates a point in time copy of an existing volume.  The
+// storage backend implements the copy by snapshotting the source volume,
+// so this is the way to exercise volume snapshots from a BAT run. An error
+// will be returned if the following environment variables are not set;
+// CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func CloneVolume(ctx context.Context, tenant, volume string,
+	options *VolumeOptions) (string, error) {
+	return AddVolume(ctx, tenant, volume, "volume", options)
+}
+
 // GetAllVolumes returns a map of all the volumes defined in the specified
 // tenant. The map is indexed by volume ID. The map is retrieved by calling
 // ciao list volumes. An error will be returned if the following environment
@@ -152,6 +178,72 @@ func WaitForVolumeStatus(ctx context.Context, tenant, volume, status string) err
 	return nil
 }
 
+// GetVolumeCount returns the number of volumes owned by the specified
+// tenant. An error will be returned if the following environment variables
+// are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func GetVolumeCount(ctx context.Context, tenant string) (int, error) {
+	args := []string{"list", "volumes", "-f", "{{len .}}"}
+	data, err := RunCIAOCmd(ctx, tenant, args)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(string(data))
+}
+
+// DeleteVolumeAndWait deletes a volume and then blocks until the volume no
+// longer appears in the tenant's list of volumes or the context is
+// cancelled. An error will be returned if the following environment
+// variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func DeleteVolumeAndWait(ctx context.Context, tenant, volume string) error {
+	err := DeleteVolume(ctx, tenant, volume)
+	if err != nil {
+		return err
+	}
+
+	for {
+		volumes, err := GetAllVolumes(ctx, tenant)
+		if err != nil {
+			return err
+		}
+		if _, ok := volumes[volume]; !ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Test timed out waiting for volume %s deletion",
+				volume)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// DeleteAllVolumes deletes all of the volumes owned by a tenant. Volumes that
+// are attached to instances cannot be deleted and will cause an error to be
+// returned once all the other volumes have been deleted. An error will also
+// be returned if the following environment variables are not set;
+// CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func DeleteAllVolumes(ctx context.Context, tenant string) error {
+	volumes, err := GetAllVolumes(ctx, tenant)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for ID := range volumes {
+		if err := DeleteVolume(ctx, tenant, ID); err != nil {
+			failed = append(failed, ID)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Unable to delete volumes: %s",
+			strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
 // AttachVolume attaches a volume to an instance. An error will be returned if
 // the following environment variables are not set; CIAO_CLIENT_CERT_FILE,
 // CIAO_CONTROLLER.
@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package bat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StressResult aggregates the outcome of a set of operations executed
+// concurrently by one of the stress helpers.
+type StressResult struct {
+	// Operations is the number of operations that were attempted
+	Operations int
+
+	// Failures is the number of operations that returned an error
+	Failures int
+
+	// Errors contains one entry per operation.  The entry is nil if the
+	// operation succeeded.
+	Errors []error
+
+	// Latencies contains the duration of each operation, successful or not
+	Latencies []time.Duration
+
+	// Elapsed is the wall clock time taken to complete all the operations
+	Elapsed time.Duration
+
+	// Min, Max, Mean and P95 summarise the latencies of the operations
+	Min  time.Duration
+	Max  time.Duration
+	Mean time.Duration
+	P95  time.Duration
+}
+
+// String returns a one line summary of the StressResult
+func (r *StressResult) String() string {
+	return fmt.Sprintf("%d operations, %d failures in %v (min %v, mean %v, p95 %v, max %v)",
+		r.Operations, r.Failures, r.Elapsed, r.Min, r.Mean, r.P95, r.Max)
+}
+
+func (r *StressResult) computeLatencyStats() {
+	if len(r.Latencies) == 0 {
+		return
+	}
+
+	sorted := make([]time.Duration, len(r.Latencies))
+	copy(sorted, r.Latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+
+	r.Min = sorted[0]
+	r.Max = sorted[len(sorted)-1]
+	r.Mean = total / time.Duration(len(sorted))
+	r.P95 = sorted[(len(sorted)*95+99)/100-1]
+}
+
+// runConcurrently invokes op num times using at most concurrency goroutines
+// and records the latency and result of each invocation.
+func runConcurrently(ctx context.Context, num, concurrency int,
+	op func(ctx context.Context, i int) error) *StressResult {
+	if concurrency <= 0 || concurrency > num {
+		concurrency = num
+	}
+
+	result := &StressResult{
+		Operations: num,
+		Errors:     make([]error, num),
+		Latencies:  make([]time.Duration, num),
+	}
+
+	var wg sync.WaitGroup
+	work := make(chan int)
+
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				opStart := time.Now()
+				result.Errors[i] = op(ctx, i)
+				result.Latencies[i] = time.Since(opStart)
+			}
+		}()
+	}
+
+	for i := 0; i < num; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	for _, err := range result.Errors {
+		if err != nil {
+			result.Failures++
+		}
+	}
+	result.computeLatencyStats()
+
+	return result
+}
+
+// LaunchInstancesConcurrently launches num instances of the specified
+// workload, issuing one ciao create instance command per instance with at
+// most concurrency commands in flight at any one time.  It returns the UUIDs
+// of the instances that were successfully created along with a StressResult
+// describing the latency and outcome of each request.  An error is returned
+// if at least one of the requests failed. An error will also be returned if
+// the following environment variables are not set; CIAO_CLIENT_CERT_FILE,
+// CIAO_CONTROLLER.
+func LaunchInstancesConcurrently(ctx context.Context, tenant, workload string,
+	num, concurrency int) ([]string, *StressResult, error) {
+	created := make([][]string, num)
+
+	result := runConcurrently(ctx, num, concurrency,
+		func(ctx context.Context, i int) error {
+			var err error
+			created[i], err = LaunchInstances(ctx, tenant, workload, 1)
+			return err
+		})
+
+	var instances []string
+	for _, c := range created {
+		instances = append(instances, c...)
+	}
+
+	if result.Failures > 0 {
+		return instances, result, fmt.Errorf("%d of %d instance launches failed",
+			result.Failures, num)
+	}
+
+	return instances, result, nil
+}
+
+// DeleteInstancesConcurrently deletes the specified instances with at most
+// concurrency ciao delete instance commands in flight at any one time.  The
+// indices of the errors in the returned StressResult match the indices of the
+// instances slice.  An error is returned if at least one of the deletions
+// failed. An error will also be returned if the following environment
+// variables are not set; CIAO_CLIENT_CERT_FILE, CIAO_CONTROLLER.
+func DeleteInstancesConcurrently(ctx context.Context, tenant string,
+	instances []string, concurrency int) (*StressResult, error) {
+	result := runConcurrently(ctx, len(instances), concurrency,
+		func(ctx context.Context, i int) error {
+			return DeleteInstance(ctx, tenant, instances[i])
+		})
+
+	if result.Failures > 0 {
+		return result, fmt.Errorf("%d of %d instance deletions failed",
+			result.Failures, len(instances))
+	}
+
+	return result, nil
+}
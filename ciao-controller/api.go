@@ -26,6 +26,7 @@ import (
 
 	"github.com/ciao-project/ciao/ciao-controller/types"
 	"github.com/ciao-project/ciao/payloads"
+	"github.com/ciao-project/ciao/service"
 	"github.com/ciao-project/ciao/ssntp"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
@@ -57,8 +58,11 @@ func errorResponse(err error) APIResponse {
 	switch err {
 	case types.ErrQuota:
 		return APIResponse{http.StatusForbidden, nil}
+	case types.ErrBadRequest:
+		return APIResponse{http.StatusBadRequest, nil}
 	case types.ErrTenantNotFound,
-		types.ErrInstanceNotFound:
+		types.ErrInstanceNotFound,
+		types.ErrNodeNotFound:
 		return APIResponse{http.StatusNotFound, nil}
 	default:
 		return APIResponse{http.StatusInternalServerError, nil}
@@ -83,6 +87,10 @@ func pagerQueryParse(r *http.Request) (int, int, string) {
 		} else {
 			limit = (int)(l)
 		}
+
+		if limit > types.MaxPageSize {
+			limit = types.MaxPageSize
+		}
 	}
 
 	if values["marker"] != nil {
@@ -99,6 +107,21 @@ func pagerQueryParse(r *http.Request) (int, int, string) {
 	return limit, offset, marker
 }
 
+// markerIndex returns the position of the item following marker in a list
+// of n items sorted by ID, id returning the ID of the i-th item, or -1 if
+// marker is not in the list.  The marker is found by binary search so that
+// paging through large lists does not require a scan per page.
+func markerIndex(n int, id func(i int) string, marker string) int {
+	i := sort.Search(n, func(i int) bool {
+		return id(i) >= marker
+	})
+	if i == n || id(i) != marker {
+		return -1
+	}
+
+	return i + 1
+}
+
 type nodePager struct {
 	ctl   *controller
 	nodes []types.CiaoNode
@@ -140,19 +163,14 @@ func (pager *nodePager) nextPage(filterType pagerFilterType, filter string, r *h
 			offset)
 	}
 
-	for i, node := range pager.nodes {
-		if node.ID == lastSeen {
-			if i >= len(pager.nodes)-1 {
-				return pager.getNodes(filterType, filter, nil,
-					limit, 0)
-			}
-
-			return pager.getNodes(filterType, filter,
-				pager.nodes[i+1:], limit, 0)
-		}
+	next := markerIndex(len(pager.nodes), func(i int) string {
+		return pager.nodes[i].ID
+	}, lastSeen)
+	if next == -1 {
+		return types.CiaoNodes{}, fmt.Errorf("Item %s not found", lastSeen)
 	}
 
-	return types.CiaoNodes{}, fmt.Errorf("Item %s not found", lastSeen)
+	return pager.getNodes(filterType, filter, pager.nodes[next:], limit, 0)
 }
 
 type nodeServerPager struct {
@@ -201,19 +219,15 @@ func (pager *nodeServerPager) nextPage(filterType pagerFilterType, filter string
 			pager.instances, 0, offset)
 	}
 
-	for i, instance := range pager.instances {
-		if instance.ID == lastSeen {
-			if i >= len(pager.instances)-1 {
-				return pager.getNodeServers(filterType, filter,
-					nil, limit, 0)
-			}
-
-			return pager.getNodeServers(filterType, filter,
-				pager.instances[i+1:], limit, 0)
-		}
+	next := markerIndex(len(pager.instances), func(i int) string {
+		return pager.instances[i].ID
+	}, lastSeen)
+	if next == -1 {
+		return types.CiaoServersStats{}, fmt.Errorf("Item %s not found", lastSeen)
 	}
 
-	return types.CiaoServersStats{}, fmt.Errorf("Item %s not found", lastSeen)
+	return pager.getNodeServers(filterType, filter, pager.instances[next:],
+		limit, 0)
 }
 
 func findQuota(qds []types.QuotaDetails, name string) *types.QuotaDetails {
@@ -264,6 +278,57 @@ func getResources(c *controller, w http.ResponseWriter, r *http.Request) (APIRes
 	return APIResponse{http.StatusOK, tenantResource}, nil
 }
 
+func updateResources(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	t, err := c.ds.GetTenant(tenant)
+	if err != nil || t == nil {
+		return errorResponse(types.ErrTenantNotFound), types.ErrTenantNotFound
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	var req types.CiaoTenantQuotaUpdate
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(types.ErrBadRequest), types.ErrBadRequest
+	}
+
+	limits := []struct {
+		name  string
+		value *int
+	}{
+		{"tenant-instances-quota", req.InstanceLimit},
+		{"tenant-vcpu-quota", req.VCPULimit},
+		{"tenant-mem-quota", req.MemLimit},
+		{"tenant-storage-quota", req.DiskLimit},
+	}
+
+	var qds []types.QuotaDetails
+	for _, l := range limits {
+		if l.value == nil {
+			continue
+		}
+		if *l.value < -1 {
+			return errorResponse(types.ErrBadRequest), types.ErrBadRequest
+		}
+		qds = append(qds, types.QuotaDetails{Name: l.name, Value: *l.value})
+	}
+
+	// Launches in progress check each of their instances against the
+	// limits in force when it is created, so they pick up the new ones.
+	err = c.UpdateQuotas(t.ID, qds)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return getResources(c, w, r)
+}
+
 func tenantQueryParse(r *http.Request) (time.Time, time.Time, error) {
 	values := r.URL.Query()
 	var startTime, endTime time.Time
@@ -306,13 +371,14 @@ func getUsage(c *controller, w http.ResponseWriter, r *http.Request) (APIRespons
 	return APIResponse{http.StatusOK, usage}, nil
 }
 
-type instanceAction func(string) error
+type instanceAction func(string, string) error
 
 func serversAction(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
 	var servers types.CiaoServersAction
 	var actionFunc instanceAction
+	var actionName string
 	var statusFilter string
 
 	body, err := ioutil.ReadAll(r.Body)
@@ -327,30 +393,61 @@ func serversAction(c *controller, w http.ResponseWriter, r *http.Request) (APIRe
 
 	if servers.Action == "os-start" {
 		actionFunc = c.restartInstance
+		actionName = types.InstanceActionStart
 		statusFilter = payloads.Exited
 	} else if servers.Action == "os-stop" {
 		actionFunc = c.stopInstance
+		actionName = types.InstanceActionStop
 		statusFilter = payloads.Running
 	} else if servers.Action == "os-delete" {
-		actionFunc = c.deleteInstance
+		actionFunc = func(instanceID string, requestID string) error {
+			i, err := c.ds.GetInstance(instanceID)
+			if err != nil {
+				return err
+			}
+			return c.deleteServerInstance(i, requestID)
+		}
+		actionName = types.InstanceActionDelete
 		statusFilter = ""
 	} else {
 		return APIResponse{http.StatusServiceUnavailable, nil},
 			errors.New("Unsupported action")
 	}
 
+	user := service.GetUser(r.Context())
+	requestID := service.GetRequestID(r.Context())
+
+	results := types.CiaoServersActionResults{
+		Action:  servers.Action,
+		Results: []types.CiaoServerActionResult{},
+	}
+
+	// The action is attempted on every instance, a failure on one of
+	// them is reported in the results rather than aborting the request.
+	addResult := func(instanceID string, err error) {
+		res := types.CiaoServerActionResult{
+			ServerID: instanceID,
+			Success:  err == nil,
+		}
+		if err != nil {
+			glog.Warningf("%s of instance %s failed: %v", servers.Action, instanceID, err)
+			res.Reason = err.Error()
+		}
+		results.Results = append(results.Results, res)
+	}
+
 	if len(servers.ServerIDs) > 0 {
 		for _, instanceID := range servers.ServerIDs {
 			// make sure the instance belongs to the tenant
-			_, err := c.ds.GetTenantInstance(tenant, instanceID)
+			instance, err := c.ds.GetTenantInstance(tenant, instanceID)
 			if err != nil {
-				return errorResponse(err), err
+				addResult(instanceID, err)
+				continue
 			}
 
-			err = actionFunc(instanceID)
-			if err != nil {
-				return errorResponse(err), err
-			}
+			err = actionFunc(instanceID, requestID)
+			c.recordInstanceAction(instance, actionName, user, err)
+			addResult(instanceID, err)
 		}
 	} else {
 		/* We want to act on all relevant instances */
@@ -365,14 +462,13 @@ func serversAction(c *controller, w http.ResponseWriter, r *http.Request) (APIRe
 				continue
 			}
 
-			err = actionFunc(instance.ID)
-			if err != nil {
-				return errorResponse(err), err
-			}
+			err = actionFunc(instance.ID, requestID)
+			c.recordInstanceAction(instance, actionName, user, err)
+			addResult(instance.ID, err)
 		}
 	}
 
-	return APIResponse{http.StatusAccepted, nil}, nil
+	return APIResponse{http.StatusAccepted, results}, nil
 }
 
 func trimComputeNodes(c *controller, nodeList types.CiaoNodes, targetRole ssntp.Role) (types.CiaoNodes, error) {
@@ -457,6 +553,35 @@ func listNodes(c *controller, w http.ResponseWriter, r *http.Request) (APIRespon
 	return listSubsetOfNodes(c, w, r, ssntp.UNKNOWN)
 }
 
+func showNode(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	nodeID := vars["node"]
+
+	node, err := c.ds.GetNodeDetails(nodeID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, node}, nil
+}
+
+func evacuateNode(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	nodeID := vars["node"]
+
+	_, err := c.ds.GetNodeDetails(nodeID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = c.EvacuateNode(nodeID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
 func listNodeServers(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	nodeID := vars["node"]
@@ -468,17 +593,27 @@ func listNodeServers(c *controller, w http.ResponseWriter, r *http.Request) (API
 		return errorResponse(err), err
 	}
 
+	byID := make(map[string]*types.Instance, len(instances))
 	for _, instance := range instances {
-		for i := range serversStats.Servers {
-			if serversStats.Servers[i].ID != instance.ID {
-				continue
-			}
+		byID[instance.ID] = instance
+	}
 
-			serversStats.Servers[i].TenantID = instance.TenantID
-			serversStats.Servers[i].IPv4 = instance.IPAddress
+	for i := range serversStats.Servers {
+		instance, ok := byID[serversStats.Servers[i].ID]
+		if !ok {
+			continue
 		}
+
+		serversStats.Servers[i].TenantID = instance.TenantID
+		serversStats.Servers[i].IPv4 = instance.IPAddress
 	}
 
+	// The servers must be listed in the same order for every page
+	// requested with a marker.
+	sort.Slice(serversStats.Servers, func(i, j int) bool {
+		return serversStats.Servers[i].ID < serversStats.Servers[j].ID
+	})
+
 	pager := nodeServerPager{
 		ctl:       c,
 		instances: serversStats.Servers,
@@ -617,6 +752,22 @@ func clearEvents(c *controller, w http.ResponseWriter, r *http.Request) (APIResp
 	return APIResponse{http.StatusAccepted, nil}, nil
 }
 
+func getEventRetention(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return APIResponse{http.StatusOK, c.eventRetention()}, nil
+}
+
+func deleteTenant(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenant"]
+
+	err := c.DeleteTenant(tenantID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusNoContent, nil}, nil
+}
+
 func traceData(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	label := vars["label"]
@@ -641,3 +792,15 @@ func traceData(c *controller, w http.ResponseWriter, r *http.Request) (APIRespon
 
 	return APIResponse{http.StatusOK, traceData}, nil
 }
+
+func traceFrames(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	label := vars["label"]
+
+	frames, err := c.ds.GetTraceFrames(label)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, types.CiaoTraceFrames{Frames: frames}}, nil
+}
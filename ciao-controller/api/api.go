@@ -15,12 +15,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +37,11 @@ import (
 // Port is the default port number for the ciao API.
 const Port = 8889
 
+// RequestIDHeader is the response header holding the ID assigned to an API
+// request.  The ID appears in the log entries of every service involved in
+// handling the request.
+const RequestIDHeader = "X-Ciao-Request-Id"
+
 const (
 	// PoolsV1 is the content-type string for v1 of our pools resource
 	PoolsV1 = "x.ciao.pools.v1"
@@ -58,6 +66,22 @@ const (
 
 	// InstancesV1 is the content-type string for v1 of our intances resource
 	InstancesV1 = "x.ciao.instances.v1"
+
+	// ReservedIPsV1 is the content-type string for v1 of our reserved-ips resource
+	ReservedIPsV1 = "x.ciao.reserved-ips.v1"
+
+	// SubnetsV1 is the content-type string for v1 of our subnets resource
+	SubnetsV1 = "x.ciao.subnets.v1"
+)
+
+const (
+	// Version is the version of the ciao API served by the controller.  It
+	// is increased whenever the format of a request or a response changes.
+	Version = 1
+
+	// MinVersion is the oldest version of the ciao API whose clients are
+	// still supported by the controller.
+	MinVersion = 1
 )
 
 // ErrorImage defines all possible image handling errors
@@ -70,6 +94,10 @@ var (
 	// ErrImageSaving is returned when an image is being uploaded.
 	ErrImageSaving = errors.New("Image being uploaded")
 
+	// ErrImageUploadInProgress is returned when data is uploaded for an
+	// image whose previous upload has not completed.
+	ErrImageUploadInProgress = errors.New("Image upload already in progress")
+
 	// ErrBadUUID is returned when an invalid UUID is specified
 	ErrBadUUID = errors.New("Bad UUID")
 
@@ -98,7 +126,18 @@ type RequestedVolume struct {
 	Internal    bool   `json:"-"`
 }
 
+// BootStep describes one tier of a composed launch.  A step is only
+// started once all the instances of the steps it depends on are running.
+type BootStep struct {
+	Name       string   `json:"name"`
+	WorkloadID string   `json:"workload_id"`
+	Instances  int      `json:"instances"`
+	DependsOn  []string `json:"depends_on,omitempty"`
+}
+
 // CreateServerRequest contains the details needed to start new instance(s)
+// ExpiresIn, if set, is the number of seconds after which the instances
+// are deleted.
 type CreateServerRequest struct {
 	Server struct {
 		ID           string            `json:"id"`
@@ -108,9 +147,31 @@ type CreateServerRequest struct {
 		MaxInstances int               `json:"max_count"`
 		MinInstances int               `json:"min_count"`
 		Metadata     map[string]string `json:"metadata,omitempty"`
+		BootSteps    []BootStep        `json:"boot_steps,omitempty"`
+		UserData     string            `json:"user_data,omitempty"`
+		UserDataMode string            `json:"user_data_mode,omitempty"`
+		IPAddress    string            `json:"ip_address,omitempty"`
+		SubnetID     string            `json:"subnet_id,omitempty"`
+		ExpiresIn    int               `json:"expires_in,omitempty"`
 	} `json:"server"`
 }
 
+// UserData modes supported by CreateServerRequest.  UserData contains a
+// base64 encoded cloud-init config which, depending on UserDataMode, is
+// either merged with the config of the workload or replaces it.
+const (
+	UserDataMerge   = "merge"
+	UserDataReplace = "replace"
+)
+
+// BootPlan is returned in response to a CreateServerRequest containing
+// BootSteps.  Stages lists the names of the steps in the order in which
+// they will be started; the steps of a single stage are started together.
+// Progress is reported through the event log.
+type BootPlan struct {
+	Stages [][]string `json:"stages"`
+}
+
 // PrivateAddresses contains information about a single instance network
 // interface.
 type PrivateAddresses struct {
@@ -131,12 +192,50 @@ type ServerDetails struct {
 	TenantID         string             `json:"tenant_id"`
 	SSHIP            string             `json:"ssh_ip"`
 	SSHPort          int                `json:"ssh_port"`
+	DeleteAt         *time.Time         `json:"delete_at,omitempty"`
+	ExpiresAt        *time.Time         `json:"expires_at,omitempty"`
+	Metadata         map[string]string  `json:"metadata,omitempty"`
+}
+
+// LaunchFailure describes an instance of a CreateServerRequest that
+// could not be started.
+type LaunchFailure struct {
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
 }
 
-// Servers holds multiple servers including a count
+// Servers holds multiple servers including a count.  When returned in
+// response to a CreateServerRequest Failures lists the instances that
+// could not be started.
 type Servers struct {
 	TotalServers int             `json:"total_servers"`
 	Servers      []ServerDetails `json:"servers"`
+	Failures     []LaunchFailure `json:"failures,omitempty"`
+}
+
+// InstanceActions holds the history of the actions performed on an
+// instance, oldest first.
+type InstanceActions struct {
+	Actions []types.InstanceAction `json:"instance_actions"`
+}
+
+// InstanceCrashes holds the crashes of an instance, oldest first.  The
+// artifacts of a crash stay on the node that ran the instance, under the
+// path given in Artifacts, and must be fetched from there.  They are
+// removed along with the crash records when the instance is deleted.
+type InstanceCrashes struct {
+	Crashes []types.InstanceCrash `json:"crashes"`
+}
+
+// ServerMetadata holds the key/value metadata of an instance.
+type ServerMetadata struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ServerMetadataItem holds a single key/value pair of the metadata of an
+// instance.
+type ServerMetadataItem struct {
+	Meta map[string]string `json:"meta"`
 }
 
 // Server holds a single server's worth of details.
@@ -164,6 +263,10 @@ type HTTPErrorData struct {
 	Code    int    `json:"code"`
 	Name    string `json:"name"`
 	Message string `json:"message"`
+
+	// Quotas lists the quotas exceeded by requests refused for
+	// being over quota.
+	Quotas []types.QuotaExcess `json:"quotas,omitempty"`
 }
 
 // HTTPReturnErrorCode represents the unmarshalled version for Return codes
@@ -181,32 +284,56 @@ type Response struct {
 }
 
 func errorResponse(err error) Response {
+	if _, ok := err.(*types.QuotaError); ok {
+		return Response{http.StatusForbidden, nil}
+	}
+
 	switch err {
 	case types.ErrPoolNotFound,
 		types.ErrTenantNotFound,
 		types.ErrAddressNotFound,
 		types.ErrInstanceNotFound,
-		types.ErrWorkloadNotFound:
+		types.ErrWorkloadNotFound,
+		types.ErrSubnetNotFound,
+		types.ErrMetadataNotFound:
 		return Response{http.StatusNotFound, nil}
 
 	case types.ErrQuota,
+		types.ErrMinInstances,
 		types.ErrInstanceNotAssigned,
 		types.ErrDuplicateSubnet,
 		types.ErrDuplicateIP,
 		types.ErrInvalidIP,
+		types.ErrIPInUse,
+		types.ErrBadSubnet,
+		types.ErrSubnetInUse,
 		types.ErrPoolNotEmpty,
 		types.ErrInvalidPoolAddress,
 		types.ErrBadRequest,
+		types.ErrBadBootSteps,
 		types.ErrPoolEmpty,
 		types.ErrDuplicatePoolName,
-		types.ErrWorkloadInUse:
+		types.ErrBadName,
+		types.ErrDuplicateName,
+		types.ErrWorkloadInUse,
+		types.ErrInstanceDeleted,
+		types.ErrInstanceNotDeleted:
 		return Response{http.StatusForbidden, nil}
 
+	case ErrImageUploadInProgress:
+		return Response{http.StatusConflict, nil}
+
 	default:
 		return Response{http.StatusInternalServerError, nil}
 	}
 }
 
+// sizer is implemented by raw response data whose size is known before it
+// is streamed, e.g., image files.
+type sizer interface {
+	Size() int64
+}
+
 // Handler is a custom handler for the compute APIs.
 // This custom handler allows us to more cleanly return an error and response,
 // and pass some package level context into the handler.
@@ -237,6 +364,10 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Message: err.Error(),
 		}
 
+		if qe, ok := err.(*types.QuotaError); ok {
+			data.Quotas = qe.Excesses
+		}
+
 		code := HTTPReturnErrorCode{
 			Error: data,
 		}
@@ -253,6 +384,39 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// raw data, e.g., image files, is streamed as is.  The first chunk
+	// is read before the status is sent so that data which cannot be
+	// read at all is reported as an error, and the connection is aborted
+	// if reading fails later on so that clients don't get truncated data.
+	if data, ok := resp.response.(io.ReadCloser); ok {
+		defer func() { _ = data.Close() }()
+
+		buf := make([]byte, 32*1024)
+		n, err := io.ReadAtLeast(data, buf, 1)
+		if err != nil && err != io.EOF {
+			glog.Warningf("Error reading response to request: %s: %v", r.URL.String(), err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if s, ok := data.(sizer); ok {
+			w.Header().Set("Content-Length", strconv.FormatInt(s.Size(), 10))
+		}
+		w.WriteHeader(resp.status)
+
+		_, err = w.Write(buf[:n])
+		if err == nil {
+			_, err = io.Copy(w, data)
+		}
+		if err != nil {
+			glog.Warningf("Error streaming response to request: %s: %v", r.URL.String(), err)
+			panic(http.ErrAbortHandler)
+		}
+		return
+	}
+
 	b, err := json.Marshal(resp.response)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError),
@@ -265,6 +429,15 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(b)
 }
 
+func showVersion(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	version := types.APIVersion{
+		Version:    Version,
+		MinVersion: MinVersion,
+	}
+
+	return Response{http.StatusOK, version}, nil
+}
+
 func listResources(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
 	var links []types.APILink
 	vars := mux.Vars(r)
@@ -381,6 +554,30 @@ func listResources(c *Context, w http.ResponseWriter, r *http.Request) (Response
 		links = append(links, link)
 	}
 
+	// for the "reserved-ips" resource
+	if ok {
+		link = types.APILink{
+			Rel:        "reserved-ips",
+			Version:    ReservedIPsV1,
+			MinVersion: ReservedIPsV1,
+		}
+
+		link.Href = fmt.Sprintf("%s/%s/reserved-ips", c.URL, tenantID)
+		links = append(links, link)
+	}
+
+	// for the "subnets" resource
+	if ok {
+		link = types.APILink{
+			Rel:        "subnets",
+			Version:    SubnetsV1,
+			MinVersion: SubnetsV1,
+		}
+
+		link.Href = fmt.Sprintf("%s/%s/subnets", c.URL, tenantID)
+		links = append(links, link)
+	}
+
 	return Response{http.StatusOK, links}, nil
 }
 
@@ -685,6 +882,35 @@ func deleteWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Respons
 	return Response{http.StatusNoContent, nil}, nil
 }
 
+func updateWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.Workload
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	vars := mux.Vars(r)
+	ID := vars["workload_id"]
+
+	tenantID, ok := vars["tenant"]
+	if !ok {
+		tenantID = "admin"
+	}
+
+	err = c.UpdateWorkload(tenantID, ID, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
 func showWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
 	vars := mux.Vars(r)
 	ID := vars["workload_id"]
@@ -928,6 +1154,17 @@ func listImages(context *Context, w http.ResponseWriter, r *http.Request) (Respo
 	return Response{http.StatusOK, images}, nil
 }
 
+// listAllImages returns the images of all the tenants along with the
+// storage they consume.
+func listAllImages(context *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	usage, err := context.ListAllImages()
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, usage}, nil
+}
+
 // getImage get information about an image by image_id field
 //
 func getImage(context *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
@@ -963,6 +1200,23 @@ func uploadImage(context *Context, w http.ResponseWriter, r *http.Request) (Resp
 	return Response{http.StatusNoContent, nil}, nil
 }
 
+func downloadImage(context *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+
+	tenantID, ok := vars["tenant"]
+	if !ok {
+		tenantID = "admin"
+	}
+
+	data, err := context.DownloadImage(tenantID, imageID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, data}, nil
+}
+
 func deleteImage(context *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
 	vars := mux.Vars(r)
 	imageID := vars["image_id"]
@@ -1003,11 +1257,61 @@ func createVolume(bc *Context, w http.ResponseWriter, r *http.Request) (Response
 	return Response{http.StatusAccepted, vol}, nil
 }
 
+// volumeFilterFromQuery builds a volume filter from the status, bootable,
+// min_size and max_size query parameters.
+func volumeFilterFromQuery(values url.Values) (types.VolumeFilter, error) {
+	var filter types.VolumeFilter
+
+	if status := values.Get("status"); status != "" {
+		switch types.BlockState(status) {
+		case types.Available, types.Attaching, types.InUse, types.Detaching:
+			filter.State = types.BlockState(status)
+		default:
+			return filter, fmt.Errorf("Invalid volume status %s", status)
+		}
+	}
+
+	if bootable := values.Get("bootable"); bootable != "" {
+		b, err := strconv.ParseBool(bootable)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid bootable value %s", bootable)
+		}
+		filter.Bootable = &b
+	}
+
+	var err error
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"min_size", &filter.MinSize}, {"max_size", &filter.MaxSize}} {
+		v := values.Get(p.name)
+		if v == "" {
+			continue
+		}
+		*p.value, err = strconv.Atoi(v)
+		if err != nil || *p.value < 0 {
+			return filter, fmt.Errorf("Invalid %s value %s", p.name, v)
+		}
+	}
+
+	if filter.MaxSize > 0 && filter.MaxSize < filter.MinSize {
+		return filter, fmt.Errorf("max_size %d is smaller than min_size %d",
+			filter.MaxSize, filter.MinSize)
+	}
+
+	return filter, nil
+}
+
 func listVolumesDetail(bc *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
 
-	vols, err := bc.ListVolumesDetail(tenant)
+	filter, err := volumeFilterFromQuery(r.URL.Query())
+	if err != nil {
+		return Response{http.StatusBadRequest, nil}, err
+	}
+
+	vols, err := bc.ListVolumesDetail(tenant, filter)
 	if err != nil {
 		return errorResponse(err), err
 	}
@@ -1137,13 +1441,58 @@ func createInstance(c *Context, w http.ResponseWriter, r *http.Request) (Respons
 		return Response{http.StatusBadRequest, nil}, err
 	}
 
-	resp, err := c.CreateServer(tenant, req)
+	resp, err := c.CreateServer(r.Context(), tenant, req, service.GetUser(r.Context()), service.GetRequestID(r.Context()))
 	if err != nil {
 		return errorResponse(err), err
 	}
 
 	return Response{http.StatusAccepted, resp}, nil
 }
+
+// serverFilter returns a function reporting whether an instance matches the
+// filters of an instance listing query: status, ip, one of the private
+// addresses of the instance, name and created_since, an RFC 3339 time.
+func serverFilter(values url.Values) (func(ServerDetails) bool, error) {
+	status := values.Get("status")
+	ip := values.Get("ip")
+	name := values.Get("name")
+
+	var since time.Time
+	if s := values.Get("created_since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid created_since %q, expected an RFC 3339 time", s)
+		}
+	}
+
+	return func(s ServerDetails) bool {
+		if status != "" && s.Status != status {
+			return false
+		}
+
+		if name != "" && s.Name != name {
+			return false
+		}
+
+		if !since.IsZero() && s.Created.Before(since) {
+			return false
+		}
+
+		if ip == "" {
+			return true
+		}
+
+		for _, a := range s.PrivateAddresses {
+			if a.Addr == ip {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
 func listInstanceDetails(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
@@ -1162,6 +1511,11 @@ func listInstanceDetails(c *Context, w http.ResponseWriter, r *http.Request) (Re
 		}
 	}
 
+	match, err := serverFilter(values)
+	if err != nil {
+		return Response{http.StatusBadRequest, nil}, err
+	}
+
 	servers, err := c.ListServersDetail(tenant)
 	if err != nil {
 		return errorResponse(err), err
@@ -1169,14 +1523,10 @@ func listInstanceDetails(c *Context, w http.ResponseWriter, r *http.Request) (Re
 
 	resp := Servers{}
 
-	if workload != "" {
-		for _, s := range servers {
-			if s.WorkloadID == workload {
-				resp.Servers = append(resp.Servers, s)
-			}
+	for _, s := range servers {
+		if (workload == "" || s.WorkloadID == workload) && match(s) {
+			resp.Servers = append(resp.Servers, s)
 		}
-	} else {
-		resp.Servers = servers
 	}
 
 	resp.TotalServers = len(resp.Servers)
@@ -1202,7 +1552,7 @@ func deleteInstance(c *Context, w http.ResponseWriter, r *http.Request) (Respons
 	tenant := vars["tenant"]
 	server := vars["instance_id"]
 
-	err := c.DeleteServer(tenant, server)
+	err := c.DeleteServer(tenant, server, service.GetUser(r.Context()), service.GetRequestID(r.Context()))
 	if err != nil {
 		return errorResponse(err), err
 	}
@@ -1222,10 +1572,22 @@ func instanceAction(c *Context, w http.ResponseWriter, r *http.Request) (Respons
 
 	bodyString := string(body)
 
+	user := service.GetUser(r.Context())
+	requestID := service.GetRequestID(r.Context())
+
 	if strings.Contains(bodyString, "os-start") {
-		err = c.StartServer(tenant, server)
+		err = c.StartServer(tenant, server, user, requestID)
 	} else if strings.Contains(bodyString, "os-stop") {
-		err = c.StopServer(tenant, server)
+		err = c.StopServer(tenant, server, user, requestID)
+	} else if strings.Contains(bodyString, "os-restore") {
+		err = c.RestoreServer(tenant, server, user, requestID)
+	} else if strings.Contains(bodyString, "os-migrate") {
+		// Moving instances between nodes is up to the admin
+		if !service.GetPrivilege(r.Context()) {
+			return Response{http.StatusUnauthorized, nil},
+				errors.New("Migration limited to privileged users")
+		}
+		err = c.MigrateServer(tenant, server, user, requestID)
 	} else {
 		return Response{http.StatusServiceUnavailable, nil},
 			errors.New("Unsupported Action")
@@ -1238,6 +1600,246 @@ func instanceAction(c *Context, w http.ResponseWriter, r *http.Request) (Respons
 	return Response{http.StatusAccepted, nil}, nil
 }
 
+func listInstanceActions(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+
+	actions, err := c.ListInstanceActions(tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, InstanceActions{Actions: actions}}, nil
+}
+
+func listInstanceCrashes(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+
+	crashes, err := c.ListInstanceCrashes(tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, InstanceCrashes{Crashes: crashes}}, nil
+}
+
+func listServerMetadata(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+
+	metadata, err := c.ListServerMetadata(tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, ServerMetadata{Metadata: metadata}}, nil
+}
+
+// updateServerMetadata merges the metadata of the request, if POSTed, or
+// replaces the metadata of the instance with it, if PUT.
+func updateServerMetadata(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Response{http.StatusBadRequest, nil}, err
+	}
+
+	var req ServerMetadata
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return Response{http.StatusBadRequest, nil}, err
+	}
+
+	metadata, err := c.UpdateServerMetadata(tenant, server, req.Metadata, r.Method == "PUT")
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, ServerMetadata{Metadata: metadata}}, nil
+}
+
+func showServerMetadataItem(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+	key := vars["key"]
+
+	metadata, err := c.ListServerMetadata(tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	value, ok := metadata[key]
+	if !ok {
+		return errorResponse(types.ErrMetadataNotFound), types.ErrMetadataNotFound
+	}
+
+	return Response{http.StatusOK, ServerMetadataItem{Meta: map[string]string{key: value}}}, nil
+}
+
+func setServerMetadataItem(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+	key := vars["key"]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Response{http.StatusBadRequest, nil}, err
+	}
+
+	var req ServerMetadataItem
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return Response{http.StatusBadRequest, nil}, err
+	}
+
+	// The item must be the one named in the URL
+	value, ok := req.Meta[key]
+	if !ok || len(req.Meta) != 1 {
+		return Response{http.StatusBadRequest, nil}, types.ErrBadRequest
+	}
+
+	_, err = c.UpdateServerMetadata(tenant, server, req.Meta, false)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, ServerMetadataItem{Meta: map[string]string{key: value}}}, nil
+}
+
+func deleteServerMetadataItem(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["instance_id"]
+	key := vars["key"]
+
+	err := c.DeleteServerMetadata(tenant, server, key)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
+func reserveIP(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	var req types.ReserveIPRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	reserved, err := c.ReserveTenantIP(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusCreated, reserved}, nil
+}
+
+func listReservedIPs(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	reserved, err := c.ListReservedTenantIPs(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, reserved}, nil
+}
+
+func releaseReservedIP(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	address := vars["address"]
+
+	err := c.ReleaseReservedTenantIP(tenant, address)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
+func createSubnet(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	var req types.CreateSubnetRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	subnet, err := c.CreateTenantSubnet(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusCreated, subnet}, nil
+}
+
+func listSubnets(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	subnets, err := c.ListTenantSubnets(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, subnets}, nil
+}
+
+func showSubnet(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	subnetID := vars["subnet_id"]
+
+	subnet, err := c.ShowTenantSubnet(tenant, subnetID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, subnet}, nil
+}
+
+func deleteTenantSubnet(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	subnetID := vars["subnet_id"]
+
+	err := c.DeleteTenantSubnet(tenant, subnetID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
 // Service is an interface which must be implemented by the ciao API context.
 type Service interface {
 	AddPool(name string, subnet *string, ips []string) (types.Pool, error)
@@ -1251,6 +1853,7 @@ type Service interface {
 	UnMapAddress(ID string) error
 	CreateWorkload(req types.Workload) (types.Workload, error)
 	DeleteWorkload(tenantID string, workloadID string) error
+	UpdateWorkload(tenantID string, workloadID string, req types.Workload) error
 	ShowWorkload(tenantID string, workloadID string) (types.Workload, error)
 	ListWorkloads(tenantID string) ([]types.Workload, error)
 	ListQuotas(tenantID string) []types.QuotaDetails
@@ -1264,21 +1867,37 @@ type Service interface {
 	DeleteTenant(ID string) error
 	CreateImage(string, CreateImageRequest) (types.Image, error)
 	UploadImage(string, string, io.Reader) error
+	DownloadImage(string, string) (io.ReadCloser, error)
 	ListImages(string) ([]types.Image, error)
+	ListAllImages() (types.ImageStoreUsage, error)
 	GetImage(string, string) (types.Image, error)
 	DeleteImage(string, string) error
 	CreateVolume(tenant string, req RequestedVolume) (types.Volume, error)
 	DeleteVolume(tenant string, volume string) error
 	AttachVolume(tenant string, volume string, instance string, mountpoint string) error
 	DetachVolume(tenant string, volume string, attachment string) error
-	ListVolumesDetail(tenant string) ([]types.Volume, error)
+	ListVolumesDetail(tenant string, filter types.VolumeFilter) ([]types.Volume, error)
 	ShowVolumeDetails(tenant string, volume string) (types.Volume, error)
-	CreateServer(string, CreateServerRequest) (interface{}, error)
+	CreateServer(ctx context.Context, tenant string, req CreateServerRequest, user string, requestID string) (interface{}, error)
 	ListServersDetail(tenant string) ([]ServerDetails, error)
 	ShowServerDetails(tenant string, server string) (Server, error)
-	DeleteServer(tenant string, server string) error
-	StartServer(tenant string, server string) error
-	StopServer(tenant string, server string) error
+	DeleteServer(tenant string, server string, user string, requestID string) error
+	StartServer(tenant string, server string, user string, requestID string) error
+	StopServer(tenant string, server string, user string, requestID string) error
+	RestoreServer(tenant string, server string, user string, requestID string) error
+	MigrateServer(tenant string, server string, user string, requestID string) error
+	ListInstanceActions(tenant string, server string) ([]types.InstanceAction, error)
+	ListInstanceCrashes(tenant string, server string) ([]types.InstanceCrash, error)
+	ListServerMetadata(tenant string, server string) (map[string]string, error)
+	UpdateServerMetadata(tenant string, server string, metadata map[string]string, replace bool) (map[string]string, error)
+	DeleteServerMetadata(tenant string, server string, key string) error
+	ReserveTenantIP(tenant string, req types.ReserveIPRequest) (types.ReservedIP, error)
+	ListReservedTenantIPs(tenant string) ([]types.ReservedIP, error)
+	ReleaseReservedTenantIP(tenant string, address string) error
+	CreateTenantSubnet(tenant string, req types.CreateSubnetRequest) (types.TenantSubnet, error)
+	ListTenantSubnets(tenant string) ([]types.TenantSubnet, error)
+	ShowTenantSubnet(tenant string, subnetID string) (types.TenantSubnet, error)
+	DeleteTenantSubnet(tenant string, subnetID string) error
 }
 
 // Context is used to provide the services and current URL to the handlers.
@@ -1313,6 +1932,9 @@ func Routes(config Config, r *mux.Router) *mux.Router {
 	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}", Handler{context, listResources, false})
 	route.Methods("GET")
 
+	route = r.Handle("/version", Handler{context, showVersion, false})
+	route.Methods("GET")
+
 	matchContent := fmt.Sprintf("application/(%s|json)", PoolsV1)
 
 	route = r.Handle("/pools", Handler{context, listPools, true})
@@ -1389,6 +2011,10 @@ func Routes(config Config, r *mux.Router) *mux.Router {
 	route.Methods("DELETE")
 	route.HeadersRegexp("Content-Type", matchContent)
 
+	route = r.Handle("/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, updateWorkload, true})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
 	route = r.Handle("/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, showWorkload, true})
 	route.Methods("GET")
 	route.HeadersRegexp("Content-Type", matchContent)
@@ -1405,6 +2031,10 @@ func Routes(config Config, r *mux.Router) *mux.Router {
 	route.Methods("DELETE")
 	route.HeadersRegexp("Content-Type", matchContent)
 
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, updateWorkload, false})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
 	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, showWorkload, false})
 	route.Methods("GET")
 	route.HeadersRegexp("Content-Type", matchContent)
@@ -1467,6 +2097,10 @@ func Routes(config Config, r *mux.Router) *mux.Router {
 	route.Methods("PUT")
 	route.HeadersRegexp("Content-Type", matchContent)
 
+	route = r.Handle("/{tenant}/images/{image_id:"+uuid.UUIDRegex+"}/file", Handler{context, downloadImage, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
 	route = r.Handle("/{tenant}/images", Handler{context, listImages, false})
 	route.Methods("GET")
 	route.HeadersRegexp("Content-Type", matchContent)
@@ -1487,10 +2121,18 @@ func Routes(config Config, r *mux.Router) *mux.Router {
 	route.Methods("PUT")
 	route.HeadersRegexp("Content-Type", matchContent)
 
+	route = r.Handle("/images/{image_id:"+uuid.UUIDRegex+"}/file", Handler{context, downloadImage, true})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
 	route = r.Handle("/images", Handler{context, listImages, true})
 	route.Methods("GET")
 	route.HeadersRegexp("Content-Type", matchContent)
 
+	route = r.Handle("/images/all", Handler{context, listAllImages, true})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
 	route = r.Handle("/images/{image_id:"+uuid.UUIDRegex+"}", Handler{context, getImage, true})
 	route.Methods("GET")
 	route.HeadersRegexp("Content-Type", matchContent)
@@ -1545,5 +2187,67 @@ func Routes(config Config, r *mux.Router) *mux.Router {
 	route.Methods("POST")
 	route.HeadersRegexp("Content-Type", matchContent)
 
+	route = r.Handle("/{tenant}/instances/{instance_id}/os-instance-actions", Handler{context, listInstanceActions, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/instances/{instance_id}/crashes", Handler{context, listInstanceCrashes, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/instances/{instance_id}/metadata", Handler{context, listServerMetadata, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/instances/{instance_id}/metadata", Handler{context, updateServerMetadata, false})
+	route.Methods("PUT", "POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/instances/{instance_id}/metadata/{key}", Handler{context, showServerMetadataItem, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/instances/{instance_id}/metadata/{key}", Handler{context, setServerMetadataItem, false})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/instances/{instance_id}/metadata/{key}", Handler{context, deleteServerMetadataItem, false})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// Reserved IPs
+	matchContent = fmt.Sprintf("application/(%s|json)", ReservedIPsV1)
+
+	route = r.Handle("/{tenant}/reserved-ips", Handler{context, reserveIP, false})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/reserved-ips", Handler{context, listReservedIPs, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/reserved-ips/{address}", Handler{context, releaseReservedIP, false})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// Subnets
+	matchContent = fmt.Sprintf("application/(%s|json)", SubnetsV1)
+
+	route = r.Handle("/{tenant}/subnets", Handler{context, createSubnet, false})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/subnets", Handler{context, listSubnets, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/subnets/{subnet_id}", Handler{context, showSubnet, false})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant}/subnets/{subnet_id}", Handler{context, deleteTenantSubnet, false})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
 	return r
 }
@@ -16,10 +16,13 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,6 +50,14 @@ var tests = []test{
 		http.StatusOK,
 		`[{"rel":"pools","href":"/pools","version":"x.ciao.pools.v1","minimum_version":"x.ciao.pools.v1"},{"rel":"external-ips","href":"/external-ips","version":"x.ciao.external-ips.v1","minimum_version":"x.ciao.external-ips.v1"},{"rel":"workloads","href":"/workloads","version":"x.ciao.workloads.v1","minimum_version":"x.ciao.workloads.v1"},{"rel":"tenants","href":"/tenants","version":"x.ciao.tenants.v1","minimum_version":"x.ciao.tenants.v1"},{"rel":"node","href":"/node","version":"x.ciao.node.v1","minimum_version":"x.ciao.node.v1"},{"rel":"images","href":"/images","version":"x.ciao.images.v1","minimum_version":"x.ciao.images.v1"}]`,
 	},
+	{
+		"GET",
+		"/version",
+		"",
+		"application/json",
+		http.StatusOK,
+		`{"version":1,"minimum_version":1}`,
+	},
 	{
 		"GET",
 		"/pools",
@@ -133,7 +144,7 @@ var tests = []test{
 		`{"id":"","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!"}`,
 		fmt.Sprintf("application/%s", WorkloadsV1),
 		http.StatusCreated,
-		`{"workload":{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!","storage":null,"visibility":"public","workload_requirements":{"MemMB":0,"VCPUs":0,"NodeID":"","Hostname":"","NetworkNode":false,"Privileged":false}},"link":{"rel":"self","href":"/workloads/ba58f471-0735-4773-9550-188e2d012941"}}`,
+		`{"workload":{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!","storage":null,"visibility":"public","workload_requirements":{"MemMB":0,"VCPUs":0,"NodeID":"","Hostname":"","NetworkNode":false,"Privileged":false,"DisableNetMultiQueue":false,"DiskIOPS":0,"NetBandwidthMbps":0,"ExtraSpecs":null}},"link":{"rel":"self","href":"/workloads/ba58f471-0735-4773-9550-188e2d012941"}}`,
 	},
 	{
 		"DELETE",
@@ -143,13 +154,21 @@ var tests = []test{
 		http.StatusNoContent,
 		"null",
 	},
+	{
+		"PUT",
+		"/workloads/76f4fa99-e533-4cbd-ab36-f6c0f51292ed",
+		`{"id":"","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!"}`,
+		fmt.Sprintf("application/%s", WorkloadsV1),
+		http.StatusNoContent,
+		"null",
+	},
 	{
 		"GET",
 		"/workloads/ba58f471-0735-4773-9550-188e2d012941",
 		"",
 		fmt.Sprintf("application/%s", WorkloadsV1),
 		http.StatusOK,
-		`{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!","storage":null,"visibility":"private","workload_requirements":{"MemMB":0,"VCPUs":0,"NodeID":"","Hostname":"","NetworkNode":false,"Privileged":false}}`,
+		`{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!","storage":null,"visibility":"private","workload_requirements":{"MemMB":0,"VCPUs":0,"NodeID":"","Hostname":"","NetworkNode":false,"Privileged":false,"DisableNetMultiQueue":false,"DiskIOPS":0,"NetBandwidthMbps":0,"ExtraSpecs":null}}`,
 	},
 	{
 		"GET",
@@ -157,7 +176,7 @@ var tests = []test{
 		"",
 		fmt.Sprintf("application/%s", WorkloadsV1),
 		http.StatusOK,
-		`[{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!","storage":null,"visibility":"private","workload_requirements":{"MemMB":0,"VCPUs":0,"NodeID":"","Hostname":"","NetworkNode":false,"Privileged":false}}]`,
+		`[{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_name":"","config":"this will totally work!","storage":null,"visibility":"private","workload_requirements":{"MemMB":0,"VCPUs":0,"NodeID":"","Hostname":"","NetworkNode":false,"Privileged":false,"DisableNetMultiQueue":false,"DiskIOPS":0,"NetBandwidthMbps":0,"ExtraSpecs":null}}]`,
 	},
 	{
 		"GET",
@@ -222,6 +241,14 @@ var tests = []test{
 		http.StatusOK,
 		`[{"id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb","state":"created","tenant_id":"","name":"Ubuntu","create_time":"2015-11-29T22:21:42Z","size":0,"visibility":"public"}]`,
 	},
+	{
+		"GET",
+		"/images/all",
+		"",
+		fmt.Sprintf("application/%s", ImagesV1),
+		http.StatusOK,
+		`{"images":[{"id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb","state":"active","tenant_id":"validtenantid","name":"Ubuntu","create_time":"2015-11-29T22:21:42Z","size":1024,"visibility":"private"}],"tenants":[{"tenant_id":"validtenantid","images":1,"size":1024}],"total_size":1024,"stored_size":1024,"dedup_savings":0}`,
+	},
 	{
 		"GET",
 		"/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27",
@@ -230,6 +257,14 @@ var tests = []test{
 		http.StatusOK,
 		`{"id":"1bea47ed-f6a9-463b-b423-14b9cca9ad27","state":"active","tenant_id":"","name":"cirros-0.3.2-x86_64-disk","create_time":"2014-05-05T17:15:10Z","size":13167616,"visibility":"public"}`,
 	},
+	{
+		"GET",
+		"/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/file",
+		"",
+		fmt.Sprintf("application/%s", ImagesV1),
+		http.StatusOK,
+		"image data",
+	},
 	{
 		"DELETE",
 		"/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27",
@@ -254,6 +289,30 @@ var tests = []test{
 		http.StatusOK,
 		`[{"id":"new-test-id","bootable":false,"boot_index":0,"ephemeral":false,"local":false,"swap":false,"size":123456,"tenant_id":"test-tenant-id","state":"available","created":"0001-01-01T00:00:00Z","name":"my volume","description":"my volume for stuff","internal":false},{"id":"new-test-id2","bootable":false,"boot_index":0,"ephemeral":false,"local":false,"swap":false,"size":123456,"tenant_id":"test-tenant-id","state":"available","created":"0001-01-01T00:00:00Z","name":"volume 2","description":"my other volume","internal":false}]`,
 	},
+	{
+		"GET",
+		"/validtenantid/volumes?status=in-use",
+		"",
+		fmt.Sprintf("application/%s", VolumesV1),
+		http.StatusOK,
+		`[]`,
+	},
+	{
+		"GET",
+		"/validtenantid/volumes?bootable=false&min_size=100000&max_size=200000",
+		"",
+		fmt.Sprintf("application/%s", VolumesV1),
+		http.StatusOK,
+		`[{"id":"new-test-id","bootable":false,"boot_index":0,"ephemeral":false,"local":false,"swap":false,"size":123456,"tenant_id":"test-tenant-id","state":"available","created":"0001-01-01T00:00:00Z","name":"my volume","description":"my volume for stuff","internal":false},{"id":"new-test-id2","bootable":false,"boot_index":0,"ephemeral":false,"local":false,"swap":false,"size":123456,"tenant_id":"test-tenant-id","state":"available","created":"0001-01-01T00:00:00Z","name":"volume 2","description":"my other volume","internal":false}]`,
+	},
+	{
+		"GET",
+		"/validtenantid/volumes?min_size=10&max_size=5",
+		"",
+		fmt.Sprintf("application/%s", VolumesV1),
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"max_size 5 is smaller than min_size 10"}}` + "\n",
+	},
 	{
 		"GET",
 		"/validtenantid/volumes/validvolumeid",
@@ -301,6 +360,28 @@ var tests = []test{
 		fmt.Sprintf("application/%s", InstancesV1),
 		http.StatusOK,
 		`{"total_servers":1,"servers":[{"private_addresses":[{"addr":"192.169.0.1","mac_addr":"00:02:00:01:02:03"}],"created":"0001-01-01T00:00:00Z","workload_id":"testWorkloadUUID","node_id":"nodeUUID","id":"testUUID","name":"","volumes":null,"status":"active","tenant_id":"validtenantid","ssh_ip":"","ssh_port":0}]}`},
+	{
+		"GET",
+		"/validtenantid/instances/detail?status=active&ip=192.169.0.1",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"total_servers":1,"servers":[{"private_addresses":[{"addr":"192.169.0.1","mac_addr":"00:02:00:01:02:03"}],"created":"0001-01-01T00:00:00Z","workload_id":"testWorkloadUUID","node_id":"nodeUUID","id":"testUUID","name":"","volumes":null,"status":"active","tenant_id":"validtenantid","ssh_ip":"","ssh_port":0}]}`},
+	{
+		"GET",
+		"/validtenantid/instances/detail?created_since=2017-06-01T00:00:00Z",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"total_servers":0,"servers":null}`},
+	{
+		"GET",
+		"/validtenantid/instances/detail?created_since=yesterday",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"Invalid created_since \"yesterday\", expected an RFC 3339 time"}}
+`},
 	{
 		"GET",
 		"/validtenantid/instances/instanceid",
@@ -333,6 +414,158 @@ var tests = []test{
 		http.StatusAccepted,
 		"null",
 	},
+	{
+		"POST",
+		"/validtenantid/instances/instanceid/action",
+		`{"os-restore":null}`,
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"POST",
+		"/validtenantid/instances/instanceid/action",
+		`{"os-migrate":null}`,
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"GET",
+		"/validtenantid/instances/instanceid/os-instance-actions",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"instance_actions":[{"instance_id":"instanceid","tenant_id":"validtenantid","action":"create","user":"user","result":"success","timestamp":"0001-01-01T00:00:00Z"},{"instance_id":"instanceid","tenant_id":"validtenantid","action":"launch","node_id":"nodeUUID","result":"error","reason":"full_cn","timestamp":"0001-01-01T00:00:00Z"}]}`,
+	},
+	{
+		"GET",
+		"/validtenantid/instances/instanceid/crashes",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"crashes":[{"instance_id":"instanceid","tenant_id":"validtenantid","node_id":"nodeUUID","exit_status":"guest panicked","artifacts":"/var/lib/ciao/crashes/instanceid/20170612T101323Z","memory_dump":true,"timestamp":"0001-01-01T00:00:00Z"}]}`,
+	},
+	{
+		"GET",
+		"/validtenantid/instances/instanceid/metadata",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"metadata":{"role":"web"}}`,
+	},
+	{
+		"PUT",
+		"/validtenantid/instances/instanceid/metadata",
+		`{"metadata":{"tier":"1"}}`,
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"metadata":{"tier":"1"}}`,
+	},
+	{
+		"POST",
+		"/validtenantid/instances/instanceid/metadata",
+		`{"metadata":{"tier":"1"}}`,
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"metadata":{"role":"web","tier":"1"}}`,
+	},
+	{
+		"GET",
+		"/validtenantid/instances/instanceid/metadata/role",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"meta":{"role":"web"}}`,
+	},
+	{
+		"PUT",
+		"/validtenantid/instances/instanceid/metadata/tier",
+		`{"meta":{"tier":"1"}}`,
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusOK,
+		`{"meta":{"tier":"1"}}`,
+	},
+	{
+		"DELETE",
+		"/validtenantid/instances/instanceid/metadata/role",
+		"",
+		fmt.Sprintf("application/%s", InstancesV1),
+		http.StatusNoContent,
+		"null",
+	},
+	{
+		"POST",
+		"/validtenantid/reserved-ips",
+		`{"address":"172.16.0.10","description":"dns"}`,
+		fmt.Sprintf("application/%s", ReservedIPsV1),
+		http.StatusCreated,
+		`{"tenant_id":"validtenantid","address":"172.16.0.10","description":"dns","create_time":"0001-01-01T00:00:00Z"}`,
+	},
+	{
+		"POST",
+		"/validtenantid/reserved-ips",
+		`{"address":"172.16.0.1"}`,
+		fmt.Sprintf("application/%s", ReservedIPsV1),
+		http.StatusForbidden,
+		`{"error":{"code":403,"name":"Forbidden","message":"The IP Address is already in use"}}` + "\n",
+	},
+	{
+		"GET",
+		"/validtenantid/reserved-ips",
+		"",
+		fmt.Sprintf("application/%s", ReservedIPsV1),
+		http.StatusOK,
+		`[{"tenant_id":"validtenantid","address":"172.16.0.10","description":"dns","create_time":"0001-01-01T00:00:00Z"}]`,
+	},
+	{
+		"DELETE",
+		"/validtenantid/reserved-ips/172.16.0.10",
+		"",
+		fmt.Sprintf("application/%s", ReservedIPsV1),
+		http.StatusNoContent,
+		"null",
+	},
+	{
+		"POST",
+		"/validtenantid/subnets",
+		`{"name":"backend","cidr":"172.16.9.0/24"}`,
+		fmt.Sprintf("application/%s", SubnetsV1),
+		http.StatusCreated,
+		`{"id":"subnetid","tenant_id":"validtenantid","name":"backend","cidr":"172.16.9.0/24","create_time":"0001-01-01T00:00:00Z"}`,
+	},
+	{
+		"POST",
+		"/validtenantid/subnets",
+		`{"cidr":"10.0.0.0/24"}`,
+		fmt.Sprintf("application/%s", SubnetsV1),
+		http.StatusForbidden,
+		`{"error":{"code":403,"name":"Forbidden","message":"Subnet must be within 172.16.0.0/12 and match the tenant subnet size"}}` + "\n",
+	},
+	{
+		"GET",
+		"/validtenantid/subnets",
+		"",
+		fmt.Sprintf("application/%s", SubnetsV1),
+		http.StatusOK,
+		`[{"id":"subnetid","tenant_id":"validtenantid","name":"backend","cidr":"172.16.9.0/24","create_time":"0001-01-01T00:00:00Z"}]`,
+	},
+	{
+		"GET",
+		"/validtenantid/subnets/unknownid",
+		"",
+		fmt.Sprintf("application/%s", SubnetsV1),
+		http.StatusNotFound,
+		`{"error":{"code":404,"name":"Not Found","message":"Subnet not found"}}` + "\n",
+	},
+	{
+		"DELETE",
+		"/validtenantid/subnets/subnetid",
+		"",
+		fmt.Sprintf("application/%s", SubnetsV1),
+		http.StatusNoContent,
+		"null",
+	},
 }
 
 type testCiaoService struct{}
@@ -448,6 +681,10 @@ func (ts testCiaoService) DeleteWorkload(tenant string, workload string) error {
 	return nil
 }
 
+func (ts testCiaoService) UpdateWorkload(tenant string, workload string, req types.Workload) error {
+	return nil
+}
+
 func (ts testCiaoService) ShowWorkload(tenant string, ID string) (types.Workload, error) {
 	return types.Workload{
 		ID:          "ba58f471-0735-4773-9550-188e2d012941",
@@ -576,6 +813,29 @@ func (ts testCiaoService) ListImages(tenantID string) ([]types.Image, error) {
 	return images, nil
 }
 
+func (ts testCiaoService) ListAllImages() (types.ImageStoreUsage, error) {
+	createdAt, _ := time.Parse(time.RFC3339, "2015-11-29T22:21:42Z")
+
+	image := types.Image{
+		State:      types.Active,
+		CreateTime: createdAt,
+		ID:         "b2173dd3-7ad6-4362-baa6-a68bce3565cb",
+		TenantID:   "validtenantid",
+		Name:       "Ubuntu",
+		Size:       1024,
+		Visibility: types.Private,
+	}
+
+	return types.ImageStoreUsage{
+		Images: []types.Image{image},
+		Tenants: []types.TenantImageUsage{
+			{TenantID: "validtenantid", Images: 1, Size: 1024},
+		},
+		TotalSize:  1024,
+		StoredSize: 1024,
+	}, nil
+}
+
 func (ts testCiaoService) GetImage(tenantID, ID string) (types.Image, error) {
 	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
 	name := "cirros-0.3.2-x86_64-disk"
@@ -596,6 +856,10 @@ func (ts testCiaoService) UploadImage(string, string, io.Reader) error {
 	return nil
 }
 
+func (ts testCiaoService) DownloadImage(string, string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("image data")), nil
+}
+
 func (ts testCiaoService) DeleteImage(string, string) error {
 	return nil
 }
@@ -638,8 +902,8 @@ func (ts testCiaoService) DetachVolume(tenant string, volume string, attachment
 	return nil
 }
 
-func (ts testCiaoService) ListVolumesDetail(tenant string) ([]types.Volume, error) {
-	return []types.Volume{
+func (ts testCiaoService) ListVolumesDetail(tenant string, filter types.VolumeFilter) ([]types.Volume, error) {
+	vols := []types.Volume{
 		{
 			BlockDevice: storage.BlockDevice{
 				ID:   "new-test-id",
@@ -660,10 +924,19 @@ func (ts testCiaoService) ListVolumesDetail(tenant string) ([]types.Volume, erro
 			Description: "my other volume",
 			TenantID:    "test-tenant-id",
 		},
-	}, nil
+	}
+
+	matched := []types.Volume{}
+	for _, v := range vols {
+		if filter.Match(v) {
+			matched = append(matched, v)
+		}
+	}
+
+	return matched, nil
 }
 
-func (ts testCiaoService) CreateServer(tenant string, req CreateServerRequest) (interface{}, error) {
+func (ts testCiaoService) CreateServer(ctx context.Context, tenant string, req CreateServerRequest, user string, requestID string) (interface{}, error) {
 	req.Server.ID = "validServerID"
 	return req, nil
 }
@@ -708,15 +981,131 @@ func (ts testCiaoService) ShowServerDetails(tenant string, server string) (Serve
 	return Server{Server: s}, nil
 }
 
-func (ts testCiaoService) DeleteServer(tenant string, server string) error {
+func (ts testCiaoService) DeleteServer(tenant string, server string, user string, requestID string) error {
+	return nil
+}
+
+func (ts testCiaoService) StartServer(tenant string, server string, user string, requestID string) error {
 	return nil
 }
 
-func (ts testCiaoService) StartServer(tenant string, server string) error {
+func (ts testCiaoService) StopServer(tenant string, server string, user string, requestID string) error {
 	return nil
 }
 
-func (ts testCiaoService) StopServer(tenant string, server string) error {
+func (ts testCiaoService) RestoreServer(tenant string, server string, user string, requestID string) error {
+	return nil
+}
+
+func (ts testCiaoService) MigrateServer(tenant string, server string, user string, requestID string) error {
+	return nil
+}
+
+func (ts testCiaoService) ListInstanceActions(tenant string, server string) ([]types.InstanceAction, error) {
+	return []types.InstanceAction{
+		{
+			InstanceID: server,
+			TenantID:   tenant,
+			Action:     types.InstanceActionCreate,
+			User:       "user",
+			Result:     types.InstanceActionSuccess,
+		},
+		{
+			InstanceID: server,
+			TenantID:   tenant,
+			Action:     types.InstanceActionLaunch,
+			NodeID:     "nodeUUID",
+			Result:     types.InstanceActionError,
+			Reason:     "full_cn",
+		},
+	}, nil
+}
+
+func (ts testCiaoService) ListServerMetadata(tenant string, server string) (map[string]string, error) {
+	return map[string]string{"role": "web"}, nil
+}
+
+func (ts testCiaoService) UpdateServerMetadata(tenant string, server string, metadata map[string]string, replace bool) (map[string]string, error) {
+	if replace {
+		return metadata, nil
+	}
+
+	updated := map[string]string{"role": "web"}
+	for k, v := range metadata {
+		updated[k] = v
+	}
+	return updated, nil
+}
+
+func (ts testCiaoService) DeleteServerMetadata(tenant string, server string, key string) error {
+	return nil
+}
+
+func (ts testCiaoService) ListInstanceCrashes(tenant string, server string) ([]types.InstanceCrash, error) {
+	return []types.InstanceCrash{
+		{
+			InstanceID: server,
+			TenantID:   tenant,
+			NodeID:     "nodeUUID",
+			ExitStatus: "guest panicked",
+			Artifacts:  "/var/lib/ciao/crashes/instanceid/20170612T101323Z",
+			MemoryDump: true,
+		},
+	}, nil
+}
+
+func (ts testCiaoService) ReserveTenantIP(tenant string, req types.ReserveIPRequest) (types.ReservedIP, error) {
+	if req.Address == "172.16.0.1" {
+		return types.ReservedIP{}, types.ErrIPInUse
+	}
+
+	return types.ReservedIP{
+		TenantID:    tenant,
+		Address:     req.Address,
+		Description: req.Description,
+	}, nil
+}
+
+func (ts testCiaoService) ListReservedTenantIPs(tenant string) ([]types.ReservedIP, error) {
+	return []types.ReservedIP{
+		{
+			TenantID:    tenant,
+			Address:     "172.16.0.10",
+			Description: "dns",
+		},
+	}, nil
+}
+
+func (ts testCiaoService) ReleaseReservedTenantIP(tenant string, address string) error {
+	return nil
+}
+
+var testSubnet = types.TenantSubnet{
+	ID:       "subnetid",
+	TenantID: "validtenantid",
+	Name:     "backend",
+	CIDR:     "172.16.9.0/24",
+}
+
+func (ts testCiaoService) CreateTenantSubnet(tenant string, req types.CreateSubnetRequest) (types.TenantSubnet, error) {
+	if req.CIDR != testSubnet.CIDR {
+		return types.TenantSubnet{}, types.ErrBadSubnet
+	}
+	return testSubnet, nil
+}
+
+func (ts testCiaoService) ListTenantSubnets(tenant string) ([]types.TenantSubnet, error) {
+	return []types.TenantSubnet{testSubnet}, nil
+}
+
+func (ts testCiaoService) ShowTenantSubnet(tenant string, subnetID string) (types.TenantSubnet, error) {
+	if subnetID != testSubnet.ID {
+		return types.TenantSubnet{}, types.ErrSubnetNotFound
+	}
+	return testSubnet, nil
+}
+
+func (ts testCiaoService) DeleteTenantSubnet(tenant string, subnetID string) error {
 	return nil
 }
 
@@ -758,3 +1147,62 @@ func TestRoutes(t *testing.T) {
 		t.Fatalf("No routes returned")
 	}
 }
+
+type sizedData struct {
+	io.Reader
+	size int64
+}
+
+func (d sizedData) Close() error {
+	return nil
+}
+
+func (d sizedData) Size() int64 {
+	return d.size
+}
+
+func serveRawData(data io.ReadCloser) (rr *httptest.ResponseRecorder, aborted bool) {
+	h := Handler{
+		Handler: func(*Context, http.ResponseWriter, *http.Request) (Response, error) {
+			return Response{http.StatusOK, data}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/images/id/file", nil)
+	rr = httptest.NewRecorder()
+
+	defer func() {
+		aborted = recover() == http.ErrAbortHandler
+	}()
+
+	h.ServeHTTP(rr, req)
+
+	return rr, false
+}
+
+func TestRawResponse(t *testing.T) {
+	rr, aborted := serveRawData(sizedData{strings.NewReader("image data"), 10})
+	if aborted || rr.Code != http.StatusOK || rr.Body.String() != "image data" {
+		t.Errorf("Unexpected response: %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Length") != "10" {
+		t.Errorf("Expected Content-Length 10, got %q", rr.Header().Get("Content-Length"))
+	}
+
+	r, w := io.Pipe()
+	_ = w.CloseWithError(fmt.Errorf("export failed"))
+	rr, aborted = serveRawData(r)
+	if aborted || rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected %d when data cannot be read, got %d", http.StatusInternalServerError, rr.Code)
+	}
+
+	r, w = io.Pipe()
+	go func() {
+		_, _ = w.Write([]byte("image"))
+		_ = w.CloseWithError(fmt.Errorf("export failed"))
+	}()
+	_, aborted = serveRawData(r)
+	if !aborted {
+		t.Error("Response not aborted when data is truncated")
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/internal/tracing"
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// bootStepTimeout is how long we wait for the instances of a boot stage
+// to become active before abandoning the rest of the sequence.
+var bootStepTimeout = 5 * time.Minute
+
+// bootStepPollInterval is how often the state of the instances of a boot
+// stage is checked.
+var bootStepPollInterval = time.Second
+
+// orderBootSteps validates a set of boot steps and sorts them into stages.
+// All the dependencies of the steps of a stage belong to earlier stages.
+func orderBootSteps(steps []api.BootStep) ([][]api.BootStep, error) {
+	byName := make(map[string]api.BootStep)
+	for _, s := range steps {
+		if s.Name == "" || s.WorkloadID == "" || s.Instances <= 0 {
+			return nil, types.ErrBadBootSteps
+		}
+		if _, ok := byName[s.Name]; ok {
+			return nil, types.ErrBadBootSteps
+		}
+		byName[s.Name] = s
+	}
+
+	for _, s := range steps {
+		for _, d := range s.DependsOn {
+			if _, ok := byName[d]; !ok || d == s.Name {
+				return nil, types.ErrBadBootSteps
+			}
+		}
+	}
+
+	var stages [][]api.BootStep
+	started := make(map[string]bool)
+	for len(started) < len(steps) {
+		var stage []api.BootStep
+		for _, s := range steps {
+			if started[s.Name] {
+				continue
+			}
+
+			ready := true
+			for _, d := range s.DependsOn {
+				if !started[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				stage = append(stage, s)
+			}
+		}
+
+		// No progress means that the remaining steps form a cycle
+		if len(stage) == 0 {
+			return nil, types.ErrBadBootSteps
+		}
+
+		sort.Slice(stage, func(i, j int) bool { return stage[i].Name < stage[j].Name })
+		for _, s := range stage {
+			started[s.Name] = true
+		}
+		stages = append(stages, stage)
+	}
+
+	return stages, nil
+}
+
+func (c *controller) createComposedServers(tenant string, server api.CreateServerRequest, user string, requestID string,
+	parent tracing.SpanContext) (interface{}, error) {
+	stages, err := orderBootSteps(server.Server.BootSteps)
+	if err != nil {
+		return server, err
+	}
+
+	if err := validateMetadata(server.Server.Metadata); err != nil {
+		return server, err
+	}
+
+	userData, replace, err := userDataFromRequest(server)
+	if err != nil {
+		return server, err
+	}
+
+	var plan api.BootPlan
+	r := regexp.MustCompile("^[a-z0-9-]{1,64}$")
+	for _, stage := range stages {
+		var names []string
+		for _, s := range stage {
+			if server.Server.Name != "" && !r.MatchString(bootStepInstanceName(server, s)) {
+				return server, types.ErrBadName
+			}
+
+			_, err := c.ds.GetWorkload(s.WorkloadID)
+			if err != nil {
+				return server, err
+			}
+			names = append(names, s.Name)
+		}
+		plan.Stages = append(plan.Stages, names)
+	}
+
+	go c.runBootSequence(tenant, server, stages, userData, replace, user, requestID, parent)
+
+	return plan, nil
+}
+
+func bootStepInstanceName(server api.CreateServerRequest, step api.BootStep) string {
+	if server.Server.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s", server.Server.Name, step.Name)
+}
+
+// runBootSequence starts the boot stages one after the other, waiting for
+// all the instances of a stage to be active before starting the next one.
+// The sequence is abandoned if any of the instances of a stage fail to
+// start.
+func (c *controller) runBootSequence(tenant string, server api.CreateServerRequest,
+	stages [][]api.BootStep, userData string, replaceUserData bool, user string, requestID string,
+	parent tracing.SpanContext) {
+	label := server.Server.Metadata["label"]
+
+	for n, stage := range stages {
+		var instances []*types.Instance
+
+		for _, s := range stage {
+			c.logBootEvent(tenant, "Boot step %s: starting %d instance(s) of workload %s",
+				s.Name, s.Instances, s.WorkloadID)
+
+			w := types.WorkloadRequest{
+				WorkloadID:      s.WorkloadID,
+				TenantID:        tenant,
+				Instances:       s.Instances,
+				TraceLabel:      label,
+				Name:            bootStepInstanceName(server, s),
+				SubnetID:        server.Server.SubnetID,
+				UserData:        userData,
+				ReplaceUserData: replaceUserData,
+				Metadata:        server.Server.Metadata,
+				RequestID:       requestID,
+				ExpiresIn:       time.Duration(server.Server.ExpiresIn) * time.Second,
+				TraceID:         parent.TraceID,
+				SpanID:          parent.SpanID,
+			}
+			started, err := c.startWorkload(w)
+			for _, i := range started {
+				c.recordInstanceAction(i, types.InstanceActionCreate, user, nil)
+			}
+			instances = append(instances, started...)
+			if err != nil {
+				c.logBootError(tenant, "Boot step %s: failed to start instances: %v", s.Name, err)
+				c.logBootError(tenant, "Boot sequence abandoned at stage %d of %d", n+1, len(stages))
+				return
+			}
+		}
+
+		err := c.waitForInstancesActive(instances, bootStepTimeout)
+		if err != nil {
+			c.logBootError(tenant, "Boot stage %d of %d failed: %v", n+1, len(stages), err)
+			c.logBootError(tenant, "Boot sequence abandoned at stage %d of %d", n+1, len(stages))
+			return
+		}
+
+		for _, s := range stage {
+			c.logBootEvent(tenant, "Boot step %s: %d instance(s) active", s.Name, s.Instances)
+		}
+	}
+
+	c.logBootEvent(tenant, "Boot sequence complete")
+}
+
+// waitForInstancesActive polls the datastore until all of the instances
+// are active.  An error is returned if an instance disappears, which
+// happens when it fails to start, reaches a state other than pending or
+// if the timeout expires.
+func (c *controller) waitForInstancesActive(instances []*types.Instance, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		active := 0
+		for _, i := range instances {
+			instance, err := c.ds.GetInstance(i.ID)
+			if err != nil {
+				return errors.Wrapf(err, "instance %s failed to start", i.ID)
+			}
+
+			instance.StateLock.RLock()
+			state := instance.State
+			instance.StateLock.RUnlock()
+
+			switch state {
+			case payloads.Running:
+				active++
+			case payloads.Pending:
+			default:
+				return fmt.Errorf("instance %s is %s", i.ID, state)
+			}
+		}
+
+		if active == len(instances) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %d instance(s) to become active",
+				len(instances)-active)
+		}
+
+		time.Sleep(bootStepPollInterval)
+	}
+}
+
+func (c *controller) logBootEvent(tenant string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	glog.Info(msg)
+	if err := c.ds.LogEvent(tenant, msg); err != nil {
+		glog.Warningf("Unable to log boot event: %v", err)
+	}
+}
+
+func (c *controller) logBootError(tenant string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	glog.Warning(msg)
+	if err := c.ds.LogError(tenant, msg); err != nil {
+		glog.Warningf("Unable to log boot error: %v", err)
+	}
+}
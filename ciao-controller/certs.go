@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// certReloader serves the certificate of the HTTPS servers and re-reads it
+// from disk when asked to or when the certificate or key files change, so
+// that certificates can be rotated without restarting the controller.
+type certReloader struct {
+	certPath string
+	keyPath  string
+	interval time.Duration
+
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newCertReloader(certPath, keyPath string, interval time.Duration) (*certReloader, error) {
+	cr := &certReloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		interval: interval,
+	}
+
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// reload reads the certificate and key.  The current certificate is kept
+// if they cannot be loaded, e.g., because only one of the files has been
+// replaced so far.
+func (cr *certReloader) reload() error {
+	certTime, err := modTime(cr.certPath)
+	if err != nil {
+		return errors.Wrap(err, "Unable to stat HTTPS certificate")
+	}
+
+	keyTime, err := modTime(cr.keyPath)
+	if err != nil {
+		return errors.Wrap(err, "Unable to stat HTTPS key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	if err != nil {
+		return errors.Wrap(err, "Unable to load HTTPS certificate")
+	}
+
+	cr.lock.Lock()
+	cr.cert = &cert
+	cr.certTime = certTime
+	cr.keyTime = keyTime
+	cr.lock.Unlock()
+
+	return nil
+}
+
+// changed returns true if the certificate or key files have been modified
+// since they were last loaded.
+func (cr *certReloader) changed() bool {
+	certTime, err := modTime(cr.certPath)
+	if err != nil {
+		return false
+	}
+
+	keyTime, err := modTime(cr.keyPath)
+	if err != nil {
+		return false
+	}
+
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+
+	return !certTime.Equal(cr.certTime) || !keyTime.Equal(cr.keyTime)
+}
+
+// getCertificate is used as the GetCertificate callback of the servers'
+// tls.Config.
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+
+	return cr.cert, nil
+}
+
+func (cr *certReloader) reloadAndLog() {
+	if err := cr.reload(); err != nil {
+		glog.Errorf("Keeping current HTTPS certificate: %v", err)
+		return
+	}
+	glog.Infof("Reloaded HTTPS certificate %s", cr.certPath)
+}
+
+// start watches the certificate and key files for changes and reloads them
+// whenever they change or a value is received on reload.
+func (cr *certReloader) start(reload <-chan os.Signal) {
+	cr.stop = make(chan struct{})
+	cr.wg.Add(1)
+	go func() {
+		defer cr.wg.Done()
+
+		var tick <-chan time.Time
+		if cr.interval > 0 {
+			ticker := time.NewTicker(cr.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-cr.stop:
+				return
+			case s := <-reload:
+				glog.Infof("Received signal %s, reloading HTTPS certificate", s)
+				cr.reloadAndLog()
+			case <-tick:
+				if cr.changed() {
+					cr.reloadAndLog()
+				}
+			}
+		}
+	}()
+}
+
+func (cr *certReloader) shutdown() {
+	if cr.stop == nil {
+		return
+	}
+
+	close(cr.stop)
+	cr.wg.Wait()
+	cr.stop = nil
+}
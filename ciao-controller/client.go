@@ -34,9 +34,9 @@ type controllerClient interface {
 	ssntp.ClientNotifier
 	StartTracedWorkload(config string, startTime time.Time, label string) error
 	StartWorkload(config string) error
-	DeleteInstance(instanceID string, nodeID string) error
-	StopInstance(instanceID string, nodeID string) error
-	RestartInstance(i *types.Instance, w *types.Workload, t *types.Tenant) error
+	DeleteInstance(instanceID string, nodeID string, requestID string) error
+	StopInstance(instanceID string, nodeID string, requestID string) error
+	RestartInstance(i *types.Instance, w *types.Workload, t *types.Tenant, excludeNodeID string, requestID string) error
 	RemoveInstance(instanceID string)
 	EvacuateNode(nodeID string) error
 	RestoreNode(nodeID string) error
@@ -166,6 +166,30 @@ func (client *ssntpClient) instanceDeleted(payload []byte) {
 	client.RemoveInstance(event.InstanceDeleted.InstanceUUID)
 }
 
+func (client *ssntpClient) instanceLog(payload []byte) {
+	var event payloads.EventInstanceLog
+	err := yaml.Unmarshal(payload, &event)
+	if err != nil {
+		glog.Warningf("Error unmarshalling InstanceLog: %v", err)
+		return
+	}
+
+	l := event.InstanceLog
+	glog.Infof("Instance %s %s: %s", l.InstanceUUID, l.Reason, l.Message)
+
+	err = client.ctl.ds.InstanceLog(l.InstanceUUID, l.Reason, l.Message)
+	if err != nil {
+		glog.Warningf("Error logging instance incident: %v", err)
+	}
+
+	if l.Crash != nil {
+		err = client.ctl.ds.AddInstanceCrash(l.InstanceUUID, *l.Crash)
+		if err != nil {
+			glog.Warningf("Error recording instance crash: %v", err)
+		}
+	}
+}
+
 func (client *ssntpClient) instanceStopped(payload []byte) {
 	var event payloads.EventInstanceStopped
 	err := yaml.Unmarshal(payload, &event)
@@ -187,6 +211,8 @@ func (client *ssntpClient) instanceStopped(payload []byte) {
 		glog.Warningf("Error stopping instance from datastore: %v", err)
 	}
 
+	go client.ctl.completeMigration(instanceID)
+
 	if i.CNCI {
 		tenant, err := client.ctl.ds.GetTenant(i.TenantID)
 		if err != nil {
@@ -241,6 +267,10 @@ func (client *ssntpClient) traceReport(payload []byte) {
 		glog.Warningf("Error unmarshalling TraceReport: %v", err)
 		return
 	}
+	for _, frame := range trace.Frames {
+		client.ctl.traceFrame(frame)
+	}
+
 	err = client.ctl.ds.HandleTraceReport(trace)
 	if err != nil {
 		glog.Warningf("Error updating trace report in datastore: %v", err)
@@ -257,6 +287,8 @@ func (client *ssntpClient) nodeConnected(payload []byte) {
 	glog.Infof("Node %s connected", nodeConnected.Connected.NodeUUID)
 
 	client.ctl.ds.AddNode(nodeConnected.Connected.NodeUUID, nodeConnected.Connected.NodeType)
+	client.ctl.sendPendingDeletes(nodeConnected.Connected.NodeUUID)
+	client.ctl.instanceReaper.nodeReconnected(nodeConnected.Connected.NodeUUID)
 }
 
 func (client *ssntpClient) nodeDisconnected(payload []byte) {
@@ -272,6 +304,9 @@ func (client *ssntpClient) nodeDisconnected(payload []byte) {
 	if err != nil {
 		glog.Warningf("Error marking node as deleted in datastore: %v", err)
 	}
+
+	client.ctl.cancelNodeMigrations(nodeDisconnected.Disconnected.NodeUUID,
+		errors.New("Node disconnected"))
 }
 
 func (client *ssntpClient) unassignEvent(payload []byte) {
@@ -338,6 +373,9 @@ func (client *ssntpClient) EventNotify(event ssntp.Event, frame *ssntp.Frame) {
 	case ssntp.InstanceStopped:
 		client.instanceStopped(payload)
 
+	case ssntp.InstanceLog:
+		client.instanceLog(payload)
+
 	case ssntp.ConcentratorInstanceAdded:
 		client.concentratorInstanceAdded(payload)
 
@@ -383,7 +421,7 @@ func (client *ssntpClient) startFailure(payload []byte) {
 	cnci := i.CNCI
 	tenantID := i.TenantID
 
-	err = client.ctl.ds.StartFailure(failure.InstanceUUID, failure.Reason, failure.Restart, failure.NodeUUID)
+	err = client.ctl.ds.StartFailure(failure.InstanceUUID, failure.Reason, failure.Restart, failure.NodeUUID, failure.RequestID)
 	if err != nil {
 		glog.Warningf("Error adding StartFailure to datastore: %v", err)
 	}
@@ -402,6 +440,31 @@ func (client *ssntpClient) startFailure(payload []byte) {
 	}
 }
 
+func (client *ssntpClient) deleteFailure(payload []byte) {
+	var failure payloads.ErrorDeleteFailure
+	err := yaml.Unmarshal(payload, &failure)
+	if err != nil {
+		glog.Warningf("Error unmarshalling DeleteFailure: %v", err)
+		return
+	}
+
+	i, err := client.ctl.ds.GetInstance(failure.InstanceUUID)
+	if err != nil {
+		glog.Warningf("Error getting instance: %v", err)
+		return
+	}
+
+	msg := fmt.Sprintf("Delete Failure %s: %s", failure.InstanceUUID, failure.Reason.String())
+	err = client.ctl.ds.LogRequestError(i.TenantID, failure.RequestID, msg)
+	if err != nil {
+		glog.Warningf("Error logging error: %v", err)
+	}
+
+	// Stop failures are reported as delete failures.
+	client.ctl.cancelMigration(failure.InstanceUUID, errors.New(msg))
+	client.ctl.instanceReaper.deleteFailed(failure.InstanceUUID)
+}
+
 func (client *ssntpClient) attachVolumeFailure(payload []byte) {
 	var failure payloads.ErrorAttachVolumeFailure
 	err := yaml.Unmarshal(payload, &failure)
@@ -463,6 +526,9 @@ func (client *ssntpClient) ErrorNotify(err ssntp.Error, frame *ssntp.Frame) {
 	case ssntp.StartFailure:
 		client.startFailure(payload)
 
+	case ssntp.DeleteFailure:
+		client.deleteFailure(payload)
+
 	case ssntp.AttachVolumeFailure:
 		client.attachVolumeFailure(payload)
 
@@ -512,7 +578,7 @@ func (client *ssntpClient) deleteInstance(payload *payloads.Delete, instanceID s
 		return err
 	}
 
-	glog.Info("DELETE instance_id: ", instanceID, "node_id ", nodeID)
+	glog.Info("DELETE instance_id: ", instanceID, " node_id: ", nodeID, " request_id: ", payload.Delete.RequestID)
 	glog.V(1).Info(string(y))
 
 	_, err = client.ssntp.SendCommand(ssntp.DELETE, y)
@@ -520,7 +586,7 @@ func (client *ssntpClient) deleteInstance(payload *payloads.Delete, instanceID s
 	return err
 }
 
-func (client *ssntpClient) DeleteInstance(instanceID string, nodeID string) error {
+func (client *ssntpClient) DeleteInstance(instanceID string, nodeID string, requestID string) error {
 	if nodeID == "" {
 		// This instance is not running and not assigned to a node.  We
 		// can just remove its details from controller's db and delete
@@ -534,26 +600,30 @@ func (client *ssntpClient) DeleteInstance(instanceID string, nodeID string) erro
 		Delete: payloads.StopCmd{
 			InstanceUUID:      instanceID,
 			WorkloadAgentUUID: nodeID,
+			RequestID:         requestID,
 		},
 	}
 
 	return client.deleteInstance(&payload, instanceID, nodeID)
 }
 
-func (client *ssntpClient) StopInstance(instanceID string, nodeID string) error {
+func (client *ssntpClient) StopInstance(instanceID string, nodeID string, requestID string) error {
 	payload := payloads.Delete{
 		Delete: payloads.StopCmd{
 			InstanceUUID:      instanceID,
 			WorkloadAgentUUID: nodeID,
 			Stop:              true,
+			RequestID:         requestID,
 		},
 	}
 
 	return client.deleteInstance(&payload, instanceID, nodeID)
 }
 
+// RestartInstance restarts a stopped instance on any node but
+// excludeNodeID, if set.
 func (client *ssntpClient) RestartInstance(i *types.Instance, w *types.Workload,
-	t *types.Tenant) error {
+	t *types.Tenant, excludeNodeID string, requestID string) error {
 	var cnci *types.Instance
 
 	err := client.ctl.ds.InstanceRestarting(i.ID)
@@ -592,8 +662,10 @@ func (client *ssntpClient) RestartInstance(i *types.Instance, w *types.Workload,
 			VnicMAC:  i.MACAddress,
 			VnicUUID: i.VnicUUID,
 		},
-		Storage: make([]payloads.StorageResource, len(attachments)),
-		Restart: true,
+		Storage:       make([]payloads.StorageResource, len(attachments)),
+		Restart:       true,
+		ExcludeNodeID: excludeNodeID,
+		RequestID:     requestID,
 	}
 
 	if cnci != nil {
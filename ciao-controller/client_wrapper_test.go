@@ -83,17 +83,17 @@ func (client *ssntpClientWrapper) StartWorkload(config string) error {
 	return client.realClient.StartWorkload(config)
 }
 
-func (client *ssntpClientWrapper) DeleteInstance(instanceID string, nodeID string) error {
-	return client.realClient.DeleteInstance(instanceID, nodeID)
+func (client *ssntpClientWrapper) DeleteInstance(instanceID string, nodeID string, requestID string) error {
+	return client.realClient.DeleteInstance(instanceID, nodeID, requestID)
 }
 
-func (client *ssntpClientWrapper) StopInstance(instanceID string, nodeID string) error {
-	return client.realClient.StopInstance(instanceID, nodeID)
+func (client *ssntpClientWrapper) StopInstance(instanceID string, nodeID string, requestID string) error {
+	return client.realClient.StopInstance(instanceID, nodeID, requestID)
 }
 
 func (client *ssntpClientWrapper) RestartInstance(i *types.Instance, w *types.Workload,
-	t *types.Tenant) error {
-	return client.realClient.RestartInstance(i, w, t)
+	t *types.Tenant, excludeNodeID string, requestID string) error {
+	return client.realClient.RestartInstance(i, w, t, excludeNodeID, requestID)
 }
 
 func (client *ssntpClientWrapper) EvacuateNode(nodeID string) error {
@@ -80,7 +80,7 @@ func (c *CNCI) stop() error {
 		return err
 	}
 
-	err = c.ctrl.deleteInstance(c.instance.ID)
+	err = c.ctrl.deleteInstance(c.instance.ID, "")
 	if err != nil {
 		return errors.Wrapf(err, "error deleting CNCI instance")
 	}
@@ -370,7 +370,7 @@ func (c *CNCIManager) CNCIStopped(id string) error {
 	}
 
 	cnci.transitionState(exited)
-	err := c.ctrl.restartInstance(cnci.instance.ID)
+	err := c.ctrl.restartInstance(cnci.instance.ID, "")
 
 	return errors.Wrap(err, "Error restarting instance")
 }
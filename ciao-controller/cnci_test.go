@@ -103,7 +103,7 @@ func TestCNCIRemoved(t *testing.T) {
 	clientCh := client.AddCmdChan(ssntp.DELETE)
 	netClientCh := netClient.AddCmdChan(ssntp.DELETE)
 
-	err = ctl.deleteInstance(instanceID)
+	err = ctl.deleteInstance(instanceID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -22,13 +22,20 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/ciao-project/ciao/ciao-controller/internal/tracing"
 	"github.com/ciao-project/ciao/ciao-controller/types"
 	"github.com/ciao-project/ciao/payloads"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
-func (c *controller) restartInstance(instanceID string) error {
+func (c *controller) restartInstance(instanceID string, requestID string) error {
+	return c.restartInstanceExcluding(instanceID, "", requestID)
+}
+
+// restartInstanceExcluding restarts a stopped instance on any node but
+// excludeNodeID, if set.
+func (c *controller) restartInstanceExcluding(instanceID string, excludeNodeID string, requestID string) error {
 	// should I bother to see if instanceID is valid?
 	i, err := c.ds.GetInstance(instanceID)
 	if err != nil {
@@ -39,6 +46,10 @@ func (c *controller) restartInstance(instanceID string) error {
 		return errors.New("You may only restart paused instances")
 	}
 
+	if _, deleted := c.ds.GetInstanceDeletedAt(instanceID); deleted {
+		return types.ErrInstanceDeleted
+	}
+
 	w, err := c.ds.GetWorkload(i.WorkloadID)
 	if err != nil {
 		return err
@@ -57,7 +68,7 @@ func (c *controller) restartInstance(instanceID string) error {
 	}
 
 	go func() {
-		if err := c.client.RestartInstance(i, &w, t); err != nil {
+		if err := c.client.RestartInstance(i, &w, t, excludeNodeID, requestID); err != nil {
 			glog.Warningf("Error restarting instance: %v", err)
 		}
 	}()
@@ -65,7 +76,7 @@ func (c *controller) restartInstance(instanceID string) error {
 	return nil
 }
 
-func (c *controller) stopInstance(instanceID string) error {
+func (c *controller) stopInstance(instanceID string, requestID string) error {
 	// get node id.  If there is no node id we can't send a delete
 	i, err := c.ds.GetInstance(instanceID)
 	if err != nil {
@@ -81,7 +92,7 @@ func (c *controller) stopInstance(instanceID string) error {
 	}
 
 	go func() {
-		if err := c.client.StopInstance(instanceID, i.NodeID); err != nil {
+		if err := c.client.StopInstance(instanceID, i.NodeID, requestID); err != nil {
 			glog.Warningf("Error stopping instance: %v", err)
 		}
 	}()
@@ -98,7 +109,7 @@ func (c *controller) deleteInstanceSync(instanceID string) error {
 		return err
 	}
 
-	err = c.deleteInstance(instanceID)
+	err = c.deleteInstance(instanceID, "")
 	if err != nil {
 		return err
 	}
@@ -134,7 +145,7 @@ func (c *controller) deleteInstanceSync(instanceID string) error {
 	}
 }
 
-func (c *controller) deleteInstance(instanceID string) error {
+func (c *controller) deleteInstance(instanceID string, requestID string) error {
 	// get node id.  If there is no node id and the instance is
 	// pending we can't send a delete
 	i, err := c.ds.GetInstance(instanceID)
@@ -146,7 +157,8 @@ func (c *controller) deleteInstance(instanceID string) error {
 		return types.ErrInstanceNotAssigned
 	}
 
-	if i.State == payloads.Missing {
+	missing := i.State == payloads.Missing
+	if missing && i.LastNodeID == "" {
 		return types.ErrInstanceNotAssigned
 	}
 
@@ -158,8 +170,17 @@ func (c *controller) deleteInstance(instanceID string) error {
 		}
 	}
 
+	c.cancelMigration(instanceID, errors.New("Instance deleted"))
+
+	// The node of a missing instance is not connected so the DELETE
+	// would be dropped.  It is sent once the node reconnects.
+	if missing {
+		c.addPendingDelete(instanceID, i.LastNodeID, requestID)
+		return nil
+	}
+
 	go func() {
-		if err := c.client.DeleteInstance(instanceID, i.NodeID); err != nil {
+		if err := c.client.DeleteInstance(instanceID, i.NodeID, requestID); err != nil {
 			glog.Warningf("Error deleting instance: %v", err)
 		}
 	}()
@@ -167,6 +188,55 @@ func (c *controller) deleteInstance(instanceID string) error {
 	return nil
 }
 
+// pendingDelete records the deletion of a missing instance until the node
+// the instance was running on reconnects.
+type pendingDelete struct {
+	nodeID    string
+	requestID string
+}
+
+// addPendingDelete records that a missing instance is to be deleted once
+// its node reconnects.
+func (c *controller) addPendingDelete(instanceID string, nodeID string, requestID string) {
+	c.pendingDeletesLock.Lock()
+	defer c.pendingDeletesLock.Unlock()
+
+	if c.pendingDeletes == nil {
+		c.pendingDeletes = make(map[string]pendingDelete)
+	}
+	c.pendingDeletes[instanceID] = pendingDelete{
+		nodeID:    nodeID,
+		requestID: requestID,
+	}
+
+	glog.Infof("Instance %s is missing, deleting it once node %s reconnects", instanceID, nodeID)
+}
+
+// sendPendingDeletes deletes the instances that went missing with a node
+// which has reconnected.
+func (c *controller) sendPendingDeletes(nodeID string) {
+	pending := make(map[string]string)
+
+	c.pendingDeletesLock.Lock()
+	for id, d := range c.pendingDeletes {
+		if d.nodeID == nodeID {
+			pending[id] = d.requestID
+			delete(c.pendingDeletes, id)
+		}
+	}
+	c.pendingDeletesLock.Unlock()
+
+	for instanceID, requestID := range pending {
+		if _, err := c.ds.GetInstance(instanceID); err != nil {
+			continue
+		}
+
+		if err := c.client.DeleteInstance(instanceID, nodeID, requestID); err != nil {
+			glog.Warningf("Error deleting instance: %v", err)
+		}
+	}
+}
+
 func (c *controller) confirmTenantRaw(tenantID string) error {
 	tenant, err := c.ds.GetTenant(tenantID)
 	if err != nil {
@@ -232,83 +302,194 @@ func (c *controller) confirmTenant(tenantID string) error {
 	return err
 }
 
+// instanceName returns the name of the i-th of n instances launched with a
+// given name.
+func instanceName(name string, n int, i int) string {
+	if name == "" || n == 1 {
+		return name
+	}
+
+	return fmt.Sprintf("%s-%d", name, i)
+}
+
 func (c *controller) createInstance(w types.WorkloadRequest, wl types.Workload, name string, newIP net.IP) (*types.Instance, error) {
 	startTime := time.Now()
 
-	instance, err := newInstance(c, w.TenantID, &wl, name, w.Subnet, newIP)
+	instance, err := newInstance(c, w.TenantID, &wl, name, w.Subnet, newIP, w.Metadata, w.RequestID)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error creating instance")
 	}
 	instance.startTime = startTime
+	if w.ExpiresIn > 0 {
+		instance.expiresAt = startTime.Add(w.ExpiresIn)
+	}
 
 	ok, err := instance.Allowed()
 	if err != nil {
 		_ = instance.Clean()
+		if !ok {
+			return nil, err
+		}
 		return nil, errors.Wrap(err, "Error checking if instance allowed")
 	}
 
-	if !ok {
-		_ = instance.Clean()
-		return nil, errors.New("Over quota")
-	}
-
 	err = instance.Add()
 	if err != nil {
 		_ = instance.Clean()
 		return nil, errors.Wrap(err, "Error adding instance")
 	}
 
-	if w.TraceLabel == "" {
+	// The start of an instance requested through the API is recorded
+	// in the trace of the request and points to the trace of the
+	// instance, which holds the spans of its SSNTP frames.
+	var span *tracing.Span
+	if w.SpanID != "" {
+		span = c.tracer.StartSpanAt(tracing.SpanContext{TraceID: w.TraceID, SpanID: w.SpanID},
+			"start instance", "ciao-controller", startTime)
+		span.SetTag("instance_id", instance.ID)
+		span.SetTag("instance.trace_id", tracing.TraceIDFromUUID(instance.ID))
+	}
+
+	// All START commands are traced when spans are being recorded so
+	// that the launch of every instance can be followed.
+	if w.TraceLabel == "" && c.tracer == nil {
 		err = c.client.StartWorkload(instance.newConfig.config)
 	} else {
 		err = c.client.StartTracedWorkload(instance.newConfig.config, instance.startTime, w.TraceLabel)
 	}
 
 	if err != nil {
+		span.SetTag("error", err.Error())
+		span.Finish()
 		_ = instance.Clean()
 		return nil, errors.Wrap(err, "Error starting workload")
 	}
+	span.Finish()
 
 	return instance.Instance, nil
 }
 
 func (c *controller) startWorkload(w types.WorkloadRequest) ([]*types.Instance, error) {
-	var e error
+	instances, failures, err := c.startWorkloadResults(w)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(failures) > 0 {
+		// return the first error
+		return instances, failures[0].err
+	}
+
+	return instances, nil
+}
+
+// launchFailure records why one of the instances of a workload request
+// could not be started.
+type launchFailure struct {
+	name string
+	err  error
+}
+
+// startWorkloadResults starts the instances of a workload request.  It
+// returns the instances that were started along with a launchFailure for
+// each instance that could not be.  An error is returned if the request
+// itself is invalid, in which case no instances are started.
+func (c *controller) startWorkloadResults(w types.WorkloadRequest) ([]*types.Instance, []launchFailure, error) {
 	var sem = make(chan int, runtime.NumCPU())
 
 	if w.Instances <= 0 {
-		return nil, errors.New("Missing number of instances to start")
+		return nil, nil, errors.New("Missing number of instances to start")
 	}
 
 	wl, err := c.ds.GetWorkload(w.WorkloadID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// wl is a copy so the workload itself is left untouched
+	if w.UserData != "" {
+		wl.Config, err = overrideUserData(wl.Config, w.UserData, w.ReplaceUserData)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	if wl.Requirements.Privileged {
 		tenant, err := c.ds.GetTenant(w.TenantID)
 		if err != nil {
-			return nil, errors.Wrap(err, "error getting tenant from datastore")
+			return nil, nil, errors.Wrap(err, "error getting tenant from datastore")
 		}
 
 		if !tenant.Permissions.PrivilegedContainers {
-			return nil, errors.New("Permission denied: you do not have permission to create privileged workloads")
+			return nil, nil, errors.New("Permission denied: you do not have permission to create privileged workloads")
 		}
 	}
 
 	var IPPool []net.IP
+	reservedIP := false
 
 	// if this is for a CNCI, we don't want to allocate any IPs.
-	if w.Subnet == "" {
+	if w.IPAddress != "" {
+		if w.Subnet != "" || w.Instances != 1 {
+			return nil, nil, types.ErrBadRequest
+		}
+
+		ip := net.ParseIP(w.IPAddress)
+		if ip == nil {
+			return nil, nil, types.ErrInvalidIP
+		}
+
+		if w.SubnetID != "" {
+			subnet, err := c.ds.GetTenantSubnet(w.TenantID, w.SubnetID)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			_, ipNet, err := net.ParseCIDR(subnet.CIDR)
+			if err != nil || !ipNet.Contains(ip) {
+				return nil, nil, types.ErrInvalidIP
+			}
+		}
+
+		// A reserved address is already claimed for the tenant.  The
+		// reservation is only consumed once the instance has been
+		// added, and launches on reserved addresses are serialised so
+		// that a reservation is not handed to two instances.
+		c.reservedIPsLock.Lock()
+		defer c.reservedIPsLock.Unlock()
+
+		reservedIP, err = c.ds.IsReservedTenantIP(w.TenantID, ip.String())
+		if err != nil {
+			return nil, nil, err
+		}
+		if !reservedIP {
+			err = c.ds.ClaimTenantIP(w.TenantID, ip)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		IPPool = []net.IP{ip.To4()}
+	} else if w.SubnetID != "" {
+		if w.Subnet != "" {
+			return nil, nil, types.ErrBadRequest
+		}
+
+		IPPool, err = c.ds.AllocateSubnetIPPool(w.TenantID, w.SubnetID, w.Instances)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if w.Subnet == "" {
 		IPPool, err = c.ds.AllocateTenantIPPool(w.TenantID, w.Instances)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	var newInstances []*types.Instance
+	var failures []launchFailure
 	type result struct {
 		instance *types.Instance
+		name     string
 		err      error
 	}
 
@@ -321,18 +502,14 @@ func (c *controller) startWorkload(w types.WorkloadRequest) ([]*types.Instance,
 			newIP = IPPool[i]
 		}
 
-		name := w.Name
-		if name != "" {
-			if w.Instances > 1 {
-				name = fmt.Sprintf("%s-%d", name, i)
-			}
-		}
+		name := instanceName(w.Name, w.Instances, i)
 
 		go func(newIP net.IP, name string) {
 			sem <- 1
 			instance, err := c.createInstance(w, wl, name, newIP)
 			ret := result{
 				err:      err,
+				name:     name,
 				instance: instance,
 			}
 			<-sem
@@ -344,13 +521,35 @@ func (c *controller) startWorkload(w types.WorkloadRequest) ([]*types.Instance,
 		retVal := <-errChan
 		if retVal.err == nil {
 			newInstances = append(newInstances, retVal.instance)
-		} else if e == nil {
-			// return the first error
-			e = retVal.err
+		} else {
+			failures = append(failures, launchFailure{retVal.name, retVal.err})
+		}
+	}
+
+	if reservedIP {
+		c.settleReservedIP(w.TenantID, IPPool[0], len(newInstances) > 0)
+	}
+
+	return newInstances, failures, nil
+}
+
+// settleReservedIP consumes the reservation of an address once an instance
+// has been launched on it.  If the launch failed, the address, which was
+// released when the instance was cleaned up, is claimed again so that it
+// remains reserved.
+func (c *controller) settleReservedIP(tenantID string, ip net.IP, launched bool) {
+	if launched {
+		err := c.ds.TakeReservedTenantIP(tenantID, ip.String())
+		if err != nil {
+			glog.Warningf("Unable to consume reservation of %s: %v", ip, err)
 		}
+		return
 	}
 
-	return newInstances, e
+	err := c.ds.ClaimTenantIP(tenantID, ip)
+	if err != nil && err != types.ErrIPInUse {
+		glog.Warningf("Unable to restore reservation of %s: %v", ip, err)
+	}
 }
 
 func (c *controller) deleteEphemeralStorage(instanceID string) error {
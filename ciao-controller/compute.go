@@ -15,12 +15,17 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"regexp"
 	"sort"
+	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/internal/tracing"
 	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 )
 
@@ -52,16 +57,116 @@ func instanceToServer(ctl *controller, instance *types.Instance) (api.ServerDeta
 		Name:    instance.Name,
 	}
 
+	if deletedAt, ok := ctl.ds.GetInstanceDeletedAt(instance.ID); ok {
+		deleteAt := deletedAt.Add(ctl.instanceReaper.window)
+		server.DeleteAt = &deleteAt
+	}
+
+	if expiresAt, ok := ctl.ds.GetInstanceExpiry(instance.ID); ok {
+		server.ExpiresAt = &expiresAt
+	}
+
+	if metadata := ctl.ds.GetInstanceMetadata(instance.ID); len(metadata) > 0 {
+		server.Metadata = metadata
+	}
+
 	return server, nil
 }
 
-func (c *controller) CreateServer(tenant string, server api.CreateServerRequest) (resp interface{}, err error) {
-	nInstances := 1
+// userDataFromRequest decodes the user data of a create request and
+// returns it along with whether it should replace the workload config.
+func userDataFromRequest(server api.CreateServerRequest) (string, bool, error) {
+	var replace bool
+
+	switch server.Server.UserDataMode {
+	case "", api.UserDataMerge:
+	case api.UserDataReplace:
+		replace = true
+	default:
+		return "", false, types.ErrBadRequest
+	}
+
+	userData, err := base64.StdEncoding.DecodeString(server.Server.UserData)
+	if err != nil {
+		return "", false, types.ErrBadRequest
+	}
+
+	return string(userData), replace, nil
+}
+
+// Limits on the metadata of an instance, as in OpenStack
+const (
+	maxMetadataItems  = 128
+	maxMetadataLength = 255
+)
 
-	if server.Server.MaxInstances > 0 {
-		nInstances = server.Server.MaxInstances
-	} else if server.Server.MinInstances > 0 {
-		nInstances = server.Server.MinInstances
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataItems {
+		return types.ErrBadRequest
+	}
+
+	for k, v := range metadata {
+		if k == "" || len(k) > maxMetadataLength || len(v) > maxMetadataLength {
+			return types.ErrBadRequest
+		}
+	}
+
+	return nil
+}
+
+// instanceCounts returns the minimum and maximum number of instances
+// requested.  Both default to 1 and the maximum defaults to the minimum
+// when only the minimum is provided.
+func instanceCounts(server api.CreateServerRequest) (int, int, error) {
+	minInstances := server.Server.MinInstances
+	maxInstances := server.Server.MaxInstances
+
+	if minInstances < 0 || maxInstances < 0 {
+		return 0, 0, types.ErrBadRequest
+	}
+
+	if maxInstances == 0 {
+		maxInstances = minInstances
+	}
+	if maxInstances == 0 {
+		maxInstances = 1
+	}
+	if minInstances == 0 {
+		minInstances = 1
+	}
+
+	if minInstances > maxInstances {
+		return 0, 0, types.ErrBadRequest
+	}
+
+	return minInstances, maxInstances, nil
+}
+
+// rollbackInstances deletes instances that were started by a request
+// that could not launch its minimum number of instances.  Instances
+// cannot be deleted until they have been assigned to a node so we
+// wait for them to leave the pending state first.
+func (c *controller) rollbackInstances(tenant string, requestID string, instances []*types.Instance) {
+	for _, instance := range instances {
+		go func(instance *types.Instance) {
+			// An error means the instance failed to start or left
+			// the pending state, in both cases we can go on.
+			_ = c.waitForInstancesActive([]*types.Instance{instance}, bootStepTimeout)
+
+			err := c.deleteInstance(instance.ID, requestID)
+			if err != nil && err != types.ErrInstanceNotFound {
+				glog.Warningf("Unable to roll back instance %s: %v", instance.ID, err)
+				_ = c.ds.LogRequestError(tenant, requestID, fmt.Sprintf("Unable to roll back instance %s: %v",
+					instance.ID, err))
+			}
+		}(instance)
+	}
+}
+
+func (c *controller) CreateServer(ctx context.Context, tenant string, server api.CreateServerRequest, user string, requestID string) (resp interface{}, err error) {
+	minInstances, nInstances, err := instanceCounts(server)
+	if err != nil {
+		return server, err
 	}
 
 	if server.Server.Name != "" {
@@ -72,38 +177,103 @@ func (c *controller) CreateServer(tenant string, server api.CreateServerRequest)
 		}
 	}
 
+	if server.Server.ExpiresIn < 0 {
+		return server, types.ErrBadRequest
+	}
+
+	if len(server.Server.BootSteps) > 0 {
+		if server.Server.IPAddress != "" {
+			return server, types.ErrBadRequest
+		}
+		return c.createComposedServers(tenant, server, user, requestID, tracing.FromContext(ctx).Context())
+	}
+
+	// Instance names are unique within a tenant.  The tenant may not
+	// have been created yet, in which case it has no instances.
+	if server.Server.Name != "" {
+		for i := 0; i < nInstances; i++ {
+			id, _ := c.ds.ResolveInstance(tenant, instanceName(server.Server.Name, nInstances, i))
+			if id != "" {
+				return server, types.ErrDuplicateName
+			}
+		}
+	}
+
+	if err := validateMetadata(server.Server.Metadata); err != nil {
+		return server, err
+	}
+
 	label := server.Server.Metadata["label"]
 
+	userData, replace, err := userDataFromRequest(server)
+	if err != nil {
+		return server, err
+	}
+
+	parent := tracing.FromContext(ctx).Context()
 	w := types.WorkloadRequest{
-		WorkloadID: server.Server.WorkloadID,
-		TenantID:   tenant,
-		Instances:  nInstances,
-		TraceLabel: label,
-		Name:       server.Server.Name,
-	}
-	var e error
-	instances, err := c.startWorkload(w)
+		WorkloadID:      server.Server.WorkloadID,
+		TenantID:        tenant,
+		Instances:       nInstances,
+		TraceLabel:      label,
+		Name:            server.Server.Name,
+		SubnetID:        server.Server.SubnetID,
+		IPAddress:       server.Server.IPAddress,
+		UserData:        userData,
+		ReplaceUserData: replace,
+		Metadata:        server.Server.Metadata,
+		RequestID:       requestID,
+		ExpiresIn:       time.Duration(server.Server.ExpiresIn) * time.Second,
+		TraceID:         parent.TraceID,
+		SpanID:          parent.SpanID,
+	}
+	instances, failures, err := c.startWorkloadResults(w)
 	if err != nil {
-		e = err
+		_ = c.ds.LogRequestError(tenant, requestID, fmt.Sprintf("Error launching instance(s): %v", err))
+		return server, err
 	}
 
 	var servers api.Servers
+	var quotaErr *types.QuotaError
+
+	for _, f := range failures {
+		if qe, ok := f.err.(*types.QuotaError); ok {
+			_ = c.ds.LogRequestError(tenant, requestID, fmt.Sprintf("Quota exceeded launching instance %s: %v", f.name, f.err))
+			if quotaErr == nil {
+				quotaErr = qe
+			}
+		} else {
+			_ = c.ds.LogRequestError(tenant, requestID, fmt.Sprintf("Error launching instance %s: %v", f.name, f.err))
+		}
+		servers.Failures = append(servers.Failures, api.LaunchFailure{
+			Name:   f.name,
+			Reason: f.err.Error(),
+		})
+	}
 
-	for _, instance := range instances {
-		server, err := instanceToServer(c, instance)
-		if err != nil && e == nil {
-			e = err
+	// Fewer than the minimum requested, undo what we have started
+	if len(instances) < minInstances {
+		_ = c.ds.LogRequestError(tenant, requestID, fmt.Sprintf("Only %d of a minimum of %d instance(s) launched, rolling back",
+			len(instances), minInstances))
+		c.rollbackInstances(tenant, requestID, instances)
+		if quotaErr != nil {
+			return server, quotaErr
 		}
-		servers.Servers = append(servers.Servers, server)
+		return server, types.ErrMinInstances
 	}
 
-	if e != nil {
-		_ = c.ds.LogError(tenant, fmt.Sprintf("Error launching instance(s): %v", e))
+	for _, instance := range instances {
+		glog.Infof("Launching instance %s for request %s", instance.ID, requestID)
+		c.recordInstanceAction(instance, types.InstanceActionCreate, user, nil)
 	}
 
-	// If no instances launcher or if none converted bail early
-	if e != nil && len(servers.Servers) == 0 {
-		return server, e
+	for _, instance := range instances {
+		server, err := instanceToServer(c, instance)
+		if err != nil {
+			_ = c.ds.LogRequestError(tenant, requestID, fmt.Sprintf("Error launching instance(s): %v", err))
+			continue
+		}
+		servers.Servers = append(servers.Servers, server)
 	}
 
 	servers.TotalServers = len(instances)
@@ -123,6 +293,7 @@ func (c *controller) CreateServer(tenant string, server api.CreateServerRequest)
 		api.Servers{
 			TotalServers: servers.TotalServers,
 			Servers:      servers.Servers,
+			Failures:     servers.Failures,
 		},
 	}
 
@@ -158,10 +329,22 @@ func (c *controller) ListServersDetail(tenant string) ([]api.ServerDetails, erro
 	return servers, nil
 }
 
+// resolveServer returns the ID of the instance of a tenant identified by
+// server, either its ID or its name.  server is returned as is if no such
+// instance is found.
+func (c *controller) resolveServer(tenant string, server string) string {
+	id, err := c.ds.ResolveInstance(tenant, server)
+	if err != nil || id == "" {
+		return server
+	}
+
+	return id
+}
+
 func (c *controller) ShowServerDetails(tenant string, server string) (api.Server, error) {
 	var s api.Server
 
-	instance, err := c.ds.GetTenantInstance(tenant, server)
+	instance, err := c.ds.GetTenantInstance(tenant, c.resolveServer(tenant, server))
 	if err != nil {
 		return s, err
 	}
@@ -174,40 +357,206 @@ func (c *controller) ShowServerDetails(tenant string, server string) (api.Server
 	return s, nil
 }
 
-func (c *controller) DeleteServer(tenant string, server string) error {
+// ListServerMetadata returns the metadata of an instance.
+func (c *controller) ListServerMetadata(tenant string, server string) (map[string]string, error) {
+	if _, err := c.ds.GetTenantInstance(tenant, server); err != nil {
+		return nil, types.ErrInstanceNotFound
+	}
+
+	return c.ds.GetInstanceMetadata(server), nil
+}
+
+// UpdateServerMetadata sets the given metadata of an instance, keeping the
+// other keys unless replace is set, and returns the resulting metadata.
+func (c *controller) UpdateServerMetadata(tenant string, server string, metadata map[string]string, replace bool) (map[string]string, error) {
+	if _, err := c.ds.GetTenantInstance(tenant, server); err != nil {
+		return nil, types.ErrInstanceNotFound
+	}
+
+	// concurrent updates must not lose each other's keys
+	c.metadataLock.Lock()
+	defer c.metadataLock.Unlock()
+
+	updated := make(map[string]string)
+	if !replace {
+		updated = c.ds.GetInstanceMetadata(server)
+	}
+	for k, v := range metadata {
+		updated[k] = v
+	}
+
+	if err := validateMetadata(updated); err != nil {
+		return nil, err
+	}
+
+	if err := c.ds.SetInstanceMetadata(server, updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteServerMetadata removes a key from the metadata of an instance.
+func (c *controller) DeleteServerMetadata(tenant string, server string, key string) error {
+	if _, err := c.ds.GetTenantInstance(tenant, server); err != nil {
+		return types.ErrInstanceNotFound
+	}
+
+	c.metadataLock.Lock()
+	defer c.metadataLock.Unlock()
+
+	metadata := c.ds.GetInstanceMetadata(server)
+	if _, ok := metadata[key]; !ok {
+		return types.ErrMetadataNotFound
+	}
+	delete(metadata, key)
+
+	return c.ds.SetInstanceMetadata(server, metadata)
+}
+
+func (c *controller) DeleteServer(tenant string, server string, user string, requestID string) error {
+	server = c.resolveServer(tenant, server)
+
 	/* First check that the instance belongs to this tenant */
-	_, err := c.ds.GetTenantInstance(tenant, server)
+	i, err := c.ds.GetTenantInstance(tenant, server)
 	if err != nil {
 		return api.ErrInstanceNotFound
 	}
 
-	err = c.deleteInstance(server)
+	err = c.deleteServerInstance(i, requestID)
+	c.recordInstanceAction(i, types.InstanceActionDelete, user, err)
 
 	return err
 }
 
-func (c *controller) StartServer(tenant string, ID string) error {
-	_, err := c.ds.GetTenantInstance(tenant, ID)
+// deleteServerInstance deletes an instance at the request of a user.  The
+// deletion is deferred if the instance reaper is enabled, unless the
+// instance was already soft deleted, in which case it is deleted for good.
+func (c *controller) deleteServerInstance(i *types.Instance, requestID string) error {
+	_, deleted := c.ds.GetInstanceDeletedAt(i.ID)
+	if c.instanceReaper.enabled() && !deleted && !i.CNCI {
+		glog.Infof("Soft deleting instance %s for request %s", i.ID, requestID)
+		return c.softDeleteInstance(i, requestID)
+	}
+
+	glog.Infof("Deleting instance %s for request %s", i.ID, requestID)
+	return c.deleteInstance(i.ID, requestID)
+}
+
+// RestoreServer cancels the deferred deletion of an instance.
+func (c *controller) RestoreServer(tenant string, ID string, user string, requestID string) error {
+	i, err := c.ds.GetTenantInstance(tenant, ID)
 	if err != nil {
 		return err
 	}
 
-	err = c.restartInstance(ID)
+	glog.Infof("Restoring instance %s for request %s", ID, requestID)
+	err = c.restoreInstance(i)
+	c.recordInstanceAction(i, types.InstanceActionRestore, user, err)
 
 	return err
 }
 
-func (c *controller) StopServer(tenant string, ID string) error {
-	_, err := c.ds.GetTenantInstance(tenant, ID)
+func (c *controller) StartServer(tenant string, ID string, user string, requestID string) error {
+	i, err := c.ds.GetTenantInstance(tenant, ID)
 	if err != nil {
 		return err
 	}
 
-	err = c.stopInstance(ID)
+	glog.Infof("Starting instance %s for request %s", ID, requestID)
+	err = c.restartInstance(ID, requestID)
+	c.recordInstanceAction(i, types.InstanceActionStart, user, err)
 
 	return err
 }
 
+func (c *controller) StopServer(tenant string, ID string, user string, requestID string) error {
+	i, err := c.ds.GetTenantInstance(tenant, ID)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Stopping instance %s for request %s", ID, requestID)
+	err = c.stopInstance(ID, requestID)
+	c.recordInstanceAction(i, types.InstanceActionStop, user, err)
+
+	return err
+}
+
+// MigrateServer moves a running instance to another node by stopping it
+// and restarting it once stopped.
+func (c *controller) MigrateServer(tenant string, ID string, user string, requestID string) error {
+	i, err := c.ds.GetTenantInstance(tenant, ID)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Migrating instance %s for request %s", ID, requestID)
+	err = c.migrateInstance(i, requestID)
+	c.recordInstanceAction(i, types.InstanceActionMigrate, user, err)
+
+	return err
+}
+
+// ListInstanceActions returns the history of an instance.  The history of
+// deleted instances remains available.
+func (c *controller) ListInstanceActions(tenant string, ID string) ([]types.InstanceAction, error) {
+	actions, err := c.ds.GetInstanceActions(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(actions) == 0 || actions[0].TenantID != tenant {
+		return nil, types.ErrInstanceNotFound
+	}
+
+	return actions, nil
+}
+
+// ListInstanceCrashes returns the crashes of an instance along with the
+// location of the artifacts collected by its node.
+func (c *controller) ListInstanceCrashes(tenant string, ID string) ([]types.InstanceCrash, error) {
+	crashes, err := c.ds.GetInstanceCrashes(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(crashes) == 0 {
+		if _, err := c.ds.GetTenantInstance(tenant, ID); err != nil {
+			return nil, types.ErrInstanceNotFound
+		}
+		return []types.InstanceCrash{}, nil
+	}
+
+	if crashes[0].TenantID != tenant {
+		return nil, types.ErrInstanceNotFound
+	}
+
+	return crashes, nil
+}
+
+// recordInstanceAction adds a user requested action to the history of an
+// instance.  The action failed if err is not nil.
+func (c *controller) recordInstanceAction(i *types.Instance, action string, user string, err error) {
+	a := types.InstanceAction{
+		InstanceID: i.ID,
+		TenantID:   i.TenantID,
+		Action:     action,
+		User:       user,
+		NodeID:     i.NodeID,
+		Result:     types.InstanceActionSuccess,
+	}
+
+	if err != nil {
+		a.Result = types.InstanceActionError
+		a.Reason = err.Error()
+	}
+
+	if err := c.ds.AddInstanceAction(a); err != nil {
+		glog.Warningf("Unable to record %s action for instance %s: %v", action, i.ID, err)
+	}
+}
+
 func (c *controller) createComputeRoutes(r *mux.Router) error {
 	legacyComputeRoutes(c, r)
 
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -24,6 +25,7 @@ import (
 	"net/url"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,6 +36,7 @@ import (
 	"github.com/ciao-project/ciao/payloads"
 	"github.com/ciao-project/ciao/ssntp"
 	"github.com/ciao-project/ciao/testutil"
+	"github.com/ciao-project/ciao/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -82,6 +85,10 @@ func testHTTPRequest(t *testing.T, method string, URL string, expectedResponse i
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.Header.Get(api.RequestIDHeader) == "" {
+		t.Errorf("Missing %s header", api.RequestIDHeader)
+	}
+
 	if resp.StatusCode != expectedResponse {
 		var msg string
 
@@ -298,7 +305,7 @@ func testServersActionStart(t *testing.T, httpExpectedStatus int, validToken boo
 
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 
-	err = ctl.stopInstance(servers.Servers[0].ID)
+	err = ctl.stopInstance(servers.Servers[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -382,6 +389,114 @@ func TestServersActionStopWrongAction(t *testing.T) {
 	testServersActionStop(t, http.StatusServiceUnavailable, "wrong-action")
 }
 
+func TestServersActionSoftDelete(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/servers/action"
+
+	client, err := testutil.NewSsntpTestClientConnection("ServersActionSoftDelete", ssntp.AGENT, testutil.AgentUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+
+	servers := testCreateServer(t, 1)
+	if servers.TotalServers != 1 {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	ctl.instanceReaper.window = time.Hour
+	defer func() { ctl.instanceReaper.window = 0 }()
+
+	cmd := types.CiaoServersAction{
+		Action:    "os-delete",
+		ServerIDs: []string{servers.Servers[0].ID},
+	}
+
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = testHTTPRequest(t, "POST", url, http.StatusAccepted, b, true)
+
+	if _, ok := ctl.ds.GetInstanceDeletedAt(servers.Servers[0].ID); !ok {
+		t.Fatal("Instance not soft deleted by os-delete")
+	}
+
+	// don't leave the instance for the reaper of later tests to delete
+	if err := ctl.ds.RestoreInstance(servers.Servers[0].ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServersActionResults(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/servers/action"
+
+	client, err := testutil.NewSsntpTestClientConnection("ServersActionResults", ssntp.AGENT, testutil.AgentUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+
+	servers := testCreateServer(t, 1)
+	if servers.TotalServers != 1 {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	unknownID := uuid.Generate().String()
+	cmd := types.CiaoServersAction{
+		Action:    "os-stop",
+		ServerIDs: []string{unknownID, servers.Servers[0].ID},
+	}
+
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := testHTTPRequest(t, "POST", url, http.StatusAccepted, b, true)
+
+	var results types.CiaoServersActionResults
+	err = json.Unmarshal(body, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results.Results))
+	}
+
+	failures := results.Failures()
+	if len(failures) != 1 || failures[0].ServerID != unknownID || failures[0].Reason == "" {
+		t.Fatalf("Unexpected failures %v", failures)
+	}
+
+	if results.Results[1].ServerID != servers.Servers[0].ID || !results.Results[1].Success {
+		t.Fatalf("Unexpected result %v", results.Results[1])
+	}
+}
+
 func testServerActionStop(t *testing.T, httpExpectedStatus int, validToken bool) {
 	action := "os-stop"
 
@@ -442,7 +557,7 @@ func TestServerActionStart(t *testing.T) {
 
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 
-	err = ctl.stopInstance(servers.Servers[0].ID)
+	err = ctl.stopInstance(servers.Servers[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -589,6 +704,46 @@ func TestListTenantQuotas(t *testing.T) {
 	testListTenantQuotas(t, http.StatusOK, true)
 }
 
+func TestUpdateTenantQuotas(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/quotas"
+
+	old := ctl.qs.DumpQuotas(tenant.ID)
+	defer func() {
+		if err := ctl.UpdateQuotas(tenant.ID, old); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	_ = testHTTPRequest(t, "PUT", url, http.StatusBadRequest, []byte(`{"instances_limit": -2}`), true)
+
+	body := testHTTPRequest(t, "PUT", url, http.StatusOK, []byte(`{"instances_limit": 5, "ram_limit": 1024}`), true)
+
+	var result types.CiaoTenantResources
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.InstanceLimit != 5 || result.MemLimit != 1024 {
+		t.Fatalf("Limits not updated: %+v", result)
+	}
+
+	qds, err := ctl.ds.GetQuotas(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qd := findQuota(qds, "tenant-instances-quota")
+	if qd == nil || qd.Value != 5 {
+		t.Fatal("Instance limit not persisted")
+	}
+}
+
 func testListEventsTenant(t *testing.T, httpExpectedStatus int, validToken bool) {
 	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
 	if err != nil {
@@ -726,6 +881,38 @@ func TestListNodes(t *testing.T) {
 	testListNodes(t, http.StatusOK, true)
 }
 
+func TestShowNode(t *testing.T) {
+	nodes := ctl.ds.GetNodeLastStats()
+	if len(nodes.Nodes) == 0 {
+		t.Skip("No nodes available")
+	}
+
+	expected, err := ctl.ds.GetNodeDetails(nodes.Nodes[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/nodes/" + expected.ID
+
+	body := testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var result types.CiaoNodeDetails
+
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.ID != expected.ID || result.Hostname != expected.Hostname ||
+		!reflect.DeepEqual(result.Roles, expected.Roles) ||
+		!reflect.DeepEqual(result.Networks, expected.Networks) {
+		t.Fatalf("expected: \n%+v\n result: \n%+v\n", expected, result)
+	}
+
+	url = testutil.ComputeURL + "/v2.1/nodes/unknown-node"
+	_ = testHTTPRequest(t, "GET", url, http.StatusNotFound, nil, true)
+}
+
 func testListCNCIs(t *testing.T, httpExpectedStatus int, validToken bool) {
 	var expected types.CiaoCNCIs
 
@@ -846,6 +1033,91 @@ func TestListCNCIDetails(t *testing.T) {
 	testListCNCIDetails(t, http.StatusOK, true)
 }
 
+func TestNativeListCNCIs(t *testing.T) {
+	url := testutil.ComputeURL + nativeAPIPrefix + "/cncis"
+
+	body := testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var all types.CiaoCNCIs
+	err := json.Unmarshal(body, &all)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sort.SliceIsSorted(all.CNCIs, func(i, j int) bool {
+		return all.CNCIs[i].ID < all.CNCIs[j].ID
+	}) {
+		t.Fatalf("CNCIs not sorted by ID: %+v", all.CNCIs)
+	}
+
+	if len(all.CNCIs) < 2 {
+		return
+	}
+
+	url = fmt.Sprintf("%s?limit=1&marker=%s", url, all.CNCIs[0].ID)
+	body = testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var page types.CiaoCNCIs
+	err = json.Unmarshal(body, &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.CNCIs) != 1 || !reflect.DeepEqual(page.CNCIs[0], all.CNCIs[1]) {
+		t.Fatalf("expected: \n%+v\n result: \n%+v\n", all.CNCIs[1:2], page.CNCIs)
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	ids := []string{"a", "b", "c", "d"}
+	id := func(i int) string { return ids[i] }
+
+	tests := []struct {
+		query string
+		start int
+		end   int
+		err   bool
+	}{
+		{"", 0, 4, false},
+		{"limit=2", 0, 2, false},
+		{"limit=2&offset=3", 3, 4, false},
+		{"offset=10", 4, 4, false},
+		{"limit=1&marker=b", 2, 3, false},
+		{"marker=d", 4, 4, false},
+		{"marker=e", 0, 0, true},
+		{"marker=bb", 0, 0, true},
+		{"marker=a", 1, 4, false},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequest("GET", "/ciao/v1/cncis?"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start, end, err := pageBounds(r, len(ids), id)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.query, err)
+			continue
+		}
+		if !tt.err && (start != tt.start || end != tt.end) {
+			t.Errorf("%s: expected [%d:%d] got [%d:%d]", tt.query, tt.start, tt.end, start, end)
+		}
+	}
+}
+
+func TestPagerQueryParseMaxLimit(t *testing.T) {
+	r, err := http.NewRequest("GET", fmt.Sprintf("/v2.1/nodes?limit=%d", types.MaxPageSize+1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit, _, _ := pagerQueryParse(r)
+	if limit != types.MaxPageSize {
+		t.Errorf("expected limit %d got %d", types.MaxPageSize, limit)
+	}
+}
+
 func testListTraces(t *testing.T, httpExpectedStatus int, validToken bool) {
 	var expected types.CiaoTracesSummary
 
@@ -1015,3 +1287,160 @@ func testTraceData(t *testing.T, httpExpectedStatus int, validToken bool) {
 func TestTraceData(t *testing.T) {
 	testTraceData(t, http.StatusOK, true)
 }
+
+func TestOrderBootSteps(t *testing.T) {
+	steps := []api.BootStep{
+		{Name: "app", WorkloadID: "w1", Instances: 2, DependsOn: []string{"db", "cache"}},
+		{Name: "db", WorkloadID: "w2", Instances: 1},
+		{Name: "cache", WorkloadID: "w3", Instances: 1},
+		{Name: "lb", WorkloadID: "w4", Instances: 1, DependsOn: []string{"app"}},
+	}
+
+	stages, err := orderBootSteps(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names [][]string
+	for _, stage := range stages {
+		var n []string
+		for _, s := range stage {
+			n = append(n, s.Name)
+		}
+		names = append(names, n)
+	}
+
+	expected := [][]string{{"cache", "db"}, {"app"}, {"lb"}}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Unexpected boot stages %v, expected %v", names, expected)
+	}
+
+	invalid := [][]api.BootStep{
+		{{Name: "a", WorkloadID: "w", Instances: 1, DependsOn: []string{"b"}},
+			{Name: "b", WorkloadID: "w", Instances: 1, DependsOn: []string{"a"}}},
+		{{Name: "a", WorkloadID: "w", Instances: 1, DependsOn: []string{"missing"}}},
+		{{Name: "a", WorkloadID: "w", Instances: 1}, {Name: "a", WorkloadID: "w", Instances: 1}},
+		{{Name: "a", WorkloadID: "w", Instances: 0}},
+		{{Name: "", WorkloadID: "w", Instances: 1}},
+	}
+
+	for _, steps := range invalid {
+		if _, err := orderBootSteps(steps); err != types.ErrBadBootSteps {
+			t.Errorf("Invalid boot steps %v accepted", steps)
+		}
+	}
+}
+
+func TestOverrideUserData(t *testing.T) {
+	workloadConfig := "---\n#cloud-config\nruncmd:\n  - [ touch, /a ]\nhostname: base\n...\n"
+	userData := "#cloud-config\nruncmd:\n  - [ touch, /b ]\nhostname: override\n"
+
+	config, err := overrideUserData(workloadConfig, userData, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var merged map[string]interface{}
+	err = yaml.Unmarshal([]byte(cloudInitBody(config)), &merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged["hostname"] != "override" {
+		t.Errorf("hostname not overridden: %v", merged["hostname"])
+	}
+	if runcmd, ok := merged["runcmd"].([]interface{}); !ok || len(runcmd) != 2 {
+		t.Errorf("runcmd not merged: %v", merged["runcmd"])
+	}
+
+	config, err = overrideUserData(workloadConfig, "#!/bin/sh\necho hello\n", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != "---\n#!/bin/sh\necho hello\n...\n" {
+		t.Errorf("Unexpected replaced config: %q", config)
+	}
+
+	_, err = overrideUserData(workloadConfig, "#!/bin/sh\necho hello\n", false)
+	if err != types.ErrBadRequest {
+		t.Errorf("Merging a script should fail: %v", err)
+	}
+}
+
+func TestInstanceCounts(t *testing.T) {
+	tests := []struct {
+		min, max       int
+		expMin, expMax int
+		valid          bool
+	}{
+		{0, 0, 1, 1, true},
+		{0, 5, 1, 5, true},
+		{3, 0, 3, 3, true},
+		{2, 4, 2, 4, true},
+		{5, 2, 0, 0, false},
+		{-1, 2, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		var server api.CreateServerRequest
+		server.Server.MinInstances = test.min
+		server.Server.MaxInstances = test.max
+
+		min, max, err := instanceCounts(server)
+		if (err == nil) != test.valid {
+			t.Errorf("instanceCounts(%d, %d) returned %v", test.min, test.max, err)
+			continue
+		}
+		if test.valid && (min != test.expMin || max != test.expMax) {
+			t.Errorf("instanceCounts(%d, %d) = %d, %d expected %d, %d",
+				test.min, test.max, min, max, test.expMin, test.expMax)
+		}
+	}
+}
+
+func TestCreateComposedServersMetadata(t *testing.T) {
+	var server api.CreateServerRequest
+	server.Server.BootSteps = []api.BootStep{
+		{Name: "db", WorkloadID: "w", Instances: 1},
+	}
+	server.Server.Metadata = map[string]string{"": "value"}
+
+	_, err := ctl.CreateServer(context.Background(), "tenant", server, "", "")
+	if err != types.ErrBadRequest {
+		t.Fatalf("Invalid metadata of a composed server accepted: %v", err)
+	}
+}
+
+func TestUpdateServerMetadataConcurrent(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	tenant := instances[0].TenantID
+	server := instances[0].ID
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			metadata := map[string]string{fmt.Sprintf("key%d", i): "value"}
+			_, err := ctl.UpdateServerMetadata(tenant, server, metadata, false)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	metadata, err := ctl.ListServerMetadata(tenant, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := metadata[fmt.Sprintf("key%d", i)]; !ok {
+			t.Errorf("Metadata key%d lost by a concurrent update", i)
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -252,7 +253,7 @@ func BenchmarkNewConfig(b *testing.B) {
 
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		_, err := newConfig(ctl, &wls[0], id.String(), tenant.ID, fmt.Sprintf("test-%d", n), ip)
+		_, err := newConfig(ctl, &wls[0], id.String(), tenant.ID, fmt.Sprintf("test-%d", n), ip, nil, "")
 		if err != nil {
 			b.Error(err)
 		}
@@ -322,6 +323,9 @@ func TestTenantOutOfBounds(t *testing.T) {
 	_, err = ctl.startWorkload(w)
 	if err == nil {
 		t.Errorf("Not tracking limits correctly")
+	} else if qe, ok := err.(*types.QuotaError); !ok || len(qe.Excesses) != 1 ||
+		qe.Excesses[0].Name != "tenant-instances-quota" || qe.Excesses[0].Excess != 1 {
+		t.Errorf("Expected instance quota to be exceeded by 1: %v", err)
 	}
 	quotas = []types.QuotaDetails{
 		{Name: "tenant-instances-quota", Value: -1},
@@ -336,6 +340,38 @@ func TestStartWorkload(t *testing.T) {
 	defer client.Shutdown()
 }
 
+func TestValidateExtraSpecs(t *testing.T) {
+	valid := map[string]string{
+		"hw:cpu_policy": "dedicated",
+		"ciao:restart":  "always",
+	}
+	if err := validateExtraSpecs(valid); err != nil {
+		t.Errorf("Unexpected error validating %v: %v", valid, err)
+	}
+
+	for _, k := range []string{"", "cpu_policy", ":restart", "hw:", "HW:cpu policy"} {
+		if err := validateExtraSpecs(map[string]string{k: "value"}); err == nil {
+			t.Errorf("Expected error validating extra spec key %q", k)
+		}
+	}
+}
+
+func TestValidateIORequirements(t *testing.T) {
+	valid := payloads.WorkloadRequirements{DiskIOPS: 1000, NetBandwidthMbps: 100}
+	if err := validateIORequirements(valid); err != nil {
+		t.Errorf("Unexpected error validating %+v: %v", valid, err)
+	}
+
+	for _, req := range []payloads.WorkloadRequirements{
+		{DiskIOPS: -1},
+		{NetBandwidthMbps: -1},
+	} {
+		if err := validateIORequirements(req); err != types.ErrBadRequest {
+			t.Errorf("Expected ErrBadRequest validating %+v, got %v", req, err)
+		}
+	}
+}
+
 func TestNamedWorkload(t *testing.T) {
 	var reason payloads.StartFailureReason
 
@@ -411,7 +447,7 @@ func TestDeleteInstance(t *testing.T) {
 
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 
-	err := ctl.deleteInstance(instances[0].ID)
+	err := ctl.deleteInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -435,11 +471,134 @@ func TestStopInstance(t *testing.T) {
 
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 
-	err := ctl.stopInstance(instances[0].ID)
+	err := ctl.stopInstance(instances[0].ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+}
+
+func TestDeleteMissingInstance(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	err := ctl.ds.DeleteNode(client.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.State != payloads.Missing {
+		t.Fatalf("Expected instance to be %s, got %s", payloads.Missing, i.State)
+	}
+
+	err = ctl.deleteInstance(instances[0].ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.pendingDeletesLock.Lock()
+	_, pending := ctl.pendingDeletes[instances[0].ID]
+	ctl.pendingDeletesLock.Unlock()
+	if !pending {
+		t.Fatal("Delete of missing instance not kept until its node reconnects")
+	}
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+
+	ctl.sendPendingDeletes(client.UUID)
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+}
+
+func TestSoftDeleteInstance(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	ctl.instanceReaper.window = time.Hour
+	defer func() { ctl.instanceReaper.window = 0 }()
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+
+	err := ctl.softDeleteInstance(instances[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+
+	if _, ok := ctl.ds.GetInstanceDeletedAt(instances[0].ID); !ok {
+		t.Fatal("Instance not marked as deleted")
+	}
+
+	// the deferred delete window has not passed
+	ctl.reapInstances()
+
+	err = ctl.restoreInstance(instances[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if _, ok := ctl.ds.GetInstanceDeletedAt(instances[0].ID); ok {
+		t.Fatal("Restored instance still marked as deleted")
+	}
+
+	err = ctl.restoreInstance(instances[0])
+	if err != types.ErrInstanceNotDeleted {
+		t.Fatalf("Expected %v, got %v", types.ErrInstanceNotDeleted, err)
+	}
+}
+
+func TestReapInstances(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	err := ctl.ds.SoftDeleteInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.instanceReaper.window = time.Nanosecond
+	defer func() { ctl.instanceReaper.window = 0 }()
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+
+	ctl.reapInstances()
+
 	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
 	if err != nil {
 		t.Fatal(err)
@@ -447,6 +606,151 @@ func TestStopInstance(t *testing.T) {
 	if result.InstanceUUID != instances[0].ID {
 		t.Fatal("Did not get correct Instance ID")
 	}
+
+	// the DELETE is in flight so it is not resent until it fails
+	if ctl.instanceReaper.markDeleting(instances[0].ID, "") {
+		t.Fatal("DELETE of reaped instance not recorded as in flight")
+	}
+
+	serverCh = server.AddCmdChan(ssntp.DELETE)
+
+	ctl.instanceReaper.deleteFailed(instances[0].ID)
+	ctl.reapInstances()
+
+	result, err = server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+}
+
+func TestReaperDeletesInFlight(t *testing.T) {
+	var r instanceReaper
+
+	if !r.markDeleting("instance1", "node1") || !r.markDeleting("instance2", "node2") ||
+		!r.markDeleting("instance3", "node1") {
+		t.Fatal("Unable to record DELETEs in flight")
+	}
+
+	if r.markDeleting("instance1", "node1") {
+		t.Fatal("DELETE recorded twice")
+	}
+
+	r.nodeReconnected("node1")
+	if !reflect.DeepEqual(r.deleting, map[string]string{"instance2": "node2"}) {
+		t.Fatalf("Unexpected DELETEs in flight after node reconnected: %v", r.deleting)
+	}
+
+	r.deleteFailed("instance2")
+	if len(r.deleting) != 0 {
+		t.Fatalf("Unexpected DELETEs in flight after failure: %v", r.deleting)
+	}
+
+	_ = r.markDeleting("instance1", "node1")
+	_ = r.markDeleting("instance2", "node2")
+	r.forgetDeletes(func(instanceID string) bool { return instanceID == "instance2" })
+	if !reflect.DeepEqual(r.deleting, map[string]string{"instance2": "node2"}) {
+		t.Fatalf("Unexpected DELETEs in flight after removal: %v", r.deleting)
+	}
+}
+
+func TestReapExpiredInstances(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	err := ctl.ds.SetInstanceExpiry(instances[0].ID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+
+	ctl.reapExpiredInstances()
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+
+	// the deletion is retried until the instance is removed
+	if _, ok := ctl.ds.GetInstanceExpiry(instances[0].ID); !ok {
+		t.Fatal("Expiry cleared before the instance was removed")
+	}
+
+	err = ctl.ds.ClearInstanceExpiry(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReapExpiredMappedInstance(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	poolName := "testexpiredmapped"
+	address := "10.10.1.1"
+	testAddPool(t, poolName, nil, []string{address})
+
+	err := ctl.MapAddress(instances[0].TenantID, &poolName, instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// don't leave the pool and mapping for the tests of pools
+	defer func() {
+		_ = ctl.ds.UnMapExternalIP(address)
+		ctl.qs.Release(instances[0].TenantID,
+			payloads.RequestedResource{Type: payloads.ExternalIP, Value: 1})
+
+		pools, _ := ctl.ListPools()
+		for _, pool := range pools {
+			if pool.Name == poolName {
+				_ = ctl.DeletePool(pool.ID)
+			}
+		}
+	}()
+
+	err = ctl.ds.SetInstanceExpiry(instances[0].ID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ctl.ds.ClearInstanceExpiry(instances[0].ID) }()
+
+	ctl.reapExpiredInstances()
+	ctl.reapExpiredInstances()
+
+	if _, ok := ctl.ds.GetInstanceExpiry(instances[0].ID); !ok {
+		t.Fatal("Expiry of mapped instance cleared")
+	}
+
+	entries, err := ctl.ds.GetEventLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := fmt.Sprintf("Unable to delete instance %s expired", instances[0].ID)
+	failures := 0
+	for i := range entries {
+		if strings.HasPrefix(entries[i].Message, prefix) {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Fatalf("Expected failure to be logged once, got %d", failures)
+	}
 }
 
 func TestRestartInstance(t *testing.T) {
@@ -460,7 +764,7 @@ func TestRestartInstance(t *testing.T) {
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 	clientCh := client.AddCmdChan(ssntp.DELETE)
 
-	err := ctl.stopInstance(instances[0].ID)
+	err := ctl.stopInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -484,7 +788,7 @@ func TestRestartInstance(t *testing.T) {
 
 	serverCh = server.AddCmdChan(ssntp.START)
 
-	err = ctl.restartInstance(instances[0].ID)
+	err = ctl.restartInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -498,6 +802,68 @@ func TestRestartInstance(t *testing.T) {
 	}
 }
 
+func TestMigrateStopFailure(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	client.DeleteFail = true
+	client.DeleteFailReason = payloads.DeleteNoInstance
+
+	sendStatsCmd(client, t)
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+	controllerCh := wrappedClient.addErrorChan(ssntp.DeleteFailure)
+
+	err = ctl.migrateInstance(i, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrappedClient.getErrorChan(controllerCh, ssntp.DeleteFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the instance was not stopped, so stopping it later should not
+	// restart it elsewhere.
+	ctl.migrationsLock.Lock()
+	_, migrating := ctl.migrations[i.ID]
+	ctl.migrationsLock.Unlock()
+	if migrating {
+		t.Fatal("Migration not cancelled after stop failure")
+	}
+
+	client.DeleteFail = false
+
+	err = ctl.migrateInstance(i, "")
+	if err != nil {
+		t.Fatalf("Unable to migrate instance again: %v", err)
+	}
+
+	err = ctl.deleteInstance(i.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.migrationsLock.Lock()
+	_, migrating = ctl.migrations[i.ID]
+	ctl.migrationsLock.Unlock()
+	if migrating {
+		t.Fatal("Migration not cancelled after deleting instance")
+	}
+}
+
 func TestEvacuateNode(t *testing.T) {
 	client, err := testutil.NewSsntpTestClientConnection("EvacuateNode", ssntp.AGENT, testutil.AgentUUID)
 	if err != nil {
@@ -729,7 +1095,7 @@ func doDetachVolumeCommand(t *testing.T, fail bool) {
 		serverCh := server.AddCmdChan(ssntp.DELETE)
 		clientCh := client.AddCmdChan(ssntp.DELETE)
 
-		err := ctl.stopInstance(instanceID)
+		err := ctl.stopInstance(instanceID, "")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -799,7 +1165,7 @@ func TestInstanceDeletedEvent(t *testing.T) {
 
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 
-	err := ctl.deleteInstance(instances[0].ID)
+	err := ctl.deleteInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -862,7 +1228,7 @@ func TestStopFailure(t *testing.T) {
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 	controllerCh := wrappedClient.addErrorChan(ssntp.DeleteFailure)
 
-	err = ctl.stopInstance(instances[0].ID)
+	err = ctl.stopInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -899,7 +1265,7 @@ func TestRestartFailure(t *testing.T) {
 	serverCh := server.AddCmdChan(ssntp.DELETE)
 	clientCh := client.AddCmdChan(ssntp.DELETE)
 
-	err = ctl.stopInstance(instances[0].ID)
+	err = ctl.stopInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -926,7 +1292,7 @@ func TestRestartFailure(t *testing.T) {
 	serverCh = server.AddCmdChan(ssntp.START)
 	controllerCh := wrappedClient.addErrorChan(ssntp.StartFailure)
 
-	err = ctl.restartInstance(instances[0].ID)
+	err = ctl.restartInstance(instances[0].ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1334,7 +1700,7 @@ func TestStorageConfig(t *testing.T) {
 
 	ip := net.ParseIP("172.16.0.2")
 
-	_, err = newConfig(ctl, &wls[0], id.String(), tenant.ID, "test", ip)
+	_, err = newConfig(ctl, &wls[0], id.String(), tenant.ID, "test", ip, nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1408,6 +1774,130 @@ func TestCreateImageVolume(t *testing.T) {
 	}
 }
 
+func TestDownloadImagePermissions(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant2, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internal, err := ctl.CreateImage("", api.CreateImageRequest{
+		Name:       "download-internal",
+		Visibility: types.Internal,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ctl.ds.DeleteImage(internal.ID) }()
+
+	private, err := ctl.CreateImage(tenant.ID, api.CreateImageRequest{
+		Name:       "download-private",
+		Visibility: types.Private,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ctl.ds.DeleteImage(private.ID) }()
+
+	_, err = ctl.DownloadImage(tenant.ID, internal.ID)
+	if err != api.ErrNoImage {
+		t.Errorf("Expected ErrNoImage downloading internal image, got %v", err)
+	}
+
+	_, err = ctl.DownloadImage(tenant2.ID, private.ID)
+	if err != api.ErrNoImage {
+		t.Errorf("Expected ErrNoImage downloading image of another tenant, got %v", err)
+	}
+
+	// Neither image has data, so permitted downloads fail as the
+	// images are not active.
+	_, err = ctl.DownloadImage(tenant.ID, private.ID)
+	if err != api.ErrImageSaving {
+		t.Errorf("Expected ErrImageSaving downloading own image, got %v", err)
+	}
+
+	_, err = ctl.DownloadImage("admin", internal.ID)
+	if err != api.ErrImageSaving {
+		t.Errorf("Expected ErrImageSaving downloading internal image as admin, got %v", err)
+	}
+}
+
+func TestUploadImageInProgress(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := ctl.CreateImage(tenant.ID, api.CreateImageRequest{
+		Name: "upload-in-progress",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ctl.ds.DeleteImage(image.ID) }()
+
+	image.State = types.Saving
+	err = ctl.ds.UpdateImage(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.UploadImage(tenant.ID, image.ID, strings.NewReader("image data"))
+	if err != api.ErrImageUploadInProgress {
+		t.Errorf("Expected ErrImageUploadInProgress, got %v", err)
+	}
+}
+
+// deleteRecordingDriver records the block devices deleted through it.
+type deleteRecordingDriver struct {
+	storage.BlockDriver
+	deleted []string
+}
+
+func (d *deleteRecordingDriver) DeleteBlockDevice(ID string) error {
+	d.deleted = append(d.deleted, ID)
+	return d.BlockDriver.DeleteBlockDevice(ID)
+}
+
+func TestUploadLegacyImage(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := ctl.CreateImage(tenant.ID, api.CreateImageRequest{
+		Name: "upload-legacy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ctl.ds.DeleteImage(image.ID) }()
+
+	// data uploaded before images were deduplicated has no digest
+	image.State = types.Active
+	err = ctl.ds.UpdateImage(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &deleteRecordingDriver{BlockDriver: ctl.BlockDriver}
+	ctl.BlockDriver = driver
+	defer func() { ctl.BlockDriver = driver.BlockDriver }()
+
+	err = ctl.UploadImage(tenant.ID, image.ID, strings.NewReader("legacy image data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(driver.deleted) != 1 || driver.deleted[0] != image.ID {
+		t.Errorf("Expected legacy block device %s to be deleted, got %v", image.ID, driver.deleted)
+	}
+}
+
 func TestDeleteVolume(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -1481,7 +1971,7 @@ func TestListVolumesDetail(t *testing.T) {
 
 	_ = createTestVolume(tenant.ID, 20, t)
 
-	vols, err := ctl.ListVolumesDetail(tenant.ID)
+	vols, err := ctl.ListVolumesDetail(tenant.ID, types.VolumeFilter{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2110,13 +2600,19 @@ func TestMain(m *testing.M) {
 
 	_, _ = addComputeTestTenant()
 
+	ctl.certs, err = newCertReloader(httpsCAcert, httpsKey, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading HTTPS certificate: %v", err)
+		os.Exit(1)
+	}
+
 	s, err := ctl.createCiaoServer()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating ciao server: %v", err)
 		os.Exit(1)
 	}
 
-	go func() { _ = s.ListenAndServeTLS(httpsCAcert, httpsKey) }()
+	go func() { _ = s.ListenAndServeTLS("", "") }()
 	time.Sleep(1 * time.Second)
 
 	code := m.Run()
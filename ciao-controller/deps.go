@@ -28,4 +28,13 @@ var controllerDeps = osprepare.PackageRequirements{
 	"ubuntu": {
 		{BinaryName: "/usr/bin/qemu-img", PackageName: "qemu-utils"},
 	},
+	"centos": {
+		{BinaryName: "/usr/bin/qemu-img", PackageName: "qemu-img"},
+	},
+	"debian": {
+		{BinaryName: "/usr/bin/qemu-img", PackageName: "qemu-utils"},
+	},
+	"opensuse": {
+		{BinaryName: "/usr/bin/qemu-img", PackageName: "qemu-tools"},
+	},
 }
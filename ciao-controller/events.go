@@ -0,0 +1,265 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/service"
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+)
+
+// eventStreamKeepAlive is how often a comment is sent on idle event
+// streams so that proxies do not time out the connection.
+var eventStreamKeepAlive = 30 * time.Second
+
+// eventPruner periodically removes old entries from the event log so
+// that it does not grow without bound.
+type eventPruner struct {
+	maxAge   time.Duration
+	maxRows  int
+	interval time.Duration
+
+	statsLock sync.Mutex
+	stats     types.EventRetention
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (p *eventPruner) enabled() bool {
+	return p.interval > 0 && (p.maxAge > 0 || p.maxRows > 0)
+}
+
+// startEventPruning launches the background job that enforces the event
+// retention policy.  Nothing is started if the policy places no limits on
+// the event log.
+func (c *controller) startEventPruning() {
+	p := &c.eventPruner
+	if !p.enabled() {
+		glog.Info("Event log pruning disabled")
+		return
+	}
+
+	glog.Infof("Pruning event log every %v (max age %v, max rows per tenant %d)",
+		p.interval, p.maxAge, p.maxRows)
+
+	p.stop = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			c.pruneEvents()
+
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *controller) stopEventPruning() {
+	p := &c.eventPruner
+	if p.stop == nil {
+		return
+	}
+
+	close(p.stop)
+	p.wg.Wait()
+	p.stop = nil
+}
+
+func (c *controller) pruneEvents() {
+	p := &c.eventPruner
+
+	pruned, err := c.ds.PruneEventLog(p.maxAge, p.maxRows)
+
+	p.statsLock.Lock()
+	p.stats.Runs++
+	p.stats.LastRun = time.Now()
+	p.stats.LastPruned = pruned
+	p.stats.Pruned += pruned
+	if err != nil {
+		p.stats.Failures++
+	}
+	p.statsLock.Unlock()
+
+	if err != nil {
+		glog.Warningf("Unable to prune event log: %v", err)
+		return
+	}
+
+	glog.V(1).Infof("Pruned %d event log entries", pruned)
+}
+
+// eventRetention returns the retention policy and pruning statistics
+func (c *controller) eventRetention() types.EventRetention {
+	p := &c.eventPruner
+
+	p.statsLock.Lock()
+	r := p.stats
+	p.statsLock.Unlock()
+
+	r.MaxAge = p.maxAge.String()
+	r.MaxRows = p.maxRows
+	r.PruneInterval = p.interval.String()
+
+	return r
+}
+
+// eventKey identifies an event log entry among those logged at the same
+// time.
+type eventKey struct {
+	timestamp int64
+	tenantID  string
+	eventType string
+	message   string
+}
+
+func logEntryKey(l types.LogEntry) eventKey {
+	return eventKey{l.Timestamp.Unix(), l.TenantID, l.EventType, l.Message}
+}
+
+// writeEvent sends a log entry as a server-sent event
+func writeEvent(w http.ResponseWriter, l types.LogEntry) error {
+	b, err := json.Marshal(types.CiaoEvent{
+		Timestamp: l.Timestamp,
+		TenantID:  l.TenantID,
+		EventType: l.EventType,
+		Message:   l.Message,
+	})
+	if err != nil {
+		glog.Warningf("Unable to marshal event: %v", err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "data: %s\n\n", b)
+	return err
+}
+
+// eventStreamHandler pushes the events logged after a client connects as
+// server-sent events, one JSON encoded types.CiaoEvent per message.  Only
+// the events of the tenant in the route are sent, if any.  Clients resume
+// a stream by giving the since query parameter, an RFC 3339 time, in which
+// case the events logged at or after that time are sent first.
+type eventStreamHandler struct {
+	*controller
+	Privileged bool
+}
+
+func (h eventStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Privileged && !service.GetPrivilege(r.Context()) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since %q, expected an RFC 3339 time", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tenant := mux.Vars(r)["tenant"]
+
+	events, cancel := h.ds.SubscribeEvents()
+	defer cancel()
+
+	// The log is read after subscribing so that no event is missed.
+	// The events logged in between are both in the log and received
+	// on the subscription, they are only sent once.
+	var replay []types.LogEntry
+	if !since.IsZero() {
+		log, err := h.ds.GetEventLog()
+		if err != nil {
+			glog.Warningf("Unable to get event log: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		for _, l := range log {
+			if (tenant == "" || tenant == l.TenantID) && !l.Timestamp.Before(since) {
+				replay = append(replay, *l)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	replayed := make(map[eventKey]int)
+	for _, l := range replay {
+		if err := writeEvent(w, l); err != nil {
+			return
+		}
+		replayed[logEntryKey(l)]++
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case l, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if tenant != "" && tenant != l.TenantID {
+				continue
+			}
+
+			if k := logEntryKey(l); replayed[k] > 0 {
+				replayed[k]--
+				continue
+			}
+
+			if err := writeEvent(w, l); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
@@ -15,11 +15,16 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"regexp"
+	"sort"
 	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/api"
@@ -87,59 +92,210 @@ func (c *controller) ListImages(tenant string) ([]types.Image, error) {
 	return c.ds.GetImages(tenant, false)
 }
 
-func (c *controller) uploadImage(imageID string, body io.Reader) error {
+// ListAllImages returns the images of every tenant along with the storage
+// consumed by each tenant and the storage saved by sharing the data of
+// identical images.
+func (c *controller) ListAllImages() (types.ImageStoreUsage, error) {
+	glog.Info("Listing images from all tenants")
+
+	images := c.ds.GetAllImages()
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].TenantID != images[j].TenantID {
+			return images[i].TenantID < images[j].TenantID
+		}
+		return images[i].ID < images[j].ID
+	})
+
+	usage := types.ImageStoreUsage{Images: images}
+	stored := make(map[string]bool)
+	for _, i := range images {
+		n := len(usage.Tenants)
+		if n == 0 || usage.Tenants[n-1].TenantID != i.TenantID {
+			usage.Tenants = append(usage.Tenants, types.TenantImageUsage{TenantID: i.TenantID})
+			n++
+		}
+		usage.Tenants[n-1].Images++
+		usage.Tenants[n-1].Size += i.Size
+		usage.TotalSize += i.Size
+
+		if i.Digest != "" {
+			if stored[i.Digest] {
+				continue
+			}
+			stored[i.Digest] = true
+		}
+		usage.StoredSize += i.Size
+	}
+	usage.DedupSavings = usage.TotalSize - usage.StoredSize
+
+	return usage, nil
+}
+
+// imageDataID returns the ID of the block device storing the data of the
+// images with the given digest.  The ID is derived from the digest so that
+// the data is stored once, however many images share it.
+func imageDataID(digest string) string {
+	return fmt.Sprintf("%s-%s-%s-%s-%s", digest[0:8], digest[8:12], digest[12:16],
+		digest[16:20], digest[20:32])
+}
+
+// imageBlockDevice returns the ID of the block device storing the data of
+// an image.  Images uploaded before their data was deduplicated are stored
+// in a block device named after the image.
+func (c *controller) imageBlockDevice(imageID string) string {
+	image, err := c.ds.GetImage(imageID)
+	if err != nil || image.Digest == "" {
+		return imageID
+	}
+
+	return imageDataID(image.Digest)
+}
+
+func (c *controller) deleteImageBlockDevice(ID string) error {
+	err := c.DeleteBlockDeviceSnapshot(ID, "ciao-image")
+	if err != nil {
+		return fmt.Errorf("Unable to delete snapshot: %v", err)
+	}
+
+	err = c.DeleteBlockDevice(ID)
+	if err != nil {
+		return fmt.Errorf("Error deleting block device: %v", err)
+	}
+
+	return nil
+}
+
+// releaseImageData deletes the block device storing the data of the images
+// with the given digest once no image refers to it.
+func (c *controller) releaseImageData(digest string) error {
+	c.imageDataLock.Lock()
+	defer c.imageDataLock.Unlock()
+
+	if refs := c.ds.GetImageDigestRefs(digest); refs > 0 {
+		glog.Infof("Image data %s still shared by %d images", digest, refs)
+		return nil
+	}
+
+	return c.deleteImageBlockDevice(imageDataID(digest))
+}
+
+// writeImageFile writes the data of an image to a temporary file and
+// returns the path of the file along with the digest of the data.
+func writeImageFile(body io.Reader) (string, string, error) {
 	f, err := ioutil.TempFile("", "ciao-image")
 	if err != nil {
-		return fmt.Errorf("Error creating temporary image file: %v", err)
+		return "", "", fmt.Errorf("Error creating temporary image file: %v", err)
 	}
-	defer func() { _ = os.Remove(f.Name()) }()
 
+	h := sha256.New()
 	buf := make([]byte, 1<<16)
-	_, err = io.CopyBuffer(f, body, buf)
+	_, err = io.CopyBuffer(io.MultiWriter(f, h), body, buf)
 	if err != nil {
 		_ = f.Close()
-		return fmt.Errorf("Error writing to temporary image file: %v", err)
+		_ = os.Remove(f.Name())
+		return "", "", fmt.Errorf("Error writing to temporary image file: %v", err)
 	}
 
 	err = f.Close()
 	if err != nil {
-		return fmt.Errorf("Error closing temporary image file: %v", err)
+		_ = os.Remove(f.Name())
+		return "", "", fmt.Errorf("Error closing temporary image file: %v", err)
 	}
 
-	_, err = c.CreateBlockDevice(imageID, f.Name(), 0)
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// imageDiskFormat returns the format of the image data stored in path, as
+// detected by qemu-img.
+func imageDiskFormat(path string) (string, error) {
+	out, err := exec.Command("qemu-img", "info", "--output=json", path).Output()
 	if err != nil {
-		return fmt.Errorf("Error creating block device: %v", err)
+		return "", fmt.Errorf("Error running qemu-img info: %v", err)
 	}
 
-	err = c.CreateBlockDeviceSnapshot(imageID, "ciao-image")
-	if err != nil {
-		_ = c.DeleteBlockDevice(imageID)
-		return fmt.Errorf("Unable to create snapshot: %v", err)
+	var info struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("Error parsing qemu-img info output: %v", err)
 	}
 
-	return nil
+	return info.Format, nil
+}
+
+// storeImageData stores the data of an image, read from path, and marks the
+// image as active.  The data is only written to a new block device if no
+// other image has the same digest.
+func (c *controller) storeImageData(image types.Image, path, digest string) error {
+	dataID := imageDataID(digest)
+
+	c.imageDataLock.Lock()
+	defer c.imageDataLock.Unlock()
+
+	created := false
+	if refs := c.ds.GetImageDigestRefs(digest); refs > 0 {
+		glog.Infof("Image %s shares data %s with %d images", image.ID, digest, refs)
+	} else {
+		_, err := c.CreateBlockDevice(dataID, path, 0)
+		if err != nil {
+			return fmt.Errorf("Error creating block device: %v", err)
+		}
+
+		err = c.CreateBlockDeviceSnapshot(dataID, "ciao-image")
+		if err != nil {
+			_ = c.DeleteBlockDevice(dataID)
+			return fmt.Errorf("Unable to create snapshot: %v", err)
+		}
+		created = true
+	}
+
+	imageSize, err := c.GetBlockDeviceSize(dataID)
+	if err == nil {
+		image.Size = imageSize
+		image.State = types.Active
+		image.Digest = digest
+		err = c.ds.UpdateImage(image)
+	}
+
+	if err != nil && created {
+		_ = c.deleteImageBlockDevice(dataID)
+	}
+
+	return err
 }
 
 // UploadImage will upload a raw image data and update its status.
 func (c *controller) UploadImage(tenantID, imageID string, body io.Reader) error {
 	glog.Infof("Uploading image: %v", imageID)
 
+	// The data previously stored for the image is released once the new
+	// data is stored, so a single upload may be in progress at a time.
+	c.imageUploadLock.Lock()
 	image, err := c.ds.GetImage(imageID)
 	if err != nil {
+		c.imageUploadLock.Unlock()
 		return err
 	}
 
 	if tenantID != "admin" && image.TenantID != image.TenantID {
+		c.imageUploadLock.Unlock()
 		return api.ErrNoImage
 	}
 
+	if image.State == types.Saving {
+		c.imageUploadLock.Unlock()
+		return api.ErrImageUploadInProgress
+	}
+
+	previous := image
 	image.State = types.Saving
 	err = c.ds.UpdateImage(image)
+	c.imageUploadLock.Unlock()
 	if err != nil {
 		return err
 	}
 
-	err = c.uploadImage(imageID, body)
+	path, digest, err := writeImageFile(body)
 	if err != nil {
 		glog.Errorf("Error uploading image: %v", err)
 		image.State = types.Killed
@@ -147,26 +303,88 @@ func (c *controller) UploadImage(tenantID, imageID string, body io.Reader) error
 		return api.ErrImageSaving
 	}
 
-	imageSize, err := c.GetBlockDeviceSize(imageID)
-	if err != nil {
-		glog.Errorf("Error getting block device size: %v", err)
-		image.State = types.Killed
-		_ = c.ds.UpdateImage(image)
-		return api.ErrImageSaving
+	image.DiskFormat = ""
+	image.UploadSize = 0
+	if fi, err := os.Stat(path); err == nil {
+		image.UploadSize = uint64(fi.Size())
+	}
+	if format, err := imageDiskFormat(path); err == nil {
+		image.DiskFormat = format
+	} else {
+		glog.Warningf("Unable to detect format of image %s: %v", imageID, err)
 	}
 
-	image.Size = imageSize
-	image.State = types.Active
+	if !*asyncImageConversion {
+		err = c.convertImage(image, previous, path, digest)
+		if err != nil {
+			return api.ErrImageSaving
+		}
+		return nil
+	}
 
+	// The image stays in the saving state until its data has been
+	// converted and stored.
 	err = c.ds.UpdateImage(image)
 	if err != nil {
+		_ = os.Remove(path)
 		return err
 	}
 
-	glog.Infof("Image %v uploaded", imageID)
+	go func() {
+		_ = c.convertImage(image, previous, path, digest)
+	}()
+
+	glog.Infof("Image %v uploaded, converting in the background", imageID)
 	return nil
 }
 
+// convertImage converts the uploaded data of an image, read from path, to
+// the format of the storage backend and stores it.  The image is marked as
+// killed if the data cannot be stored.  The data previously stored for the
+// image, as described by previous, is released once the new data is stored.
+func (c *controller) convertImage(image, previous types.Image, path, digest string) error {
+	defer func() { _ = os.Remove(path) }()
+
+	// The image may have been deleted while it was being uploaded.
+	if _, err := c.ds.GetImage(image.ID); err != nil {
+		glog.Warningf("Image %s deleted before its data was stored", image.ID)
+		return err
+	}
+
+	err := c.storeImageData(image, path, digest)
+	if err != nil {
+		glog.Errorf("Error storing image %s: %v", image.ID, err)
+		image.State = types.Killed
+		_ = c.ds.UpdateImage(image)
+		return err
+	}
+
+	c.releasePreviousImageData(previous, digest)
+
+	glog.Infof("Image %v stored", image.ID)
+	return nil
+}
+
+// releasePreviousImageData releases the data stored for an image before
+// new data with the given digest was stored for it.  Data uploaded before
+// images were deduplicated is stored in a block device of its own, which is
+// deleted whether or not the new data is shared with other images.
+func (c *controller) releasePreviousImageData(previous types.Image, digest string) {
+	var err error
+	switch {
+	case previous.Digest != "":
+		if previous.Digest != digest {
+			err = c.releaseImageData(previous.Digest)
+		}
+	case previous.State == types.Active:
+		err = c.deleteImageBlockDevice(previous.ID)
+	}
+
+	if err != nil {
+		glog.Warningf("Unable to release previous data of image %s: %v", previous.ID, err)
+	}
+}
+
 // DeleteImage will delete a raw image and its metadata
 func (c *controller) DeleteImage(tenantID, imageID string) error {
 	glog.Infof("Deleting image: %v", imageID)
@@ -187,20 +405,65 @@ func (c *controller) DeleteImage(tenantID, imageID string) error {
 
 	c.qs.Release(tenantID, payloads.RequestedResource{Type: payloads.Image, Value: 1})
 
-	err = c.DeleteBlockDeviceSnapshot(imageID, "ciao-image")
-	if err != nil {
-		return fmt.Errorf("Unable to delete snapshot: %v", err)
+	if image.Digest != "" {
+		err = c.releaseImageData(image.Digest)
+	} else {
+		err = c.deleteImageBlockDevice(imageID)
 	}
-
-	err = c.DeleteBlockDevice(imageID)
 	if err != nil {
-		return fmt.Errorf("Error deleting block device: %v", err)
+		return err
 	}
 
 	glog.Infof("Image %v deleted", imageID)
 	return nil
 }
 
+// DownloadImage returns the data of an image after checking permissions.
+// Tenants may only download their own images and public images.  Internal
+// images, such as the CNCI image, can be launched by tenants but only
+// downloaded by the administrator.  The data is read from the storage
+// backend as it is consumed.
+func (c *controller) DownloadImage(tenantID, imageID string) (io.ReadCloser, error) {
+	image, err := c.GetImage(tenantID, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenantID != "admin" && image.TenantID != tenantID && image.Visibility != types.Public {
+		return nil, api.ErrNoImage
+	}
+
+	if image.State != types.Active {
+		return nil, api.ErrImageSaving
+	}
+
+	dataID := c.imageBlockDevice(image.ID)
+
+	size, err := c.GetBlockDeviceSize(dataID)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting size of image %s: %v", imageID, err)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		_ = w.CloseWithError(c.ExportBlockDevice(dataID, w))
+	}()
+
+	return imageData{r, int64(size)}, nil
+}
+
+// imageData streams the data of an image exported from the storage
+// backend.  Its size is known up front so that clients can detect
+// truncated downloads.
+type imageData struct {
+	*io.PipeReader
+	size int64
+}
+
+func (d imageData) Size() int64 {
+	return d.size
+}
+
 // GetImage gets image metadata after checking permissions
 func (c *controller) GetImage(tenantID, imageID string) (types.Image, error) {
 	glog.Infof("Getting Image [%v] from [%v]", imageID, tenantID)
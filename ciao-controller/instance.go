@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -46,11 +47,14 @@ type instance struct {
 	newConfig config
 	ctl       *controller
 	startTime time.Time
+	metadata  map[string]string
+	expiresAt time.Time
 }
 
 type userData struct {
-	UUID     string `json:"uuid"`
-	Hostname string `json:"hostname"`
+	UUID     string            `json:"uuid"`
+	Hostname string            `json:"hostname"`
+	Meta     map[string]string `json:"meta,omitempty"`
 }
 
 func isCNCIWorkload(workload *types.Workload) bool {
@@ -58,7 +62,8 @@ func isCNCIWorkload(workload *types.Workload) bool {
 }
 
 func newInstance(ctl *controller, tenantID string, workload *types.Workload,
-	name string, subnet string, IPAddr net.IP) (*instance, error) {
+	name string, subnet string, IPAddr net.IP, metadata map[string]string,
+	requestID string) (*instance, error) {
 	id := uuid.Generate()
 
 	if name != "" {
@@ -68,11 +73,11 @@ func newInstance(ctl *controller, tenantID string, workload *types.Workload,
 		}
 
 		if existingID != "" {
-			return nil, fmt.Errorf("Instance name already in use: %s", name)
+			return nil, types.ErrDuplicateName
 		}
 	}
 
-	config, err := newConfig(ctl, workload, id.String(), tenantID, name, IPAddr)
+	config, err := newConfig(ctl, workload, id.String(), tenantID, name, IPAddr, metadata, requestID)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +105,7 @@ func newInstance(ctl *controller, tenantID string, workload *types.Workload,
 		ctl:       ctl,
 		newConfig: config,
 		Instance:  &newInstance,
+		metadata:  metadata,
 	}
 
 	return i, nil
@@ -113,6 +119,20 @@ func (i *instance) Add() error {
 		return errors.Wrapf(err, "Error creating instance in datastore")
 	}
 
+	if len(i.metadata) > 0 {
+		err = ds.SetInstanceMetadata(i.Instance.ID, i.metadata)
+		if err != nil {
+			return errors.Wrap(err, "Error storing instance metadata")
+		}
+	}
+
+	if !i.expiresAt.IsZero() {
+		err = ds.SetInstanceExpiry(i.Instance.ID, i.expiresAt)
+		if err != nil {
+			return errors.Wrap(err, "Error storing instance expiry")
+		}
+	}
+
 	for _, volume := range i.newConfig.sc.Start.Storage {
 		if volume.ID == "" && volume.Local {
 			// these are launcher auto-created ephemeral
@@ -162,6 +182,9 @@ func (i *instance) Clean() error {
 	return nil
 }
 
+// Allowed reserves the resources of the instance in the quotas of its
+// tenant.  If the instance does not fit in them, false is returned along
+// with a *types.QuotaError detailing the quotas it exceeds.
 func (i *instance) Allowed() (bool, error) {
 	if i.CNCI == true {
 		// should I bother to check the tenant id exists?
@@ -182,7 +205,10 @@ func (i *instance) Allowed() (bool, error) {
 	res := <-i.ctl.qs.Consume(i.TenantID, resources...)
 
 	// Cleanup on disallowed happens in Clean()
-	return res.Allowed(), nil
+	if !res.Allowed() {
+		return false, &types.QuotaError{Excesses: res.Excesses()}
+	}
+	return true, nil
 }
 
 func instanceActive(i *types.Instance) bool {
@@ -265,7 +291,7 @@ func networkConfig(ctl *controller, tenant *types.Tenant, networking *payloads.N
 }
 
 func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID string,
-	name string, IPaddr net.IP) (config, error) {
+	name string, IPaddr net.IP, metadata map[string]string, requestID string) (config, error) {
 	var metaData userData
 	var config config
 	var networking payloads.NetworkResources
@@ -291,6 +317,7 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 	if name != "" {
 		metaData.Hostname = name
 	}
+	metaData.Meta = metadata
 
 	config.ip = networking.PrivateIP
 
@@ -315,6 +342,7 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 		Networking:          networking,
 		Storage:             storage,
 		Requirements:        wl.Requirements,
+		RequestID:           requestID,
 	}
 
 	if wl.VMType == payloads.Docker {
@@ -341,3 +369,79 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 
 	return config, err
 }
+
+// cloudInitBody strips the YAML document start and end markers that
+// surround a cloud-init config.
+func cloudInitBody(config string) string {
+	lines := strings.Split(strings.TrimRight(config, "\n"), "\n")
+
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "---") {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && strings.HasPrefix(lines[len(lines)-1], "...") {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// mergeCloudConfig merges override into base.  Maps are merged
+// recursively, lists are concatenated and any other value in override
+// replaces the value in base.
+func mergeCloudConfig(base, override interface{}) interface{} {
+	switch o := override.(type) {
+	case map[interface{}]interface{}:
+		b, ok := base.(map[interface{}]interface{})
+		if !ok {
+			return o
+		}
+		for k, v := range o {
+			b[k] = mergeCloudConfig(b[k], v)
+		}
+		return b
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok {
+			return o
+		}
+		return append(b, o...)
+	}
+
+	return override
+}
+
+// overrideUserData returns the cloud-init config to use for an instance
+// given the config of its workload and the user data supplied when the
+// instance was created.  If replace is false both must be cloud-config
+// documents, which are merged.  types.ErrBadRequest is returned if the
+// user data cannot be merged.
+func overrideUserData(workloadConfig string, userData string, replace bool) (string, error) {
+	if replace {
+		return "---\n" + cloudInitBody(userData) + "...\n", nil
+	}
+
+	base := cloudInitBody(workloadConfig)
+	override := cloudInitBody(userData)
+	if !strings.HasPrefix(base, "#cloud-config") || !strings.HasPrefix(override, "#cloud-config") {
+		return "", types.ErrBadRequest
+	}
+
+	var baseData, overrideData map[interface{}]interface{}
+	if err := yaml.Unmarshal([]byte(base), &baseData); err != nil {
+		return "", errors.Wrap(err, "error parsing workload cloud-config")
+	}
+	if err := yaml.Unmarshal([]byte(override), &overrideData); err != nil {
+		return "", types.ErrBadRequest
+	}
+
+	if baseData == nil {
+		baseData = make(map[interface{}]interface{})
+	}
+
+	merged, err := yaml.Marshal(mergeCloudConfig(baseData, overrideData))
+	if err != nil {
+		return "", errors.Wrap(err, "error marshalling merged cloud-config")
+	}
+
+	return "---\n#cloud-config\n" + string(merged) + "...\n", nil
+}
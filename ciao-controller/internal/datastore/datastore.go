@@ -50,6 +50,13 @@ type Config struct {
 	DBBackend         persistentStore
 	PersistentURI     string
 	InitWorkloadsPath string
+	Notifier          Notifier
+}
+
+// Notifier is informed of instance lifecycle and node state changes.
+// Notify is called with datastore locks held and must not block.
+type Notifier interface {
+	Notify(n types.Notification)
 }
 
 type userEventType string
@@ -62,6 +69,7 @@ const (
 type tenant struct {
 	types.Tenant
 	network   map[uint32]map[uint32]bool
+	subnets   map[uint32]types.TenantSubnet
 	instances map[string]*types.Instance
 	devices   map[string]types.Volume
 	workloads []string
@@ -71,6 +79,7 @@ type tenant struct {
 type node struct {
 	types.Node
 	instances map[string]*types.Instance
+	networks  []payloads.NetworkStat
 }
 
 type attachment struct {
@@ -90,10 +99,20 @@ type persistentStore interface {
 	// interfaces related to logging
 	logEvent(event types.LogEntry) error
 	clearLog() error
+	pruneLog(before time.Time, maxRows int) (pruned int, err error)
 	getEventLog() (logEntries []*types.LogEntry, err error)
 
+	// interfaces related to instance action history
+	addInstanceAction(action types.InstanceAction) error
+	getInstanceActions(instanceID string) ([]types.InstanceAction, error)
+
+	// interfaces related to instance crashes
+	addInstanceCrash(crash types.InstanceCrash) error
+	getInstanceCrashes(instanceID string) ([]types.InstanceCrash, error)
+
 	// interfaces related to workloads
 	addWorkload(wl types.Workload) error
+	updateWorkload(wl types.Workload) error
 	deleteWorkload(ID string) error
 	getWorkloads() ([]types.Workload, error)
 
@@ -104,6 +123,11 @@ type persistentStore interface {
 	releaseTenantIP(tenantID string, subnetInt uint32, rest uint32) (err error)
 	claimTenantIP(tenantID string, subnetInt uint32, rest uint32) (err error)
 	claimTenantIPs(tenantID string, IPs []tenantIP) (err error)
+	addTenantSubnet(s types.TenantSubnet) error
+	deleteTenantSubnet(subnetID string) error
+	addReservedIP(r types.ReservedIP) error
+	deleteReservedIP(tenantID string, address string) error
+	getReservedIPs(tenantID string) ([]types.ReservedIP, error)
 	updateTenant(tenant *types.Tenant) error
 	deleteTenant(tenantID string) error
 
@@ -113,12 +137,27 @@ type persistentStore interface {
 	deleteInstance(instanceID string) (err error)
 	updateInstance(instance *types.Instance) (err error)
 
+	// interfaces related to deferred instance deletion
+	addDeletedInstance(instanceID string, deletedAt time.Time) error
+	removeDeletedInstance(instanceID string) error
+	getDeletedInstances() (map[string]time.Time, error)
+
+	// interfaces related to instance expiry
+	addInstanceExpiry(instanceID string, expiresAt time.Time) error
+	removeInstanceExpiry(instanceID string) error
+	getInstanceExpiries() (map[string]time.Time, error)
+
+	// interfaces related to instance metadata
+	updateInstanceMetadata(instanceID string, metadata map[string]string) error
+	getInstanceMetadata() (map[string]map[string]string, error)
+
 	// interfaces related to statistics
 	addNodeStat(stat payloads.Stat) (err error)
 	addInstanceStats(stats []payloads.InstanceStat, nodeID string) (err error)
 	addFrameStat(stat payloads.FrameTrace) (err error)
 	getBatchFrameSummary() (stats []types.BatchFrameSummary, err error)
 	getBatchFrameStatistics(label string) (stats []types.BatchFrameStat, err error)
+	getTraceFrames(label string) (frames []types.CiaoTraceFrame, err error)
 
 	// storage interfaces
 	getWorkloadStorage(ID string) ([]types.StorageResource, error)
@@ -153,7 +192,8 @@ type persistentStore interface {
 
 // Datastore provides context for the datastore package.
 type Datastore struct {
-	db persistentStore
+	db       persistentStore
+	notifier Notifier
 
 	nodeLastStat     map[string]types.CiaoNode
 	nodeLastStatLock *sync.RWMutex
@@ -172,7 +212,21 @@ type Datastore struct {
 	instances     map[string]*types.Instance
 	instancesLock *sync.RWMutex
 
-	tenantUsage     map[string][]types.CiaoUsage
+	// instanceNames maps the names of the instances of each tenant to
+	// their IDs.  Names are unique within a tenant.
+	instanceNames     map[string]map[string]string
+	instanceNamesLock *sync.RWMutex
+
+	deletedInstances     map[string]time.Time
+	deletedInstancesLock *sync.RWMutex
+
+	instanceExpiries     map[string]time.Time
+	instanceExpiriesLock *sync.RWMutex
+
+	instanceMetadata     map[string]map[string]string
+	instanceMetadataLock *sync.RWMutex
+
+	tenantUsage     map[string]*usageHistory
 	tenantUsageLock *sync.RWMutex
 
 	blockDevices map[string]types.Volume
@@ -198,6 +252,9 @@ type Datastore struct {
 	workloadsLock   *sync.RWMutex
 	workloads       map[string]types.Workload
 	publicWorkloads []string
+
+	eventSubscribersLock sync.Mutex
+	eventSubscribers     map[chan types.LogEntry]struct{}
 }
 
 func (ds *Datastore) initExternalIPs() {
@@ -295,6 +352,7 @@ func (ds *Datastore) Init(config Config) error {
 	}
 
 	ds.db = ps
+	ds.notifier = config.Notifier
 
 	ds.nodeLastStat = make(map[string]types.CiaoNode)
 	ds.nodeLastStatLock = &sync.RWMutex{}
@@ -317,8 +375,33 @@ func (ds *Datastore) Init(config Config) error {
 		return errors.Wrap(err, "error getting instances from database")
 	}
 
+	ds.instanceNamesLock = &sync.RWMutex{}
+	ds.instanceNames = make(map[string]map[string]string)
+
 	for i := range instances {
 		ds.instances[instances[i].ID] = instances[i]
+
+		if instances[i].Name != "" {
+			ds.reserveInstanceName(instances[i])
+		}
+	}
+
+	ds.deletedInstancesLock = &sync.RWMutex{}
+	ds.deletedInstances, err = ds.db.getDeletedInstances()
+	if err != nil {
+		return errors.Wrap(err, "error getting deleted instances from database")
+	}
+
+	ds.instanceExpiriesLock = &sync.RWMutex{}
+	ds.instanceExpiries, err = ds.db.getInstanceExpiries()
+	if err != nil {
+		return errors.Wrap(err, "error getting instance expiries from database")
+	}
+
+	ds.instanceMetadataLock = &sync.RWMutex{}
+	ds.instanceMetadata, err = ds.db.getInstanceMetadata()
+	if err != nil {
+		return errors.Wrap(err, "error getting instance metadata from database")
 	}
 
 	// cache our current tenants into a map that we can
@@ -368,7 +451,7 @@ func (ds *Datastore) Init(config Config) error {
 		}
 	}
 
-	ds.tenantUsage = make(map[string][]types.CiaoUsage)
+	ds.tenantUsage = make(map[string]*usageHistory)
 	ds.tenantUsageLock = &sync.RWMutex{}
 
 	ds.blockDevices, err = ds.db.getAllBlockData()
@@ -446,6 +529,10 @@ func (ds *Datastore) DeleteTenant(ID string) error {
 
 	delete(ds.tenants, ID)
 
+	ds.tenantUsageLock.Lock()
+	delete(ds.tenantUsage, ID)
+	ds.tenantUsageLock.Unlock()
+
 	return ds.db.deleteTenant(ID)
 }
 
@@ -543,6 +630,46 @@ func (ds *Datastore) AddWorkload(w types.Workload) error {
 	return nil
 }
 
+// UpdateWorkload replaces the definition of an existing workload.  The ID,
+// tenant and visibility of the workload cannot be changed, nor can its
+// memory and VCPU requirements while instances of the workload exist.
+func (ds *Datastore) UpdateWorkload(w types.Workload) error {
+	ds.workloadsLock.Lock()
+	defer ds.workloadsLock.Unlock()
+
+	wl, ok := ds.workloads[w.ID]
+	if !ok {
+		return types.ErrWorkloadNotFound
+	}
+
+	w.TenantID = wl.TenantID
+	w.Visibility = wl.Visibility
+
+	// The quotas consumed by instances are those of their workload's
+	// current requirements, so the requirements cannot change while
+	// instances of the workload exist.
+	if w.Requirements.MemMB != wl.Requirements.MemMB ||
+		w.Requirements.VCPUs != wl.Requirements.VCPUs {
+		ds.instancesLock.RLock()
+		for _, val := range ds.instances {
+			if val.WorkloadID == w.ID {
+				ds.instancesLock.RUnlock()
+				return types.ErrWorkloadInUse
+			}
+		}
+		ds.instancesLock.RUnlock()
+	}
+
+	err := ds.db.updateWorkload(w)
+	if err != nil {
+		return errors.Wrapf(err, "error updating workload (%v) in database", w.ID)
+	}
+
+	ds.workloads[w.ID] = w
+
+	return nil
+}
+
 // DeleteWorkload will delete an unused workload from the datastore.
 // workload ID out of the datastore.
 func (ds *Datastore) DeleteWorkload(workloadID string) error {
@@ -805,8 +932,14 @@ func (ds *Datastore) AllocateTenantIPPool(tenantID string, num int) ([]net.IP, e
 
 	subnets := ds.tenants[tenantID].network
 
+	// subnets created by the tenant are only used on request
+	tenantSubnets := ds.tenants[tenantID].subnets
+
 	// look for any subnets that have available host nums
 	for k, v := range subnets {
+		if _, ok := tenantSubnets[k]; ok {
+			continue
+		}
 		if len(v) < maxHosts {
 			start = k
 			break
@@ -823,6 +956,10 @@ func (ds *Datastore) AllocateTenantIPPool(tenantID string, num int) ([]net.IP, e
 		// if we have not yet allocated out of this subnet,
 		// we need to make a new map to hold the host addrs.
 		subnetNum := start & mask
+		if _, ok := tenantSubnets[subnetNum]; ok {
+			start += uint32(maxHosts)
+			continue
+		}
 		if subnets[subnetNum] == nil {
 			subnets[subnetNum] = make(map[uint32]bool)
 		}
@@ -868,6 +1005,130 @@ func (ds *Datastore) AllocateTenantIP(tenantID string) (net.IP, error) {
 	return ips[0], nil
 }
 
+// ClaimTenantIP reserves a specific address from the tenant network for
+// the caller.  The address must lie in the tenant network, must not be the
+// network, gateway or broadcast address of its subnet and must not already
+// be allocated.
+func (ds *Datastore) ClaimTenantIP(tenantID string, ip net.IP) error {
+	tenant, err := ds.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	if tenant == nil {
+		return types.ErrTenantNotFound
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return types.ErrInvalidIP
+	}
+
+	if !tenantNetwork.Contains(ip4) {
+		return types.ErrInvalidIP
+	}
+
+	mask := net.CIDRMask(tenant.SubnetBits, 32)
+	maxHosts := uint32(1) << uint32(32-tenant.SubnetBits)
+	addr := binary.BigEndian.Uint32(ip4)
+	subnetNum := addr & binary.BigEndian.Uint32(mask)
+
+	// same addresses as skipped by AllocateTenantIPPool
+	host := addr - subnetNum
+	if host < 2 || host == maxHosts-1 {
+		return types.ErrInvalidIP
+	}
+
+	ds.tenantsLock.Lock()
+
+	subnets := ds.tenants[tenantID].network
+	if subnets[subnetNum][addr] {
+		ds.tenantsLock.Unlock()
+		return types.ErrIPInUse
+	}
+
+	if subnets[subnetNum] == nil {
+		subnets[subnetNum] = make(map[uint32]bool)
+	}
+	subnets[subnetNum][addr] = true
+
+	tenantAddrs := []tenantIP{{subnetNum, addr}}
+	err = ds.db.claimTenantIPs(tenantID, tenantAddrs)
+	if err != nil {
+		ds.cleanTenantIPs(tenantID, tenantAddrs)
+		ds.tenantsLock.Unlock()
+		return err
+	}
+
+	ds.tenantsLock.Unlock()
+
+	return ds.activateSubnets(tenantID, []net.IP{ip4})
+}
+
+// ReserveTenantIP holds back an address of the tenant network so that it
+// is not handed out to instances automatically.
+func (ds *Datastore) ReserveTenantIP(tenantID string, ip net.IP, description string) (types.ReservedIP, error) {
+	err := ds.ClaimTenantIP(tenantID, ip)
+	if err != nil {
+		return types.ReservedIP{}, err
+	}
+
+	r := types.ReservedIP{
+		TenantID:    tenantID,
+		Address:     ip.String(),
+		Description: description,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.db.addReservedIP(r)
+	if err != nil {
+		if tmpErr := ds.ReleaseTenantIP(tenantID, r.Address); tmpErr != nil {
+			glog.Warningf("Unable to release reserved IP %s: %v", r.Address, tmpErr)
+		}
+		return types.ReservedIP{}, errors.Wrap(err, "Error reserving IP")
+	}
+
+	return r, nil
+}
+
+// GetReservedTenantIPs returns the addresses reserved by a tenant.
+func (ds *Datastore) GetReservedTenantIPs(tenantID string) ([]types.ReservedIP, error) {
+	return ds.db.getReservedIPs(tenantID)
+}
+
+// ReleaseReservedTenantIP cancels a reservation and returns the address to
+// the tenant network.
+func (ds *Datastore) ReleaseReservedTenantIP(tenantID string, address string) error {
+	err := ds.db.deleteReservedIP(tenantID, address)
+	if err != nil {
+		return err
+	}
+
+	return ds.ReleaseTenantIP(tenantID, address)
+}
+
+// IsReservedTenantIP returns true if an address of the tenant network is
+// reserved.
+func (ds *Datastore) IsReservedTenantIP(tenantID string, address string) (bool, error) {
+	reserved, err := ds.db.getReservedIPs(tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, r := range reserved {
+		if r.Address == address {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// TakeReservedTenantIP consumes a reservation, leaving the address claimed
+// for the instance it is being assigned to.
+func (ds *Datastore) TakeReservedTenantIP(tenantID string, address string) error {
+	return ds.db.deleteReservedIP(tenantID, address)
+}
+
 func (ds *Datastore) getInstances(cncis bool) ([]*types.Instance, error) {
 	var instances []*types.Instance
 
@@ -988,9 +1249,14 @@ func (ds *Datastore) GetAllInstancesByNode(nodeID string) ([]*types.Instance, er
 // AddInstance will store a new instance in the datastore.
 // The instance will be updated both in the cache and in the database
 func (ds *Datastore) AddInstance(instance *types.Instance) error {
+	if instance.Name != "" && !ds.reserveInstanceName(instance) {
+		return types.ErrDuplicateName
+	}
+
 	err := ds.db.addInstance(instance)
 
 	if err != nil {
+		ds.releaseInstanceName(instance)
 		return errors.Wrap(err, "Error adding instance to database")
 	}
 
@@ -1020,9 +1286,57 @@ func (ds *Datastore) AddInstance(instance *types.Instance) error {
 	}
 	ds.tenantsLock.Unlock()
 
+	ds.notify(types.Notification{
+		Event:      types.InstanceCreated,
+		TenantID:   instance.TenantID,
+		InstanceID: instance.ID,
+		NodeID:     instance.NodeID,
+		State:      instance.State,
+	})
+
 	return nil
 }
 
+// AddInstanceAction records an action performed on an instance.
+func (ds *Datastore) AddInstanceAction(action types.InstanceAction) error {
+	if action.Timestamp.IsZero() {
+		action.Timestamp = time.Now()
+	}
+
+	return errors.Wrap(ds.db.addInstanceAction(action), "Error recording instance action")
+}
+
+// GetInstanceActions retrieves the actions recorded for an instance, oldest
+// first.  The history of an instance is kept after it has been deleted.
+func (ds *Datastore) GetInstanceActions(instanceID string) ([]types.InstanceAction, error) {
+	actions, err := ds.db.getInstanceActions(instanceID)
+	return actions, errors.Wrap(err, "Error retrieving instance actions")
+}
+
+func (ds *Datastore) recordInstanceAction(i *types.Instance, action, result, reason, nodeID string) {
+	err := ds.AddInstanceAction(types.InstanceAction{
+		InstanceID: i.ID,
+		TenantID:   i.TenantID,
+		Action:     action,
+		NodeID:     nodeID,
+		Result:     result,
+		Reason:     reason,
+	})
+	if err != nil {
+		glog.Warningf("Unable to record %s action for instance %s: %v", action, i.ID, err)
+	}
+}
+
+func (ds *Datastore) notify(n types.Notification) {
+	if ds.notifier == nil {
+		return
+	}
+
+	n.Version = types.NotificationVersion
+	n.Timestamp = time.Now()
+	ds.notifier.Notify(n)
+}
+
 // StartFailure will clean up after a failure to start an instance.
 // If an instance was a CNCI, this function will remove the CNCI instance
 // for this tenant. If the instance was a normal tenant instance, the
@@ -1033,7 +1347,7 @@ func (ds *Datastore) AddInstance(instance *types.Instance) error {
 // is received.  StartFailure errors may also be generated when restarting an
 // exited instance and we want to make sure that a failure to restart such
 // an instance does not result in it being deleted.
-func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailureReason, migration bool, nodeID string) error {
+func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailureReason, migration bool, nodeID string, requestID string) error {
 	i, err := ds.GetInstance(instanceID)
 	if err != nil {
 		return errors.Wrapf(err, "error getting instance (%v)", instanceID)
@@ -1049,6 +1363,17 @@ func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailur
 		}
 	}
 
+	ds.recordInstanceAction(i, types.InstanceActionLaunch, types.InstanceActionError,
+		reason.String(), nodeID)
+
+	ds.notify(types.Notification{
+		Event:      types.InstanceStartFailed,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		NodeID:     nodeID,
+		Reason:     reason.String(),
+	})
+
 	ds.nodesLock.Lock()
 	defer ds.nodesLock.Unlock()
 
@@ -1059,13 +1384,14 @@ func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailur
 	}
 
 	msg := fmt.Sprintf("Start Failure %s: %s", instanceID, reason.String())
+	msg = requestMessage(msg, requestID)
 	e := types.LogEntry{
 		TenantID:  i.TenantID,
 		EventType: string(userError),
 		Message:   msg,
 		NodeID:    nodeID,
 	}
-	return errors.Wrap(ds.db.logEvent(e), "Error logging event")
+	return errors.Wrap(ds.logEvent(e), "Error logging event")
 }
 
 // AttachVolumeFailure will clean up after a failure to attach a volume.
@@ -1109,7 +1435,54 @@ func (ds *Datastore) AttachVolumeFailure(instanceID string, volumeID string, rea
 		NodeID:    i.NodeID,
 	}
 
-	return errors.Wrap(ds.db.logEvent(e), "Error logging event")
+	return errors.Wrap(ds.logEvent(e), "Error logging event")
+}
+
+// InstanceLog records an incident reported by a launcher about one of
+// its instances in the event log of the instance's tenant.
+func (ds *Datastore) InstanceLog(instanceID string, reason payloads.InstanceLogReason, message string) error {
+	i, err := ds.GetInstance(instanceID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting instance (%v)", instanceID)
+	}
+
+	msg := fmt.Sprintf("Instance %s %s: %s", instanceID, reason.String(), message)
+	e := types.LogEntry{
+		TenantID:  i.TenantID,
+		EventType: string(userError),
+		Message:   msg,
+		NodeID:    i.NodeID,
+	}
+
+	return errors.Wrap(ds.logEvent(e), "Error logging event")
+}
+
+// AddInstanceCrash records a crash of an instance reported by its node.
+func (ds *Datastore) AddInstanceCrash(instanceID string, crash payloads.InstanceCrash) error {
+	i, err := ds.GetInstance(instanceID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting instance (%v)", instanceID)
+	}
+
+	c := types.InstanceCrash{
+		InstanceID: instanceID,
+		TenantID:   i.TenantID,
+		NodeID:     i.NodeID,
+		ExitStatus: crash.ExitStatus,
+		Stderr:     crash.Stderr,
+		Artifacts:  crash.Artifacts,
+		MemoryDump: crash.MemoryDump,
+		Timestamp:  time.Now(),
+	}
+
+	return errors.Wrap(ds.db.addInstanceCrash(c), "Error recording instance crash")
+}
+
+// GetInstanceCrashes retrieves the crashes recorded for an instance, oldest
+// first.
+func (ds *Datastore) GetInstanceCrashes(instanceID string) ([]types.InstanceCrash, error) {
+	crashes, err := ds.db.getInstanceCrashes(instanceID)
+	return crashes, errors.Wrap(err, "Error retrieving instance crashes")
 }
 
 func (ds *Datastore) deleteInstance(instanceID string) (string, error) {
@@ -1134,6 +1507,8 @@ func (ds *Datastore) deleteInstance(instanceID string) (string, error) {
 	}
 	ds.tenantsLock.Unlock()
 
+	ds.releaseInstanceName(i)
+
 	// we may not have received any node stats for this instance
 	if i.NodeID != "" {
 		ds.nodesLock.Lock()
@@ -1158,9 +1533,210 @@ func (ds *Datastore) deleteInstance(instanceID string) (string, error) {
 
 	ds.updateStorageAttachments(instanceID)
 
+	ds.deletedInstancesLock.Lock()
+	_, deleted := ds.deletedInstances[instanceID]
+	delete(ds.deletedInstances, instanceID)
+	ds.deletedInstancesLock.Unlock()
+
+	if deleted {
+		if tmpErr := ds.db.removeDeletedInstance(instanceID); tmpErr != nil {
+			glog.Warningf("error removing deferred deletion of instance (%v): %v", instanceID, tmpErr)
+		}
+	}
+
+	ds.instanceExpiriesLock.Lock()
+	_, expires := ds.instanceExpiries[instanceID]
+	delete(ds.instanceExpiries, instanceID)
+	ds.instanceExpiriesLock.Unlock()
+
+	if expires {
+		if tmpErr := ds.db.removeInstanceExpiry(instanceID); tmpErr != nil {
+			glog.Warningf("error removing expiry of instance (%v): %v", instanceID, tmpErr)
+		}
+	}
+
+	ds.instanceMetadataLock.Lock()
+	_, hasMetadata := ds.instanceMetadata[instanceID]
+	delete(ds.instanceMetadata, instanceID)
+	ds.instanceMetadataLock.Unlock()
+
+	if hasMetadata {
+		if tmpErr := ds.db.updateInstanceMetadata(instanceID, nil); tmpErr != nil {
+			glog.Warningf("error removing metadata of instance (%v): %v", instanceID, tmpErr)
+		}
+	}
+
 	return i.TenantID, err
 }
 
+// SoftDeleteInstance marks an instance as deleted without removing it, so
+// that it can be restored until its deletion is finalized.
+func (ds *Datastore) SoftDeleteInstance(instanceID string) error {
+	if _, err := ds.GetInstance(instanceID); err != nil {
+		return err
+	}
+
+	ds.deletedInstancesLock.Lock()
+	defer ds.deletedInstancesLock.Unlock()
+
+	if _, ok := ds.deletedInstances[instanceID]; ok {
+		return types.ErrInstanceDeleted
+	}
+
+	deletedAt := time.Now()
+	if err := ds.db.addDeletedInstance(instanceID, deletedAt); err != nil {
+		return errors.Wrap(err, "Error recording instance deletion")
+	}
+
+	ds.deletedInstances[instanceID] = deletedAt
+
+	return nil
+}
+
+// RestoreInstance clears the deleted mark of an instance deleted with
+// SoftDeleteInstance.
+func (ds *Datastore) RestoreInstance(instanceID string) error {
+	ds.deletedInstancesLock.Lock()
+	defer ds.deletedInstancesLock.Unlock()
+
+	if _, ok := ds.deletedInstances[instanceID]; !ok {
+		return types.ErrInstanceNotDeleted
+	}
+
+	if err := ds.db.removeDeletedInstance(instanceID); err != nil {
+		return errors.Wrap(err, "Error restoring instance")
+	}
+
+	delete(ds.deletedInstances, instanceID)
+
+	return nil
+}
+
+// GetInstanceDeletedAt returns the time at which an instance was soft
+// deleted and whether it is awaiting deletion at all.
+func (ds *Datastore) GetInstanceDeletedAt(instanceID string) (time.Time, bool) {
+	ds.deletedInstancesLock.RLock()
+	defer ds.deletedInstancesLock.RUnlock()
+
+	deletedAt, ok := ds.deletedInstances[instanceID]
+	return deletedAt, ok
+}
+
+// GetDeletedInstances returns the soft deleted instances along with the
+// time at which they were deleted.
+func (ds *Datastore) GetDeletedInstances() map[string]time.Time {
+	ds.deletedInstancesLock.RLock()
+	defer ds.deletedInstancesLock.RUnlock()
+
+	deleted := make(map[string]time.Time, len(ds.deletedInstances))
+	for id, deletedAt := range ds.deletedInstances {
+		deleted[id] = deletedAt
+	}
+
+	return deleted
+}
+
+// SetInstanceExpiry records the time after which an instance is to be
+// deleted.
+func (ds *Datastore) SetInstanceExpiry(instanceID string, expiresAt time.Time) error {
+	if _, err := ds.GetInstance(instanceID); err != nil {
+		return err
+	}
+
+	ds.instanceExpiriesLock.Lock()
+	defer ds.instanceExpiriesLock.Unlock()
+
+	if err := ds.db.addInstanceExpiry(instanceID, expiresAt); err != nil {
+		return errors.Wrap(err, "Error recording instance expiry")
+	}
+
+	ds.instanceExpiries[instanceID] = expiresAt
+
+	return nil
+}
+
+// ClearInstanceExpiry cancels the expiry of an instance.
+func (ds *Datastore) ClearInstanceExpiry(instanceID string) error {
+	ds.instanceExpiriesLock.Lock()
+	defer ds.instanceExpiriesLock.Unlock()
+
+	if _, ok := ds.instanceExpiries[instanceID]; !ok {
+		return nil
+	}
+
+	if err := ds.db.removeInstanceExpiry(instanceID); err != nil {
+		return errors.Wrap(err, "Error clearing instance expiry")
+	}
+
+	delete(ds.instanceExpiries, instanceID)
+
+	return nil
+}
+
+// GetInstanceExpiry returns the time after which an instance is to be
+// deleted and whether it expires at all.
+func (ds *Datastore) GetInstanceExpiry(instanceID string) (time.Time, bool) {
+	ds.instanceExpiriesLock.RLock()
+	defer ds.instanceExpiriesLock.RUnlock()
+
+	expiresAt, ok := ds.instanceExpiries[instanceID]
+	return expiresAt, ok
+}
+
+// GetInstanceExpiries returns the instances which expire along with the
+// time after which they are to be deleted.
+func (ds *Datastore) GetInstanceExpiries() map[string]time.Time {
+	ds.instanceExpiriesLock.RLock()
+	defer ds.instanceExpiriesLock.RUnlock()
+
+	expiries := make(map[string]time.Time, len(ds.instanceExpiries))
+	for id, expiresAt := range ds.instanceExpiries {
+		expiries[id] = expiresAt
+	}
+
+	return expiries
+}
+
+// GetInstanceMetadata returns a copy of the metadata of an instance.
+func (ds *Datastore) GetInstanceMetadata(instanceID string) map[string]string {
+	ds.instanceMetadataLock.RLock()
+	defer ds.instanceMetadataLock.RUnlock()
+
+	metadata := make(map[string]string, len(ds.instanceMetadata[instanceID]))
+	for k, v := range ds.instanceMetadata[instanceID] {
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+// SetInstanceMetadata replaces the metadata of an instance.
+func (ds *Datastore) SetInstanceMetadata(instanceID string, metadata map[string]string) error {
+	if _, err := ds.GetInstance(instanceID); err != nil {
+		return err
+	}
+
+	md := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		md[k] = v
+	}
+
+	ds.instanceMetadataLock.Lock()
+	defer ds.instanceMetadataLock.Unlock()
+
+	if err := ds.db.updateInstanceMetadata(instanceID, md); err != nil {
+		return errors.Wrap(err, "Error updating instance metadata")
+	}
+
+	if len(md) == 0 {
+		delete(ds.instanceMetadata, instanceID)
+	} else {
+		ds.instanceMetadata[instanceID] = md
+	}
+
+	return nil
+}
+
 // DeleteInstance removes an instance from the datastore.
 func (ds *Datastore) DeleteInstance(instanceID string) error {
 	i, err := ds.GetInstance(instanceID)
@@ -1175,6 +1751,15 @@ func (ds *Datastore) DeleteInstance(instanceID string) error {
 		return errors.Wrapf(err, "error deleting instance")
 	}
 
+	ds.recordInstanceAction(i, types.InstanceActionDeleted, types.InstanceActionSuccess, "", nodeID)
+
+	ds.notify(types.Notification{
+		Event:      types.InstanceDeleted,
+		TenantID:   tenantID,
+		InstanceID: instanceID,
+		NodeID:     nodeID,
+	})
+
 	msg := fmt.Sprintf("Deleted Instance %s", instanceID)
 	e := types.LogEntry{
 		TenantID:  tenantID,
@@ -1182,7 +1767,7 @@ func (ds *Datastore) DeleteInstance(instanceID string) error {
 		Message:   msg,
 		NodeID:    nodeID,
 	}
-	return errors.Wrap(ds.db.logEvent(e), "Error logging event")
+	return errors.Wrap(ds.logEvent(e), "Error logging event")
 }
 
 func (ds *Datastore) updateInstanceStatus(status, instanceID string) error {
@@ -1219,12 +1804,30 @@ func (ds *Datastore) InstanceRestarting(instanceID string) error {
 
 	ds.instancesLock.Lock()
 	i := ds.instances[instanceID]
+	previous := i.State
 	i.State = payloads.Pending
 	ds.instancesLock.Unlock()
 
+	ds.notifyInstanceState(i, previous, payloads.Pending)
+
 	return nil
 }
 
+func (ds *Datastore) notifyInstanceState(i *types.Instance, previous, state string) {
+	if previous == state {
+		return
+	}
+
+	ds.notify(types.Notification{
+		Event:         types.InstanceStateChanged,
+		TenantID:      i.TenantID,
+		InstanceID:    i.ID,
+		NodeID:        i.NodeID,
+		State:         state,
+		PreviousState: previous,
+	})
+}
+
 // InstanceStopped removes the link between an instance and its node
 func (ds *Datastore) InstanceStopped(instanceID string) error {
 	err := ds.updateInstanceStatus(payloads.Exited, instanceID)
@@ -1235,10 +1838,14 @@ func (ds *Datastore) InstanceStopped(instanceID string) error {
 	ds.instancesLock.Lock()
 	i := ds.instances[instanceID]
 	oldNodeID := i.NodeID
+	previous := i.State
 	i.NodeID = ""
 	i.State = payloads.Exited
 	ds.instancesLock.Unlock()
 
+	ds.notifyInstanceState(i, previous, payloads.Exited)
+	ds.recordInstanceAction(i, types.InstanceActionExited, types.InstanceActionSuccess, "", oldNodeID)
+
 	// we may not have received any node stats for this instance
 	if oldNodeID != "" {
 		ds.nodesLock.Lock()
@@ -1253,7 +1860,16 @@ func (ds *Datastore) InstanceStopped(instanceID string) error {
 func (ds *Datastore) DeleteNode(nodeID string) error {
 	ds.nodesLock.Lock()
 	for _, i := range ds.nodes[nodeID].instances {
-		_ = i.TransitionInstanceState(payloads.Missing)
+		i.StateLock.RLock()
+		previous := i.State
+		i.StateLock.RUnlock()
+
+		if i.TransitionInstanceState(payloads.Missing) == nil {
+			ds.notifyInstanceState(i, previous, payloads.Missing)
+			ds.recordInstanceAction(i, types.InstanceActionLost, types.InstanceActionError,
+				"node disconnected", nodeID)
+		}
+		i.LastNodeID = nodeID
 		i.NodeID = ""
 	}
 	delete(ds.nodes, nodeID)
@@ -1263,6 +1879,11 @@ func (ds *Datastore) DeleteNode(nodeID string) error {
 	delete(ds.nodeLastStat, nodeID)
 	ds.nodeLastStatLock.Unlock()
 
+	ds.notify(types.Notification{
+		Event:  types.NodeDisconnected,
+		NodeID: nodeID,
+	})
+
 	return nil
 }
 
@@ -1294,6 +1915,11 @@ func (ds *Datastore) AddNode(nodeID string, nodeType payloads.Resource) {
 		instances: make(map[string]*types.Instance),
 	}
 	ds.nodes[nodeID] = n
+
+	ds.notify(types.Notification{
+		Event:  types.NodeConnected,
+		NodeID: nodeID,
+	})
 }
 
 // GetNode retrieves a node in the node cache.
@@ -1327,6 +1953,12 @@ func (ds *Datastore) HandleTraceReport(trace payloads.Trace) error {
 	for index := range trace.Frames {
 		i := trace.Frames[index]
 
+		// Unlabelled frames are only traced for the tracing
+		// collector and do not belong to any trace label.
+		if i.Label == "" {
+			continue
+		}
+
 		if tmpErr := ds.db.addFrameStat(i); tmpErr != nil {
 			if err == nil {
 				err = errors.Wrapf(tmpErr, "error adding stats to database")
@@ -1377,6 +2009,69 @@ func (ds *Datastore) GetNodeLastStats() types.CiaoNodes {
 	return nodes
 }
 
+// GetNodeDetails retrieves the last statistics reported by a node along
+// with its roles, its network interfaces and a summary of its instances.
+func (ds *Datastore) GetNodeDetails(nodeID string) (types.CiaoNodeDetails, error) {
+	var details types.CiaoNodeDetails
+
+	ds.nodeLastStatLock.RLock()
+	stat, ok := ds.nodeLastStat[nodeID]
+	ds.nodeLastStatLock.RUnlock()
+	if !ok {
+		return details, types.ErrNodeNotFound
+	}
+
+	details.CiaoNode = stat
+	details.Roles = []string{}
+	details.Networks = []types.CiaoNodeNetwork{}
+
+	ds.nodesLock.RLock()
+	defer ds.nodesLock.RUnlock()
+
+	n := ds.nodes[nodeID]
+	if n == nil {
+		return details, nil
+	}
+
+	if n.NodeRole.IsAgent() {
+		details.Roles = append(details.Roles, "compute")
+	}
+	if n.NodeRole.IsNetAgent() {
+		details.Roles = append(details.Roles, "network")
+	}
+
+	for _, nic := range n.networks {
+		details.Networks = append(details.Networks, types.CiaoNodeNetwork{
+			IP:  nic.NodeIP,
+			MAC: nic.NodeMAC,
+		})
+	}
+
+	for _, i := range n.instances {
+		if i.CNCI {
+			continue
+		}
+
+		details.TotalInstances++
+
+		switch i.State {
+		case payloads.Pending:
+			details.TotalPendingInstances++
+		case payloads.Running:
+			details.TotalRunningInstances++
+		case payloads.Exited:
+			details.TotalPausedInstances++
+		}
+	}
+
+	details.TotalFailures = n.TotalFailures
+	details.StartFailures = n.StartFailures
+	details.AttachVolumeFailures = n.AttachVolumeFailures
+	details.DeleteFailures = n.DeleteFailures
+
+	return details, nil
+}
+
 func (ds *Datastore) addNodeStat(stat payloads.Stat) error {
 	ds.nodesLock.Lock()
 
@@ -1389,10 +2084,12 @@ func (ds *Datastore) addNodeStat(stat payloads.Stat) error {
 
 	n.ID = stat.NodeUUID
 	n.Hostname = stat.NodeHostName
+	n.networks = stat.Networks
 
 	cnStat := types.CiaoNode{
 		ID:                   stat.NodeUUID,
 		Hostname:             n.Hostname,
+		Timestamp:            time.Now(),
 		Status:               stat.Status,
 		Load:                 stat.Load,
 		MemTotal:             stat.MemTotalMB,
@@ -1409,16 +2106,24 @@ func (ds *Datastore) addNodeStat(stat payloads.Stat) error {
 	ds.nodesLock.Unlock()
 	ds.nodeLastStatLock.Lock()
 
+	last, seen := ds.nodeLastStat[stat.NodeUUID]
 	delete(ds.nodeLastStat, stat.NodeUUID)
 	ds.nodeLastStat[stat.NodeUUID] = cnStat
 
 	ds.nodeLastStatLock.Unlock()
 
+	if seen && last.Status != cnStat.Status {
+		ds.notify(types.Notification{
+			Event:         types.NodeStateChanged,
+			NodeID:        stat.NodeUUID,
+			State:         cnStat.Status,
+			PreviousState: last.Status,
+		})
+	}
+
 	return errors.Wrap(ds.db.addNodeStat(stat), "error adding node stats to database")
 }
 
-var tenantUsagePeriodMinutes float64 = 5
-
 func (ds *Datastore) updateTenantUsageNeeded(delta types.CiaoUsage, tenantID string) bool {
 	if delta.VCPU == 0 &&
 		delta.Memory == 0 &&
@@ -1434,69 +2139,39 @@ func (ds *Datastore) updateTenantUsage(delta types.CiaoUsage, tenantID string) {
 		return
 	}
 
-	createNewUsage := true
-	lastUsage := types.CiaoUsage{}
-
 	ds.tenantUsageLock.Lock()
 
-	tenantUsage := ds.tenantUsage[tenantID]
-	if len(tenantUsage) != 0 {
-		lastUsage = tenantUsage[len(tenantUsage)-1]
-		// We will not create more than one entry per tenant every tenantUsagePeriodMinutes
-		if time.Since(lastUsage.Timestamp).Minutes() < tenantUsagePeriodMinutes {
-			createNewUsage = false
-		}
+	history := ds.tenantUsage[tenantID]
+	if history == nil {
+		history = newUsageHistory()
+		ds.tenantUsage[tenantID] = history
 	}
 
-	newUsage := types.CiaoUsage{
-		VCPU:   lastUsage.VCPU + delta.VCPU,
-		Memory: lastUsage.Memory + delta.Memory,
-		Disk:   lastUsage.Disk + delta.Disk,
-	}
-
-	// If we need to create a new usage entry, we timestamp it now.
-	// If not we just update the last entry.
-	if createNewUsage == true {
-		newUsage.Timestamp = time.Now()
-		ds.tenantUsage[tenantID] = append(ds.tenantUsage[tenantID], newUsage)
-	} else {
-		newUsage.Timestamp = lastUsage.Timestamp
-		tenantUsage[len(tenantUsage)-1] = newUsage
-	}
+	lastUsage, _ := history.last()
+	history.add(types.CiaoUsage{
+		VCPU:      lastUsage.VCPU + delta.VCPU,
+		Memory:    lastUsage.Memory + delta.Memory,
+		Disk:      lastUsage.Disk + delta.Disk,
+		Timestamp: time.Now(),
+	})
 
 	ds.tenantUsageLock.Unlock()
 }
 
 // GetTenantUsage provides statistics on actual resource usage.
-// Usage is provided between a specified time period.
+// Usage is provided between a specified time period.  Recent periods are
+// served from raw samples and longer ones from samples rolled up into five
+// minute or hourly intervals, depending on how far back start is.
 func (ds *Datastore) GetTenantUsage(tenantID string, start time.Time, end time.Time) ([]types.CiaoUsage, error) {
 	ds.tenantUsageLock.RLock()
 	defer ds.tenantUsageLock.RUnlock()
 
-	tenantUsage := ds.tenantUsage[tenantID]
-	if tenantUsage == nil || len(tenantUsage) == 0 {
-		return nil, nil
-	}
-
-	historyLength := len(tenantUsage)
-	if tenantUsage[0].Timestamp.After(end) == true ||
-		start.After(tenantUsage[historyLength-1].Timestamp) == true {
+	history := ds.tenantUsage[tenantID]
+	if history == nil {
 		return nil, nil
 	}
 
-	first := 0
-	last := 0
-	for _, u := range tenantUsage {
-		if start.After(u.Timestamp) == true {
-			first++
-		}
-
-		if end.After(u.Timestamp) == true {
-			last++
-		}
-	}
-
-	return tenantUsage[first:last], nil
+	return history.get(start, end, time.Now()), nil
 }
 
 func reduceToZero(v int) int {
@@ -1519,6 +2194,22 @@ func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID stri
 			VCPUUsage: reduceToZero(stat.CPUUsage),
 			MemUsage:  reduceToZero(stat.MemoryUsageMB),
 			DiskUsage: reduceToZero(stat.DiskUsageMB),
+
+			NetRxBytes:      stat.NetRxBytes,
+			NetTxBytes:      stat.NetTxBytes,
+			NetRxPackets:    stat.NetRxPackets,
+			NetTxPackets:    stat.NetTxPackets,
+			BlockReadBytes:  stat.BlockReadBytes,
+			BlockWriteBytes: stat.BlockWriteBytes,
+			Connections:     stat.Connections,
+		}
+
+		for _, t := range stat.TopTalkers {
+			instanceStat.TopTalkers = append(instanceStat.TopTalkers, types.TopTalker{
+				IP:          t.IP,
+				Connections: t.Connections,
+				Bytes:       t.Bytes,
+			})
 		}
 
 		ds.instanceLastStatLock.Lock()
@@ -1543,6 +2234,7 @@ func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID stri
 		ds.instancesLock.Lock()
 		instance, ok := ds.instances[stat.InstanceUUID]
 		if ok {
+			previous := instance.State
 			instance.State = stat.State
 			instance.NodeID = nodeID
 			instance.SSHIP = stat.SSHIP
@@ -1550,6 +2242,11 @@ func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID stri
 			ds.nodesLock.Lock()
 			ds.nodes[nodeID].instances[instance.ID] = instance
 			ds.nodesLock.Unlock()
+			ds.notifyInstanceState(instance, previous, stat.State)
+			if previous == payloads.Pending && stat.State == payloads.Running {
+				ds.recordInstanceAction(instance, types.InstanceActionLaunch,
+					types.InstanceActionSuccess, "", nodeID)
+			}
 		}
 		ds.instancesLock.Unlock()
 	}
@@ -1656,6 +2353,13 @@ func (ds *Datastore) GetBatchFrameStatistics(label string) ([]types.BatchFrameSt
 	return ds.db.getBatchFrameStatistics(label)
 }
 
+// GetTraceFrames retrieves the timestamps of every frame traced with the
+// given label, along with the timestamps recorded by each node the frame
+// went through.
+func (ds *Datastore) GetTraceFrames(label string) ([]types.CiaoTraceFrame, error) {
+	return ds.db.getTraceFrames(label)
+}
+
 // GetEventLog retrieves all the log entries stored in the datastore.
 func (ds *Datastore) GetEventLog() ([]*types.LogEntry, error) {
 	// we don't as of yet cache any of the events that are logged.
@@ -1668,6 +2372,92 @@ func (ds *Datastore) ClearLog() error {
 	return ds.db.clearLog()
 }
 
+// PruneEventLog removes the event log entries that are older than maxAge
+// and then, for each tenant, all but the most recent maxRows entries.  A
+// zero maxAge or maxRows disables the corresponding limit.  The number of
+// entries removed is returned.
+func (ds *Datastore) PruneEventLog(maxAge time.Duration, maxRows int) (int, error) {
+	var before time.Time
+	if maxAge > 0 {
+		before = time.Now().Add(-maxAge)
+	}
+
+	pruned, err := ds.db.pruneLog(before, maxRows)
+	return pruned, errors.Wrap(err, "Error pruning event log")
+}
+
+// eventSubscriberBacklog is the number of events buffered for each event
+// subscriber. Events are dropped for subscribers that fall further behind.
+const eventSubscriberBacklog = 64
+
+// logEvent adds an entry to the persistent event log and passes it on to
+// the event subscribers.
+func (ds *Datastore) logEvent(e types.LogEntry) error {
+	// The entries passed on to the subscribers have the timestamp
+	// stored in the log, to the second, so that clients resuming an
+	// event stream can tell them apart from those already received.
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	e.Timestamp = e.Timestamp.UTC().Truncate(time.Second)
+
+	if err := ds.db.logEvent(e); err != nil {
+		return err
+	}
+
+	ds.eventSubscribersLock.Lock()
+	defer ds.eventSubscribersLock.Unlock()
+
+	for ch := range ds.eventSubscribers {
+		select {
+		case ch <- e:
+		default:
+			glog.Warningf("Dropping event for slow subscriber: %s", e.Message)
+		}
+	}
+
+	return nil
+}
+
+// SubscribeEvents returns a channel on which the entries subsequently
+// added to the event log are sent. The returned function must be called
+// to cancel the subscription once the caller is no longer reading from
+// the channel. The channel is closed when the subscription is cancelled
+// or when CloseEventSubscriptions is called.
+func (ds *Datastore) SubscribeEvents() (<-chan types.LogEntry, func()) {
+	ch := make(chan types.LogEntry, eventSubscriberBacklog)
+
+	ds.eventSubscribersLock.Lock()
+	if ds.eventSubscribers == nil {
+		ds.eventSubscribers = make(map[chan types.LogEntry]struct{})
+	}
+	ds.eventSubscribers[ch] = struct{}{}
+	ds.eventSubscribersLock.Unlock()
+
+	cancel := func() {
+		ds.eventSubscribersLock.Lock()
+		defer ds.eventSubscribersLock.Unlock()
+
+		if _, ok := ds.eventSubscribers[ch]; ok {
+			delete(ds.eventSubscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+// CloseEventSubscriptions cancels all the event subscriptions.
+func (ds *Datastore) CloseEventSubscriptions() {
+	ds.eventSubscribersLock.Lock()
+	defer ds.eventSubscribersLock.Unlock()
+
+	for ch := range ds.eventSubscribers {
+		delete(ds.eventSubscribers, ch)
+		close(ch)
+	}
+}
+
 // LogEvent will add a message to the persistent event log.
 func (ds *Datastore) LogEvent(tenant string, msg string) error {
 	e := types.LogEntry{
@@ -1675,7 +2465,7 @@ func (ds *Datastore) LogEvent(tenant string, msg string) error {
 		EventType: string(userInfo),
 		Message:   msg,
 	}
-	return ds.db.logEvent(e)
+	return ds.logEvent(e)
 }
 
 // LogError will add a message to the persistent event log as an error
@@ -1685,7 +2475,28 @@ func (ds *Datastore) LogError(tenant string, msg string) error {
 		EventType: string(userError),
 		Message:   msg,
 	}
-	return ds.db.logEvent(e)
+	return ds.logEvent(e)
+}
+
+// requestMessage appends the ID of the API request responsible for an
+// event, if any, to the message logged for the event.
+func requestMessage(msg string, requestID string) string {
+	if requestID == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s [request %s]", msg, requestID)
+}
+
+// LogRequestEvent will add a message caused by the API request identified
+// by requestID to the persistent event log.
+func (ds *Datastore) LogRequestEvent(tenant string, requestID string, msg string) error {
+	return ds.LogEvent(tenant, requestMessage(msg, requestID))
+}
+
+// LogRequestError will add a message caused by the API request identified
+// by requestID to the persistent event log as an error.
+func (ds *Datastore) LogRequestError(tenant string, requestID string, msg string) error {
+	return ds.LogError(tenant, requestMessage(msg, requestID))
 }
 
 // AddBlockDevice will store information about new BlockData into
@@ -1750,6 +2561,12 @@ func (ds *Datastore) DeleteBlockDevice(ID string) error {
 
 // GetBlockDevices will return all the BlockDevices associated with a tenant.
 func (ds *Datastore) GetBlockDevices(tenant string) ([]types.Volume, error) {
+	return ds.FindBlockDevices(tenant, types.VolumeFilter{})
+}
+
+// FindBlockDevices will return the BlockDevices associated with a tenant
+// which match the filter.
+func (ds *Datastore) FindBlockDevices(tenant string, filter types.VolumeFilter) ([]types.Volume, error) {
 	var devices []types.Volume
 
 	ds.tenantsLock.RLock()
@@ -1761,7 +2578,9 @@ func (ds *Datastore) GetBlockDevices(tenant string) ([]types.Volume, error) {
 	}
 
 	for _, value := range ds.tenants[tenant].devices {
-		devices = append(devices, value)
+		if filter.Match(value) {
+			devices = append(devices, value)
+		}
 	}
 
 	ds.tenantsLock.RUnlock()
@@ -2546,24 +3365,63 @@ func (ds *Datastore) UpdateQuotas(tenantID string, qds []types.QuotaDetails) err
 	return ds.db.updateQuotas(tenantID, qds)
 }
 
-// ResolveInstance maps an instance name to an uuid, returning "" if not found
-// TODO: Replace this O(n) algorithm with another name to id map.
+// reserveInstanceName records the name of an instance, returning false if
+// another instance of its tenant already has that name.
+func (ds *Datastore) reserveInstanceName(i *types.Instance) bool {
+	ds.instanceNamesLock.Lock()
+	defer ds.instanceNamesLock.Unlock()
+
+	names := ds.instanceNames[i.TenantID]
+	if names == nil {
+		names = make(map[string]string)
+		ds.instanceNames[i.TenantID] = names
+	}
+
+	if id, ok := names[i.Name]; ok && id != i.ID {
+		return false
+	}
+	names[i.Name] = i.ID
+
+	return true
+}
+
+// releaseInstanceName frees the name of an instance for use by others.
+func (ds *Datastore) releaseInstanceName(i *types.Instance) {
+	ds.instanceNamesLock.Lock()
+	defer ds.instanceNamesLock.Unlock()
+
+	names := ds.instanceNames[i.TenantID]
+	if i.Name == "" || names[i.Name] != i.ID {
+		return
+	}
+
+	delete(names, i.Name)
+	if len(names) == 0 {
+		delete(ds.instanceNames, i.TenantID)
+	}
+}
+
+// ResolveInstance maps an instance name or ID to an uuid, returning "" if not
+// found.  IDs take precedence over names.
 func (ds *Datastore) ResolveInstance(tenantID string, name string) (string, error) {
 	ds.tenantsLock.RLock()
-	defer ds.tenantsLock.RUnlock()
-
-	t, ok := ds.tenants[tenantID]
+	_, ok := ds.tenants[tenantID]
+	ds.tenantsLock.RUnlock()
 	if !ok {
 		return "", fmt.Errorf("Tenant not found: %s", tenantID)
 	}
 
-	for _, i := range t.instances {
-		if i.Name == name || i.ID == name {
-			return i.ID, nil
-		}
+	ds.instancesLock.RLock()
+	i, ok := ds.instances[name]
+	ds.instancesLock.RUnlock()
+	if ok && i.TenantID == tenantID {
+		return i.ID, nil
 	}
 
-	return "", nil
+	ds.instanceNamesLock.RLock()
+	defer ds.instanceNamesLock.RUnlock()
+
+	return ds.instanceNames[tenantID][name], nil
 }
 
 // AddImage adds an image to the datastore and database
@@ -2734,6 +3592,36 @@ func (ds *Datastore) GetImages(tenantID string, admin bool) ([]types.Image, erro
 	return images, nil
 }
 
+// GetAllImages returns the images of all the tenants, including the
+// internal and public images.
+func (ds *Datastore) GetAllImages() []types.Image {
+	ds.imageLock.RLock()
+	defer ds.imageLock.RUnlock()
+
+	images := make([]types.Image, 0, len(ds.images))
+	for _, image := range ds.images {
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// GetImageDigestRefs returns the number of images whose data has the given
+// digest.
+func (ds *Datastore) GetImageDigestRefs(digest string) int {
+	ds.imageLock.RLock()
+	defer ds.imageLock.RUnlock()
+
+	refs := 0
+	for _, image := range ds.images {
+		if image.Digest == digest {
+			refs++
+		}
+	}
+
+	return refs
+}
+
 // DeleteImage deleted the image from the datastore and the database
 func (ds *Datastore) DeleteImage(ID string) error {
 	ds.imageLock.Lock()
@@ -34,6 +34,7 @@ import (
 	"github.com/ciao-project/ciao/ciao-controller/utils"
 	"github.com/ciao-project/ciao/ciao-storage"
 	"github.com/ciao-project/ciao/payloads"
+	"github.com/ciao-project/ciao/ssntp"
 	"github.com/ciao-project/ciao/uuid"
 	jsonpatch "github.com/evanphx/json-patch"
 )
@@ -412,6 +413,195 @@ func TestDeleteInstanceNetwork(t *testing.T) {
 	}
 }
 
+func TestInstanceMetadata(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if md := ds.GetInstanceMetadata(instance.ID); len(md) != 0 {
+		t.Fatalf("Expected no metadata for new instance, got %v", md)
+	}
+
+	err = ds.SetInstanceMetadata(instance.ID, map[string]string{"role": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := ds.GetInstanceMetadata(instance.ID)
+	if md["role"] != "web" {
+		t.Fatalf("Expected role web, got %v", md)
+	}
+
+	// The copy returned must not alias the datastore's
+	md["role"] = "db"
+	if ds.GetInstanceMetadata(instance.ID)["role"] != "web" {
+		t.Fatal("Metadata modified through returned copy")
+	}
+
+	err = ds.SetInstanceMetadata("not-an-instance", map[string]string{"role": "web"})
+	if err == nil {
+		t.Fatal("Expected error setting metadata of unknown instance")
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if md := ds.GetInstanceMetadata(instance.ID); len(md) != 0 {
+		t.Fatalf("Expected metadata to be deleted with instance, got %v", md)
+	}
+}
+
+func TestSoftDeleteInstance(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.RestoreInstance(instance.ID)
+	if err != types.ErrInstanceNotDeleted {
+		t.Fatalf("Expected %v restoring instance, got %v", types.ErrInstanceNotDeleted, err)
+	}
+
+	err = ds.SoftDeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.SoftDeleteInstance(instance.ID)
+	if err != types.ErrInstanceDeleted {
+		t.Fatalf("Expected %v deleting instance twice, got %v", types.ErrInstanceDeleted, err)
+	}
+
+	if _, ok := ds.GetInstanceDeletedAt(instance.ID); !ok {
+		t.Fatal("Soft deleted instance not marked as deleted")
+	}
+
+	if _, ok := ds.GetDeletedInstances()[instance.ID]; !ok {
+		t.Fatal("Soft deleted instance not listed")
+	}
+
+	err = ds.RestoreInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ds.GetInstanceDeletedAt(instance.ID); ok {
+		t.Fatal("Restored instance still marked as deleted")
+	}
+
+	err = ds.SoftDeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ds.GetInstanceDeletedAt(instance.ID); ok {
+		t.Fatal("Deleted instance still marked as deleted")
+	}
+}
+
+func TestInstanceExpiry(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ds.GetInstanceExpiry(instance.ID); ok {
+		t.Fatal("New instance expires")
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = ds.SetInstanceExpiry(instance.ID, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e, ok := ds.GetInstanceExpiry(instance.ID); !ok || !e.Equal(expiresAt) {
+		t.Fatalf("Expected instance to expire at %v, got %v", expiresAt, e)
+	}
+
+	if _, ok := ds.GetInstanceExpiries()[instance.ID]; !ok {
+		t.Fatal("Expiring instance not listed")
+	}
+
+	err = ds.ClearInstanceExpiry(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ds.GetInstanceExpiry(instance.ID); ok {
+		t.Fatal("Instance still expires after expiry cleared")
+	}
+
+	err = ds.SetInstanceExpiry(instance.ID, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ds.GetInstanceExpiry(instance.ID); ok {
+		t.Fatal("Deleted instance still expires")
+	}
+
+	err = ds.SetInstanceExpiry(instance.ID, expiresAt)
+	if err != types.ErrInstanceNotFound {
+		t.Fatalf("Expected %v setting expiry of deleted instance, got %v", types.ErrInstanceNotFound, err)
+	}
+}
+
 func TestGetAllInstances(t *testing.T) {
 	instancesBefore, err := ds.GetAllInstances()
 	if err != nil {
@@ -646,13 +836,23 @@ func TestGetInstanceLastStats(t *testing.T) {
 
 	for i := range instances {
 		stat := payloads.InstanceStat{
-			InstanceUUID:  instances[i].ID,
-			State:         payloads.ComputeStatusRunning,
-			SSHIP:         "192.168.0.1",
-			SSHPort:       34567,
-			MemoryUsageMB: 0,
-			DiskUsageMB:   0,
-			CPUUsage:      0,
+			InstanceUUID:    instances[i].ID,
+			State:           payloads.ComputeStatusRunning,
+			SSHIP:           "192.168.0.1",
+			SSHPort:         34567,
+			MemoryUsageMB:   0,
+			DiskUsageMB:     0,
+			CPUUsage:        0,
+			NetRxBytes:      1024,
+			NetTxBytes:      2048,
+			NetRxPackets:    16,
+			NetTxPackets:    32,
+			BlockReadBytes:  4096,
+			BlockWriteBytes: 8192,
+			Connections:     2,
+			TopTalkers: []payloads.TopTalker{
+				{IP: "10.0.0.3", Connections: 2, Bytes: 800},
+			},
 		}
 		stats = append(stats, stat)
 	}
@@ -678,6 +878,19 @@ func TestGetInstanceLastStats(t *testing.T) {
 	if len(serverStats.Servers) != len(instances) {
 		t.Fatal("Not enough instance stats retrieved")
 	}
+
+	for _, s := range serverStats.Servers {
+		if s.NetRxBytes != 1024 || s.NetTxBytes != 2048 ||
+			s.NetRxPackets != 16 || s.NetTxPackets != 32 ||
+			s.BlockReadBytes != 4096 || s.BlockWriteBytes != 8192 {
+			t.Fatalf("Incorrect I/O counters for instance %s", s.ID)
+		}
+
+		if s.Connections != 2 || len(s.TopTalkers) != 1 ||
+			s.TopTalkers[0] != (types.TopTalker{IP: "10.0.0.3", Connections: 2, Bytes: 800}) {
+			t.Fatalf("Incorrect connection tracking statistics for instance %s", s.ID)
+		}
+	}
 }
 
 func TestGetNodeLastStats(t *testing.T) {
@@ -740,6 +953,96 @@ func TestGetNodeLastStats(t *testing.T) {
 	}
 }
 
+func TestGetNodeDetails(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instances, err := addTestInstances(tenant, wls[0], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeID := uuid.Generate().String()
+	ds.AddNode(nodeID, payloads.ComputeNode)
+
+	_, err = ds.GetNodeDetails(nodeID)
+	if err != types.ErrNodeNotFound {
+		t.Fatalf("Expected ErrNodeNotFound, got %v", err)
+	}
+
+	var stats []payloads.InstanceStat
+	for i := range instances {
+		stats = append(stats, payloads.InstanceStat{
+			InstanceUUID: instances[i].ID,
+			State:        payloads.ComputeStatusRunning,
+		})
+	}
+
+	stat := payloads.Stat{
+		NodeUUID:        nodeID,
+		Status:          "READY",
+		MemTotalMB:      256,
+		MemAvailableMB:  128,
+		DiskTotalMB:     1024,
+		DiskAvailableMB: 512,
+		Load:            20,
+		CpusOnline:      4,
+		NodeHostName:    "test",
+		Networks: []payloads.NetworkStat{
+			{
+				NodeIP:  "192.168.1.1",
+				NodeMAC: "02:00:15:03:6f:49",
+			},
+		},
+		Instances: stats,
+	}
+
+	err = ds.HandleStats(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := ds.GetNodeDetails(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.ID != nodeID || details.Hostname != "test" ||
+		details.Status != "READY" || details.MemTotal != 256 ||
+		details.DiskAvailable != 512 || details.OnlineCPUs != 4 {
+		t.Errorf("Incorrect node details %+v", details)
+	}
+
+	if details.Timestamp.IsZero() {
+		t.Error("Last report time not set")
+	}
+
+	if details.TotalInstances != len(instances) ||
+		details.TotalRunningInstances != len(instances) {
+		t.Errorf("Incorrect instance summary %+v", details)
+	}
+
+	if len(details.Roles) != 1 || details.Roles[0] != "compute" {
+		t.Errorf("Incorrect roles %v", details.Roles)
+	}
+
+	if len(details.Networks) != 1 || details.Networks[0].IP != "192.168.1.1" ||
+		details.Networks[0].MAC != "02:00:15:03:6f:49" {
+		t.Errorf("Incorrect networks %v", details.Networks)
+	}
+}
+
 func createTestFrameTraces(label string) []payloads.FrameTrace {
 	var nodes []payloads.SSNTPNode
 	for i := 0; i < 3; i++ {
@@ -828,6 +1131,90 @@ func TestLogEvent(t *testing.T) {
 	}
 }
 
+func TestLogRequestEvent(t *testing.T) {
+	err := ds.ClearLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.LogRequestEvent("test-tenantID", "", "no request")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.LogRequestError("test-tenantID", "test-requestID", "request")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := ds.GetEventLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(log))
+	}
+
+	if log[0].Message != "no request" || log[0].EventType != string(userInfo) {
+		t.Errorf("Unexpected log entry %+v", log[0])
+	}
+
+	if log[1].Message != "request [request test-requestID]" || log[1].EventType != string(userError) {
+		t.Errorf("Unexpected log entry %+v", log[1])
+	}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	events, cancel := ds.SubscribeEvents()
+
+	err := ds.LogError("test-tenantID", "subscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent types.LogEntry
+	select {
+	case sent = <-events:
+		if sent.TenantID != "test-tenantID" || sent.Message != "subscribed" ||
+			sent.EventType != string(userError) || sent.Timestamp.IsZero() {
+			t.Errorf("Unexpected event %+v", sent)
+		}
+	default:
+		t.Fatal("Event not sent to subscriber")
+	}
+
+	// Subscribers resuming a stream from the log rely on the logged
+	// entries having the timestamps sent
+	log, err := ds.GetEventLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged *types.LogEntry
+	for _, l := range log {
+		if l.Message == "subscribed" {
+			logged = l
+		}
+	}
+	if logged == nil || !logged.Timestamp.Equal(sent.Timestamp) {
+		t.Errorf("Expected logged entry with timestamp %v, got %+v", sent.Timestamp, logged)
+	}
+
+	cancel()
+
+	err = ds.LogEvent("test-tenantID", "unsubscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-events; ok {
+		t.Fatal("Expected channel to be closed after cancelling subscription")
+	}
+
+	// Cancelling twice must be harmless
+	cancel()
+}
+
 func TestClearLog(t *testing.T) {
 	err := ds.db.clearLog()
 	if err != nil {
@@ -835,6 +1222,97 @@ func TestClearLog(t *testing.T) {
 	}
 }
 
+func TestPruneEventLog(t *testing.T) {
+	err := ds.ClearLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = ds.LogEvent("test-tenantID", fmt.Sprintf("message %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := ds.PruneEventLog(time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Fatalf("Expected 2 events to be pruned, got %d", pruned)
+	}
+
+	log, err := ds.GetEventLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Message != "message 2" {
+		t.Fatalf("Expected most recent event to be kept, got %v", log)
+	}
+
+	err = ds.ClearLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testNotifier struct {
+	notifications []types.Notification
+}
+
+func (n *testNotifier) Notify(notification types.Notification) {
+	n.notifications = append(n.notifications, notification)
+}
+
+func TestNodeNotifications(t *testing.T) {
+	notifier := &testNotifier{}
+	ds.notifier = notifier
+	defer func() { ds.notifier = nil }()
+
+	nodeID := uuid.Generate().String()
+	ds.AddNode(nodeID, payloads.ComputeNode)
+
+	stat := payloads.Stat{
+		NodeUUID: nodeID,
+	}
+	for _, status := range []ssntp.Status{ssntp.READY, ssntp.READY, ssntp.FULL} {
+		stat.Status = status.String()
+		err := ds.addNodeStat(stat)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := ds.DeleteNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []types.NotificationEvent{
+		types.NodeConnected,
+		types.NodeStateChanged,
+		types.NodeDisconnected,
+	}
+
+	if len(notifier.notifications) != len(expected) {
+		t.Fatalf("Expected %d notifications, got %d", len(expected),
+			len(notifier.notifications))
+	}
+
+	for i, n := range notifier.notifications {
+		if n.Event != expected[i] || n.NodeID != nodeID ||
+			n.Version != types.NotificationVersion {
+			t.Errorf("Unexpected notification %+v", n)
+		}
+	}
+
+	changed := notifier.notifications[1]
+	if changed.PreviousState != ssntp.READY.String() || changed.State != ssntp.FULL.String() {
+		t.Errorf("Unexpected state change %s -> %s", changed.PreviousState, changed.State)
+	}
+}
+
 func TestAddFrameStat(t *testing.T) {
 	stat := createTestFrameTraces("test")[0]
 	err := ds.db.addFrameStat(stat)
@@ -1088,6 +1566,127 @@ func TestGetCNCISummary(t *testing.T) {
 
 }
 
+func TestClaimTenantIP(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.ParseIP("172.16.5.10")
+	err = ds.ClaimTenantIP(tenant.ID, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTenant, err := ds.getTenant(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mask := binary.BigEndian.Uint32(net.CIDRMask(newTenant.SubnetBits, 32))
+	hostInt := binary.BigEndian.Uint32(ip.To4())
+	if newTenant.network[hostInt&mask][hostInt] != true {
+		t.Fatal("IP Address not claimed in cache")
+	}
+
+	err = ds.ClaimTenantIP(tenant.ID, ip)
+	if err != types.ErrIPInUse {
+		t.Fatalf("Expected %v claiming an allocated IP, got %v", types.ErrIPInUse, err)
+	}
+
+	for _, bad := range []string{"10.0.0.5", "172.16.5.0", "172.16.5.1", "172.16.5.255"} {
+		err = ds.ClaimTenantIP(tenant.ID, net.ParseIP(bad))
+		if err != types.ErrInvalidIP {
+			t.Errorf("Expected %v claiming %s, got %v", types.ErrInvalidIP, bad, err)
+		}
+	}
+
+	err = ds.ReleaseTenantIP(tenant.ID, ip.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.ClaimTenantIP(tenant.ID, ip)
+	if err != nil {
+		t.Fatalf("Unable to claim a released IP: %v", err)
+	}
+}
+
+func TestReserveTenantIP(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.ParseIP("172.16.7.20")
+	r, err := ds.ReserveTenantIP(tenant.ID, ip, "dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Address != ip.String() || r.Description != "dns" || r.TenantID != tenant.ID {
+		t.Fatalf("Unexpected reservation %v", r)
+	}
+
+	_, err = ds.ReserveTenantIP(tenant.ID, ip, "dns")
+	if err != types.ErrIPInUse {
+		t.Fatalf("Expected %v reserving a reserved IP, got %v", types.ErrIPInUse, err)
+	}
+
+	reserved, err := ds.GetReservedTenantIPs(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reserved) != 1 || reserved[0].Address != ip.String() {
+		t.Fatalf("Unexpected reserved IPs %v", reserved)
+	}
+
+	err = ds.ReleaseReservedTenantIP(tenant.ID, ip.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.ReleaseReservedTenantIP(tenant.ID, ip.String())
+	if err != types.ErrAddressNotFound {
+		t.Fatalf("Expected %v releasing an unreserved IP, got %v", types.ErrAddressNotFound, err)
+	}
+
+	// the address is free again
+	_, err = ds.ReserveTenantIP(tenant.ID, ip, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isReserved, err := ds.IsReservedTenantIP(tenant.ID, ip.String())
+	if err != nil || !isReserved {
+		t.Fatalf("Expected %s to be reserved: %v", ip, err)
+	}
+
+	err = ds.TakeReservedTenantIP(tenant.ID, ip.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reserved, err = ds.GetReservedTenantIPs(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reserved) != 0 {
+		t.Fatalf("Reservation not consumed %v", reserved)
+	}
+
+	isReserved, err = ds.IsReservedTenantIP(tenant.ID, ip.String())
+	if err != nil || isReserved {
+		t.Fatalf("Expected %s not to be reserved: %v", ip, err)
+	}
+
+	// but remains claimed for the instance
+	err = ds.ClaimTenantIP(tenant.ID, ip)
+	if err != types.ErrIPInUse {
+		t.Fatalf("Expected %v claiming a taken IP, got %v", types.ErrIPInUse, err)
+	}
+}
+
 func TestReleaseTenantIP(t *testing.T) {
 	/* add a new tenant */
 	tenant, err := addTestTenant()
@@ -1147,48 +1746,149 @@ func TestReleaseTenantIP(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// confirm that tenant map shows it not used.
-	if newTenant.network[subnetInt][hostInt] != false {
-		t.Fatal("IP Address not released from database")
+	// confirm that tenant map shows it not used.
+	if newTenant.network[subnetInt][hostInt] != false {
+		t.Fatal("IP Address not released from database")
+	}
+}
+
+func TestStartFailureFullCloud(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason := payloads.FullCloud
+
+	err = ds.StartFailure(instance.ID, reason, false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.GetInstance(instance.ID)
+	if err == nil {
+		t.Fatal("Expected instance not to be present")
+	}
+}
+
+func TestAttachVolumeFailure(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add test instances
+	wls, err := ds.GetWorkloads(newTenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(newTenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add test block data
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
+	}
+
+	data := types.Volume{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    newTenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// update block data to indicate it is attaching
+	data.State = types.Attaching
+
+	err = ds.UpdateBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend we got a failure to attach.
+	err = ds.AttachVolumeFailure(instance.ID, data.ID, payloads.AttachVolumeAlreadyAttached)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure state has been switched to Available again.
+	bd, err := ds.GetBlockDevice(data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bd.State != types.Available {
+		t.Fatalf("expected state: %s, got %s\n", types.Available, bd.State)
+	}
+}
+
+func TestInstanceLog(t *testing.T) {
+	err := ds.ClearLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestStartFailureFullCloud(t *testing.T) {
-	tenant, err := addTestTenant()
+	wls, err := ds.GetWorkloads(newTenant.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads(tenant.ID)
+	instance, err := addTestInstance(newTenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	err = ds.InstanceLog(instance.ID, payloads.InstanceOOMKilled, "qemu process 42 killed")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	reason := payloads.FullCloud
-
-	err = ds.StartFailure(instance.ID, reason, false, "")
+	logs, err := ds.GetEventLog()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ds.GetInstance(instance.ID)
+	expected := fmt.Sprintf("Instance %s was killed by the OOM killer: qemu process 42 killed", instance.ID)
+	if len(logs) != 1 || logs[0].TenantID != newTenant.ID ||
+		logs[0].EventType != string(userError) || logs[0].Message != expected {
+		t.Fatalf("Unexpected event log %v", logs)
+	}
+
+	err = ds.InstanceLog("unknown-instance", payloads.InstanceExited, "qemu exited")
 	if err == nil {
-		t.Fatal("Expected instance not to be present")
+		t.Fatal("Expected an error logging an incident for an unknown instance")
 	}
 }
 
-func TestAttachVolumeFailure(t *testing.T) {
+func TestAddInstanceCrash(t *testing.T) {
 	newTenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add test instances
 	wls, err := ds.GetWorkloads(newTenant.ID)
 	if err != nil {
 		t.Fatal(err)
@@ -1199,45 +1899,45 @@ func TestAttachVolumeFailure(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// add test block data
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	crash := payloads.InstanceCrash{
+		ExitStatus: "guest panicked",
+		Artifacts:  "/var/lib/ciao/crashes/" + instance.ID + "/20170612T101323Z",
+		MemoryDump: true,
 	}
 
-	data := types.Volume{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
+	err = ds.AddInstanceCrash(instance.ID, crash)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err = ds.AddBlockDevice(data)
+	crashes, err := ds.GetInstanceCrashes(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// update block data to indicate it is attaching
-	data.State = types.Attaching
+	if len(crashes) != 1 || crashes[0].TenantID != newTenant.ID ||
+		crashes[0].ExitStatus != crash.ExitStatus || crashes[0].Artifacts != crash.Artifacts ||
+		!crashes[0].MemoryDump {
+		t.Fatalf("Unexpected crashes %v", crashes)
+	}
 
-	err = ds.UpdateBlockDevice(data)
-	if err != nil {
-		t.Fatal(err)
+	err = ds.AddInstanceCrash("unknown-instance", crash)
+	if err == nil {
+		t.Fatal("Expected an error recording a crash of an unknown instance")
 	}
 
-	// pretend we got a failure to attach.
-	err = ds.AttachVolumeFailure(instance.ID, data.ID, payloads.AttachVolumeAlreadyAttached)
+	err = ds.DeleteInstance(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// make sure state has been switched to Available again.
-	bd, err := ds.GetBlockDevice(data.ID)
+	crashes, err = ds.GetInstanceCrashes(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if bd.State != types.Available {
-		t.Fatalf("expected state: %s, got %s\n", types.Available, bd.State)
+	if len(crashes) != 0 {
+		t.Fatalf("Crashes of deleted instance not removed: %v", crashes)
 	}
 }
 
@@ -1363,6 +2063,63 @@ func TestAddBlockDevice(t *testing.T) {
 	}
 }
 
+func TestFindBlockDevices(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := []types.Volume{
+		{
+			BlockDevice: storage.BlockDevice{ID: uuid.Generate().String(), Size: 10, Bootable: true},
+			State:       types.Available,
+		},
+		{
+			BlockDevice: storage.BlockDevice{ID: uuid.Generate().String(), Size: 20},
+			State:       types.InUse,
+		},
+		{
+			BlockDevice: storage.BlockDevice{ID: uuid.Generate().String(), Size: 30},
+			State:       types.Available,
+		},
+	}
+
+	for _, v := range volumes {
+		v.TenantID = newTenant.ID
+		err = ds.AddBlockDevice(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bootable := true
+	notBootable := false
+	tests := []struct {
+		filter   types.VolumeFilter
+		expected int
+	}{
+		{types.VolumeFilter{}, 3},
+		{types.VolumeFilter{State: types.Available}, 2},
+		{types.VolumeFilter{Bootable: &bootable}, 1},
+		{types.VolumeFilter{Bootable: &notBootable, State: types.Available}, 1},
+		{types.VolumeFilter{MinSize: 15}, 2},
+		{types.VolumeFilter{MinSize: 15, MaxSize: 25}, 1},
+		{types.VolumeFilter{MaxSize: 5}, 0},
+	}
+
+	for _, tt := range tests {
+		devices, err := ds.FindBlockDevices(newTenant.ID, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(devices) != tt.expected {
+			t.Errorf("Expected %d volumes for filter %+v, got %d",
+				tt.expected, tt.filter, len(devices))
+		}
+	}
+}
+
 func TestDeleteBlockDevice(t *testing.T) {
 	newTenant, err := addTestTenant()
 	if err != nil {
@@ -2510,6 +3267,56 @@ func TestDeleteWorkload(t *testing.T) {
 	}
 }
 
+func TestUpdateWorkloadInUse(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl := wls[0]
+	wl.Description = "updated description"
+	err = ds.UpdateWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changing the requirements of an in use workload should fail.
+	wl.Requirements.MemMB++
+	err = ds.UpdateWorkload(wl)
+	if err != types.ErrWorkloadInUse {
+		t.Fatal("Changing the requirements of an in use workload did not fail")
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.UpdateWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := ds.GetWorkload(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Requirements.MemMB != wl.Requirements.MemMB {
+		t.Fatalf("Expected %d MB, got %d", wl.Requirements.MemMB, updated.Requirements.MemMB)
+	}
+}
+
 func TestAddNamedInstance(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -2551,6 +3358,31 @@ func TestAddNamedInstance(t *testing.T) {
 	if id != instances[0].ID {
 		t.Fatalf("Failed to resolve instance name to ID")
 	}
+
+	id, err = ds.ResolveInstance(tenant.ID, instances[0].ID)
+	if err != nil || id != instances[0].ID {
+		t.Fatalf("Failed to resolve instance ID: %q %v", id, err)
+	}
+
+	_, err = addInstance(tenant, wls[0], "test-instance")
+	if err != types.ErrDuplicateName {
+		t.Fatalf("Expected %v adding a duplicate name, got %v", types.ErrDuplicateName, err)
+	}
+
+	err = ds.DeleteInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err = ds.ResolveInstance(tenant.ID, "test-instance")
+	if err != nil || id != "" {
+		t.Fatalf("Expected name of deleted instance to be released: %q %v", id, err)
+	}
+
+	_, err = addInstance(tenant, wls[0], "test-instance")
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestAddRemoveImage(t *testing.T) {
@@ -2695,6 +3527,105 @@ func TestAddRemoveInternalImage(t *testing.T) {
 	}
 }
 
+func TestGetAllImages(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private := types.Image{
+		ID:         uuid.Generate().String(),
+		Name:       "test-image-1",
+		Visibility: types.Private,
+		TenantID:   tenant.ID,
+		Size:       1024,
+	}
+
+	internal := types.Image{
+		ID:         uuid.Generate().String(),
+		Name:       "test-image-2",
+		Visibility: types.Internal,
+	}
+
+	for _, i := range []types.Image{private, internal} {
+		err = ds.AddImage(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	images := ds.GetAllImages()
+	found := 0
+	for _, i := range images {
+		if reflect.DeepEqual(i, private) || reflect.DeepEqual(i, internal) {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Fatalf("Expected both images to be listed: %v", images)
+	}
+
+	for _, i := range []types.Image{private, internal} {
+		err = ds.DeleteImage(i.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetImageDigestRefs(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	first := types.Image{
+		ID:         uuid.Generate().String(),
+		Name:       "test-digest-1",
+		Visibility: types.Private,
+		TenantID:   tenant.ID,
+		Digest:     digest,
+	}
+
+	second := types.Image{
+		ID:         uuid.Generate().String(),
+		Name:       "test-digest-2",
+		Visibility: types.Internal,
+		Digest:     digest,
+	}
+
+	for _, i := range []types.Image{first, second} {
+		err = ds.AddImage(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if refs := ds.GetImageDigestRefs(digest); refs != 2 {
+		t.Fatalf("Expected 2 references to digest, got %d", refs)
+	}
+
+	err = ds.DeleteImage(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refs := ds.GetImageDigestRefs(digest); refs != 1 {
+		t.Fatalf("Expected 1 reference to digest, got %d", refs)
+	}
+
+	err = ds.DeleteImage(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refs := ds.GetImageDigestRefs(digest); refs != 0 {
+		t.Fatalf("Expected no references to digest, got %d", refs)
+	}
+}
+
 func TestAddRemoveDuplicateImage(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -2812,6 +3743,55 @@ var ds *Datastore
 
 var workloadsPath = flag.String("workloads_path", "../../workloads", "path to yaml files")
 
+func TestUsageHistory(t *testing.T) {
+	h := newUsageHistory()
+	now := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	start := now.Add(-30 * 24 * time.Hour)
+
+	// One sample per minute for the last 30 days
+	for ts := start; ts.Before(now); ts = ts.Add(time.Minute) {
+		h.add(types.CiaoUsage{VCPU: ts.Minute(), Timestamp: ts})
+	}
+
+	raw := h.get(now.Add(-30*time.Minute), now, now)
+	if len(raw) != 30 {
+		t.Errorf("Expected 30 raw samples, got %d", len(raw))
+	}
+
+	day := h.get(now.Add(-24*time.Hour), now, now)
+	if len(day) != 24*12 {
+		t.Errorf("Expected %d five minute samples, got %d", 24*12, len(day))
+	}
+	for _, u := range day {
+		if u.Timestamp.Minute()%5 != 0 || u.VCPU != u.Timestamp.Minute()+4 {
+			t.Fatalf("Unexpected five minute sample %+v", u)
+		}
+	}
+
+	month := h.get(start, now, now)
+	if len(month) != 30*24 {
+		t.Errorf("Expected %d hourly samples, got %d", 30*24, len(month))
+	}
+	for _, u := range month {
+		if u.Timestamp.Minute() != 0 || u.VCPU != 59 {
+			t.Fatalf("Unexpected hourly sample %+v", u)
+		}
+	}
+
+	if len(h.samples[0]) > 60 {
+		t.Errorf("Raw samples not pruned, %d samples retained", len(h.samples[0]))
+	}
+
+	if len(h.samples[1]) > 7*24*12 {
+		t.Errorf("Five minute samples not pruned, %d samples retained", len(h.samples[1]))
+	}
+
+	last, ok := h.last()
+	if !ok || !last.Timestamp.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Unexpected last sample %+v", last)
+	}
+}
+
 func TestMain(m *testing.M) {
 	flag.Parse()
 
@@ -2837,3 +3817,77 @@ func TestMain(m *testing.M) {
 
 	os.Exit(code)
 }
+
+func TestTenantSubnets(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{"10.0.0.0/24", "172.16.9.0/16", "172.16.9.1/24", "invalid"} {
+		_, err = ds.AddTenantSubnet(tenant.ID, "", bad)
+		if err != types.ErrBadSubnet {
+			t.Errorf("Expected %v adding %s, got %v", types.ErrBadSubnet, bad, err)
+		}
+	}
+
+	subnet, err := ds.AddTenantSubnet(tenant.ID, "backend", "172.16.9.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.AddTenantSubnet(tenant.ID, "", "172.16.9.0/24")
+	if err != types.ErrDuplicateSubnet {
+		t.Fatalf("Expected %v adding a duplicate subnet, got %v", types.ErrDuplicateSubnet, err)
+	}
+
+	subnets, err := ds.GetTenantSubnets(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subnets) != 1 || subnets[0].ID != subnet.ID || subnets[0].CIDR != "172.16.9.0/24" {
+		t.Fatalf("Unexpected subnets %v", subnets)
+	}
+
+	// subnets created by the tenant are not used automatically
+	ips, err := ds.AllocateTenantIPPool(tenant.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ipNet, _ := net.ParseCIDR(subnet.CIDR)
+	for _, ip := range ips {
+		if ipNet.Contains(ip) {
+			t.Fatalf("Address %s allocated from tenant subnet", ip)
+		}
+	}
+
+	ips, err = ds.AllocateSubnetIPPool(tenant.ID, subnet.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 || ips[0].String() != "172.16.9.2" || ips[1].String() != "172.16.9.3" {
+		t.Fatalf("Unexpected addresses %v", ips)
+	}
+
+	err = ds.DeleteTenantSubnet(tenant.ID, subnet.ID)
+	if err != types.ErrSubnetInUse {
+		t.Fatalf("Expected %v deleting a subnet in use, got %v", types.ErrSubnetInUse, err)
+	}
+
+	for _, ip := range ips {
+		err = ds.ReleaseTenantIP(tenant.ID, ip.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = ds.DeleteTenantSubnet(tenant.ID, subnet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.GetTenantSubnet(tenant.ID, subnet.ID)
+	if err != types.ErrSubnetNotFound {
+		t.Fatalf("Expected %v getting a deleted subnet, got %v", types.ErrSubnetNotFound, err)
+	}
+}
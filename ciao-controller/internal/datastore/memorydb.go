@@ -17,6 +17,7 @@ package datastore
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/types"
 	"github.com/ciao-project/ciao/payloads"
@@ -32,6 +33,12 @@ type MemoryDB struct {
 	attachments     map[string]types.StorageAttachment
 	instanceVolumes map[attachment]string
 	logEntries      []*types.LogEntry
+	instanceActions []types.InstanceAction
+	instanceCrashes []types.InstanceCrash
+	deleted         map[string]time.Time
+	expiries        map[string]time.Time
+	metadata        map[string]map[string]string
+	reservedIPs     []types.ReservedIP
 
 	workloadsPath string
 }
@@ -50,6 +57,9 @@ func (db *MemoryDB) init(config Config) error {
 	db.tenants = make(map[string]*tenant)
 	db.nodes = make(map[string]*node)
 	db.instances = make(map[string]*types.Instance)
+	db.deleted = make(map[string]time.Time)
+	db.expiries = make(map[string]time.Time)
+	db.metadata = make(map[string]map[string]string)
 	db.tenantUsage = make(map[string][]types.CiaoUsage)
 	db.blockDevices = make(map[string]types.Volume)
 	db.attachments = make(map[string]types.StorageAttachment)
@@ -64,6 +74,9 @@ func (db *MemoryDB) disconnect() {
 }
 
 func (db *MemoryDB) logEvent(entry types.LogEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
 	db.logEntries = append(db.logEntries, &entry)
 
 	return nil
@@ -74,6 +87,59 @@ func (db *MemoryDB) clearLog() error {
 	return nil
 }
 
+func (db *MemoryDB) pruneLog(before time.Time, maxRows int) (int, error) {
+	var kept []*types.LogEntry
+	rows := make(map[string]int)
+
+	// walk backwards so that the most recent entries of a tenant are kept
+	for i := len(db.logEntries) - 1; i >= 0; i-- {
+		e := db.logEntries[i]
+		if e.Timestamp.Before(before) {
+			continue
+		}
+		if maxRows > 0 && rows[e.TenantID] >= maxRows {
+			continue
+		}
+		rows[e.TenantID]++
+		kept = append([]*types.LogEntry{e}, kept...)
+	}
+
+	pruned := len(db.logEntries) - len(kept)
+	db.logEntries = kept
+
+	return pruned, nil
+}
+
+func (db *MemoryDB) addInstanceAction(action types.InstanceAction) error {
+	db.instanceActions = append(db.instanceActions, action)
+	return nil
+}
+
+func (db *MemoryDB) getInstanceActions(instanceID string) ([]types.InstanceAction, error) {
+	var actions []types.InstanceAction
+	for _, a := range db.instanceActions {
+		if a.InstanceID == instanceID {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
+
+func (db *MemoryDB) addInstanceCrash(crash types.InstanceCrash) error {
+	db.instanceCrashes = append(db.instanceCrashes, crash)
+	return nil
+}
+
+func (db *MemoryDB) getInstanceCrashes(instanceID string) ([]types.InstanceCrash, error) {
+	var crashes []types.InstanceCrash
+	for _, c := range db.instanceCrashes {
+		if c.InstanceID == instanceID {
+			crashes = append(crashes, c)
+		}
+	}
+	return crashes, nil
+}
+
 func (db *MemoryDB) getEventLog() ([]*types.LogEntry, error) {
 	return db.logEntries, nil
 }
@@ -88,6 +154,7 @@ func (db *MemoryDB) addTenant(id string, config types.TenantConfig) error {
 			},
 		},
 		network:   make(map[uint32]map[uint32]bool),
+		subnets:   make(map[uint32]types.TenantSubnet),
 		instances: make(map[string]*types.Instance),
 		devices:   make(map[string]types.Volume),
 	}
@@ -123,6 +190,39 @@ func (db *MemoryDB) claimTenantIPs(tenantID string, IPs []tenantIP) error {
 	return nil
 }
 
+func (db *MemoryDB) addTenantSubnet(s types.TenantSubnet) error {
+	return nil
+}
+
+func (db *MemoryDB) deleteTenantSubnet(subnetID string) error {
+	return nil
+}
+
+func (db *MemoryDB) addReservedIP(r types.ReservedIP) error {
+	db.reservedIPs = append(db.reservedIPs, r)
+	return nil
+}
+
+func (db *MemoryDB) deleteReservedIP(tenantID string, address string) error {
+	for i, r := range db.reservedIPs {
+		if r.TenantID == tenantID && r.Address == address {
+			db.reservedIPs = append(db.reservedIPs[:i], db.reservedIPs[i+1:]...)
+			return nil
+		}
+	}
+	return types.ErrAddressNotFound
+}
+
+func (db *MemoryDB) getReservedIPs(tenantID string) ([]types.ReservedIP, error) {
+	var reserved []types.ReservedIP
+	for _, r := range db.reservedIPs {
+		if r.TenantID == tenantID {
+			reserved = append(reserved, r)
+		}
+	}
+	return reserved, nil
+}
+
 func (db *MemoryDB) getInstances() ([]*types.Instance, error) {
 	var instances []*types.Instance
 	for _, instance := range db.instances {
@@ -136,9 +236,76 @@ func (db *MemoryDB) addInstance(instance *types.Instance) error {
 }
 
 func (db *MemoryDB) deleteInstance(instanceID string) error {
+	var crashes []types.InstanceCrash
+	for _, c := range db.instanceCrashes {
+		if c.InstanceID != instanceID {
+			crashes = append(crashes, c)
+		}
+	}
+	db.instanceCrashes = crashes
+
+	return nil
+}
+
+func (db *MemoryDB) addDeletedInstance(instanceID string, deletedAt time.Time) error {
+	db.deleted[instanceID] = deletedAt
+	return nil
+}
+
+func (db *MemoryDB) removeDeletedInstance(instanceID string) error {
+	delete(db.deleted, instanceID)
+	return nil
+}
+
+func (db *MemoryDB) getDeletedInstances() (map[string]time.Time, error) {
+	deleted := make(map[string]time.Time, len(db.deleted))
+	for id, deletedAt := range db.deleted {
+		deleted[id] = deletedAt
+	}
+	return deleted, nil
+}
+
+func (db *MemoryDB) addInstanceExpiry(instanceID string, expiresAt time.Time) error {
+	db.expiries[instanceID] = expiresAt
 	return nil
 }
 
+func (db *MemoryDB) removeInstanceExpiry(instanceID string) error {
+	delete(db.expiries, instanceID)
+	return nil
+}
+
+func (db *MemoryDB) getInstanceExpiries() (map[string]time.Time, error) {
+	expiries := make(map[string]time.Time, len(db.expiries))
+	for id, expiresAt := range db.expiries {
+		expiries[id] = expiresAt
+	}
+	return expiries, nil
+}
+
+func (db *MemoryDB) updateInstanceMetadata(instanceID string, metadata map[string]string) error {
+	if len(metadata) == 0 {
+		delete(db.metadata, instanceID)
+		return nil
+	}
+
+	md := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		md[k] = v
+	}
+	db.metadata[instanceID] = md
+
+	return nil
+}
+
+func (db *MemoryDB) getInstanceMetadata() (map[string]map[string]string, error) {
+	metadata := make(map[string]map[string]string, len(db.metadata))
+	for id, md := range db.metadata {
+		metadata[id] = md
+	}
+	return metadata, nil
+}
+
 func (db *MemoryDB) addNodeStat(stat payloads.Stat) error {
 	return nil
 }
@@ -159,6 +326,10 @@ func (db *MemoryDB) getBatchFrameStatistics(label string) ([]types.BatchFrameSta
 	return nil, nil
 }
 
+func (db *MemoryDB) getTraceFrames(label string) ([]types.CiaoTraceFrame, error) {
+	return nil, nil
+}
+
 func (db *MemoryDB) getWorkloadStorage(ID string) ([]types.StorageResource, error) {
 	return []types.StorageResource{}, nil
 }
@@ -227,6 +398,10 @@ func (db *MemoryDB) addWorkload(wl types.Workload) error {
 	return nil
 }
 
+func (db *MemoryDB) updateWorkload(wl types.Workload) error {
+	return nil
+}
+
 func (db *MemoryDB) deleteWorkload(ID string) error {
 	return nil
 }
@@ -253,6 +428,23 @@ func (db *MemoryDB) updateTenant(tenant *types.Tenant) error {
 
 func (db *MemoryDB) deleteTenant(tenantID string) error {
 	delete(db.tenants, tenantID)
+
+	var actions []types.InstanceAction
+	for _, a := range db.instanceActions {
+		if a.TenantID != tenantID {
+			actions = append(actions, a)
+		}
+	}
+	db.instanceActions = actions
+
+	var crashes []types.InstanceCrash
+	for _, c := range db.instanceCrashes {
+		if c.TenantID != tenantID {
+			crashes = append(crashes, c)
+		}
+	}
+	db.instanceCrashes = crashes
+
 	return nil
 }
 
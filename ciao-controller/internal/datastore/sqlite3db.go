@@ -17,9 +17,11 @@ package datastore
 
 import (
 	"database/sql"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -88,6 +90,92 @@ func (d logData) Init() error {
 	return d.ds.exec(d.db, cmd)
 }
 
+type instanceActionData struct {
+	namedData
+}
+
+func (d instanceActionData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS instance_actions
+		(
+		id integer primary key,
+		instance_id varchar(32),
+		tenant_id varchar(32),
+		action string,
+		user string,
+		node_id varchar(32),
+		result string,
+		reason string,
+		timestamp DATETIME
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
+type instanceCrashData struct {
+	namedData
+}
+
+func (d instanceCrashData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS instance_crashes
+		(
+		id integer primary key,
+		instance_id varchar(32),
+		tenant_id varchar(32),
+		node_id varchar(32),
+		exit_status string,
+		stderr string,
+		artifacts string,
+		memory_dump integer,
+		timestamp DATETIME
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
+type deletedInstanceData struct {
+	namedData
+}
+
+func (d deletedInstanceData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS deleted_instances
+		(
+		instance_id varchar(32) primary key,
+		deleted_at DATETIME
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
+type instanceExpiryData struct {
+	namedData
+}
+
+func (d instanceExpiryData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS instance_expiries
+		(
+		instance_id varchar(32) primary key,
+		expires_at DATETIME
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
+type instanceMetadataData struct {
+	namedData
+}
+
+func (d instanceMetadataData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS instance_metadata
+		(
+		instance_id varchar(32),
+		key string,
+		value string,
+		primary key(instance_id, key)
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
 type subnetData struct {
 	namedData
 }
@@ -104,6 +192,42 @@ func (d subnetData) Init() error {
 	return d.ds.exec(d.db, cmd)
 }
 
+type tenantSubnetData struct {
+	namedData
+}
+
+func (d tenantSubnetData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS tenant_subnets
+		(
+		id varchar(32) primary key,
+		tenant_id varchar(32),
+		name string,
+		cidr string,
+		timestamp DATETIME,
+		foreign key(tenant_id) references tenants(id)
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
+type reservedIPData struct {
+	namedData
+}
+
+func (d reservedIPData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS reserved_ips
+		(
+		tenant_id varchar(32),
+		address string,
+		description string,
+		timestamp DATETIME,
+		primary key(tenant_id, address),
+		foreign key(tenant_id) references tenants(id)
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
 // Handling of Instance specific data
 type instanceData struct {
 	namedData
@@ -412,6 +536,35 @@ func (d imageData) Init() error {
 	return d.ds.exec(d.db, cmd)
 }
 
+type imageDigestData struct {
+	namedData
+}
+
+func (d imageDigestData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS image_digests
+		(
+			image_id varchar(32) primary key,
+			digest string
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
+type imageFormatData struct {
+	namedData
+}
+
+func (d imageFormatData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS image_formats
+		(
+			image_id varchar(32) primary key,
+			disk_format string,
+			upload_size int
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
 func (ds *sqliteDB) exec(db *sql.DB, cmd string) error {
 	glog.V(2).Info("exec: ", cmd)
 
@@ -497,7 +650,14 @@ func (ds *sqliteDB) init(config Config) error {
 		workloadTemplateData{namedData{ds: ds, name: "workload_template", db: ds.db}},
 		nodeStatisticsData{namedData{ds: ds, name: "node_statistics", db: ds.db}},
 		logData{namedData{ds: ds, name: "log", db: ds.db}},
+		instanceActionData{namedData{ds: ds, name: "instance_actions", db: ds.db}},
+		instanceCrashData{namedData{ds: ds, name: "instance_crashes", db: ds.db}},
+		deletedInstanceData{namedData{ds: ds, name: "deleted_instances", db: ds.db}},
+		instanceExpiryData{namedData{ds: ds, name: "instance_expiries", db: ds.db}},
+		instanceMetadataData{namedData{ds: ds, name: "instance_metadata", db: ds.db}},
 		subnetData{namedData{ds: ds, name: "tenant_network", db: ds.db}},
+		reservedIPData{namedData{ds: ds, name: "reserved_ips", db: ds.db}},
+		tenantSubnetData{namedData{ds: ds, name: "tenant_subnets", db: ds.db}},
 		instanceStatisticsData{namedData{ds: ds, name: "instance_statistics", db: ds.db}},
 		frameStatisticsData{namedData{ds: ds, name: "frame_statistics", db: ds.db}},
 		traceData{namedData{ds: ds, name: "trace_data", db: ds.db}},
@@ -510,6 +670,8 @@ func (ds *sqliteDB) init(config Config) error {
 		mappedIPData{namedData{ds: ds, name: "mapped_ips", db: ds.db}},
 		quotaData{namedData{ds: ds, name: "quotas", db: ds.db}},
 		imageData{namedData{ds: ds, name: "images", db: ds.db}},
+		imageDigestData{namedData{ds: ds, name: "image_digests", db: ds.db}},
+		imageFormatData{namedData{ds: ds, name: "image_formats", db: ds.db}},
 	}
 
 	ds.workloadsPath = config.InitWorkloadsPath
@@ -582,7 +744,15 @@ func (ds *sqliteDB) logEvent(event types.LogEntry) error {
 	ds.dbLock.Lock()
 	defer ds.dbLock.Unlock()
 
-	_, err := db.Exec("INSERT INTO log (tenant_id, node_id, type, message) VALUES (?, ?, ?, ?)", event.TenantID, event.NodeID, event.EventType, event.Message)
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	// timestamps are stored as UTC in the format used by sqlite
+	_, err := db.Exec("INSERT INTO log (tenant_id, node_id, type, message, timestamp) VALUES (?, ?, ?, ?, ?)",
+		event.TenantID, event.NodeID, event.EventType, event.Message,
+		timestamp.UTC().Format("2006-01-02 15:04:05"))
 
 	return err
 }
@@ -599,6 +769,138 @@ func (ds *sqliteDB) clearLog() error {
 	return err
 }
 
+// pruneLog removes the event entries logged before a given time and
+// limits the number of entries retained for each tenant
+func (ds *sqliteDB) pruneLog(before time.Time, maxRows int) (int, error) {
+	db := ds.getTableDB("log")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var pruned int64
+
+	if !before.IsZero() {
+		// timestamps are stored by sqlite as UTC in this format
+		res, err := tx.Exec("DELETE FROM log WHERE timestamp < ?",
+			before.UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		pruned += n
+	}
+
+	if maxRows > 0 {
+		res, err := tx.Exec(`DELETE FROM log
+				     WHERE id NOT IN
+				     (SELECT id FROM log AS l
+				      WHERE l.tenant_id IS log.tenant_id
+				      ORDER BY l.id DESC LIMIT ?)`, maxRows)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		pruned += n
+	}
+
+	return int(pruned), tx.Commit()
+}
+
+func (ds *sqliteDB) addInstanceAction(a types.InstanceAction) error {
+	db := ds.getTableDB("instance_actions")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec(`INSERT INTO instance_actions
+			   (instance_id, tenant_id, action, user, node_id, result, reason, timestamp)
+			   VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.InstanceID, a.TenantID, a.Action, a.User, a.NodeID, a.Result, a.Reason, a.Timestamp)
+
+	return err
+}
+
+func (ds *sqliteDB) getInstanceActions(instanceID string) ([]types.InstanceAction, error) {
+	db := ds.getTableDB("instance_actions")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query(`SELECT instance_id, tenant_id, action, user, node_id,
+			       result, reason, timestamp
+			       FROM instance_actions
+			       WHERE instance_id = ?
+			       ORDER BY id`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var actions []types.InstanceAction
+	for rows.Next() {
+		var a types.InstanceAction
+		err = rows.Scan(&a.InstanceID, &a.TenantID, &a.Action, &a.User, &a.NodeID,
+			&a.Result, &a.Reason, &a.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	return actions, rows.Err()
+}
+
+func (ds *sqliteDB) addInstanceCrash(c types.InstanceCrash) error {
+	db := ds.getTableDB("instance_crashes")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec(`INSERT INTO instance_crashes
+			   (instance_id, tenant_id, node_id, exit_status, stderr, artifacts, memory_dump, timestamp)
+			   VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.InstanceID, c.TenantID, c.NodeID, c.ExitStatus, c.Stderr, c.Artifacts, c.MemoryDump, c.Timestamp)
+
+	return err
+}
+
+func (ds *sqliteDB) getInstanceCrashes(instanceID string) ([]types.InstanceCrash, error) {
+	db := ds.getTableDB("instance_crashes")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query(`SELECT instance_id, tenant_id, node_id, exit_status,
+			       stderr, artifacts, memory_dump, timestamp
+			       FROM instance_crashes
+			       WHERE instance_id = ?
+			       ORDER BY id`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var crashes []types.InstanceCrash
+	for rows.Next() {
+		var c types.InstanceCrash
+		err = rows.Scan(&c.InstanceID, &c.TenantID, &c.NodeID, &c.ExitStatus,
+			&c.Stderr, &c.Artifacts, &c.MemoryDump, &c.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		crashes = append(crashes, c)
+	}
+
+	return crashes, rows.Err()
+}
+
 func (ds *sqliteDB) getConfig(ID string) (string, error) {
 	var configFile string
 
@@ -840,6 +1142,64 @@ func (ds *sqliteDB) addWorkload(w types.Workload) error {
 	return err
 }
 
+func (ds *sqliteDB) updateWorkload(w types.Workload) error {
+	db := ds.getTableDB("workload_template")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// replace the workload storage resources
+	err = ds.deleteWorkloadStorage(tx, w.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for i := range w.Storage {
+		err := ds.createWorkloadStorage(tx, w.ID, &w.Storage[i])
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	requirements, err := json.Marshal(w.Requirements)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE workload_template SET description = ?, fw_type = ?, vm_type = ?, image_name = ?, requirements = ? WHERE id = ?", w.Description, w.FWType, string(w.VMType), w.ImageName, string(requirements), w.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// The new config is written aside and only replaces the current one
+	// once the transaction has been committed.
+	filename := fmt.Sprintf("%s_config.yaml", w.ID)
+	path := filepath.Join(ds.workloadsPath, filename)
+	tmpPath := path + ".new"
+	err = ioutil.WriteFile(tmpPath, []byte(w.Config), 0644)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
 func (ds *sqliteDB) deleteWorkload(ID string) error {
 	db := ds.getTableDB("workload_template")
 
@@ -993,8 +1353,95 @@ func (ds *sqliteDB) releaseTenantIP(tenantID string, subnetInt uint32, rest uint
 	return err
 }
 
+func (ds *sqliteDB) addTenantSubnet(s types.TenantSubnet) error {
+	db := ds.getTableDB("tenant_subnets")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("INSERT INTO tenant_subnets VALUES(?, ?, ?, ?, ?)",
+		s.ID, s.TenantID, s.Name, s.CIDR, s.CreateTime)
+
+	return err
+}
+
+func (ds *sqliteDB) deleteTenantSubnet(subnetID string) error {
+	db := ds.getTableDB("tenant_subnets")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("DELETE FROM tenant_subnets WHERE id = ?", subnetID)
+
+	return err
+}
+
+func (ds *sqliteDB) addReservedIP(r types.ReservedIP) error {
+	db := ds.getTableDB("reserved_ips")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("INSERT INTO reserved_ips VALUES(?, ?, ?, ?)",
+		r.TenantID, r.Address, r.Description, r.CreateTime)
+
+	return err
+}
+
+func (ds *sqliteDB) deleteReservedIP(tenantID string, address string) error {
+	db := ds.getTableDB("reserved_ips")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	res, err := db.Exec("DELETE FROM reserved_ips WHERE tenant_id = ? AND address = ?", tenantID, address)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return types.ErrAddressNotFound
+	}
+
+	return nil
+}
+
+func (ds *sqliteDB) getReservedIPs(tenantID string) ([]types.ReservedIP, error) {
+	db := ds.getTableDB("reserved_ips")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query(`SELECT tenant_id, address, description, timestamp
+			       FROM reserved_ips
+			       WHERE tenant_id = ?
+			       ORDER BY timestamp`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var reserved []types.ReservedIP
+	for rows.Next() {
+		var r types.ReservedIP
+		err = rows.Scan(&r.TenantID, &r.Address, &r.Description, &r.CreateTime)
+		if err != nil {
+			return nil, err
+		}
+		reserved = append(reserved, r)
+	}
+
+	return reserved, rows.Err()
+}
+
 func (ds *sqliteDB) getTenantNetwork(tenant *tenant) error {
 	tenant.network = make(map[uint32]map[uint32]bool)
+	tenant.subnets = make(map[uint32]types.TenantSubnet)
 
 	ds.dbLock.Lock()
 	defer ds.dbLock.Unlock()
@@ -1030,7 +1477,43 @@ func (ds *sqliteDB) getTenantNetwork(tenant *tenant) error {
 		tenant.network[subnetInt][rest] = true
 	}
 
-	return err
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return ds.getTenantSubnets(tenant)
+}
+
+// dbLock must be held.
+func (ds *sqliteDB) getTenantSubnets(tenant *tenant) error {
+	db := ds.getTableDB("tenant_subnets")
+
+	rows, err := db.Query(`SELECT id, tenant_id, name, cidr, timestamp
+			       FROM tenant_subnets
+			       WHERE tenant_id = ?`, tenant.ID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var s types.TenantSubnet
+
+		err = rows.Scan(&s.ID, &s.TenantID, &s.Name, &s.CIDR, &s.CreateTime)
+		if err != nil {
+			return err
+		}
+
+		ip, _, err := net.ParseCIDR(s.CIDR)
+		if err != nil || ip.To4() == nil {
+			glog.Warningf("Invalid subnet %s of tenant %s", s.CIDR, tenant.ID)
+			continue
+		}
+
+		tenant.subnets[binary.BigEndian.Uint32(ip.To4())] = s
+	}
+
+	return rows.Err()
 }
 
 func (ds *sqliteDB) updateTenant(tenant *types.Tenant) error {
@@ -1067,6 +1550,41 @@ func (ds *sqliteDB) deleteTenant(tenantID string) error {
 		return err
 	}
 
+	// its instance action history
+	_, err = tx.Exec("DELETE FROM instance_actions WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// the crashes of its instances
+	_, err = tx.Exec("DELETE FROM instance_crashes WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// and any subnets allocated to it
+	_, err = tx.Exec("DELETE FROM tenant_network WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// the subnets it created
+	_, err = tx.Exec("DELETE FROM tenant_subnets WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// along with its reserved addresses
+	_, err = tx.Exec("DELETE FROM reserved_ips WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
 	_, err = tx.Exec("DELETE FROM tenants WHERE id = ?", tenantID)
 	if err != nil {
 		_ = tx.Rollback()
@@ -1245,9 +1763,25 @@ func (ds *sqliteDB) deleteInstance(instanceID string) error {
 	ds.dbLock.Lock()
 	defer ds.dbLock.Unlock()
 
-	_, err := db.Exec("DELETE FROM instances WHERE id = ?", instanceID)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
 
-	return err
+	_, err = tx.Exec("DELETE FROM instances WHERE id = ?", instanceID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// its node removes the crash artifacts along with the instance
+	_, err = tx.Exec("DELETE FROM instance_crashes WHERE instance_id = ?", instanceID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (ds *sqliteDB) updateInstance(instance *types.Instance) error {
@@ -1261,6 +1795,159 @@ func (ds *sqliteDB) updateInstance(instance *types.Instance) error {
 	return err
 }
 
+func (ds *sqliteDB) addDeletedInstance(instanceID string, deletedAt time.Time) error {
+	db := ds.getTableDB("deleted_instances")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("REPLACE INTO deleted_instances (instance_id, deleted_at) VALUES (?, ?)", instanceID, deletedAt)
+
+	return err
+}
+
+func (ds *sqliteDB) removeDeletedInstance(instanceID string) error {
+	db := ds.getTableDB("deleted_instances")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("DELETE FROM deleted_instances WHERE instance_id = ?", instanceID)
+
+	return err
+}
+
+func (ds *sqliteDB) getDeletedInstances() (map[string]time.Time, error) {
+	db := ds.getTableDB("deleted_instances")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query("SELECT instance_id, deleted_at FROM deleted_instances")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	deleted := make(map[string]time.Time)
+	for rows.Next() {
+		var instanceID string
+		var deletedAt time.Time
+
+		if err := rows.Scan(&instanceID, &deletedAt); err != nil {
+			return nil, err
+		}
+		deleted[instanceID] = deletedAt
+	}
+
+	return deleted, rows.Err()
+}
+
+func (ds *sqliteDB) addInstanceExpiry(instanceID string, expiresAt time.Time) error {
+	db := ds.getTableDB("instance_expiries")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("REPLACE INTO instance_expiries (instance_id, expires_at) VALUES (?, ?)", instanceID, expiresAt)
+
+	return err
+}
+
+func (ds *sqliteDB) removeInstanceExpiry(instanceID string) error {
+	db := ds.getTableDB("instance_expiries")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := db.Exec("DELETE FROM instance_expiries WHERE instance_id = ?", instanceID)
+
+	return err
+}
+
+func (ds *sqliteDB) getInstanceExpiries() (map[string]time.Time, error) {
+	db := ds.getTableDB("instance_expiries")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query("SELECT instance_id, expires_at FROM instance_expiries")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	expiries := make(map[string]time.Time)
+	for rows.Next() {
+		var instanceID string
+		var expiresAt time.Time
+
+		if err := rows.Scan(&instanceID, &expiresAt); err != nil {
+			return nil, err
+		}
+		expiries[instanceID] = expiresAt
+	}
+
+	return expiries, rows.Err()
+}
+
+func (ds *sqliteDB) updateInstanceMetadata(instanceID string, metadata map[string]string) error {
+	db := ds.getTableDB("instance_metadata")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM instance_metadata WHERE instance_id = ?", instanceID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for key, value := range metadata {
+		_, err = tx.Exec("INSERT INTO instance_metadata (instance_id, key, value) VALUES (?, ?, ?)", instanceID, key, value)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *sqliteDB) getInstanceMetadata() (map[string]map[string]string, error) {
+	db := ds.getTableDB("instance_metadata")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query("SELECT instance_id, key, value FROM instance_metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	metadata := make(map[string]map[string]string)
+	for rows.Next() {
+		var instanceID, key, value string
+
+		if err := rows.Scan(&instanceID, &key, &value); err != nil {
+			return nil, err
+		}
+
+		if metadata[instanceID] == nil {
+			metadata[instanceID] = make(map[string]string)
+		}
+		metadata[instanceID][key] = value
+	}
+
+	return metadata, rows.Err()
+}
+
 func (ds *sqliteDB) addNodeStat(stat payloads.Stat) error {
 	db := ds.getTableDB("node_statistics")
 
@@ -1578,6 +2265,68 @@ func (ds *sqliteDB) getBatchFrameStatistics(label string) ([]types.BatchFrameSta
 	return stats, err
 }
 
+// getTraceFrames returns the raw timestamps of the frames traced with label
+// together with the timestamps recorded by each node the frames went through.
+func (ds *sqliteDB) getTraceFrames(label string) ([]types.CiaoTraceFrame, error) {
+	db := ds.getTableDB("frame_statistics")
+
+	query := `SELECT	frame_statistics.id,
+			frame_statistics.type,
+			frame_statistics.operand,
+			frame_statistics.start_timestamp,
+			frame_statistics.end_timestamp,
+			trace_data.ssntp_uuid,
+			trace_data.rx_timestamp,
+			trace_data.tx_timestamp
+		FROM frame_statistics
+		LEFT JOIN trace_data
+		ON trace_data.frame_id = frame_statistics.id
+		WHERE frame_statistics.label = ?
+		ORDER BY frame_statistics.id, trace_data.id`
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	rows, err := db.Query(query, label)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	frames := make([]types.CiaoTraceFrame, 0)
+
+	for rows.Next() {
+		var frame types.CiaoTraceFrame
+		var start, end sql.NullString
+		var nodeID, rx, tx sql.NullString
+
+		err = rows.Scan(&frame.ID, &frame.Type, &frame.Operand, &start, &end, &nodeID, &rx, &tx)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(frames) == 0 || frames[len(frames)-1].ID != frame.ID {
+			frame.StartTimestamp = start.String
+			frame.EndTimestamp = end.String
+			frame.Nodes = []types.CiaoTraceFrameNode{}
+			frames = append(frames, frame)
+		}
+
+		if !nodeID.Valid {
+			continue
+		}
+
+		last := &frames[len(frames)-1]
+		last.Nodes = append(last.Nodes, types.CiaoTraceFrameNode{
+			NodeID:      nodeID.String,
+			RxTimestamp: rx.String,
+			TxTimestamp: tx.String,
+		})
+	}
+
+	return frames, rows.Err()
+}
+
 func (ds *sqliteDB) getTenantDevices(tenantID string) (map[string]types.Volume, error) {
 	devices := make(map[string]types.Volume)
 
@@ -2170,7 +2919,16 @@ func (ds *sqliteDB) getQuotas(tenantID string) ([]types.QuotaDetails, error) {
 func (ds *sqliteDB) getImages() ([]types.Image, error) {
 	images := []types.Image{}
 
-	query := `SELECT id, state, tenant_id, name, createtime, size, visibility FROM images`
+	query := `SELECT images.id, images.state, images.tenant_id, images.name,
+			 images.createtime, images.size, images.visibility,
+			 IFNULL(image_digests.digest, ''),
+			 IFNULL(image_formats.disk_format, ''),
+			 IFNULL(image_formats.upload_size, 0)
+		  FROM images
+		  LEFT JOIN image_digests
+		  ON images.id = image_digests.image_id
+		  LEFT JOIN image_formats
+		  ON images.id = image_formats.image_id`
 
 	db := ds.getTableDB("images")
 	ds.dbLock.Lock()
@@ -2186,7 +2944,8 @@ func (ds *sqliteDB) getImages() ([]types.Image, error) {
 		i := types.Image{}
 		var state, visibility string
 
-		err = rows.Scan(&i.ID, &state, &i.TenantID, &i.Name, &i.CreateTime, &i.Size, &visibility)
+		err = rows.Scan(&i.ID, &state, &i.TenantID, &i.Name, &i.CreateTime, &i.Size, &visibility, &i.Digest,
+			&i.DiskFormat, &i.UploadSize)
 		if err != nil {
 			return []types.Image{}, errors.Wrap(err, "error reading image row from database")
 		}
@@ -2207,9 +2966,39 @@ func (ds *sqliteDB) updateImage(i types.Image) error {
 	ds.dbLock.Lock()
 	defer ds.dbLock.Unlock()
 
-	_, err := db.Exec(query, i.ID, i.State, i.TenantID, i.Name, i.CreateTime, i.Size, i.Visibility)
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Error starting image update transaction")
+	}
+
+	_, err = tx.Exec(query, i.ID, i.State, i.TenantID, i.Name, i.CreateTime, i.Size, i.Visibility)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "Error updatiing image into database")
+	}
 
-	return errors.Wrap(err, "Error updatiing image into database")
+	if i.Digest != "" {
+		_, err = tx.Exec(`REPLACE INTO image_digests (image_id, digest) VALUES (?, ?)`, i.ID, i.Digest)
+	} else {
+		_, err = tx.Exec(`DELETE FROM image_digests WHERE image_id = ?`, i.ID)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "Error updating image digest in database")
+	}
+
+	if i.DiskFormat != "" {
+		_, err = tx.Exec(`REPLACE INTO image_formats (image_id, disk_format, upload_size) VALUES (?, ?, ?)`,
+			i.ID, i.DiskFormat, i.UploadSize)
+	} else {
+		_, err = tx.Exec(`DELETE FROM image_formats WHERE image_id = ?`, i.ID)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "Error updating image format in database")
+	}
+
+	return errors.Wrap(tx.Commit(), "Error committing image update")
 }
 
 func (ds *sqliteDB) deleteImage(ID string) error {
@@ -2220,6 +3009,16 @@ func (ds *sqliteDB) deleteImage(ID string) error {
 	defer ds.dbLock.Unlock()
 
 	_, err := db.Exec(query, ID)
+	if err != nil {
+		return errors.Wrap(err, "Error deleting image from database")
+	}
+
+	_, err = db.Exec(`DELETE FROM image_digests WHERE image_id = ?`, ID)
+	if err != nil {
+		return errors.Wrap(err, "Error deleting image digest from database")
+	}
+
+	_, err = db.Exec(`DELETE FROM image_formats WHERE image_id = ?`, ID)
 
-	return errors.Wrap(err, "Error deleting image from database")
+	return errors.Wrap(err, "Error deleting image format from database")
 }
@@ -808,6 +808,42 @@ func TestSQLiteDBGetBatchFrameStatistics(t *testing.T) {
 	}
 }
 
+func TestSQLiteDBGetTraceFrames(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := createTestFrameTraces("trace_frames_test")
+	for _, frame := range frames {
+		err := db.addFrameStat(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	traced, err := db.getTraceFrames("trace_frames_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(traced) != len(frames) {
+		t.Fatalf("Expected %d frames, got %d", len(frames), len(traced))
+	}
+
+	for i, frame := range traced {
+		if len(frame.Nodes) != len(frames[i].Nodes) {
+			t.Fatalf("Expected %d nodes, got %d", len(frames[i].Nodes), len(frame.Nodes))
+		}
+
+		for j, node := range frame.Nodes {
+			if node.NodeID != frames[i].Nodes[j].SSNTPUUID {
+				t.Fatalf("Expected node %s, got %s", frames[i].Nodes[j].SSNTPUUID, node.NodeID)
+			}
+		}
+	}
+}
+
 func TestSQLiteDBGetBatchFrameSummary(t *testing.T) {
 	db, err := getPersistentStore()
 	if err != nil {
@@ -892,6 +928,291 @@ func TestSQLiteDBEventLog(t *testing.T) {
 	}
 }
 
+func TestSQLiteDBPruneLog(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tenantID := range []string{"tenant1", "tenant1", "tenant1", "tenant2"} {
+		e := types.LogEntry{
+			TenantID:  tenantID,
+			EventType: string(userInfo),
+			Message:   "test message",
+		}
+		err = db.logEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := db.pruneLog(time.Time{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Fatalf("Expected 1 log message to be pruned, got %d", pruned)
+	}
+
+	log, err := db.getEventLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 3 {
+		t.Fatalf("Expected 3 log messages, got %d", len(log))
+	}
+
+	pruned, err = db.pruneLog(time.Now().Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 0 {
+		t.Fatalf("Expected no log messages to be pruned, got %d", pruned)
+	}
+
+	pruned, err = db.pruneLog(time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 3 {
+		t.Fatalf("Expected 3 log messages to be pruned, got %d", pruned)
+	}
+}
+
+func TestSQLiteDBInstanceActions(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+	actions := []types.InstanceAction{
+		{
+			InstanceID: instanceID,
+			TenantID:   "tenant",
+			Action:     types.InstanceActionCreate,
+			User:       "user",
+			Result:     types.InstanceActionSuccess,
+			Timestamp:  time.Now().UTC(),
+		},
+		{
+			InstanceID: instanceID,
+			TenantID:   "tenant",
+			Action:     types.InstanceActionLaunch,
+			NodeID:     "node",
+			Result:     types.InstanceActionError,
+			Reason:     "full_cn",
+			Timestamp:  time.Now().UTC(),
+		},
+		{
+			InstanceID: uuid.Generate().String(),
+			TenantID:   "tenant",
+			Action:     types.InstanceActionCreate,
+			Result:     types.InstanceActionSuccess,
+			Timestamp:  time.Now().UTC(),
+		},
+	}
+
+	for _, a := range actions {
+		err = db.addInstanceAction(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := db.getInstanceActions(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 actions, got %d", len(history))
+	}
+
+	for i := range history {
+		if !history[i].Timestamp.Equal(actions[i].Timestamp) {
+			t.Errorf("Unexpected timestamp %v", history[i].Timestamp)
+		}
+		history[i].Timestamp = actions[i].Timestamp
+		if history[i] != actions[i] {
+			t.Errorf("Expected %+v, got %+v", actions[i], history[i])
+		}
+	}
+}
+
+func TestSQLiteDBInstanceCrashes(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+	crash := types.InstanceCrash{
+		InstanceID: instanceID,
+		TenantID:   "tenant",
+		NodeID:     "node",
+		ExitStatus: "killed by SIGSEGV",
+		Stderr:     "qemu: fatal error",
+		Artifacts:  "/var/lib/ciao/crashes/" + instanceID + "/20170612T101323Z",
+		Timestamp:  time.Now().UTC(),
+	}
+
+	err = db.addInstanceCrash(crash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crashes, err := db.getInstanceCrashes(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(crashes) != 1 {
+		t.Fatalf("Expected 1 crash, got %d", len(crashes))
+	}
+
+	if !crashes[0].Timestamp.Equal(crash.Timestamp) {
+		t.Errorf("Unexpected timestamp %v", crashes[0].Timestamp)
+	}
+	crashes[0].Timestamp = crash.Timestamp
+	if crashes[0] != crash {
+		t.Errorf("Expected %+v, got %+v", crash, crashes[0])
+	}
+
+	crashes, err = db.getInstanceCrashes(uuid.Generate().String())
+	if err != nil || len(crashes) != 0 {
+		t.Errorf("Unexpected crashes %v: %v", crashes, err)
+	}
+
+	err = db.deleteInstance(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crashes, err = db.getInstanceCrashes(instanceID)
+	if err != nil || len(crashes) != 0 {
+		t.Errorf("Crashes of deleted instance not removed %v: %v", crashes, err)
+	}
+}
+
+func TestSQLiteDBDeletedInstances(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+	deletedAt := time.Now().UTC()
+
+	err = db.addDeletedInstance(instanceID, deletedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := db.getDeletedInstances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !deleted[instanceID].Equal(deletedAt) {
+		t.Fatalf("Expected %s to be deleted at %v, got %v", instanceID, deletedAt, deleted[instanceID])
+	}
+
+	err = db.removeDeletedInstance(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err = db.getDeletedInstances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := deleted[instanceID]; ok {
+		t.Fatalf("%s still deleted after removal", instanceID)
+	}
+}
+
+func TestSQLiteDBInstanceExpiries(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	err = db.addInstanceExpiry(instanceID, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiries, err := db.getInstanceExpiries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !expiries[instanceID].Equal(expiresAt) {
+		t.Fatalf("Expected %s to expire at %v, got %v", instanceID, expiresAt, expiries[instanceID])
+	}
+
+	err = db.removeInstanceExpiry(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiries, err = db.getInstanceExpiries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := expiries[instanceID]; ok {
+		t.Fatalf("%s still expires after removal", instanceID)
+	}
+}
+
+func TestSQLiteDBInstanceMetadata(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+
+	err = db.updateInstanceMetadata(instanceID, map[string]string{"role": "web", "tier": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.updateInstanceMetadata(instanceID, map[string]string{"role": "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := db.getInstanceMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadata[instanceID]) != 1 || metadata[instanceID]["role"] != "db" {
+		t.Fatalf("Expected metadata of %s to be replaced, got %v", instanceID, metadata[instanceID])
+	}
+
+	err = db.updateInstanceMetadata(instanceID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err = db.getInstanceMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := metadata[instanceID]; ok {
+		t.Fatalf("%s still has metadata after removal", instanceID)
+	}
+}
+
 func TestSQLiteDBInstanceStats(t *testing.T) {
 	db, err := getPersistentStore()
 	if err != nil {
@@ -992,6 +1313,36 @@ users:
 		t.Fatal("Expected workload equality")
 	}
 
+	// update the workload
+	wl.Description = "updatedWorkload"
+	wl.Config = "#cloud-config\n"
+	wl.Requirements.MemMB = 1024
+	wl.Storage[0].Size = 40
+
+	err = db.updateWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workloads, err = db.getWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl2 = types.Workload{}
+	for i, w := range workloads {
+		if w.ID == wl.ID {
+			wl2 = workloads[i]
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(wl, wl2) {
+		fmt.Fprintf(os.Stderr, "got %v\n", wl2)
+		fmt.Fprintf(os.Stderr, "expected %v\n", wl)
+		t.Fatal("Expected updated workload equality")
+	}
+
 	// now try to delete the workload
 	err = db.deleteWorkload(wl.ID)
 	if err != nil {
@@ -1298,19 +1649,44 @@ func TestSQLiteDBDeleteTenant(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	err = db.claimTenantIP(tenantID, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	err = db.deleteTenant(tenantID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	tenant, err := db.getTenant(tenantID)
+	dbTenant, err := db.getTenant(tenantID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if tenant != nil {
+	if dbTenant != nil {
 		t.Fatal("Tenant Delete not successful")
 	}
+
+	// a tenant re-created with the same ID must not inherit any subnets
+	err = db.addTenant(tenantID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbTenant, err = db.getTenant(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dbTenant.network) != 0 {
+		t.Fatal("Tenant subnets not deleted")
+	}
+
+	err = db.deleteTenant(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestSQLiteDBAddRemoveImages(t *testing.T) {
@@ -1372,6 +1748,9 @@ func TestSQLiteDBAddRemoveImages(t *testing.T) {
 		Name:       "test-image2",
 		Size:       1234567,
 		Visibility: types.Private,
+		Digest:     "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		DiskFormat: "qcow2",
+		UploadSize: 654321,
 	}
 
 	err = db.updateImage(i2)
@@ -1388,6 +1767,12 @@ func TestSQLiteDBAddRemoveImages(t *testing.T) {
 		t.Fatalf("Unexpected image count: %d vs 2", len(images))
 	}
 
+	for _, image := range images {
+		if image.ID == i2.ID && !reflect.DeepEqual(image, i2) {
+			t.Fatalf("Returned image not as expected %v vs %v", image, i2)
+		}
+	}
+
 	err = db.deleteImage(i.ID)
 	if err != nil {
 		t.Fatal(err)
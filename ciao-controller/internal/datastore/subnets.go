@@ -0,0 +1,231 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/uuid"
+	"github.com/pkg/errors"
+)
+
+// tenantNetwork is the address range out of which the subnets of all
+// tenants are carved.
+var tenantNetwork = net.IPNet{
+	IP:   net.IPv4(172, 16, 0, 0).To4(),
+	Mask: net.CIDRMask(12, 32),
+}
+
+// AddTenantSubnet creates a subnet of the tenant network.  The subnet must
+// have the tenant's subnet size and must not overlap a subnet that is
+// already in use, whether it was created by the tenant or carved out
+// automatically.  Addresses are only allocated from the new subnet to
+// instances that ask for it.
+func (ds *Datastore) AddTenantSubnet(tenantID string, name string, cidr string) (types.TenantSubnet, error) {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return types.TenantSubnet{}, err
+	}
+	if t == nil {
+		return types.TenantSubnet{}, types.ErrTenantNotFound
+	}
+
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil {
+		return types.TenantSubnet{}, types.ErrBadSubnet
+	}
+
+	ones, _ := ipNet.Mask.Size()
+	if ones != t.SubnetBits || !ip.Equal(ipNet.IP) || !tenantNetwork.Contains(ip) {
+		return types.TenantSubnet{}, types.ErrBadSubnet
+	}
+
+	subnetNum := binary.BigEndian.Uint32(ip.To4())
+
+	s := types.TenantSubnet{
+		ID:         uuid.Generate().String(),
+		TenantID:   tenantID,
+		Name:       name,
+		CIDR:       ipNet.String(),
+		CreateTime: time.Now(),
+	}
+
+	ds.tenantsLock.Lock()
+	defer ds.tenantsLock.Unlock()
+
+	if _, ok := t.subnets[subnetNum]; ok || len(t.network[subnetNum]) > 0 {
+		return types.TenantSubnet{}, types.ErrDuplicateSubnet
+	}
+
+	err = ds.db.addTenantSubnet(s)
+	if err != nil {
+		return types.TenantSubnet{}, err
+	}
+
+	t.subnets[subnetNum] = s
+
+	return s, nil
+}
+
+// GetTenantSubnets returns the subnets created by a tenant ordered by
+// address.
+func (ds *Datastore) GetTenantSubnets(tenantID string) ([]types.TenantSubnet, error) {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, types.ErrTenantNotFound
+	}
+
+	ds.tenantsLock.RLock()
+	nums := make([]uint32, 0, len(t.subnets))
+	for n := range t.subnets {
+		nums = append(nums, n)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	subnets := make([]types.TenantSubnet, 0, len(nums))
+	for _, n := range nums {
+		subnets = append(subnets, t.subnets[n])
+	}
+	ds.tenantsLock.RUnlock()
+
+	return subnets, nil
+}
+
+// lock for tenant must be held.
+func findTenantSubnet(t *tenant, subnetID string) (uint32, types.TenantSubnet, error) {
+	for n, s := range t.subnets {
+		if s.ID == subnetID {
+			return n, s, nil
+		}
+	}
+	return 0, types.TenantSubnet{}, types.ErrSubnetNotFound
+}
+
+// GetTenantSubnet returns a subnet created by a tenant.
+func (ds *Datastore) GetTenantSubnet(tenantID string, subnetID string) (types.TenantSubnet, error) {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return types.TenantSubnet{}, err
+	}
+	if t == nil {
+		return types.TenantSubnet{}, types.ErrTenantNotFound
+	}
+
+	ds.tenantsLock.RLock()
+	defer ds.tenantsLock.RUnlock()
+
+	_, s, err := findTenantSubnet(t, subnetID)
+	return s, err
+}
+
+// DeleteTenantSubnet removes a subnet created by a tenant.  The subnet
+// cannot be removed while addresses are allocated from it.
+func (ds *Datastore) DeleteTenantSubnet(tenantID string, subnetID string) error {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return types.ErrTenantNotFound
+	}
+
+	ds.tenantsLock.Lock()
+	defer ds.tenantsLock.Unlock()
+
+	subnetNum, _, err := findTenantSubnet(t, subnetID)
+	if err != nil {
+		return err
+	}
+
+	if len(t.network[subnetNum]) > 0 {
+		return types.ErrSubnetInUse
+	}
+
+	err = ds.db.deleteTenantSubnet(subnetID)
+	if err != nil {
+		return err
+	}
+
+	delete(t.subnets, subnetNum)
+
+	return nil
+}
+
+// AllocateSubnetIPPool reserves a pool of IP addresses from a subnet
+// created by the tenant.
+func (ds *Datastore) AllocateSubnetIPPool(tenantID string, subnetID string, num int) ([]net.IP, error) {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, types.ErrTenantNotFound
+	}
+
+	ds.tenantsLock.Lock()
+
+	subnetNum, _, err := findTenantSubnet(t, subnetID)
+	if err != nil {
+		ds.tenantsLock.Unlock()
+		return nil, err
+	}
+
+	if t.network[subnetNum] == nil {
+		t.network[subnetNum] = make(map[uint32]bool)
+	}
+	netmap := t.network[subnetNum]
+	maxHosts := uint32(1) << uint32(32-t.SubnetBits)
+
+	var addrs []net.IP
+	var tenantAddrs []tenantIP
+
+	// skip network, gateway, and broadcast addrs.
+	for host := uint32(2); host < maxHosts-1 && len(addrs) < num; host++ {
+		addr := subnetNum + host
+		if netmap[addr] {
+			continue
+		}
+
+		netmap[addr] = true
+		newIP := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(newIP, addr)
+		addrs = append(addrs, newIP)
+		tenantAddrs = append(tenantAddrs, tenantIP{subnetNum, addr})
+	}
+
+	if len(addrs) < num {
+		ds.cleanTenantIPs(tenantID, tenantAddrs)
+		ds.tenantsLock.Unlock()
+		return nil, errors.New("out of addrs")
+	}
+
+	err = ds.db.claimTenantIPs(tenantID, tenantAddrs)
+	if err != nil {
+		ds.cleanTenantIPs(tenantID, tenantAddrs)
+		ds.tenantsLock.Unlock()
+		return nil, err
+	}
+
+	ds.tenantsLock.Unlock()
+
+	return addrs, ds.activateSubnets(tenantID, addrs)
+}
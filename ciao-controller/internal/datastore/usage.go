@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+)
+
+// usageResolution describes one of the resolutions at which the usage
+// history of a tenant is kept.  A period of 0 means that every sample is
+// kept.  Otherwise there is one sample per period, holding the last usage
+// recorded during that period and timestamped with the start of the
+// period.  Samples older than retention are discarded.
+type usageResolution struct {
+	period    time.Duration
+	retention time.Duration
+}
+
+// usageResolutions lists the resolutions from the finest to the coarsest.
+// A query is served from the finest resolution that still covers the start
+// of the requested window, so a month long window is served from around 720
+// hourly samples rather than from every raw sample.
+var usageResolutions = []usageResolution{
+	{period: 0, retention: time.Hour},
+	{period: 5 * time.Minute, retention: 7 * 24 * time.Hour},
+	{period: time.Hour, retention: 90 * 24 * time.Hour},
+}
+
+// usageHistory holds the usage samples of a tenant at each of the
+// usageResolutions, oldest first.
+type usageHistory struct {
+	samples [][]types.CiaoUsage
+}
+
+func newUsageHistory() *usageHistory {
+	return &usageHistory{
+		samples: make([][]types.CiaoUsage, len(usageResolutions)),
+	}
+}
+
+// last returns the most recent sample, which is always the last raw sample.
+func (h *usageHistory) last() (types.CiaoUsage, bool) {
+	raw := h.samples[0]
+	if len(raw) == 0 {
+		return types.CiaoUsage{}, false
+	}
+	return raw[len(raw)-1], true
+}
+
+// add records a new sample at every resolution and discards the samples
+// that have outlived their retention period.
+func (h *usageHistory) add(u types.CiaoUsage) {
+	for i, r := range usageResolutions {
+		samples := h.samples[i]
+		sample := u
+
+		if r.period > 0 {
+			sample.Timestamp = u.Timestamp.Truncate(r.period)
+			n := len(samples)
+			if n > 0 && samples[n-1].Timestamp.Equal(sample.Timestamp) {
+				samples[n-1] = sample
+				continue
+			}
+		}
+
+		h.samples[i] = pruneUsage(append(samples, sample), u.Timestamp.Add(-r.retention))
+	}
+}
+
+func pruneUsage(samples []types.CiaoUsage, before time.Time) []types.CiaoUsage {
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Timestamp.After(before)
+	})
+
+	// The discarded samples are freed the next time append needs to
+	// grow the slice.
+	return samples[i:]
+}
+
+// get returns the samples timestamped within [start, end) from the finest
+// resolution whose retention covers start.
+func (h *usageHistory) get(start, end time.Time, now time.Time) []types.CiaoUsage {
+	res := len(usageResolutions) - 1
+	for i, r := range usageResolutions {
+		if !start.Before(now.Add(-r.retention)) {
+			res = i
+			break
+		}
+	}
+
+	samples := h.samples[res]
+	first := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].Timestamp.Before(start)
+	})
+	last := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].Timestamp.Before(end)
+	})
+	if first >= last {
+		return nil
+	}
+
+	return append([]types.CiaoUsage(nil), samples[first:last]...)
+}
@@ -42,6 +42,7 @@ type Result interface {
 	Allowed() bool
 	Reason() string
 	Resources() []payloads.RequestedResource
+	Excesses() []types.QuotaExcess
 }
 
 type consumeOp struct {
@@ -75,6 +76,7 @@ type result struct {
 	allowed   bool
 	reason    string
 	resources []payloads.RequestedResource
+	excesses  []types.QuotaExcess
 }
 
 var supportedResources = [...]payloads.Resource{
@@ -114,7 +116,7 @@ func getTenantData(tenantDetails map[string]*tenantData, tenantID string) *tenan
 
 func consumeQuota(tenantDetails map[string]*tenantData, op *consumeOp) Result {
 	td := getTenantData(tenantDetails, op.tenantID)
-	allowed := true
+	res := &result{resources: op.resources, allowed: true}
 
 	for _, r := range op.resources {
 		q, ok := td.quotas[r.Type]
@@ -122,16 +124,21 @@ func consumeQuota(tenantDetails map[string]*tenantData, op *consumeOp) Result {
 		if ok {
 			q.consumed += r.Value
 			if q.limit > -1 && q.consumed > q.limit {
-				allowed = false
+				res.allowed = false
+				res.excesses = append(res.excesses, types.QuotaExcess{
+					Name:      resourceToQuotaName(r.Type),
+					Limit:     q.limit,
+					Usage:     q.consumed - r.Value,
+					Requested: r.Value,
+					Excess:    q.consumed - q.limit,
+				})
 			}
 		}
 	}
 
-	res := &result{resources: op.resources}
-	res.allowed = allowed
-	if !allowed {
-		// TODO: produce more precise reason
-		res.reason = "Over quota"
+	if !res.allowed {
+		err := types.QuotaError{Excesses: res.excesses}
+		res.reason = err.Error()
 	}
 	return res
 }
@@ -408,6 +415,12 @@ func (r *result) Reason() string {
 	return r.reason
 }
 
+// Excesses details by how much each quota the request was denied for is
+// exceeded.
+func (r *result) Excesses() []types.QuotaExcess {
+	return r.excesses
+}
+
 // Resources gives the set of resources that made up the consumption request
 // that this Result was associated with.
 func (r *result) Resources() []payloads.RequestedResource {
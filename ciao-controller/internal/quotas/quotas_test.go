@@ -61,6 +61,44 @@ func TestConsumeAndRelease(t *testing.T) {
 	qs.Shutdown()
 }
 
+func TestConsumeExcesses(t *testing.T) {
+	qs := &Quotas{}
+	qs.Init()
+	defer qs.Shutdown()
+
+	quotas := []types.QuotaDetails{
+		{Name: "tenant-vcpu-quota", Value: 10},
+		{Name: "tenant-instances-quota", Value: 2},
+	}
+
+	qs.Update("test-tenant-1", quotas)
+
+	res := <-qs.Consume("test-tenant-1",
+		payloads.RequestedResource{Type: payloads.VCPUs, Value: 6},
+		payloads.RequestedResource{Type: payloads.Instance, Value: 1})
+	if !res.Allowed() || len(res.Excesses()) != 0 {
+		t.Fatalf("Expected to be allowed: %+v", res.Excesses())
+	}
+
+	res = <-qs.Consume("test-tenant-1",
+		payloads.RequestedResource{Type: payloads.VCPUs, Value: 6},
+		payloads.RequestedResource{Type: payloads.Instance, Value: 1})
+	if res.Allowed() {
+		t.Fatal("Expected to be denied")
+	}
+
+	expected := []types.QuotaExcess{
+		{Name: "tenant-vcpu-quota", Limit: 10, Usage: 6, Requested: 6, Excess: 2},
+	}
+	if !reflect.DeepEqual(res.Excesses(), expected) {
+		t.Fatalf("Expected excesses %+v, got %+v", expected, res.Excesses())
+	}
+
+	if res.Reason() != "Over quota: tenant-vcpu-quota exceeded by 2 (6 requested, 6 of 10 used)" {
+		t.Fatalf("Unexpected reason: %s", res.Reason())
+	}
+}
+
 func testHasQuota(t *testing.T, qds []types.QuotaDetails, qd types.QuotaDetails) {
 	for i := range qds {
 		if reflect.DeepEqual(qd, qds[i]) {
@@ -0,0 +1,303 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records distributed trace spans and reports them to a
+// Jaeger collector.
+//
+// Spans are reported in batches, as JSON, to the Zipkin compatible
+// endpoint of the collector, e.g., http://jaeger:9411/api/v2/spans.  A span
+// looks like
+//
+//	{
+//	  "traceId": "d1f3c6a42a9b4b079d361b6d3a2b0f1e",
+//	  "id": "4c8a2f1b0e9d3a57",
+//	  "parentId": "9b2e7c4d1a0f6e38",
+//	  "name": "ssntp START",
+//	  "timestamp": 1497262403103482,
+//	  "duration": 15342,
+//	  "localEndpoint": {"serviceName": "ciao-scheduler"},
+//	  "tags": {"instance_id": "d1f3c6a4-2a9b-4b07-9d36-1b6d3a2b0f1e"}
+//	}
+//
+// Spans are queued and reported asynchronously.  They are dropped if the
+// queue is full or if the collector cannot be reached.
+//
+// A nil *Tracer is valid and records nothing, as are the nil spans it
+// returns, so callers do not need to check whether tracing is enabled.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var queueLength = 1024
+
+var batchSize = 100
+
+var flushInterval = time.Second
+
+var postTimeout = 5 * time.Second
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// Span records a single operation of a trace.
+type Span struct {
+	tracer   *Tracer
+	context  SpanContext
+	parentID string
+	name     string
+	service  string
+	start    time.Time
+	tags     map[string]string
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// Tracer creates spans and reports them to a collector once they are
+// finished.
+type Tracer struct {
+	collector string
+	service   string
+	client    *http.Client
+	queue     chan zipkinSpan
+	wg        sync.WaitGroup
+}
+
+// NewTracer creates a Tracer which reports the spans of service to the
+// collector endpoint identified by rawURL.
+func NewTracer(service, rawURL string) (*Tracer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid tracing collector URL %s: %v", rawURL, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Unsupported tracing collector URL scheme %q", u.Scheme)
+	}
+
+	t := &Tracer{
+		collector: u.String(),
+		service:   service,
+		client:    &http.Client{Timeout: postTimeout},
+		queue:     make(chan zipkinSpan, queueLength),
+	}
+
+	t.wg.Add(1)
+	go t.run()
+
+	return t, nil
+}
+
+// Close reports any queued spans.  Spans must not be finished after Close.
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+
+	close(t.queue)
+	t.wg.Wait()
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// TraceIDFromUUID returns the ID of a trace named after a UUID, so that
+// the trace of an object, e.g., an instance, can be looked up by its UUID.
+func TraceIDFromUUID(uuid string) string {
+	id := make([]byte, 0, 32)
+	for i := 0; i < len(uuid); i++ {
+		if uuid[i] != '-' {
+			id = append(id, uuid[i])
+		}
+	}
+	return string(id)
+}
+
+// StartSpan starts a span of the tracer's service.  The span is a child of
+// the span held by ctx, if any, and the returned context holds the new
+// span.
+func (t *Tracer) StartSpan(ctx context.Context, name string) (*Span, context.Context) {
+	if t == nil {
+		return nil, ctx
+	}
+
+	var parent SpanContext
+	if p := FromContext(ctx); p != nil {
+		parent = p.context
+	}
+
+	s := t.StartSpanAt(parent, name, t.service, time.Now())
+	return s, context.WithValue(ctx, spanKey{}, s)
+}
+
+// StartSpanAt starts a span of service at a given time.  The span is a child
+// of parent, unless parent has no SpanID, in which case it is a root span.
+// A new trace is started if parent has no TraceID.  This allows spans to be
+// recorded after the fact from timestamps collected elsewhere.
+func (t *Tracer) StartSpanAt(parent SpanContext, name, service string, start time.Time) *Span {
+	if t == nil {
+		return nil
+	}
+
+	traceID := parent.TraceID
+	if traceID == "" {
+		traceID = newID(16)
+	}
+
+	return &Span{
+		tracer:   t,
+		context:  SpanContext{TraceID: traceID, SpanID: newID(8)},
+		parentID: parent.SpanID,
+		name:     name,
+		service:  service,
+		start:    start,
+		tags:     make(map[string]string),
+	}
+}
+
+// Context returns the SpanContext of the span, which can be used to start
+// child spans.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetTag annotates the span with a key value pair.
+func (s *Span) SetTag(key, value string) {
+	if s == nil {
+		return
+	}
+	s.tags[key] = value
+}
+
+// Finish ends the span and queues it to be reported.
+func (s *Span) Finish() {
+	s.FinishAt(time.Now())
+}
+
+// FinishAt ends the span at a given time and queues it to be reported.  It
+// never blocks.
+func (s *Span) FinishAt(end time.Time) {
+	if s == nil {
+		return
+	}
+
+	zs := zipkinSpan{
+		TraceID:       s.context.TraceID,
+		ID:            s.context.SpanID,
+		ParentID:      s.parentID,
+		Name:          s.name,
+		Timestamp:     s.start.UnixNano() / int64(time.Microsecond),
+		Duration:      int64(end.Sub(s.start) / time.Microsecond),
+		LocalEndpoint: zipkinEndpoint{ServiceName: s.service},
+		Tags:          s.tags,
+	}
+
+	select {
+	case s.tracer.queue <- zs:
+	default:
+		glog.Warningf("Tracing queue full, dropping %s span", s.name)
+	}
+}
+
+type spanKey struct{}
+
+// FromContext returns the span held by ctx or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func (t *Tracer) run() {
+	defer t.wg.Done()
+
+	var batch []zipkinSpan
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				t.report(batch)
+				return
+			}
+
+			batch = append(batch, s)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		t.report(batch)
+		batch = nil
+	}
+}
+
+func (t *Tracer) report(batch []zipkinSpan) {
+	if len(batch) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		glog.Warningf("Unable to marshal %d spans: %v", len(batch), err)
+		return
+	}
+
+	resp, err := t.client.Post(t.collector, "application/json", bytes.NewReader(data))
+	if err != nil {
+		glog.Warningf("Unable to report %d spans: %v", len(batch), err)
+		return
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		glog.Warningf("Unable to report %d spans: %s", len(batch), resp.Status)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCollector records the spans reported to it.
+type fakeCollector struct {
+	sync.Mutex
+	spans []zipkinSpan
+}
+
+func (fc *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var spans []zipkinSpan
+	if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fc.Lock()
+	fc.spans = append(fc.spans, spans...)
+	fc.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func TestNewTracer(t *testing.T) {
+	for _, u := range []string{"nats://localhost:4222", ":foo"} {
+		if _, err := NewTracer("test", u); err == nil {
+			t.Errorf("Expected error creating tracer for %s", u)
+		}
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+
+	span, ctx := tracer.StartSpan(context.Background(), "nil")
+	span.SetTag("key", "value")
+	span.Finish()
+
+	if span != nil || FromContext(ctx) != nil {
+		t.Errorf("Expected nil tracer to create nil spans")
+	}
+
+	if tracer.StartSpanAt(SpanContext{}, "nil", "test", time.Now()) != nil {
+		t.Errorf("Expected nil tracer to create nil spans")
+	}
+
+	tracer.Close()
+}
+
+func TestSpans(t *testing.T) {
+	fc := &fakeCollector{}
+	server := httptest.NewServer(fc)
+	defer server.Close()
+
+	tracer, err := NewTracer("test", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, ctx := tracer.StartSpan(context.Background(), "root")
+	if FromContext(ctx) != root {
+		t.Errorf("Span not found in context")
+	}
+
+	child, _ := tracer.StartSpan(ctx, "child")
+	child.SetTag("key", "value")
+	child.Finish()
+	root.Finish()
+
+	start := time.Date(2017, 6, 12, 10, 13, 23, 0, time.UTC)
+	traceID := TraceIDFromUUID("d1f3c6a4-2a9b-4b07-9d36-1b6d3a2b0f1e")
+	frame := tracer.StartSpanAt(SpanContext{TraceID: traceID}, "frame", "other", start)
+	frame.FinishAt(start.Add(15 * time.Millisecond))
+
+	tracer.Close()
+
+	if len(fc.spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(fc.spans))
+	}
+
+	c, r, f := fc.spans[0], fc.spans[1], fc.spans[2]
+	if c.TraceID != r.TraceID || c.ParentID != r.ID || r.ParentID != "" {
+		t.Errorf("Child span %+v does not belong to root span %+v", c, r)
+	}
+
+	if c.Tags["key"] != "value" || c.LocalEndpoint.ServiceName != "test" {
+		t.Errorf("Unexpected child span %+v", c)
+	}
+
+	if f.TraceID != "d1f3c6a42a9b4b079d361b6d3a2b0f1e" || f.ParentID != "" ||
+		f.LocalEndpoint.ServiceName != "other" ||
+		f.Timestamp != start.UnixNano()/1000 || f.Duration != 15000 {
+		t.Errorf("Unexpected frame span %+v", f)
+	}
+}
@@ -84,6 +84,10 @@ func listTenantQuotas(c *controller, w http.ResponseWriter, r *http.Request) (AP
 	return getResources(c, w, r)
 }
 
+func updateTenantQuotas(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return updateResources(c, w, r)
+}
+
 func listTenantResources(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	return getUsage(c, w, r)
 }
@@ -107,6 +111,14 @@ func legacyListNetworkNodes(c *controller, w http.ResponseWriter, r *http.Reques
 	return listNetworkNodes(c, w, r)
 }
 
+func legacyShowNode(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return showNode(c, w, r)
+}
+
+func legacyEvacuateNode(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return evacuateNode(c, w, r)
+}
+
 func legacyListNodeServers(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	return listNodeServers(c, w, r)
 }
@@ -135,6 +147,14 @@ func legacyClearEvents(c *controller, w http.ResponseWriter, r *http.Request) (A
 	return clearEvents(c, w, r)
 }
 
+func legacyDeleteTenant(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return deleteTenant(c, w, r)
+}
+
+func legacyGetEventRetention(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return getEventRetention(c, w, r)
+}
+
 func legacyTraceData(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	return traceData(c, w, r)
 }
@@ -148,6 +168,11 @@ func legacyComputeRoutes(ctl *controller, r *mux.Router) *mux.Router {
 
 	r.Handle("/v2.1/{tenant}/quotas",
 		legacyAPIHandler{ctl, listTenantQuotas, false}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/quotas",
+		legacyAPIHandler{ctl, updateTenantQuotas, true}).Methods("PUT")
+
+	r.Handle("/v2.1/tenants/{tenant}",
+		legacyAPIHandler{ctl, legacyDeleteTenant, true}).Methods("DELETE")
 
 	r.Handle("/v2.1/nodes",
 		legacyAPIHandler{ctl, legacyListNodes, true}).Methods("GET")
@@ -157,6 +182,10 @@ func legacyComputeRoutes(ctl *controller, r *mux.Router) *mux.Router {
 		legacyAPIHandler{ctl, legacyListComputeNodes, true}).Methods("GET")
 	r.Handle("/v2.1/nodes/network",
 		legacyAPIHandler{ctl, legacyListNetworkNodes, true}).Methods("GET")
+	r.Handle("/v2.1/nodes/{node}",
+		legacyAPIHandler{ctl, legacyShowNode, true}).Methods("GET")
+	r.Handle("/v2.1/nodes/{node}/evacuate",
+		legacyAPIHandler{ctl, legacyEvacuateNode, true}).Methods("POST")
 
 	r.Handle("/v2.1/cncis",
 		legacyAPIHandler{ctl, legacyListCNCIs, true}).Methods("GET")
@@ -167,13 +196,21 @@ func legacyComputeRoutes(ctl *controller, r *mux.Router) *mux.Router {
 		legacyAPIHandler{ctl, legacyListEvents, true}).Methods("GET")
 	r.Handle("/v2.1/events",
 		legacyAPIHandler{ctl, legacyClearEvents, true}).Methods("DELETE")
+	r.Handle("/v2.1/events/retention",
+		legacyAPIHandler{ctl, legacyGetEventRetention, true}).Methods("GET")
 	r.Handle("/v2.1/{tenant}/events",
 		legacyAPIHandler{ctl, legacyListTenantEvents, false}).Methods("GET")
+	r.Handle("/v2.1/events/stream",
+		eventStreamHandler{ctl, true}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/events/stream",
+		eventStreamHandler{ctl, false}).Methods("GET")
 
 	r.Handle("/v2.1/traces",
 		legacyAPIHandler{ctl, legacyListTraces, true}).Methods("GET")
 	r.Handle("/v2.1/traces/{label}",
 		legacyAPIHandler{ctl, legacyTraceData, true}).Methods("GET")
+	r.Handle("/v2.1/traces/{label}/frames",
+		legacyAPIHandler{ctl, traceFrames, true}).Methods("GET")
 
 	return r
 }
@@ -28,10 +28,13 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/api"
 	"github.com/ciao-project/ciao/ciao-controller/internal/datastore"
+	"github.com/ciao-project/ciao/ciao-controller/internal/notify"
 	"github.com/ciao-project/ciao/ciao-controller/internal/quotas"
+	"github.com/ciao-project/ciao/ciao-controller/internal/tracing"
 	storage "github.com/ciao-project/ciao/ciao-storage"
 	"github.com/ciao-project/ciao/clogger/gloginterface"
 	"github.com/ciao-project/ciao/database"
@@ -53,8 +56,20 @@ type controller struct {
 	apiURL              string
 	tenantReadiness     map[string]*tenantConfirmMemo
 	tenantReadinessLock sync.Mutex
+	imageDataLock       sync.Mutex
+	imageUploadLock     sync.Mutex
+	reservedIPsLock     sync.Mutex
+	metadataLock        sync.Mutex
 	qs                  *quotas.Quotas
 	httpServers         []*http.Server
+	eventPruner         eventPruner
+	instanceReaper      instanceReaper
+	migrations          map[string]migration
+	migrationsLock      sync.Mutex
+	pendingDeletes      map[string]pendingDelete
+	pendingDeletesLock  sync.Mutex
+	certs               *certReloader
+	tracer              *tracing.Tracer
 }
 
 type cnciNetFlag string
@@ -78,7 +93,10 @@ var cert = flag.String("cert", "", "Client certificate")
 var caCert = flag.String("cacert", "", "CA certificate")
 var serverURL = flag.String("url", "", "Server URL")
 var prepare = flag.Bool("osprepare", false, "Install dependencies")
+var verifyDeps = flag.Bool("osprepare-verify", false, "Report missing dependencies as JSON without installing them")
+var pkgDir = flag.String("osprepare-pkgdir", "", "Install dependencies from a local package directory")
 var controllerAPIPort = api.Port
+var controllerAPIBindAddress = flag.String("api_bind_address", "", "address or interface on which the ciao API listens, overrides ciao_bind_address in the cluster configuration")
 var httpsCAcert = "/etc/pki/ciao/ciao-controller-cacert.pem"
 var httpsKey = "/etc/pki/ciao/ciao-controller-key.pem"
 var workloadsPath = flag.String("workloads_path", "/var/lib/ciao/data/controller/workloads", "path to yaml files")
@@ -89,6 +107,19 @@ var clientCertCAPath = "/etc/pki/ciao/auth-CA.pem"
 
 var cephID = flag.String("ceph_id", "", "ceph client id")
 
+var notifyURL = flag.String("notify_url", "", "publish instance and node notifications to this NATS server, e.g., nats://localhost:4222")
+var notifySubject = flag.String("notify_subject_prefix", notify.DefaultSubjectPrefix, "prefix of the subjects on which notifications are published")
+
+var tracingCollector = flag.String("tracing_collector", "", "report trace spans to the Zipkin compatible endpoint of this Jaeger collector, e.g., http://localhost:9411/api/v2/spans")
+
+var eventsMaxAge = flag.Duration("events_max_age", 0, "remove events older than this from the event log, 0 to keep them all")
+var eventsMaxRows = flag.Int("events_max_rows", 0, "maximum number of events kept per tenant, 0 for no limit")
+var httpsCertCheckInterval = flag.Duration("https_cert_check_interval", time.Minute, "interval at which the HTTPS certificate and key are checked for changes, 0 to only reload them on SIGHUP")
+var eventsPruneInterval = flag.Duration("events_prune_interval", 10*time.Minute, "interval at which the event log retention policy is enforced")
+var deferredDeleteWindow = flag.Duration("deferred_delete_window", 0, "keep deleted instances stopped and restorable for this long before deleting them, 0 to delete them immediately")
+var deferredDeleteInterval = flag.Duration("deferred_delete_interval", time.Minute, "interval at which instances whose deferred delete window has passed, or which have expired, are deleted")
+var asyncImageConversion = flag.Bool("async_image_conversion", false, "convert uploaded images to the format of the storage backend in the background, rather than before the upload completes")
+
 var adminSSHKey = ""
 
 // this default allows us to have up to 32K hosts within the upper part
@@ -146,10 +177,36 @@ func getNameFromCert(httpsCAcert, httpsKey string) (string, error) {
 }
 
 func main() {
+	if *verifyDeps {
+		reqs := osprepare.NewPackageRequirements()
+		reqs.Append(osprepare.BootstrapRequirements)
+		reqs.Append(controllerDeps)
+		if err := osprepare.ReportMissingDeps(os.Stdout, reqs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *prepare {
 		logger := gloginterface.CiaoGlogLogger{}
-		osprepare.Bootstrap(context.TODO(), logger)
-		osprepare.InstallDeps(context.TODO(), controllerDeps, logger)
+		var err error
+		if *pkgDir != "" {
+			err = osprepare.BootstrapFromDir(context.TODO(), *pkgDir, logger)
+			if err == nil {
+				err = osprepare.InstallDepsFromDir(context.TODO(), controllerDeps, *pkgDir, logger)
+			}
+		} else {
+			err = osprepare.Bootstrap(context.TODO(), logger)
+			if err == nil {
+				err = osprepare.InstallDeps(context.TODO(), controllerDeps, logger)
+			}
+		}
+		glog.Flush()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
 
@@ -166,12 +223,43 @@ func main() {
 		InitWorkloadsPath: *workloadsPath,
 	}
 
+	if *notifyURL != "" {
+		publisher, err := notify.NewPublisher(*notifyURL, *notifySubject)
+		if err != nil {
+			glog.Fatalf("Unable to create notification publisher: %v", err)
+			return
+		}
+		defer publisher.Close()
+		dsConfig.Notifier = publisher
+	}
+
+	if *tracingCollector != "" {
+		ctl.tracer, err = tracing.NewTracer("ciao-controller", *tracingCollector)
+		if err != nil {
+			glog.Fatalf("Unable to create tracer: %v", err)
+			return
+		}
+		defer ctl.tracer.Close()
+	}
+
 	err = ctl.ds.Init(dsConfig)
 	if err != nil {
 		glog.Fatalf("unable to Init datastore: %s", err)
 		return
 	}
 
+	ctl.eventPruner = eventPruner{
+		maxAge:   *eventsMaxAge,
+		maxRows:  *eventsMaxRows,
+		interval: *eventsPruneInterval,
+	}
+	ctl.startEventPruning()
+
+	ctl.instanceReaper = instanceReaper{
+		window:   *deferredDeleteWindow,
+		interval: *deferredDeleteInterval,
+	}
+
 	ctl.qs.Init()
 	err = populateQuotasFromDatastore(ctl.qs, ctl.ds)
 	if err != nil {
@@ -201,6 +289,9 @@ func main() {
 	}
 
 	controllerAPIPort = clusterConfig.Configure.Controller.CiaoPort
+	if *controllerAPIBindAddress == "" {
+		*controllerAPIBindAddress = clusterConfig.Configure.Controller.CiaoBindAddress
+	}
 	httpsCAcert = clusterConfig.Configure.Controller.HTTPSCACert
 	httpsKey = clusterConfig.Configure.Controller.HTTPSKey
 	if *cephID == "" {
@@ -242,6 +333,8 @@ func main() {
 		return
 	}
 
+	ctl.startInstanceReaper()
+
 	host, err := getNameFromCert(httpsCAcert, httpsKey)
 	if err != nil {
 		glog.Warningf("Unable to get name from certificate: %s", err)
@@ -250,6 +343,15 @@ func main() {
 
 	ctl.apiURL = fmt.Sprintf("https://%s:%d", host, controllerAPIPort)
 
+	ctl.certs, err = newCertReloader(httpsCAcert, httpsKey, *httpsCertCheckInterval)
+	if err != nil {
+		glog.Fatalf("Error loading HTTPS certificate: %v", err)
+	}
+
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	ctl.certs.start(reloadCh)
+
 	server, err := ctl.createCiaoServer()
 	if err != nil {
 		glog.Fatalf("Error creating ciao server: %v", err)
@@ -268,7 +370,7 @@ func main() {
 	for _, server := range ctl.httpServers {
 		wg.Add(1)
 		go func(server *http.Server) {
-			if err := server.ListenAndServeTLS(httpsCAcert, httpsKey); err != http.ErrServerClosed {
+			if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
 				glog.Errorf("Error from HTTP server: %v", err)
 			}
 			wg.Done()
@@ -277,6 +379,10 @@ func main() {
 
 	wg.Wait()
 	glog.Warning("Controller shutdown initiated")
+	ctl.stopInstanceReaper()
+	ctl.stopEventPruning()
+	signal.Stop(reloadCh)
+	ctl.certs.shutdown()
 	ctl.qs.Shutdown()
 	ctl.ds.Exit()
 	ctl.client.Disconnect()
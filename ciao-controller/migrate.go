@@ -0,0 +1,187 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// migration records an instance being cold migrated.  The instance is
+// stopped on its node and, once its launcher reports it stopped, restarted
+// on any other node.
+type migration struct {
+	tenantID  string
+	nodeID    string
+	requestID string
+}
+
+// addMigration records that an instance is about to be stopped on its node
+// to be restarted on another one.
+func (c *controller) addMigration(i *types.Instance, requestID string) error {
+	c.migrationsLock.Lock()
+	defer c.migrationsLock.Unlock()
+
+	if _, ok := c.migrations[i.ID]; ok {
+		return errors.New("Instance already being migrated")
+	}
+	if c.migrations == nil {
+		c.migrations = make(map[string]migration)
+	}
+	c.migrations[i.ID] = migration{
+		tenantID:  i.TenantID,
+		nodeID:    i.NodeID,
+		requestID: requestID,
+	}
+
+	_ = c.ds.LogRequestEvent(i.TenantID, requestID,
+		fmt.Sprintf("Migrating instance %s from node %s", i.ID, i.NodeID))
+
+	return nil
+}
+
+// cancelMigration forgets about the migration of an instance that could
+// not be stopped or that is being deleted, so that it is not restarted the
+// next time it stops.
+func (c *controller) cancelMigration(instanceID string, err error) {
+	c.migrationsLock.Lock()
+	m, ok := c.migrations[instanceID]
+	delete(c.migrations, instanceID)
+	c.migrationsLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	_ = c.ds.LogRequestError(m.tenantID, m.requestID,
+		fmt.Sprintf("Unable to migrate instance %s from node %s: %v", instanceID, m.nodeID, err))
+}
+
+// cancelNodeMigrations forgets about the migrations of the instances of a
+// node which has disconnected before stopping them.
+func (c *controller) cancelNodeMigrations(nodeID string, err error) {
+	var instances []string
+
+	c.migrationsLock.Lock()
+	for id, m := range c.migrations {
+		if m.nodeID == nodeID {
+			instances = append(instances, id)
+		}
+	}
+	c.migrationsLock.Unlock()
+
+	for _, id := range instances {
+		c.cancelMigration(id, err)
+	}
+}
+
+// migrateInstance stops a running instance so that it can be restarted on
+// another node.  The migration completes asynchronously.
+func (c *controller) migrateInstance(i *types.Instance, requestID string) error {
+	if i.NodeID == "" {
+		return types.ErrInstanceNotAssigned
+	}
+
+	if i.State != payloads.ComputeStatusRunning {
+		return errors.New("You may only migrate running instances")
+	}
+
+	if _, deleted := c.ds.GetInstanceDeletedAt(i.ID); deleted {
+		return types.ErrInstanceDeleted
+	}
+
+	if err := c.addMigration(i, requestID); err != nil {
+		return err
+	}
+
+	go func(instanceID string, nodeID string) {
+		if err := c.client.StopInstance(instanceID, nodeID, requestID); err != nil {
+			glog.Warningf("Error stopping instance %s for migration: %v", instanceID, err)
+			c.cancelMigration(instanceID, err)
+		}
+	}(i.ID, i.NodeID)
+
+	return nil
+}
+
+// evacuateNode puts a node in maintenance, which stops all its instances.
+// The instances that were running are restarted on other nodes.  The
+// result of the migration of each of them is logged as an event of its
+// tenant.
+func (c *controller) evacuateNode(nodeID string) error {
+	instances, err := c.ds.GetAllInstancesByNode(nodeID)
+	if err != nil {
+		return err
+	}
+
+	var migrating []string
+	for _, i := range instances {
+		if i.State != payloads.ComputeStatusRunning {
+			continue
+		}
+
+		if _, deleted := c.ds.GetInstanceDeletedAt(i.ID); deleted {
+			continue
+		}
+
+		if err := c.addMigration(i, ""); err != nil {
+			glog.Warningf("Not migrating instance %s off node %s: %v", i.ID, nodeID, err)
+			continue
+		}
+		migrating = append(migrating, i.ID)
+	}
+
+	glog.Infof("Evacuating node %s, migrating %d instance(s)", nodeID, len(migrating))
+
+	go func() {
+		if err := c.client.EvacuateNode(nodeID); err != nil {
+			glog.Warningf("Error evacuating node %s: %v", nodeID, err)
+			for _, id := range migrating {
+				c.cancelMigration(id, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// completeMigration restarts an instance stopped to be migrated on any node
+// but the one it was stopped on.  It does nothing for the other instances.
+func (c *controller) completeMigration(instanceID string) {
+	c.migrationsLock.Lock()
+	m, ok := c.migrations[instanceID]
+	delete(c.migrations, instanceID)
+	c.migrationsLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	err := c.restartInstanceExcluding(instanceID, m.nodeID, m.requestID)
+	if err != nil {
+		glog.Warningf("Error restarting migrated instance %s: %v", instanceID, err)
+		_ = c.ds.LogRequestError(m.tenantID, m.requestID,
+			fmt.Sprintf("Unable to restart instance %s migrated from node %s: %v", instanceID, m.nodeID, err))
+		return
+	}
+
+	glog.Infof("Restarting instance %s migrated from node %s", instanceID, m.nodeID)
+	_ = c.ds.LogRequestEvent(m.tenantID, m.requestID,
+		fmt.Sprintf("Restarting instance %s migrated from node %s", instanceID, m.nodeID))
+}
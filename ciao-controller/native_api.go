@@ -0,0 +1,174 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/gorilla/mux"
+)
+
+// nativeAPIPrefix is the path under which the ciao native API is served.
+// The native API exposes the ciao resources, along with the cluster
+// resources only available through the /v2.1 compatibility API, with
+// consistent schemas and pagination.
+const nativeAPIPrefix = "/ciao/v1"
+
+// pageBounds returns the bounds of the page of a list of n items requested
+// by the limit, offset and marker query parameters of r.  id returns the ID
+// of the i-th item, the list being sorted by ID, it may be nil for lists
+// that cannot be paged by marker.
+func pageBounds(r *http.Request, n int, id func(i int) string) (int, int, error) {
+	limit, start, marker := pagerQueryParse(r)
+
+	if marker != "" {
+		if id == nil {
+			return 0, 0, fmt.Errorf("Marker not supported")
+		}
+
+		start = markerIndex(n, id, marker)
+		if start == -1 {
+			return 0, 0, fmt.Errorf("Item %s not found", marker)
+		}
+	}
+
+	if start < 0 || start > n {
+		start = n
+	}
+
+	end := n
+	if limit > 0 && start+limit < n {
+		end = start + limit
+	}
+
+	return start, end, nil
+}
+
+func nativeListCNCIs(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	resp, err := listCNCIs(c, w, r)
+	if err != nil {
+		return resp, err
+	}
+
+	cncis := resp.response.(types.CiaoCNCIs)
+	sort.Slice(cncis.CNCIs, func(i, j int) bool {
+		return cncis.CNCIs[i].ID < cncis.CNCIs[j].ID
+	})
+
+	start, end, err := pageBounds(r, len(cncis.CNCIs), func(i int) string {
+		return cncis.CNCIs[i].ID
+	})
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+	cncis.CNCIs = cncis.CNCIs[start:end]
+
+	return APIResponse{http.StatusOK, cncis}, nil
+}
+
+func nativeListTraces(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	resp, err := listTraces(c, w, r)
+	if err != nil {
+		return resp, err
+	}
+
+	traces := resp.response.(types.CiaoTracesSummary)
+	sort.Slice(traces.Summaries, func(i, j int) bool {
+		return traces.Summaries[i].Label < traces.Summaries[j].Label
+	})
+
+	start, end, err := pageBounds(r, len(traces.Summaries), func(i int) string {
+		return traces.Summaries[i].Label
+	})
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+	traces.Summaries = traces.Summaries[start:end]
+
+	return APIResponse{http.StatusOK, traces}, nil
+}
+
+func nativeListEvents(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	resp, err := listEvents(c, w, r)
+	if err != nil {
+		return resp, err
+	}
+
+	// Events have no ID so they can only be paged by offset
+	events := resp.response.(types.CiaoEvents)
+	start, end, err := pageBounds(r, len(events.Events), nil)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+	events.Events = events.Events[start:end]
+
+	return APIResponse{http.StatusOK, events}, nil
+}
+
+func nativeClusterRoutes(ctl *controller, r *mux.Router) *mux.Router {
+	r.Handle("/nodes",
+		legacyAPIHandler{ctl, listNodes, true}).Methods("GET")
+	r.Handle("/nodes/compute",
+		legacyAPIHandler{ctl, listComputeNodes, true}).Methods("GET")
+	r.Handle("/nodes/network",
+		legacyAPIHandler{ctl, listNetworkNodes, true}).Methods("GET")
+	r.Handle("/nodes/{node}",
+		legacyAPIHandler{ctl, showNode, true}).Methods("GET")
+	r.Handle("/nodes/{node}/instances",
+		legacyAPIHandler{ctl, listNodeServers, true}).Methods("GET")
+
+	r.Handle("/cncis",
+		legacyAPIHandler{ctl, nativeListCNCIs, true}).Methods("GET")
+	r.Handle("/cncis/{cnci}",
+		legacyAPIHandler{ctl, listCNCIDetails, true}).Methods("GET")
+
+	r.Handle("/events",
+		legacyAPIHandler{ctl, nativeListEvents, true}).Methods("GET")
+	r.Handle("/events",
+		legacyAPIHandler{ctl, clearEvents, true}).Methods("DELETE")
+	r.Handle("/events/retention",
+		legacyAPIHandler{ctl, getEventRetention, true}).Methods("GET")
+	r.Handle("/events/stream",
+		eventStreamHandler{ctl, true}).Methods("GET")
+	r.Handle("/{tenant}/events",
+		legacyAPIHandler{ctl, nativeListEvents, false}).Methods("GET")
+	r.Handle("/{tenant}/events/stream",
+		eventStreamHandler{ctl, false}).Methods("GET")
+
+	r.Handle("/traces",
+		legacyAPIHandler{ctl, nativeListTraces, true}).Methods("GET")
+	r.Handle("/traces/{label}",
+		legacyAPIHandler{ctl, traceData, true}).Methods("GET")
+	r.Handle("/traces/{label}/frames",
+		legacyAPIHandler{ctl, traceFrames, true}).Methods("GET")
+
+	return r
+}
+
+// createNativeRoutes serves the ciao API, along with the cluster resources
+// of the compute API, under nativeAPIPrefix.  The routes of the ciao API
+// also remain available at the root for existing clients.
+func (c *controller) createNativeRoutes(r *mux.Router) {
+	s := r.PathPrefix(nativeAPIPrefix).Subrouter()
+
+	nativeClusterRoutes(c, s)
+
+	config := api.Config{URL: c.apiURL + nativeAPIPrefix, CiaoService: c}
+	api.Routes(config, s)
+}
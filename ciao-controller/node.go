@@ -18,12 +18,7 @@ import "github.com/golang/glog"
 
 func (c *controller) EvacuateNode(nodeID string) error {
 	// should I bother to see if nodeID is valid?
-	go func() {
-		if err := c.client.EvacuateNode(nodeID); err != nil {
-			glog.Warningf("Error evacuating node")
-		}
-	}()
-	return nil
+	return c.evacuateNode(nodeID)
 }
 
 func (c *controller) RestoreNode(nodeID string) error {
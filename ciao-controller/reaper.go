@@ -0,0 +1,322 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+// instanceReaper finalizes the deletion of soft deleted instances once
+// their deferred delete window has passed, and deletes the instances which
+// have expired.
+type instanceReaper struct {
+	window   time.Duration
+	interval time.Duration
+
+	// expired holds the outcome of the last attempt to delete each
+	// expired instance, an empty string on success, so that deletions
+	// which are retried are only logged when their outcome changes.
+	expired map[string]string
+
+	// deleting holds the node of each instance the reaper has sent a
+	// DELETE for.  The DELETE is only resent once the node reports that
+	// it failed or reconnects, rather than on every run.
+	deleting     map[string]string
+	deletingLock sync.Mutex
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (r *instanceReaper) enabled() bool {
+	return r.window > 0
+}
+
+// markDeleting records that a DELETE is being sent for an instance running
+// on nodeID.  It returns false if one is already in flight.
+func (r *instanceReaper) markDeleting(instanceID string, nodeID string) bool {
+	r.deletingLock.Lock()
+	defer r.deletingLock.Unlock()
+
+	if _, ok := r.deleting[instanceID]; ok {
+		return false
+	}
+
+	if r.deleting == nil {
+		r.deleting = make(map[string]string)
+	}
+	r.deleting[instanceID] = nodeID
+
+	return true
+}
+
+// deleteFailed allows the DELETE of an instance to be resent.
+func (r *instanceReaper) deleteFailed(instanceID string) {
+	r.deletingLock.Lock()
+	delete(r.deleting, instanceID)
+	r.deletingLock.Unlock()
+}
+
+// nodeReconnected allows the DELETEs sent to a node to be resent, as they
+// may have been lost while the node was disconnected.
+func (r *instanceReaper) nodeReconnected(nodeID string) {
+	r.deletingLock.Lock()
+	defer r.deletingLock.Unlock()
+
+	for instanceID, n := range r.deleting {
+		if n == nodeID {
+			delete(r.deleting, instanceID)
+		}
+	}
+}
+
+// forgetDeletes drops the DELETEs in flight for the instances that are no
+// longer to be reaped, i.e., which have been removed or restored.
+func (r *instanceReaper) forgetDeletes(reaped func(instanceID string) bool) {
+	r.deletingLock.Lock()
+	defer r.deletingLock.Unlock()
+
+	for instanceID := range r.deleting {
+		if !reaped(instanceID) {
+			delete(r.deleting, instanceID)
+		}
+	}
+}
+
+// startInstanceReaper launches the background job that deletes instances
+// whose deferred delete window has passed or which have expired.
+func (c *controller) startInstanceReaper() {
+	r := &c.instanceReaper
+	if !r.enabled() {
+		glog.Info("Deferred instance deletion disabled")
+	} else if r.interval <= 0 || r.interval > r.window {
+		r.interval = r.window
+	}
+
+	if r.interval <= 0 {
+		r.interval = time.Minute
+	}
+
+	if r.enabled() {
+		glog.Infof("Deleting instances %v after they are deleted, checking every %v",
+			r.window, r.interval)
+	}
+	glog.Infof("Deleting expired instances, checking every %v", r.interval)
+
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			c.forgetReapedInstances()
+			if r.enabled() {
+				c.reapInstances()
+			}
+			c.reapExpiredInstances()
+
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *controller) stopInstanceReaper() {
+	r := &c.instanceReaper
+	if r.stop == nil {
+		return
+	}
+
+	close(r.stop)
+	r.wg.Wait()
+	r.stop = nil
+}
+
+// forgetReapedInstances stops tracking the DELETEs of the instances which
+// are neither soft deleted nor expired anymore.
+func (c *controller) forgetReapedInstances() {
+	deleted := c.ds.GetDeletedInstances()
+	expiries := c.ds.GetInstanceExpiries()
+
+	c.instanceReaper.forgetDeletes(func(instanceID string) bool {
+		_, isDeleted := deleted[instanceID]
+		_, isExpiring := expiries[instanceID]
+		return isDeleted || isExpiring
+	})
+}
+
+// reapInstance sends the DELETE of an instance unless one is already in
+// flight.
+func (c *controller) reapInstance(instanceID string) error {
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return err
+	}
+
+	nodeID := i.NodeID
+	if nodeID == "" {
+		nodeID = i.LastNodeID
+	}
+
+	if !c.instanceReaper.markDeleting(instanceID, nodeID) {
+		return nil
+	}
+
+	glog.Infof("Reaping instance %s", instanceID)
+	err = c.deleteInstance(instanceID, "")
+	if err != nil {
+		c.instanceReaper.deleteFailed(instanceID)
+	}
+
+	return err
+}
+
+func (c *controller) reapInstances() {
+	now := time.Now()
+
+	for instanceID, deletedAt := range c.ds.GetDeletedInstances() {
+		if now.Before(deletedAt.Add(c.instanceReaper.window)) {
+			continue
+		}
+
+		if err := c.reapInstance(instanceID); err != nil {
+			glog.Warningf("Unable to delete instance %s: %v", instanceID, err)
+		}
+	}
+}
+
+// reapExpiredInstances deletes the instances whose time to live has
+// passed, logging an event for each of them.  The expiry of an instance is
+// only cleared once the instance is removed from the datastore, so its
+// deletion is retried until it succeeds.
+func (c *controller) reapExpiredInstances() {
+	r := &c.instanceReaper
+	now := time.Now()
+	expiries := c.ds.GetInstanceExpiries()
+
+	for instanceID := range r.expired {
+		if _, ok := expiries[instanceID]; !ok {
+			delete(r.expired, instanceID)
+		}
+	}
+
+	for instanceID, expiresAt := range expiries {
+		if now.Before(expiresAt) {
+			continue
+		}
+
+		i, err := c.ds.GetInstance(instanceID)
+		if err != nil {
+			continue
+		}
+
+		err = c.reapInstance(instanceID)
+		if err == types.ErrInstanceNotAssigned {
+			// not running on any node yet, try again later
+			continue
+		}
+
+		outcome := ""
+		if err != nil {
+			outcome = err.Error()
+		}
+		if last, ok := r.expired[instanceID]; ok && last == outcome {
+			continue
+		}
+		if r.expired == nil {
+			r.expired = make(map[string]string)
+		}
+		r.expired[instanceID] = outcome
+
+		if err != nil {
+			glog.Warningf("Unable to delete expired instance %s: %v", instanceID, err)
+			_ = c.ds.LogError(i.TenantID, fmt.Sprintf("Unable to delete instance %s expired at %s, retrying: %v",
+				instanceID, expiresAt.Format(time.RFC3339), err))
+			continue
+		}
+
+		glog.Infof("Instance %s expired at %s", instanceID, expiresAt.Format(time.RFC3339))
+		msg := fmt.Sprintf("Instance %s expired at %s, deleting it", instanceID, expiresAt.Format(time.RFC3339))
+		if err := c.ds.LogEvent(i.TenantID, msg); err != nil {
+			glog.Warningf("Unable to log expiry of instance %s: %v", instanceID, err)
+		}
+	}
+}
+
+// softDeleteInstance stops an instance and marks it as deleted.  It is
+// deleted for good by the reaper unless it is restored within the deferred
+// delete window.  Instances which cannot be stopped are deleted immediately.
+func (c *controller) softDeleteInstance(i *types.Instance, requestID string) error {
+	// the instance must be deletable by the reaper
+	IPs := c.ds.GetMappedIPs(&i.TenantID)
+	for _, m := range IPs {
+		if m.InstanceID == i.ID {
+			return types.ErrInstanceMapped
+		}
+	}
+
+	i.StateLock.RLock()
+	state := i.State
+	i.StateLock.RUnlock()
+
+	switch state {
+	case payloads.Running:
+		if err := c.stopInstance(i.ID, requestID); err != nil {
+			return err
+		}
+	case payloads.Exited:
+	default:
+		return c.deleteInstance(i.ID, requestID)
+	}
+
+	if err := c.ds.SoftDeleteInstance(i.ID); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("Instance %s deleted, it can be restored until %s", i.ID,
+		time.Now().Add(c.instanceReaper.window).Format(time.RFC3339))
+	if err := c.ds.LogEvent(i.TenantID, msg); err != nil {
+		glog.Warningf("Unable to log soft deletion of instance %s: %v", i.ID, err)
+	}
+
+	return nil
+}
+
+// restoreInstance cancels the deferred deletion of an instance.  The
+// instance remains stopped.
+func (c *controller) restoreInstance(i *types.Instance) error {
+	if err := c.ds.RestoreInstance(i.ID); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("Instance %s restored", i.ID)
+	if err := c.ds.LogEvent(i.TenantID, msg); err != nil {
+		glog.Warningf("Unable to log restore of instance %s: %v", i.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+)
+
+// ReserveTenantIP holds back an address of the tenant network for later
+// use, e.g., by a planned service that needs a well known address.
+func (c *controller) ReserveTenantIP(tenant string, req types.ReserveIPRequest) (types.ReservedIP, error) {
+	ip := net.ParseIP(req.Address)
+	if ip == nil {
+		return types.ReservedIP{}, types.ErrInvalidIP
+	}
+
+	r, err := c.ds.ReserveTenantIP(tenant, ip, req.Description)
+	if err != nil {
+		return types.ReservedIP{}, err
+	}
+
+	_ = c.ds.LogEvent(tenant, fmt.Sprintf("Reserved IP %s", r.Address))
+
+	return r, nil
+}
+
+// ListReservedTenantIPs returns the addresses currently reserved by a tenant.
+func (c *controller) ListReservedTenantIPs(tenant string) ([]types.ReservedIP, error) {
+	t, err := c.ds.GetTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, types.ErrTenantNotFound
+	}
+
+	reserved, err := c.ds.GetReservedTenantIPs(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if reserved == nil {
+		reserved = []types.ReservedIP{}
+	}
+
+	return reserved, nil
+}
+
+// ReleaseReservedTenantIP cancels a reservation, making the address
+// available for automatic allocation again.
+func (c *controller) ReleaseReservedTenantIP(tenant string, address string) error {
+	err := c.ds.ReleaseReservedTenantIP(tenant, address)
+	if err != nil {
+		return err
+	}
+
+	_ = c.ds.LogEvent(tenant, fmt.Sprintf("Released reserved IP %s", address))
+
+	return nil
+}
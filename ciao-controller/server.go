@@ -20,17 +20,32 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/api"
 	"github.com/ciao-project/ciao/service"
+	"github.com/ciao-project/ciao/uuid"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 )
 
+// requestIDHandler assigns an ID to every API request.  The ID is returned
+// to the client in the response headers and is passed on to the other
+// services involved in handling the request so that their log entries can
+// be correlated.
+func requestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := uuid.Generate().String()
+		w.Header().Set(api.RequestIDHeader, requestID)
+		h.ServeHTTP(w, r.WithContext(service.SetRequestID(r.Context(), requestID)))
+	})
+}
+
 type clientCertAuthHandler struct {
 	Controller *controller
 	Next       http.Handler
@@ -52,6 +67,7 @@ func (h *clientCertAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	}
 
 	r = r.WithContext(service.SetPrivilege(r.Context(), true))
+	r = r.WithContext(service.SetUser(r.Context(), cert.Subject.CommonName))
 
 	vars := mux.Vars(r)
 	tenantFromVars := vars["tenant"]
@@ -86,6 +102,11 @@ func (c *controller) createCiaoRoutes(r *mux.Router) error {
 	r = api.Routes(config, r)
 
 	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		// The routes of subrouters have no handler of their own
+		if route.GetHandler() == nil {
+			return nil
+		}
+
 		h := &clientCertAuthHandler{
 			Next:       route.GetHandler(),
 			Controller: c,
@@ -98,13 +119,45 @@ func (c *controller) createCiaoRoutes(r *mux.Router) error {
 	return err
 }
 
+// listenAddress returns the address on which an API server listens for
+// connections on port.  bind may be empty, to listen on all interfaces, an
+// IP address, a host name or the name of a network interface, in which case
+// the first address of the interface is used.
+func listenAddress(bind string, port int) (string, error) {
+	if bind != "" && net.ParseIP(bind) == nil {
+		if iface, err := net.InterfaceByName(bind); err == nil {
+			addrs, err := iface.Addrs()
+			if err != nil {
+				return "", errors.Wrapf(err, "Unable to get addresses of %s", bind)
+			}
+
+			ip := ""
+			for _, a := range addrs {
+				if ipNet, ok := a.(*net.IPNet); ok {
+					ip = ipNet.IP.String()
+					break
+				}
+			}
+			if ip == "" {
+				return "", fmt.Errorf("Interface %s has no address", bind)
+			}
+			bind = ip
+		}
+	}
+
+	return net.JoinHostPort(bind, strconv.Itoa(port)), nil
+}
+
 func (c *controller) createCiaoServer() (*http.Server, error) {
 	r := mux.NewRouter()
 
-	addr := fmt.Sprintf(":%d", controllerAPIPort)
+	addr, err := listenAddress(*controllerAPIBindAddress, controllerAPIPort)
+	if err != nil {
+		return nil, err
+	}
 
 	server := &http.Server{
-		Handler: r,
+		Handler: requestIDHandler(c.tracedHandler(r)),
 		Addr:    addr,
 	}
 
@@ -118,8 +171,9 @@ func (c *controller) createCiaoServer() (*http.Server, error) {
 		return nil, errors.New("Error importing client auth CA to poool")
 	}
 	tlsConfig := tls.Config{
-		ClientAuth: tls.RequireAndVerifyClientCert,
-		ClientCAs:  certPool,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      certPool,
+		GetCertificate: c.certs.getCertificate,
 	}
 	server.TLSConfig = &tlsConfig
 
@@ -127,6 +181,8 @@ func (c *controller) createCiaoServer() (*http.Server, error) {
 		return nil, errors.Wrap(err, "Error adding compute routes")
 	}
 
+	c.createNativeRoutes(r)
+
 	err = c.createCiaoRoutes(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error adding ciao routes")
@@ -137,6 +193,8 @@ func (c *controller) createCiaoServer() (*http.Server, error) {
 
 func (c *controller) ShutdownHTTPServers() {
 	glog.Warning("Shutting down HTTP servers")
+	// Event streams never complete on their own
+	c.ds.CloseEventSubscriptions()
 	var wg sync.WaitGroup
 	for _, server := range c.httpServers {
 		wg.Add(1)
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+)
+
+// CreateTenantSubnet adds a subnet to the tenant network.  Instances are
+// attached to it by naming it when they are created.
+func (c *controller) CreateTenantSubnet(tenant string, req types.CreateSubnetRequest) (types.TenantSubnet, error) {
+	s, err := c.ds.AddTenantSubnet(tenant, req.Name, req.CIDR)
+	if err != nil {
+		return types.TenantSubnet{}, err
+	}
+
+	_ = c.ds.LogEvent(tenant, fmt.Sprintf("Created subnet %s (%s)", s.CIDR, s.ID))
+
+	return s, nil
+}
+
+// ListTenantSubnets returns the subnets created by a tenant.
+func (c *controller) ListTenantSubnets(tenant string) ([]types.TenantSubnet, error) {
+	return c.ds.GetTenantSubnets(tenant)
+}
+
+// ShowTenantSubnet returns a subnet created by a tenant.
+func (c *controller) ShowTenantSubnet(tenant string, subnetID string) (types.TenantSubnet, error) {
+	return c.ds.GetTenantSubnet(tenant, subnetID)
+}
+
+// DeleteTenantSubnet removes a subnet that no instance is attached to.
+func (c *controller) DeleteTenantSubnet(tenant string, subnetID string) error {
+	s, err := c.ds.GetTenantSubnet(tenant, subnetID)
+	if err != nil {
+		return err
+	}
+
+	err = c.ds.DeleteTenantSubnet(tenant, subnetID)
+	if err != nil {
+		return err
+	}
+
+	_ = c.ds.LogEvent(tenant, fmt.Sprintf("Deleted subnet %s (%s)", s.CIDR, s.ID))
+
+	return nil
+}
@@ -190,16 +190,32 @@ func (c *controller) deleteInstances(tenantID string) error {
 // revoked the tenant's certificate. So no more
 // activity can happen for this tenant while this
 // command is going.
+//
+// Progress is reported in the tenant's event log as each class of
+// object is removed, so that an admin can follow the teardown of a
+// tenant with a large number of resources.
 func (c *controller) DeleteTenant(tenantID string) error {
-	err := c.deleteInstances(tenantID)
+	t, err := c.ds.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return types.ErrTenantNotFound
+	}
+
+	c.logTenantDeletion(tenantID, "Deleting tenant %s", tenantID)
+
+	err = c.deleteInstances(tenantID)
 	if err != nil {
 		return err
 	}
+	c.logTenantDeletion(tenantID, "Deleted instances of tenant %s", tenantID)
 
 	err = c.deleteCNCIInstances(tenantID)
 	if err != nil {
 		return err
 	}
+	c.logTenantDeletion(tenantID, "Deleted CNCIs of tenant %s", tenantID)
 
 	// remove any private workloads associated with this tenant.
 	workloads, err := c.ds.GetTenantWorkloads(tenantID)
@@ -213,6 +229,7 @@ func (c *controller) DeleteTenant(tenantID string) error {
 			return errors.Wrap(err, "Unable to remove tenant")
 		}
 	}
+	c.logTenantDeletion(tenantID, "Deleted workloads of tenant %s", tenantID)
 
 	// remove any images for this tenant.
 	images, err := c.ds.GetImages(tenantID, false)
@@ -229,6 +246,7 @@ func (c *controller) DeleteTenant(tenantID string) error {
 			return errors.Wrap(err, "Unable to remove tenant")
 		}
 	}
+	c.logTenantDeletion(tenantID, "Deleted images of tenant %s", tenantID)
 
 	// remove any storage for this tenant.
 	bds, err := c.ds.GetBlockDevices(tenantID)
@@ -243,8 +261,25 @@ func (c *controller) DeleteTenant(tenantID string) error {
 		}
 	}
 
+	c.logTenantDeletion(tenantID, "Deleted volumes of tenant %s", tenantID)
+
 	c.qs.DeleteTenant(tenantID)
 
-	// quotas get deleted from database as side effect to deleting tenant
-	return c.ds.DeleteTenant(tenantID)
+	// quotas, subnets and usage records get deleted from database as side
+	// effect to deleting tenant
+	err = c.ds.DeleteTenant(tenantID)
+	if err != nil {
+		return errors.Wrap(err, "Unable to remove tenant")
+	}
+	c.logTenantDeletion(tenantID, "Tenant %s deleted", tenantID)
+
+	return nil
+}
+
+func (c *controller) logTenantDeletion(tenantID string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	glog.Info(msg)
+	if err := c.ds.LogEvent(tenantID, msg); err != nil {
+		glog.Warningf("Unable to log tenant deletion event: %v", err)
+	}
 }
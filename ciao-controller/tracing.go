@@ -0,0 +1,148 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/internal/tracing"
+	"github.com/ciao-project/ciao/payloads"
+	"github.com/ciao-project/ciao/service"
+	"github.com/golang/glog"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flush allows streamed responses to be traced.
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// tracedHandler records a span for every API request handled by h.
+func (c *controller) tracedHandler(h http.Handler) http.Handler {
+	if c.tracer == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := c.tracer.StartSpan(r.Context(), fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+		span.SetTag("http.method", r.Method)
+		span.SetTag("http.url", r.URL.String())
+		if requestID := service.GetRequestID(r.Context()); requestID != "" {
+			span.SetTag("request_id", requestID)
+		}
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sr, r.WithContext(ctx))
+
+		span.SetTag("http.status_code", strconv.Itoa(sr.status))
+		span.Finish()
+	})
+}
+
+func parseTraceTimestamp(ts string) (time.Time, bool) {
+	if ts == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		glog.Warningf("Invalid trace timestamp %s: %v", ts, err)
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// roleSpan returns the service and operation names of the span recording
+// the time a frame spent in a node with the given SSNTP role.
+func roleSpan(role string, operand string) (string, string) {
+	switch {
+	case strings.Contains(role, "Controller"):
+		return "ciao-controller", fmt.Sprintf("send %s", operand)
+	case strings.Contains(role, "Scheduler"):
+		return "ciao-scheduler", fmt.Sprintf("schedule %s", operand)
+	case strings.Contains(role, "Agent"):
+		return "ciao-launcher", fmt.Sprintf("process %s", operand)
+	}
+	return strings.ToLower(role), operand
+}
+
+// traceFrame records the round-trip of a traced SSNTP frame as a span
+// with a child span for the time spent in each node it passed through.
+// The spans of a frame concerning an instance belong to the trace named
+// after the instance.
+func (c *controller) traceFrame(frame payloads.FrameTrace) {
+	if c.tracer == nil {
+		return
+	}
+
+	start, ok := parseTraceTimestamp(frame.StartTimestamp)
+	if !ok {
+		return
+	}
+
+	end, ok := parseTraceTimestamp(frame.EndTimestamp)
+	if !ok {
+		return
+	}
+
+	var parent tracing.SpanContext
+	if frame.InstanceUUID != "" {
+		parent.TraceID = tracing.TraceIDFromUUID(frame.InstanceUUID)
+	}
+
+	root := c.tracer.StartSpanAt(parent, fmt.Sprintf("ssntp %s", frame.Operand), "ciao-controller", start)
+	root.SetTag("ssntp.type", frame.Type)
+	if frame.Label != "" {
+		root.SetTag("trace.label", frame.Label)
+	}
+	if frame.InstanceUUID != "" {
+		root.SetTag("instance_id", frame.InstanceUUID)
+	}
+
+	for _, node := range frame.Nodes {
+		nodeStart, ok := parseTraceTimestamp(node.RxTimestamp)
+		if !ok {
+			nodeStart = start
+		}
+
+		nodeEnd, ok := parseTraceTimestamp(node.TxTimestamp)
+		if !ok {
+			nodeEnd = end
+		}
+
+		service, name := roleSpan(node.SSNTPRole, frame.Operand)
+		span := c.tracer.StartSpanAt(root.Context(), name, service, nodeStart)
+		span.SetTag("node_id", node.SSNTPUUID)
+		span.FinishAt(nodeEnd)
+	}
+
+	root.FinishAt(end)
+}
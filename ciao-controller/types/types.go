@@ -19,6 +19,7 @@ package types
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
@@ -102,12 +103,24 @@ type WorkloadResponse struct {
 // WorkloadRequest contains resource and configuration for a user
 // workload.
 type WorkloadRequest struct {
-	WorkloadID string
-	TenantID   string
-	Instances  int
-	TraceLabel string
-	Name       string
-	Subnet     string
+	WorkloadID      string
+	TenantID        string
+	Instances       int
+	TraceLabel      string
+	Name            string
+	Subnet          string
+	SubnetID        string
+	IPAddress       string
+	UserData        string
+	ReplaceUserData bool
+	Metadata        map[string]string
+	RequestID       string
+	ExpiresIn       time.Duration
+
+	// TraceID and SpanID identify the span of the API request, if
+	// any, under which the start of each instance is traced.
+	TraceID string
+	SpanID  string
 }
 
 // Instance contains information about an instance of a workload.
@@ -128,6 +141,11 @@ type Instance struct {
 	Name        string       `json:"name"`
 	StateLock   sync.RWMutex `json:"-"`
 	StateChange *sync.Cond   `json:"-"`
+
+	// LastNodeID is the node a missing instance was running on when
+	// that node disconnected.  Deletes of the instance are sent to it
+	// once it reconnects.
+	LastNodeID string `json:"-"`
 }
 
 // SortedInstancesByID implements sort.Interface for Instance by ID string
@@ -187,6 +205,113 @@ type LogEntry struct {
 	Message   string    `json:"message"`
 }
 
+// EventRetention describes the event log retention policy of the
+// controller along with statistics about the pruning of the event log.
+type EventRetention struct {
+	MaxAge        string    `json:"max_age"`
+	MaxRows       int       `json:"max_rows"`
+	PruneInterval string    `json:"prune_interval"`
+	Runs          int       `json:"runs"`
+	Failures      int       `json:"failures"`
+	Pruned        int       `json:"pruned"`
+	LastRun       time.Time `json:"last_run"`
+	LastPruned    int       `json:"last_pruned"`
+}
+
+// Actions recorded in the history of an instance.  Create, start, stop,
+// delete, restore and migrate are requested by users.  The others are
+// reported by the cluster.
+const (
+	InstanceActionCreate  = "create"
+	InstanceActionStart   = "start"
+	InstanceActionStop    = "stop"
+	InstanceActionDelete  = "delete"
+	InstanceActionRestore = "restore"
+	InstanceActionMigrate = "migrate"
+	InstanceActionLaunch  = "launch"
+	InstanceActionExited  = "exited"
+	InstanceActionDeleted = "deleted"
+	InstanceActionLost    = "lost"
+)
+
+// Results of the actions recorded in the history of an instance.
+const (
+	InstanceActionSuccess = "success"
+	InstanceActionError   = "error"
+)
+
+// InstanceAction records an action performed on an instance along with
+// its outcome.  User is empty for actions which were not requested through
+// the API.
+type InstanceAction struct {
+	InstanceID string    `json:"instance_id"`
+	TenantID   string    `json:"tenant_id"`
+	Action     string    `json:"action"`
+	User       string    `json:"user,omitempty"`
+	NodeID     string    `json:"node_id,omitempty"`
+	Result     string    `json:"result"`
+	Reason     string    `json:"reason,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// InstanceCrash records a crash of an instance and where on its node the
+// artifacts collected for postmortem debugging are stored.
+type InstanceCrash struct {
+	InstanceID string    `json:"instance_id"`
+	TenantID   string    `json:"tenant_id"`
+	NodeID     string    `json:"node_id"`
+	ExitStatus string    `json:"exit_status"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Artifacts  string    `json:"artifacts"`
+	MemoryDump bool      `json:"memory_dump"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// NotificationEvent identifies the kind of change described by a
+// Notification.
+type NotificationEvent string
+
+const (
+	// InstanceCreated is sent when an instance is added to the cluster
+	InstanceCreated NotificationEvent = "instance.created"
+
+	// InstanceStateChanged is sent when the state of an instance changes
+	InstanceStateChanged NotificationEvent = "instance.state_changed"
+
+	// InstanceStartFailed is sent when an instance fails to start
+	InstanceStartFailed NotificationEvent = "instance.start_failed"
+
+	// InstanceDeleted is sent when an instance is removed from the cluster
+	InstanceDeleted NotificationEvent = "instance.deleted"
+
+	// NodeConnected is sent when a node joins the cluster
+	NodeConnected NotificationEvent = "node.connected"
+
+	// NodeStateChanged is sent when the status reported by a node changes
+	NodeStateChanged NotificationEvent = "node.state_changed"
+
+	// NodeDisconnected is sent when a node leaves the cluster
+	NodeDisconnected NotificationEvent = "node.disconnected"
+)
+
+// NotificationVersion is the version of the Notification schema.  It is
+// incremented whenever an incompatible change is made to Notification.
+const NotificationVersion = 1
+
+// Notification describes an instance lifecycle or node state change.  It
+// is published, JSON encoded, on the message bus.
+type Notification struct {
+	Version       int               `json:"version"`
+	Event         NotificationEvent `json:"event"`
+	Timestamp     time.Time         `json:"timestamp"`
+	TenantID      string            `json:"tenant_id,omitempty"`
+	InstanceID    string            `json:"instance_id,omitempty"`
+	NodeID        string            `json:"node_id,omitempty"`
+	State         string            `json:"state,omitempty"`
+	PreviousState string            `json:"previous_state,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+}
+
 // NodeStats stores statistics for individual nodes in the cluster.
 type NodeStats struct {
 	NodeID          string    `json:"node_id"`
@@ -293,6 +418,32 @@ type Volume struct {
 	Internal    bool       `json:"internal"`    // whether this storage should be shown to the user
 }
 
+// VolumeFilter restricts a volume listing to the volumes matching all of
+// its criteria.  The zero value matches every volume.
+type VolumeFilter struct {
+	State    BlockState // only volumes in this state, if not empty
+	Bootable *bool      // only (non-)bootable volumes, if not nil
+	MinSize  int        // only volumes of at least MinSize GiB
+	MaxSize  int        // only volumes of at most MaxSize GiB, if not 0
+}
+
+// Match returns true if the volume meets the criteria of the filter.
+func (f VolumeFilter) Match(v Volume) bool {
+	if f.State != "" && v.State != f.State {
+		return false
+	}
+
+	if f.Bootable != nil && v.Bootable != *f.Bootable {
+		return false
+	}
+
+	if v.Size < f.MinSize || (f.MaxSize > 0 && v.Size > f.MaxSize) {
+		return false
+	}
+
+	return true
+}
+
 // StorageAttachment represents a link between a block device and
 // an instance.
 type StorageAttachment struct {
@@ -348,6 +499,26 @@ type CiaoNodeStatus struct {
 	Status NodeStatusType `json:"status"`
 }
 
+// CiaoNodeNetwork describes one of the network interfaces of a node.
+type CiaoNodeNetwork struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+}
+
+// CiaoNodeDetails represents the unmarshalled version of the contents of a
+// v2.1/nodes/{node} response.  It contains the capacities and status last
+// reported by the node, the time of that report, the node's roles, its
+// network interfaces and a summary of the instances it hosts.
+type CiaoNodeDetails struct {
+	CiaoNode
+	Roles    []string          `json:"roles"`
+	Networks []CiaoNodeNetwork `json:"networks"`
+}
+
+// MaxPageSize is the largest number of items returned in a page of the
+// listings paged by limit and marker.  Larger limits are reduced to it.
+const MaxPageSize = 1000
+
 // CiaoNodes represents the unmarshalled version of the contents of a
 // /v2.1/nodes response.  It contains status and statistics information
 // for a set of nodes.
@@ -380,6 +551,16 @@ type CiaoTenantResources struct {
 	DiskUsage     int       `json:"disk_usage"`
 }
 
+// CiaoTenantQuotaUpdate represents the unmarshalled version of the contents
+// of a PUT /v2.1/{tenant}/quotas request.  Only the limits present in the
+// request are changed, -1 meaning unlimited.
+type CiaoTenantQuotaUpdate struct {
+	InstanceLimit *int `json:"instances_limit,omitempty"`
+	VCPULimit     *int `json:"cpus_limit,omitempty"`
+	MemLimit      *int `json:"ram_limit,omitempty"`
+	DiskLimit     *int `json:"disk_limit,omitempty"`
+}
+
 // CiaoUsage contains a snapshot of resource consumption for a tenant.
 type CiaoUsage struct {
 	VCPU      int       `json:"cpus_usage"`
@@ -433,15 +614,31 @@ func NewCiaoCNCIs() (cncis CiaoCNCIs) {
 
 // CiaoServerStats contains status information about a CN or a NN.
 type CiaoServerStats struct {
-	ID        string    `json:"id"`
-	NodeID    string    `json:"node_id"`
-	Timestamp time.Time `json:"updated"`
-	Status    string    `json:"status"`
-	TenantID  string    `json:"tenant_id"`
-	IPv4      string    `json:"IPv4"`
-	VCPUUsage int       `json:"cpus_usage"`
-	MemUsage  int       `json:"ram_usage"`
-	DiskUsage int       `json:"disk_usage"`
+	ID              string      `json:"id"`
+	NodeID          string      `json:"node_id"`
+	Timestamp       time.Time   `json:"updated"`
+	Status          string      `json:"status"`
+	TenantID        string      `json:"tenant_id"`
+	IPv4            string      `json:"IPv4"`
+	VCPUUsage       int         `json:"cpus_usage"`
+	MemUsage        int         `json:"ram_usage"`
+	DiskUsage       int         `json:"disk_usage"`
+	NetRxBytes      int64       `json:"net_rx_bytes"`
+	NetTxBytes      int64       `json:"net_tx_bytes"`
+	NetRxPackets    int64       `json:"net_rx_packets"`
+	NetTxPackets    int64       `json:"net_tx_packets"`
+	BlockReadBytes  int64       `json:"block_read_bytes"`
+	BlockWriteBytes int64       `json:"block_write_bytes"`
+	Connections     int         `json:"connections"`
+	TopTalkers      []TopTalker `json:"top_talkers,omitempty"`
+}
+
+// TopTalker describes the traffic between an instance and one of the peers
+// it exchanged the most traffic with, as tracked by its node.
+type TopTalker struct {
+	IP          string `json:"ip"`
+	Connections int    `json:"connections"`
+	Bytes       int64  `json:"bytes"`
 }
 
 // CiaoServersStats represents the unmarshalled version of the contents of a
@@ -474,6 +671,33 @@ type CiaoServersAction struct {
 	ServerIDs []string `json:"servers"`
 }
 
+// CiaoServerActionResult reports the outcome of an action performed on a
+// single instance as part of a v2.1/servers/action request.
+type CiaoServerActionResult struct {
+	ServerID string `json:"server_id"`
+	Success  bool   `json:"success"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// CiaoServersActionResults represents the unmarshalled version of the
+// response to a v2.1/servers/action request.  It lists the outcome of the
+// action for each of the instances it was applied to.
+type CiaoServersActionResults struct {
+	Action  string                   `json:"action"`
+	Results []CiaoServerActionResult `json:"results"`
+}
+
+// Failures returns the results of the instances the action failed on.
+func (r CiaoServersActionResults) Failures() []CiaoServerActionResult {
+	var failures []CiaoServerActionResult
+	for _, res := range r.Results {
+		if !res.Success {
+			failures = append(failures, res)
+		}
+	}
+	return failures
+}
+
 // CiaoTraceSummary contains information about a specific SSNTP Trace label.
 type CiaoTraceSummary struct {
 	Label     string `json:"label"`
@@ -517,6 +741,32 @@ type CiaoTraceData struct {
 	FramesStat []CiaoFrameStat    `json:"frames"`
 }
 
+// CiaoTraceFrameNode contains the timestamps at which a traced frame was
+// received and forwarded by a single SSNTP node.
+type CiaoTraceFrameNode struct {
+	NodeID      string `json:"node_id"`
+	RxTimestamp string `json:"rx_timestamp"`
+	TxTimestamp string `json:"tx_timestamp"`
+}
+
+// CiaoTraceFrame contains the raw timing information of a single traced
+// SSNTP frame.
+type CiaoTraceFrame struct {
+	ID             int                  `json:"id"`
+	Type           string               `json:"type"`
+	Operand        string               `json:"operand"`
+	StartTimestamp string               `json:"start_timestamp"`
+	EndTimestamp   string               `json:"end_timestamp"`
+	Nodes          []CiaoTraceFrameNode `json:"nodes"`
+}
+
+// CiaoTraceFrames represents the unmarshalled version of the response to a
+// v2.1/traces/{label}/frames request.  It contains the per frame and per node
+// timestamps of all the SSNTP frames traced with a label.
+type CiaoTraceFrames struct {
+	Frames []CiaoTraceFrame `json:"frames"`
+}
+
 // CiaoEvent contains information about an individual event generated
 // in a ciao cluster.
 type CiaoEvent struct {
@@ -551,6 +801,9 @@ var (
 	// ErrInstanceNotFound is returned when an instance is not found.
 	ErrInstanceNotFound = errors.New("Instance not found")
 
+	// ErrNodeNotFound is returned when a node is not found.
+	ErrNodeNotFound = errors.New("Node not found")
+
 	// ErrInstanceNotAssigned is returned when an instance is not assigned to a node.
 	ErrInstanceNotAssigned = errors.New("Cannot perform operation: instance not assigned to Node")
 
@@ -563,9 +816,23 @@ var (
 	// ErrInvalidIP is returned when an IP cannot be parsed
 	ErrInvalidIP = errors.New("The IP Address is not valid")
 
+	// ErrIPInUse is returned when a requested tenant IP is already allocated
+	ErrIPInUse = errors.New("The IP Address is already in use")
+
 	// ErrSubnetTooSmall is returned when an invalid subnet is used
 	ErrSubnetTooSmall = errors.New("Requested subnet is too small to be usable")
 
+	// ErrBadSubnet is returned when a tenant subnet is not a subnet of the
+	// tenant network of the tenant's subnet size
+	ErrBadSubnet = errors.New("Subnet must be within 172.16.0.0/12 and match the tenant subnet size")
+
+	// ErrSubnetNotFound is returned when a tenant subnet is not found
+	ErrSubnetNotFound = errors.New("Subnet not found")
+
+	// ErrSubnetInUse is returned when deleting a tenant subnet which still
+	// has addresses allocated from it
+	ErrSubnetInUse = errors.New("Subnet has allocated addresses")
+
 	// ErrPoolNotFound is returned when an external IP pool is not found
 	ErrPoolNotFound = errors.New("Pool not found")
 
@@ -591,14 +858,39 @@ var (
 	// due to having an external IP assigned to it.
 	ErrInstanceMapped = errors.New("Unmap the external IP prior to deletion")
 
+	// ErrInstanceDeleted is returned when an operation is attempted on
+	// an instance which is awaiting deferred deletion.
+	ErrInstanceDeleted = errors.New("Instance is deleted, restore it first")
+
+	// ErrInstanceNotDeleted is returned when restoring an instance which
+	// is not awaiting deferred deletion.
+	ErrInstanceNotDeleted = errors.New("Instance is not awaiting deletion")
+
+	// ErrMetadataNotFound is returned when an instance has no metadata
+	// with the requested key
+	ErrMetadataNotFound = errors.New("Metadata key not found")
+
 	// ErrWorkloadNotFound is returned when a workload ID cannot be found
 	ErrWorkloadNotFound = errors.New("Workload not found")
 
-	// ErrWorkloadInUse is returned by DeleteWorkload when an instance of a workload is still active.
+	// ErrWorkloadInUse is returned by DeleteWorkload, and by UpdateWorkload
+	// when changing requirements, when an instance of a workload is still active.
 	ErrWorkloadInUse = errors.New("Workload definition still in use")
 
 	// ErrBadName is returned when a name doesn't match the requirements
 	ErrBadName = errors.New("Requested name doesn't match requirements")
+
+	// ErrDuplicateName is returned when an instance is given the name of
+	// another instance of its tenant
+	ErrDuplicateName = errors.New("Instance name already in use")
+
+	// ErrBadBootSteps is returned when the boot steps of a composed
+	// launch are incomplete or contain a dependency cycle
+	ErrBadBootSteps = errors.New("Invalid boot steps")
+
+	// ErrMinInstances is returned when fewer than the minimum number of
+	// instances requested could be started
+	ErrMinInstances = errors.New("Minimum number of instances could not be started")
 )
 
 // Link provides a url and relationship for a resource.
@@ -615,6 +907,14 @@ type APILink struct {
 	MinVersion string `json:"minimum_version"`
 }
 
+// APIVersion represents the unmarshalled version of the response to a
+// /version request.  It holds the range of ciao API versions supported by the
+// controller.
+type APIVersion struct {
+	Version    int `json:"version"`
+	MinVersion int `json:"minimum_version"`
+}
+
 // ExternalSubnet represents a subnet for External IPs.
 type ExternalSubnet struct {
 	ID    string `json:"id"`
@@ -702,6 +1002,39 @@ type MapIPRequest struct {
 	InstanceID string  `json:"instance_id"`
 }
 
+// ReserveIPRequest is used to reserve an address from the tenant network.
+type ReserveIPRequest struct {
+	Address     string `json:"address"`
+	Description string `json:"description,omitempty"`
+}
+
+// ReservedIP is an address of the tenant network that is held back from
+// automatic allocation.  A reserved address can be assigned to an instance
+// by requesting it at create time, which consumes the reservation.
+type ReservedIP struct {
+	TenantID    string    `json:"tenant_id"`
+	Address     string    `json:"address"`
+	Description string    `json:"description,omitempty"`
+	CreateTime  time.Time `json:"create_time"`
+}
+
+// CreateSubnetRequest is used to add a subnet to the tenant network.
+type CreateSubnetRequest struct {
+	Name string `json:"name,omitempty"`
+	CIDR string `json:"cidr"`
+}
+
+// TenantSubnet is a subnet of the tenant network created at the request of
+// the tenant.  Instances are only given addresses from such a subnet when
+// they ask for it at create time.
+type TenantSubnet struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	Name       string    `json:"name,omitempty"`
+	CIDR       string    `json:"cidr"`
+	CreateTime time.Time `json:"create_time"`
+}
+
 // QuotaDetails holds information for updating and querying quotas
 type QuotaDetails struct {
 	Name  string
@@ -762,6 +1095,32 @@ func (qd *QuotaDetails) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// QuotaExcess describes by how much a request exceeds one of the quotas of
+// a tenant.
+type QuotaExcess struct {
+	Name      string `json:"name"`
+	Limit     int    `json:"limit"`
+	Usage     int    `json:"usage"`
+	Requested int    `json:"requested"`
+	Excess    int    `json:"excess"`
+}
+
+// QuotaError is returned when a request is refused because it would take
+// the usage of a tenant over its quotas.
+type QuotaError struct {
+	Excesses []QuotaExcess
+}
+
+func (e *QuotaError) Error() string {
+	msgs := make([]string, 0, len(e.Excesses))
+	for _, qe := range e.Excesses {
+		msgs = append(msgs, fmt.Sprintf("%s exceeded by %d (%d requested, %d of %d used)",
+			qe.Name, qe.Excess, qe.Requested, qe.Usage, qe.Limit))
+	}
+
+	return "Over quota: " + strings.Join(msgs, ", ")
+}
+
 // QuotaUpdateRequest holds the layout for updating quota API
 type QuotaUpdateRequest struct {
 	Quotas []QuotaDetails `json:"quotas"`
@@ -827,6 +1186,45 @@ type Image struct {
 	CreateTime time.Time  `json:"create_time"`
 	Size       uint64     `json:"size"`
 	Visibility Visibility `json:"visibility"`
+
+	// Digest is the SHA-256 digest of the image's data.  Images with the
+	// same digest share the block device storing their data.  Images
+	// uploaded before images were deduplicated have no digest.
+	Digest string `json:"digest,omitempty"`
+
+	// DiskFormat is the format of the data uploaded for the image, e.g.,
+	// qcow2, as detected by qemu-img.  The data is stored in the format
+	// preferred by the storage backend, whatever the uploaded format.
+	DiskFormat string `json:"disk_format,omitempty"`
+
+	// UploadSize is the size in bytes of the data uploaded for the image,
+	// before it was converted.
+	UploadSize uint64 `json:"upload_size,omitempty"`
+}
+
+// TenantImageUsage summarises the storage consumed by the images of a
+// tenant.  Images created by the administrator, e.g., public and internal
+// images, are reported with an empty TenantID.
+type TenantImageUsage struct {
+	TenantID string `json:"tenant_id"`
+	Images   int    `json:"images"`
+	Size     uint64 `json:"size"`
+}
+
+// ImageStoreUsage lists the images of all the tenants along with the
+// storage they consume in the image store.
+type ImageStoreUsage struct {
+	Images    []Image            `json:"images"`
+	Tenants   []TenantImageUsage `json:"tenants"`
+	TotalSize uint64             `json:"total_size"`
+
+	// StoredSize is the storage actually consumed by the images, the
+	// data shared by images with the same digest being counted once.
+	StoredSize uint64 `json:"stored_size"`
+
+	// DedupSavings is the storage saved by sharing the data of images
+	// with the same digest.
+	DedupSavings uint64 `json:"dedup_savings"`
 }
 
 // TransitionInstanceState safely sets thes state on an instance
@@ -33,7 +33,7 @@ func (c *controller) CreateVolume(tenant string, req api.RequestedVolume) (types
 	// no limits checking for now.
 	if req.ImageRef != "" {
 		// create bootable volume
-		bd, err = c.CreateBlockDeviceFromSnapshot(req.ImageRef, "ciao-image")
+		bd, err = c.CreateBlockDeviceFromSnapshot(c.imageBlockDevice(req.ImageRef), "ciao-image")
 		bd.Bootable = true
 	} else if req.SourceVolID != "" {
 		// copy existing volume
@@ -268,10 +268,10 @@ func (c *controller) DetachVolume(tenant string, volume string, attachment strin
 	return retval
 }
 
-func (c *controller) ListVolumesDetail(tenant string) ([]types.Volume, error) {
+func (c *controller) ListVolumesDetail(tenant string, filter types.VolumeFilter) ([]types.Volume, error) {
 	vols := []types.Volume{}
 
-	devs, err := c.ds.GetBlockDevices(tenant)
+	devs, err := c.ds.FindBlockDevices(tenant, filter)
 	if err != nil {
 		return vols, err
 	}
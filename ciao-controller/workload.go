@@ -15,6 +15,8 @@
 package main
 
 import (
+	"regexp"
+
 	"github.com/golang/glog"
 
 	"github.com/ciao-project/ciao/ciao-controller/types"
@@ -117,6 +119,36 @@ func (c *controller) validateWorkloadStorage(req *types.Workload) error {
 	return nil
 }
 
+// extraSpecKey matches namespaced extra spec keys, e.g., hw:cpu_policy.
+var extraSpecKey = regexp.MustCompile("^[a-z0-9_-]+:[a-zA-Z0-9_.:-]+$")
+
+func validateExtraSpecs(specs map[string]string) error {
+	for k := range specs {
+		if !extraSpecKey.MatchString(k) {
+			glog.V(2).Infof("Invalid workload request: bad extra spec key %q", k)
+			return types.ErrBadRequest
+		}
+	}
+
+	return nil
+}
+
+// validateIORequirements checks that the disk IOPS and network bandwidth
+// reserved for a workload are not negative.
+func validateIORequirements(req payloads.WorkloadRequirements) error {
+	if req.DiskIOPS < 0 {
+		glog.V(2).Infof("Invalid workload request: negative disk IOPS %d", req.DiskIOPS)
+		return types.ErrBadRequest
+	}
+
+	if req.NetBandwidthMbps < 0 {
+		glog.V(2).Infof("Invalid workload request: negative network bandwidth %d", req.NetBandwidthMbps)
+		return types.ErrBadRequest
+	}
+
+	return nil
+}
+
 // this is probably an insufficient amount of checking.
 func (c *controller) validateWorkloadRequest(req *types.Workload) error {
 	// ID must be blank.
@@ -151,6 +183,14 @@ func (c *controller) validateWorkloadRequest(req *types.Workload) error {
 		return types.ErrBadRequest
 	}
 
+	if err := validateExtraSpecs(req.Requirements.ExtraSpecs); err != nil {
+		return err
+	}
+
+	if err := validateIORequirements(req.Requirements); err != nil {
+		return err
+	}
+
 	if len(req.Storage) > 0 {
 		err := c.validateWorkloadStorage(req)
 		if err != nil {
@@ -190,6 +230,32 @@ func (c *controller) DeleteWorkload(tenantID string, workloadID string) error {
 	return types.ErrWorkloadNotFound
 }
 
+func (c *controller) UpdateWorkload(tenantID string, workloadID string, req types.Workload) error {
+	wl, err := c.ds.GetWorkload(workloadID)
+	if err != nil {
+		return err
+	}
+
+	if tenantID != "admin" && tenantID != wl.TenantID {
+		return types.ErrWorkloadNotFound
+	}
+
+	// The ID, owner and visibility of a workload are kept, the request
+	// replaces everything else.
+	req.ID = ""
+	req.TenantID = wl.TenantID
+	req.Visibility = wl.Visibility
+
+	err = c.validateWorkloadRequest(&req)
+	if err != nil {
+		return err
+	}
+
+	req.ID = workloadID
+
+	return c.ds.UpdateWorkload(req)
+}
+
 func (c *controller) ShowWorkload(tenantID string, workloadID string) (types.Workload, error) {
 	wl, err := c.ds.GetWorkload(workloadID)
 	if err != nil {
@@ -0,0 +1,66 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ciao-project/ciao/ciao-deploy/deploy"
+	"github.com/spf13/cobra"
+)
+
+var generateConf = &deploy.ClusterConfiguration{}
+var generateCNCISize cnciFlag = "large"
+var outputDirectory string
+
+func generate() int {
+	generateConf.CNCISize = generateCNCISize.String()
+	err := deploy.GenerateConfiguration(outputDirectory, generateConf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate the cluster configuration without installing it",
+	Long: `Renders the systemd unit files, cluster configuration and environment
+files for the ciao services into a directory for use by configuration
+management tools`,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(generate())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(generateCmd)
+
+	hostNetwork, _ := getFirstPhyDevice()
+
+	generateCmd.Flags().StringVar(&outputDirectory, "output-directory", "ciao-deploy", "Directory to write the generated files to")
+	generateCmd.Flags().StringVar(&generateConf.CephID, "ceph-id", "admin", "The ceph id for the storage cluster")
+	generateCmd.Flags().StringVar(&generateConf.HTTPSCaCertPath, "https-ca-cert", "", "Path to CA certificate for HTTP service")
+	generateCmd.Flags().StringVar(&generateConf.HTTPSCertPath, "https-cert", "", "Path to certificate for HTTPS service")
+	generateCmd.Flags().StringVar(&generateConf.AdminSSHKeyPath, "admin-ssh-key", "", "Path to SSH public key for accessing CNCI")
+	generateCmd.Flags().StringVar(&generateConf.ComputeNet, "compute-net", hostNetwork, "Network range for compute network")
+	generateCmd.Flags().StringVar(&generateConf.MgmtNet, "mgmt-net", hostNetwork, "Network range for management network")
+	generateCmd.Flags().StringVar(&generateConf.CNCINet, "cnci-net", "192.168.128.0", "Host start address for CNCI mgmt network - must be at least /18")
+	generateCmd.Flags().StringVar(&generateConf.ServerHostname, "server-hostname", deploy.HostnameWithFallback(), "Name or FQDN that the master node can be reached on")
+	generateCmd.Flags().BoolVar(&generateConf.DisableLimits, "disable-limits", false, "Disable memory limit checking for cluster nodes")
+	generateCmd.Flags().Var(&generateCNCISize, "cnci", "Specifies the resources (mem, cpu) available to CNCIs.  Can be 'tiny', 'medium', 'large'")
+}
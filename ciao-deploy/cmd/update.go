@@ -21,13 +21,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var noRollback bool
+
 func update() int {
 	ctx, cancelFunc := getSignalContext()
 	defer cancelFunc()
 
-	err := deploy.UpdateMaster(ctx)
+	err := deploy.UpdateMaster(ctx, !noRollback)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error updating master node")
+		fmt.Fprintf(os.Stderr, "Error updating master node: %v\n", err)
 		return 1
 	}
 
@@ -46,7 +48,9 @@ func update() int {
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update the master node on the cluster",
-	Long:  `Use on an already setup master node to update the current software on the node`,
+	Long: `Use on an already setup master node to update the current software on the node.
+Services that are not running after the update are rolled back to the previously
+deployed version.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		os.Exit(update())
 	},
@@ -55,5 +59,6 @@ var updateCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(updateCmd)
 	updateCmd.Flags().BoolVar(&localLauncher, "local-launcher", false, "Enable a local launcher on this node (for testing)")
-
+	updateCmd.Flags().BoolVar(&noRollback, "no-rollback", false, "Do not roll back services that fail after the update")
+	updateCmd.Flags().DurationVar(&deploy.HealthCheckDelay, "health-check-delay", deploy.HealthCheckDelay, "Time services must stay up after the update")
 }
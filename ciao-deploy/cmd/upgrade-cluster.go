@@ -0,0 +1,69 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/ciao-project/ciao/ciao-deploy/deploy"
+	"github.com/spf13/cobra"
+)
+
+func upgradeCluster(args []string) int {
+	ctx, cancelFunc := getSignalContext()
+	defer cancelFunc()
+
+	err := deploy.UpdateMaster(ctx, !noRollback)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating master node: %v\n", err)
+		return 1
+	}
+
+	hosts := args
+	err = deploy.UpgradeNodes(ctx, sshUser, !noRollback, hosts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error upgrading nodes: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+var upgradeClusterCmd = &cobra.Command{
+	Use:   "upgrade-cluster <hosts>",
+	Short: "Upgrade the master node and the given nodes",
+	Long: `Update the software on the master node and then on each of the given
+nodes. Services that are not running after the upgrade are rolled back to the
+previously deployed version.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(upgradeCluster(args))
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+func init() {
+	RootCmd.AddCommand(upgradeClusterCmd)
+
+	u, err := user.Current()
+	currentUser := ""
+	if err == nil {
+		currentUser = u.Username
+	}
+
+	upgradeClusterCmd.Flags().StringVar(&sshUser, "user", currentUser, "User to SSH as")
+	upgradeClusterCmd.Flags().BoolVar(&noRollback, "no-rollback", false, "Do not roll back services that fail after the upgrade")
+	upgradeClusterCmd.Flags().DurationVar(&deploy.HealthCheckDelay, "health-check-delay", deploy.HealthCheckDelay, "Time services must stay up after the upgrade")
+}
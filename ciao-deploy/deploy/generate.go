@@ -0,0 +1,211 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/ciao-project/ciao/ssntp"
+	"github.com/pkg/errors"
+)
+
+var launcherCaps = []string{
+	"CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_DAC_OVERRIDE",
+	"CAP_SETGID", "CAP_SETUID", "CAP_SYS_PTRACE", "CAP_SYS_MODULE",
+}
+
+// nodeCertPath returns the path of the certificate for a role on the node
+// the generated files are installed on, using the systemd host name
+// specifier as the files are not generated on that node.
+func nodeCertPath(role ssntp.Role) string {
+	return path.Join(ciaoPKIDir, fmt.Sprintf("cert-%s-%%H.pem", role.String()))
+}
+
+// generatedNode describes the unit files needed on one kind of node
+type generatedNode struct {
+	dir   string
+	units []unitFileConf
+}
+
+func generatedNodes() []generatedNode {
+	caCertPath := path.Join(ciaoPKIDir, "CAcert.pem")
+
+	return []generatedNode{
+		{
+			dir: "master",
+			units: []unitFileConf{
+				{
+					Tool:       "ciao-scheduler",
+					User:       ciaoUser,
+					CertPath:   nodeCertPath(ssntp.SCHEDULER),
+					CACertPath: caCertPath,
+				},
+				{
+					Tool:       "ciao-controller",
+					User:       ciaoUser,
+					CertPath:   nodeCertPath(ssntp.Controller),
+					CACertPath: caCertPath,
+				},
+			},
+		},
+		{
+			dir: "compute",
+			units: []unitFileConf{
+				{
+					Tool:       "ciao-launcher",
+					User:       ciaoUser,
+					CertPath:   nodeCertPath(ssntp.AGENT),
+					CACertPath: caCertPath,
+					Caps:       launcherCaps,
+					Roles:      []string{"agent"},
+					Deps:       []string{"docker.service"},
+				},
+			},
+		},
+		{
+			dir: "network",
+			units: []unitFileConf{
+				{
+					Tool:       "ciao-launcher",
+					User:       ciaoUser,
+					CertPath:   nodeCertPath(ssntp.NETAGENT),
+					CACertPath: caCertPath,
+					Caps:       launcherCaps,
+					Roles:      []string{"net-agent"},
+					Deps:       []string{"docker.service"},
+				},
+			},
+		},
+	}
+}
+
+func writeGeneratedFile(outDir string, name string, data []byte) error {
+	p := filepath.Join(outDir, name)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrapf(err, "Error creating directory for %s", name)
+	}
+
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		return errors.Wrapf(err, "Error writing %s", name)
+	}
+
+	fmt.Printf("Generated %s\n", p)
+	return nil
+}
+
+func generateEnvironmentData(clusterConf *ClusterConfiguration) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "CIAO_CONTROLLER=\"%s\"\n", clusterConf.ServerHostname)
+	fmt.Fprintf(&b, "CIAO_ADMIN_CLIENT_CERT_FILE=\"%s\"\n", clusterConf.AuthAdminCertPath)
+
+	return b.Bytes()
+}
+
+// generateTLSPathsData lists where each certificate referenced by the
+// generated files is expected to be installed.  %H stands for the host name
+// of the node.
+func generateTLSPathsData(clusterConf *ClusterConfiguration) []byte {
+	var b bytes.Buffer
+
+	paths := []struct {
+		name string
+		path string
+	}{
+		{"CIAO_CA_CERT", path.Join(ciaoPKIDir, "CAcert.pem")},
+		{"CIAO_SCHEDULER_CERT", nodeCertPath(ssntp.SCHEDULER)},
+		{"CIAO_CONTROLLER_CERT", nodeCertPath(ssntp.Controller)},
+		{"CIAO_COMPUTE_LAUNCHER_CERT", nodeCertPath(ssntp.AGENT)},
+		{"CIAO_NETWORK_LAUNCHER_CERT", nodeCertPath(ssntp.NETAGENT)},
+		{"CIAO_CNCI_AGENT_CERT", "/var/lib/ciao/cert-client-localhost.pem"},
+		{"CIAO_CNCI_AGENT_CA_CERT", "/var/lib/ciao/CAcert-server-localhost.pem"},
+		{"CIAO_HTTPS_CA_CERT", clusterConf.HTTPSCaCertPath},
+		{"CIAO_HTTPS_CERT", clusterConf.HTTPSCertPath},
+		{"CIAO_AUTH_CA_CERT", clusterConf.AuthCACertPath},
+		{"CIAO_AUTH_ADMIN_CERT", clusterConf.AuthAdminCertPath},
+	}
+
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", p.name, p.path)
+	}
+
+	return b.Bytes()
+}
+
+// GenerateConfiguration renders the systemd unit files, the cluster
+// configuration and the environment files that setup and join would install
+// into outDir without installing anything, so that they can be deployed by
+// other tools.  The unit files are grouped by the kind of node they belong
+// on.  The image service is part of the controller and so has no unit of
+// its own.
+func GenerateConfiguration(outDir string, clusterConf *ClusterConfiguration) error {
+	// Refer to the locations the certificates are copied to by setup
+	if clusterConf.HTTPSCaCertPath != "" {
+		clusterConf.HTTPSCaCertPath = filepath.Join(ciaoLocalCertsDir, filepath.Base(clusterConf.HTTPSCaCertPath))
+	}
+	if clusterConf.HTTPSCertPath != "" {
+		clusterConf.HTTPSCertPath = filepath.Join(ciaoLocalCertsDir, filepath.Base(clusterConf.HTTPSCertPath))
+	}
+	clusterConf.AuthCACertPath = path.Join(ciaoPKIDir, "auth-CA.pem")
+	clusterConf.AuthAdminCertPath = path.Join(ciaoPKIDir, "auth-admin.pem")
+
+	for _, node := range generatedNodes() {
+		for _, unit := range node.units {
+			serviceData, osPrepareData, err := generateUnitFiles(unit)
+			if err != nil {
+				return err
+			}
+
+			serviceName := filepath.Join(node.dir, fmt.Sprintf("%s.service", unit.Tool))
+			if err := writeGeneratedFile(outDir, serviceName, serviceData.Bytes()); err != nil {
+				return err
+			}
+
+			osPrepareName := filepath.Join(node.dir, fmt.Sprintf("%s-prepare.service", unit.Tool))
+			if err := writeGeneratedFile(outDir, osPrepareName, osPrepareData.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	cnciServicePath := InGoPath("/src/github.com/ciao-project/ciao/networking/ciao-cnci-agent/scripts/ciao-cnci-agent.service")
+	cnciServiceData, err := ioutil.ReadFile(cnciServicePath)
+	if err != nil {
+		return errors.Wrap(err, "Error reading CNCI agent service file")
+	}
+	if err := writeGeneratedFile(outDir, filepath.Join("cnci", "ciao-cnci-agent.service"), cnciServiceData); err != nil {
+		return err
+	}
+
+	configData, err := generateConfigurationData(clusterConf, path.Join(ciaoConfigDir, "configuration.yaml"))
+	if err != nil {
+		return errors.Wrap(err, "Error generating cluster configuration")
+	}
+	if err := writeGeneratedFile(outDir, "configuration.yaml", configData); err != nil {
+		return err
+	}
+
+	if err := writeGeneratedFile(outDir, "ciao.env", generateEnvironmentData(clusterConf)); err != nil {
+		return err
+	}
+
+	return writeGeneratedFile(outDir, "tls-paths.env", generateTLSPathsData(clusterConf))
+}
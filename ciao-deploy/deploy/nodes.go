@@ -195,6 +195,20 @@ func createRemoteCiaoDirectory(ctx context.Context, hostname, sshUser, path stri
 	return nil
 }
 
+func launcherUnitConf(certPath string, caCertPath string, roles []string) unitFileConf {
+	return unitFileConf{
+		Tool:       "ciao-launcher",
+		User:       ciaoUser,
+		CertPath:   certPath,
+		CACertPath: caCertPath,
+		Caps:       launcherCaps,
+		Roles:      roles,
+		Deps: []string{
+			"docker.service",
+		},
+	}
+}
+
 func setupNode(ctx context.Context, anchorCertPath string, caCertPath string, hostname string, sshUser string, networkNode bool) (errOut error) {
 	status, err := SSHRunCommandWithStatus(ctx, sshUser, hostname,
 		fmt.Sprintf("sudo useradd -r %s -G docker,kvm -d %s -s /bin/false", ciaoUser, ciaoDataDir))
@@ -259,18 +273,7 @@ func setupNode(ctx context.Context, anchorCertPath string, caCertPath string, ho
 		}
 	}()
 
-	err = InstallToolRemote(ctx, sshUser, hostname, unitFileConf{
-		Tool:       "ciao-launcher",
-		User:       ciaoUser,
-		CertPath:   remoteCertPath,
-		CACertPath: caCertPath,
-		Caps: []string{"CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_DAC_OVERRIDE",
-			"CAP_SETGID", "CAP_SETUID", "CAP_SYS_PTRACE", "CAP_SYS_MODULE"},
-		Roles: roles,
-		Deps: []string{
-			"docker.service",
-		},
-	})
+	err = InstallToolRemote(ctx, sshUser, hostname, launcherUnitConf(remoteCertPath, caCertPath, roles))
 	if err != nil {
 		return errors.Wrap(err, "Error installing tool on node")
 	}
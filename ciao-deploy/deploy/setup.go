@@ -75,18 +75,16 @@ var ciaoPKIDir = "/etc/pki/ciao"
 var ciaoUser = "ciao"
 var ciaoUserAndGroup = ciaoUser + ":" + ciaoUser
 
-func createConfigurationFile(ctx context.Context, clusterConf *ClusterConfiguration) (string, error) {
+func generateConfigurationData(clusterConf *ClusterConfiguration, ciaoConfigPath string) ([]byte, error) {
 	var adminSSHKeyData string
 	if clusterConf.AdminSSHKeyPath != "" {
 		buf, err := ioutil.ReadFile(clusterConf.AdminSSHKeyPath)
 		if err != nil {
-			return "", errors.Wrap(err, "Error reading SSH key path")
+			return nil, errors.Wrap(err, "Error reading SSH key path")
 		}
 		adminSSHKeyData = strings.TrimSpace(string(buf))
 	}
 
-	ciaoConfigPath := path.Join(ciaoConfigDir, "configuration.yaml")
-
 	config := &payloads.Configure{}
 	config.InitDefaults()
 	config.Configure.Scheduler.ConfigStorageURI = ciaoConfigPath
@@ -124,7 +122,18 @@ func createConfigurationFile(ctx context.Context, clusterConf *ClusterConfigurat
 
 	data, err := yaml.Marshal(config)
 	if err != nil {
-		return "", errors.Wrap(err, "Error creating marshalling configuration data")
+		return nil, errors.Wrap(err, "Error creating marshalling configuration data")
+	}
+
+	return data, nil
+}
+
+func createConfigurationFile(ctx context.Context, clusterConf *ClusterConfiguration) (string, error) {
+	ciaoConfigPath := path.Join(ciaoConfigDir, "configuration.yaml")
+
+	data, err := generateConfigurationData(clusterConf, ciaoConfigPath)
+	if err != nil {
+		return "", err
 	}
 
 	f, err := ioutil.TempFile("", "configuration.yaml")
@@ -271,6 +280,20 @@ KillMode=control-group
 WantedBy=multi-user.target
 `
 
+func generateUnitFiles(config unitFileConf) (serviceData bytes.Buffer, osPrepareData bytes.Buffer, err error) {
+	err = template.Must(template.New("unit-service").Parse(systemdServiceData)).Execute(&serviceData, config)
+	if err != nil {
+		return serviceData, osPrepareData, errors.Wrapf(err, "Error generating service systemd file for %s", config.Tool)
+	}
+
+	err = template.Must(template.New("unit-osprepare").Parse(systemdOsPrepareData)).Execute(&osPrepareData, config)
+	if err != nil {
+		return serviceData, osPrepareData, errors.Wrapf(err, "Error generating osprepare systemd file for %s", config.Tool)
+	}
+
+	return serviceData, osPrepareData, nil
+}
+
 func installUnitFile(ctx context.Context, unitName, serviceFilePath string, data *bytes.Buffer) error {
 	fmt.Printf("Installing systemd unit file %s\n", unitName)
 
@@ -310,17 +333,9 @@ func startAndEnableService(ctx context.Context, unitName string) error {
 
 // InstallTool installs a tool to its final destination and manages it via systemd
 func InstallTool(ctx context.Context, config unitFileConf) (errOut error) {
-	var serviceData bytes.Buffer
-	var osPrepareData bytes.Buffer
-
-	err := template.Must(template.New("unit-service").Parse(systemdServiceData)).Execute(&serviceData, config)
+	serviceData, osPrepareData, err := generateUnitFiles(config)
 	if err != nil {
-		return errors.Wrapf(err, "Error generating service systemd file for %s", config.Tool)
-	}
-
-	err = template.Must(template.New("unit-osprepare").Parse(systemdOsPrepareData)).Execute(&osPrepareData, config)
-	if err != nil {
-		return errors.Wrapf(err, "Error generating osprepare systemd file for %s", config.Tool)
+		return err
 	}
 
 	osPrepareName := fmt.Sprintf("%s-prepare", config.Tool)
@@ -757,17 +772,26 @@ func SetupLocalLauncher(ctx context.Context) (errOut error) {
 	return nil
 }
 
-// UpdateMaster updates the running one the master
-func UpdateMaster(ctx context.Context) error {
+// UpdateMaster updates the running one the master. If rollback is set the
+// services that fail their health check after the update are reverted to
+// their previously deployed version.
+func UpdateMaster(ctx context.Context, rollback bool) error {
 	anchorCertPath := path.Join(ciaoPKIDir, CertName(ssntp.SCHEDULER))
 	controllerCertPath := path.Join(ciaoPKIDir, CertName(ssntp.Controller))
 	caCertPath := path.Join(ciaoPKIDir, "CAcert.pem")
+	target := localTarget()
 
-	if err := installScheduler(ctx, anchorCertPath, caCertPath); err != nil {
+	err := upgradeTool(ctx, target, "ciao-scheduler", rollback, func() error {
+		return installScheduler(ctx, anchorCertPath, caCertPath)
+	})
+	if err != nil {
 		return errors.Wrap(err, "Error installating scheduler")
 	}
 
-	if err := installController(ctx, controllerCertPath, caCertPath); err != nil {
+	err = upgradeTool(ctx, target, "ciao-controller", rollback, func() error {
+		return installController(ctx, controllerCertPath, caCertPath)
+	})
+	if err != nil {
 		return errors.Wrap(err, "Error installng controller")
 	}
 
@@ -0,0 +1,218 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ciao-project/ciao/ssntp"
+	"github.com/pkg/errors"
+)
+
+// previousSuffix is appended to the installed binary and unit files of a
+// tool to record the version that was deployed before an upgrade.
+const previousSuffix = ".previous"
+
+// HealthCheckDelay is how long an upgraded service must stay active before
+// the upgrade is considered successful
+var HealthCheckDelay = 10 * time.Second
+
+// upgradeTarget is the node on which a tool is upgraded
+type upgradeTarget struct {
+	name string
+	run  func(ctx context.Context, command string) error
+}
+
+func localTarget() upgradeTarget {
+	return upgradeTarget{
+		name: HostnameWithFallback(),
+		run: func(ctx context.Context, command string) error {
+			cmd := exec.CommandContext(ctx, "sh", "-c", command)
+			if err := cmd.Run(); err != nil {
+				return errors.Wrapf(err, "Error running: %s", command)
+			}
+			return nil
+		},
+	}
+}
+
+func remoteTarget(sshUser string, hostname string) upgradeTarget {
+	return upgradeTarget{
+		name: hostname,
+		run: func(ctx context.Context, command string) error {
+			return SSHRunCommand(ctx, sshUser, hostname, command)
+		},
+	}
+}
+
+func toolFiles(tool string) []string {
+	return []string{
+		path.Join("/usr/local/bin", tool),
+		path.Join("/etc/systemd/system", fmt.Sprintf("%s.service", tool)),
+		path.Join("/etc/systemd/system", fmt.Sprintf("%s-prepare.service", tool)),
+	}
+}
+
+// backupTool records the currently deployed binary and unit files of the
+// tool. Files that are not yet installed have their previous version
+// removed so that a rollback uninstalls them.
+func backupTool(ctx context.Context, target upgradeTarget, tool string) error {
+	fmt.Printf("%s: Recording deployed version of %s\n", target.name, tool)
+	for _, f := range toolFiles(tool) {
+		prev := f + previousSuffix
+		err := target.run(ctx, fmt.Sprintf("sudo sh -c 'if [ -e %s ]; then cp -p %s %s; else rm -f %s; fi'",
+			f, f, prev, prev))
+		if err != nil {
+			return errors.Wrapf(err, "Error recording previous version of %s", f)
+		}
+	}
+	return nil
+}
+
+// checkToolHealth checks that the service of the tool is still active once
+// HealthCheckDelay has elapsed.
+func checkToolHealth(ctx context.Context, target upgradeTarget, tool string) error {
+	fmt.Printf("%s: Checking health of %s\n", target.name, tool)
+	select {
+	case <-time.After(HealthCheckDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	err := target.run(ctx, fmt.Sprintf("systemctl is-active --quiet %s", tool))
+	if err != nil {
+		return errors.Errorf("%s is not active after upgrade", tool)
+	}
+	return nil
+}
+
+// rollbackTool restores the binary and unit files recorded by backupTool
+// and restarts the tool.
+func rollbackTool(ctx context.Context, target upgradeTarget, tool string) error {
+	fmt.Printf("%s: Rolling back %s\n", target.name, tool)
+	osPrepareName := fmt.Sprintf("%s-prepare", tool)
+
+	_ = target.run(ctx, fmt.Sprintf("sudo systemctl stop %s", tool))
+	_ = target.run(ctx, fmt.Sprintf("sudo systemctl stop %s", osPrepareName))
+
+	for _, f := range toolFiles(tool) {
+		prev := f + previousSuffix
+		err := target.run(ctx, fmt.Sprintf("sudo sh -c 'if [ -e %s ]; then cp -p %s %s; else rm -f %s; fi'",
+			prev, prev, f, f))
+		if err != nil {
+			return errors.Wrapf(err, "Error restoring previous version of %s", f)
+		}
+	}
+
+	if err := target.run(ctx, "sudo systemctl daemon-reload"); err != nil {
+		return errors.Wrap(err, "Error reloading systemd unit files")
+	}
+
+	for _, unit := range []string{osPrepareName, tool} {
+		if err := target.run(ctx, fmt.Sprintf("sudo systemctl enable %s", unit)); err != nil {
+			return errors.Wrapf(err, "Error enabling %s", unit)
+		}
+		if err := target.run(ctx, fmt.Sprintf("sudo systemctl restart %s", unit)); err != nil {
+			return errors.Wrapf(err, "Error restarting %s", unit)
+		}
+	}
+
+	return checkToolHealth(ctx, target, tool)
+}
+
+// upgradeTool records the deployed version of the tool, installs the new
+// one and checks its health. If the upgrade fails and rollback is set the
+// recorded version is restored.
+func upgradeTool(ctx context.Context, target upgradeTarget, tool string, rollback bool, install func() error) error {
+	if rollback {
+		if err := backupTool(ctx, target, tool); err != nil {
+			return err
+		}
+	}
+
+	err := install()
+	if err == nil {
+		err = checkToolHealth(ctx, target, tool)
+	}
+	if err == nil || !rollback {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: Upgrade of %s failed: %v\n", target.name, tool, err)
+
+	// The upgrade may have been interrupted so do not let the context
+	// prevent the node from being restored.
+	if rbErr := rollbackTool(context.Background(), target, tool); rbErr != nil {
+		return errors.Wrapf(rbErr, "Error rolling back %s after failed upgrade (%v)", tool, err)
+	}
+
+	fmt.Printf("%s: Rolled back %s to previous version\n", target.name, tool)
+	return errors.Wrapf(err, "Upgrade of %s rolled back", tool)
+}
+
+func upgradeNode(ctx context.Context, sshUser string, hostname string, rollback bool) error {
+	caCertPath := path.Join(ciaoPKIDir, "CAcert.pem")
+
+	// The role of the node is only recorded by the name of its certificate
+	var role ssntp.Role = ssntp.AGENT
+	roles := []string{"agent"}
+	var networkAgentRole ssntp.Role = ssntp.NETAGENT
+	networkAgentCertPath := path.Join(ciaoPKIDir, fmt.Sprintf("cert-%s-%s.pem", networkAgentRole.String(), hostname))
+	if SSHRunCommand(ctx, sshUser, hostname, fmt.Sprintf("test -e %s", networkAgentCertPath)) == nil {
+		role = ssntp.NETAGENT
+		roles = []string{"net-agent"}
+	}
+	certPath := path.Join(ciaoPKIDir, fmt.Sprintf("cert-%s-%s.pem", role.String(), hostname))
+
+	target := remoteTarget(sshUser, hostname)
+	return upgradeTool(ctx, target, "ciao-launcher", rollback, func() error {
+		return InstallToolRemote(ctx, sshUser, hostname, launcherUnitConf(certPath, caCertPath, roles))
+	})
+}
+
+// UpgradeNodes upgrades the launcher on the given nodes. Nodes on which the
+// upgraded launcher fails its health check are rolled back to the previously
+// deployed version if rollback is set.
+func UpgradeNodes(ctx context.Context, sshUser string, rollback bool, hosts []string) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	failed := 0
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(hostname string) {
+			err := upgradeNode(ctx, sshUser, hostname, rollback)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error upgrading node: %s: %v\n", hostname, err)
+				mutex.Lock()
+				failed++
+				mutex.Unlock()
+			}
+			wg.Done()
+		}(host)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return errors.Errorf("Upgrade failed on %d of %d nodes", failed, len(hosts))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	statsSocket  = "stats-socket"
+	statsTimeout = 5 * time.Second
+)
+
+// blockStats is the part of a query-blockstats reply we are interested in.
+// The stats of each device describe the I/O performed by the guest.  The
+// parent layers, e.g., the rbd protocol, are ignored as they would count
+// the same I/O again.
+type blockStats []struct {
+	Device string `json:"device"`
+	Stats  struct {
+		ReadBytes  int64 `json:"rd_bytes"`
+		WriteBytes int64 `json:"wr_bytes"`
+	} `json:"stats"`
+}
+
+// sum returns the number of bytes read and written by all the devices.
+func (bs blockStats) sum() (readBytes, writeBytes int64) {
+	for _, d := range bs {
+		readBytes += d.Stats.ReadBytes
+		writeBytes += d.Stats.WriteBytes
+	}
+	return
+}
+
+// qmpBlockStats returns the number of bytes read and written by the block
+// devices of a VM.  The volumes of a VM are accessed by qemu through librbd
+// so the I/O of the qemu process does not account for them; the counters
+// are obtained from qemu with query-blockstats instead.  The query is sent
+// over a QMP socket of its own, as the monitor socket is held by the monitor
+// go routine.  -1 is returned if qemu cannot be reached.
+func qmpBlockStats(instanceDir string) (readBytes, writeBytes int64) {
+	socket := path.Join(instanceDir, statsSocket)
+	conn, err := net.DialTimeout("unix", socket, statsTimeout)
+	if err != nil {
+		if glog.V(1) {
+			glog.Warningf("Unable to connect to %s: %v", socket, err)
+		}
+		return -1, -1
+	}
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetDeadline(time.Now().Add(statsTimeout))
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	var greeting map[string]interface{}
+	if err := dec.Decode(&greeting); err != nil {
+		glog.Warningf("Unable to read QMP greeting from %s: %v", socket, err)
+		return -1, -1
+	}
+
+	if err := qmpRawCommand(enc, dec, "qmp_capabilities", nil, nil); err != nil {
+		glog.Warningf("Unable to negotiate QMP capabilities on %s: %v", socket, err)
+		return -1, -1
+	}
+
+	var stats blockStats
+	if err := qmpRawCommand(enc, dec, "query-blockstats", nil, &stats); err != nil {
+		glog.Warningf("Unable to query block stats on %s: %v", socket, err)
+		return -1, -1
+	}
+
+	return stats.sum()
+}
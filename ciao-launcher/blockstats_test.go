@@ -0,0 +1,110 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+const blockStatsReply = `{"return": [
+	{"device": "drive-virtio-disk0",
+	 "stats": {"rd_bytes": 1048576, "wr_bytes": 4096, "rd_operations": 256, "wr_operations": 1},
+	 "parent": {"stats": {"rd_bytes": 2097152, "wr_bytes": 8192}}},
+	{"device": "d_1f3c6a42a9b4b079d361b6d3a2b0f1e",
+	 "stats": {"rd_bytes": 512, "wr_bytes": 1024}}
+]}`
+
+// serveQMP accepts a single QMP connection on socket, greets the client
+// and answers each of its commands with the next of replies.
+func serveQMP(t *testing.T, socket string, replies ...string) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer func() { _ = l.Close() }()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = fmt.Fprintln(conn, `{"QMP": {"version": {}, "capabilities": []}}`)
+		scanner := bufio.NewScanner(conn)
+		for _, reply := range replies {
+			if !scanner.Scan() {
+				return
+			}
+			_, _ = fmt.Fprintln(conn, `{"event": "RESUME"}`)
+			_, _ = fmt.Fprintln(conn, reply)
+		}
+	}()
+}
+
+// Checks the block counters are obtained from query-blockstats.
+//
+// A fake QMP server answers query-blockstats with the stats of two devices,
+// one of which has a parent layer.
+//
+// The counters of both devices are summed and the parent layer is ignored.
+func TestQMPBlockStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	serveQMP(t, path.Join(dir, statsSocket), `{"return": {}}`, blockStatsReply)
+
+	read, write := qmpBlockStats(dir)
+	if read != 1049088 || write != 5120 {
+		t.Errorf("Unexpected block stats %d %d, expected 1049088 5120", read, write)
+	}
+}
+
+// Checks the block counters are unknown when qemu cannot be reached.
+//
+// qmpBlockStats is called for an instance without a stats socket and for
+// one whose qemu fails the query.
+//
+// -1 is returned in both cases.
+func TestQMPBlockStatsUnknown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if read, write := qmpBlockStats(dir); read != -1 || write != -1 {
+		t.Errorf("Expected unknown block stats, got %d %d", read, write)
+	}
+
+	serveQMP(t, path.Join(dir, statsSocket), `{"return": {}}`,
+		`{"error": {"class": "GenericError", "desc": "failed"}}`)
+
+	if read, write := qmpBlockStats(dir); read != -1 || write != -1 {
+		t.Errorf("Expected unknown block stats, got %d %d", read, write)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ciao-project/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/intel/govmm/qemu"
+)
+
+const (
+	qemuLogFile    = "qemu.log"
+	dumpSocket     = "dump-socket"
+	memoryDumpFile = "memory.elf"
+	stderrTailSize = 4096
+	dumpTimeout    = 10 * time.Minute
+
+	exitEventsTimeout = 5 * time.Second
+)
+
+// qmpExitState records the QMP events which tell us how a VM went down.
+// It is written by the monitor go routines and read by the instance go
+// routine once the VM is lost, so its fields are accessed atomically.
+// done is closed once no more events will be recorded.
+type qmpExitState struct {
+	monitored int32
+	shutdown  int32
+	panicked  int32
+	dumped    int32
+	done      chan struct{}
+}
+
+func newQMPExitState() *qmpExitState {
+	return &qmpExitState{done: make(chan struct{})}
+}
+
+// wait waits for the events of a VM which has gone down to be recorded and
+// returns false if the VM's events were never monitored.
+func (s *qmpExitState) wait() bool {
+	select {
+	case <-s.done:
+	case <-time.After(exitEventsTimeout):
+		glog.Warning("Timed out waiting for QMP events")
+	}
+	return atomic.LoadInt32(&s.monitored) != 0
+}
+
+func (s *qmpExitState) shutdownSeen() bool {
+	return atomic.LoadInt32(&s.shutdown) != 0
+}
+
+func (s *qmpExitState) guestPanicked() bool {
+	return atomic.LoadInt32(&s.panicked) != 0
+}
+
+func (s *qmpExitState) memoryDumped() bool {
+	return atomic.LoadInt32(&s.dumped) != 0
+}
+
+// qmpRawCommand sends a QMP command and waits for its result, skipping any
+// events received in the meantime.  The result is decoded into result
+// unless it is nil.
+func qmpRawCommand(enc *json.Encoder, dec *json.Decoder, cmd string, args map[string]interface{},
+	result interface{}) error {
+	req := map[string]interface{}{"execute": cmd}
+	if args != nil {
+		req["arguments"] = args
+	}
+
+	if err := enc.Encode(req); err != nil {
+		return err
+	}
+
+	for {
+		var resp struct {
+			Return json.RawMessage `json:"return"`
+			Error  *struct {
+				Class string `json:"class"`
+				Desc  string `json:"desc"`
+			} `json:"error"`
+			Event string `json:"event"`
+		}
+
+		if err := dec.Decode(&resp); err != nil {
+			return err
+		}
+
+		if resp.Event != "" {
+			continue
+		}
+
+		if resp.Error != nil {
+			return fmt.Errorf("%s failed: %s", cmd, resp.Error.Desc)
+		}
+
+		if result != nil {
+			return json.Unmarshal(resp.Return, result)
+		}
+
+		return nil
+	}
+}
+
+// dumpGuestMemoryAndQuit dumps the memory of a panicked guest into its
+// instance directory and then terminates qemu.  The dump is performed over
+// a second QMP socket so that it does not interfere with the monitor.
+func dumpGuestMemoryAndQuit(instanceDir string, exit *qmpExitState) {
+	socket := path.Join(instanceDir, dumpSocket)
+	conn, err := net.DialTimeout("unix", socket, time.Second*10)
+	if err != nil {
+		glog.Warningf("Unable to connect to %s: %v", socket, err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetDeadline(time.Now().Add(dumpTimeout))
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	var greeting map[string]interface{}
+	if err := dec.Decode(&greeting); err != nil {
+		glog.Warningf("Unable to read QMP greeting from %s: %v", socket, err)
+		return
+	}
+
+	if err := qmpRawCommand(enc, dec, "qmp_capabilities", nil, nil); err != nil {
+		glog.Warningf("Unable to negotiate QMP capabilities on %s: %v", socket, err)
+		return
+	}
+
+	dumpPath := path.Join(instanceDir, memoryDumpFile)
+	err = qmpRawCommand(enc, dec, "dump-guest-memory", map[string]interface{}{
+		"paging":   false,
+		"protocol": "file:" + dumpPath,
+	}, nil)
+	if err != nil {
+		glog.Warningf("Unable to dump guest memory to %s: %v", dumpPath, err)
+	} else {
+		glog.Infof("Guest memory dumped to %s", dumpPath)
+		atomic.StoreInt32(&exit.dumped, 1)
+	}
+
+	if err := qmpRawCommand(enc, dec, "quit", nil, nil); err != nil && err != io.EOF {
+		glog.Warningf("Unable to terminate panicked instance: %v", err)
+	}
+}
+
+// monitorQMPEvents records the events which tell us how a VM went down.
+// A guest panic is only reported if the VM has a pvpanic device, which is
+// the case when crash dumps are enabled.  qemu pauses panicked guests so
+// it is terminated once the memory of the guest has been dumped.
+func monitorQMPEvents(eventCh <-chan qemu.QMPEvent, instanceDir string, exit *qmpExitState,
+	wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(exit.done)
+
+	atomic.StoreInt32(&exit.monitored, 1)
+
+	for ev := range eventCh {
+		switch ev.Name {
+		case "SHUTDOWN":
+			atomic.StoreInt32(&exit.shutdown, 1)
+		case "GUEST_PANICKED":
+			if !atomic.CompareAndSwapInt32(&exit.panicked, 0, 1) {
+				continue
+			}
+			glog.Warningf("Guest in %s panicked", instanceDir)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dumpGuestMemoryAndQuit(instanceDir, exit)
+			}()
+		}
+	}
+}
+
+func tailFile(filePath string, size int64) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if fi.Size() > size {
+		if _, err := f.Seek(-size, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := ioutil.ReadAll(f)
+	return string(data), err
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// removeCrashArtifacts deletes the artifacts of all the crashes of an
+// instance.
+func removeCrashArtifacts(instance string) {
+	crashDir := path.Join(crashesDir, instance)
+	if err := os.RemoveAll(crashDir); err != nil {
+		glog.Warningf("Unable to remove crash artifacts %s: %v", crashDir, err)
+	}
+}
+
+// collectQEMUCrash stores the artifacts of a crashed qemu instance in the
+// crash directory of the instance, which unlike the instance directory is
+// preserved when the crashed instance is stopped.
+func collectQEMUCrash(crashDir, instanceDir, exitStatus string, dumped bool) (*payloads.InstanceCrash, error) {
+	dir := path.Join(crashDir, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("Unable to create crash directory %s: %v", dir, err)
+	}
+
+	crash := &payloads.InstanceCrash{
+		ExitStatus: exitStatus,
+		Artifacts:  dir,
+	}
+
+	err := ioutil.WriteFile(path.Join(dir, "exit_status"), []byte(exitStatus+"\n"), 0640)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to record exit status: %v", err)
+	}
+
+	logPath := path.Join(instanceDir, qemuLogFile)
+	if err := copyFile(path.Join(dir, "stderr.log"), logPath); err != nil {
+		glog.Warningf("Unable to copy %s: %v", logPath, err)
+	} else if crash.Stderr, err = tailFile(logPath, stderrTailSize); err != nil {
+		glog.Warningf("Unable to read %s: %v", logPath, err)
+	}
+
+	if dumped {
+		dumpPath := path.Join(instanceDir, memoryDumpFile)
+		if err := os.Rename(dumpPath, path.Join(dir, memoryDumpFile)); err != nil {
+			glog.Warningf("Unable to store memory dump %s: %v", dumpPath, err)
+		} else {
+			crash.MemoryDump = true
+		}
+	}
+
+	return crash, nil
+}
@@ -0,0 +1,111 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/intel/govmm/qemu"
+)
+
+// Checks that the QMP events of a VM are recorded.
+//
+// A SHUTDOWN event is sent to monitorQMPEvents and the event channel is
+// closed.  The test checks that the shutdown is recorded and that the
+// guest is not reported as having panicked.
+func TestMonitorQMPEvents(t *testing.T) {
+	var wg sync.WaitGroup
+
+	eventCh := make(chan qemu.QMPEvent, 1)
+	exit := newQMPExitState()
+
+	wg.Add(1)
+	go monitorQMPEvents(eventCh, "/tmp/testInstance", exit, &wg)
+	eventCh <- qemu.QMPEvent{Name: "SHUTDOWN"}
+	close(eventCh)
+	wg.Wait()
+
+	if !exit.wait() {
+		t.Errorf("Events not monitored")
+	}
+
+	if !exit.shutdownSeen() || exit.guestPanicked() || exit.memoryDumped() {
+		t.Errorf("Unexpected exit state %+v", exit)
+	}
+}
+
+// Checks that the artifacts of a crashed VM are collected.
+//
+// A fake qemu log and memory dump are created in an instance directory and
+// collectQEMUCrash is called.  The test checks that the exit status, log
+// and memory dump are stored in the crash directory and that the stderr
+// reported to the controller is the tail of the log.
+func TestCollectQEMUCrash(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "crash-test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	instanceDir := path.Join(tmpDir, "instance")
+	crashDir := path.Join(tmpDir, "crashes")
+	if err := os.MkdirAll(instanceDir, 0755); err != nil {
+		t.Fatalf("Unable to create %s: %v", instanceDir, err)
+	}
+
+	log := strings.Repeat("x", stderrTailSize) + "qemu: fatal error\n"
+	err = ioutil.WriteFile(path.Join(instanceDir, qemuLogFile), []byte(log), 0644)
+	if err != nil {
+		t.Fatalf("Unable to write qemu log: %v", err)
+	}
+
+	err = ioutil.WriteFile(path.Join(instanceDir, memoryDumpFile), []byte("ELF"), 0644)
+	if err != nil {
+		t.Fatalf("Unable to write memory dump: %v", err)
+	}
+
+	crash, err := collectQEMUCrash(crashDir, instanceDir, "guest panicked", true)
+	if err != nil {
+		t.Fatalf("Unable to collect crash: %v", err)
+	}
+
+	if crash.ExitStatus != "guest panicked" || !crash.MemoryDump ||
+		path.Dir(crash.Artifacts) != crashDir {
+		t.Errorf("Unexpected crash %+v", crash)
+	}
+
+	if len(crash.Stderr) != stderrTailSize || !strings.HasSuffix(crash.Stderr, "qemu: fatal error\n") {
+		t.Errorf("Expected stderr to be the tail of the qemu log")
+	}
+
+	for _, f := range []string{"exit_status", "stderr.log", memoryDumpFile} {
+		if _, err := os.Stat(path.Join(crash.Artifacts, f)); err != nil {
+			t.Errorf("Artifact %s not collected: %v", f, err)
+		}
+	}
+
+	if _, err := os.Stat(path.Join(instanceDir, memoryDumpFile)); err == nil {
+		t.Errorf("Memory dump not moved to crash directory")
+	}
+}
@@ -27,12 +27,12 @@ type deleteError struct {
 	code payloads.DeleteFailureReason
 }
 
-func (de *deleteError) send(conn serverConn, instance string) {
+func (de *deleteError) send(conn serverConn, instance, requestID string) {
 	if !conn.isConnected() {
 		return
 	}
 
-	payload, err := generateDeleteError(conn.UUID(), instance, de)
+	payload, err := generateDeleteError(conn.UUID(), instance, requestID, de)
 	if err != nil {
 		glog.Errorf("Unable to generate payload for delete_failure: %v", err)
 		return
@@ -25,19 +25,37 @@ import "github.com/ciao-project/ciao/osprepare"
 // fuser for qemu instance pid
 
 var launcherClearLinuxCommonDeps = []osprepare.PackageRequirement{
-	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "cloud-control"},
+	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "cloud-control", MinVersion: osprepare.MinQemuVersion},
 	{BinaryName: "/usr/bin/xorriso", PackageName: "cloud-control"},
 	{BinaryName: "/usr/sbin/fuser", PackageName: "cloud-control"},
 }
 
 var launcherFedoraCommonDeps = []osprepare.PackageRequirement{
-	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86"},
+	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86", MinVersion: osprepare.MinQemuVersion},
 	{BinaryName: "/usr/bin/xorriso", PackageName: "xorriso"},
 	{BinaryName: "/usr/sbin/fuser", PackageName: "psmisc"},
 }
 
 var launcherUbuntuCommonDeps = []osprepare.PackageRequirement{
-	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86"},
+	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86", MinVersion: osprepare.MinQemuVersion},
+	{BinaryName: "/usr/bin/xorriso", PackageName: "xorriso"},
+	{BinaryName: "/bin/fuser", PackageName: "psmisc"},
+}
+
+var launcherCentOSCommonDeps = []osprepare.PackageRequirement{
+	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86", MinVersion: osprepare.MinQemuVersion},
+	{BinaryName: "/usr/bin/xorriso", PackageName: "xorriso"},
+	{BinaryName: "/usr/sbin/fuser", PackageName: "psmisc"},
+}
+
+var launcherDebianCommonDeps = []osprepare.PackageRequirement{
+	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86", MinVersion: osprepare.MinQemuVersion},
+	{BinaryName: "/usr/bin/xorriso", PackageName: "xorriso"},
+	{BinaryName: "/bin/fuser", PackageName: "psmisc"},
+}
+
+var launcherOpenSUSECommonDeps = []osprepare.PackageRequirement{
+	{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-x86", MinVersion: osprepare.MinQemuVersion},
 	{BinaryName: "/usr/bin/xorriso", PackageName: "xorriso"},
 	{BinaryName: "/bin/fuser", PackageName: "psmisc"},
 }
@@ -50,6 +68,9 @@ var launcherNetNodeDeps = map[string][]osprepare.PackageRequirement{
 	"clearlinux": launcherClearLinuxCommonDeps,
 	"fedora":     launcherFedoraCommonDeps,
 	"ubuntu":     launcherUbuntuCommonDeps,
+	"centos":     launcherCentOSCommonDeps,
+	"debian":     launcherDebianCommonDeps,
+	"opensuse":   launcherOpenSUSECommonDeps,
 }
 
 var launcherComputeNodeDeps = map[string][]osprepare.PackageRequirement{
@@ -58,9 +79,21 @@ var launcherComputeNodeDeps = map[string][]osprepare.PackageRequirement{
 	// docker for containers
 
 	"clearlinux": append(launcherClearLinuxCommonDeps,
-		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "cloud-control"}),
+		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "cloud-control",
+			MinVersion: osprepare.MinDockerVersion}),
 	"fedora": append(launcherFedoraCommonDeps,
-		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker-engine"}),
+		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker-engine",
+			MinVersion: osprepare.MinDockerVersion}),
 	"ubuntu": append(launcherUbuntuCommonDeps,
-		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker-engine"}),
+		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker-engine",
+			MinVersion: osprepare.MinDockerVersion}),
+	"centos": append(launcherCentOSCommonDeps,
+		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker",
+			MinVersion: osprepare.MinDockerVersion}),
+	"debian": append(launcherDebianCommonDeps,
+		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker.io",
+			MinVersion: osprepare.MinDockerVersion}),
+	"opensuse": append(launcherOpenSUSECommonDeps,
+		osprepare.PackageRequirement{BinaryName: "/usr/bin/docker", PackageName: "docker",
+			MinVersion: osprepare.MinDockerVersion}),
 }
@@ -31,6 +31,7 @@ import (
 	"context"
 
 	storage "github.com/ciao-project/ciao/ciao-storage"
+	"github.com/ciao-project/ciao/payloads"
 
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/engine-api/client"
@@ -517,10 +518,11 @@ func (d *docker) computeInstanceDiskspace() int {
 	return int(*con.SizeRootFs / (1024 * 1024))
 }
 
-func (d *docker) stats() (disk, memory, cpu int) {
+func (d *docker) stats() (disk, memory, cpu int, counters ioStats) {
 	disk = d.computeInstanceDiskspace()
 	memory = -1
 	cpu = -1
+	counters = unknownIOStats()
 
 	if d.cfg == nil {
 		return
@@ -541,7 +543,7 @@ func (d *docker) stats() (disk, memory, cpu int) {
 	}
 	defer func() { _ = resp.Close() }()
 
-	var stats types.Stats
+	var stats types.StatsJSON
 	err = json.NewDecoder(resp).Decode(&stats)
 	if err != nil {
 		glog.Errorf("Unable to get stats from container: %s:%s %v", d.cfg.Instance, d.dockerID, err)
@@ -566,13 +568,59 @@ func (d *docker) stats() (disk, memory, cpu int) {
 	d.prevCPUTime = cpuTime
 	d.prevSampleTime = now
 
+	counters = computeContainerIOStats(&stats)
+
 	return
 }
 
+func computeContainerIOStats(stats *types.StatsJSON) ioStats {
+	counters := unknownIOStats()
+
+	if len(stats.Networks) > 0 {
+		counters.netRxBytes, counters.netTxBytes = 0, 0
+		counters.netRxPackets, counters.netTxPackets = 0, 0
+		for _, n := range stats.Networks {
+			counters.netRxBytes += int64(n.RxBytes)
+			counters.netTxBytes += int64(n.TxBytes)
+			counters.netRxPackets += int64(n.RxPackets)
+			counters.netTxPackets += int64(n.TxPackets)
+		}
+	}
+
+	if len(stats.BlkioStats.IoServiceBytesRecursive) > 0 {
+		counters.blockReadBytes, counters.blockWriteBytes = 0, 0
+		for _, e := range stats.BlkioStats.IoServiceBytesRecursive {
+			switch e.Op {
+			case "Read":
+				counters.blockReadBytes += int64(e.Value)
+			case "Write":
+				counters.blockWriteBytes += int64(e.Value)
+			}
+		}
+	}
+
+	return counters
+}
+
 func (d *docker) connected() {
 	d.prevCPUTime = -1
 }
 
+func (d *docker) exitReason() (payloads.InstanceLogReason, string, *payloads.InstanceCrash) {
+	con, err := d.cli.ContainerInspect(context.Background(), d.dockerID)
+	if err != nil || con.State == nil {
+		return payloads.InstanceExited, "container exited", nil
+	}
+
+	if con.State.OOMKilled {
+		return payloads.InstanceOOMKilled,
+			fmt.Sprintf("container %s was killed by the OOM killer", d.dockerID), nil
+	}
+
+	return payloads.InstanceExited,
+		fmt.Sprintf("container %s exited with code %d", d.dockerID, con.State.ExitCode), nil
+}
+
 func (d *docker) lostVM() {
 	d.prevCPUTime = -1
 
@@ -107,6 +107,10 @@ func (s dockerTestStorage) GetBlockDeviceSize(volumeUUID string) (uint64, error)
 	return 0, nil
 }
 
+func (s dockerTestStorage) ExportBlockDevice(string, io.Writer) error {
+	return nil
+}
+
 func (s dockerTestStorage) IsValidSnapshotUUID(string) error {
 	return nil
 }
@@ -196,6 +200,27 @@ func (d *dockerTestClient) ContainerStats(context.Context, string, bool) (io.Rea
   },
   "memory_stats" : {
      "usage" : 104857600
+  },
+  "blkio_stats" : {
+    "io_service_bytes_recursive" : [
+      { "major" : 8, "minor" : 0, "op" : "Read", "value" : 4096 },
+      { "major" : 8, "minor" : 0, "op" : "Write", "value" : 8192 },
+      { "major" : 8, "minor" : 0, "op" : "Total", "value" : 12288 }
+    ]
+  },
+  "networks" : {
+    "eth0" : {
+      "rx_bytes" : 1024,
+      "rx_packets" : 16,
+      "tx_bytes" : 2048,
+      "tx_packets" : 32
+    },
+    "eth1" : {
+      "rx_bytes" : 1024,
+      "rx_packets" : 16,
+      "tx_bytes" : 2048,
+      "tx_packets" : 32
+    }
   }
 }`)
 
@@ -842,7 +867,7 @@ func TestDockerStats(t *testing.T) {
 	tc := &dockerTestClient{}
 	d := &docker{dockerID: testutil.InstanceUUID, cfg: &vmConfig{}, cli: tc, prevCPUTime: -1}
 
-	disk, mem, cpu := d.stats()
+	disk, mem, cpu, counters := d.stats()
 	if mem != 100 {
 		t.Errorf("Expected memory usage of 100.  Got %d", mem)
 	}
@@ -855,7 +880,19 @@ func TestDockerStats(t *testing.T) {
 		t.Errorf("Expected cpu usage of -1.  Got %d", cpu)
 	}
 
-	_, _, cpu = d.stats()
+	expected := ioStats{
+		netRxBytes:      2048,
+		netTxBytes:      4096,
+		netRxPackets:    32,
+		netTxPackets:    64,
+		blockReadBytes:  4096,
+		blockWriteBytes: 8192,
+	}
+	if counters != expected {
+		t.Errorf("Expected I/O counters %+v.  Got %+v", expected, counters)
+	}
+
+	_, _, cpu, _ = d.stats()
 	if cpu != 0 {
 		t.Errorf("Expected cpu usage of 0.  Got %d", cpu)
 	}
@@ -172,6 +172,10 @@ func purgeLauncherState() {
 		glog.Warningf("Unable to delete instances dir %s: %v", instancesDir, err)
 	}
 
+	if err = os.RemoveAll(crashesDir); err != nil {
+		glog.Warningf("Unable to delete crashes dir %s: %v", crashesDir, err)
+	}
+
 	lockPath := path.Join(lockDir, lockFile)
 	if err = os.RemoveAll(lockPath); err != nil {
 		glog.Warningf("Unable to delete lock file %s: %v", lockPath, err)
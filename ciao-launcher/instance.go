@@ -74,6 +74,10 @@ type insDeleteCmd struct {
 	// two operations are almost identical for launcher.  The only difference
 	// is in the events that get sent back to controller.
 	stop bool
+
+	// The ID of the API request that caused the instance to be deleted,
+	// if any.
+	requestID string
 }
 type insMonitorCmd struct{}
 
@@ -128,14 +132,17 @@ func (id *instanceData) startCommand(cmd *insStartCmd) {
 	if id.monitorCh != nil {
 		startErr := &startError{nil, payloads.AlreadyRunning, cmd.cfg.Restart}
 		glog.Errorf("Unable to start instance[%s]", string(startErr.code))
-		startErr.send(id.ac.conn, id.instance)
+		startErr.send(id.ac.conn, id.instance, cmd.cfg.RequestID)
 		return
 	}
 	id.creating = true
 	st, startErr := processStart(cmd, id.instanceDir, id.vm, id.ac.conn)
 	if startErr != nil {
 		glog.Errorf("Unable to start instance[%s]: %v", string(startErr.code), startErr.err)
-		startErr.send(id.ac.conn, id.instance)
+		if startErr.code == payloads.ImageFailure && startErr.err != nil {
+			id.sendInstanceLogEvent(payloads.ImageFetchFailure, startErr.err.Error(), nil)
+		}
+		startErr.send(id.ac.conn, id.instance, cmd.cfg.RequestID)
 
 		if startErr.code != payloads.InstanceExists {
 			glog.Warningf("Unable to create VM instance: %s.  Killing it", id.instance)
@@ -152,7 +159,7 @@ func (id *instanceData) startCommand(cmd *insStartCmd) {
 	id.monitorCh = id.vm.monitorVM(id.monitorCloseCh, id.connectedCh, &id.instanceWg, false)
 	id.ovsCh <- &ovsStatusCmd{}
 	if cmd.frame != nil && cmd.frame.PathTrace() {
-		id.ovsCh <- &ovsTraceFrame{cmd.frame}
+		id.ovsCh <- &ovsTraceFrame{cmd.frame, id.instance}
 	}
 }
 
@@ -196,11 +203,32 @@ func (id *instanceData) sendInstanceStoppedEvent() {
 	}
 }
 
+func (id *instanceData) sendInstanceLogEvent(reason payloads.InstanceLogReason, message string,
+	crash *payloads.InstanceCrash) {
+	var event payloads.EventInstanceLog
+
+	event.InstanceLog.InstanceUUID = id.instance
+	event.InstanceLog.Reason = reason
+	event.InstanceLog.Message = message
+	event.InstanceLog.Crash = crash
+
+	payload, err := yaml.Marshal(&event)
+	if err != nil {
+		glog.Errorf("Unable to Marshall InstanceLog %v", err)
+		return
+	}
+	_, err = id.ac.conn.SendEvent(ssntp.InstanceLog, payload)
+	if err != nil {
+		glog.Errorf("Failed to send event command %v", err)
+		return
+	}
+}
+
 func (id *instanceData) deleteCommand(cmd *insDeleteCmd) bool {
 	if id.shuttingDown && !cmd.suicide {
 		deleteErr := &deleteError{nil, payloads.DeleteNoInstance}
 		glog.Errorf("Unable to delete instance[%s]", string(deleteErr.code))
-		deleteErr.send(id.ac.conn, id.instance)
+		deleteErr.send(id.ac.conn, id.instance, cmd.requestID)
 		return false
 	}
 
@@ -213,6 +241,11 @@ func (id *instanceData) deleteCommand(cmd *insDeleteCmd) bool {
 
 	_ = processDelete(id.vm, id.instanceDir, id.ac.conn, id.creating)
 
+	// The crash artifacts of an instance outlive it being stopped
+	if !cmd.stop {
+		removeCrashArtifacts(id.instance)
+	}
+
 	id.unmapVolumes()
 
 	if !cmd.skipDeleteEvent {
@@ -240,8 +273,7 @@ func (id *instanceData) attachVolumeCommand(cmd *insAttachVolumeCmd) {
 		attachErr.send(id.ac.conn, id.instance, cmd.volumeUUID)
 		return
 	}
-	d, m, c := id.vm.stats()
-	id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, id.getVolumes()}
+	id.sendStats()
 
 	glog.Infof("Volume %s attached to instance %s", cmd.volumeUUID, id.instance)
 }
@@ -317,12 +349,16 @@ func (id *instanceData) unmapVolumes() {
 	}
 }
 
+func (id *instanceData) sendStats() {
+	d, m, c, io := id.vm.stats()
+	id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, io, id.getVolumes()}
+}
+
 func (id *instanceData) instanceLoop() {
 
 	id.vm.init(id.cfg, id.instanceDir)
 
-	d, m, c := id.vm.stats()
-	id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, id.getVolumes()}
+	id.sendStats()
 
 DONE:
 	for {
@@ -330,8 +366,7 @@ DONE:
 		case <-id.doneCh:
 			break DONE
 		case <-id.statsTimer:
-			d, m, c := id.vm.stats()
-			id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, id.getVolumes()}
+			id.sendStats()
 			id.statsTimer = time.After(time.Second * resourcePeriod)
 		case cmd := <-id.cmdCh:
 			if !id.instanceCommand(cmd) {
@@ -339,9 +374,9 @@ DONE:
 			}
 		case <-id.monitorCloseCh:
 			// Means we've lost VM for now
+			id.sendInstanceLogEvent(id.vm.exitReason())
 			id.vm.lostVM()
-			d, m, c := id.vm.stats()
-			id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, id.getVolumes()}
+			id.sendStats()
 
 			glog.Infof("Lost VM instance: %s", id.instance)
 			id.monitorCloseCh = nil
@@ -358,8 +393,7 @@ DONE:
 			id.connectedCh = nil
 			id.vm.connected()
 			id.ovsCh <- &ovsStateChange{id.instance, ovsRunning}
-			d, m, c := id.vm.stats()
-			id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, id.getVolumes()}
+			id.sendStats()
 			id.statsTimer = time.After(time.Second * resourcePeriod)
 		}
 	}
@@ -51,6 +51,15 @@ var standardCfg = vmConfig{
 	VnicUUID:    "67d86208-b46c-0000-9018-fe14087d415f",
 }
 
+var testIOStats = ioStats{
+	netRxBytes:      1024,
+	netTxBytes:      2048,
+	netRxPackets:    16,
+	netTxPackets:    32,
+	blockReadBytes:  4096,
+	blockWriteBytes: 8192,
+}
+
 // instanceTestState implements virtualizer and serverConn
 type instanceTestState struct {
 	t               *testing.T
@@ -62,6 +71,7 @@ type instanceTestState struct {
 	deMigration     bool
 	de              payloads.EventInstanceDeleted
 	se              payloads.EventInstanceStopped
+	le              payloads.EventInstanceLog
 	connect         bool
 	monitorCh       chan interface{}
 	errorCh         chan struct{}
@@ -114,8 +124,8 @@ func (v *instanceTestState) monitorVM(closedCh chan struct{}, connectedCh chan s
 	return monitorCh
 }
 
-func (v *instanceTestState) stats() (disk, memory, cpu int) {
-	return v.statsArray[0], v.statsArray[1], v.statsArray[2]
+func (v *instanceTestState) stats() (disk, memory, cpu int, io ioStats) {
+	return v.statsArray[0], v.statsArray[1], v.statsArray[2], testIOStats
 }
 
 func (v *instanceTestState) connected() {
@@ -125,6 +135,10 @@ func (v *instanceTestState) connected() {
 func (v *instanceTestState) lostVM() {
 }
 
+func (v *instanceTestState) exitReason() (payloads.InstanceLogReason, string, *payloads.InstanceCrash) {
+	return payloads.InstanceExited, "test instance exited", nil
+}
+
 func (v *instanceTestState) SendError(error ssntp.Error, payload []byte) (int, error) {
 	switch error {
 	case ssntp.StartFailure:
@@ -165,6 +179,12 @@ func (v *instanceTestState) SendEvent(event ssntp.Event, payload []byte) (int, e
 		if err != nil {
 			v.t.Fatalf("Failed to unmarshall instanceStopped event %v", err)
 		}
+	case ssntp.InstanceLog:
+		err := yaml.Unmarshal(payload, &v.le)
+		if err != nil {
+			v.t.Fatalf("Failed to unmarshall instanceLog event %v", err)
+		}
+		return 0, nil
 	}
 
 	if v.eventCh != nil {
@@ -258,7 +278,8 @@ func (v *instanceTestState) expectStatsUpdate(t *testing.T, ovsCh <-chan interfa
 		return false
 	}
 	if stats.diskUsageMB != v.statsArray[0] || stats.memoryUsageMB != v.statsArray[1] ||
-		stats.CPUUsage != v.statsArray[2] || stats.instance != v.instance {
+		stats.CPUUsage != v.statsArray[2] || stats.io != testIOStats ||
+		stats.instance != v.instance {
 		t.Error("Incorrect statistics received")
 		return false
 	}
@@ -623,6 +644,11 @@ func TestStartBadImage(t *testing.T) {
 			string(state.stf.Reason), string(payloads.ImageFailure))
 	}
 
+	if state.le.InstanceLog.Reason != payloads.ImageFetchFailure {
+		t.Errorf("Incorrect instance log reason. Reported %s, expected %s",
+			string(state.le.InstanceLog.Reason), string(payloads.ImageFetchFailure))
+	}
+
 	select {
 	case acCmd := <-state.ac.cmdCh:
 		state.errorCh = make(chan struct{})
@@ -762,6 +788,11 @@ DONE:
 	}
 
 	wg.Wait()
+
+	if state.le.InstanceLog.Reason != payloads.InstanceExited ||
+		state.le.InstanceLog.InstanceUUID != cfg.Instance {
+		t.Errorf("Unexpected instance log event %+v", state.le.InstanceLog)
+	}
 }
 
 // Check we get an error when starting a running instance.
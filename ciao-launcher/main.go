@@ -87,11 +87,19 @@ var diskLimit bool
 var memLimit bool
 var cephID string
 var prepare bool
+var verifyDeps bool
+var pkgDir string
 var roles string
 var simulate bool
 var childProcessCreds *syscall.SysProcAttr
 var childProcessKVMCreds *syscall.SysProcAttr
 var maxInstances = int(math.MaxInt32)
+var statsInterval time.Duration
+var statsDelta bool
+var diskIOPS int
+var netBandwidthMbps int
+var crashDumps bool
+var connTrackTopTalkers int
 
 func init() {
 	flag.StringVar(&serverCertPath, "cacert", "", "Client certificate")
@@ -101,13 +109,21 @@ func init() {
 	flag.BoolVar(&simulate, "simulation", false, "Launcher simulation")
 	flag.StringVar(&cephID, "ceph_id", "", "ceph client id")
 	flag.BoolVar(&prepare, "osprepare", false, "Install dependencies")
+	flag.BoolVar(&verifyDeps, "osprepare-verify", false, "Report missing dependencies as JSON without installing them")
+	flag.StringVar(&pkgDir, "osprepare-pkgdir", "", "Install dependencies from a local package directory")
 	flag.StringVar(&roles, "roles", "agent", "Roles for which dependencies are to be installed")
+	flag.DurationVar(&statsInterval, "stats-interval", 0, "Interval between STATS frames, overrides the cluster configuration")
+	flag.IntVar(&diskIOPS, "disk-iops", 0, "Disk IOPS that can be reserved by instances, 0 for no limit")
+	flag.IntVar(&netBandwidthMbps, "net-bandwidth", 0, "Network bandwidth in Mbit/s that can be reserved by instances, 0 for no limit")
+	flag.IntVar(&connTrackTopTalkers, "conntrack-top-talkers", 0, "Number of top talkers to report for each instance from the conntrack table, 0 disables connection tracking statistics")
+	flag.BoolVar(&crashDumps, "crash-dump", false, "Dump the memory of VMs whose guest panics, requires pvpanic support in the guest")
 }
 
 const (
 	lockDir         = "/tmp/lock/ciao"
 	ciaoDir         = "/var/lib/ciao"
 	instancesDir    = ciaoDir + "/instances"
+	crashesDir      = ciaoDir + "/crashes"
 	dataDir         = ciaoDir + "/data/launcher/"
 	logDir          = ciaoDir + "/logs/launcher"
 	maintenanceFile = dataDir + "/maintenance"
@@ -116,33 +132,62 @@ const (
 	lockFile        = "client-agent.lock"
 	statsPeriod     = 6
 	resourcePeriod  = 30
+	fullStatsPeriod = 10
 )
 
-func installLauncherDeps(roles string, doneCh chan os.Signal) {
-	ctx, cancelFunc := context.WithCancel(context.Background())
+func launcherDepsForRoles(roles string) osprepare.PackageRequirements {
 	rolesSet := make(map[string]struct{})
 	for _, k := range strings.Split(roles, ",") {
 		rolesSet[k] = struct{}{}
 	}
 
+	launcherDeps := osprepare.NewPackageRequirements()
+
+	if _, ok := rolesSet["net-agent"]; ok {
+		launcherDeps.Append(launcherNetNodeDeps)
+	}
+	if _, ok := rolesSet["agent"]; ok {
+		launcherDeps.Append(launcherComputeNodeDeps)
+	}
+
+	return launcherDeps
+}
+
+func verifyLauncherDeps(roles string) int {
+	reqs := osprepare.NewPackageRequirements()
+	reqs.Append(osprepare.BootstrapRequirements)
+	reqs.Append(launcherDepsForRoles(roles))
+
+	if err := osprepare.ReportMissingDeps(os.Stdout, reqs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func installLauncherDeps(roles string, doneCh chan os.Signal) int {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	launcherDeps := launcherDepsForRoles(roles)
+
 	ch := make(chan error)
 	go func() {
 
 		logger := gloginterface.CiaoGlogLogger{}
-		osprepare.Bootstrap(ctx, logger)
-
-		launcherDeps := osprepare.NewPackageRequirements()
-
-		if _, ok := rolesSet["net-agent"]; ok {
-			launcherDeps.Append(launcherNetNodeDeps)
-		}
-		if _, ok := rolesSet["agent"]; ok {
-			launcherDeps.Append(launcherComputeNodeDeps)
+		var err error
+		if pkgDir != "" {
+			err = osprepare.BootstrapFromDir(ctx, pkgDir, logger)
+			if err == nil {
+				err = osprepare.InstallDepsFromDir(ctx, launcherDeps, pkgDir, logger)
+			}
+		} else {
+			err = osprepare.Bootstrap(ctx, logger)
+			if err == nil {
+				err = osprepare.InstallDeps(ctx, launcherDeps, logger)
+			}
 		}
 
-		osprepare.InstallDeps(ctx, launcherDeps, logger)
-
-		ch <- nil
+		ch <- err
 	}()
 
 	select {
@@ -150,12 +195,16 @@ func installLauncherDeps(roles string, doneCh chan os.Signal) {
 		glog.Info("Received terminating signal.  Cancelling installation of launcher dependencies.")
 		cancelFunc()
 		<-ch
+		return 1
 	case err := <-ch:
+		cancelFunc()
 		if err != nil {
 			glog.Errorf("Failed to install launcher dependencies: %v\n", err)
+			return 1
 		}
-		cancelFunc()
 	}
+
+	return 0
 }
 
 func insCmdChannel(instance string, ovsCh chan<- interface{}) chan<- interface{} {
@@ -234,7 +283,7 @@ func processInstanceCommand(conn serverConn, cmd *cmdWrapper, ovsCh chan<- inter
 					insCmd.cfg.Instance)
 			}
 			se := startError{nil, addResult.errorCode, insCmd.cfg.Restart}
-			se.send(conn, cmd.instance)
+			se.send(conn, cmd.instance, insCmd.cfg.RequestID)
 			return
 		}
 		target = addResult.cmdCh
@@ -244,7 +293,7 @@ func processInstanceCommand(conn serverConn, cmd *cmdWrapper, ovsCh chan<- inter
 		if target == nil {
 			glog.Errorf("Instance %s does not exist", cmd.instance)
 			de := deleteError{nil, payloads.DeleteNoInstance}
-			de.send(conn, cmd.instance)
+			de.send(conn, cmd.instance, insCmd.requestID)
 			return
 		}
 		delCmd = insCmd
@@ -297,6 +346,13 @@ func loadClusterConfig(conn serverConn) error {
 	netConfig.MgmtNet = clusterConfig.Configure.Launcher.ManagementNetwork
 	diskLimit = clusterConfig.Configure.Launcher.DiskLimit
 	memLimit = clusterConfig.Configure.Launcher.MemoryLimit
+	statsDelta = clusterConfig.Configure.Launcher.StatsDelta
+	if statsInterval <= 0 {
+		statsInterval = time.Duration(clusterConfig.Configure.Launcher.StatsInterval) * time.Second
+	}
+	if statsInterval <= 0 {
+		statsInterval = time.Second * statsPeriod
+	}
 	if cephID == "" {
 		cephID = clusterConfig.Configure.Storage.CephID
 	}
@@ -366,6 +422,12 @@ func printClusterConfig() {
 	glog.Infof("Disk Limit:           %v", diskLimit)
 	glog.Infof("Memory Limit:         %v", memLimit)
 	glog.Infof("Ceph ID:              %v", cephID)
+	glog.Infof("Stats Interval:       %v", statsInterval)
+	glog.Infof("Delta Stats:          %v", statsDelta)
+	glog.Infof("Disk IOPS:            %v", diskIOPS)
+	glog.Infof("Network Bandwidth:    %v", netBandwidthMbps)
+	glog.Infof("Crash Dumps:          %v", crashDumps)
+	glog.Infof("Conntrack Talkers:    %v", connTrackTopTalkers)
 	if childProcessCreds != nil {
 		glog.Infof("Credentials:          %d:%d",
 			childProcessCreds.Credential.Uid,
@@ -589,11 +651,16 @@ func main() {
 
 	flag.Parse()
 
+	if verifyDeps {
+		os.Exit(verifyLauncherDeps(roles))
+	}
+
 	if prepare {
 		signalCh := make(chan os.Signal, 1)
 		signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-		installLauncherDeps(roles, signalCh)
-		return
+		code := installLauncherDeps(roles, signalCh)
+		glog.Flush()
+		os.Exit(code)
 	}
 
 	if simulate == false && getLock() != nil {
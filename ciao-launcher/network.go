@@ -88,6 +88,7 @@ func initNetworkPhase1() error {
 		ComputeNet:    cnetList,
 		Mode:          libsnnet.GreTunnel,
 	}
+	cn.ConnTrackZones = connTrackTopTalkers > 0
 
 	libsnnet.CnMaxAPIConcurrency = 1
 	if err := cn.Init(); err != nil {
@@ -236,7 +237,7 @@ func createCNVnicCfg(cfg *vmConfig) (*libsnnet.VnicConfig, error) {
 		TenantID:   cfg.TenantUUID,
 		SubnetID:   cfg.SubnetIP,
 		ConcID:     cfg.ConcUUID,
-		Queues:     1,
+		Queues:     cfg.netQueues(),
 	}, nil
 }
 
@@ -21,12 +21,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/ciao-project/ciao/deviceinfo"
+	"github.com/ciao-project/ciao/networking/libsnnet"
 	"github.com/ciao-project/ciao/payloads"
 	"github.com/ciao-project/ciao/ssntp"
 	"github.com/golang/glog"
@@ -81,6 +83,7 @@ type ovsStatsUpdateCmd struct {
 	memoryUsageMB int
 	diskUsageMB   int
 	CPUUsage      int
+	io            ioStats
 	volumes       []string
 }
 
@@ -93,7 +96,8 @@ type ovsRestoreCmd struct {
 }
 
 type ovsTraceFrame struct {
-	frame *ssntp.Frame
+	frame    *ssntp.Frame
+	instance string
 }
 
 type ovsStatusCmd struct{}
@@ -145,11 +149,15 @@ type ovsInstanceState struct {
 	memoryUsageMB  int
 	diskUsageMB    int
 	CPUUsage       int
+	io             ioStats
 	maxDiskUsageMB int
 	maxVCPUs       int
 	maxMemoryMB    int
+	maxDiskIOPS    int
+	maxNetMbps     int
 	sshIP          string
 	sshPort        int
+	connTrackVnic  *libsnnet.VnicConfig
 	volumes        []string
 }
 
@@ -165,12 +173,19 @@ type overseer struct {
 	vcpusAllocated     int
 	diskSpaceAllocated int
 	memoryAllocated    int
+	diskIOPSAllocated  int
+	netMbpsAllocated   int
 	diskSpaceAvailable int
 	memoryAvailable    int
 	traceFrames        *list.List
 	statsInterval      time.Duration
 	di                 deviceInfo
 	maintenance        bool
+
+	// lastStats contains the instance statistics sent in the previous
+	// STATS frame.  It is nil if the next STATS frame must be a full one.
+	lastStats      map[string]payloads.InstanceStat
+	statsSinceFull int
 }
 
 type cnStats struct {
@@ -209,9 +224,37 @@ func (ovs *overseer) roomAvailable(cfg *vmConfig) payloads.StartFailureReason {
 		}
 	}
 
+	if diskIOPS > 0 && ovs.diskIOPSAllocated+cfg.DiskIOPS > diskIOPS {
+		return payloads.FullComputeNode
+	}
+
+	if netBandwidthMbps > 0 && ovs.netMbpsAllocated+cfg.NetMbps > netBandwidthMbps {
+		return payloads.FullComputeNode
+	}
+
 	return ""
 }
 
+// reservedIOAvailable returns the disk IOPS and network bandwidth that can
+// still be reserved by new instances.  Both are 0 if they are not limited.
+func (ovs *overseer) reservedIOAvailable() (iops, mbps int) {
+	if diskIOPS > 0 {
+		iops = diskIOPS - ovs.diskIOPSAllocated
+		if iops < 0 {
+			iops = 0
+		}
+	}
+
+	if netBandwidthMbps > 0 {
+		mbps = netBandwidthMbps - ovs.netMbpsAllocated
+		if mbps < 0 {
+			mbps = 0
+		}
+	}
+
+	return
+}
+
 func (ovs *overseer) updateAvailableResources(cns *cnStats) {
 	diskSpaceConsumed := 0
 	memConsumed := 0
@@ -280,6 +323,8 @@ func (ovs *overseer) sendReadyStatusCommand(cns *cnStats) {
 		s.Networks[i] = *nic
 	}
 	s.NodeHostName = hostname
+	s.DiskIOPSTotal, s.NetBandwidthTotalMbps = diskIOPS, netBandwidthMbps
+	s.DiskIOPSAvailable, s.NetBandwidthAvailableMbps = ovs.reservedIOAvailable()
 
 	payload, err := yaml.Marshal(&s)
 	if err != nil {
@@ -327,25 +372,7 @@ func (ovs *overseer) sendStats(cns *cnStats, status ssntp.Status) {
 	for i, nic := range nicInfo {
 		s.Networks[i] = *nic
 	}
-	s.Instances = make([]payloads.InstanceStat, len(ovs.instances))
-	i := 0
-	for uuid, state := range ovs.instances {
-		s.Instances[i].InstanceUUID = uuid
-		if state.running == ovsRunning {
-			s.Instances[i].State = payloads.Running
-		} else if state.running == ovsStopped {
-			s.Instances[i].State = payloads.Exited
-		} else {
-			s.Instances[i].State = payloads.Pending
-		}
-		s.Instances[i].MemoryUsageMB = state.memoryUsageMB
-		s.Instances[i].DiskUsageMB = state.diskUsageMB
-		s.Instances[i].CPUUsage = state.CPUUsage
-		s.Instances[i].SSHIP = state.sshIP
-		s.Instances[i].SSHPort = state.sshPort
-		s.Instances[i].Volumes = state.volumes
-		i++
-	}
+	s.Instances, s.Delta = ovs.instanceStats()
 
 	payload, err := yaml.Marshal(&s)
 	if err != nil {
@@ -356,10 +383,145 @@ func (ovs *overseer) sendStats(cns *cnStats, status ssntp.Status) {
 	_, err = ovs.ac.conn.SendCommand(ssntp.STATS, payload)
 	if err != nil {
 		glog.Errorf("Failed to send stats command %v", err)
+		ovs.lastStats = nil
 		return
 	}
 }
 
+func (ovs *overseer) instanceStat(uuid string, state *ovsInstanceState) payloads.InstanceStat {
+	stat := payloads.InstanceStat{
+		InstanceUUID:    uuid,
+		MemoryUsageMB:   state.memoryUsageMB,
+		DiskUsageMB:     state.diskUsageMB,
+		CPUUsage:        state.CPUUsage,
+		SSHIP:           state.sshIP,
+		SSHPort:         state.sshPort,
+		Volumes:         state.volumes,
+		NetRxBytes:      state.io.netRxBytes,
+		NetTxBytes:      state.io.netTxBytes,
+		NetRxPackets:    state.io.netRxPackets,
+		NetTxPackets:    state.io.netTxPackets,
+		BlockReadBytes:  state.io.blockReadBytes,
+		BlockWriteBytes: state.io.blockWriteBytes,
+		Connections:     -1,
+	}
+
+	if state.running == ovsRunning {
+		stat.State = payloads.Running
+	} else if state.running == ovsStopped {
+		stat.State = payloads.Exited
+	} else {
+		stat.State = payloads.Pending
+	}
+
+	return stat
+}
+
+// instanceStats returns the statistics of the instances to include in the
+// next STATS frame.  When delta reporting is enabled only the instances
+// whose statistics have changed since the last frame are returned, along
+// with true.  A full report is still sent every fullStatsPeriod frames so
+// that the controller recovers from any frames it may have missed.
+func (ovs *overseer) instanceStats() ([]payloads.InstanceStat, bool) {
+	connStats := ovs.connTrackStats()
+
+	current := make(map[string]payloads.InstanceStat, len(ovs.instances))
+	for uuid, state := range ovs.instances {
+		stat := ovs.instanceStat(uuid, state)
+		if cs, ok := connStats[uuid]; ok && state.running == ovsRunning {
+			stat.Connections = cs.Connections
+			for _, t := range cs.TopTalkers {
+				stat.TopTalkers = append(stat.TopTalkers, payloads.TopTalker{
+					IP:          t.IP.String(),
+					Connections: t.Connections,
+					Bytes:       t.Bytes,
+				})
+			}
+		}
+		current[uuid] = stat
+	}
+
+	delta := statsDelta && ovs.lastStats != nil && ovs.statsSinceFull < fullStatsPeriod
+	if delta {
+		ovs.statsSinceFull++
+	} else {
+		ovs.statsSinceFull = 0
+	}
+
+	stats := make([]payloads.InstanceStat, 0, len(current))
+	for uuid, stat := range current {
+		if delta {
+			last, ok := ovs.lastStats[uuid]
+			if ok && reflect.DeepEqual(last, stat) {
+				continue
+			}
+		}
+		stats = append(stats, stat)
+	}
+
+	if statsDelta {
+		ovs.lastStats = current
+	}
+
+	return stats, delta
+}
+
+// connTrackVnicCfg returns the configuration of the tenant VNIC of an
+// instance, used to find the conntrack zone of its connections, or nil if
+// the instance has no tenant VNIC.
+func connTrackVnicCfg(cfg *vmConfig) *libsnnet.VnicConfig {
+	if connTrackTopTalkers <= 0 || cfg.NetworkNode {
+		return nil
+	}
+
+	vnicCfg, err := createCNVnicCfg(cfg)
+	if err != nil {
+		return nil
+	}
+
+	return vnicCfg
+}
+
+// connTrackStats reads the conntrack table once for all the running
+// instances, returning the statistics of their VNICs indexed by instance.
+// VNICs are identified by their address and the conntrack zone of their
+// bridge as instances of different tenants may share an address.
+func (ovs *overseer) connTrackStats() map[string]*libsnnet.ConnTrackStats {
+	if connTrackTopTalkers <= 0 || cnNet == nil {
+		return nil
+	}
+
+	vnics := make(map[string]libsnnet.ConnTrackVnic)
+	for uuid, state := range ovs.instances {
+		if state.running != ovsRunning || state.connTrackVnic == nil {
+			continue
+		}
+
+		zone, err := cnNet.ConnTrackZone(state.connTrackVnic)
+		if err != nil {
+			glog.V(1).Infof("No conntrack zone for instance %s: %v", uuid, err)
+			continue
+		}
+
+		vnics[uuid] = libsnnet.ConnTrackVnic{
+			IP:   state.connTrackVnic.VnicIP,
+			Zone: zone,
+		}
+	}
+
+	if len(vnics) == 0 {
+		return nil
+	}
+
+	stats, err := libsnnet.ConnTrackStatistics(vnics, connTrackTopTalkers)
+	if err != nil {
+		glog.Warningf("Unable to compute connection tracking statistics: %v", err)
+		return nil
+	}
+
+	return stats
+}
+
 func (ovs *overseer) sendTraceReport() {
 	var s payloads.Trace
 
@@ -368,12 +530,13 @@ func (ovs *overseer) sendTraceReport() {
 	}
 
 	for e := ovs.traceFrames.Front(); e != nil; e = e.Next() {
-		f := e.Value.(*ssntp.Frame)
-		frameTrace, err := f.DumpTrace()
+		tf := e.Value.(*ovsTraceFrame)
+		frameTrace, err := tf.frame.DumpTrace()
 		if err != nil {
 			glog.Errorf("Unable to dump traced frame %v", err)
 			continue
 		}
+		frameTrace.InstanceUUID = tf.instance
 
 		s.Frames = append(s.Frames, *frameTrace)
 	}
@@ -443,6 +606,8 @@ func (ovs *overseer) processAddCommand(cmd *ovsAddCmd) {
 		ovs.vcpusAllocated += cfg.Cpus
 		ovs.diskSpaceAllocated += cfg.Disk
 		ovs.memoryAllocated += cfg.Mem
+		ovs.diskIOPSAllocated += cfg.DiskIOPS
+		ovs.netMbpsAllocated += cfg.NetMbps
 		targetCh = startInstance(cmd.instance, cfg, ovs.childWg, ovs.childDoneCh,
 			ovs.ac, ovs.ovsInstanceCh)
 		ovs.instances[cmd.instance] = &ovsInstanceState{
@@ -451,11 +616,15 @@ func (ovs *overseer) processAddCommand(cmd *ovsAddCmd) {
 			diskUsageMB:    -1,
 			CPUUsage:       -1,
 			memoryUsageMB:  -1,
+			io:             unknownIOStats(),
 			maxDiskUsageMB: cfg.Disk,
 			maxVCPUs:       cfg.Cpus,
 			maxMemoryMB:    cfg.Mem,
+			maxDiskIOPS:    cfg.DiskIOPS,
+			maxNetMbps:     cfg.NetMbps,
 			sshIP:          cfg.ConcIP,
 			sshPort:        cfg.SSHPort,
+			connTrackVnic:  connTrackVnicCfg(cfg),
 		}
 	}
 	cmd.targetCh <- ovsAddResult{targetCh, errCode}
@@ -484,6 +653,16 @@ func (ovs *overseer) processRemoveCommand(cmd *ovsRemoveCmd) {
 		ovs.memoryAllocated = 0
 	}
 
+	ovs.diskIOPSAllocated -= target.maxDiskIOPS
+	if ovs.diskIOPSAllocated < 0 {
+		ovs.diskIOPSAllocated = 0
+	}
+
+	ovs.netMbpsAllocated -= target.maxNetMbps
+	if ovs.netMbpsAllocated < 0 {
+		ovs.netMbpsAllocated = 0
+	}
+
 	delete(ovs.instances, cmd.instance)
 	cmd.errCh <- nil
 }
@@ -529,13 +708,14 @@ func (ovs *overseer) processStatusUpdateCommand(cmd *ovsStatsUpdateCmd) {
 		target.memoryUsageMB = cmd.memoryUsageMB
 		target.diskUsageMB = cmd.diskUsageMB
 		target.CPUUsage = cmd.CPUUsage
+		target.io = cmd.io
 		target.volumes = cmd.volumes
 	}
 }
 
 func (ovs *overseer) processTraceFrameCommand(cmd *ovsTraceFrame) {
 	cmd.frame.SetEndStamp()
-	ovs.traceFrames.PushBack(cmd.frame)
+	ovs.traceFrames.PushBack(cmd)
 }
 
 func (ovs *overseer) processMaintenanceCommand(cmd *ovsMaintenanceCmd) {
@@ -614,6 +794,9 @@ DONE:
 			ovs.processCommand(cmd)
 		case <-statsTimer:
 			if !ovs.ac.conn.isConnected() {
+				// The controller may have missed some updates, so
+				// the next STATS frame needs to be a full one.
+				ovs.lastStats = nil
 				statsTimer = time.After(ovs.statsInterval)
 				continue
 			}
@@ -677,6 +860,8 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 	vcpusAllocated := 0
 	diskSpaceAllocated := 0
 	memoryAllocated := 0
+	diskIOPSAllocated := 0
+	netMbpsAllocated := 0
 
 	_ = filepath.Walk(instancesDir, func(path string, info os.FileInfo, err error) error {
 		if path == instancesDir {
@@ -701,6 +886,8 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 		vcpusAllocated += cfg.Cpus
 		diskSpaceAllocated += cfg.Disk
 		memoryAllocated += cfg.Mem
+		diskIOPSAllocated += cfg.DiskIOPS
+		netMbpsAllocated += cfg.NetMbps
 
 		target := startInstance(instance, cfg, childWg, childDoneCh, ac, ovsInstanceCh)
 		instances[instance] = &ovsInstanceState{
@@ -709,11 +896,15 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 			diskUsageMB:    -1,
 			CPUUsage:       -1,
 			memoryUsageMB:  -1,
+			io:             unknownIOStats(),
 			maxDiskUsageMB: cfg.Disk,
 			maxVCPUs:       cfg.Cpus,
 			maxMemoryMB:    cfg.Mem,
+			maxDiskIOPS:    cfg.DiskIOPS,
+			maxNetMbps:     cfg.NetMbps,
 			sshIP:          cfg.ConcIP,
 			sshPort:        cfg.SSHPort,
+			connTrackVnic:  connTrackVnicCfg(cfg),
 		}
 		toMonitor = append(toMonitor, target)
 
@@ -739,6 +930,8 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 		vcpusAllocated:     vcpusAllocated,
 		diskSpaceAllocated: diskSpaceAllocated,
 		memoryAllocated:    memoryAllocated,
+		diskIOPSAllocated:  diskIOPSAllocated,
+		netMbpsAllocated:   netMbpsAllocated,
 		traceFrames:        list.New(),
 		statsInterval:      statsInterval,
 		di:                 di,
@@ -767,6 +960,6 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 }
 
 func startOverseer(wg *sync.WaitGroup, ac *agentClient) chan<- interface{} {
-	return startOverseerFull(instancesDir, wg, ac, time.Second*statsPeriod,
+	return startOverseerFull(instancesDir, wg, ac, statsInterval,
 		realDeviceInfo{})
 }
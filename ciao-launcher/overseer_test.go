@@ -814,3 +814,116 @@ func TestStateChange(t *testing.T) {
 	shutdownOverseer(ovsCh, state)
 	wg.Wait()
 }
+
+// Checks delta stats reporting
+//
+// Enable delta reporting and compute the instance statistics of an overseer
+// managing two instances several times, updating the statistics of one of
+// the instances in between.
+//
+// The first report should be a full one.  The following reports should only
+// contain the instance whose statistics have changed, apart from every
+// fullStatsPeriod reports, which should be full ones again.  Forgetting the
+// last statistics, as happens when the connection is lost, should also
+// result in a full report.
+func TestDeltaStats(t *testing.T) {
+	statsDelta = true
+	defer func() { statsDelta = false }()
+
+	newState := func() *ovsInstanceState {
+		return &ovsInstanceState{
+			running:       ovsRunning,
+			diskUsageMB:   10,
+			CPUUsage:      5,
+			memoryUsageMB: 100,
+			io:            unknownIOStats(),
+		}
+	}
+
+	ovs := &overseer{
+		instances: map[string]*ovsInstanceState{
+			"instance-1": newState(),
+			"instance-2": newState(),
+		},
+	}
+
+	stats, delta := ovs.instanceStats()
+	if delta || len(stats) != 2 {
+		t.Fatalf("Expected full report with 2 instances.  Got delta %v with %d instances",
+			delta, len(stats))
+	}
+
+	for i := 0; i < fullStatsPeriod; i++ {
+		ovs.instances["instance-1"].CPUUsage = i
+		stats, delta = ovs.instanceStats()
+		if !delta || len(stats) != 1 || stats[0].InstanceUUID != "instance-1" {
+			t.Fatalf("Expected delta report containing instance-1.  Got delta %v with %+v",
+				delta, stats)
+		}
+	}
+
+	stats, delta = ovs.instanceStats()
+	if delta || len(stats) != 2 {
+		t.Fatalf("Expected periodic full report.  Got delta %v with %d instances",
+			delta, len(stats))
+	}
+
+	stats, delta = ovs.instanceStats()
+	if !delta || len(stats) != 0 {
+		t.Fatalf("Expected empty delta report.  Got delta %v with %d instances",
+			delta, len(stats))
+	}
+
+	ovs.lastStats = nil
+	stats, delta = ovs.instanceStats()
+	if delta || len(stats) != 2 {
+		t.Fatalf("Expected full report after reset.  Got delta %v with %d instances",
+			delta, len(stats))
+	}
+}
+
+// Check the overseer limits the disk IOPS and network bandwidth reserved by
+// instances.
+//
+// Create an overseer with some IOPS and bandwidth already reserved, check
+// whether instances requesting more or less than what is left fit and
+// compute the IOPS and bandwidth left.
+//
+// Instances requesting more IOPS or bandwidth than is left should not fit.
+// The IOPS and bandwidth left should be the capacity minus what has been
+// reserved, and 0 when the node has no limits.
+func TestReservedIO(t *testing.T) {
+	defer func(iops, mbps int) {
+		diskIOPS, netBandwidthMbps = iops, mbps
+	}(diskIOPS, netBandwidthMbps)
+	diskIOPS, netBandwidthMbps = 1000, 100
+
+	ovs := &overseer{
+		instances:          make(map[string]*ovsInstanceState),
+		diskSpaceAvailable: diskSpaceHWM * 2,
+		memoryAvailable:    memHWM * 2,
+		diskIOPSAllocated:  600,
+		netMbpsAllocated:   50,
+	}
+
+	if r := ovs.roomAvailable(&vmConfig{DiskIOPS: 500}); r != payloads.FullComputeNode {
+		t.Errorf("Expected instance requesting too many IOPS not to fit")
+	}
+
+	if r := ovs.roomAvailable(&vmConfig{NetMbps: 60}); r != payloads.FullComputeNode {
+		t.Errorf("Expected instance requesting too much bandwidth not to fit")
+	}
+
+	if r := ovs.roomAvailable(&vmConfig{DiskIOPS: 400, NetMbps: 50}); r != "" {
+		t.Errorf("Expected instance to fit, got %s", r)
+	}
+
+	if iops, mbps := ovs.reservedIOAvailable(); iops != 400 || mbps != 50 {
+		t.Errorf("Expected 400 IOPS and 50 Mbps available, got %d and %d", iops, mbps)
+	}
+
+	diskIOPS, netBandwidthMbps = 0, 0
+	if iops, mbps := ovs.reservedIOAvailable(); iops != 0 || mbps != 0 {
+		t.Errorf("Expected no IOPS or bandwidth limits, got %d and %d", iops, mbps)
+	}
+}
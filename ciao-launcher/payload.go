@@ -143,6 +143,8 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 	mem := start.Requirements.MemMB
 	networkNode := start.Requirements.NetworkNode
 	privileged := start.Requirements.Privileged
+	singleQueue := start.Requirements.DisableNetMultiQueue
+	extraSpecs := start.Requirements.ExtraSpecs
 
 	net := &start.Networking
 	vnicIP := strings.TrimSpace(net.PrivateIP)
@@ -180,24 +182,31 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 		Volumes:     volumes,
 		Restart:     clouddata.Start.Restart,
 		Privileged:  privileged,
+		SingleQueue: singleQueue,
+		ExtraSpecs:  extraSpecs,
+		DiskIOPS:    start.Requirements.DiskIOPS,
+		NetMbps:     start.Requirements.NetBandwidthMbps,
+		RequestID:   strings.TrimSpace(start.RequestID),
 	}, nil
 }
 
-func generateStartError(node, instance string, startErr *startError) (out []byte, err error) {
+func generateStartError(node, instance, requestID string, startErr *startError) (out []byte, err error) {
 	sf := &payloads.ErrorStartFailure{
 		NodeUUID:     node,
 		InstanceUUID: instance,
 		Reason:       startErr.code,
 		Restart:      startErr.restart,
+		RequestID:    requestID,
 	}
 	return yaml.Marshal(sf)
 }
 
-func generateDeleteError(node, instance string, deleteErr *deleteError) (out []byte, err error) {
+func generateDeleteError(node, instance, requestID string, deleteErr *deleteError) (out []byte, err error) {
 	df := &payloads.ErrorDeleteFailure{
 		NodeUUID:     node,
 		InstanceUUID: instance,
 		Reason:       deleteErr.code,
+		RequestID:    requestID,
 	}
 	return yaml.Marshal(df)
 }
@@ -241,20 +250,21 @@ func generateNetEventPayload(ssntpEvent *libsnnet.SsntpEventInfo, agentUUID stri
 	return yaml.Marshal(event)
 }
 
-func parseDeletePayload(data []byte) (string, bool, *payloadError) {
+func parseDeletePayload(data []byte) (string, bool, string, *payloadError) {
 	var clouddata payloads.Delete
 
 	err := yaml.Unmarshal(data, &clouddata)
 	if err != nil {
-		return "", false, &payloadError{err, payloads.DeleteInvalidPayload}
+		return "", false, "", &payloadError{err, payloads.DeleteInvalidPayload}
 	}
 
 	instance := strings.TrimSpace(clouddata.Delete.InstanceUUID)
 	if !uuidRegexp.MatchString(instance) {
 		err = fmt.Errorf("Invalid instance id received: %s", instance)
-		return "", false, &payloadError{err, payloads.DeleteInvalidData}
+		return "", false, "", &payloadError{err, payloads.DeleteInvalidData}
 	}
-	return instance, clouddata.Delete.Stop, nil
+	requestID := strings.TrimSpace(clouddata.Delete.RequestID)
+	return instance, clouddata.Delete.Stop, requestID, nil
 }
 
 func extractVolumeInfo(cmd *payloads.VolumeCmd, errString string) (string, string, *payloadError) {
@@ -73,6 +73,55 @@ start:
 			},
 		},
 	},
+	{
+		`
+start:
+  requirements:
+    vcpus: 2
+    mem_mb: 370
+    extra_specs:
+      hw:cpu_policy: dedicated
+      ciao:restart: always
+  instance_uuid: d7d86208-b46c-4465-9018-ee14087d415f
+  tenant_uuid: 67d86208-000-4465-9018-fe14087d415f
+  fw_type: legacy
+  vm_type: qemu
+  networking:
+    vnic_mac: 02:00:e6:f5:af:f9
+    vnic_uuid: 67d86208-b46c-0000-9018-fe14087d415f
+    concentrator_ip: 192.168.42.21
+    concentrator_uuid: 67d86208-b46c-4465-0000-fe14087d415f
+    subnet: 192.168.8.0/21
+    private_ip: 192.168.8.2
+  storage:
+     - id: 69e84267-ed01-4738-b15f-b47de06b62e7
+       boot: true
+`,
+		&vmConfig{
+			Cpus:       2,
+			Mem:        370,
+			Instance:   "d7d86208-b46c-4465-9018-ee14087d415f",
+			Legacy:     true,
+			VnicMAC:    "02:00:e6:f5:af:f9",
+			VnicIP:     "192.168.8.2",
+			ConcIP:     "192.168.42.21",
+			SubnetIP:   "192.168.8.0/21",
+			TenantUUID: "67d86208-000-4465-9018-fe14087d415f",
+			ConcUUID:   "67d86208-b46c-4465-0000-fe14087d415f",
+			VnicUUID:   "67d86208-b46c-0000-9018-fe14087d415f",
+			SSHPort:    35050,
+			Volumes: []volumeConfig{
+				{
+					UUID:     "69e84267-ed01-4738-b15f-b47de06b62e7",
+					Bootable: true,
+				},
+			},
+			ExtraSpecs: map[string]string{
+				"hw:cpu_policy": "dedicated",
+				"ciao:restart":  "always",
+			},
+		},
+	},
 	{
 		"start",
 		nil,
@@ -175,11 +224,12 @@ func TestParseAttachVolumePayload(t *testing.T) {
 
 // Verify the parseStartPayload function.
 //
-// The function is passed one valid payload and a number of invalid payloads.
+// The function is passed two valid payloads, one with extra specs, and a
+// number of invalid payloads.
 //
-// No error should be returned for the valid payload.  The resulting vmConfig
-// structure should match the handcrafted structure associated with the
-// payload.  The invalid payloads should fail to parse.
+// No error should be returned for the valid payloads.  The resulting vmConfig
+// structures should match the handcrafted structures associated with the
+// payloads.  The invalid payloads should fail to parse.
 func TestParseStartPayload(t *testing.T) {
 	for i, st := range startTests {
 		cfg, err := parseStartPayload([]byte(st.payload))
@@ -274,7 +324,7 @@ func TestGenerateNetEventPayload(t *testing.T) {
 // The payload should parse without any error and the instance UUID in the
 // resulting payloads data structure should be as expected.
 func TestParseDeletePayload(t *testing.T) {
-	instance, stop, err := parseDeletePayload([]byte(testutil.DeleteYaml))
+	instance, stop, _, err := parseDeletePayload([]byte(testutil.DeleteYaml))
 	if err != nil {
 		t.Fatalf("Failed to parse delete payload : %v", err.err)
 	}
@@ -19,9 +19,13 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/golang/glog"
 )
@@ -108,3 +112,99 @@ func parseProcStat(statPath string) int64 {
 
 	return cpuTime
 }
+
+func computeInterfaceStats(ifName string) (rxBytes, txBytes, rxPackets, txPackets int64) {
+	statsPath := path.Join("/sys/class/net", ifName, "statistics")
+	return parseInterfaceStats(statsPath)
+}
+
+func parseInterfaceStats(statsPath string) (rxBytes, txBytes, rxPackets, txPackets int64) {
+	return readCounter(path.Join(statsPath, "rx_bytes")),
+		readCounter(path.Join(statsPath, "tx_bytes")),
+		readCounter(path.Join(statsPath, "rx_packets")),
+		readCounter(path.Join(statsPath, "tx_packets"))
+}
+
+func readCounter(counterPath string) int64 {
+	data, err := ioutil.ReadFile(counterPath)
+	if err != nil {
+		if glog.V(1) {
+			glog.Warningf("Unable to read %s: %v", counterPath, err)
+		}
+		return -1
+	}
+
+	val, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return val
+}
+
+var oomKillRegexp = regexp.MustCompile(`Killed process (\d+)`)
+var segfaultRegexp = regexp.MustCompile(`\[(\d+)\]: segfault at`)
+
+// processOOMKilled returns true if the kernel log records that the process
+// with the given pid was killed by the OOM killer.
+func processOOMKilled(pid int) bool {
+	return parseKernelLogOOMKill("/dev/kmsg", pid)
+}
+
+func parseKernelLogOOMKill(logPath string, pid int) bool {
+	return kernelLogMatchesPid(logPath, oomKillRegexp, pid)
+}
+
+// processSegfaulted returns true if the kernel log records that the process
+// with the given pid was killed by a segmentation fault.
+func processSegfaulted(pid int) bool {
+	return parseKernelLogSegfault("/dev/kmsg", pid)
+}
+
+func parseKernelLogSegfault(logPath string, pid int) bool {
+	return kernelLogMatchesPid(logPath, segfaultRegexp, pid)
+}
+
+// kernelLogMatchesPid returns true if a record of the kernel log matches re
+// and the pid captured by re is the given pid.
+func kernelLogMatchesPid(logPath string, re *regexp.Regexp, pid int) bool {
+	// /dev/kmsg returns one record per read and blocks once all the
+	// records have been read unless opened with O_NONBLOCK.  The os
+	// package would register the file with the poller and block anyway,
+	// so the syscalls are used directly.
+	fd, err := syscall.Open(logPath, syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		if glog.V(1) {
+			glog.Warningf("Unable to open %s: %v", logPath, err)
+		}
+		return false
+	}
+	defer func() { _ = syscall.Close(fd) }()
+
+	var data []byte
+	buf := make([]byte, 8192)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EPIPE {
+			// Records were overwritten while reading
+			continue
+		}
+		if err != nil || n <= 0 {
+			break
+		}
+		data = append(data, buf[:n]...)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		matches := re.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		if matched, err := strconv.Atoi(matches[1]); err == nil && matched == pid {
+			return true
+		}
+	}
+
+	return false
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
 )
 
@@ -191,3 +192,109 @@ func TestParseProcStat(t *testing.T) {
 		t.Errorf("Expected parseProcStat to fail when passed invalid path")
 	}
 }
+
+// Verify the network interface statistics parser
+//
+// This test creates a fake statistics directory containing some valid and
+// some invalid counters and checks that parseInterfaceStats returns the
+// values of the valid counters and -1 for the others.
+func TestParseInterfaceStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "process_stats_test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory : %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	counters := map[string]string{
+		"rx_bytes":   "1048576\n",
+		"tx_bytes":   "2048\n",
+		"rx_packets": "invalid\n",
+	}
+	for name, val := range counters {
+		err = ioutil.WriteFile(path.Join(dir, name), []byte(val), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write %s : %v", name, err)
+		}
+	}
+
+	rxBytes, txBytes, rxPackets, txPackets := parseInterfaceStats(dir)
+	if rxBytes != 1048576 || txBytes != 2048 || rxPackets != -1 || txPackets != -1 {
+		t.Errorf("Incorrect values from parseInterfaceStats %d %d %d %d",
+			rxBytes, txBytes, rxPackets, txPackets)
+	}
+}
+
+// Verify the OOM killer kernel log parser
+//
+// This test creates a fake kernel log recording the OOM kill of a process
+// and checks that parseKernelLogOOMKill only reports that process as having
+// been killed.
+func TestParseKernelLogOOMKill(t *testing.T) {
+	f, err := ioutil.TempFile("", "process_stats_test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary file : %v", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	log := `6,1021,5213546,-;qemu-system-x86 invoked oom-killer: gfp_mask=0x14280ca
+3,1022,5213600,-;Out of memory: Kill process 4242 (qemu-system-x86) score 900 or sacrifice child
+3,1023,5213601,-;Killed process 4242 (qemu-system-x86) total-vm:4194304kB, anon-rss:2097152kB
+`
+	_, err = f.WriteString(log)
+	err2 := f.Close()
+	if err != nil || err2 != nil {
+		t.Fatalf("Unable to write to temporary file : %v %v", err, err2)
+	}
+
+	if !parseKernelLogOOMKill(f.Name(), 4242) {
+		t.Errorf("Expected process 4242 to have been OOM killed")
+	}
+
+	if parseKernelLogOOMKill(f.Name(), 42) {
+		t.Errorf("Process 42 was not OOM killed")
+	}
+
+	if parseKernelLogOOMKill("", 4242) {
+		t.Errorf("Expected parseKernelLogOOMKill to fail when passed invalid path")
+	}
+}
+
+// Verify the segmentation fault kernel log parser
+//
+// This test creates a fake kernel log recording the segmentation fault of a
+// process and checks that parseKernelLogSegfault only reports that process
+// as having crashed.
+func TestParseKernelLogSegfault(t *testing.T) {
+	f, err := ioutil.TempFile("", "process_stats_test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary file : %v", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	log := `6,1121,6213546,-;qemu-system-x86[4343]: segfault at 0 ip 000055d0c1b6a8b0 sp 00007ffd27a5ae50 error 4 in qemu-system-x86_64[55d0c1800000+8a2000]
+6,1122,6213547,-;device tap1 left promiscuous mode
+`
+	_, err = f.WriteString(log)
+	err2 := f.Close()
+	if err != nil || err2 != nil {
+		t.Fatalf("Unable to write to temporary file : %v %v", err, err2)
+	}
+
+	if !parseKernelLogSegfault(f.Name(), 4343) {
+		t.Errorf("Expected process 4343 to have segfaulted")
+	}
+
+	if parseKernelLogSegfault(f.Name(), 43) {
+		t.Errorf("Process 43 did not segfault")
+	}
+
+	if parseKernelLogSegfault("", 4343) {
+		t.Errorf("Expected parseKernelLogSegfault to fail when passed invalid path")
+	}
+}
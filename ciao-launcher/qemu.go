@@ -27,10 +27,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"context"
 
+	"github.com/ciao-project/ciao/payloads"
 	"github.com/golang/glog"
 	"github.com/intel/govmm/qemu"
 )
@@ -72,9 +74,11 @@ type qemuV struct {
 	instanceDir    string
 	vcPort         int
 	pid            int
+	vnicName       string
 	prevCPUTime    int64
 	prevSampleTime time.Time
 	isoPath        string
+	exitState      *qmpExitState
 }
 
 func (q *qemuV) init(cfg *vmConfig, instanceDir string) {
@@ -159,6 +163,17 @@ func locateTapDevice(vnicName string) (string, error) {
 	return fmt.Sprintf("/dev/tap%d", i), nil
 }
 
+// multiQueueParam returns the virtio-net-pci options needed for a device
+// with the given number of queue pairs.  Each queue pair needs an MSI-X
+// vector for each of its two virtqueues, plus one for the control queue
+// and one for configuration changes.
+func multiQueueParam(queues int) string {
+	if queues <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("mq=on,vectors=%d,", (queues*2)+2)
+}
+
 func computeMacvtapParam(vnicName string, mac string, queues int) ([]string, []*os.File, error) {
 	var fdParam bytes.Buffer
 	var vhostFdParam bytes.Buffer
@@ -204,7 +219,7 @@ func computeMacvtapParam(vnicName string, mac string, queues int) ([]string, []*
 	}
 
 	netdev := fmt.Sprintf("type=tap,fds=%s,vhostfds=%s,id=%s,vhost=on", fdParam.String(), vhostFdParam.String(), vnicName)
-	device := fmt.Sprintf("virtio-net-pci,netdev=%s,mq=on,vectors=%d,mac=%s", vnicName, 32, mac)
+	device := fmt.Sprintf("virtio-net-pci,netdev=%s,%smac=%s", vnicName, multiQueueParam(queues), mac)
 	params = append(params, "-netdev", netdev)
 	params = append(params, "-device", device)
 	return params, fds, nil
@@ -239,8 +254,8 @@ func computeTapParam(infds []*os.File, vnicName, mac string) ([]string, []*os.Fi
 	params := make([]string, 0, 8)
 	netdev := fmt.Sprintf("type=tap,fds=%s,vhostfds=%s,id=%s,vhost=on",
 		fdParam.String(), vhostFdParam.String(), vnicName)
-	device := fmt.Sprintf("driver=virtio-net-pci,netdev=%s,mq=on,vectors=%d,mac=%s",
-		vnicName, (len(infds)*2)+2, mac)
+	device := fmt.Sprintf("driver=virtio-net-pci,netdev=%s,%smac=%s",
+		vnicName, multiQueueParam(len(infds)), mac)
 
 	params = append(params, "-netdev", netdev)
 	params = append(params, "-device", device)
@@ -383,6 +398,17 @@ func generateQEMULaunchParams(cfg *vmConfig, isoPath, instanceDir string,
 	qmpParam := fmt.Sprintf("unix:%s,server,nowait", qmpSocket)
 	params = append(params, "-qmp", qmpParam)
 
+	statsParam := fmt.Sprintf("unix:%s,server,nowait", path.Join(instanceDir, statsSocket))
+	params = append(params, "-qmp", statsParam)
+
+	// Once daemonized qemu writes its stderr to the log file
+	params = append(params, "-D", path.Join(instanceDir, qemuLogFile))
+
+	if crashDumps {
+		dumpParam := fmt.Sprintf("unix:%s,server,nowait", path.Join(instanceDir, dumpSocket))
+		params = append(params, "-qmp", dumpParam, "-device", "pvpanic")
+	}
+
 	if cfg.Mem > 0 {
 		memoryParam := fmt.Sprintf("%d", cfg.Mem)
 		params = append(params, "-m", memoryParam)
@@ -404,13 +430,12 @@ func (q *qemuV) startVM(vnicName, ipAddress, cephID string, fds []*os.File) erro
 
 	networkParams := make([]string, 0, 32)
 
+	q.vnicName = vnicName
 	if vnicName != "" {
 		if q.cfg.NetworkNode {
 			var err error
 			var macvtapParam []string
-			//TODO: @mcastelino get from scheduler/controller
-			numQueues := 4
-			macvtapParam, fds, err = computeMacvtapParam(vnicName, q.cfg.VnicMAC, numQueues)
+			macvtapParam, fds, err = computeMacvtapParam(vnicName, q.cfg.VnicMAC, q.cfg.netQueues())
 			if err != nil {
 				return err
 			}
@@ -472,6 +497,37 @@ func (q *qemuV) lostVM() {
 	q.prevCPUTime = -1
 }
 
+func (q *qemuV) exitReason() (payloads.InstanceLogReason, string, *payloads.InstanceCrash) {
+	if q.pid != 0 && processOOMKilled(q.pid) {
+		return payloads.InstanceOOMKilled,
+			fmt.Sprintf("qemu process %d was killed by the OOM killer", q.pid), nil
+	}
+
+	// qemu is daemonized so its exit status cannot be retrieved.  A
+	// qemu which did not report a SHUTDOWN event has crashed.
+	if q.exitState == nil || !q.exitState.wait() ||
+		(q.exitState.shutdownSeen() && !q.exitState.guestPanicked()) {
+		return payloads.InstanceExited, "qemu process exited", nil
+	}
+
+	exitStatus := "terminated without shutting down"
+	if q.exitState.guestPanicked() {
+		exitStatus = "guest panicked"
+	} else if q.pid != 0 && processSegfaulted(q.pid) {
+		exitStatus = "killed by SIGSEGV"
+	}
+
+	crash, err := collectQEMUCrash(path.Join(crashesDir, q.cfg.Instance), q.instanceDir,
+		exitStatus, q.exitState.memoryDumped())
+	if err != nil {
+		glog.Warningf("Unable to collect crash artifacts of %s: %v", q.cfg.Instance, err)
+		return payloads.InstanceCrashed, fmt.Sprintf("qemu %s", exitStatus), nil
+	}
+
+	return payloads.InstanceCrashed,
+		fmt.Sprintf("qemu %s, artifacts stored in %s", exitStatus, crash.Artifacts), crash
+}
+
 func qmpAttach(cmd virtualizerAttachCmd, q *qemu.QMP) {
 	glog.Info("Attach command received")
 
@@ -502,7 +558,7 @@ func qmpAttach(cmd virtualizerAttachCmd, q *qemu.QMP) {
 }
 
 func qmpConnect(qmpChannel chan interface{}, instance, instanceDir string, closedCh chan struct{},
-	connectedCh chan struct{}, wg *sync.WaitGroup, boot bool) {
+	connectedCh chan struct{}, wg *sync.WaitGroup, boot bool, exit *qmpExitState) {
 
 	var q *qemu.QMP
 	defer func() {
@@ -513,14 +569,21 @@ func qmpConnect(qmpChannel chan interface{}, instance, instanceDir string, close
 		wg.Done()
 	}()
 
+	// The event channel is buffered and drained by its own go routine
+	// as the QMP object blocks while delivering events.
+	eventCh := make(chan qemu.QMPEvent, 16)
 	socket := path.Join(instanceDir, "socket")
-	cfg := qemu.QMPConfig{Logger: qmpGlogLogger{}}
+	cfg := qemu.QMPConfig{Logger: qmpGlogLogger{}, EventCh: eventCh}
 	q, ver, err := qemu.QMPStart(context.Background(), socket, cfg, closedCh)
 	if err != nil {
 		glog.Warningf("Failed to connect to QEMU instance %s: %v", instance, err)
+		close(exit.done)
 		return
 	}
 
+	wg.Add(1)
+	go monitorQMPEvents(eventCh, instanceDir, exit, wg)
+
 	glog.Infof("Connected to %s.", instance)
 	glog.Infof("QMP version %d.%d.%d", ver.Major, ver.Minor, ver.Micro)
 	glog.Infof("QMP capabilities %s", ver.Capabilities)
@@ -546,6 +609,7 @@ DONE:
 			cancelFN()
 			if err != nil {
 				glog.Warningf("Failed to power down cleanly: %v", err)
+				atomic.StoreInt32(&exit.shutdown, 1)
 				err = q.ExecuteQuit(context.Background())
 				if err != nil {
 					glog.Warningf("Failed to execute quit instance: %v", err)
@@ -568,21 +632,49 @@ DONE:
 func (q *qemuV) monitorVM(closedCh chan struct{}, connectedCh chan struct{},
 	wg *sync.WaitGroup, boot bool) chan interface{} {
 	qmpChannel := make(chan interface{})
+	q.exitState = newQMPExitState()
 	wg.Add(1)
-	go qmpConnect(qmpChannel, q.cfg.Instance, q.instanceDir, closedCh, connectedCh, wg, boot)
+	go qmpConnect(qmpChannel, q.cfg.Instance, q.instanceDir, closedCh, connectedCh, wg, boot,
+		q.exitState)
 	return qmpChannel
 }
 
-func (q *qemuV) stats() (disk, memory, cpu int) {
+func (q *qemuV) ioStats() ioStats {
+	io := unknownIOStats()
+	io.blockReadBytes, io.blockWriteBytes = qmpBlockStats(q.instanceDir)
+
+	if q.vnicName == "" || q.cfg == nil {
+		return io
+	}
+
+	rxBytes, txBytes, rxPackets, txPackets := computeInterfaceStats(q.vnicName)
+
+	// The counters of a macvtap device, used by the CNCIs, already describe
+	// the traffic from the point of view of the VM.  Those of a tap device
+	// are reversed, what the host transmits on the tap the VM receives.
+	if q.cfg.NetworkNode {
+		io.netRxBytes, io.netTxBytes = rxBytes, txBytes
+		io.netRxPackets, io.netTxPackets = rxPackets, txPackets
+	} else {
+		io.netRxBytes, io.netTxBytes = txBytes, rxBytes
+		io.netRxPackets, io.netTxPackets = txPackets, rxPackets
+	}
+
+	return io
+}
+
+func (q *qemuV) stats() (disk, memory, cpu int, io ioStats) {
 	disk = 0
 	memory = -1
 	cpu = -1
+	io = unknownIOStats()
 
 	if q.pid == 0 {
 		return
 	}
 
 	memory = computeProcessMemUsage(q.pid)
+	io = q.ioStats()
 	if q.cfg == nil {
 		return
 	}
@@ -35,7 +35,9 @@ func genQEMUParams(networkParams []string) []string {
 	}
 	baseParams = append(baseParams, networkParams...)
 	baseParams = append(baseParams, "-enable-kvm", "-cpu", "host", "-daemonize",
-		"-qmp", "unix:/var/lib/ciao/instance/1/socket,server,nowait")
+		"-qmp", "unix:/var/lib/ciao/instance/1/socket,server,nowait",
+		"-qmp", "unix:/var/lib/ciao/instance/1/stats-socket,server,nowait",
+		"-D", "/var/lib/ciao/instance/1/qemu.log")
 
 	return baseParams
 }
@@ -88,6 +90,40 @@ func TestGenerateQEMULaunchParams(t *testing.T) {
 	}
 }
 
+// Checks the number of network queues given to VMs.
+//
+// VMs are given one queue per VCPU unless they have opted out, and the
+// virtio-net device is only configured for multiple queues if they have more
+// than one.
+//
+// The number of queues should match the VCPUs, capped to the tap device
+// limit, and be 1 for single queue VMs.
+func TestNetQueues(t *testing.T) {
+	tests := []struct {
+		cfg    vmConfig
+		queues int
+		param  string
+	}{
+		{vmConfig{Cpus: 0}, 1, ""},
+		{vmConfig{Cpus: 1}, 1, ""},
+		{vmConfig{Cpus: 4}, 4, "mq=on,vectors=10,"},
+		{vmConfig{Cpus: 4, SingleQueue: true}, 1, ""},
+		{vmConfig{Cpus: 1024}, 256, "mq=on,vectors=514,"},
+	}
+
+	for _, test := range tests {
+		queues := test.cfg.netQueues()
+		if queues != test.queues {
+			t.Errorf("Expected %d queues for %+v, got %d", test.queues, test.cfg, queues)
+		}
+
+		param := multiQueueParam(queues)
+		if param != test.param {
+			t.Errorf("Expected %q for %d queues, got %q", test.param, queues, param)
+		}
+	}
+}
+
 func TestQmpConnectBadSocket(t *testing.T) {
 	var wg sync.WaitGroup
 	qmpChannel := make(chan interface{})
@@ -96,14 +132,20 @@ func TestQmpConnectBadSocket(t *testing.T) {
 	instance := "testInstance"
 	instanceDir := path.Join("/tmp", instance)
 
+	exit := newQMPExitState()
+
 	wg.Add(1)
-	go qmpConnect(qmpChannel, instance, instanceDir, closedCh, connectedCh, &wg, false)
+	go qmpConnect(qmpChannel, instance, instanceDir, closedCh, connectedCh, &wg, false, exit)
 	wg.Wait()
 	select {
 	case <-closedCh:
 	case <-time.After(time.Second):
 		t.Fatalf("Timed out waiting for closedCh to close")
 	}
+
+	if exit.wait() {
+		t.Errorf("Events of unconnected instance monitored")
+	}
 }
 
 func setupQmpSocket(t *testing.T, runTest func(net.Conn, *bufio.Scanner, chan interface{}, *testing.T) bool) {
@@ -128,8 +170,9 @@ func setupQmpSocket(t *testing.T, runTest func(net.Conn, *bufio.Scanner, chan in
 		t.Fatalf("Unable to open domain socket %s: %v", socketPath, err)
 	}
 	defer ln.Close()
+	exit := newQMPExitState()
 	wg.Add(1)
-	go qmpConnect(qmpChannel, instance, instanceDir, closedCh, connectedCh, &wg, false)
+	go qmpConnect(qmpChannel, instance, instanceDir, closedCh, connectedCh, &wg, false, exit)
 	fd, err := ln.Accept()
 	if err != nil {
 		t.Fatalf("Unable to accept client %v", err)
@@ -172,6 +215,10 @@ func setupQmpSocket(t *testing.T, runTest func(net.Conn, *bufio.Scanner, chan in
 	case <-time.After(time.Second):
 		t.Fatalf("Timed out waiting for closedCh to close")
 	}
+
+	if !exit.wait() {
+		t.Errorf("Events of connected instance not monitored")
+	}
 }
 
 func TestQmpConnect(t *testing.T) {
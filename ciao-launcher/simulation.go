@@ -22,6 +22,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ciao-project/ciao/payloads"
 	"github.com/golang/glog"
 )
 
@@ -115,14 +116,18 @@ func (s *simulation) monitorVM(closedCh chan struct{}, connectedCh chan struct{}
 	return s.monitorCh
 }
 
-func (s *simulation) stats() (disk, memory, cpu int) {
-	return s.disk / 10, s.mem / 10, s.cpus / 10
+func (s *simulation) stats() (disk, memory, cpu int, io ioStats) {
+	return s.disk / 10, s.mem / 10, s.cpus / 10, unknownIOStats()
 }
 
 func (s *simulation) connected() {
 	glog.Infof("connected\n")
 }
 
+func (s *simulation) exitReason() (payloads.InstanceLogReason, string, *payloads.InstanceCrash) {
+	return payloads.InstanceExited, "simulated instance exited", nil
+}
+
 func (s *simulation) lostVM() {
 	glog.Infof("simulation: lostVM\n")
 }
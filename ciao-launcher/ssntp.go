@@ -107,23 +107,29 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 				payloads.StartFailureReason(payloadErr.code),
 				false,
 			}
-			startError.send(client.conn, "")
+			startError.send(client.conn, "", "")
 			glog.Errorf("Unable to parse YAML: %v", payloadErr.err)
 			return
 		}
+		if cfg.RequestID != "" {
+			glog.Infof("START %s for request %s", cfg.Instance, cfg.RequestID)
+		}
 		client.cmdCh <- &cmdWrapper{cfg.Instance, &insStartCmd{cn, md, frame, cfg, time.Now()}}
 	case ssntp.DELETE:
-		instance, stop, payloadErr := parseDeletePayload(payload)
+		instance, stop, requestID, payloadErr := parseDeletePayload(payload)
 		if payloadErr != nil {
 			deleteError := &deleteError{
 				payloadErr.err,
 				payloads.DeleteFailureReason(payloadErr.code),
 			}
-			deleteError.send(client.conn, "")
+			deleteError.send(client.conn, "", "")
 			glog.Errorf("Unable to parse YAML: %s", payloadErr.err)
 			return
 		}
-		client.cmdCh <- &cmdWrapper{instance, &insDeleteCmd{stop: stop}}
+		if requestID != "" {
+			glog.Infof("DELETE %s for request %s", instance, requestID)
+		}
+		client.cmdCh <- &cmdWrapper{instance, &insDeleteCmd{stop: stop, requestID: requestID}}
 	case ssntp.AttachVolume:
 		instance, volume, payloadErr := parseAttachVolumePayload(payload)
 		if payloadErr != nil {
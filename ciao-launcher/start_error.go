@@ -28,12 +28,12 @@ type startError struct {
 	restart bool
 }
 
-func (se *startError) send(conn serverConn, instance string) {
+func (se *startError) send(conn serverConn, instance, requestID string) {
 	if !conn.isConnected() {
 		return
 	}
 
-	payload, err := generateStartError(conn.UUID(), instance, se)
+	payload, err := generateStartError(conn.UUID(), instance, requestID, se)
 	if err != nil {
 		glog.Errorf("Unable to generate payload for start_failure: %v", err)
 		return
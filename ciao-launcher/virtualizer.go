@@ -20,6 +20,8 @@ import (
 	"errors"
 	"os"
 	"sync"
+
+	"github.com/ciao-project/ciao/payloads"
 )
 
 type virtualizerStopCmd struct{}
@@ -31,6 +33,23 @@ type virtualizerAttachCmd struct {
 
 var errImageNotFound = errors.New("Image Not Found")
 
+// ioStats contains the cumulative network and block I/O counters of an
+// instance.  The network counters are expressed from the point of view of
+// the instance, i.e., netRxBytes is the number of bytes received by the
+// instance.  Counters that are not known are set to -1.
+type ioStats struct {
+	netRxBytes      int64
+	netTxBytes      int64
+	netRxPackets    int64
+	netTxPackets    int64
+	blockReadBytes  int64
+	blockWriteBytes int64
+}
+
+func unknownIOStats() ioStats {
+	return ioStats{-1, -1, -1, -1, -1, -1}
+}
+
 //BUG(markus): These methods need to be cancellable
 
 // The virtualizer interface is designed to isolate launcher, and in particular,
@@ -98,7 +117,8 @@ type virtualizer interface {
 	// disk: Size of the VM/container rootfs in GB or -1 if not known.
 	// memory: Amount of memory used by the VM or container process, in MB
 	// cpu: Normalized CPU time of VM or container process
-	stats() (disk, memory, cpu int)
+	// io: Network and block I/O counters of the VM or container
+	stats() (disk, memory, cpu int, io ioStats)
 
 	// connected is called by the instance go routine to inform the virtualizer that
 	// the VM is running.  The virtualizer can used this notification to perform some
@@ -119,4 +139,11 @@ type virtualizer interface {
 	// The instance go routine then calls lostVM so that the virtualizer can update
 	// its internal state.
 	lostVM()
+
+	// exitReason is called by the instance go routine when it detects that the VM
+	// or container has stopped running of its own accord, before lostVM is called.
+	// It returns the reason the instance went down, a message describing the
+	// incident and, if the instance crashed, a description of the artifacts
+	// collected for postmortem debugging, which are reported to the controller.
+	exitReason() (payloads.InstanceLogReason, string, *payloads.InstanceCrash)
 }
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 
+	"github.com/ciao-project/ciao/networking/libsnnet"
 	"github.com/golang/glog"
 )
 
@@ -49,6 +50,11 @@ type vmConfig struct {
 	Volumes     []volumeConfig
 	Restart     bool
 	Privileged  bool
+	SingleQueue bool
+	RequestID   string
+	ExtraSpecs  map[string]string
+	DiskIOPS    int
+	NetMbps     int
 }
 
 func loadVMConfig(instanceDir string) (*vmConfig, error) {
@@ -90,6 +96,21 @@ func (cfg *vmConfig) save(instanceDir string) error {
 	return cfgFile.Close()
 }
 
+// netQueues returns the number of queues of the instance's network
+// interface.  VMs get one queue per VCPU, so that network processing can
+// be spread across all of them, unless their workload has opted out.
+func (cfg *vmConfig) netQueues() int {
+	if cfg.SingleQueue || cfg.Cpus <= 1 {
+		return 1
+	}
+
+	if cfg.Cpus > libsnnet.MaxVnicQueues {
+		return libsnnet.MaxVnicQueues
+	}
+
+	return cfg.Cpus
+}
+
 func (cfg *vmConfig) findVolume(UUID string) *volumeConfig {
 	for i := range cfg.Volumes {
 		if cfg.Volumes[i].UUID == UUID {
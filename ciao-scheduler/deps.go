@@ -29,4 +29,13 @@ var schedDeps = osprepare.PackageRequirements{
 	"ubuntu": {
 		{BinaryName: "", PackageName: ""},
 	},
+	"centos": {
+		{BinaryName: "", PackageName: ""},
+	},
+	"debian": {
+		{BinaryName: "", PackageName: ""},
+	},
+	"opensuse": {
+		{BinaryName: "", PackageName: ""},
+	},
 }
@@ -41,9 +41,15 @@ var cacert = flag.String("cacert", "/etc/pki/ciao/CAcert-server-localhost.pem",
 var cpuprofile = flag.String("cpuprofile", "", "Write cpu profile to file")
 var heartbeat = flag.Bool("heartbeat", false, "Emit status heartbeat text")
 var prepare = flag.Bool("osprepare", false, "Install dependencies")
+var verifyDeps = flag.Bool("osprepare-verify", false, "Report missing dependencies as JSON without installing them")
+var pkgDir = flag.String("osprepare-pkgdir", "", "Install dependencies from a local package directory")
 var logDir = "/var/lib/ciao/logs/scheduler"
 var configURI = flag.String("configuration-uri", "file:///etc/ciao/configuration.yaml",
 	"Cluster configuration URI")
+var commandQueue = flag.String("command-queue", "",
+	"Directory in which to queue the commands sent to disconnected nodes, empty to drop them")
+var commandQueueTTL = flag.Duration("command-queue-ttl", time.Hour,
+	"Time after which queued commands that could not be delivered are dropped")
 
 type ssntpSchedulerServer struct {
 	// user config overrides ------------------------------------------
@@ -100,6 +106,13 @@ type nodeStat struct {
 	isNetNode   bool
 	networks    []payloads.NetworkStat
 	hostname    string
+
+	// The disk IOPS and network bandwidth capacities are 0 for nodes
+	// which do not limit them.
+	diskIOPSTotal         int
+	diskIOPSAvail         int
+	netBandwidthTotalMbps int
+	netBandwidthAvailMbps int
 }
 
 type controllerStatus uint8
@@ -434,6 +447,10 @@ func (sched *ssntpSchedulerServer) updateNodeStat(node *nodeStat, status ssntp.S
 		node.cpus = stats.CpusOnline
 		node.networks = stats.Networks
 		node.hostname = stats.NodeHostName
+		node.diskIOPSTotal = stats.DiskIOPSTotal
+		node.diskIOPSAvail = stats.DiskIOPSAvailable
+		node.netBandwidthTotalMbps = stats.NetBandwidthTotalMbps
+		node.netBandwidthAvailMbps = stats.NetBandwidthAvailableMbps
 
 		//any changes to the payloads.Ready struct should be
 		//accompanied by a change here
@@ -473,9 +490,11 @@ func (sched *ssntpSchedulerServer) StatusNotify(uuid string, status ssntp.Status
 }
 
 type workResources struct {
-	instanceUUID string
-	diskReqMB    int
-	requirements payloads.WorkloadRequirements
+	instanceUUID  string
+	requestID     string
+	diskReqMB     int
+	excludeNodeID string
+	requirements  payloads.WorkloadRequirements
 }
 
 func (sched *ssntpSchedulerServer) getWorkloadResources(work *payloads.Start) (workload workResources, err error) {
@@ -487,9 +506,11 @@ func (sched *ssntpSchedulerServer) getWorkloadResources(work *payloads.Start) (w
 	}
 
 	workload.requirements = work.Start.Requirements
+	workload.excludeNodeID = work.Start.ExcludeNodeID
 
 	// note the uuid
 	workload.instanceUUID = work.Start.InstanceUUID
+	workload.requestID = work.Start.RequestID
 
 	return workload, nil
 }
@@ -512,16 +533,31 @@ func (sched *ssntpSchedulerServer) workloadFits(node *nodeStat, workload *workRe
 			return false
 		}
 
+		if workload.excludeNodeID == node.uuid {
+			return false
+		}
+
+		if node.diskIOPSTotal > 0 &&
+			node.diskIOPSAvail < workload.requirements.DiskIOPS {
+			return false
+		}
+
+		if node.netBandwidthTotalMbps > 0 &&
+			node.netBandwidthAvailMbps < workload.requirements.NetBandwidthMbps {
+			return false
+		}
+
 		return true
 	}
 	return false
 }
 
-func (sched *ssntpSchedulerServer) sendStartFailureError(clientUUID string, instanceUUID string, reason payloads.StartFailureReason, restart bool) {
+func (sched *ssntpSchedulerServer) sendStartFailureError(clientUUID string, workload *workResources, reason payloads.StartFailureReason, restart bool) {
 	error := payloads.ErrorStartFailure{
-		InstanceUUID: instanceUUID,
+		InstanceUUID: workload.instanceUUID,
 		Reason:       reason,
 		Restart:      restart,
+		RequestID:    workload.requestID,
 	}
 
 	payload, err := yaml.Marshal(&error)
@@ -602,33 +638,33 @@ func (sched *ssntpSchedulerServer) fwdEventToCNCI(event ssntp.Event, payload []b
 	return dest
 }
 
-func getWorkloadAgentUUID(sched *ssntpSchedulerServer, command ssntp.Command, payload []byte) (string, string, error) {
+func getWorkloadAgentUUID(sched *ssntpSchedulerServer, command ssntp.Command, payload []byte) (string, string, string, error) {
 	switch command {
 	default:
-		return "", "", fmt.Errorf("unsupported ssntp.Command type \"%s\"", command)
+		return "", "", "", fmt.Errorf("unsupported ssntp.Command type \"%s\"", command)
 	case ssntp.DELETE:
 		var cmd payloads.Delete
 		err := yaml.Unmarshal(payload, &cmd)
-		return cmd.Delete.InstanceUUID, cmd.Delete.WorkloadAgentUUID, err
+		return cmd.Delete.InstanceUUID, cmd.Delete.WorkloadAgentUUID, cmd.Delete.RequestID, err
 	case ssntp.EVACUATE:
 		var cmd payloads.Evacuate
 		err := yaml.Unmarshal(payload, &cmd)
-		return "", cmd.Evacuate.WorkloadAgentUUID, err
+		return "", cmd.Evacuate.WorkloadAgentUUID, "", err
 	case ssntp.Restore:
 		var cmd payloads.Restore
 		err := yaml.Unmarshal(payload, &cmd)
-		return "", cmd.Restore.WorkloadAgentUUID, err
+		return "", cmd.Restore.WorkloadAgentUUID, "", err
 	case ssntp.AttachVolume:
 		var cmd payloads.AttachVolume
 		err := yaml.Unmarshal(payload, &cmd)
-		return cmd.Attach.InstanceUUID, cmd.Attach.WorkloadAgentUUID, err
+		return cmd.Attach.InstanceUUID, cmd.Attach.WorkloadAgentUUID, "", err
 	}
 }
 
 func (sched *ssntpSchedulerServer) fwdCmdToComputeNode(command ssntp.Command, payload []byte) (dest ssntp.ForwardDestination, instanceUUID string) {
 	// some commands require no scheduling choice, rather the specified
 	// agent/launcher needs the command instead of the scheduler
-	instanceUUID, cnDestUUID, err := getWorkloadAgentUUID(sched, command, payload)
+	instanceUUID, cnDestUUID, requestID, err := getWorkloadAgentUUID(sched, command, payload)
 	if err != nil || cnDestUUID == "" {
 		glog.Errorf("Bad %s command yaml from Controller, WorkloadAgentUUID == %s\n", command.String(), cnDestUUID)
 		dest.SetDecision(ssntp.Discard)
@@ -636,6 +672,9 @@ func (sched *ssntpSchedulerServer) fwdCmdToComputeNode(command ssntp.Command, pa
 	}
 
 	glog.V(2).Infof("Forwarding controller %s command to %s\n", command.String(), cnDestUUID)
+	if requestID != "" {
+		glog.Infof("%s %s for request %s forwarded to %s", command, instanceUUID, requestID, cnDestUUID)
+	}
 	dest.AddRecipient(cnDestUUID)
 
 	return
@@ -644,6 +683,12 @@ func (sched *ssntpSchedulerServer) fwdCmdToComputeNode(command ssntp.Command, pa
 // Decrement resource claims for the referenced locked nodeStat object
 func (sched *ssntpSchedulerServer) decrementResourceUsage(node *nodeStat, workload *workResources) {
 	node.memAvailMB -= workload.requirements.MemMB
+	if node.diskIOPSTotal > 0 {
+		node.diskIOPSAvail -= workload.requirements.DiskIOPS
+	}
+	if node.netBandwidthTotalMbps > 0 {
+		node.netBandwidthAvailMbps -= workload.requirements.NetBandwidthMbps
+	}
 }
 
 // Find suitable compute node, returning referenced to a locked nodeStat if found
@@ -653,7 +698,7 @@ func pickComputeNode(sched *ssntpSchedulerServer, controllerUUID string, workloa
 
 	if len(sched.cnList) == 0 {
 		glog.Errorf("No compute nodes connected, unable to start workload")
-		sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.NoComputeNodes, restart)
+		sched.sendStartFailureError(controllerUUID, workload, payloads.NoComputeNodes, restart)
 		return nil
 	}
 
@@ -686,7 +731,7 @@ func pickComputeNode(sched *ssntpSchedulerServer, controllerUUID string, workloa
 		node.mutex.Unlock()
 	}
 
-	sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.FullCloud, restart)
+	sched.sendStartFailureError(controllerUUID, workload, payloads.FullCloud, restart)
 	return nil
 }
 
@@ -697,7 +742,7 @@ func pickNetworkNode(sched *ssntpSchedulerServer, controllerUUID string, workloa
 
 	if len(sched.nnList) == 0 {
 		glog.Errorf("No network nodes connected, unable to start network workload")
-		sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.NoNetworkNodes, restart)
+		sched.sendStartFailureError(controllerUUID, workload, payloads.NoNetworkNodes, restart)
 		return nil
 	}
 
@@ -730,7 +775,7 @@ func pickNetworkNode(sched *ssntpSchedulerServer, controllerUUID string, workloa
 		node.mutex.Unlock()
 	}
 
-	sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.NoNetworkNodes, restart)
+	sched.sendStartFailureError(controllerUUID, workload, payloads.NoNetworkNodes, restart)
 	return nil
 }
 
@@ -768,6 +813,10 @@ func startWorkload(sched *ssntpSchedulerServer, controllerUUID string, payload [
 		//	hopefully not queue when all nodes have just started a workload.
 		sched.decrementResourceUsage(targetNode, &workload)
 
+		if workload.requestID != "" {
+			glog.Infof("START %s for request %s scheduled on %s", instanceUUID, workload.requestID, targetNode.uuid)
+		}
+
 		dest.AddRecipient(targetNode.uuid)
 		targetNode.mutex.Unlock()
 	} else {
@@ -1063,6 +1112,10 @@ func setSSNTPForwardRules(sched *ssntpSchedulerServer) {
 			Operand: ssntp.InstanceStopped,
 			Dest:    ssntp.Controller,
 		},
+		{ // all InstanceLog events go to all Controllers
+			Operand: ssntp.InstanceLog,
+			Dest:    ssntp.Controller,
+		},
 		{ // all ConcentratorInstanceAdded events go to all Controllers
 			Operand: ssntp.ConcentratorInstanceAdded,
 			Dest:    ssntp.Controller,
@@ -1178,6 +1231,13 @@ func configSchedulerServer() (sched *ssntpSchedulerServer) {
 		Log:       ssntp.Log,
 	}
 
+	if *commandQueue != "" {
+		sched.config.CommandQueue = &ssntp.QueueConfig{
+			Path: *commandQueue,
+			TTL:  *commandQueueTTL,
+		}
+	}
+
 	setSSNTPForwardRules(sched)
 
 	return sched
@@ -1193,10 +1253,36 @@ func main() {
 
 	glog.Info("Starting Scheduler")
 
+	if *verifyDeps {
+		reqs := osprepare.NewPackageRequirements()
+		reqs.Append(osprepare.BootstrapRequirements)
+		reqs.Append(schedDeps)
+		if err := osprepare.ReportMissingDeps(os.Stdout, reqs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *prepare {
 		logger := gloginterface.CiaoGlogLogger{}
-		osprepare.Bootstrap(context.TODO(), logger)
-		osprepare.InstallDeps(context.TODO(), schedDeps, logger)
+		var err error
+		if *pkgDir != "" {
+			err = osprepare.BootstrapFromDir(context.TODO(), *pkgDir, logger)
+			if err == nil {
+				err = osprepare.InstallDepsFromDir(context.TODO(), schedDeps, *pkgDir, logger)
+			}
+		} else {
+			err = osprepare.Bootstrap(context.TODO(), logger)
+			if err == nil {
+				err = osprepare.InstallDeps(context.TODO(), schedDeps, logger)
+			}
+		}
+		glog.Flush()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
 
@@ -208,6 +208,89 @@ func TestPickComputeNode(t *testing.T) {
 	}
 }
 
+func TestWorkloadFitsIO(t *testing.T) {
+	sched = configSchedulerServer()
+	if sched == nil {
+		t.Fatal("unable to configure test scheduler")
+	}
+
+	var work = createStartWorkload(2, 256, 10000)
+	work.Start.Requirements.DiskIOPS = 1000
+	work.Start.Requirements.NetBandwidthMbps = 500
+	resources, err := sched.getWorkloadResources(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := nodeStat{
+		status:                ssntp.READY,
+		uuid:                  "00000001",
+		memTotalMB:            141312,
+		memAvailMB:            141312,
+		diskIOPSTotal:         1500,
+		diskIOPSAvail:         1500,
+		netBandwidthTotalMbps: 10000,
+		netBandwidthAvailMbps: 10000,
+	}
+
+	if !sched.workloadFits(&node, &resources) {
+		t.Fatal("found no fit on node with free IOPS and bandwidth")
+	}
+
+	sched.decrementResourceUsage(&node, &resources)
+	if node.diskIOPSAvail != 500 || node.netBandwidthAvailMbps != 9500 {
+		t.Fatalf("unexpected IOPS %d and bandwidth %d left", node.diskIOPSAvail,
+			node.netBandwidthAvailMbps)
+	}
+
+	if sched.workloadFits(&node, &resources) {
+		t.Error("found fit on node without enough free IOPS")
+	}
+
+	node.diskIOPSAvail = 1500
+	node.netBandwidthAvailMbps = 100
+	if sched.workloadFits(&node, &resources) {
+		t.Error("found fit on node without enough free bandwidth")
+	}
+
+	// nodes which do not report their capacity are not limited
+	node.diskIOPSTotal, node.diskIOPSAvail = 0, 0
+	node.netBandwidthTotalMbps, node.netBandwidthAvailMbps = 0, 0
+	if !sched.workloadFits(&node, &resources) {
+		t.Error("found no fit on node without IOPS or bandwidth limits")
+	}
+}
+
+func TestWorkloadFitsExcludedNode(t *testing.T) {
+	sched = configSchedulerServer()
+	if sched == nil {
+		t.Fatal("unable to configure test scheduler")
+	}
+
+	var work = createStartWorkload(2, 256, 10000)
+	work.Start.ExcludeNodeID = "00000001"
+	resources, err := sched.getWorkloadResources(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := nodeStat{
+		status:     ssntp.READY,
+		uuid:       "00000001",
+		memTotalMB: 141312,
+		memAvailMB: 141312,
+	}
+
+	if sched.workloadFits(&node, &resources) {
+		t.Error("found fit on excluded node")
+	}
+
+	node.uuid = "00000002"
+	if !sched.workloadFits(&node, &resources) {
+		t.Error("found no fit on node not excluded")
+	}
+}
+
 func benchmarkPickComputeNode(b *testing.B, nodecount int) {
 	sched = configSchedulerServer()
 	if sched == nil {
@@ -749,7 +832,7 @@ func TestGetWorkloadAgentUUID(t *testing.T) {
 		{ssntp.AttachVolume, []byte(testutil.AttachVolumeYaml), testutil.InstanceUUID, testutil.AgentUUID},
 	}
 	for _, test := range stringTests {
-		instanceUUID, agentUUID, _ := GetWorkloadAgentUUID(sched, test.cmd, test.yaml)
+		instanceUUID, agentUUID, _, _ := GetWorkloadAgentUUID(sched, test.cmd, test.yaml)
 		if instanceUUID != test.expectedInstanceUUID {
 			t.Errorf("failed to get correct instanceUUID, expected %s, got %s", test.expectedInstanceUUID, instanceUUID)
 		}
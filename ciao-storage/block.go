@@ -16,6 +16,7 @@ package storage
 
 import (
 	"errors"
+	"io"
 )
 
 var (
@@ -35,6 +36,7 @@ type BlockDriver interface {
 	GetVolumeMapping() (map[string][]string, error)
 	CopyBlockDevice(string) (BlockDevice, error)
 	GetBlockDeviceSize(volumeUUID string) (uint64, error)
+	ExportBlockDevice(volumeUUID string, w io.Writer) error
 	IsValidSnapshotUUID(string) error
 	Resize(volumeUUID string, sizeGiB int) (int, error)
 }
@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -195,6 +196,21 @@ func (d CephDriver) GetBlockDeviceSize(volumeUUID string) (uint64, error) {
 	return infoData.Size, nil
 }
 
+// ExportBlockDevice writes the content of the block device to w
+func (d CephDriver) ExportBlockDevice(volumeUUID string, w io.Writer) error {
+	args := append(d.getCredentials(), "export", volumeUUID, "-")
+	cmd := exec.Command("rbd", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Error when running: %v: %v: %s", cmd.Args, err, stderr.Bytes())
+	}
+
+	return nil
+}
+
 func (d CephDriver) getCredentials() []string {
 	args := make([]string, 0, 8)
 	if d.ID != "" {
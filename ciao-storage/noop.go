@@ -16,6 +16,7 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	"sync/atomic"
 
@@ -62,6 +63,11 @@ func (d *NoopDriver) GetBlockDeviceSize(volumeUUID string) (uint64, error) {
 	return 0, nil
 }
 
+// ExportBlockDevice pretends to write the content of a block device
+func (d *NoopDriver) ExportBlockDevice(volumeUUID string, w io.Writer) error {
+	return nil
+}
+
 // MapVolumeToNode pretends to map a volume to a local device on a node.
 func (d *NoopDriver) MapVolumeToNode(volumeUUID string) (string, error) {
 	dNum := atomic.AddInt64(&d.deviceNum, 1)
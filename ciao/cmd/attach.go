@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"github.com/ciao-project/ciao/ciao-controller/types"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -22,6 +23,7 @@ import (
 var volAttachFlags = struct {
 	mode       string
 	mountpoint string
+	wait       waitFlags
 }{}
 
 var attachCmd = &cobra.Command{
@@ -44,8 +46,11 @@ var attachVolCmd = &cobra.Command{
 	Short: `Attach a volume to an instance`,
 	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.Wrap(c.AttachVolume(args[0], args[1], volAttachFlags.mountpoint, volAttachFlags.mode),
-			"Error attaching volume")
+		err := c.AttachVolume(args[0], args[1], volAttachFlags.mountpoint, volAttachFlags.mode)
+		if err != nil {
+			return errors.Wrap(err, "Error attaching volume")
+		}
+		return waitForVolume(volAttachFlags.wait, args[0], types.InUse)
 	},
 }
 
@@ -57,4 +62,5 @@ func init() {
 
 	attachVolCmd.Flags().StringVar(&volAttachFlags.mode, "mode", "rw", "Access mode")
 	attachVolCmd.Flags().StringVar(&volAttachFlags.mountpoint, "mountpoint", "/mnt", "Mount point ")
+	addWaitFlags(attachVolCmd, &volAttachFlags.wait)
 }
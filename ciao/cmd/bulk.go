@@ -0,0 +1,167 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ciao-project/ciao/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// progressBarWidth is the number of characters of the bar showing the
+// progress of bulk operations
+const progressBarWidth = 40
+
+func addParallelFlag(cmd *cobra.Command, parallel *int) {
+	cmd.Flags().IntVar(parallel, "parallel", 8, "Number of instances operated on concurrently")
+}
+
+func addForceFlag(cmd *cobra.Command, force *bool) {
+	cmd.Flags().BoolVar(force, "force", false, "Do not ask for confirmation when operating on several instances")
+}
+
+// confirm asks the user to answer yes to question before an action
+// affecting several instances, unless force is set.  The action is refused
+// if the user cannot be asked.
+func confirm(force bool, question string) error {
+	if force || c.DryRun {
+		return nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return errors.New("Not running interactively, use --force to confirm")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s Are you sure (yes/N)? ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return errors.Wrap(err, "Error reading answer")
+	}
+
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("Aborted")
+	}
+
+	return nil
+}
+
+// progress reports the completion of bulk operations on stderr.  A bar
+// is redrawn on terminals, otherwise nothing is shown so as not to clutter
+// logs.
+type progress struct {
+	sync.Mutex
+	total int
+	done  int
+	show  bool
+}
+
+func (p *progress) update() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.done++
+	if !p.show {
+		return
+	}
+
+	drawProgressBar(int64(p.done), int64(p.total), fmt.Sprintf("%d/%d", p.done, p.total))
+}
+
+// drawProgressBar redraws on stderr a bar filled in proportion of done out
+// of total, followed by label.  The line is ended once done reaches total.
+func drawProgressBar(done, total int64, label string) {
+	filled := progressBarWidth
+	if total > 0 {
+		filled = int(done * progressBarWidth / total)
+	}
+
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %s", strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled), label)
+	if done >= total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// runBulk calls op for each of the instances using at most parallel
+// concurrent calls.  Once all the calls have returned the instances for
+// which op failed are listed along with the reason.  what describes the
+// operation in the error returned if any of the calls fail, e.g., stop.
+func runBulk(parallel int, what string, ids []string, op func(id string) error) error {
+	if len(ids) == 1 {
+		return op(ids[0])
+	}
+
+	// The requests that would be sent are printed in order
+	if c.DryRun {
+		for _, id := range ids {
+			if err := op(id); errors.Cause(err) != client.ErrDryRun {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if parallel < 1 {
+		return fmt.Errorf("Invalid parallelism %d", parallel)
+	}
+
+	p := &progress{
+		total: len(ids),
+		show:  isTerminal(os.Stderr),
+	}
+	errs := make([]error, len(ids))
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = op(ids[i])
+				p.update()
+			}
+		}()
+	}
+
+	for i := range ids {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", ids[i], err)
+			failed++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %d succeeded, %d failed\n", what, len(ids)-failed, failed)
+
+	if failed > 0 {
+		return errors.Errorf("Failed to %s %d of %d instances", what, failed, len(ids))
+	}
+
+	return nil
+}
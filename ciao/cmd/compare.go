@@ -0,0 +1,115 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/intel/tfortools"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type traceStatDelta struct {
+	Stat   string
+	First  float64
+	Second float64
+	Delta  float64
+	Change string
+}
+
+type traceComparison struct {
+	FirstLabel  string
+	SecondLabel string
+	Deltas      []traceStatDelta
+}
+
+func newTraceStatDelta(stat string, first, second float64) traceStatDelta {
+	change := "-"
+	if first != 0 {
+		change = fmt.Sprintf("%+.1f%%", (second-first)*100/first)
+	}
+
+	return traceStatDelta{
+		Stat:   stat,
+		First:  first,
+		Second: second,
+		Delta:  second - first,
+		Change: change,
+	}
+}
+
+var compareTracesLabels []string
+
+var compareTracesCmd = &cobra.Command{
+	Use:   "traces --labels FIRST,SECOND",
+	Short: "Compare the trace data of two labels",
+	Long: `Compare the trace summaries of two labels, showing the change in the
+average and variance of the time spent in each component from the first label
+to the second.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(compareTracesLabels) != 2 {
+			return errors.New("Exactly two trace labels must be supplied")
+		}
+
+		first, err := c.GetTraceData(compareTracesLabels[0])
+		if err != nil {
+			return errors.Wrapf(err, "Error getting trace data for %s", compareTracesLabels[0])
+		}
+
+		second, err := c.GetTraceData(compareTracesLabels[1])
+		if err != nil {
+			return errors.Wrapf(err, "Error getting trace data for %s", compareTracesLabels[1])
+		}
+
+		a, b := first.Summary, second.Summary
+		comparison := traceComparison{
+			FirstLabel:  compareTracesLabels[0],
+			SecondLabel: compareTracesLabels[1],
+			Deltas: []traceStatDelta{
+				newTraceStatDelta("Instances", float64(a.NumInstances), float64(b.NumInstances)),
+				newTraceStatDelta("Total elapsed", a.TotalElapsed, b.TotalElapsed),
+				newTraceStatDelta("Average elapsed", a.AverageElapsed, b.AverageElapsed),
+				newTraceStatDelta("Average controller", a.AverageControllerElapsed, b.AverageControllerElapsed),
+				newTraceStatDelta("Average scheduler", a.AverageSchedulerElapsed, b.AverageSchedulerElapsed),
+				newTraceStatDelta("Average launcher", a.AverageLauncherElapsed, b.AverageLauncherElapsed),
+				newTraceStatDelta("Controller variance", a.VarianceController, b.VarianceController),
+				newTraceStatDelta("Scheduler variance", a.VarianceScheduler, b.VarianceScheduler),
+				newTraceStatDelta("Launcher variance", a.VarianceLauncher, b.VarianceLauncher),
+			},
+		}
+
+		return render(cmd, comparison)
+	},
+	Annotations: map[string]string{
+		"default_template": `First:	{{ .FirstLabel }}
+Second:	{{ .SecondLabel }}
+{{ htable .Deltas }}`,
+		"template_usage": tfortools.GenerateUsageUndecorated(traceComparison{}),
+	},
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare resources",
+}
+
+func init() {
+	compareTracesCmd.Flags().StringSliceVar(&compareTracesLabels, "labels", nil, "Comma separated trace labels to compare")
+	compareCmd.AddCommand(compareTracesCmd)
+
+	rootCmd.AddCommand(compareCmd)
+}
@@ -0,0 +1,382 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// completionCacheTTL is how long the IDs listed for shell completion are
+// reused before the controller is queried again.
+var completionCacheTTL = 30 * time.Second
+
+// idListers return the IDs of the objects of each kind that can be
+// completed.
+var idListers = map[string]func() ([]string, error){
+	"image": func() ([]string, error) {
+		images, err := c.ListImages()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(images))
+		for _, i := range images {
+			ids = append(ids, i.ID)
+		}
+		return ids, nil
+	},
+	"instance": func() ([]string, error) {
+		servers, err := c.ListInstances()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(servers.Servers))
+		for _, s := range servers.Servers {
+			ids = append(ids, s.ID)
+		}
+		return ids, nil
+	},
+	"tenant": func() ([]string, error) {
+		tenants, err := c.ListTenants()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(tenants.Tenants))
+		for _, t := range tenants.Tenants {
+			ids = append(ids, t.ID)
+		}
+		return ids, nil
+	},
+	"volume": func() ([]string, error) {
+		volumes, err := c.ListVolumes()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(volumes))
+		for _, v := range volumes {
+			ids = append(ids, v.ID)
+		}
+		return ids, nil
+	},
+	"workload": func() ([]string, error) {
+		wls, err := c.ListWorkloads()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(wls))
+		for _, wl := range wls {
+			ids = append(ids, wl.ID)
+		}
+		return ids, nil
+	},
+}
+
+// argCompletions gives the kind of object expected by each argument of the
+// commands whose arguments are completed. Empty kinds are not completed.
+var argCompletions = map[*cobra.Command][]string{
+	attachIPCmd:        {"", "instance"},
+	attachVolCmd:       {"volume", "instance"},
+	detachVolCmd:       {"volume"},
+	eventExportCmd:     {"tenant"},
+	eventListCmd:       {"tenant"},
+	imageDelCmd:        {"image"},
+	imageDownloadCmd:   {"image"},
+	imageShowCmd:       {"image"},
+	instanceCreateCmd:  {"workload"},
+	instanceDelCmd:     {"instance"},
+	instanceListCmd:    {"workload"},
+	instanceShowCmd:    {"instance"},
+	quotasListCmd:      {"tenant"},
+	restartInstanceCmd: {"instance"},
+	sshCmd:             {"instance"},
+	stopInstanceCmd:    {"instance"},
+	tenantDelCmd:       {"tenant"},
+	tenantShowCmd:      {"tenant"},
+	tenantUpdateCmd:    {"tenant"},
+	updateQuotasCmd:    {"tenant"},
+	volumeDelCmd:       {"volume"},
+	volumeShowCmd:      {"volume"},
+	workloadDelCmd:     {"workload"},
+	workloadShowCmd:    {"workload"},
+	workloadUpdateCmd:  {"workload"},
+}
+
+func completionCacheFile(kind string) string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+
+	// IDs are only valid for the controller and tenant they were
+	// listed from.
+	key := sha256.Sum256([]byte(c.ControllerURL + "\x00" + c.TenantID + "\x00" + kind))
+	return filepath.Join(dir, "ciao", "completion", fmt.Sprintf("%x", key[:8]))
+}
+
+func completeIDs(kind string) ([]string, error) {
+	list, ok := idListers[kind]
+	if !ok {
+		return nil, fmt.Errorf("Unknown object type %s", kind)
+	}
+
+	cacheFile := completionCacheFile(kind)
+	if fi, err := os.Stat(cacheFile); err == nil && time.Since(fi.ModTime()) < completionCacheTTL {
+		if data, err := ioutil.ReadFile(cacheFile); err == nil {
+			return strings.Fields(string(data)), nil
+		}
+	}
+
+	ids, err := list()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error listing %ss", kind)
+	}
+	sort.Strings(ids)
+
+	// Failing to cache the IDs only makes the next completion slower
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0700); err == nil {
+		_ = ioutil.WriteFile(cacheFile, []byte(strings.Join(ids, "\n")+"\n"), 0600)
+	}
+
+	return ids, nil
+}
+
+var completeIDsCmd = &cobra.Command{
+	Use:    "__complete-ids KIND",
+	Short:  "List the IDs used to complete arguments",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ids, err := completeIDs(args[0])
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	},
+}
+
+// bashCompletionFunction generates the __custom_func called by the cobra
+// bash completion when it has no completion of its own for an argument.
+func bashCompletionFunction() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(`__ciao_complete_ids()
+{
+    local ids
+    ids=$(ciao __complete-ids "$1" 2>/dev/null)
+    COMPREPLY=( $(compgen -W "${ids}" -- "$cur") )
+}
+
+__custom_func()
+{
+    case "${last_command}:${#nouns[@]}" in
+`)
+
+	var cases []string
+	for cmd, kinds := range argCompletions {
+		name := strings.Replace(cmd.CommandPath(), " ", "_", -1)
+		for i, kind := range kinds {
+			if kind == "" {
+				continue
+			}
+			cases = append(cases, fmt.Sprintf("        %s:%d)\n            __ciao_complete_ids %s\n            ;;\n",
+				name, i, kind))
+		}
+	}
+	sort.Strings(cases)
+	buf.WriteString(strings.Join(cases, ""))
+
+	buf.WriteString(`        *)
+            ;;
+    esac
+}
+`)
+
+	return buf.String()
+}
+
+// zshCompletionPreamble defines the functions of the bash-completion
+// library used by the cobra bash completion, so that the bash completion
+// can be loaded in zsh by bashcompinit.
+const zshCompletionPreamble = `#compdef ciao
+
+__ciao_bash_source() {
+	alias shopt=':'
+	alias _expand=_bash_expand
+	alias _complete=_bash_comp
+	emulate -L sh
+	setopt kshglob noshglob braceexpand
+	source "$@"
+}
+
+__ciao_type() {
+	# -t is not supported by zsh
+	if [ "$1" = "-t" ]; then
+		shift
+	fi
+	type "$@"
+}
+
+__ciao_compgen() {
+	local completions w
+	completions=( $(compgen "$@") ) || return $?
+	# filter by the word being completed
+	while [[ "$1" = -* && "$1" != -- ]]; do
+		shift
+		shift
+	done
+	if [[ "$1" == -- ]]; then
+		shift
+	fi
+	for w in "${completions[@]}"; do
+		if [[ "${w}" = "$1"* ]]; then
+			echo "${w}"
+		fi
+	done
+}
+
+__ciao_compopt() {
+	true # not supported by bashcompinit
+}
+
+__ciao_ltrim_colon_completions() {
+	true # words are not split on colons in zsh
+}
+
+__ciao_get_comp_words_by_ref() {
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[${COMP_CWORD}-1]}"
+	words=("${COMP_WORDS[@]}")
+	cword=("${COMP_CWORD[@]}")
+}
+
+__ciao_filedir() {
+	local RET w
+	if [ "$1" = "-d" ]; then
+		RET=( $(compgen -d) )
+	else
+		RET=( $(compgen -f) )
+	fi
+	for w in ${RET[@]}; do
+		if [[ "${w}" = "${cur}"* ]]; then
+			COMPREPLY+=("${w}")
+		fi
+	done
+}
+
+autoload -U +X bashcompinit && bashcompinit
+`
+
+// zshRewrites adapt the bash completion script to the subset of bash
+// emulated by zsh.
+var zshRewrites = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`declare -F`), "whence -w"},
+	{regexp.MustCompile(`_get_comp_words_by_ref "\$@"`), `_get_comp_words_by_ref "$$*"`},
+	{regexp.MustCompile(`local ([a-zA-Z0-9_]*)=`), "local $1; $1="},
+	{regexp.MustCompile(`flags\+=\("(--.*)="\)`), `flags+=("$1"); two_word_flags+=("$1")`},
+	{regexp.MustCompile(`must_have_one_flag\+=\("(--.*)="\)`), `must_have_one_flag+=("$1")`},
+	{regexp.MustCompile(`\b_filedir\b`), "__ciao_filedir"},
+	{regexp.MustCompile(`\b_get_comp_words_by_ref\b`), "__ciao_get_comp_words_by_ref"},
+	{regexp.MustCompile(`\b__ltrim_colon_completions\b`), "__ciao_ltrim_colon_completions"},
+	{regexp.MustCompile(`\bcompgen\b`), "__ciao_compgen"},
+	{regexp.MustCompile(`\bcompopt\b`), "__ciao_compopt"},
+	{regexp.MustCompile(`\bdeclare\b`), "builtin declare"},
+	{regexp.MustCompile(`\$\(type\b`), "$$(__ciao_type"},
+}
+
+// genZshCompletion writes a zsh completion script, built by loading the
+// bash completion with bashcompinit.  This completes the same flags and
+// IDs as the bash completion, which the completion generated by cobra for
+// zsh does not.
+func genZshCompletion(w io.Writer) error {
+	var bash bytes.Buffer
+	if err := rootCmd.GenBashCompletion(&bash); err != nil {
+		return err
+	}
+
+	script := bash.String()
+	for _, r := range zshRewrites {
+		script = r.re.ReplaceAllString(script, r.repl)
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n__ciao_bash_source <(cat <<'BASH_COMPLETION_EOF'\n%sBASH_COMPLETION_EOF\n)\n",
+		zshCompletionPreamble, script)
+	return err
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh]",
+	Short: "Generate the shell completion script",
+	Long: `Generate the bash or zsh completion script for the CLI.  A bash script is
+generated if no shell is given.
+
+The IDs of instances, workloads, tenants and volumes are completed by querying
+the controller. The IDs are cached for a short time to keep completion fast.
+
+To load the completion in the current shell run
+
+	source <(ciao completion bash)
+
+or
+
+	source <(ciao completion zsh)`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh"},
+	// Generating the script does not require access to the controller
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootCmd.BashCompletionFunction = bashCompletionFunction()
+
+		shell := "bash"
+		if len(args) == 1 {
+			shell = args[0]
+		}
+
+		var err error
+		switch shell {
+		case "bash":
+			err = rootCmd.GenBashCompletion(os.Stdout)
+		case "zsh":
+			err = genZshCompletion(os.Stdout)
+		default:
+			return fmt.Errorf("Unsupported shell %q, valid shells are: bash, zsh", shell)
+		}
+
+		return errors.Wrap(err, "Error generating completion")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(completeIDsCmd)
+}
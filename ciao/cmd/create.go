@@ -15,9 +15,13 @@
 package cmd
 
 import (
+	"encoding/base64"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/api"
 	"github.com/ciao-project/ciao/ciao-controller/types"
@@ -40,10 +44,20 @@ var imgFlags = struct {
 }{}
 
 var instanceFlags = struct {
-	instances int
-	label     string
-	name      string
-	workload  string
+	instances       int
+	label           string
+	name            string
+	workload        string
+	userData        string
+	replaceUserData bool
+	ipAddress       string
+	subnet          string
+	wait            waitFlags
+	parallel        int
+	file            string
+	metadata        map[string]string
+	volumes         []instanceVolume
+	expiresIn       time.Duration
 }{}
 
 var tenantFlags = struct {
@@ -58,6 +72,7 @@ var volFlags = struct {
 	size        int
 	source      string
 	sourcetype  string
+	wait        waitFlags
 }{}
 
 var imageCreateCmd = &cobra.Command{
@@ -84,7 +99,14 @@ var imageCreateCmd = &cobra.Command{
 			}
 		}
 
-		id, err := c.CreateImage(name, imageVisibility, imgFlags.id, f)
+		var size int64
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
+
+		progress := newTransferProgress(size)
+		id, err := c.CreateImage(name, imageVisibility, imgFlags.id, progressReader{f, progress})
+		progress.finish()
 		if err != nil {
 			return errors.Wrap(err, "Error creating image")
 		}
@@ -99,6 +121,93 @@ var imageCreateCmd = &cobra.Command{
 	Annotations: imageShowCmd.Annotations,
 }
 
+// instanceVolume is a volume attached to the instance created from an
+// instance spec.
+type instanceVolume struct {
+	ID         string `yaml:"id"`
+	MountPoint string `yaml:"mountpoint,omitempty"`
+	Mode       string `yaml:"mode,omitempty"`
+}
+
+// instanceSpec describes the instances created by create instance --file.
+// Its fields match the flags of the command, which take precedence.
+type instanceSpec struct {
+	Workload        string            `yaml:"workload"`
+	Instances       int               `yaml:"instances,omitempty"`
+	Name            string            `yaml:"name,omitempty"`
+	Label           string            `yaml:"label,omitempty"`
+	Metadata        map[string]string `yaml:"metadata,omitempty"`
+	UserData        string            `yaml:"user_data,omitempty"`
+	ReplaceUserData bool              `yaml:"replace_user_data,omitempty"`
+	IPAddress       string            `yaml:"ip,omitempty"`
+	Subnet          string            `yaml:"subnet,omitempty"`
+	Volumes         []instanceVolume  `yaml:"volumes,omitempty"`
+	ExpiresIn       time.Duration     `yaml:"expires_in,omitempty"`
+}
+
+// applyInstanceSpec reads the YAML, or JSON, instance spec found at path and
+// sets the flags of cmd not given on the command line from it.  The path of
+// the user data is relative to the spec.
+func applyInstanceSpec(cmd *cobra.Command, path string) error {
+	var spec instanceSpec
+
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "Error reading instance spec")
+	}
+
+	err = yaml.Unmarshal(f, &spec)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshalling instance spec")
+	}
+
+	if spec.UserData != "" && !filepath.IsAbs(spec.UserData) {
+		spec.UserData = filepath.Join(filepath.Dir(path), spec.UserData)
+	}
+
+	set := func(flag string, value *string, specValue string) {
+		if !cmd.Flags().Changed(flag) && specValue != "" {
+			*value = specValue
+		}
+	}
+
+	set("workload", &instanceFlags.workload, spec.Workload)
+	set("name", &instanceFlags.name, spec.Name)
+	set("label", &instanceFlags.label, spec.Label)
+	set("user-data", &instanceFlags.userData, spec.UserData)
+	set("ip", &instanceFlags.ipAddress, spec.IPAddress)
+	set("subnet", &instanceFlags.subnet, spec.Subnet)
+
+	if !cmd.Flags().Changed("instances") && spec.Instances > 0 {
+		instanceFlags.instances = spec.Instances
+	}
+
+	if !cmd.Flags().Changed("replace-user-data") {
+		instanceFlags.replaceUserData = spec.ReplaceUserData
+	}
+
+	if !cmd.Flags().Changed("expires-in") {
+		instanceFlags.expiresIn = spec.ExpiresIn
+	}
+
+	instanceFlags.metadata = spec.Metadata
+
+	for _, v := range spec.Volumes {
+		if v.ID == "" {
+			return errors.New("Volumes of the instance spec must have an id")
+		}
+		if v.MountPoint == "" {
+			v.MountPoint = "/mnt"
+		}
+		if v.Mode == "" {
+			v.Mode = "rw"
+		}
+		instanceFlags.volumes = append(instanceFlags.volumes, v)
+	}
+
+	return nil
+}
+
 func validateCreateCommandArgs() error {
 	if instanceFlags.instances < 1 {
 		return errors.New("Invalid instance count")
@@ -111,40 +220,154 @@ func validateCreateCommandArgs() error {
 		}
 	}
 
+	if instanceFlags.expiresIn < 0 {
+		return errors.New("Invalid expiry time")
+	}
+
+	if len(instanceFlags.volumes) > 0 && instanceFlags.instances != 1 {
+		return errors.New("Volumes can only be attached when creating a single instance")
+	}
+
+	if instanceFlags.ipAddress != "" {
+		if instanceFlags.instances != 1 {
+			return errors.New("An IP address can only be requested when creating a single instance")
+		}
+		if net.ParseIP(instanceFlags.ipAddress) == nil {
+			return errors.New("Invalid IP address")
+		}
+	}
+
 	return nil
 }
 
-func populateCreateServerRequest(server *api.CreateServerRequest) {
-	if instanceFlags.label != "" {
+func populateCreateServerRequest(server *api.CreateServerRequest) error {
+	if len(instanceFlags.metadata) > 0 || instanceFlags.label != "" {
 		server.Server.Metadata = make(map[string]string)
-		server.Server.Metadata["label"] = instanceFlags.label
+		for k, v := range instanceFlags.metadata {
+			server.Server.Metadata[k] = v
+		}
+		if instanceFlags.label != "" {
+			server.Server.Metadata["label"] = instanceFlags.label
+		}
 	}
 
 	server.Server.MaxInstances = instanceFlags.instances
 	server.Server.MinInstances = 1
 	server.Server.Name = instanceFlags.name
+	server.Server.IPAddress = instanceFlags.ipAddress
+	server.Server.SubnetID = instanceFlags.subnet
+
+	// Expire no earlier than requested
+	if instanceFlags.expiresIn > 0 {
+		server.Server.ExpiresIn = int((instanceFlags.expiresIn + time.Second - 1) / time.Second)
+	}
+
+	if instanceFlags.userData != "" {
+		userData, err := ioutil.ReadFile(instanceFlags.userData)
+		if err != nil {
+			return errors.Wrap(err, "Error reading user data")
+		}
+		server.Server.UserData = base64.StdEncoding.EncodeToString(userData)
+		server.Server.UserDataMode = api.UserDataMerge
+		if instanceFlags.replaceUserData {
+			server.Server.UserDataMode = api.UserDataReplace
+		}
+	}
+
+	return nil
 }
 
 var instanceCreateCmd = &cobra.Command{
-	Use:   "instance WORKLOAD",
+	Use:   "instance [WORKLOAD]",
 	Short: "Create an instance of a workload",
-	Args:  cobra.ExactArgs(1),
+	Long: `Create instances of a workload, given as argument, with --workload or in the
+instance spec read from --file.
+
+An instance spec is a YAML, or JSON, file describing the instances to create
+so that they can be kept under version control, e.g.,
+
+    workload: 7d3a7bd4-1b5e-4b2e-9d5f-8e1a4e0a3c2f
+    instances: 1
+    name: db
+    metadata:
+      role: database
+    user_data: db-cloud-init.yaml
+    subnet: 0e2c6a4e-6d3b-4b8e-9f5e-2d1b9c7a8f10
+    volumes:
+    - id: 5b0c9a3e-2f7d-4c1a-8e6b-3a9d2c1f0e7b
+      mountpoint: /var/lib/db
+
+The fields match the flags of the command, which take precedence over the
+spec.  The volumes listed are attached once the instance is created.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if instanceFlags.file != "" {
+			if err := applyInstanceSpec(cmd, instanceFlags.file); err != nil {
+				return err
+			}
+		}
+
+		if len(args) == 1 {
+			instanceFlags.workload = args[0]
+		}
+
+		if instanceFlags.workload == "" {
+			return errors.New("A workload must be given as argument, with --workload or in the instance spec")
+		}
+
 		if err := validateCreateCommandArgs(); err != nil {
 			return err
 		}
 
 		var server api.CreateServerRequest
 
-		server.Server.WorkloadID = args[0]
+		server.Server.WorkloadID = instanceFlags.workload
 
-		populateCreateServerRequest(&server)
+		if err := populateCreateServerRequest(&server); err != nil {
+			return err
+		}
 
 		servers, err := c.CreateInstances(server)
 		if err != nil {
 			return errors.Wrap(err, "Error creating instances")
 		}
 
+		if instanceFlags.wait.enabled {
+			ids := make([]string, len(servers.Servers))
+			index := make(map[string]int)
+			for i, s := range servers.Servers {
+				ids[i] = s.ID
+				index[s.ID] = i
+			}
+
+			// Each goroutine updates a different instance of the slice
+			err := runBulk(instanceFlags.parallel, "start", ids, func(id string) error {
+				err := waitForInstance(instanceFlags.wait, id, payloads.ComputeStatusRunning)
+				if err != nil {
+					return err
+				}
+
+				server, err := c.GetInstance(id)
+				if err != nil {
+					return errors.Wrap(err, "Error getting instance")
+				}
+				servers.Servers[index[id]] = server.Server
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, v := range instanceFlags.volumes {
+			for _, s := range servers.Servers {
+				err := c.AttachVolume(v.ID, s.ID, v.MountPoint, v.Mode)
+				if err != nil {
+					return errors.Wrapf(err, "Error attaching volume %s", v.ID)
+				}
+			}
+		}
+
 		return render(cmd, servers.Servers)
 	},
 	Annotations: instanceListCmd.Annotations,
@@ -217,6 +440,17 @@ var volumeCreateCmd = &cobra.Command{
 			return errors.Wrap(err, "Error creating volume")
 		}
 
+		if volFlags.wait.enabled {
+			if err := waitForVolume(volFlags.wait, vol.ID, types.Available); err != nil {
+				return err
+			}
+
+			vol, err = c.GetVolume(vol.ID)
+			if err != nil {
+				return errors.Wrap(err, "Error getting volume")
+			}
+		}
+
 		return render(cmd, vol)
 	},
 	Annotations: volumeShowCmd.Annotations,
@@ -236,11 +470,15 @@ type disk struct {
 }
 
 type workloadRequirements struct {
-	VCPUs      int    `yaml:"vcpus"`
-	MemMB      int    `yaml:"mem_mb"`
-	NodeID     string `yaml:"node_id,omitempty"`
-	Hostname   string `yaml:"hostname,omitempty"`
-	Privileged bool   `yaml:"privileged,omitempty"`
+	VCPUs                int               `yaml:"vcpus"`
+	MemMB                int               `yaml:"mem_mb"`
+	NodeID               string            `yaml:"node_id,omitempty"`
+	Hostname             string            `yaml:"hostname,omitempty"`
+	Privileged           bool              `yaml:"privileged,omitempty"`
+	DisableNetMultiQueue bool              `yaml:"disable_net_multiqueue,omitempty"`
+	DiskIOPS             int               `yaml:"disk_iops,omitempty"`
+	NetBandwidthMbps     int               `yaml:"net_bandwidth_mbps,omitempty"`
+	ExtraSpecs           map[string]string `yaml:"extra_specs,omitempty"`
 }
 
 type workloadOptions struct {
@@ -332,51 +570,115 @@ func optToReq(opt workloadOptions, req *types.Workload) error {
 	req.Requirements.Hostname = opt.Requirements.Hostname
 	req.Requirements.NodeID = opt.Requirements.NodeID
 	req.Requirements.Privileged = opt.Requirements.Privileged
+	req.Requirements.DisableNetMultiQueue = opt.Requirements.DisableNetMultiQueue
+	req.Requirements.DiskIOPS = opt.Requirements.DiskIOPS
+	req.Requirements.NetBandwidthMbps = opt.Requirements.NetBandwidthMbps
+	req.Requirements.ExtraSpecs = opt.Requirements.ExtraSpecs
 
 	return nil
 }
 
+// workloadFromFile builds a workload request from the workload yaml file
+// found at path
+func workloadFromFile(path string) (types.Workload, error) {
+	var opt workloadOptions
+	var req types.Workload
+
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		return req, errors.Wrap(err, "Error reading config file")
+	}
+
+	err = yaml.Unmarshal(f, &opt)
+	if err != nil {
+		return req, errors.Wrap(err, "Error unmarshalling file")
+	}
+
+	err = optToReq(opt, &req)
+	if err != nil {
+		return req, errors.Wrap(err, "Error converting options to request")
+	}
+
+	return req, nil
+}
+
 var workloadCreateCmd = &cobra.Command{
 	Use:   "workload FILE",
 	Short: `Create a new workload`,
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var opt workloadOptions
-		var req types.Workload
-
-		config := args[0]
-
-		f, err := ioutil.ReadFile(config)
+		req, err := workloadFromFile(args[0])
 		if err != nil {
-			return errors.Wrap(err, "Error reading config file")
+			return err
 		}
 
-		err = yaml.Unmarshal(f, &opt)
+		workload, err := c.CreateWorkload(req)
 		if err != nil {
-			return errors.Wrap(err, "Error unmarshalling file")
+			return errors.Wrap(err, "Error creating workload")
 		}
 
-		err = optToReq(opt, &req)
+		return render(cmd, workload)
+	},
+	Annotations: workloadShowCmd.Annotations,
+}
+
+var subnetFlags = struct {
+	name string
+}{}
+
+var subnetCreateCmd = &cobra.Command{
+	Use:   "subnet CIDR",
+	Short: "Add a subnet to the tenant network",
+	Long: `Add a subnet to the tenant network.  The subnet must lie within
+172.16.0.0/12 and have the tenant's subnet size.  Instances are only
+attached to it when it is passed to create instance --subnet.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subnet, err := c.CreateSubnet(subnetFlags.name, args[0])
 		if err != nil {
-			return errors.Wrap(err, "Error converting options to request")
+			return errors.Wrap(err, "Error creating subnet")
 		}
 
-		workload, err := c.CreateWorkload(req)
+		return render(cmd, subnet)
+	},
+	Annotations: subnetShowCmd.Annotations,
+}
+
+var reservedIPFlags = struct {
+	description string
+}{}
+
+var reservedIPCreateCmd = &cobra.Command{
+	Use:   "reserved-ip ADDRESS",
+	Short: "Reserve an address of the tenant network",
+	Long: `Reserve an address of the tenant network so that it is not assigned
+to instances automatically.  The address can be assigned to an instance
+with create instance --ip, which consumes the reservation.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if net.ParseIP(args[0]) == nil {
+			return errors.New("Invalid IP address")
+		}
+
+		reserved, err := c.ReserveIP(args[0], reservedIPFlags.description)
 		if err != nil {
-			return errors.Wrap(err, "Error creating workload")
+			return errors.Wrap(err, "Error reserving IP")
 		}
 
-		return render(cmd, workload)
+		return render(cmd, []types.ReservedIP{reserved})
 	},
-	Annotations: workloadShowCmd.Annotations,
+	Annotations: reservedIPListCmd.Annotations,
 }
 
-var createCmds = []*cobra.Command{imageCreateCmd, instanceCreateCmd, poolCreateCmd, volumeCreateCmd, workloadCreateCmd, tenantCreateCmd}
+var createCmds = []*cobra.Command{imageCreateCmd, instanceCreateCmd, poolCreateCmd, reservedIPCreateCmd, subnetCreateCmd, volumeCreateCmd, workloadCreateCmd, tenantCreateCmd}
 
 func init() {
 	for _, cmd := range createCmds {
 		createCmd.AddCommand(cmd)
 	}
+
+	reservedIPCreateCmd.Flags().StringVar(&reservedIPFlags.description, "description", "", "What the address is reserved for")
+	subnetCreateCmd.Flags().StringVar(&subnetFlags.name, "name", "", "Name of the subnet")
 	rootCmd.AddCommand(createCmd)
 
 	imageCreateCmd.Flags().StringVar(&imgFlags.id, "id", "", "Image ID")
@@ -386,12 +688,21 @@ func init() {
 	instanceCreateCmd.Flags().StringVar(&instanceFlags.label, "label", "", "Set a frame label. This will trigger frame tracing")
 	instanceCreateCmd.Flags().StringVar(&instanceFlags.name, "name", "", "Name for this instance. When multiple instances are requested this is used as a prefix")
 	instanceCreateCmd.Flags().StringVar(&instanceFlags.workload, "workload", "", "Workload UUID")
+	instanceCreateCmd.Flags().StringVar(&instanceFlags.userData, "user-data", "", "Path to a cloud-init config merged with the workload's config")
+	instanceCreateCmd.Flags().BoolVar(&instanceFlags.replaceUserData, "replace-user-data", false, "Replace the workload's cloud-init config with --user-data instead of merging")
+	instanceCreateCmd.Flags().StringVar(&instanceFlags.ipAddress, "ip", "", "IP address from the tenant network to assign to the instance")
+	instanceCreateCmd.Flags().StringVar(&instanceFlags.subnet, "subnet", "", "ID of the tenant subnet to attach the instance to")
+	instanceCreateCmd.Flags().DurationVar(&instanceFlags.expiresIn, "expires-in", 0, "Delete the instances once they have existed for this long, e.g., 2h")
+	instanceCreateCmd.Flags().StringVar(&instanceFlags.file, "file", "", "YAML or JSON spec describing the instances to create")
+	addWaitFlags(instanceCreateCmd, &instanceFlags.wait)
+	addParallelFlag(instanceCreateCmd, &instanceFlags.parallel)
 
 	volumeCreateCmd.Flags().StringVar(&volFlags.description, "description", "", "Volume description")
 	volumeCreateCmd.Flags().StringVar(&volFlags.name, "name", "", "Volume name")
 	volumeCreateCmd.Flags().IntVar(&volFlags.size, "size", 1, "Size of the volume in GiB")
 	volumeCreateCmd.Flags().StringVar(&volFlags.source, "source", "", "ID of image or volume to clone from")
 	volumeCreateCmd.Flags().StringVar(&volFlags.sourcetype, "source-type", "image", "The type of the source to clone from")
+	addWaitFlags(volumeCreateCmd, &volFlags.wait)
 
 	tenantCreateCmd.Flags().IntVar(&tenantFlags.cidrPrefixSize, "cidr-prefix-size", 0, "Number of bits in network mask (12-30)")
 	tenantCreateCmd.Flags().BoolVar(&tenantFlags.createPrivilegedContainers, "create-privileged-containers", false, "Whether this tenant can create privileged containers")
@@ -0,0 +1,117 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/spf13/cobra"
+)
+
+// csvRecords converts the data rendered by the commands supporting
+// --format csv to a header and the records following it.
+var csvRecords = map[*cobra.Command]func(data interface{}) ([]string, [][]string){}
+
+func quotaRecords(data interface{}) ([]string, [][]string) {
+	quotas := data.([]types.QuotaDetails)
+	records := make([][]string, 0, len(quotas))
+	for _, q := range quotas {
+		value := strconv.Itoa(q.Value)
+		if q.Value == -1 {
+			value = "unlimited"
+		}
+
+		// Limits have no usage
+		usage := ""
+		if !strings.Contains(q.Name, "limit") {
+			usage = strconv.Itoa(q.Usage)
+		}
+
+		records = append(records, []string{q.Name, value, usage})
+	}
+
+	return []string{"name", "value", "usage"}, records
+}
+
+func usageRecords(data interface{}) ([]string, [][]string) {
+	if summaries, ok := data.([]usageSummary); ok {
+		return usageSummaryRecords(summaries)
+	}
+
+	usages := data.([]types.CiaoUsage)
+	records := make([][]string, 0, len(usages))
+	for _, u := range usages {
+		records = append(records, []string{
+			u.Timestamp.Format(time.RFC3339),
+			strconv.Itoa(u.VCPU),
+			strconv.Itoa(u.Memory),
+			strconv.Itoa(u.Disk),
+		})
+	}
+
+	return []string{"timestamp", "cpus_usage", "ram_usage", "disk_usage"}, records
+}
+
+func usageSummaryRecords(summaries []usageSummary) ([]string, [][]string) {
+	avg := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	records := make([][]string, 0, len(summaries))
+	for _, s := range summaries {
+		records = append(records, []string{
+			s.Start.Format(time.RFC3339),
+			strconv.Itoa(s.Samples),
+			strconv.Itoa(s.MinVCPU), avg(s.AvgVCPU), strconv.Itoa(s.MaxVCPU),
+			strconv.Itoa(s.MinMemory), avg(s.AvgMemory), strconv.Itoa(s.MaxMemory),
+			strconv.Itoa(s.MinDisk), avg(s.AvgDisk), strconv.Itoa(s.MaxDisk),
+		})
+	}
+
+	return []string{"start", "samples",
+		"cpus_usage_min", "cpus_usage_avg", "cpus_usage_max",
+		"ram_usage_min", "ram_usage_avg", "ram_usage_max",
+		"disk_usage_min", "disk_usage_avg", "disk_usage_max"}, records
+}
+
+func writeCSV(w io.Writer, cmd *cobra.Command, data interface{}) error {
+	toRecords, ok := csvRecords[cmd]
+	if !ok {
+		return fmt.Errorf("--format csv is not supported by %s", cmd.CommandPath())
+	}
+
+	header, records := toRecords(data)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+func init() {
+	csvRecords[quotasListCmd] = quotaRecords
+	csvRecords[usageListCmd] = usageRecords
+}
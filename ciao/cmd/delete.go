@@ -15,6 +15,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -42,22 +44,43 @@ var imageDelCmd = &cobra.Command{
 }
 
 var deleteInstanceFlags = struct {
-	all bool
+	all      bool
+	wait     waitFlags
+	parallel int
+	force    bool
 }{}
 
 var instanceDelCmd = &cobra.Command{
-	Use:   "instance ID",
-	Short: "Delete instance from cluster",
+	Use:   "instance ID...",
+	Short: "Delete one or more instances from the cluster",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if deleteInstanceFlags.all {
-			return errors.Wrap(c.DeleteAllInstances(), "Error deleting all instances")
+			if err := confirm(deleteInstanceFlags.force, fmt.Sprintf("This will delete all the instances of tenant %s.", c.TenantID)); err != nil {
+				return err
+			}
+
+			if err := c.DeleteAllInstances(); err != nil {
+				return errors.Wrap(err, "Error deleting all instances")
+			}
+			return waitForAllInstancesDeleted(deleteInstanceFlags.wait)
 		}
 
 		if len(args) < 1 {
 			return errors.New("Instance ID required")
 		}
 
-		return errors.Wrap(c.DeleteInstance(args[0]), "Error deleting instance")
+		if len(args) > 1 {
+			if err := confirm(deleteInstanceFlags.force, fmt.Sprintf("This will delete %d instances.", len(args))); err != nil {
+				return err
+			}
+		}
+
+		return runBulk(deleteInstanceFlags.parallel, "delete", args, func(id string) error {
+			if err := c.DeleteInstance(id); err != nil {
+				return errors.Wrap(err, "Error deleting instance")
+			}
+			return waitForInstanceDeleted(deleteInstanceFlags.wait, id)
+		})
 	},
 }
 
@@ -70,12 +93,35 @@ var poolDelCmd = &cobra.Command{
 	},
 }
 
+var reservedIPDelCmd = &cobra.Command{
+	Use:   "reserved-ip ADDRESS",
+	Short: "Release a reserved address",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.Wrap(c.ReleaseReservedIP(args[0]), "Error releasing reserved IP")
+	},
+}
+
+var subnetDelCmd = &cobra.Command{
+	Use:   "subnet ID",
+	Short: "Delete a subnet",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.Wrap(c.DeleteSubnet(args[0]), "Error deleting subnet")
+	},
+}
+
+var deleteVolumeFlags waitFlags
+
 var volumeDelCmd = &cobra.Command{
 	Use:   "volume ID",
 	Short: "Delete a volume",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.Wrap(c.DeleteVolume(args[0]), "Error deleting volume")
+		if err := c.DeleteVolume(args[0]); err != nil {
+			return errors.Wrap(err, "Error deleting volume")
+		}
+		return waitForVolumeDeleted(deleteVolumeFlags, args[0])
 	},
 }
 
@@ -97,7 +143,7 @@ var workloadDelCmd = &cobra.Command{
 	},
 }
 
-var delCmds = []*cobra.Command{eventsDelCmd, imageDelCmd, instanceDelCmd, poolDelCmd, volumeDelCmd, workloadDelCmd, tenantDelCmd}
+var delCmds = []*cobra.Command{eventsDelCmd, imageDelCmd, instanceDelCmd, poolDelCmd, reservedIPDelCmd, subnetDelCmd, volumeDelCmd, workloadDelCmd, tenantDelCmd}
 
 func init() {
 	for _, cmd := range delCmds {
@@ -105,6 +151,10 @@ func init() {
 	}
 
 	instanceDelCmd.Flags().BoolVar(&deleteInstanceFlags.all, "all", false, "Delete all instances")
+	addWaitFlags(instanceDelCmd, &deleteInstanceFlags.wait)
+	addParallelFlag(instanceDelCmd, &deleteInstanceFlags.parallel)
+	addForceFlag(instanceDelCmd, &deleteInstanceFlags.force)
+	addWaitFlags(volumeDelCmd, &deleteVolumeFlags)
 
 	rootCmd.AddCommand(deleteCmd)
 }
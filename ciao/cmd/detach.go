@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"github.com/ciao-project/ciao/ciao-controller/types"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -33,18 +34,24 @@ var detachIPCmd = &cobra.Command{
 	},
 }
 
+var volDetachFlags waitFlags
+
 var detachVolCmd = &cobra.Command{
 	Use:   "volume VOLUME",
 	Short: "Detach a volume from an instance",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.Wrap(c.DetachVolume(args[0]), "Error detaching volume")
+		if err := c.DetachVolume(args[0]); err != nil {
+			return errors.Wrap(err, "Error detaching volume")
+		}
+		return waitForVolume(volDetachFlags, args[0], types.Available)
 	},
 }
 
 func init() {
 	detachCmd.AddCommand(detachIPCmd)
 	detachCmd.AddCommand(detachVolCmd)
+	addWaitFlags(detachVolCmd, &volDetachFlags)
 
 	rootCmd.AddCommand(detachCmd)
 }
@@ -0,0 +1,206 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/spf13/cobra"
+)
+
+var doctorFlags struct {
+	maxNodeAge time.Duration
+}
+
+// Results of the checks of the doctor command
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+var checkColors = map[string]string{
+	checkOK:   "\033[32m",
+	checkWarn: "\033[33m",
+	checkFail: "\033[31m",
+	checkSkip: "\033[90m",
+}
+
+type doctorResult struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+type doctorCheck struct {
+	name       string
+	privileged bool
+	run        func() (string, string)
+}
+
+func checkController() (string, string) {
+	version, err := c.GetAPIVersion()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+
+	if err := c.SetAPIVersion(version); err != nil {
+		return checkFail, err.Error()
+	}
+
+	return checkOK, fmt.Sprintf("%s, ciao API version %d", c.ControllerURL, c.APIVersion)
+}
+
+// checkNodes reports nodes whose last stats are older than --max-node-age,
+// as they are no longer connected to the scheduler, and nodes that are
+// not ready to run instances.
+func checkNodes(list func() (types.CiaoNodes, error)) func() (string, string) {
+	return func() (string, string) {
+		nodes, err := list()
+		if err != nil {
+			return checkFail, err.Error()
+		}
+
+		if len(nodes.Nodes) == 0 {
+			return checkFail, "No node connected"
+		}
+
+		var stale, unavailable []string
+		for _, n := range nodes.Nodes {
+			if age := time.Since(n.Timestamp); age > doctorFlags.maxNodeAge {
+				stale = append(stale, fmt.Sprintf("%s (%s)", n.Hostname, humanDuration(age)))
+			} else if n.Status != string(types.NodeStatusReady) {
+				unavailable = append(unavailable, fmt.Sprintf("%s (%s)", n.Hostname, n.Status))
+			}
+		}
+
+		switch {
+		case len(stale) > 0:
+			return checkFail, fmt.Sprintf("No stats received from %s", strings.Join(stale, ", "))
+		case len(unavailable) > 0:
+			return checkWarn, fmt.Sprintf("Not ready: %s", strings.Join(unavailable, ", "))
+		}
+
+		return checkOK, fmt.Sprintf("%d nodes reporting", len(nodes.Nodes))
+	}
+}
+
+// checkCNCIs reports the tenants with CNCIs that have not come up, as
+// shown by their lack of IP address.
+func checkCNCIs() (string, string) {
+	cncis, err := c.ListCNCIs()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+
+	down := make(map[string]int)
+	tenants := make(map[string]bool)
+	for _, cnci := range cncis.CNCIs {
+		tenants[cnci.TenantID] = true
+		if cnci.IPv4 == "" {
+			down[cnci.TenantID]++
+		}
+	}
+
+	if len(down) > 0 {
+		msgs := make([]string, 0, len(down))
+		for tenant, n := range down {
+			msgs = append(msgs, fmt.Sprintf("%s (%d)", tenant, n))
+		}
+		sort.Strings(msgs)
+		return checkFail, fmt.Sprintf("CNCIs not active for tenants %s", strings.Join(msgs, ", "))
+	}
+
+	return checkOK, fmt.Sprintf("%d CNCIs active for %d tenants", len(cncis.CNCIs), len(tenants))
+}
+
+var doctorChecks = []doctorCheck{
+	{"Controller", false, checkController},
+	{"Compute nodes", true, checkNodes(c.ListComputeNodes)},
+	{"Network nodes", true, checkNodes(c.ListNetworkNodes)},
+	{"CNCIs", true, checkCNCIs},
+}
+
+func printDoctorResult(r doctorResult, color bool) {
+	status := fmt.Sprintf("%-4s", r.Status)
+	if color {
+		status = checkColors[r.Status] + status + "\033[0m"
+	}
+	fmt.Printf("[%s] %-14s %s\n", status, r.Check, r.Detail)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the health of the cluster",
+	Long: `Check that the controller can be reached and supports the CLI and, for
+privileged users, that the nodes are connected to the scheduler and ready, and
+that the CNCIs of every tenant are active. The command fails if any check
+fails.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Report the state of the cluster rather than retry
+		c.Retries = 0
+
+		color := isTerminal(os.Stdout) && !jsonOutput()
+		results := make([]doctorResult, 0, len(doctorChecks))
+		failed := 0
+
+		// The first check is that of the controller, which the
+		// others depend on.
+		for i, check := range doctorChecks {
+			r := doctorResult{Check: check.name}
+			if i > 0 && results[0].Status == checkFail {
+				r.Status, r.Detail = checkSkip, "Controller unavailable"
+			} else if check.privileged && !c.IsPrivileged() {
+				r.Status, r.Detail = checkSkip, "Limited to privileged users"
+			} else {
+				r.Status, r.Detail = check.run()
+			}
+
+			if r.Status == checkFail {
+				failed++
+			}
+
+			results = append(results, r)
+			if !jsonOutput() {
+				printDoctorResult(r, color)
+			}
+		}
+
+		if jsonOutput() {
+			if err := render(cmd, results); err != nil {
+				return err
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(results))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	doctorCmd.Flags().DurationVar(&doctorFlags.maxNodeAge, "max-node-age", 2*time.Minute, "Age of the last stats of a node after which it is considered disconnected")
+
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,70 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download the data of an object",
+}
+
+var imageDownloadCmd = &cobra.Command{
+	Use:   "image ID FILE",
+	Short: "Download the data of an image",
+	Long: `Download the data of an image to FILE, or to stdout if FILE is -.  The data is
+downloaded in the raw format it is stored in by the cluster.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		image, err := c.GetImage(args[0])
+		if err != nil {
+			return errors.Wrap(err, "Error getting image")
+		}
+
+		var w io.Writer = os.Stdout
+		if args[1] != "-" {
+			f, err := os.Create(args[1])
+			if err != nil {
+				return errors.Wrap(err, "Error creating image file")
+			}
+			defer func() { _ = f.Close() }()
+			w = f
+		}
+
+		progress := newTransferProgress(int64(image.Size))
+		err = c.DownloadImage(image.ID, progressWriter{w, progress})
+		progress.finish()
+		if err != nil {
+			return errors.Wrap(err, "Error downloading image")
+		}
+
+		if f, ok := w.(*os.File); ok && f != os.Stdout {
+			return errors.Wrap(f.Close(), "Error writing image file")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	downloadCmd.AddCommand(imageDownloadCmd)
+	rootCmd.AddCommand(downloadCmd)
+}
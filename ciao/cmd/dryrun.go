@@ -0,0 +1,54 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/ciao-project/ciao/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// addDryRunFlag adds --dry-run to cmd.  In dry run mode the requests that
+// would change the cluster are printed rather than sent, and the command
+// stops successfully at the first of them.
+func addDryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&c.DryRun, "dry-run", false, "Print the requests that would change the cluster instead of sending them")
+
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		if errors.Cause(err) == client.ErrDryRun {
+			return nil
+		}
+		return err
+	}
+}
+
+func init() {
+	dryRunCmds := []*cobra.Command{
+		instanceCreateCmd,
+		instanceDelCmd,
+		stopInstanceCmd,
+		restartInstanceCmd,
+		volumeCreateCmd,
+		volumeDelCmd,
+		attachVolCmd,
+		detachVolCmd,
+	}
+
+	for _, cmd := range dryRunCmds {
+		addDryRunFlag(cmd)
+	}
+}
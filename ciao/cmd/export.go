@@ -0,0 +1,315 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var eventExportFlags struct {
+	output    string
+	format    string
+	since     time.Duration
+	eventType string
+	append    bool
+}
+
+// eventWriter writes events to an export file one at a time, so that each
+// event is a complete record that survives the file being rotated.
+type eventWriter interface {
+	Write(e types.CiaoEvent) error
+	Flush() error
+}
+
+type jsonEventWriter struct {
+	enc *json.Encoder
+}
+
+func (w jsonEventWriter) Write(e types.CiaoEvent) error {
+	return w.enc.Encode(e)
+}
+
+func (w jsonEventWriter) Flush() error {
+	return nil
+}
+
+type csvEventWriter struct {
+	w *csv.Writer
+}
+
+func (w csvEventWriter) Write(e types.CiaoEvent) error {
+	return w.w.Write([]string{e.Timestamp.Format(time.RFC3339Nano), e.TenantID, e.EventType, e.Message})
+}
+
+func (w csvEventWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// checkEventExportFormat checks the format events are exported in before
+// the export file is opened, so that a typo does not truncate the file.
+func checkEventExportFormat(format string) error {
+	if format != "jsonl" && format != "csv" {
+		return fmt.Errorf("Unknown export format %q, expected jsonl or csv", format)
+	}
+
+	return nil
+}
+
+func newEventWriter(format string, w io.Writer, header bool) (eventWriter, error) {
+	if err := checkEventExportFormat(format); err != nil {
+		return nil, err
+	}
+
+	if format == "csv" {
+		cw := csvEventWriter{w: csv.NewWriter(w)}
+		if header {
+			if err := cw.w.Write([]string{"time_stamp", "tenant_id", "type", "message"}); err != nil {
+				return nil, err
+			}
+		}
+		return cw, nil
+	}
+
+	return jsonEventWriter{enc: json.NewEncoder(w)}, nil
+}
+
+// openExportFile opens the file events are exported to and reports whether
+// it is empty, in which case a CSV header must be written.
+func openExportFile(path string, appendEvents bool) (*os.File, bool, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, true, nil
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendEvents {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, false, err
+	}
+
+	return f, fi.Size() == 0, nil
+}
+
+var eventExportCmd = &cobra.Command{
+	Use:   "events [TENANT]",
+	Short: "Export events to a file",
+	Long: `Export the events of the provided tenant, or of all tenants for privileged users,
+as JSON lines or CSV for archival and offline analysis. Each event is written as
+a single line so that export files can be appended to and rotated.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkEventExportFormat(eventExportFlags.format); err != nil {
+			return err
+		}
+
+		tenantID := ""
+		if len(args) == 1 {
+			tenantID = args[0]
+		}
+
+		if !c.IsPrivileged() {
+			if tenantID == "" {
+				tenantID = c.TenantID
+			}
+		}
+
+		events, err := c.ListEvents(tenantID)
+		if err != nil {
+			return errors.Wrap(err, "Error listing events")
+		}
+
+		f, empty, err := openExportFile(eventExportFlags.output, eventExportFlags.append)
+		if err != nil {
+			return errors.Wrap(err, "Error opening export file")
+		}
+		if f != os.Stdout {
+			defer func() { _ = f.Close() }()
+		}
+
+		w, err := newEventWriter(eventExportFlags.format, f, empty)
+		if err != nil {
+			return errors.Wrap(err, "Error exporting events")
+		}
+
+		var since time.Time
+		if eventExportFlags.since > 0 {
+			since = time.Now().Add(-eventExportFlags.since)
+		}
+
+		exported := 0
+		for _, e := range events.Events {
+			if e.Timestamp.Before(since) {
+				continue
+			}
+
+			if eventExportFlags.eventType != "" && e.EventType != eventExportFlags.eventType {
+				continue
+			}
+
+			if err := w.Write(e); err != nil {
+				return errors.Wrap(err, "Error writing event")
+			}
+			exported++
+		}
+
+		if err := w.Flush(); err != nil {
+			return errors.Wrap(err, "Error writing events")
+		}
+
+		if f != os.Stdout {
+			fmt.Printf("Exported %d events to %s\n", exported, eventExportFlags.output)
+		}
+
+		return nil
+	},
+}
+
+var traceExportFlags struct {
+	output string
+	format string
+}
+
+// traceExportFormat returns the format trace frames are exported in, which
+// unless given explicitly is CSV for files ending in .csv and JSON otherwise.
+func traceExportFormat(format, output string) (string, error) {
+	if format == "" {
+		if filepath.Ext(output) == ".csv" {
+			return "csv", nil
+		}
+		return "json", nil
+	}
+
+	if format != "json" && format != "csv" {
+		return "", fmt.Errorf("Unknown export format %q, expected json or csv", format)
+	}
+
+	return format, nil
+}
+
+// writeTraceFramesCSV writes a record for each node a frame went through,
+// repeating the frame timestamps so that each record stands on its own.
+func writeTraceFramesCSV(w io.Writer, frames types.CiaoTraceFrames) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"frame_id", "type", "operand", "start_timestamp",
+		"end_timestamp", "node_id", "rx_timestamp", "tx_timestamp"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, f := range frames.Frames {
+		nodes := f.Nodes
+		if len(nodes) == 0 {
+			nodes = []types.CiaoTraceFrameNode{{}}
+		}
+
+		for _, n := range nodes {
+			record := []string{strconv.Itoa(f.ID), f.Type, f.Operand, f.StartTimestamp,
+				f.EndTimestamp, n.NodeID, n.RxTimestamp, n.TxTimestamp}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+var traceExportCmd = &cobra.Command{
+	Use:   "trace LABEL",
+	Short: "Export the frame timings of a trace to a file",
+	Long: `Export the timestamps of every SSNTP frame traced with LABEL, along with the
+times each node received and forwarded the frame, as JSON or CSV for offline
+benchmark analysis. CSV exports contain one record per frame and node.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := traceExportFormat(traceExportFlags.format, traceExportFlags.output)
+		if err != nil {
+			return err
+		}
+
+		frames, err := c.GetTraceFrames(args[0])
+		if err != nil {
+			return errors.Wrap(err, "Error getting trace frames")
+		}
+
+		f, _, err := openExportFile(traceExportFlags.output, false)
+		if err != nil {
+			return errors.Wrap(err, "Error opening export file")
+		}
+		if f != os.Stdout {
+			defer func() { _ = f.Close() }()
+		}
+
+		if format == "csv" {
+			err = writeTraceFramesCSV(f, frames)
+		} else {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "\t")
+			err = enc.Encode(frames)
+		}
+		if err != nil {
+			return errors.Wrap(err, "Error writing trace frames")
+		}
+
+		if f != os.Stdout {
+			fmt.Printf("Exported %d frames to %s\n", len(frames.Frames), traceExportFlags.output)
+		}
+
+		return nil
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export objects to a file",
+}
+
+func init() {
+	eventExportCmd.Flags().StringVarP(&eventExportFlags.output, "output", "o", "-", "File to export the events to, - for stdout")
+	eventExportCmd.Flags().StringVar(&eventExportFlags.format, "format", "jsonl", "Export format, jsonl or csv")
+	eventExportCmd.Flags().DurationVar(&eventExportFlags.since, "since", 0, "Only export events newer than this, e.g., 24h")
+	eventExportCmd.Flags().StringVar(&eventExportFlags.eventType, "type", "", "Only export events of this type, e.g., error")
+	eventExportCmd.Flags().BoolVar(&eventExportFlags.append, "append", false, "Append to the export file rather than replacing it")
+	exportCmd.AddCommand(eventExportCmd)
+
+	traceExportCmd.Flags().StringVarP(&traceExportFlags.output, "output", "o", "-", "File to export the frames to, - for stdout")
+	traceExportCmd.Flags().StringVar(&traceExportFlags.format, "format", "", "Export format, json or csv, guessed from the output file name by default")
+	exportCmd.AddCommand(traceExportCmd)
+
+	rootCmd.AddCommand(exportCmd)
+}
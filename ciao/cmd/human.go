@@ -0,0 +1,244 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/ciao-storage"
+)
+
+var human bool
+
+const (
+	kibibyte = 1024
+	mebibyte = 1024 * kibibyte
+	gibibyte = 1024 * mebibyte
+)
+
+// sizeFields lists the fields holding sizes of the types rendered by the
+// CLI, along with the unit of the size in bytes.
+var sizeFields = map[reflect.Type]map[string]float64{
+	reflect.TypeOf(types.Image{}): {
+		"Size":       1,
+		"UploadSize": 1,
+	},
+	reflect.TypeOf(storage.BlockDevice{}): {
+		"Size": gibibyte,
+	},
+	reflect.TypeOf(types.CiaoNode{}): {
+		"MemTotal":      mebibyte,
+		"MemAvailable":  mebibyte,
+		"DiskTotal":     mebibyte,
+		"DiskAvailable": mebibyte,
+	},
+	reflect.TypeOf(types.CiaoServerStats{}): {
+		"MemUsage":        mebibyte,
+		"DiskUsage":       mebibyte,
+		"NetRxBytes":      1,
+		"NetTxBytes":      1,
+		"BlockReadBytes":  1,
+		"BlockWriteBytes": 1,
+	},
+	reflect.TypeOf(types.CiaoUsage{}): {
+		"Memory": mebibyte,
+		"Disk":   mebibyte,
+	},
+	reflect.TypeOf(usageSummary{}): {
+		"MinMemory": mebibyte,
+		"AvgMemory": mebibyte,
+		"MaxMemory": mebibyte,
+		"MinDisk":   mebibyte,
+		"AvgDisk":   mebibyte,
+		"MaxDisk":   mebibyte,
+	},
+}
+
+// humanSize formats a size in bytes with the largest binary unit keeping it
+// above 1, e.g., 2.5 GiB.
+func humanSize(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// humanDuration formats a duration with its two most significant units,
+// e.g., 3h12m or 2d5h.
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// humanTime formats a time relative to now, e.g., 3h12m ago.
+func humanTime(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	if d := now.Sub(t); d >= 0 {
+		return humanDuration(d) + " ago"
+	}
+	return "in " + humanDuration(t.Sub(now))
+}
+
+type humanField struct {
+	index []int
+	size  float64
+	time  bool
+}
+
+// humanType returns the type structs of type t are converted to for human
+// readable output.  The fields of embedded structs are promoted, the sizes
+// and times are replaced by strings and the other fields are kept as is so
+// that the templates written for t still apply.  nil is returned if t has
+// no field to convert.
+func humanType(t reflect.Type) (reflect.Type, []humanField) {
+	var fields []reflect.StructField
+	var conv []humanField
+	seen := make(map[string]bool)
+	converted := false
+
+	var collect func(t reflect.Type, index []int)
+	collect = func(t reflect.Type, index []int) {
+		var embedded []reflect.StructField
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			f.Index = append(append([]int{}, index...), i)
+
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				embedded = append(embedded, f)
+				continue
+			}
+
+			if f.PkgPath != "" || seen[f.Name] {
+				continue
+			}
+			seen[f.Name] = true
+
+			hf := humanField{index: f.Index}
+			if f.Type == reflect.TypeOf(time.Time{}) {
+				hf.time = true
+			} else if size, ok := sizeFields[t][f.Name]; ok {
+				hf.size = size
+			}
+
+			if hf.time || hf.size > 0 {
+				f.Type = reflect.TypeOf("")
+				converted = true
+			}
+
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag})
+			conv = append(conv, hf)
+		}
+
+		// Fields of the outer struct shadow those of embedded ones
+		for _, f := range embedded {
+			collect(f.Type, f.Index)
+		}
+	}
+	collect(t, nil)
+
+	if !converted {
+		return nil, nil
+	}
+
+	return reflect.StructOf(fields), conv
+}
+
+func humanStruct(v reflect.Value, t reflect.Type, conv []humanField, now time.Time) reflect.Value {
+	h := reflect.New(t).Elem()
+
+	for i, hf := range conv {
+		f := v.FieldByIndex(hf.index)
+
+		switch {
+		case hf.time:
+			h.Field(i).SetString(humanTime(f.Interface().(time.Time), now))
+		case hf.size > 0:
+			var n float64
+			switch f.Kind() {
+			case reflect.Int, reflect.Int32, reflect.Int64:
+				n = float64(f.Int())
+			case reflect.Uint, reflect.Uint32, reflect.Uint64:
+				n = float64(f.Uint())
+			case reflect.Float32, reflect.Float64:
+				n = f.Float()
+			}
+			h.Field(i).SetString(humanSize(n * hf.size))
+		default:
+			h.Field(i).Set(f)
+		}
+	}
+
+	return h
+}
+
+// humanize converts the struct, or slice of structs, rendered by a command
+// so that its sizes and times are output in a human readable form.  Other
+// data is returned as is.
+func humanize(data interface{}) interface{} {
+	v := reflect.ValueOf(data)
+	now := time.Now()
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		t, conv := humanType(v.Type())
+		if t == nil {
+			return data
+		}
+		return humanStruct(v, t, conv, now).Interface()
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		t, conv := humanType(v.Type().Elem())
+		if t == nil {
+			return data
+		}
+		h := reflect.MakeSlice(reflect.SliceOf(t), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			h.Index(i).Set(humanStruct(v.Index(i), t, conv, now))
+		}
+		return h.Interface()
+	}
+
+	return data
+}
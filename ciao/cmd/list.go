@@ -15,8 +15,17 @@
 package cmd
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/ciao-project/ciao/ciao-controller/api"
 	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/payloads"
 	"github.com/intel/tfortools"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -49,9 +58,61 @@ var cnciListCmd = &cobra.Command{
 	},
 }
 
+var eventListFlags struct {
+	follow    bool
+	since     string
+	eventType string
+}
+
+// parseTimeFlag returns the time given by the value of the flag name which
+// is either an RFC 3339 timestamp or a duration before now, e.g., 1h30m.
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("Invalid value for --%s %q: expected a duration or an RFC 3339 time", name, value)
+	}
+
+	return t, nil
+}
+
+// eventFilter returns a function reporting whether an event was logged
+// after the --since time and is of the --type requested, if any.
+func eventFilter() (func(types.CiaoEvent) bool, error) {
+	var since time.Time
+	if eventListFlags.since != "" {
+		var err error
+		since, err = parseTimeFlag("since", eventListFlags.since)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(e types.CiaoEvent) bool {
+		if eventListFlags.eventType != "" && e.EventType != eventListFlags.eventType {
+			return false
+		}
+		return !e.Timestamp.Before(since)
+	}, nil
+}
+
+const eventFollowTemplate = `{{ range . -}}
+{{ .Timestamp.Local.Format "2006-01-02 15:04:05" }}	{{ .TenantID }}	{{ .EventType }}	{{ .Message }}
+{{ end }}`
+
 var eventListCmd = &cobra.Command{
-	Use:  "events [TENANT]",
-	Long: `List events for the provided tenant. If no tenant is specified and the user is privileged events for all tenants will be returned otherwise returns the current tenants events.`,
+	Use: "events [TENANT]",
+	Long: `List events for the provided tenant. If no tenant is specified and the user is privileged events for all tenants will be returned otherwise returns the current tenants events.
+
+With --follow new events are shown as they are logged, one per line, until
+the command is interrupted.
+
+Events can be restricted to those logged after --since, given either as a
+duration, e.g., 30m, or as an RFC 3339 time, and to those of a given --type,
+e.g., info or error.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		tenantID := ""
@@ -65,12 +126,67 @@ var eventListCmd = &cobra.Command{
 			}
 		}
 
+		match, err := eventFilter()
+		if err != nil {
+			return err
+		}
+
 		events, err := c.ListEvents(tenantID)
 		if err != nil {
 			return errors.Wrap(err, "Error listing events")
 		}
 
-		return render(cmd, events.Events)
+		// The stream resumes from the last event listed so that the
+		// events logged since the listing are not missed.  The events
+		// listed at that time are sent again and skipped.
+		var last time.Time
+		for _, e := range events.Events {
+			if e.Timestamp.After(last) {
+				last = e.Timestamp
+			}
+		}
+		listed := 0
+		for _, e := range events.Events {
+			if e.Timestamp.Equal(last) {
+				listed++
+			}
+		}
+
+		matched := events.Events[:0]
+		for _, e := range events.Events {
+			if match(e) {
+				matched = append(matched, e)
+			}
+		}
+		events.Events = matched
+
+		if !eventListFlags.follow {
+			return render(cmd, events.Events)
+		}
+
+		if template == "" && !jsonOutput() {
+			template = eventFollowTemplate
+		}
+
+		if err := render(cmd, events.Events); err != nil {
+			return err
+		}
+
+		// In JSON each event is output as a separate object, as jq expects
+		err = c.FollowEvents(tenantID, last, func(event types.CiaoEvent) error {
+			if listed > 0 && event.Timestamp.Equal(last) {
+				listed--
+				return nil
+			}
+			if !match(event) {
+				return nil
+			}
+			if jsonOutput() {
+				return render(cmd, event)
+			}
+			return render(cmd, []types.CiaoEvent{event})
+		})
+		return errors.Wrap(err, "Error following events")
 	},
 	Annotations: map[string]string{
 		"default_template": "{{ table .}}",
@@ -96,11 +212,60 @@ var externalipListCmd = &cobra.Command{
 	},
 }
 
+var reservedIPListCmd = &cobra.Command{
+	Use:  "reserved-ips",
+	Long: `List the reserved addresses of the tenant network.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		reserved, err := c.ListReservedIPs()
+		if err != nil {
+			return errors.Wrap(err, "Error listing reserved IPs")
+		}
+
+		return render(cmd, reserved)
+	},
+	Annotations: map[string]string{
+		"default_template": `{{ table (cols . "Address" "Description" "CreateTime")}}`,
+		"template_usage":   tfortools.GenerateUsageUndecorated([]types.ReservedIP{}),
+	},
+}
+
+var subnetListCmd = &cobra.Command{
+	Use:  "subnets",
+	Long: `List the subnets created by the tenant.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subnets, err := c.ListSubnets()
+		if err != nil {
+			return errors.Wrap(err, "Error listing subnets")
+		}
+
+		return render(cmd, subnets)
+	},
+	Annotations: map[string]string{
+		"default_template": `{{ table (cols . "ID" "Name" "CIDR")}}`,
+		"template_usage":   tfortools.GenerateUsageUndecorated([]types.TenantSubnet{}),
+	},
+}
+
+var imageListFlags struct {
+	allTenants bool
+}
+
 var imageListCmd = &cobra.Command{
 	Use:  "images",
-	Long: `List images.`,
+	Long: `List images. Admins can list the images of all the tenants with --all-tenants.`,
 	Args: cobra.ExactArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if imageListFlags.allTenants {
+			usage, err := c.ListAllImages()
+			if err != nil {
+				return errors.Wrap(err, "Error getting list of images")
+			}
+
+			return render(cmd, usage.Images)
+		}
+
 		images, err := c.ListImages()
 		if err != nil {
 			return errors.Wrap(err, "Error getting list of images")
@@ -114,22 +279,242 @@ var imageListCmd = &cobra.Command{
 	},
 }
 
+var instanceListFlags struct {
+	workload   string
+	status     string
+	filters    []string
+	allTenants bool
+	parallel   int
+	watch      watchFlags
+}
+
+// instanceStatuses maps the statuses accepted by list instances --status to
+// those reported by the controller.
+var instanceStatuses = map[string]string{
+	"running": payloads.ComputeStatusRunning,
+	"stopped": payloads.ComputeStatusStopped,
+}
+
+// instanceField returns the value of the string or integer field of an
+// instance whose JSON name is key, and false if there is no such field.
+func instanceField(s api.ServerDetails, key string) (string, bool) {
+	v := reflect.ValueOf(s)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != key {
+			continue
+		}
+
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			return f.String(), true
+		case reflect.Int:
+			return strconv.FormatInt(f.Int(), 10), true
+		}
+		return "", false
+	}
+
+	return "", false
+}
+
+// forEachTenant calls fn for every tenant, making at most parallel
+// concurrent calls.  The error of the first tenant, in the order of
+// tenants, for which fn failed is returned.
+func forEachTenant(tenants []types.TenantSummary, parallel int, fn func(i int, tenantID string) error) error {
+	if parallel < 1 {
+		return fmt.Errorf("Invalid parallelism %d", parallel)
+	}
+
+	errs := make([]error, len(tenants))
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < len(tenants); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = fn(i, tenants[i].ID)
+			}
+		}()
+	}
+
+	for i := range tenants {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listAllTenantsInstances lists the instances of workloadID, or all the
+// instances if empty, of every tenant.  The tenants are queried using at
+// most parallel concurrent requests and the instances are returned grouped
+// by tenant.
+func listAllTenantsInstances(workloadID string, parallel int) ([]api.ServerDetails, error) {
+	tenants, err := c.ListTenants()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing tenants")
+	}
+
+	servers := make([]api.Servers, len(tenants.Tenants))
+	err = forEachTenant(tenants.Tenants, parallel, func(i int, tenantID string) error {
+		var err error
+		servers[i], err = c.ListInstancesByWorkload(tenantID, workloadID)
+		return errors.Wrapf(err, "Error listing instances of tenant %s", tenantID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var all []api.ServerDetails
+	for i, t := range tenants.Tenants {
+		for _, s := range servers[i].Servers {
+			if s.TenantID == "" {
+				s.TenantID = t.ID
+			}
+			all = append(all, s)
+		}
+	}
+
+	return all, nil
+}
+
+// listAllTenantsWorkloads lists the workloads of every tenant along with
+// the public workloads.  The tenants are queried using at most parallel
+// concurrent requests.
+func listAllTenantsWorkloads(parallel int) ([]types.Workload, error) {
+	tenants, err := c.ListTenants()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing tenants")
+	}
+
+	workloads := make([][]types.Workload, len(tenants.Tenants))
+	err = forEachTenant(tenants.Tenants, parallel, func(i int, tenantID string) error {
+		var err error
+		workloads[i], err = c.ListTenantWorkloads(tenantID)
+		return errors.Wrapf(err, "Error listing workloads of tenant %s", tenantID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Public workloads are listed for every tenant.
+	var all []types.Workload
+	seen := make(map[string]bool)
+	for i := range tenants.Tenants {
+		for _, wl := range workloads[i] {
+			if !seen[wl.ID] {
+				seen[wl.ID] = true
+				all = append(all, wl)
+			}
+		}
+	}
+
+	return all, nil
+}
+
+// instanceFilter returns a function reporting whether an instance has the
+// --status requested, if any, and matches all the --filter flags.
+func instanceFilter() (func(api.ServerDetails) bool, error) {
+	filters := make(map[string]string)
+	for _, f := range instanceListFlags.filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid filter %q, expected KEY=VALUE", f)
+		}
+
+		if _, ok := instanceField(api.ServerDetails{}, kv[0]); !ok {
+			return nil, fmt.Errorf("Unknown filter key %q", kv[0])
+		}
+		filters[kv[0]] = kv[1]
+	}
+
+	status := strings.ToLower(instanceListFlags.status)
+	if s, ok := instanceStatuses[status]; ok {
+		status = s
+	}
+
+	return func(s api.ServerDetails) bool {
+		if status != "" && s.Status != status {
+			return false
+		}
+
+		for k, v := range filters {
+			if f, _ := instanceField(s, k); f != v {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
 var instanceListCmd = &cobra.Command{
-	Use:  "instances [WORKLOAD]",
-	Long: `List instances. If the optional workload ID is provided then only show instances matching that ID.`,
+	Use: "instances [WORKLOAD]",
+	Long: `List instances. If the optional workload ID is provided then only show instances matching that ID.
+
+Instances can be restricted to those of a --workload, to those with a given
+--status, e.g., running, pending or stopped, and to those whose fields match
+each --filter KEY=VALUE, where KEY is the JSON name of a field, e.g.,
+node_id or name.
+
+Privileged users can list the instances of every tenant with --all-tenants.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		workloadID := ""
+		if instanceListFlags.allTenants {
+			if !c.IsPrivileged() {
+				return errors.New("Listing the instances of all tenants is for privileged users only")
+			}
+			cmd.Annotations["default_template"] = `{{ table (cols . "TenantID" "Name" "ID" "SSHIP" "SSHPort" "Status") }}`
+		}
+
+		workloadID := instanceListFlags.workload
 		if len(args) == 1 {
+			if workloadID != "" && workloadID != args[0] {
+				return errors.New("Conflicting workloads given as argument and with --workload")
+			}
 			workloadID = args[0]
 		}
 
-		servers, err := c.ListInstancesByWorkload(c.TenantID, workloadID)
+		match, err := instanceFilter()
 		if err != nil {
-			return errors.Wrap(err, "Error listing instances")
+			return err
 		}
 
-		return render(cmd, servers.Servers)
+		return watch(instanceListFlags.watch, func() error {
+			var servers []api.ServerDetails
+			if instanceListFlags.allTenants {
+				all, err := listAllTenantsInstances(workloadID, instanceListFlags.parallel)
+				if err != nil {
+					return err
+				}
+				servers = all
+			} else {
+				s, err := c.ListInstancesByWorkload(c.TenantID, workloadID)
+				if err != nil {
+					return errors.Wrap(err, "Error listing instances")
+				}
+				servers = s.Servers
+			}
+
+			filtered := make([]api.ServerDetails, 0, len(servers))
+			for _, s := range servers {
+				if match(s) {
+					filtered = append(filtered, s)
+				}
+			}
+
+			return render(cmd, filtered)
+		})
 	},
 	Annotations: map[string]string{
 		"default_template": `{{ table (cols . "Name" "ID" "SSHIP" "SSHPort" "Status") }}`,
@@ -140,8 +525,70 @@ var instanceListCmd = &cobra.Command{
 var nodeListFlags = struct {
 	computeNodesOnly bool
 	networkNodesOnly bool
+	sortKey          string
+	reverse          bool
+	columns          string
+	json             bool
+	watch            watchFlags
 }{}
 
+// nodeSortKeys maps the keys accepted by list nodes --sort to functions
+// comparing two nodes.  Keys describing free resources sort the nodes
+// with the most resources available first.
+var nodeSortKeys = map[string]func(a, b *types.CiaoNode) bool{
+	"id":          func(a, b *types.CiaoNode) bool { return a.ID < b.ID },
+	"hostname":    func(a, b *types.CiaoNode) bool { return a.Hostname < b.Hostname },
+	"status":      func(a, b *types.CiaoNode) bool { return a.Status < b.Status },
+	"load":        func(a, b *types.CiaoNode) bool { return a.Load < b.Load },
+	"free-memory": func(a, b *types.CiaoNode) bool { return a.MemAvailable > b.MemAvailable },
+	"free-disk":   func(a, b *types.CiaoNode) bool { return a.DiskAvailable > b.DiskAvailable },
+	"instances":   func(a, b *types.CiaoNode) bool { return a.TotalInstances < b.TotalInstances },
+	"failures":    func(a, b *types.CiaoNode) bool { return a.TotalFailures < b.TotalFailures },
+}
+
+func nodeSortKeyNames() []string {
+	var keys []string
+	for k := range nodeSortKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortNodes(nodes []types.CiaoNode, key string, reverse bool) error {
+	less, ok := nodeSortKeys[key]
+	if !ok {
+		return fmt.Errorf("Invalid sort key %q, valid keys are: %s", key,
+			strings.Join(nodeSortKeyNames(), ", "))
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if reverse {
+			return less(&nodes[j], &nodes[i])
+		}
+		return less(&nodes[i], &nodes[j])
+	})
+
+	return nil
+}
+
+// nodeColumnsTemplate builds a table template showing the given comma
+// separated list of CiaoNode fields
+func nodeColumnsTemplate(columns string) (string, error) {
+	nodeType := reflect.TypeOf(types.CiaoNode{})
+
+	var cols []string
+	for _, col := range strings.Split(columns, ",") {
+		col = strings.TrimSpace(col)
+		if _, ok := nodeType.FieldByName(col); !ok {
+			return "", fmt.Errorf("Invalid column %q", col)
+		}
+		cols = append(cols, strconv.Quote(col))
+	}
+
+	return fmt.Sprintf("{{ table (cols . %s) }}", strings.Join(cols, " ")), nil
+}
+
 var nodeListCmd = &cobra.Command{
 	Use:  "nodes",
 	Long: `Lists nodes. Node type can be limited by flags.`,
@@ -151,21 +598,56 @@ var nodeListCmd = &cobra.Command{
 			return errors.New("Listing nodes is limited to privileged users")
 		}
 
-		var n types.CiaoNodes
-		var err error
-		if nodeListFlags.computeNodesOnly {
-			n, err = c.ListComputeNodes()
-		} else if nodeListFlags.networkNodesOnly {
-			n, err = c.ListComputeNodes()
-		} else {
-			n, err = c.ListNodes()
+		// --json predates --format and is kept as an alias of --format json
+		if nodeListFlags.json {
+			if format != "" && format != "json" {
+				return fmt.Errorf("--json cannot be combined with --format %s", format)
+			}
+			if template != "" && template != "json" {
+				return errors.New("--json cannot be combined with --template")
+			}
+			format = "json"
 		}
 
-		if err != nil {
-			return errors.Wrap(err, "Error getting nodes")
+		if nodeListFlags.columns != "" {
+			if template != "" {
+				return errors.New("--columns cannot be combined with --template")
+			}
+			if format != "" && format != "text" {
+				return fmt.Errorf("--columns cannot be combined with --format %s", format)
+			}
+
+			var err error
+			template, err = nodeColumnsTemplate(nodeListFlags.columns)
+			if err != nil {
+				return err
+			}
 		}
 
-		return render(cmd, n.Nodes)
+		return watch(nodeListFlags.watch, func() error {
+			var n types.CiaoNodes
+			var err error
+			if nodeListFlags.computeNodesOnly {
+				n, err = c.ListComputeNodes()
+			} else if nodeListFlags.networkNodesOnly {
+				n, err = c.ListNetworkNodes()
+			} else {
+				n, err = c.ListNodes()
+			}
+
+			if err != nil {
+				return errors.Wrap(err, "Error getting nodes")
+			}
+
+			if nodeListFlags.sortKey != "" {
+				err = sortNodes(n.Nodes, nodeListFlags.sortKey, nodeListFlags.reverse)
+				if err != nil {
+					return err
+				}
+			}
+
+			return render(cmd, n.Nodes)
+		})
 	},
 	Annotations: map[string]string{
 		"default_template": `{{ table (cols . "ID" "Hostname" "Status")}}`,
@@ -217,6 +699,142 @@ var quotasListCmd = &cobra.Command{
 	},
 }
 
+var usageListFlags struct {
+	start       string
+	end         string
+	granularity time.Duration
+}
+
+// usageSummary aggregates the usage samples taken during a period of
+// --granularity.
+type usageSummary struct {
+	Start     time.Time
+	Samples   int
+	MinVCPU   int
+	AvgVCPU   float64
+	MaxVCPU   int
+	MinMemory int
+	AvgMemory float64
+	MaxMemory int
+	MinDisk   int
+	AvgDisk   float64
+	MaxDisk   int
+}
+
+func (s *usageSummary) add(u types.CiaoUsage) {
+	if s.Samples == 0 {
+		s.MinVCPU, s.MaxVCPU = u.VCPU, u.VCPU
+		s.MinMemory, s.MaxMemory = u.Memory, u.Memory
+		s.MinDisk, s.MaxDisk = u.Disk, u.Disk
+	}
+
+	minMax := func(v int, min, max *int) {
+		if v < *min {
+			*min = v
+		}
+		if v > *max {
+			*max = v
+		}
+	}
+	minMax(u.VCPU, &s.MinVCPU, &s.MaxVCPU)
+	minMax(u.Memory, &s.MinMemory, &s.MaxMemory)
+	minMax(u.Disk, &s.MinDisk, &s.MaxDisk)
+
+	// Running averages avoid keeping the samples around
+	s.Samples++
+	n := float64(s.Samples)
+	s.AvgVCPU += (float64(u.VCPU) - s.AvgVCPU) / n
+	s.AvgMemory += (float64(u.Memory) - s.AvgMemory) / n
+	s.AvgDisk += (float64(u.Disk) - s.AvgDisk) / n
+}
+
+// summarizeUsage aggregates usages into periods of granularity starting
+// at start.  Periods without samples are omitted.
+func summarizeUsage(usages []types.CiaoUsage, start time.Time, granularity time.Duration) []usageSummary {
+	var summaries []usageSummary
+	periods := make(map[int64]int)
+
+	for _, u := range usages {
+		period := int64(u.Timestamp.Sub(start) / granularity)
+		i, ok := periods[period]
+		if !ok {
+			i = len(summaries)
+			periods[period] = i
+			summaries = append(summaries, usageSummary{
+				Start: start.Add(time.Duration(period) * granularity),
+			})
+		}
+		summaries[i].add(u)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Start.Before(summaries[j].Start)
+	})
+
+	return summaries
+}
+
+var usageListCmd = &cobra.Command{
+	Use: "usage",
+	Long: `List the resource usage of the current tenant.
+
+By default the samples of the last 15 minutes are listed.  --start and --end,
+given either as durations before now, e.g., 24h, or as RFC 3339 times, select
+another period.  With --granularity the samples are aggregated into the
+minimum, average and maximum usage of each period of that duration.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var start time.Time
+		end := time.Now()
+
+		var err error
+		if usageListFlags.end != "" {
+			end, err = parseTimeFlag("end", usageListFlags.end)
+			if err != nil {
+				return err
+			}
+		}
+
+		if usageListFlags.start != "" {
+			start, err = parseTimeFlag("start", usageListFlags.start)
+			if err != nil {
+				return err
+			}
+		} else {
+			start = end.Add(-15 * time.Minute)
+		}
+
+		if !start.Before(end) {
+			return errors.New("--start must be before --end")
+		}
+
+		if usageListFlags.granularity < 0 {
+			return fmt.Errorf("Invalid granularity %v", usageListFlags.granularity)
+		}
+
+		usage, err := c.ListTenantUsage(start, end)
+		if err != nil {
+			return errors.Wrap(err, "Error getting usage")
+		}
+
+		if usageListFlags.granularity == 0 {
+			return render(cmd, usage.Usages)
+		}
+
+		if template == "" && !jsonOutput() && format != "csv" {
+			cmd.Annotations["default_template"] = usageSummaryTemplate
+		}
+
+		return render(cmd, summarizeUsage(usage.Usages, start, usageListFlags.granularity))
+	},
+	Annotations: map[string]string{
+		"default_template": "{{ table .}}",
+		"template_usage":   tfortools.GenerateUsageUndecorated([]types.CiaoUsage{}),
+	},
+}
+
+const usageSummaryTemplate = `{{ table (cols . "Start" "Samples" "MinVCPU" "AvgVCPU" "MaxVCPU" "MinMemory" "AvgMemory" "MaxMemory" "MinDisk" "AvgDisk" "MaxDisk") }}`
+
 var tenantListCmd = &cobra.Command{
 	Use:  "tenants",
 	Long: `List tenants available to the user or if privileged those on the cluster.`,
@@ -266,12 +884,33 @@ var traceListCmd = &cobra.Command{
 var volumeListTemplate = `{{ range . }}` + volumeShowTemplate + `
 {{ end }}`
 
+var volumeListFlags struct {
+	status   string
+	bootable string
+	minSize  int
+	maxSize  int
+}
+
 var volumeListCmd = &cobra.Command{
 	Use:  "volumes",
-	Long: `List volumes.`,
+	Long: `List volumes, optionally filtered by status, bootable flag and size in GiB.`,
 	Args: cobra.ExactArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		volumes, err := c.ListVolumes()
+		filter := types.VolumeFilter{
+			State:   types.BlockState(volumeListFlags.status),
+			MinSize: volumeListFlags.minSize,
+			MaxSize: volumeListFlags.maxSize,
+		}
+
+		if volumeListFlags.bootable != "" {
+			bootable, err := strconv.ParseBool(volumeListFlags.bootable)
+			if err != nil {
+				return errors.Wrap(err, "Invalid value for --bootable")
+			}
+			filter.Bootable = &bootable
+		}
+
+		volumes, err := c.ListVolumesByFilter(filter)
 		if err != nil {
 			return errors.Wrap(err, "Error listing volumes")
 		}
@@ -328,8 +967,11 @@ var listCmds = []*cobra.Command{
 	nodeListCmd,
 	poolListCmd,
 	quotasListCmd,
+	reservedIPListCmd,
+	subnetListCmd,
 	tenantListCmd,
 	traceListCmd,
+	usageListCmd,
 	volumeListCmd,
 	workloadListCmd,
 }
@@ -340,8 +982,33 @@ func init() {
 		listCmd.AddCommand(cmd)
 	}
 
+	eventListCmd.Flags().BoolVar(&eventListFlags.follow, "follow", false, "Show new events as they are logged")
+	eventListCmd.Flags().StringVar(&eventListFlags.since, "since", "", "Only show events logged after this time or duration, e.g., 2017-10-01T12:00:00Z or 1h")
+	eventListCmd.Flags().StringVar(&eventListFlags.eventType, "type", "", "Only show events of this type, e.g., info or error")
+	usageListCmd.Flags().StringVar(&usageListFlags.start, "start", "", "Start of the period to list, as a duration before now or an RFC 3339 time (default 15m before --end)")
+	usageListCmd.Flags().StringVar(&usageListFlags.end, "end", "", "End of the period to list, as a duration before now or an RFC 3339 time (default now)")
+	usageListCmd.Flags().DurationVar(&usageListFlags.granularity, "granularity", 0, "Aggregate the samples over periods of this duration, e.g., 1h")
+	imageListCmd.Flags().BoolVar(&imageListFlags.allTenants, "all-tenants", false, "List the images of all tenants (admin only)")
+
+	volumeListCmd.Flags().StringVar(&volumeListFlags.status, "status", "", "Only show volumes in this state, e.g., available or in-use")
+	volumeListCmd.Flags().StringVar(&volumeListFlags.bootable, "bootable", "", "Only show bootable (true) or non-bootable (false) volumes")
+	volumeListCmd.Flags().IntVar(&volumeListFlags.minSize, "min-size", 0, "Only show volumes of at least this size in GiB")
+	volumeListCmd.Flags().IntVar(&volumeListFlags.maxSize, "max-size", 0, "Only show volumes of at most this size in GiB")
+
 	nodeListCmd.Flags().BoolVar(&nodeListFlags.computeNodesOnly, "compute-nodes", false, "Only show compute nodes")
 	nodeListCmd.Flags().BoolVar(&nodeListFlags.networkNodesOnly, "network-nodes", false, "Only show network nodes")
+	nodeListCmd.Flags().StringVar(&nodeListFlags.sortKey, "sort", "", "Sort nodes by one of: "+strings.Join(nodeSortKeyNames(), ", "))
+	nodeListCmd.Flags().BoolVar(&nodeListFlags.reverse, "reverse", false, "Reverse the sort order")
+	nodeListCmd.Flags().StringVar(&nodeListFlags.columns, "columns", "", "Comma separated list of node fields to show, e.g., ID,Hostname,Load,MemAvailable")
+	nodeListCmd.Flags().BoolVar(&nodeListFlags.json, "json", false, "Output nodes as JSON, same as --format json")
+	_ = nodeListCmd.Flags().MarkDeprecated("json", "use --format json instead")
+	addWatchFlags(nodeListCmd, &nodeListFlags.watch)
+	instanceListCmd.Flags().StringVar(&instanceListFlags.workload, "workload", "", "Only list the instances of this workload")
+	instanceListCmd.Flags().StringVar(&instanceListFlags.status, "status", "", "Only list the instances with this status, e.g., running")
+	instanceListCmd.Flags().StringSliceVar(&instanceListFlags.filters, "filter", nil, "Only list the instances matching KEY=VALUE, may be repeated")
+	instanceListCmd.Flags().BoolVar(&instanceListFlags.allTenants, "all-tenants", false, "List the instances of all tenants (admin only)")
+	instanceListCmd.Flags().IntVar(&instanceListFlags.parallel, "parallel", 8, "Number of tenants listed concurrently with --all-tenants")
+	addWatchFlags(instanceListCmd, &instanceListFlags.watch)
 
 	rootCmd.AddCommand(listCmd)
 }
@@ -0,0 +1,90 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var metricsPushURL string
+
+// metricsPushTimeout bounds the time the CLI waits for the pushgateway so
+// that automation is not held up when it is down.
+const metricsPushTimeout = 5 * time.Second
+
+// commandMetrics returns the metrics of a run of the CLI in the Prometheus
+// text format.  The pushgateway replaces the metrics of a group on every
+// push, so the outcome of the last run is pushed as gauges rather than
+// counters, from which Prometheus can count the successes and failures.
+func commandMetrics(duration time.Duration, code int, now time.Time) []byte {
+	success := 0
+	if code == 0 {
+		success = 1
+	}
+
+	var b bytes.Buffer
+	metric := func(name, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&b, "%s %v\n", name, value)
+	}
+
+	metric("ciao_cli_command_duration_seconds", "Time taken by the last run of the command.", duration.Seconds())
+	metric("ciao_cli_command_success", "Whether the last run of the command succeeded.", success)
+	metric("ciao_cli_command_exit_code", "Exit status of the last run of the command.", code)
+	metric("ciao_cli_command_last_run_timestamp_seconds", "Time at which the command last ran.", now.Unix())
+
+	return b.Bytes()
+}
+
+// pushMetrics sends the metrics of a run of cmd to the pushgateway of
+// --metrics-push-url, grouped by job ciao and command, e.g., list instances.
+func pushMetrics(cmd *cobra.Command, duration time.Duration, code int) error {
+	command := strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name())
+	command = strings.TrimSpace(command)
+	if command == "" {
+		command = rootCmd.Name()
+	}
+
+	u := fmt.Sprintf("%s/metrics/job/ciao/command/%s", strings.TrimSuffix(metricsPushURL, "/"),
+		url.PathEscape(command))
+
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(commandMetrics(duration, code, time.Now())))
+	if err != nil {
+		return errors.Wrap(err, "Invalid metrics push URL")
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: metricsPushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Unable to push metrics")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Unable to push metrics: %s", resp.Status)
+	}
+
+	return nil
+}
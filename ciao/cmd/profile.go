@@ -0,0 +1,109 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const ciaoProfileEnv = "CIAO_PROFILE"
+
+// profile describes how to access a cluster.  Its settings are used when
+// they are not given by flags or environment variables.
+type profile struct {
+	Controller     string `yaml:"controller"`
+	TenantID       string `yaml:"tenant_id"`
+	CACertFile     string `yaml:"ca_cert_file"`
+	ClientCertFile string `yaml:"client_cert_file"`
+	ClientKeyFile  string `yaml:"client_key_file"`
+}
+
+// profileConfig is the content of the CLI configuration file.  Default
+// names the profile used when none is selected with --profile.
+type profileConfig struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+var profileName string
+
+func profileConfigFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".ciao", "config.yaml")
+}
+
+// loadProfile returns the profile selected by name, or the default profile
+// if name is empty.  No profile is returned if the configuration file does
+// not exist and no profile was requested.
+func loadProfile(name string) (*profile, error) {
+	path := profileConfigFile()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && name == "" {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Error reading configuration file")
+	}
+
+	var config profileConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing %s", path)
+	}
+
+	if name == "" {
+		name = config.Default
+		if name == "" {
+			return nil, nil
+		}
+	}
+
+	p, ok := config.Profiles[name]
+	if !ok {
+		return nil, errors.Errorf("Profile %s not found in %s", name, path)
+	}
+
+	return &p, nil
+}
+
+// applyProfile sets the settings of the client that were not given by
+// flags or environment variables from the selected profile.
+func applyProfile() error {
+	p, err := loadProfile(profileName)
+	if err != nil || p == nil {
+		return err
+	}
+
+	settings := []struct {
+		value   *string
+		profile string
+	}{
+		{&c.ControllerURL, p.Controller},
+		{&c.TenantID, p.TenantID},
+		{&c.CACertFile, p.CACertFile},
+		{&c.ClientCertFile, p.ClientCertFile},
+		{&c.ClientKeyFile, p.ClientKeyFile},
+	}
+
+	for _, s := range settings {
+		if *s.value == "" {
+			*s.value = s.profile
+		}
+	}
+
+	return nil
+}
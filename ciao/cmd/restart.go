@@ -15,16 +15,36 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/ciao-project/ciao/payloads"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var restartInstanceFlags struct {
+	wait     waitFlags
+	parallel int
+	force    bool
+}
+
 var restartInstanceCmd = &cobra.Command{
-	Use:   "instance ID",
-	Short: "Restart an instance",
-	Args:  cobra.ExactArgs(1),
+	Use:   "instance ID...",
+	Short: "Restart one or more instances",
+	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.Wrap(c.StartInstance(args[0]), "Error starting instance")
+		if len(args) > 1 {
+			if err := confirm(restartInstanceFlags.force, fmt.Sprintf("This will restart %d instances.", len(args))); err != nil {
+				return err
+			}
+		}
+
+		return runBulk(restartInstanceFlags.parallel, "restart", args, func(id string) error {
+			if err := c.StartInstance(id); err != nil {
+				return errors.Wrap(err, "Error starting instance")
+			}
+			return waitForInstance(restartInstanceFlags.wait, id, payloads.ComputeStatusRunning)
+		})
 	},
 }
 
@@ -35,5 +55,8 @@ var restartCmd = &cobra.Command{
 
 func init() {
 	restartCmd.AddCommand(restartInstanceCmd)
+	addWaitFlags(restartInstanceCmd, &restartInstanceFlags.wait)
+	addParallelFlag(restartInstanceCmd, &restartInstanceFlags.parallel)
+	addForceFlag(restartInstanceCmd, &restartInstanceFlags.force)
 	rootCmd.AddCommand(restartCmd)
 }
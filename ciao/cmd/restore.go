@@ -19,6 +19,7 @@ import (
 	"os"
 
 	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
 
 	"github.com/spf13/cobra"
 )
@@ -32,9 +33,20 @@ func restoreNode(args []string) int {
 	return 0
 }
 
+var restoreInstanceCmd = &cobra.Command{
+	Use:   "instance ID",
+	Short: "Restore a deleted instance",
+	Long: `Restore an instance deleted within the deferred delete window of the
+controller.  The instance remains stopped until it is restarted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.Wrap(c.RestoreInstance(args[0]), "Error restoring instance")
+	},
+}
+
 var restoreCmd = &cobra.Command{
 	Use:   "restore [NODE]",
-	Short: "Restore a node",
+	Short: "Restore a node or a deleted instance",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		os.Exit(restoreNode(args))
@@ -42,5 +54,6 @@ var restoreCmd = &cobra.Command{
 }
 
 func init() {
+	restoreCmd.AddCommand(restoreInstanceCmd)
 	rootCmd.AddCommand(restoreCmd)
 }
@@ -17,6 +17,8 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"time"
 
 	"github.com/ciao-project/ciao/client"
 	"github.com/intel/tfortools"
@@ -28,18 +30,97 @@ import (
 var c client.Client
 
 var template string
+var format string
+var maxItems int
+var skipVersionCheck bool
+var auditLog string
+var mockDir, recordDir string
 var rootUsageFunc (func(cmd *cobra.Command) error)
 
+// jsonTemplate outputs the data returned by the controller as JSON
+const jsonTemplate = "{{ tojson . }}\n"
+
+// jsonOutput returns true if the output of commands is requested in JSON,
+// either with --format json or -f json
+func jsonOutput() bool {
+	return format == "json" || template == "json"
+}
+
+func checkFormat(cmd *cobra.Command, args []string) error {
+	switch format {
+	case "", "text":
+	case "json":
+		if template != "" && template != "json" {
+			return errors.New("--format json cannot be combined with --template")
+		}
+	case "template":
+		if template == "" {
+			return errors.New("--format template requires --template")
+		}
+	case "csv":
+		if template != "" {
+			return errors.New("--format csv cannot be combined with --template")
+		}
+		if _, ok := csvRecords[cmd]; !ok {
+			return fmt.Errorf("--format csv is not supported by %s", cmd.CommandPath())
+		}
+	default:
+		return fmt.Errorf("Invalid format %q, valid formats are: text, json, template, csv", format)
+	}
+
+	return nil
+}
+
+// itemTemplate applies the template given with --format template to each
+// item of the listed data, one item per line, rather than to the list as a
+// whole as --template alone does.
+func itemTemplate(data interface{}) string {
+	if kind := reflect.ValueOf(data).Kind(); kind == reflect.Slice || kind == reflect.Array {
+		return "{{ range . }}" + template + "\n{{ end }}"
+	}
+
+	return template + "\n"
+}
+
+// truncateList keeps the first --max-items items of listed data.
+func truncateList(data interface{}) interface{} {
+	v := reflect.ValueOf(data)
+	if maxItems <= 0 || v.Kind() != reflect.Slice || v.Len() <= maxItems {
+		return data
+	}
+
+	return v.Slice(0, maxItems).Interface()
+}
+
 func render(cmd *cobra.Command, data interface{}) error {
-	if template == "" && cmd.Annotations != nil {
-		template = cmd.Annotations["default_template"]
+	data = truncateList(data)
+
+	// The template flag is left as is so that commands rendering several
+	// times, e.g., when following events, still see -f json.
+	tmpl := template
+	if jsonOutput() {
+		tmpl = jsonTemplate
+	} else if format == "csv" {
+		return errors.Wrap(writeCSV(os.Stdout, cmd, data), "Error generating CSV output")
+	} else if format == "template" {
+		return errors.Wrap(tfortools.OutputToTemplate(os.Stdout, "", itemTemplate(data), data, nil),
+			"Error generating template output")
+	}
+
+	// Only the default templates are known to apply to human readable data
+	if tmpl == "" && human {
+		data = humanize(data)
+	}
+
+	if tmpl == "" && cmd.Annotations != nil {
+		tmpl = cmd.Annotations["default_template"]
 	}
 
-	if template == "" {
-		template = "{{ htable (sliceof .) }}"
+	if tmpl == "" {
+		tmpl = "{{ htable (sliceof .) }}"
 	}
 
-	return errors.Wrap(tfortools.OutputToTemplate(os.Stdout, "", template, data, nil),
+	return errors.Wrap(tfortools.OutputToTemplate(os.Stdout, "", tmpl, data, nil),
 		"Error generating template output")
 }
 
@@ -67,42 +148,160 @@ const (
 	ciaoControllerEnv     = "CIAO_CONTROLLER"
 	ciaoCACertFileEnv     = "CIAO_CA_CERT_FILE"
 	ciaoClientCertFileEnv = "CIAO_CLIENT_CERT_FILE"
+	ciaoClientKeyFileEnv  = "CIAO_CLIENT_KEY_FILE"
 	ciaoTenantIDEnv       = "CIAO_TENANT_ID"
+	ciaoAuditLogEnv       = "CIAO_AUDIT_LOG"
+	ciaoMetricsPushURLEnv = "CIAO_METRICS_PUSH_URL"
 )
 
 func getCiaoEnvVariables() {
 	c.ControllerURL = os.Getenv(ciaoControllerEnv)
 	c.CACertFile = os.Getenv(ciaoCACertFileEnv)
 	c.ClientCertFile = os.Getenv(ciaoClientCertFileEnv)
+	c.ClientKeyFile = os.Getenv(ciaoClientKeyFileEnv)
 	c.TenantID = os.Getenv(ciaoTenantIDEnv)
 }
 
+// initClient initialises the client once the flags, which override the
+// environment variables, have been parsed.  The settings given by neither
+// are read from the selected profile.
+func initClient(cmd *cobra.Command, args []string) error {
+	if err := checkFormat(cmd, args); err != nil {
+		return err
+	}
+
+	if err := applyProfile(); err != nil {
+		return err
+	}
+
+	switch {
+	case mockDir != "" && recordDir != "":
+		return errors.New("Fixtures cannot be replayed and recorded at the same time")
+	case mockDir != "":
+		c.FixturesDir = mockDir
+	case recordDir != "":
+		c.FixturesDir = recordDir
+		c.RecordFixtures = true
+	}
+
+	if err := c.Init(); err != nil {
+		return errors.Wrap(err, "Failed to init the CLI")
+	}
+
+	if auditLog != "" {
+		f, err := os.OpenFile(auditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return errors.Wrap(err, "Unable to open audit log")
+		}
+		c.AuditLog = f
+	}
+
+	if !skipVersionCheck {
+		checkAPIVersion()
+	}
+
+	return nil
+}
+
+// checkAPIVersion negotiates the version of the ciao API used with the
+// controller and warns if there is none the CLI supports.  Failures to reach
+// the controller are left for the command to report, without delaying it
+// with retries.
+func checkAPIVersion() {
+	retries := c.Retries
+	c.Retries = 0
+	version, err := c.GetAPIVersion()
+	c.Retries = retries
+	if err != nil {
+		return
+	}
+
+	if err := c.SetAPIVersion(version); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
 var rootCmd = &cobra.Command{
 	Use: "ciao",
 	Long: `
 Command line interface for the Cloud Integrated Advanced Orchestrator (CIAO).
 
-The CIAO CLI sends HTTPS requests to the CIAO controller enabling one to control a CIAO cluster.`,
+The CIAO CLI sends HTTPS requests to the CIAO controller enabling one to control a CIAO cluster.
+
+The CLI exits with status 0 on success, 2 if the controller cannot be reached,
+3 if the user is not authorized, 4 if a resource is not found, 5 if a tenant
+would exceed its quotas, 6 if the controller fails and 1 on any other error.`,
+	PersistentPreRunE: initClient,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	start := time.Now()
+	cmd, err := rootCmd.ExecuteC()
+
+	code := 0
+	if err != nil {
+		code = exitCode(err)
+	}
+
+	if metricsPushURL != "" {
+		if err := pushMetrics(cmd, time.Since(start), code); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if code != 0 {
+		os.Exit(code)
 	}
 }
 
+// Exit statuses of the CLI, telling scripts why a command failed
+const (
+	exitFailure     = 1
+	exitUnreachable = 2
+	exitAuth        = 3
+	exitNotFound    = 4
+	exitQuota       = 5
+	exitServer      = 6
+)
+
+var exitCodes = map[client.ErrorCategory]int{
+	client.ErrUnreachable:  exitUnreachable,
+	client.ErrUnauthorized: exitAuth,
+	client.ErrNotFound:     exitNotFound,
+	client.ErrOverQuota:    exitQuota,
+	client.ErrServer:       exitServer,
+}
+
+func exitCode(err error) int {
+	if code, ok := exitCodes[client.GetErrorCategory(err)]; ok {
+		return code
+	}
+	return exitFailure
+}
+
 func init() {
 	getCiaoEnvVariables()
-	if err := c.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to init the CLI: %s\n", err)
-		os.Exit(1)
-	}
 
 	rootUsageFunc = rootCmd.UsageFunc()
 	rootCmd.SetUsageFunc(templatedUsageFunc)
 
-	rootCmd.PersistentFlags().StringVarP(&template, "template", "f", "", "Template used to format output")
+	rootCmd.PersistentFlags().StringVarP(&template, "template", "f", "", "Template used to format output, or json to output the data as JSON")
+	rootCmd.PersistentFlags().StringVar(&format, "format", "text", "Output format, one of: text, json, template, csv")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", os.Getenv(ciaoProfileEnv), "Profile of ~/.ciao/config.yaml used for the settings not given by flags or environment variables, overrides "+ciaoProfileEnv)
+	rootCmd.PersistentFlags().StringVar(&c.CACertFile, "ca-file", c.CACertFile, "CA certificate used to verify the controller, overrides "+ciaoCACertFileEnv)
+	rootCmd.PersistentFlags().StringVar(&c.ClientCertFile, "client-cert", c.ClientCertFile, "Client certificate, overrides "+ciaoClientCertFileEnv)
+	rootCmd.PersistentFlags().StringVar(&c.ClientKeyFile, "client-key", c.ClientKeyFile, "Key of the client certificate if not stored with it, overrides "+ciaoClientKeyFileEnv)
+	rootCmd.PersistentFlags().IntVar(&c.Retries, "retries", 2, "Number of times GET and DELETE requests are retried on connection or server errors")
+	rootCmd.PersistentFlags().DurationVar(&c.RetryInterval, "retry-interval", 500*time.Millisecond, "Time waited before the first retry, doubled after each retry")
+	rootCmd.PersistentFlags().IntVar(&c.PageSize, "page-size", 0, "Number of items requested at a time by the listings the controller pages, all at once if 0")
+	rootCmd.PersistentFlags().IntVar(&maxItems, "max-items", 0, "Maximum number of items listed, all if 0")
+	rootCmd.PersistentFlags().BoolVar(&human, "human", false, "Output sizes and times in a human readable form, e.g., 2.5 GiB and 3h12m ago")
+	rootCmd.PersistentFlags().StringVar(&auditLog, "audit-log", os.Getenv(ciaoAuditLogEnv), "File to which a record of every request changing the cluster is appended, overrides "+ciaoAuditLogEnv)
+	rootCmd.PersistentFlags().StringVar(&metricsPushURL, "metrics-push-url", os.Getenv(ciaoMetricsPushURLEnv), "URL of a Prometheus pushgateway to which the duration and outcome of the command are pushed, overrides "+ciaoMetricsPushURLEnv)
+	rootCmd.PersistentFlags().StringVar(&mockDir, "mock", "", "Directory of recorded responses replayed instead of sending requests to the controller")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Directory in which the responses of the controller are recorded, to be replayed with --mock")
+	rootCmd.PersistentFlags().BoolVar(&skipVersionCheck, "skip-version-check", false, "Do not check that the controller supports a version of the ciao API known to the CLI")
 	rootCmd.SilenceUsage = true
 }
@@ -79,11 +79,74 @@ var imageShowCmd = &cobra.Command{
 	},
 }
 
+const instanceHistoryTemplate = `{{ range . -}}
+{{ .Timestamp.Local.Format "2006-01-02 15:04:05" }}	{{ .Action }}	{{ .Result }}
+{{- if .User }} by {{ .User }}{{ end }}
+{{- if .NodeID }} on {{ .NodeID }}{{ end }}
+{{- if .Reason }}: {{ .Reason }}{{ end }}
+{{ end }}`
+
+const instanceCrashesTemplate = `{{ range . -}}
+{{ .Timestamp.Local.Format "2006-01-02 15:04:05" }}	{{ .ExitStatus }} on {{ .NodeID }}
+	Artifacts: {{ .Artifacts }}{{ if .MemoryDump }} (with memory dump){{ end }}
+{{- if .Stderr }}
+{{ .Stderr }}
+{{- end }}
+{{ end }}`
+
+var instanceShowFlags = struct {
+	history bool
+	crashes bool
+}{}
+
 var instanceShowCmd = &cobra.Command{
 	Use:   "instance ID",
 	Short: "Show information about an instance",
-	Args:  cobra.ExactArgs(1),
+	Long: `Show information about an instance.
+
+With --history the actions performed on the instance are shown instead,
+oldest first, along with the reasons for any failures.  The history of an
+instance remains available after it has been deleted.  When using the
+template flag with --history the following structure is provided:
+
+` + tfortools.GenerateUsageUndecorated([]types.InstanceAction{}) + `
+
+With --crashes the crashes of the instance are shown instead, along with the
+location of the artifacts collected on the node for postmortem debugging.
+The artifacts are not uploaded to the controller and must be fetched from
+the node.  They are removed, and the crashes forgotten, when the instance is
+deleted.  When using the template flag with --crashes the following structure is
+provided:
+
+` + tfortools.GenerateUsageUndecorated([]types.InstanceCrash{}),
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if instanceShowFlags.history {
+			actions, err := c.ListInstanceActions(args[0])
+			if err != nil {
+				return errors.Wrap(err, "Error getting instance history")
+			}
+
+			if template == "" {
+				template = instanceHistoryTemplate
+			}
+
+			return render(cmd, actions.Actions)
+		}
+
+		if instanceShowFlags.crashes {
+			crashes, err := c.ListInstanceCrashes(args[0])
+			if err != nil {
+				return errors.Wrap(err, "Error getting instance crashes")
+			}
+
+			if template == "" {
+				template = instanceCrashesTemplate
+			}
+
+			return render(cmd, crashes.Crashes)
+		}
+
 		server, err := c.GetInstance(args[0])
 		if err != nil {
 			return errors.Wrap(err, "Error getting instance")
@@ -168,6 +231,30 @@ var traceShowCmd = &cobra.Command{
 	},
 }
 
+var subnetShowTemplate = `ID:		{{ .ID }}
+Name:		{{ .Name }}
+CIDR:		{{ .CIDR }}
+CreateTime:	{{ .CreateTime }}
+`
+
+var subnetShowCmd = &cobra.Command{
+	Use:   "subnet ID",
+	Short: "Show subnet information",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subnet, err := c.GetSubnet(args[0])
+		if err != nil {
+			return errors.Wrap(err, "Error getting subnet")
+		}
+
+		return render(cmd, subnet)
+	},
+	Annotations: map[string]string{
+		"default_template": subnetShowTemplate,
+		"template_usage":   tfortools.GenerateUsageUndecorated(types.TenantSubnet{}),
+	},
+}
+
 var volumeShowTemplate = `ID:		{{ .ID }}
 Name:		{{ .Name }}
 Description:	{{ .Description }}
@@ -209,6 +296,12 @@ Requirements:
 	Hostname	{{ .Requirements.Hostname }}
 	NetworkNode	{{ .Requirements.NetworkNode }}
 	Privileged	{{ .Requirements.Privileged }}
+	DisableNetMultiQueue	{{ .Requirements.DisableNetMultiQueue }}
+	DiskIOPS	{{ .Requirements.DiskIOPS }}
+	NetBandwidthMbps	{{ .Requirements.NetBandwidthMbps }}
+{{- range $k, $v := .Requirements.ExtraSpecs }}
+	{{ $k }}	{{ $v }}
+{{- end }}
 Storage:
 {{- range .Storage }}
 	ID:		{{ .ID }}
@@ -242,6 +335,7 @@ var showCmds = []*cobra.Command{
 	imageShowCmd,
 	instanceShowCmd,
 	nodeShowCmd,
+	subnetShowCmd,
 	tenantShowCmd,
 	traceShowCmd,
 	volumeShowCmd,
@@ -253,5 +347,8 @@ func init() {
 		showCmd.AddCommand(cmd)
 	}
 
+	instanceShowCmd.Flags().BoolVar(&instanceShowFlags.history, "history", false, "Show the history of the actions performed on the instance")
+	instanceShowCmd.Flags().BoolVar(&instanceShowFlags.crashes, "crashes", false, "Show the crashes of the instance and where their artifacts are stored")
+
 	rootCmd.AddCommand(showCmd)
 }
@@ -0,0 +1,118 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var sshFlags = struct {
+	user     string
+	identity string
+}{}
+
+// workloadUser returns the name of the first user created by the
+// cloud-init config of a workload, if any.
+func workloadUser(workloadID string) (string, error) {
+	wl, err := c.GetWorkload(workloadID)
+	if err != nil {
+		return "", errors.Wrap(err, "Error getting workload")
+	}
+
+	var config struct {
+		Users []struct {
+			Name string `yaml:"name"`
+		} `yaml:"users"`
+	}
+	if err := yaml.Unmarshal([]byte(wl.Config), &config); err != nil {
+		return "", errors.Wrap(err, "Error parsing workload cloud-init config")
+	}
+
+	for _, u := range config.Users {
+		if u.Name != "" {
+			return u.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// sshArgs builds the arguments used to run ssh for an instance reachable
+// at ip:port.
+func sshArgs(user, identity, ip string, port int, extra []string) []string {
+	args := []string{"ssh", "-p", strconv.Itoa(port)}
+	if identity != "" {
+		args = append(args, "-i", identity)
+	}
+
+	host := ip
+	if user != "" {
+		host = fmt.Sprintf("%s@%s", user, ip)
+	}
+	args = append(args, host)
+
+	return append(args, extra...)
+}
+
+var sshCmd = &cobra.Command{
+	Use:   "ssh INSTANCE [-- COMMAND...]",
+	Short: "Connect to an instance with ssh",
+	Long: `Connect to an instance with ssh, using the SSH address and port reported by
+the controller.
+
+Unless --user is given the first user created by the cloud-init config of the
+instance's workload is used.  Arguments following -- are passed to ssh.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, err := c.GetInstance(args[0])
+		if err != nil {
+			return errors.Wrap(err, "Error getting instance")
+		}
+
+		if server.Server.SSHIP == "" || server.Server.SSHPort == 0 {
+			return fmt.Errorf("Instance %s is not reachable over ssh", args[0])
+		}
+
+		user := sshFlags.user
+		if user == "" {
+			user, err = workloadUser(server.Server.WorkloadID)
+			if err != nil {
+				return err
+			}
+		}
+
+		sshPath, err := exec.LookPath("ssh")
+		if err != nil {
+			return errors.Wrap(err, "Unable to find ssh")
+		}
+
+		argv := sshArgs(user, sshFlags.identity, server.Server.SSHIP, server.Server.SSHPort, args[1:])
+		return errors.Wrap(syscall.Exec(sshPath, argv, os.Environ()), "Error running ssh")
+	},
+}
+
+func init() {
+	sshCmd.Flags().StringVarP(&sshFlags.user, "user", "l", "", "User to log in as")
+	sshCmd.Flags().StringVarP(&sshFlags.identity, "identity", "i", "", "Private key used to authenticate")
+	rootCmd.AddCommand(sshCmd)
+}
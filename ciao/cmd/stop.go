@@ -15,16 +15,36 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/ciao-project/ciao/payloads"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var stopInstanceFlags struct {
+	wait     waitFlags
+	parallel int
+	force    bool
+}
+
 var stopInstanceCmd = &cobra.Command{
-	Use:   "instance ID",
-	Short: "Stop an instance",
-	Args:  cobra.ExactArgs(1),
+	Use:   "instance ID...",
+	Short: "Stop one or more instances",
+	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.Wrap(c.StopInstance(args[0]), "Error stopping instance")
+		if len(args) > 1 {
+			if err := confirm(stopInstanceFlags.force, fmt.Sprintf("This will stop %d instances.", len(args))); err != nil {
+				return err
+			}
+		}
+
+		return runBulk(stopInstanceFlags.parallel, "stop", args, func(id string) error {
+			if err := c.StopInstance(id); err != nil {
+				return errors.Wrap(err, "Error stopping instance")
+			}
+			return waitForInstance(stopInstanceFlags.wait, id, payloads.ComputeStatusStopped)
+		})
 	},
 }
 
@@ -35,5 +55,8 @@ var stopCmd = &cobra.Command{
 
 func init() {
 	stopCmd.AddCommand(stopInstanceCmd)
+	addWaitFlags(stopInstanceCmd, &stopInstanceFlags.wait)
+	addParallelFlag(stopInstanceCmd, &stopInstanceFlags.parallel)
+	addForceFlag(stopInstanceCmd, &stopInstanceFlags.force)
 	rootCmd.AddCommand(stopCmd)
 }
@@ -0,0 +1,82 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// transferProgress counts the bytes of a transfer of total bytes, e.g., an
+// image upload, and reports the progress on stderr when it is a terminal.
+type transferProgress struct {
+	total int64
+	done  int64
+	show  bool
+}
+
+func newTransferProgress(total int64) *transferProgress {
+	return &transferProgress{
+		total: total,
+		show:  isTerminal(os.Stderr),
+	}
+}
+
+func (t *transferProgress) add(n int) {
+	if n == 0 {
+		return
+	}
+
+	t.done += int64(n)
+	if !t.show {
+		return
+	}
+
+	if t.total > 0 {
+		drawProgressBar(t.done, t.total, fmt.Sprintf("%s/%s", humanSize(float64(t.done)), humanSize(float64(t.total))))
+	} else {
+		fmt.Fprintf(os.Stderr, "\r%s", humanSize(float64(t.done)))
+	}
+}
+
+// finish ends the progress line of transfers whose size was unknown
+func (t *transferProgress) finish() {
+	if t.show && t.total <= 0 && t.done > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+type progressReader struct {
+	io.Reader
+	*transferProgress
+}
+
+func (r progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.add(n)
+	return n, err
+}
+
+type progressWriter struct {
+	io.Writer
+	*transferProgress
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.add(n)
+	return n, err
+}
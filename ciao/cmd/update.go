@@ -28,35 +28,87 @@ var updateCmd = &cobra.Command{
 	Short: "Update status of an object",
 }
 
+// quotaFlags maps the flags setting the quotas of the usual resources to
+// the name of the quota they set.
+var quotaFlags = []struct {
+	flag  string
+	quota string
+	usage string
+	value string
+}{
+	{flag: "instances", quota: "tenant-instances-quota", usage: "Maximum number of instances"},
+	{flag: "vcpus", quota: "tenant-vcpu-quota", usage: "Maximum number of VCPUs"},
+	{flag: "mem", quota: "tenant-mem-quota", usage: "Maximum memory in MiB"},
+	{flag: "storage", quota: "tenant-storage-quota", usage: "Maximum storage in GiB"},
+	{flag: "volumes", quota: "tenant-volumes-quota", usage: "Maximum number of volumes"},
+	{flag: "images", quota: "tenant-images-quota", usage: "Maximum number of images"},
+	{flag: "external-ips", quota: "tenant-external-ips-quota", usage: "Maximum number of external IPs"},
+}
+
+func parseQuotaValue(value string) (int, error) {
+	if value == "unlimited" {
+		return -1, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error converting to integer")
+	}
+
+	return v, nil
+}
+
 var updateQuotasCmd = &cobra.Command{
-	Use:   "quota TENANT NAME VALUE",
+	Use:   "quota TENANT [NAME VALUE]",
 	Short: "Update tenant quotas",
-	Long:  "Updates the quota entry for the supplied tenant with the value or limit",
-	Args:  cobra.ExactArgs(3),
+	Long: `Updates the quota entries for the supplied tenant with the value or limit.
+
+The quotas of the usual resources can be set with flags, e.g.,
+--instances 20 --vcpus 16 --mem 8192, any other quota by its NAME.  Values
+are either integers or unlimited.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 && len(args) != 3 {
+			return errors.New("Expected a tenant optionally followed by a quota name and value")
+		}
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if !c.IsPrivileged() {
 			return errors.New("Updating quotas is restricted to privileged users")
 		}
 
 		tenant := args[0]
-		name := args[1]
-		value := args[2]
-
-		var v int
-		if value == "unlimited" {
-			v = -1
-		} else {
-			var err error
-			v, err = strconv.Atoi(value)
+
+		var quotas []types.QuotaDetails
+		if len(args) == 3 {
+			v, err := parseQuotaValue(args[2])
+			if err != nil {
+				return err
+			}
+			quotas = append(quotas, types.QuotaDetails{
+				Name:  args[1],
+				Value: v,
+			})
+		}
+
+		for _, q := range quotaFlags {
+			if !cmd.Flags().Changed(q.flag) {
+				continue
+			}
+
+			v, err := parseQuotaValue(q.value)
 			if err != nil {
-				return errors.Wrap(err, "Error converting to integer")
+				return errors.Wrapf(err, "Invalid value for --%s", q.flag)
 			}
+			quotas = append(quotas, types.QuotaDetails{
+				Name:  q.quota,
+				Value: v,
+			})
 		}
 
-		quotas := []types.QuotaDetails{{
-			Name:  name,
-			Value: v,
-		}}
+		if len(quotas) == 0 {
+			return errors.New("No quotas to update")
+		}
 
 		return errors.Wrap(c.UpdateQuotas(tenant, quotas), "Error updating quotas")
 	},
@@ -94,9 +146,43 @@ var tenantUpdateCmd = &cobra.Command{
 	},
 }
 
+var workloadUpdateCmd = &cobra.Command{
+	Use:   "workload ID FILE",
+	Short: "Update a workload",
+	Long: `Replace the definition of a workload with the content of a workload yaml
+file, as used by create workload.  The workload keeps its ID and visibility.
+Existing instances of the workload are not affected.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req, err := workloadFromFile(args[1])
+		if err != nil {
+			return err
+		}
+
+		err = c.UpdateWorkload(args[0], req)
+		if err != nil {
+			return errors.Wrap(err, "Error updating workload")
+		}
+
+		workload, err := c.GetWorkload(args[0])
+		if err != nil {
+			return errors.Wrap(err, "Error getting workload")
+		}
+
+		return render(cmd, workload)
+	},
+	Annotations: workloadShowCmd.Annotations,
+}
+
 func init() {
 	updateCmd.AddCommand(updateQuotasCmd)
 	updateCmd.AddCommand(tenantUpdateCmd)
+	updateCmd.AddCommand(workloadUpdateCmd)
+
+	for i := range quotaFlags {
+		q := &quotaFlags[i]
+		updateQuotasCmd.Flags().StringVar(&q.value, q.flag, "", q.usage+", or unlimited")
+	}
 
 	tenantUpdateCmd.Flags().IntVar(&tenantFlags.cidrPrefixSize, "cidr-prefix-size", 0, "Number of bits in network mask (12-30)")
 	tenantUpdateCmd.Flags().BoolVar(&tenantFlags.createPrivilegedContainers, "create-privileged-containers", false, "Whether this tenant can create privileged containers")
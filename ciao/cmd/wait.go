@@ -0,0 +1,136 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/ciao-project/ciao/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// waitPollInterval is how often a resource is polled while waiting for it
+// to reach the expected state.
+var waitPollInterval = 2 * time.Second
+
+type waitFlags struct {
+	enabled bool
+	timeout time.Duration
+}
+
+func addWaitFlags(cmd *cobra.Command, flags *waitFlags) {
+	cmd.Flags().BoolVar(&flags.enabled, "wait", false, "Wait for the operation to complete")
+	cmd.Flags().DurationVar(&flags.timeout, "timeout", 5*time.Minute, "How long to wait for the operation to complete")
+}
+
+// waitFor calls done until it reports that the operation is complete,
+// returns an error or the timeout expires.
+func waitFor(flags waitFlags, what string, done func() (bool, error)) error {
+	if !flags.enabled {
+		return nil
+	}
+
+	deadline := time.Now().Add(flags.timeout)
+	for {
+		complete, err := done()
+		if err != nil {
+			return err
+		}
+
+		if complete {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out after %v waiting for %s", flags.timeout, what)
+		}
+
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// waitForInstance waits for an instance to reach the given status.  An
+// instance that disappears while waiting has failed to start.
+func waitForInstance(flags waitFlags, instanceID string, status string) error {
+	return waitFor(flags, fmt.Sprintf("instance %s to be %s", instanceID, status), func() (bool, error) {
+		server, err := c.GetInstance(instanceID)
+		if client.IsNotFound(err) {
+			return false, fmt.Errorf("Instance %s no longer exists", instanceID)
+		} else if err != nil {
+			return false, errors.Wrap(err, "Error getting instance")
+		}
+
+		return server.Server.Status == status, nil
+	})
+}
+
+func waitForInstanceDeleted(flags waitFlags, instanceID string) error {
+	return waitFor(flags, fmt.Sprintf("instance %s to be deleted", instanceID), func() (bool, error) {
+		server, err := c.GetInstance(instanceID)
+		if client.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "Error getting instance")
+		}
+		// soft deleted instances are only removed once the deferred
+		// delete window of the controller has passed
+		return server.Server.DeleteAt != nil, nil
+	})
+}
+
+func waitForAllInstancesDeleted(flags waitFlags) error {
+	return waitFor(flags, "all instances to be deleted", func() (bool, error) {
+		servers, err := c.ListInstances()
+		if err != nil {
+			return false, errors.Wrap(err, "Error listing instances")
+		}
+		for _, s := range servers.Servers {
+			if s.DeleteAt == nil {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func waitForVolume(flags waitFlags, volumeID string, state types.BlockState) error {
+	return waitFor(flags, fmt.Sprintf("volume %s to be %s", volumeID, state), func() (bool, error) {
+		vol, err := c.GetVolume(volumeID)
+		if err != nil {
+			return false, errors.Wrap(err, "Error getting volume")
+		}
+		return vol.State == state, nil
+	})
+}
+
+func waitForVolumeDeleted(flags waitFlags, volumeID string) error {
+	return waitFor(flags, fmt.Sprintf("volume %s to be deleted", volumeID), func() (bool, error) {
+		volumes, err := c.ListVolumes()
+		if err != nil {
+			return false, errors.Wrap(err, "Error listing volumes")
+		}
+
+		for _, v := range volumes {
+			if v.ID == volumeID {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type watchFlags struct {
+	enabled  bool
+	interval time.Duration
+}
+
+func addWatchFlags(cmd *cobra.Command, flags *watchFlags) {
+	cmd.Flags().BoolVarP(&flags.enabled, "watch", "w", false, "Keep refreshing the output until interrupted")
+	cmd.Flags().DurationVar(&flags.interval, "watch-interval", 2*time.Second, "How often the output is refreshed with --watch")
+}
+
+// isTerminal returns true if f is a terminal rather than a pipe or a file
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// watch calls show once, or every flags.interval when watching until show
+// returns an error.  On a terminal the screen is cleared before each
+// refresh, otherwise the successive outputs are streamed one after the
+// other so that they can be processed, e.g., by jq.
+func watch(flags watchFlags, show func() error) error {
+	if !flags.enabled {
+		return show()
+	}
+
+	if flags.interval <= 0 {
+		return fmt.Errorf("Invalid watch interval %v", flags.interval)
+	}
+
+	clear := isTerminal(os.Stdout) && !jsonOutput()
+	for {
+		if clear {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("Every %v: %s\n\n", flags.interval, time.Now().Format("2006-01-02 15:04:05"))
+		}
+
+		if err := show(); err != nil {
+			return err
+		}
+
+		time.Sleep(flags.interval)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/types"
+	"github.com/intel/tfortools"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var workloadCmd = &cobra.Command{
+	Use:   "workload",
+	Short: "Inspect workloads",
+}
+
+type instanceDependency struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	TenantID string `json:"tenant_id"`
+	Status   string `json:"status"`
+}
+
+type workloadDependency struct {
+	ID          string               `json:"id"`
+	Description string               `json:"description"`
+	Instances   []instanceDependency `json:"instances"`
+}
+
+type imageDependency struct {
+	ID        string               `json:"id"`
+	Name      string               `json:"name"`
+	Workloads []workloadDependency `json:"workloads"`
+}
+
+var workloadGraphFlags struct {
+	parallel int
+}
+
+// workloadImages returns the IDs of the images the storage of a workload
+// is created from.
+func workloadImages(wl types.Workload) []string {
+	var images []string
+	for _, s := range wl.Storage {
+		if s.SourceType == types.ImageService && s.Source != "" {
+			images = append(images, s.Source)
+		}
+	}
+	return images
+}
+
+// imageDependencies builds the trees of the workloads created from each of
+// the images and of the instances of these workloads.
+func imageDependencies(images []types.Image, workloads []types.Workload,
+	instances []api.ServerDetails) []imageDependency {
+	byWorkload := make(map[string][]instanceDependency)
+	for _, s := range instances {
+		byWorkload[s.WorkloadID] = append(byWorkload[s.WorkloadID], instanceDependency{
+			ID:       s.ID,
+			Name:     s.Name,
+			TenantID: s.TenantID,
+			Status:   s.Status,
+		})
+	}
+
+	byImage := make(map[string][]workloadDependency)
+	for _, wl := range workloads {
+		for _, id := range workloadImages(wl) {
+			byImage[id] = append(byImage[id], workloadDependency{
+				ID:          wl.ID,
+				Description: wl.Description,
+				Instances:   byWorkload[wl.ID],
+			})
+		}
+	}
+
+	deps := make([]imageDependency, 0, len(images))
+	for _, i := range images {
+		deps = append(deps, imageDependency{
+			ID:        i.ID,
+			Name:      i.Name,
+			Workloads: byImage[i.ID],
+		})
+	}
+
+	return deps
+}
+
+func printDependencies(deps []imageDependency) {
+	for _, i := range deps {
+		fmt.Printf("%s (%s)\n", i.Name, i.ID)
+		for j, wl := range i.Workloads {
+			branch, indent := "├── ", "│   "
+			if j == len(i.Workloads)-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Printf("%s%s (%s)\n", branch, wl.Description, wl.ID)
+
+			for k, s := range wl.Instances {
+				branch := "├── "
+				if k == len(wl.Instances)-1 {
+					branch = "└── "
+				}
+				fmt.Printf("%s%s%s (%s) %s\n", indent, branch, s.Name, s.ID, s.Status)
+			}
+		}
+	}
+}
+
+// listDependencies lists the images, workloads and instances visible to
+// the user, that is those of all the tenants for admins.
+func listDependencies() ([]types.Image, []types.Workload, []api.ServerDetails, error) {
+	var images []types.Image
+	var instances []api.ServerDetails
+	var err error
+
+	if c.IsPrivileged() {
+		var usage types.ImageStoreUsage
+		usage, err = c.ListAllImages()
+		images = usage.Images
+	} else {
+		images, err = c.ListImages()
+	}
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "Error listing images")
+	}
+
+	var workloads []types.Workload
+	if c.IsPrivileged() {
+		workloads, err = listAllTenantsWorkloads(workloadGraphFlags.parallel)
+	} else {
+		workloads, err = c.ListWorkloads()
+	}
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "Error listing workloads")
+	}
+
+	if c.IsPrivileged() {
+		instances, err = listAllTenantsInstances("", workloadGraphFlags.parallel)
+	} else {
+		var servers api.Servers
+		servers, err = c.ListInstances()
+		instances = servers.Servers
+	}
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "Error listing instances")
+	}
+
+	return images, workloads, instances, nil
+}
+
+// showWorkloadGraph prints the dependency trees of every image, or of the
+// image given in args.
+func showWorkloadGraph(cmd *cobra.Command, args []string) error {
+	images, workloads, instances, err := listDependencies()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		var image []types.Image
+		for _, i := range images {
+			if i.ID == args[0] || i.Name == args[0] {
+				image = append(image, i)
+			}
+		}
+		if len(image) == 0 {
+			return fmt.Errorf("Image %s not found", args[0])
+		}
+		images = image
+	}
+
+	deps := imageDependencies(images, workloads, instances)
+	if template == "" && (format == "" || format == "text") {
+		printDependencies(deps)
+		return nil
+	}
+
+	return render(cmd, deps)
+}
+
+var workloadGraphCmd = &cobra.Command{
+	Use:   "graph [IMAGE]",
+	Short: "Show the dependency graph of images, workloads and instances",
+	Long: `Show, for each image or only for the given image, the workloads creating
+their storage from it and the instances of these workloads, i.e., what would
+break if the image were deleted. Admins are shown the images, workloads and
+instances of all tenants.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: showWorkloadGraph,
+	Annotations: map[string]string{
+		"template_usage": tfortools.GenerateUsageUndecorated([]imageDependency{}),
+	},
+}
+
+func init() {
+	workloadGraphCmd.Flags().IntVar(&workloadGraphFlags.parallel, "parallel", 8, "Number of tenants whose workloads and instances are listed concurrently")
+
+	workloadCmd.AddCommand(workloadGraphCmd)
+	rootCmd.AddCommand(workloadCmd)
+}
@@ -18,16 +18,22 @@ package client
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/api"
 	"github.com/ciao-project/ciao/ciao-controller/types"
@@ -41,16 +47,76 @@ type Client struct {
 	CACertFile     string
 	ClientCertFile string
 
+	// ClientKeyFile is the file containing the key of the client
+	// certificate.  The key is read from ClientCertFile if empty.
+	ClientKeyFile string
+
+	// Retries is the number of times GET and DELETE requests are
+	// sent again when they fail to reach the controller or it reports a
+	// server error.
+	Retries int
+
+	// RetryInterval is the time waited before the first retry.  It is
+	// doubled for every subsequent retry.
+	RetryInterval time.Duration
+
+	// DryRun, when set, prevents the requests changing the state of the
+	// cluster from being sent.  They are written to DryRunOutput, or to
+	// stdout if it is nil, and ErrDryRun is returned instead.
+	DryRun       bool
+	DryRunOutput io.Writer
+
+	// PageSize, when non zero, is the number of items requested at a
+	// time from the listings the controller pages.  Each page starts
+	// after the last item of the previous one and pages are requested
+	// until the listing is complete.  Page sizes larger than
+	// types.MaxPageSize are reduced to it, as the controller does.
+	PageSize int
+
+	// APIVersion is the version of the ciao API used to talk to the
+	// controller, as set by SetAPIVersion.
+	APIVersion int
+
+	// AuditLog, when set, receives a JSON record of every request sent
+	// to change the state of the cluster, one per line.
+	AuditLog io.Writer
+
+	// FixturesDir, when set, is the directory holding recorded responses
+	// of the controller.  If RecordFixtures is set the responses to the
+	// requests sent are recorded there, otherwise they are replayed from
+	// there and no request is sent.
+	FixturesDir    string
+	RecordFixtures bool
+
 	caCertPool *x509.CertPool
 	clientCert *tls.Certificate
+	user       string
 
 	Tenants []string
 }
 
+// ErrDryRun is returned in place of the result of the requests that were
+// not sent because DryRun is set.
+var ErrDryRun = errors.New("Request not sent in dry run mode")
+
 type queryValue struct {
 	name, value string
 }
 
+// auditRecord describes a request changing the state of the cluster.  The
+// user is the common name of the client certificate and the body of the
+// request is identified by its SHA-256 digest.
+type auditRecord struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	TenantID   string    `json:"tenant_id"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	BodySHA256 string    `json:"body_sha256,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
 func (client *Client) prepareCAcert() error {
 	if client.CACertFile != "" {
 		caCert, err := ioutil.ReadFile(client.CACertFile)
@@ -68,12 +134,12 @@ func (client *Client) prepareCAcert() error {
 	return nil
 }
 
-func getTenantsFromCertFile(clientCertFile string) ([]string, error) {
+func getSubjectFromCertFile(clientCertFile string) (pkix.Name, error) {
 	var certBlock, p *pem.Block
 
 	data, err := ioutil.ReadFile(clientCertFile)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error loading client cert file")
+		return pkix.Name{}, errors.Wrap(err, "Error loading client cert file")
 	}
 
 	for {
@@ -83,35 +149,42 @@ func getTenantsFromCertFile(clientCertFile string) ([]string, error) {
 		}
 		if p.Type == "CERTIFICATE" {
 			if certBlock != nil {
-				return nil, errors.Wrap(err, "Incorrect number of certificate blocks in file")
+				return pkix.Name{}, errors.Wrap(err, "Incorrect number of certificate blocks in file")
 			}
 			certBlock = p
 		}
 	}
 
 	if certBlock == nil {
-		return nil, errors.New("No certificate block block in cert file")
+		return pkix.Name{}, errors.New("No certificate block block in cert file")
 	}
 
 	cert, err := x509.ParseCertificate(certBlock.Bytes)
 	if err != nil {
-		return nil, errors.New("Unable to parse x509 certificate data")
+		return pkix.Name{}, errors.New("Unable to parse x509 certificate data")
 	}
 
-	return cert.Subject.Organization, nil
+	return cert.Subject, nil
 }
 
 func (client *Client) prepareClientCert() error {
-	cert, err := tls.LoadX509KeyPair(client.ClientCertFile, client.ClientCertFile)
+	keyFile := client.ClientKeyFile
+	if keyFile == "" {
+		keyFile = client.ClientCertFile
+	}
+
+	cert, err := tls.LoadX509KeyPair(client.ClientCertFile, keyFile)
 	if err != nil {
 		return errors.Wrap(err, "Unable to load client certiticate")
 	}
 	client.clientCert = &cert
 
-	client.Tenants, err = getTenantsFromCertFile(client.ClientCertFile)
+	subject, err := getSubjectFromCertFile(client.ClientCertFile)
 	if err != nil {
 		return errors.New("No tenant specified and unable to parse from certificate file")
 	}
+	client.Tenants = subject.Organization
+	client.user = subject.CommonName
 
 	if client.TenantID == "" {
 		if len(client.Tenants) == 0 {
@@ -130,6 +203,10 @@ func (client *Client) prepareClientCert() error {
 
 // Init initialises a client for making requests
 func (client *Client) Init() error {
+	if client.replaying() {
+		return client.initReplay()
+	}
+
 	if client.ControllerURL == "" {
 		return errors.New("Controller URL must be specified")
 	}
@@ -153,6 +230,34 @@ func (client *Client) Init() error {
 	return nil
 }
 
+func (client *Client) replaying() bool {
+	return client.FixturesDir != "" && !client.RecordFixtures
+}
+
+// initReplay initialises a client replaying fixtures, which needs neither
+// a controller nor a certificate.  Without a certificate the user only
+// belongs to TenantID.
+func (client *Client) initReplay() error {
+	if client.ControllerURL == "" {
+		client.ControllerURL = "ciao-controller"
+	}
+
+	if !strings.HasPrefix(client.ControllerURL, "https://") {
+		client.ControllerURL = fmt.Sprintf("https://%s:%d", client.ControllerURL, api.Port)
+	}
+
+	if client.ClientCertFile != "" {
+		return client.prepareClientCert()
+	}
+
+	if client.TenantID == "" {
+		return errors.New("A tenant must be specified to replay fixtures without a client certificate")
+	}
+	client.Tenants = []string{client.TenantID}
+
+	return nil
+}
+
 func (client *Client) buildComputeURL(format string, args ...interface{}) string {
 	prefix := fmt.Sprintf("%s/v2.1/", client.ControllerURL)
 	return fmt.Sprintf(prefix+format, args...)
@@ -163,6 +268,12 @@ func (client *Client) buildCiaoURL(format string, args ...interface{}) string {
 	return fmt.Sprintf(prefix+format, args...)
 }
 
+// retryable returns true if requests using method have no body and can be
+// sent again without side effects.
+func retryable(method string) bool {
+	return method == "GET" || method == "DELETE"
+}
+
 func (client *Client) sendHTTPRequest(method string, url string, values []queryValue, body io.Reader, content string) (*http.Response, error) {
 	req, err := http.NewRequest(method, os.ExpandEnv(url), body)
 	if err != nil {
@@ -188,6 +299,10 @@ func (client *Client) sendHTTPRequest(method string, url string, values []queryV
 		req.Header.Set("Accept", "application/json")
 	}
 
+	if client.DryRun && method != "GET" {
+		return nil, client.printRequest(req, body, content)
+	}
+
 	tlsConfig := &tls.Config{}
 
 	if client.caCertPool != nil {
@@ -199,28 +314,123 @@ func (client *Client) sendHTTPRequest(method string, url string, values []queryV
 		tlsConfig.BuildNameToCertificate()
 	}
 
-	transport := &http.Transport{
+	var transport http.RoundTripper = &http.Transport{
 		TLSClientConfig: tlsConfig,
 	}
+	if client.FixturesDir != "" {
+		if client.RecordFixtures {
+			transport = &recordTransport{client.FixturesDir, transport}
+		} else {
+			transport = &replayTransport{client.FixturesDir}
+		}
+	}
+
+	var audit *auditRecord
+	var digest hash.Hash
+	if client.AuditLog != nil && method != "GET" {
+		audit = &auditRecord{
+			Time:     time.Now(),
+			User:     client.user,
+			TenantID: client.TenantID,
+			Method:   method,
+			URL:      req.URL.String(),
+		}
+
+		// The body is hashed as it is sent so that large bodies,
+		// e.g., images, are not held in memory.
+		if req.Body != nil {
+			digest = sha256.New()
+			req.Body = teeReadCloser(req.Body, digest)
+			if getBody := req.GetBody; getBody != nil {
+				req.GetBody = func() (io.ReadCloser, error) {
+					body, err := getBody()
+					if err != nil {
+						return nil, err
+					}
+					digest.Reset()
+					return teeReadCloser(body, digest), nil
+				}
+			}
+		}
+	}
+
+	attempts := 1
+	if retryable(method) && !client.replaying() {
+		attempts += client.Retries
+	}
 
 	c := &http.Client{Transport: transport}
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "Could not send HTTP request")
+	var resp *http.Response
+	for i := 0; ; i++ {
+		resp, err = c.Do(req)
+		if i+1 >= attempts || (err == nil && resp.StatusCode < http.StatusInternalServerError) {
+			break
+		}
+
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		time.Sleep(client.RetryInterval << uint(i))
 	}
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		respBody, errBody := ioutil.ReadAll(resp.Body)
-		if errBody != nil {
-			return resp, fmt.Errorf("HTTP Error: %s", resp.Status)
+	if audit != nil {
+		if err != nil {
+			audit.Error = err.Error()
+		} else {
+			audit.Status = resp.StatusCode
+			if digest != nil {
+				audit.BodySHA256 = hex.EncodeToString(digest.Sum(nil))
+			}
 		}
+		_ = json.NewEncoder(client.AuditLog).Encode(audit)
+	}
 
-		return resp, fmt.Errorf("HTTP Error [%d] for [%s %s]: %s", resp.StatusCode, method, url, respBody)
+	if err != nil {
+		return nil, &httpError{
+			category: ErrUnreachable,
+			msg:      fmt.Sprintf("Could not send HTTP request: %v", err),
+		}
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp, newHTTPError(resp, method, url)
 	}
 
 	return resp, err
 }
 
+// teeReadCloser returns a ReadCloser writing to w what it reads from r.
+func teeReadCloser(r io.ReadCloser, w io.Writer) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(r, w), r}
+}
+
+// printRequest writes the method, URL and body of a request that is not
+// sent in dry run mode.
+func (client *Client) printRequest(req *http.Request, body io.Reader, content string) error {
+	w := client.DryRunOutput
+	if w == nil {
+		w = os.Stdout
+	}
+
+	fmt.Fprintf(w, "%s %s\n", req.Method, req.URL)
+	if body != nil {
+		if strings.HasSuffix(content, "octet-stream") {
+			fmt.Fprintln(w, "<binary data>")
+		} else {
+			b, err := ioutil.ReadAll(body)
+			if err != nil {
+				return errors.Wrap(err, "Error reading request body")
+			}
+			fmt.Fprintf(w, "%s\n", b)
+		}
+	}
+
+	return ErrDryRun
+}
+
 func (client *Client) unmarshalHTTPResponse(resp *http.Response, v interface{}) error {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -299,6 +509,41 @@ func (client *Client) getResource(url string, content string, query []queryValue
 	return nil
 }
 
+// getPages requests a listing one page at a time when PageSize is set, or
+// in a single request otherwise.  getPage is given the query selecting the
+// page and returns the number of items received and the ID of the last one,
+// which marks the start of the next page.
+func (client *Client) getPages(getPage func(query []queryValue) (int, string, error)) error {
+	if client.PageSize <= 0 {
+		_, _, err := getPage(nil)
+		return err
+	}
+
+	pageSize := client.PageSize
+	if pageSize > types.MaxPageSize {
+		pageSize = types.MaxPageSize
+	}
+
+	marker := ""
+	for {
+		query := []queryValue{{name: "limit", value: strconv.Itoa(pageSize)}}
+		if marker != "" {
+			query = append(query, queryValue{name: "marker", value: marker})
+		}
+
+		n, last, err := getPage(query)
+		if err != nil {
+			return err
+		}
+
+		if n < pageSize {
+			return nil
+		}
+
+		marker = last
+	}
+}
+
 func (client *Client) deleteResource(url string, content string) error {
 	resp, err := client.sendHTTPRequest("DELETE", url, nil, nil, content)
 	if err != nil {
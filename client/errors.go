@@ -0,0 +1,127 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/pkg/errors"
+)
+
+// ErrorCategory classifies the reasons for which requests fail
+type ErrorCategory int
+
+const (
+	// ErrOther is the category of the errors fitting no other category
+	ErrOther ErrorCategory = iota
+
+	// ErrUnreachable is the category of the requests that could not be
+	// sent to the controller
+	ErrUnreachable
+
+	// ErrUnauthorized is the category of the requests refused because
+	// the user lacks the required privileges
+	ErrUnauthorized
+
+	// ErrNotFound is the category of the requests for resources that do
+	// not exist
+	ErrNotFound
+
+	// ErrOverQuota is the category of the requests refused because they
+	// would exceed the quotas of the tenant
+	ErrOverQuota
+
+	// ErrServer is the category of the requests the controller failed to
+	// process
+	ErrServer
+)
+
+// httpError is returned when a request fails, either because it could not
+// be sent, in which case code is 0, or because the controller responded
+// with an HTTP error status.
+type httpError struct {
+	code     int
+	category ErrorCategory
+	msg      string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+// newHTTPError creates the error returned for resp, whose status is an
+// error.  The controller refuses requests exceeding the quotas, as well as
+// invalid ones, with 403 so they are told apart by the quotas listed in
+// the response or, for older controllers, by its message.
+func newHTTPError(resp *http.Response, method string, url string) *httpError {
+	e := &httpError{code: resp.StatusCode}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		e.category = ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		e.category = ErrNotFound
+	case resp.StatusCode >= http.StatusInternalServerError:
+		e.category = ErrServer
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		e.msg = fmt.Sprintf("HTTP Error: %s", resp.Status)
+		return e
+	}
+
+	var body api.HTTPReturnErrorCode
+	if resp.StatusCode == http.StatusForbidden && json.Unmarshal(respBody, &body) == nil &&
+		(len(body.Error.Quotas) > 0 || strings.Contains(strings.ToLower(body.Error.Message), "quota")) {
+		e.category = ErrOverQuota
+	}
+
+	e.msg = fmt.Sprintf("HTTP Error [%d] for [%s %s]: %s", resp.StatusCode, method, url, respBody)
+	return e
+}
+
+// IsNotFound returns true if err was caused by the controller reporting
+// that the requested resource does not exist.
+func IsNotFound(err error) bool {
+	return GetErrorCategory(err) == ErrNotFound
+}
+
+// GetErrorCategory returns the category of the failed request err was
+// caused by, and ErrOther if err was not caused by a request.
+func GetErrorCategory(err error) ErrorCategory {
+	if e, ok := errors.Cause(err).(*httpError); ok {
+		return e.category
+	}
+
+	return ErrOther
+}
+
+// GetErrorStatus returns the HTTP status of the response to the failed
+// request err was caused by, and 0 if there was no response.
+func GetErrorStatus(err error) int {
+	if e, ok := errors.Cause(err).(*httpError); ok {
+		return e.code
+	}
+
+	return 0
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fixture is a response of the controller as stored in a fixture file.
+// JSON bodies are stored as is so that fixtures can be edited, other
+// bodies are base64 encoded.
+type fixture struct {
+	Status int             `json:"status"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Data   []byte          `json:"data,omitempty"`
+}
+
+var unsafeFixtureChars = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+
+// fixtureFile returns the path of the file holding the response to req in
+// dir.  It is named after the method and path of the request, followed by
+// a digest of the query if any, so that fixtures recorded against one
+// controller can be replayed with any other.  Requests differing only by
+// their bodies share the same fixture.
+func fixtureFile(dir string, req *http.Request) string {
+	name := req.Method + unsafeFixtureChars.ReplaceAllString(req.URL.Path, "_")
+	if query := req.URL.Query(); len(query) > 0 {
+		sum := sha256.Sum256([]byte(query.Encode()))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+
+	return filepath.Join(dir, name+".json")
+}
+
+// replayTransport responds to requests with the fixtures of dir rather
+// than sending them.
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := fixtureFile(t.dir, req)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No fixture %s for %s %s", path, req.Method, req.URL.Path)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Error reading fixture")
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, errors.Wrapf(err, "Invalid fixture %s", path)
+	}
+
+	body := f.Data
+	if f.Body != nil {
+		body = f.Body
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// recordTransport sends requests with next and stores the responses as
+// fixtures in dir.  Bodies are recorded as the caller reads them, so that
+// images are not held in memory and event streams, which never end, are
+// recorded up to the point the caller closes them.
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		_ = resp.Body.Close()
+		return nil, errors.Wrap(err, "Unable to create fixture directory")
+	}
+
+	path := fixtureFile(t.dir, req)
+	f := fixture{
+		Status: resp.StatusCode,
+		Header: resp.Header,
+	}
+
+	var body *recordingBody
+	content := resp.Header.Get("Content-Type")
+	if strings.HasSuffix(content, "octet-stream") || strings.HasPrefix(content, "text/event-stream") {
+		body, err = streamFixture(path, f, resp.Body)
+	} else {
+		body = bufferFixture(path, f, resp.Body)
+	}
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = body
+
+	return resp, nil
+}
+
+// recordingBody copies a response body to w as it is read and calls finish
+// once the body has been read in full or closed.
+type recordingBody struct {
+	io.ReadCloser
+	w      io.Writer
+	finish func() error
+	once   sync.Once
+	err    error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.w.Write(p[:n])
+	}
+	if err == io.EOF {
+		if ferr := b.done(); ferr != nil {
+			return n, ferr
+		}
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if ferr := b.done(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (b *recordingBody) done() error {
+	b.once.Do(func() {
+		ferr := b.finish()
+		if b.err == nil {
+			b.err = ferr
+		}
+		if b.err != nil {
+			b.err = errors.Wrap(b.err, "Unable to record fixture")
+		}
+	})
+	return b.err
+}
+
+// bufferFixture records body in memory and writes the fixture to path
+// once it is complete, storing it as is if it turns out to be JSON.
+func bufferFixture(path string, f fixture, body io.ReadCloser) *recordingBody {
+	var buf bytes.Buffer
+	return &recordingBody{
+		ReadCloser: body,
+		w:          &buf,
+		finish: func() error {
+			if json.Valid(buf.Bytes()) {
+				f.Body = buf.Bytes()
+			} else {
+				f.Data = buf.Bytes()
+			}
+
+			data, err := json.MarshalIndent(f, "", "\t")
+			if err != nil {
+				return err
+			}
+
+			return ioutil.WriteFile(path, data, 0644)
+		},
+	}
+}
+
+// streamFixture writes the fixture of a raw body to path as the body is
+// read, base64 encoding it straight into the data field of the fixture.
+func streamFixture(path string, f fixture, body io.ReadCloser) (*recordingBody, error) {
+	head, err := json.Marshal(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding fixture")
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to record fixture")
+	}
+
+	// replace the closing brace of the encoded fixture by the data field
+	head = append(head[:len(head)-1], `,"data":"`...)
+	if _, err := file.Write(head); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrap(err, "Unable to record fixture")
+	}
+
+	enc := base64.NewEncoder(base64.StdEncoding, file)
+	return &recordingBody{
+		ReadCloser: body,
+		w:          enc,
+		finish: func() error {
+			err := enc.Close()
+			if err == nil {
+				_, err = file.WriteString(`"}`)
+			}
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		},
+	}, nil
+}
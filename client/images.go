@@ -60,6 +60,29 @@ func (client *Client) uploadTenantImage(tenant, image string, data io.Reader) er
 	return err
 }
 
+// DownloadImage writes the data of the given image to w
+func (client *Client) DownloadImage(imageID string, w io.Writer) error {
+	var url string
+	if client.IsPrivileged() && client.TenantID == "admin" {
+		url = client.buildCiaoURL("images/%s/file", imageID)
+	} else {
+		url = client.buildCiaoURL("%s/images/%s/file", client.TenantID, imageID)
+	}
+
+	resp, err := client.sendHTTPRequest("GET", url, nil, nil, api.ImagesV1)
+	if err != nil {
+		return errors.Wrapf(err, "Error making HTTP request to %s", url)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected HTTP response code (%d): %s", resp.StatusCode, resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return errors.Wrap(err, "Error reading image data")
+}
+
 // CreateImage creates and uploads a new image
 func (client *Client) CreateImage(name string, visibility types.Visibility, ID string, data io.Reader) (string, error) {
 	opts := api.CreateImageRequest{
@@ -116,3 +139,18 @@ func (client *Client) DeleteImage(imageID string) error {
 
 	return client.deleteResource(url, api.ImagesV1)
 }
+
+// ListAllImages retrieves the images of all the tenants along with the
+// storage they consume. It is only available to the administrator.
+func (client *Client) ListAllImages() (types.ImageStoreUsage, error) {
+	var usage types.ImageStoreUsage
+
+	if !client.IsPrivileged() {
+		return usage, errors.New("This command is only available to admins")
+	}
+
+	url := client.buildCiaoURL("images/all")
+	err := client.getResource(url, api.ImagesV1, nil, &usage)
+
+	return usage, err
+}
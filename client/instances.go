@@ -68,6 +68,11 @@ func (client *Client) StartInstance(instanceID string) error {
 	return client.instanceAction(instanceID, "os-start")
 }
 
+// RestoreInstance cancels the deferred deletion of the given instance
+func (client *Client) RestoreInstance(instanceID string) error {
+	return client.instanceAction(instanceID, "os-restore")
+}
+
 // ListInstancesByWorkload provides the list of instances for a given tenant and workloadID.
 func (client *Client) ListInstancesByWorkload(tenantID string, workloadID string) (api.Servers, error) {
 	var servers api.Servers
@@ -93,6 +98,28 @@ func (client *Client) ListInstances() (api.Servers, error) {
 	return client.ListInstancesByWorkload(client.TenantID, "")
 }
 
+// ListInstanceActions gets the history of the actions performed on an
+// instance, including the reasons for any failures
+func (client *Client) ListInstanceActions(instanceID string) (api.InstanceActions, error) {
+	var actions api.InstanceActions
+
+	url := client.buildCiaoURL("%s/instances/%s/os-instance-actions", client.TenantID, instanceID)
+	err := client.getResource(url, api.InstancesV1, nil, &actions)
+
+	return actions, err
+}
+
+// ListInstanceCrashes gets the crashes of an instance along with the location
+// of the artifacts collected on its node
+func (client *Client) ListInstanceCrashes(instanceID string) (api.InstanceCrashes, error) {
+	var crashes api.InstanceCrashes
+
+	url := client.buildCiaoURL("%s/instances/%s/crashes", client.TenantID, instanceID)
+	err := client.getResource(url, api.InstancesV1, nil, &crashes)
+
+	return crashes, err
+}
+
 // GetInstance gets the details of a single instances
 func (client *Client) GetInstance(instanceID string) (api.Server, error) {
 	var server api.Server
@@ -17,6 +17,10 @@
 package client
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ciao-project/ciao/ciao-controller/types"
@@ -38,6 +42,56 @@ func (client *Client) ListEvents(tenantID string) (types.CiaoEvents, error) {
 	return events, err
 }
 
+// FollowEvents streams the events logged for either all or the desired
+// tenant from the time of the call, calling f for each of them.  When since
+// is not zero, the events logged at or after since are streamed first.  It
+// returns when the stream is closed by the controller or when f returns an
+// error.
+func (client *Client) FollowEvents(tenantID string, since time.Time, f func(types.CiaoEvent) error) error {
+	var url string
+	var query []queryValue
+
+	if tenantID == "" {
+		url = client.buildComputeURL("events/stream")
+	} else {
+		url = client.buildComputeURL("%s/events/stream", tenantID)
+	}
+
+	if !since.IsZero() {
+		query = append(query, queryValue{name: "since", value: since.UTC().Format(time.RFC3339)})
+	}
+
+	resp, err := client.sendHTTPRequest("GET", url, query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Each server-sent event is a set of data lines ended by an empty
+	// line.  Lines starting with a colon are keepalive comments.
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case line == "" && len(data) > 0:
+			var event types.CiaoEvent
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				return fmt.Errorf("Error decoding event: %v", err)
+			}
+			data = nil
+
+			if err := f(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
 // DeleteEvents deletes all events
 func (client *Client) DeleteEvents() error {
 	url := client.buildComputeURL("events")
@@ -50,49 +104,89 @@ func (client *Client) ListInstancesByNode(nodeID string) (types.CiaoServersStats
 	var servers types.CiaoServersStats
 
 	url := client.buildComputeURL("nodes/%s/servers/detail", nodeID)
-	err := client.getResource(url, "", nil, &servers)
+	err := client.getPages(func(query []queryValue) (int, string, error) {
+		var page types.CiaoServersStats
+
+		if err := client.getResource(url, "", query, &page); err != nil {
+			return 0, "", err
+		}
+
+		if servers.TotalServers == 0 {
+			servers.TotalServers = page.TotalServers
+		}
+		servers.Servers = append(servers.Servers, page.Servers...)
+
+		if len(page.Servers) == 0 {
+			return 0, "", nil
+		}
+		return len(page.Servers), page.Servers[len(page.Servers)-1].ID, nil
+	})
 
 	return servers, err
 }
 
-// DeleteAllInstances deletes all the instances
+// DeleteAllInstances deletes all the instances.  An error listing the
+// instances that could not be deleted is returned if any deletion failed.
 func (client *Client) DeleteAllInstances() error {
 	var action types.CiaoServersAction
+	var results types.CiaoServersActionResults
 
 	url := client.buildComputeURL("%s/servers/action", client.TenantID)
 	action.Action = "os-delete"
 
-	return client.postResource(url, "", &action, nil)
+	err := client.postResource(url, "", &action, &results)
+	if err != nil {
+		return err
+	}
+
+	failures := results.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(failures))
+	for _, f := range failures {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.ServerID, f.Reason))
+	}
+
+	return fmt.Errorf("Unable to delete %d of %d instances: %s", len(failures),
+		len(results.Results), strings.Join(msgs, ", "))
 }
 
-// ListComputeNodes returns the set of compute nodes
-func (client *Client) ListComputeNodes() (types.CiaoNodes, error) {
+func (client *Client) listNodes(url string) (types.CiaoNodes, error) {
 	var nodes types.CiaoNodes
 
-	url := client.buildComputeURL("nodes/compute")
-	err := client.getResource(url, "", nil, &nodes)
+	err := client.getPages(func(query []queryValue) (int, string, error) {
+		var page types.CiaoNodes
+
+		if err := client.getResource(url, "", query, &page); err != nil {
+			return 0, "", err
+		}
+
+		nodes.Nodes = append(nodes.Nodes, page.Nodes...)
+
+		if len(page.Nodes) == 0 {
+			return 0, "", nil
+		}
+		return len(page.Nodes), page.Nodes[len(page.Nodes)-1].ID, nil
+	})
 
 	return nodes, err
 }
 
+// ListComputeNodes returns the set of compute nodes
+func (client *Client) ListComputeNodes() (types.CiaoNodes, error) {
+	return client.listNodes(client.buildComputeURL("nodes/compute"))
+}
+
 // ListNetworkNodes returns the set of network nodes
 func (client *Client) ListNetworkNodes() (types.CiaoNodes, error) {
-	var nodes types.CiaoNodes
-
-	url := client.buildComputeURL("nodes/network")
-	err := client.getResource(url, "", nil, &nodes)
-
-	return nodes, err
+	return client.listNodes(client.buildComputeURL("nodes/network"))
 }
 
 // ListNodes returns the set of nodes
 func (client *Client) ListNodes() (types.CiaoNodes, error) {
-	var nodes types.CiaoNodes
-
-	url := client.buildComputeURL("nodes")
-	err := client.getResource(url, "", nil, &nodes)
-
-	return nodes, err
+	return client.listNodes(client.buildComputeURL("nodes"))
 }
 
 // ListCNCIs returns the set of CNCIs
@@ -125,20 +219,25 @@ func (client *Client) ListTenantQuotas() (types.CiaoTenantResources, error) {
 	return resources, err
 }
 
-// ListTenantResources gets tenant usage information
+// ListTenantResources gets tenant usage information for the last 15 minutes
 func (client *Client) ListTenantResources() (types.CiaoUsageHistory, error) {
+	now := time.Now()
+	return client.ListTenantUsage(now.Add(-15*time.Minute), now)
+}
+
+// ListTenantUsage gets tenant usage information between start and end
+func (client *Client) ListTenantUsage(start, end time.Time) (types.CiaoUsageHistory, error) {
 	var usage types.CiaoUsageHistory
 	url := client.buildComputeURL("%s/resources", client.TenantID)
 
-	now := time.Now()
 	values := []queryValue{
 		{
 			name:  "start_date",
-			value: now.Add(-15 * time.Minute).Format(time.RFC3339),
+			value: start.Format(time.RFC3339),
 		},
 		{
 			name:  "end_date",
-			value: now.Format(time.RFC3339),
+			value: end.Format(time.RFC3339),
 		},
 	}
 
@@ -166,3 +265,13 @@ func (client *Client) GetTraceData(label string) (types.CiaoTraceData, error) {
 
 	return data, err
 }
+
+// GetTraceFrames returns the timestamps of every frame traced with label
+func (client *Client) GetTraceFrames(label string) (types.CiaoTraceFrames, error) {
+	var frames types.CiaoTraceFrames
+
+	url := client.buildComputeURL("traces/%s/frames", label)
+	err := client.getResource(url, "", nil, &frames)
+
+	return frames, err
+}
@@ -0,0 +1,53 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/types"
+)
+
+// ReserveIP reserves an address of the tenant network
+func (client *Client) ReserveIP(address string, description string) (types.ReservedIP, error) {
+	var reserved types.ReservedIP
+
+	req := types.ReserveIPRequest{
+		Address:     address,
+		Description: description,
+	}
+
+	url := client.buildCiaoURL("%s/reserved-ips", client.TenantID)
+	err := client.postResource(url, api.ReservedIPsV1, &req, &reserved)
+
+	return reserved, err
+}
+
+// ListReservedIPs lists the addresses reserved by the tenant
+func (client *Client) ListReservedIPs() ([]types.ReservedIP, error) {
+	var reserved []types.ReservedIP
+
+	url := client.buildCiaoURL("%s/reserved-ips", client.TenantID)
+	err := client.getResource(url, api.ReservedIPsV1, nil, &reserved)
+
+	return reserved, err
+}
+
+// ReleaseReservedIP cancels the reservation of an address
+func (client *Client) ReleaseReservedIP(address string) error {
+	url := client.buildCiaoURL("%s/reserved-ips/%s", client.TenantID, address)
+	return client.deleteResource(url, api.ReservedIPsV1)
+}
@@ -0,0 +1,63 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/types"
+)
+
+// CreateSubnet adds a subnet to the tenant network
+func (client *Client) CreateSubnet(name string, cidr string) (types.TenantSubnet, error) {
+	var subnet types.TenantSubnet
+
+	req := types.CreateSubnetRequest{
+		Name: name,
+		CIDR: cidr,
+	}
+
+	url := client.buildCiaoURL("%s/subnets", client.TenantID)
+	err := client.postResource(url, api.SubnetsV1, &req, &subnet)
+
+	return subnet, err
+}
+
+// ListSubnets lists the subnets created by the tenant
+func (client *Client) ListSubnets() ([]types.TenantSubnet, error) {
+	var subnets []types.TenantSubnet
+
+	url := client.buildCiaoURL("%s/subnets", client.TenantID)
+	err := client.getResource(url, api.SubnetsV1, nil, &subnets)
+
+	return subnets, err
+}
+
+// GetSubnet retrieves the details of a subnet
+func (client *Client) GetSubnet(subnetID string) (types.TenantSubnet, error) {
+	var subnet types.TenantSubnet
+
+	url := client.buildCiaoURL("%s/subnets/%s", client.TenantID, subnetID)
+	err := client.getResource(url, api.SubnetsV1, nil, &subnet)
+
+	return subnet, err
+}
+
+// DeleteSubnet deletes a subnet
+func (client *Client) DeleteSubnet(subnetID string) error {
+	url := client.buildCiaoURL("%s/subnets/%s", client.TenantID, subnetID)
+	return client.deleteResource(url, api.SubnetsV1)
+}
@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/ciao-project/ciao/ciao-controller/api"
+	"github.com/ciao-project/ciao/ciao-controller/types"
+)
+
+// The range of ciao API versions the client can use
+const (
+	MinAPIVersion = 1
+	MaxAPIVersion = api.Version
+)
+
+// GetAPIVersion returns the range of ciao API versions supported by the
+// controller.  Controllers predating the version resource only support
+// version 1.
+func (client *Client) GetAPIVersion() (types.APIVersion, error) {
+	var version types.APIVersion
+
+	url := client.buildCiaoURL("version")
+	err := client.getResource(url, "", nil, &version)
+	if IsNotFound(err) {
+		return types.APIVersion{Version: 1, MinVersion: 1}, nil
+	}
+
+	return version, err
+}
+
+// SetAPIVersion sets APIVersion to the most recent version of the ciao API
+// supported by both the client and a controller supporting version.  An
+// error is returned if they have no version in common, in which case
+// APIVersion is set to the version closest to those of the controller.
+func (client *Client) SetAPIVersion(version types.APIVersion) error {
+	switch {
+	case version.MinVersion > MaxAPIVersion:
+		client.APIVersion = MaxAPIVersion
+		return fmt.Errorf("The controller requires version %d or later of the ciao API but this client only supports up to version %d, please upgrade the client",
+			version.MinVersion, MaxAPIVersion)
+	case version.Version < MinAPIVersion:
+		client.APIVersion = MinAPIVersion
+		return fmt.Errorf("The controller only supports up to version %d of the ciao API but this client requires version %d or later, please upgrade the controller",
+			version.Version, MinAPIVersion)
+	case version.Version < MaxAPIVersion:
+		client.APIVersion = version.Version
+	default:
+		client.APIVersion = MaxAPIVersion
+	}
+
+	return nil
+}
@@ -17,6 +17,8 @@
 package client
 
 import (
+	"strconv"
+
 	"github.com/ciao-project/ciao/ciao-controller/api"
 	"github.com/ciao-project/ciao/ciao-controller/types"
 )
@@ -33,10 +35,30 @@ func (client *Client) CreateVolume(req api.RequestedVolume) (types.Volume, error
 
 // ListVolumes lists the volumes
 func (client *Client) ListVolumes() ([]types.Volume, error) {
+	return client.ListVolumesByFilter(types.VolumeFilter{})
+}
+
+// ListVolumesByFilter lists the volumes matching the filter
+func (client *Client) ListVolumesByFilter(filter types.VolumeFilter) ([]types.Volume, error) {
 	var volumes []types.Volume
 
 	url := client.buildCiaoURL("%s/volumes", client.TenantID)
-	err := client.getResource(url, api.VolumesV1, nil, &volumes)
+
+	values := []queryValue{}
+	if filter.State != "" {
+		values = append(values, queryValue{name: "status", value: string(filter.State)})
+	}
+	if filter.Bootable != nil {
+		values = append(values, queryValue{name: "bootable", value: strconv.FormatBool(*filter.Bootable)})
+	}
+	if filter.MinSize > 0 {
+		values = append(values, queryValue{name: "min_size", value: strconv.Itoa(filter.MinSize)})
+	}
+	if filter.MaxSize > 0 {
+		values = append(values, queryValue{name: "max_size", value: strconv.Itoa(filter.MaxSize)})
+	}
+
+	err := client.getResource(url, api.VolumesV1, values, &volumes)
 
 	return volumes, err
 }
@@ -43,6 +43,17 @@ func (client *Client) ListWorkloads() ([]types.Workload, error) {
 	return wls, err
 }
 
+// ListTenantWorkloads gets the workloads available to a tenant, i.e., its
+// own workloads and the public workloads.  Only admins may list the
+// workloads of tenants other than their own.
+func (client *Client) ListTenantWorkloads(tenantID string) ([]types.Workload, error) {
+	var wls []types.Workload
+
+	url := client.buildCiaoURL("%s/workloads", tenantID)
+	err := client.getResource(url, api.WorkloadsV1, nil, &wls)
+	return wls, err
+}
+
 // CreateWorkload creates a worklaod
 func (client *Client) CreateWorkload(request types.Workload) (types.Workload, error) {
 	url, err := client.getCiaoWorkloadsResource()
@@ -69,6 +80,18 @@ func (client *Client) DeleteWorkload(workloadID string) error {
 	return client.deleteResource(url, api.WorkloadsV1)
 }
 
+// UpdateWorkload replaces the definition of the given workload
+func (client *Client) UpdateWorkload(workloadID string, request types.Workload) error {
+	url, err := client.getCiaoWorkloadsResource()
+	if err != nil {
+		return errors.Wrap(err, "Error getting workloads resource")
+	}
+
+	url = fmt.Sprintf("%s/%s", url, workloadID)
+
+	return client.putResource(url, api.WorkloadsV1, &request)
+}
+
 // GetWorkload gets the given workload
 func (client *Client) GetWorkload(workloadID string) (types.Workload, error) {
 	var wl types.Workload
@@ -58,6 +58,7 @@ const fullValidConf = `configure:
     ceph_id: ciao
   controller:
     ciao_port: 8889
+    ciao_bind_address: ""
     compute_ca: /etc/pki/ciao/compute_ca.pem
     compute_cert: /etc/pki/ciao/compute_key.pem
     cnci_vcpus: 4
@@ -74,6 +75,8 @@ const fullValidConf = `configure:
     disk_limit: true
     mem_limit: true
     child_user: ciao
+    stats_interval: 0
+    stats_delta: false
 `
 
 func testBlob(t *testing.T, conf *payloads.Configure, expectedBlob []byte, positive bool) {
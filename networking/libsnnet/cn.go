@@ -66,7 +66,7 @@ type VnicConfig struct {
 	TenantID   string // UUID
 	SubnetID   string // UUID
 	ConcID     string // UUID
-	Queues     int
+	Queues     int    // Number of tap queues of a TenantVM vnic, at most MaxVnicQueues
 }
 
 // CNSsntpEvent to be generated in response to a VNIC creation
@@ -179,9 +179,15 @@ type ComputeNode struct {
 	//operations to complete. When multiple go routines  invoke the API
 	//simultaneously certain netlink calls suffer higher latencies
 	APITimeout time.Duration
+	//ConnTrackZones tracks the connections of each tenant bridge in a
+	//conntrack zone of its own, as required by ConnTrackStatistics
+	ConnTrackZones bool
 
 	*iptables.IPTables
 
+	connTrackLock  sync.Mutex
+	connTrackZones map[string]uint16
+
 	*cnTopology
 	apiThrottleSem chan int
 }
@@ -380,6 +386,8 @@ func checkCnVnicCfg(cfg *VnicConfig) error {
 		return fmt.Errorf("Invalid VNIC configuration - VnicID")
 	case cfg.VnicRole != TenantVM && cfg.VnicRole != TenantContainer:
 		return fmt.Errorf("Invalid vnic role %v", cfg)
+	case cfg.Queues < 0 || cfg.Queues > MaxVnicQueues:
+		return fmt.Errorf("Invalid VNIC configuration - Queues")
 	}
 
 	return nil
@@ -887,6 +895,12 @@ func (cn *ComputeNode) createVnicInternal(cfg *VnicConfig) (*Vnic, *SsntpEventIn
 		return nil, brCreateMsg, nil, NewFatalError(err.Error())
 	}
 
+	if cn.ConnTrackZones {
+		if err := cn.addConnTrackZone(bridge); err != nil {
+			return nil, brCreateMsg, nil, NewFatalError(err.Error())
+		}
+	}
+
 	if err := createAndEnableVnic(vnic, bridge); err != nil {
 		return nil, brCreateMsg, nil, NewFatalError(err.Error())
 	}
@@ -1152,6 +1166,13 @@ func (cn *ComputeNode) deleteBridgeInternal(bridge *Bridge, bLink *linkInfo, brD
 		fmt.Printf("Unable to delete firewall rule %v", err)
 	}
 
+	//The zone is released even if statistics have since been disabled
+	err = cn.delConnTrackZone(bridge)
+
+	if err != nil {
+		fmt.Printf("Unable to delete conntrack zone rule %v", err)
+	}
+
 	if err := bridge.Destroy(); err != nil {
 		return NewFatalError("bridge destroy failed " + err.Error())
 	}
@@ -1278,6 +1299,12 @@ func (cn *ComputeNode) ResetNetwork() error {
 		initCnTopology(cn.cnTopology)
 	}
 
+	if cn != nil && cn.IPTables != nil {
+		if err := cn.resetConnTrackZones(); err != nil {
+			fmt.Printf("Unable to delete conntrack zone rules %v", err)
+		}
+	}
+
 	//Delete everything with an alias
 	for _, link := range links {
 		alias := link.Attrs().Alias
@@ -0,0 +1,386 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libsnnet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+/* Connection tracking statistics are read from the conntrack table of the
+   node.  Traffic between the instances of a compute node and the tunnels
+   is bridged, so it is only tracked if bridge netfilter is enabled
+   (net.bridge.bridge-nf-call-iptables).  Byte counts are only available
+   if conntrack accounting is enabled (net.netfilter.nf_conntrack_acct),
+   talkers are otherwise ranked on their number of connections.  A line of
+   the table looks like
+
+   ipv4     2 tcp      6 431999 ESTABLISHED src=172.16.0.2 dst=10.0.0.3 sport=42 dport=22
+   packets=5 bytes=300 src=10.0.0.3 dst=172.16.0.2 sport=22 dport=42 packets=4 bytes=500
+   [ASSURED] mark=0 zone=3 use=2
+
+   Instances of different tenants may share a private address, so the
+   connections of each tenant bridge are tracked in their own conntrack
+   zone, assigned when the bridge is created if connection tracking
+   statistics are enabled.  A VNIC is identified in the table by its
+   address and the zone of its bridge.
+
+   Zones are allocated out of 1-65535, zone 0 being the default zone of
+   the node.  The interface index of the bridge is preferred but indexes
+   keep growing on a long running node, so an index is folded into the
+   range and the next free zone is used if another bridge already holds
+   it.  The zones in use are those of the raw PREROUTING rules of the
+   node, which survive a restart of the launcher.
+*/
+
+const procConnTrack = "/proc/net/nf_conntrack"
+
+//ConnTrackTalker describes the traffic between an instance and a single peer
+type ConnTrackTalker struct {
+	IP          net.IP
+	Connections int
+	Bytes       int64
+}
+
+//ConnTrackVnic identifies the connections of an instance VNIC in the
+//conntrack table
+type ConnTrackVnic struct {
+	IP   net.IP
+	Zone uint16
+}
+
+//ConnTrackStats describes the connections tracked for an instance VNIC
+type ConnTrackStats struct {
+	Connections int
+	TopTalkers  []ConnTrackTalker
+}
+
+type connTrackEntry struct {
+	src   []net.IP
+	dst   []net.IP
+	bytes int64
+	zone  uint16
+}
+
+//ConnTrackStatistics returns the connection tracking statistics of the
+//given VNICs, indexed by the same keys as the VNICs, along with up to topN
+//of the peers each VNIC exchanged the most traffic with.
+func ConnTrackStatistics(vnics map[string]ConnTrackVnic, topN int) (map[string]*ConnTrackStats, error) {
+	f, err := os.Open(procConnTrack)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open conntrack table %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return parseConnTrack(f, vnics, topN)
+}
+
+const maxConnTrackZone = 65535
+
+//ConnTrackZone returns the conntrack zone in which the connections of a
+//tenant VNIC are tracked, i.e., the zone of its bridge
+func (cn *ComputeNode) ConnTrackZone(cfg *VnicConfig) (uint16, error) {
+	alias := genCnVnicAliases(cfg)
+	link, err := netlink.LinkByAlias(alias.bridge)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find bridge %s %v", alias.bridge, err)
+	}
+
+	cn.connTrackLock.Lock()
+	defer cn.connTrackLock.Unlock()
+
+	zones, err := cn.loadConnTrackZones()
+	if err != nil {
+		return 0, err
+	}
+
+	zone, ok := zones[link.Attrs().Name]
+	if !ok {
+		return 0, fmt.Errorf("no conntrack zone for bridge %s", link.Attrs().Name)
+	}
+
+	return zone, nil
+}
+
+//loadConnTrackZones returns the zones of the bridges of the node, read
+//from the raw PREROUTING rules the first time it is called
+//Note: Can only be called when holding cn.connTrackLock
+func (cn *ComputeNode) loadConnTrackZones() (map[string]uint16, error) {
+	if cn.connTrackZones != nil {
+		return cn.connTrackZones, nil
+	}
+
+	rules, err := cn.List("raw", "PREROUTING")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list conntrack zone rules %v", err)
+	}
+
+	cn.connTrackZones = parseConnTrackZoneRules(rules)
+	return cn.connTrackZones, nil
+}
+
+//parseConnTrackZoneRules returns the zones of the bridges found in the
+//given rules, e.g., "-A PREROUTING -i br_xxx -j CT --zone 3"
+func parseConnTrackZoneRules(rules []string) map[string]uint16 {
+	zones := make(map[string]uint16)
+
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+
+		var bridge string
+		var zone uint64
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "-i":
+				bridge = fields[i+1]
+			case "--zone":
+				zone, _ = strconv.ParseUint(fields[i+1], 10, 16)
+			}
+		}
+
+		if strings.HasPrefix(bridge, bridgePrefix) && zone != 0 {
+			zones[bridge] = uint16(zone)
+		}
+	}
+
+	return zones
+}
+
+//allocConnTrackZone returns a zone not used by any of zones, preferably
+//the one matching the interface index of the bridge
+func allocConnTrackZone(zones map[string]uint16, bridgeIndex int) (uint16, error) {
+	used := make(map[uint16]bool, len(zones))
+	for _, z := range zones {
+		used[z] = true
+	}
+
+	first := 1
+	if bridgeIndex > 0 {
+		first = (bridgeIndex-1)%maxConnTrackZone + 1
+	}
+
+	for i := 0; i < maxConnTrackZone; i++ {
+		zone := uint16((first-1+i)%maxConnTrackZone + 1)
+		if !used[zone] {
+			return zone, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no conntrack zone available")
+}
+
+//connTrackZoneRule returns the raw table rule tracking the connections of
+//a bridge in a zone
+func connTrackZoneRule(bridge string, zone uint16) []string {
+	return []string{"-i", bridge, "-j", "CT", "--zone", strconv.Itoa(int(zone))}
+}
+
+//addConnTrackZone tracks the connections of a bridge in a zone of their
+//own, reusing the zone of the bridge if it already has one
+func (cn *ComputeNode) addConnTrackZone(bridge *Bridge) error {
+	cn.connTrackLock.Lock()
+	defer cn.connTrackLock.Unlock()
+
+	zones, err := cn.loadConnTrackZones()
+	if err != nil {
+		return err
+	}
+
+	zone, ok := zones[bridge.LinkName]
+	if !ok {
+		zone, err = allocConnTrackZone(zones, bridge.Link.Index)
+		if err != nil {
+			return err
+		}
+	}
+
+	//iptables -t raw -A PREROUTING -i "$bridge" -j CT --zone "$zone"
+	if err := cn.AppendUnique("raw", "PREROUTING", connTrackZoneRule(bridge.LinkName, zone)...); err != nil {
+		return err
+	}
+
+	zones[bridge.LinkName] = zone
+	return nil
+}
+
+//delConnTrackZone releases the zone of a bridge, if any
+func (cn *ComputeNode) delConnTrackZone(bridge *Bridge) error {
+	cn.connTrackLock.Lock()
+	defer cn.connTrackLock.Unlock()
+
+	zones, err := cn.loadConnTrackZones()
+	if err != nil {
+		return err
+	}
+
+	zone, ok := zones[bridge.LinkName]
+	if !ok {
+		return nil
+	}
+
+	if err := cn.Delete("raw", "PREROUTING", connTrackZoneRule(bridge.LinkName, zone)...); err != nil {
+		return err
+	}
+
+	delete(zones, bridge.LinkName)
+	return nil
+}
+
+//resetConnTrackZones releases the zones of all the bridges of the node
+func (cn *ComputeNode) resetConnTrackZones() error {
+	cn.connTrackLock.Lock()
+	defer cn.connTrackLock.Unlock()
+
+	cn.connTrackZones = nil
+	zones, err := cn.loadConnTrackZones()
+	if err != nil {
+		return err
+	}
+
+	for bridge, zone := range zones {
+		if err := cn.Delete("raw", "PREROUTING", connTrackZoneRule(bridge, zone)...); err != nil {
+			return err
+		}
+		delete(zones, bridge)
+	}
+
+	return nil
+}
+
+func parseConnTrackEntry(line string) connTrackEntry {
+	var e connTrackEntry
+
+	for _, field := range strings.Fields(line) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "src":
+			if ip := net.ParseIP(kv[1]); ip != nil {
+				e.src = append(e.src, ip)
+			}
+		case "dst":
+			if ip := net.ParseIP(kv[1]); ip != nil {
+				e.dst = append(e.dst, ip)
+			}
+		case "bytes":
+			if b, err := strconv.ParseInt(kv[1], 10, 64); err == nil {
+				e.bytes += b
+			}
+		case "zone":
+			if z, err := strconv.ParseUint(kv[1], 10, 16); err == nil {
+				e.zone = uint16(z)
+			}
+		}
+	}
+
+	return e
+}
+
+// peer returns the address of the other end of a connection involving ip.
+// The reply direction is checked as well as the original direction so that
+// NATed connections are attributed to the instance.
+func (e connTrackEntry) peer(ip net.IP) net.IP {
+	for i := range e.src {
+		if i >= len(e.dst) {
+			break
+		}
+
+		if e.src[i].Equal(ip) {
+			return e.dst[i]
+		}
+
+		if e.dst[i].Equal(ip) {
+			return e.src[i]
+		}
+	}
+
+	return nil
+}
+
+func parseConnTrack(r io.Reader, vnics map[string]ConnTrackVnic, topN int) (map[string]*ConnTrackStats, error) {
+	talkers := make(map[string]map[string]*ConnTrackTalker)
+	stats := make(map[string]*ConnTrackStats)
+	for key := range vnics {
+		stats[key] = &ConnTrackStats{}
+		talkers[key] = make(map[string]*ConnTrackTalker)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		e := parseConnTrackEntry(scanner.Text())
+
+		for key, vnic := range vnics {
+			if e.zone != vnic.Zone {
+				continue
+			}
+
+			peer := e.peer(vnic.IP)
+			if peer == nil {
+				continue
+			}
+
+			stats[key].Connections++
+
+			t := talkers[key][peer.String()]
+			if t == nil {
+				t = &ConnTrackTalker{IP: peer}
+				talkers[key][peer.String()] = t
+			}
+			t.Connections++
+			t.Bytes += e.bytes
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read conntrack table %v", err)
+	}
+
+	for key, peers := range talkers {
+		top := make([]ConnTrackTalker, 0, len(peers))
+		for _, t := range peers {
+			top = append(top, *t)
+		}
+
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Bytes != top[j].Bytes {
+				return top[i].Bytes > top[j].Bytes
+			}
+			if top[i].Connections != top[j].Connections {
+				return top[i].Connections > top[j].Connections
+			}
+			return top[i].IP.String() < top[j].IP.String()
+		})
+
+		if len(top) > topN {
+			top = top[:topN]
+		}
+		stats[key].TopTalkers = top
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libsnnet
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConnTrack = `ipv4     2 tcp      6 431999 ESTABLISHED src=172.16.0.2 dst=10.0.0.3 sport=40000 dport=22 packets=5 bytes=300 src=10.0.0.3 dst=172.16.0.2 sport=22 dport=40000 packets=4 bytes=500 [ASSURED] mark=0 zone=0 use=2
+ipv4     2 tcp      6 431999 ESTABLISHED src=172.16.0.2 dst=10.0.0.3 sport=40001 dport=22 packets=5 bytes=300 src=10.0.0.3 dst=172.16.0.2 sport=22 dport=40001 packets=4 bytes=500 [ASSURED] mark=0 zone=0 use=2
+ipv4     2 udp      17 29 src=172.16.0.2 dst=8.8.8.8 sport=5353 dport=53 packets=1 bytes=60 src=8.8.8.8 dst=192.168.1.1 sport=53 dport=5353 packets=1 bytes=3000 mark=0 zone=0 use=2
+ipv4     2 tcp      6 117 SYN_SENT src=10.0.0.4 dst=172.16.0.3 sport=40002 dport=80 [UNREPLIED] src=172.16.0.3 dst=10.0.0.4 sport=80 dport=40002 mark=0 zone=0 use=2
+ipv4     2 tcp      6 117 SYN_SENT src=10.0.0.5 dst=10.0.0.6 sport=40003 dport=80 [UNREPLIED] src=10.0.0.6 dst=10.0.0.5 sport=80 dport=40003 mark=0 zone=0 use=2
+ipv4     2 tcp      6 431999 ESTABLISHED src=172.16.0.2 dst=10.0.0.7 sport=40004 dport=22 packets=5 bytes=300 src=10.0.0.7 dst=172.16.0.2 sport=22 dport=40004 packets=4 bytes=500 [ASSURED] mark=0 zone=7 use=2
+`
+
+//Tests the parsing of the conntrack table
+//
+//Tests that the connections of each VNIC are counted and that its
+//top talkers are ranked by the number of bytes exchanged.  Two VNICs
+//share an address in different zones.
+//
+//Test is expected to pass
+func TestParseConnTrack(t *testing.T) {
+	vnics := map[string]ConnTrackVnic{
+		"a": {IP: net.ParseIP("172.16.0.2")},
+		"b": {IP: net.ParseIP("172.16.0.3")},
+		"c": {IP: net.ParseIP("172.16.0.4")},
+		"d": {IP: net.ParseIP("172.16.0.2"), Zone: 7},
+	}
+
+	stats, err := parseConnTrack(strings.NewReader(testConnTrack), vnics, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := stats["a"]
+	if s == nil || s.Connections != 3 || len(s.TopTalkers) != 1 {
+		t.Fatalf("Unexpected stats for 172.16.0.2 %+v", s)
+	}
+
+	top := s.TopTalkers[0]
+	if !top.IP.Equal(net.ParseIP("8.8.8.8")) || top.Connections != 1 || top.Bytes != 3060 {
+		t.Errorf("Unexpected top talker %+v", top)
+	}
+
+	s = stats["b"]
+	if s == nil || s.Connections != 1 || len(s.TopTalkers) != 1 ||
+		!s.TopTalkers[0].IP.Equal(net.ParseIP("10.0.0.4")) || s.TopTalkers[0].Bytes != 0 {
+		t.Errorf("Unexpected stats for 172.16.0.3 %+v", s)
+	}
+
+	s = stats["c"]
+	if s == nil || s.Connections != 0 || len(s.TopTalkers) != 0 {
+		t.Errorf("Unexpected stats for 172.16.0.4 %+v", s)
+	}
+
+	s = stats["d"]
+	if s == nil || s.Connections != 1 || len(s.TopTalkers) != 1 ||
+		!s.TopTalkers[0].IP.Equal(net.ParseIP("10.0.0.7")) {
+		t.Errorf("Unexpected stats for 172.16.0.2 in zone 7 %+v", s)
+	}
+}
+
+//Tests the allocation of conntrack zones
+//
+//Tests that zones are allocated within 1-65535 for interface indexes of
+//65535 and above, that zone 0 is never used and that a zone held by
+//another bridge is not reused.
+//
+//Test is expected to pass
+func TestAllocConnTrackZone(t *testing.T) {
+	tests := []struct {
+		index int
+		zones map[string]uint16
+		zone  uint16
+	}{
+		{7, nil, 7},
+		{65535, nil, 65535},
+		{65536, nil, 1},
+		{65542, map[string]uint16{"br_a": 7}, 8},
+		{131070, nil, 65535},
+		{131070, map[string]uint16{"br_a": 65535}, 1},
+		{0, nil, 1},
+	}
+
+	for _, tst := range tests {
+		zone, err := allocConnTrackZone(tst.zones, tst.index)
+		if err != nil || zone != tst.zone {
+			t.Errorf("Index %d with zones %v: expected zone %d got %d %v",
+				tst.index, tst.zones, tst.zone, zone, err)
+		}
+	}
+
+	full := make(map[string]uint16)
+	for z := 1; z <= maxConnTrackZone; z++ {
+		full[fmt.Sprintf("br_%d", z)] = uint16(z)
+	}
+	if zone, err := allocConnTrackZone(full, 65536); err == nil {
+		t.Errorf("Expected no zone to be available, got %d", zone)
+	}
+}
+
+//Tests the parsing of the conntrack zone rules
+//
+//Tests that the zones of the bridges are read from the raw PREROUTING
+//rules and that other rules are ignored.
+//
+//Test is expected to pass
+func TestParseConnTrackZoneRules(t *testing.T) {
+	rules := []string{
+		"-P PREROUTING ACCEPT",
+		"-A PREROUTING -i br_a -j CT --zone 3",
+		"-A PREROUTING -i br_b -j CT --zone 65535",
+		"-A PREROUTING -i eth0 -j CT --zone 4",
+		"-A PREROUTING -i br_c -j CT --notrack",
+	}
+
+	zones := parseConnTrackZoneRules(rules)
+	expected := map[string]uint16{"br_a": 3, "br_b": 65535}
+	if !reflect.DeepEqual(zones, expected) {
+		t.Errorf("Expected zones %v got %v", expected, zones)
+	}
+}
@@ -25,6 +25,10 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
+// MaxVnicQueues is the largest number of queues a TenantVM vnic can be
+// created with.  This is the limit imposed by the kernel on tap devices.
+const MaxVnicQueues = 256
+
 // NewVnic is used to initialize the Vnic properties
 // This has to be called prior to Create() or GetDevice()
 func NewVnic(id string) (*Vnic, error) {
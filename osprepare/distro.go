@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -44,6 +45,11 @@ type distro interface {
 	// the given target list of items to install
 	InstallPackages(ctx context.Context, packages []string, logger clogger.CiaoLog) bool
 
+	// installLocalPackages should install the given packages
+	// from the local package directory dir without accessing
+	// the network
+	installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool
+
 	// getID should return a string specifying
 	// the distribution ID (e.g: "clearlinux")
 	getID() string
@@ -58,13 +64,41 @@ func getDistro() distro {
 		return nil
 	}
 
-	if strings.HasPrefix(osRelease.ID, "clear-linux") {
+	return distroFromRelease(osRelease)
+}
+
+// distroFromRelease maps an os-release to one of the supported
+// distros.  The ID field is checked first; if it is unknown each
+// entry of ID_LIKE is tried in turn so that derivatives, e.g.,
+// RHEL or Scientific Linux, are handled like their parent distro.
+func distroFromRelease(osRelease *osRelease) distro {
+	if d := distroFromID(osRelease.ID, osRelease); d != nil {
+		return d
+	}
+
+	for _, id := range strings.Fields(osRelease.GetValue("ID_LIKE")) {
+		if d := distroFromID(id, osRelease); d != nil {
+			return d
+		}
+	}
+
+	return nil
+}
+
+func distroFromID(id string, osRelease *osRelease) distro {
+	if strings.HasPrefix(id, "clear-linux") {
 		return &clearLinuxDistro{}
-	} else if strings.Contains(osRelease.ID, "ubuntu") {
+	} else if strings.Contains(id, "ubuntu") {
 		// Store the Ubuntu codename, i.e. "xenial'
 		return &ubuntuDistro{CodeName: osRelease.GetValue("UBUNTU_CODENAME")}
-	} else if strings.Contains(osRelease.ID, "fedora") {
+	} else if strings.Contains(id, "fedora") {
 		return &fedoraDistro{}
+	} else if id == "centos" || id == "rhel" {
+		return &centOSDistro{}
+	} else if id == "debian" {
+		return &debianDistro{}
+	} else if strings.HasPrefix(id, "opensuse") || id == "sles" || id == "suse" {
+		return &openSUSEDistro{}
 	}
 	return nil
 }
@@ -122,6 +156,51 @@ func (d *clearLinuxDistro) InstallPackages(ctx context.Context, packages []strin
 	return sudoFormatCommand(ctx, "swupd bundle-add %s", packages, logger)
 }
 
+// Clear Linux bundles are installed from a local mirror of the update
+// content rather than from individual package files
+func (d *clearLinuxDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return sudoFormatCommand(ctx, "swupd bundle-add --url file://"+escapeFormat(dir)+" %s",
+		packages, logger)
+}
+
+// escapeFormat protects any formatting directives present in a
+// string that is to be embedded in a sudoFormatCommand command
+func escapeFormat(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
+
+// localPackageFiles returns the files in dir providing packages.  The
+// pattern is used to build a glob matching the file of a single package,
+// e.g., "%s_*.deb".  An error is returned if a package has no file.
+func localPackageFiles(dir string, packages []string, pattern string) ([]string, error) {
+	var files []string
+
+	for _, pkg := range packages {
+		matches, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf(pattern, pkg)))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No package file for %s found in %s", pkg, dir)
+		}
+		files = append(files, matches[len(matches)-1])
+	}
+
+	return files, nil
+}
+
+// installLocalFiles installs packages from files found in dir, using
+// command, a sudoFormatCommand command, to perform the installation
+func installLocalFiles(ctx context.Context, command, pattern, dir string, packages []string, logger clogger.CiaoLog) bool {
+	files, err := localPackageFiles(dir, packages, pattern)
+	if err != nil {
+		logger.Errorf("Unable to find local packages: %s", err)
+		return false
+	}
+
+	return sudoFormatCommand(ctx, command, files, logger)
+}
+
 // os-release *ubuntu*
 type ubuntuDistro struct {
 	CodeName string
@@ -135,6 +214,10 @@ func (d *ubuntuDistro) InstallPackages(ctx context.Context, packages []string, l
 	return sudoFormatCommand(ctx, "apt-get --yes --force-yes install %s", packages, logger)
 }
 
+func (d *ubuntuDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return installLocalFiles(ctx, "dpkg --install %s", "%s_*.deb", dir, packages, logger)
+}
+
 // Fedora
 type fedoraDistro struct {
 }
@@ -147,3 +230,60 @@ func (d *fedoraDistro) getID() string {
 func (d *fedoraDistro) InstallPackages(ctx context.Context, packages []string, logger clogger.CiaoLog) bool {
 	return sudoFormatCommand(ctx, "dnf install -y %s", packages, logger)
 }
+
+func (d *fedoraDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return installLocalFiles(ctx, "dnf install -y --disablerepo=* %s", "%s-[0-9]*.rpm", dir, packages, logger)
+}
+
+// os-release centos, rhel
+type centOSDistro struct {
+}
+
+func (d *centOSDistro) getID() string {
+	return "centos"
+}
+
+// Prefer dnf when present, falling back to yum on older releases
+func (d *centOSDistro) InstallPackages(ctx context.Context, packages []string, logger clogger.CiaoLog) bool {
+	if pathExists("/usr/bin/dnf") {
+		return sudoFormatCommand(ctx, "dnf install -y %s", packages, logger)
+	}
+	return sudoFormatCommand(ctx, "yum install -y %s", packages, logger)
+}
+
+func (d *centOSDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return installLocalFiles(ctx, "yum localinstall -y --disablerepo=* %s", "%s-[0-9]*.rpm", dir, packages, logger)
+}
+
+// os-release debian
+type debianDistro struct {
+}
+
+func (d *debianDistro) getID() string {
+	return "debian"
+}
+
+func (d *debianDistro) InstallPackages(ctx context.Context, packages []string, logger clogger.CiaoLog) bool {
+	return sudoFormatCommand(ctx, "apt-get --yes install %s", packages, logger)
+}
+
+func (d *debianDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return installLocalFiles(ctx, "dpkg --install %s", "%s_*.deb", dir, packages, logger)
+}
+
+// os-release opensuse*, sles
+type openSUSEDistro struct {
+}
+
+func (d *openSUSEDistro) getID() string {
+	return "opensuse"
+}
+
+// zypper must not prompt as there is nobody to answer
+func (d *openSUSEDistro) InstallPackages(ctx context.Context, packages []string, logger clogger.CiaoLog) bool {
+	return sudoFormatCommand(ctx, "zypper --non-interactive install %s", packages, logger)
+}
+
+func (d *openSUSEDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return installLocalFiles(ctx, "zypper --non-interactive --no-refresh install %s", "%s-[0-9]*.rpm", dir, packages, logger)
+}
@@ -17,7 +17,12 @@
 package osprepare
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -42,7 +47,7 @@ func (l ospTestLogger) V(level int32) bool {
 
 var info []string
 var warning []string
-var error []string
+var errs []string
 
 func (l ospTestLogger) Infof(format string, v ...interface{}) {
 	info = append(info, format)
@@ -53,7 +58,7 @@ func (l ospTestLogger) Warningf(format string, v ...interface{}) {
 }
 
 func (l ospTestLogger) Errorf(format string, v ...interface{}) {
-	error = append(error, format)
+	errs = append(errs, format)
 }
 
 func TestSudoFormatCommandLogging(t *testing.T) {
@@ -71,7 +76,7 @@ func TestSudoFormatCommandLogging(t *testing.T) {
 }
 
 func TestSudoFormatCommandBadCommandReturn(t *testing.T) {
-	error = []string{}
+	errs = []string{}
 	if getDistro() == nil {
 		t.Skip("Unsupported test distro")
 	}
@@ -80,7 +85,66 @@ func TestSudoFormatCommandBadCommandReturn(t *testing.T) {
 	if sudoFormatCommand(context.Background(), "false", []string{}, l) {
 		t.Fatal("Error return code not detected")
 	}
-	if len(error) != 1 && error[0] != "Error running command: %s" {
+	if len(errs) != 1 && errs[0] != "Error running command: %s" {
 		t.Fatal("Incorrect log message received")
 	}
 }
+
+func TestLocalPackageFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osprepare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for _, f := range []string{"qemu-img-2.9.0-1.fc26.x86_64.rpm", "psmisc_22.21-2_amd64.deb"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := localPackageFiles(dir, []string{"qemu-img"}, "%s-[0-9]*.rpm")
+	if err != nil || len(files) != 1 || filepath.Base(files[0]) != "qemu-img-2.9.0-1.fc26.x86_64.rpm" {
+		t.Fatalf("rpm package not found: %v %v", files, err)
+	}
+
+	files, err = localPackageFiles(dir, []string{"psmisc"}, "%s_*.deb")
+	if err != nil || len(files) != 1 {
+		t.Fatalf("deb package not found: %v %v", files, err)
+	}
+
+	if _, err = localPackageFiles(dir, []string{"qemu"}, "%s-[0-9]*.rpm"); err == nil {
+		t.Fatal("Expected error for missing package file")
+	}
+}
+
+func TestVerifyDeps(t *testing.T) {
+	d := getDistro()
+	if d == nil {
+		t.Skip("Unsupported test distro")
+	}
+
+	reqs := PackageRequirements{
+		d.getID(): {
+			{BinaryName: "", PackageName: ""},
+			{BinaryName: "/bin/sh", PackageName: "sh"},
+			{BinaryName: nonExistentFile, PackageName: "nonexistent"},
+		},
+	}
+
+	missing, err := VerifyDeps(reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].PackageName != "nonexistent" {
+		t.Fatalf("Unexpected missing dependencies: %v", missing)
+	}
+
+	var buf bytes.Buffer
+	if err = ReportMissingDeps(&buf, reqs); err == nil {
+		t.Fatal("Missing dependencies not reported as error")
+	}
+	if !strings.Contains(buf.String(), `"package": "nonexistent"`) {
+		t.Fatalf("Unexpected report: %s", buf.String())
+	}
+}
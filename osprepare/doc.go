@@ -38,10 +38,10 @@ Below is an example of a valid PackageRequirements structure.
 
 	var deps = osprepare.PackageRequirements{
 		"ubuntu": {
-			{"/usr/bin/docker", "docker"},
+			{BinaryName: "/usr/bin/docker", PackageName: "docker"},
 		},
 		"clearlinux": {
-			{"/usr/bin/docker", "containers-basic"},
+			{BinaryName: "/usr/bin/docker", PackageName: "containers-basic"},
 		},
 	}
 
@@ -54,6 +54,22 @@ The dependencies for each component should be placed into a `deps.go` file, whic
 then facilitates easier maintenance and discoverability of the dependencies for
 every component.
 
+Minimum versions
+
+A PackageRequirement may also specify a MinVersion. Once the packages have
+been installed the version of each binary with a MinVersion is obtained by
+running it with the --version flag. An error naming the package to upgrade
+is logged for each binary that is too old and InstallDeps then returns an
+error, leaving the upgrade to the administrator. VerifyDeps reports such
+binaries in the same way as missing ones.
+
+	var deps = osprepare.PackageRequirements{
+		"fedora": {
+			{BinaryName: "/usr/bin/qemu-system-x86_64", PackageName: "qemu-system-x86",
+				MinVersion: osprepare.MinQemuVersion},
+		},
+	}
+
 Verified lack of dependencies
 
 Note that it is also valid to state you have *no* dependencies at all, and that
@@ -62,26 +78,53 @@ installed during startup. Just pass an empty pair to the distro ID:
 
 	var schedDeps = osprepare.PackageRequirements{
 		"clearlinux": {
-			{"", ""},
+			{BinaryName: "", PackageName: ""},
 		},
 		"fedora": {
-			{"", ""},
+			{BinaryName: "", PackageName: ""},
 		},
 		"ubuntu": {
-			{"", ""},
+			{BinaryName: "", PackageName: ""},
 		},
 	}
 
+Verification and offline installation
+
+VerifyDeps and ReportMissingDeps check that the binaries listed in a
+PackageRequirements map are present without installing anything, which is
+useful in change-controlled environments where packages are managed by other
+means. ReportMissingDeps writes the missing dependencies as a JSON array so
+that the result can be consumed by deployment tooling, e.g.,
+
+	[
+		{
+			"distro": "fedora",
+			"binary": "/usr/bin/qemu-img",
+			"package": "qemu-img"
+		}
+	]
+
+InstallDepsFromDir installs the missing packages from a local directory of
+package files (or, on Clear Linux, a local mirror of the update content)
+rather than from the network, for use on air-gapped hosts. Ciao components
+expose these modes through their -osprepare-verify and -osprepare-pkgdir
+flags.
+
 Operating System Identification
 
 Operating Systems are identified via their `os-release` file, a standardized
 mechanism for identifying Linux distributions. Currently, detection is performed
 by comparison the lower-case value of the `ID` field to our known implementations,
-which are:
+falling back to the entries of the `ID_LIKE` field when the `ID` is not known.
+The supported distributions, and the keys used for them in PackageRequirements,
+are:
 
  * clearlinux
  * ubuntu
  * fedora
+ * centos (also used for RHEL and other ID_LIKE="rhel" derivatives)
+ * debian
+ * opensuse (also used for SLES)
 
 */
 package osprepare
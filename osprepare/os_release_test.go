@@ -48,3 +48,39 @@ func TestParseReleaseFileNonExistent(t *testing.T) {
 		t.Fatalf("Expected nil, got %v\n", res)
 	}
 }
+
+func TestDistroFromRelease(t *testing.T) {
+	tests := []struct {
+		id     string
+		idLike string
+		distro string
+	}{
+		{"clear-linux-os", "", "clearlinux"},
+		{"ubuntu", "debian", "ubuntu"},
+		{"fedora", "", "fedora"},
+		{"centos", "rhel fedora", "centos"},
+		{"rhel", "fedora", "centos"},
+		{"scientific", "rhel centos fedora", "centos"},
+		{"debian", "", "debian"},
+		{"opensuse-leap", "suse opensuse", "opensuse"},
+		{"sles", "suse", "opensuse"},
+		{"gentoo", "", ""},
+	}
+
+	for _, test := range tests {
+		r := &osRelease{
+			ID:      test.id,
+			mapping: map[string]string{"id": test.id, "id_like": test.idLike},
+		}
+		d := distroFromRelease(r)
+		if d == nil {
+			if test.distro != "" {
+				t.Errorf("%s not detected, expected %s", test.id, test.distro)
+			}
+			continue
+		}
+		if d.getID() != test.distro {
+			t.Errorf("%s detected as %s, expected %s", test.id, d.getID(), test.distro)
+		}
+	}
+}
@@ -18,6 +18,9 @@ package osprepare
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/ciao-project/ciao/clogger"
@@ -31,10 +34,13 @@ const (
 
 // PackageRequirement contains the BinaryName expected to
 // exist on the filesystem once PackageName is installed
-// (e.g: { '/usr/bin/qemu-system-x86_64', 'qemu'})
+// (e.g: { '/usr/bin/qemu-system-x86_64', 'qemu'}).  If MinVersion
+// is set the version reported by BinaryName --version must be at
+// least MinVersion.
 type PackageRequirement struct {
 	BinaryName  string
 	PackageName string
+	MinVersion  string
 }
 
 // PackageRequirements type allows to create complex
@@ -43,10 +49,10 @@ type PackageRequirement struct {
 // (e.g:
 //
 //	"ubuntu": {
-//		{"/usr/bin/docker", "docker"},
+//		{BinaryName: "/usr/bin/docker", PackageName: "docker"},
 //	},
 //	"clearlinux": {
-//		{"/usr/bin/docker", "containers-basic"},
+//		{BinaryName: "/usr/bin/docker", PackageName: "containers-basic"},
 //	},
 // )
 type PackageRequirements map[string][]PackageRequirement
@@ -83,21 +89,30 @@ func (cur *PackageRequirements) Append(newReqs PackageRequirements) {
 // functionality across all Ciao components
 var BootstrapRequirements = PackageRequirements{
 	"ubuntu": {
-		{"/usr/bin/ceph", "ceph-common"},
+		{BinaryName: "/usr/bin/ceph", PackageName: "ceph-common"},
 	},
 	"fedora": {
-		{"/usr/bin/ceph", "ceph-common"},
+		{BinaryName: "/usr/bin/ceph", PackageName: "ceph-common"},
 	},
 	"clearlinux": {
-		{"/usr/bin/ceph", "storage-cluster"},
+		{BinaryName: "/usr/bin/ceph", PackageName: "storage-cluster"},
+	},
+	"centos": {
+		{BinaryName: "/usr/bin/ceph", PackageName: "ceph-common"},
+	},
+	"debian": {
+		{BinaryName: "/usr/bin/ceph", PackageName: "ceph-common"},
+	},
+	"opensuse": {
+		{BinaryName: "/usr/bin/ceph", PackageName: "ceph-common"},
 	},
 }
 
-// CollectPackages returns a list of non-installed packages from
-// the PackageRequirements received
-func collectPackages(dist distro, reqs PackageRequirements) []string {
+// missingRequirements returns the PackageRequirement entries of reqs
+// for the given distro whose BinaryName does not exist
+func missingRequirements(dist distro, reqs PackageRequirements) []PackageRequirement {
 	// For now just support keys like "ubuntu" vs "ubuntu:16.04"
-	var pkgsMissing []string
+	var missing []PackageRequirement
 	if reqs == nil {
 		return nil
 	}
@@ -114,17 +129,92 @@ func collectPackages(dist distro, reqs PackageRequirements) []string {
 			if pathExists(pkg.BinaryName) {
 				continue
 			}
-			// Mark the package for installation
-			pkgsMissing = append(pkgsMissing, pkg.PackageName)
+			missing = append(missing, pkg)
 		}
-		return pkgsMissing
+		return missing
 	}
 	return nil
 }
 
-// InstallDeps installs all the dependencies defined in a component
-// specific PackageRequirements in order to enable running the component
-func InstallDeps(ctx context.Context, reqs PackageRequirements, logger clogger.CiaoLog) {
+// CollectPackages returns a list of non-installed packages from
+// the PackageRequirements received
+func collectPackages(dist distro, reqs PackageRequirements) []string {
+	var pkgsMissing []string
+
+	for _, pkg := range missingRequirements(dist, reqs) {
+		// Mark the package for installation
+		pkgsMissing = append(pkgsMissing, pkg.PackageName)
+	}
+	return pkgsMissing
+}
+
+// MissingDependency describes a required binary which is not present
+// on the host, or is older than the required version, along with the
+// package that provides it
+type MissingDependency struct {
+	Distro           string `json:"distro"`
+	BinaryName       string `json:"binary"`
+	PackageName      string `json:"package"`
+	MinVersion       string `json:"min_version,omitempty"`
+	InstalledVersion string `json:"installed_version,omitempty"`
+}
+
+// VerifyDeps checks that all the binaries listed in reqs for the host
+// distro exist and satisfy their MinVersion, without installing anything,
+// and returns those that do not.  An error is returned if the host distro
+// is not supported.
+func VerifyDeps(reqs PackageRequirements) ([]MissingDependency, error) {
+	distro := getDistro()
+	if distro == nil {
+		return nil, fmt.Errorf("Running on an unsupported distro")
+	}
+
+	missing := []MissingDependency{}
+	for _, pkg := range missingRequirements(distro, reqs) {
+		missing = append(missing, MissingDependency{
+			Distro:      distro.getID(),
+			BinaryName:  pkg.BinaryName,
+			PackageName: pkg.PackageName,
+			MinVersion:  pkg.MinVersion,
+		})
+	}
+	for _, pkg := range outdatedRequirements(context.Background(), distro, reqs) {
+		missing = append(missing, MissingDependency{
+			Distro:           distro.getID(),
+			BinaryName:       pkg.BinaryName,
+			PackageName:      pkg.PackageName,
+			MinVersion:       pkg.MinVersion,
+			InstalledVersion: pkg.installedVersion,
+		})
+	}
+	return missing, nil
+}
+
+// ReportMissingDeps writes the dependencies of reqs missing on the host
+// to w as a JSON array of MissingDependency objects.  An error is returned
+// if some dependencies are missing or if the host distro is not supported.
+func ReportMissingDeps(w io.Writer, reqs PackageRequirements) error {
+	missing, err := VerifyDeps(reqs)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(missing)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%d dependencies missing", len(missing))
+	}
+	return nil
+}
+
+type installFunc func(ctx context.Context, d distro, packages []string, logger clogger.CiaoLog) bool
+
+func installDeps(ctx context.Context, reqs PackageRequirements, logger clogger.CiaoLog, install installFunc) error {
 	if logger == nil {
 		logger = clogger.CiaoNullLogger{}
 	}
@@ -138,26 +228,73 @@ func InstallDeps(ctx context.Context, reqs PackageRequirements, logger clogger.C
 		} else {
 			logger.Errorf("No os-release found on this host")
 		}
-		return
+		return fmt.Errorf("Running on an unsupported distro")
 	}
 	logger.Infof("OS Detected: %s", distro.getID())
 
+	return installDistroDeps(ctx, distro, reqs, logger, install)
+}
+
+// installDistroDeps installs the packages of reqs missing on distro and
+// returns an error if they cannot be installed or if some of the installed
+// packages are older than their MinVersion, as upgrading them is left to
+// the administrator.
+func installDistroDeps(ctx context.Context, distro distro, reqs PackageRequirements, logger clogger.CiaoLog, install installFunc) error {
 	// Nothing requested to install
 	if reqs == nil {
-		return
+		return nil
 	}
 	if reqPkgs := collectPackages(distro, reqs); reqPkgs != nil {
 		logger.Infof("Missing packages detected: %v", reqPkgs)
-		if distro.InstallPackages(ctx, reqPkgs, logger) == false {
+		if install(ctx, distro, reqPkgs, logger) == false {
 			logger.Errorf("Failed to install: %s", strings.Join(reqPkgs, ", "))
-			return
+			return fmt.Errorf("Failed to install: %s", strings.Join(reqPkgs, ", "))
 		}
 		logger.Infof("Missing packages installed.")
 	}
+
+	// Installed packages, whether installed now or previously, must
+	// also be recent enough
+	outdated := outdatedRequirements(ctx, distro, reqs)
+	for _, pkg := range outdated {
+		logger.Errorf("%s", pkg)
+	}
+	if len(outdated) > 0 {
+		return fmt.Errorf("%d packages older than required", len(outdated))
+	}
+
+	return nil
+}
+
+// InstallDeps installs all the dependencies defined in a component
+// specific PackageRequirements in order to enable running the component.
+// An error is returned if the dependencies cannot be installed or if some
+// of them are installed but outdated.
+func InstallDeps(ctx context.Context, reqs PackageRequirements, logger clogger.CiaoLog) error {
+	return installDeps(ctx, reqs, logger,
+		func(ctx context.Context, d distro, packages []string, logger clogger.CiaoLog) bool {
+			return d.InstallPackages(ctx, packages, logger)
+		})
+}
+
+// InstallDepsFromDir behaves like InstallDeps but installs the missing
+// packages from the local package directory dir rather than from the
+// network, for use on hosts with no access to the distro repositories
+func InstallDepsFromDir(ctx context.Context, reqs PackageRequirements, dir string, logger clogger.CiaoLog) error {
+	return installDeps(ctx, reqs, logger,
+		func(ctx context.Context, d distro, packages []string, logger clogger.CiaoLog) bool {
+			return d.installLocalPackages(ctx, dir, packages, logger)
+		})
 }
 
 // Bootstrap installs all the core dependencies required to bootstrap the core
 // configuration of all Ciao components
-func Bootstrap(ctx context.Context, logger clogger.CiaoLog) {
-	InstallDeps(ctx, BootstrapRequirements, logger)
+func Bootstrap(ctx context.Context, logger clogger.CiaoLog) error {
+	return InstallDeps(ctx, BootstrapRequirements, logger)
+}
+
+// BootstrapFromDir installs the core dependencies from the local package
+// directory dir
+func BootstrapFromDir(ctx context.Context, dir string, logger clogger.CiaoLog) error {
+	return InstallDepsFromDir(ctx, BootstrapRequirements, dir, logger)
 }
@@ -0,0 +1,116 @@
+//
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package osprepare
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionRegexp = regexp.MustCompile(`[0-9]+(\.[0-9]+)+`)
+
+// binaryVersion runs binary --version and returns the first dotted
+// version number found in its output, e.g., "2.9.0" for
+// "QEMU emulator version 2.9.0".
+func binaryVersion(ctx context.Context, binary string) (string, error) {
+	out, err := exec.CommandContext(ctx, binary, "--version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("Unable to run %s --version: %v", binary, err)
+	}
+
+	version := versionRegexp.FindString(string(out))
+	if version == "" {
+		return "", fmt.Errorf("No version found in output of %s --version", binary)
+	}
+
+	return version, nil
+}
+
+// compareVersions compares two dotted version numbers component by
+// component, returning -1, 0 or 1 if a is older than, equal to or newer
+// than b.  Missing components are treated as 0 and any non numeric
+// suffix of a component, e.g., "-ce", is ignored.
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an = versionComponent(as[i])
+		}
+		if i < len(bs) {
+			bn = versionComponent(bs[i])
+		}
+
+		if an < bn {
+			return -1
+		} else if an > bn {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func versionComponent(c string) int {
+	end := strings.IndexFunc(c, func(r rune) bool { return r < '0' || r > '9' })
+	if end != -1 {
+		c = c[:end]
+	}
+	n, _ := strconv.Atoi(c)
+	return n
+}
+
+type outdatedRequirement struct {
+	PackageRequirement
+	installedVersion string
+}
+
+// outdatedRequirements returns the PackageRequirement entries of reqs for
+// the given distro whose BinaryName exists but whose version is older than
+// MinVersion.  A requirement whose version cannot be determined is reported
+// as outdated with an empty installedVersion.
+func outdatedRequirements(ctx context.Context, dist distro, reqs PackageRequirements) []outdatedRequirement {
+	var outdated []outdatedRequirement
+
+	for _, pkg := range reqs[dist.getID()] {
+		if pkg.BinaryName == "" || pkg.MinVersion == "" || !pathExists(pkg.BinaryName) {
+			continue
+		}
+
+		version, err := binaryVersion(ctx, pkg.BinaryName)
+		if err != nil || compareVersions(version, pkg.MinVersion) < 0 {
+			outdated = append(outdated, outdatedRequirement{pkg, version})
+		}
+	}
+
+	return outdated
+}
+
+func (o outdatedRequirement) String() string {
+	installed := o.installedVersion
+	if installed == "" {
+		installed = "unknown"
+	}
+	return fmt.Sprintf("%s version %s is older than the required %s, upgrade package %s",
+		o.BinaryName, installed, o.MinVersion, o.PackageName)
+}
@@ -0,0 +1,155 @@
+//
+// Copyright © 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package osprepare
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ciao-project/ciao/clogger"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.5.0", "2.5.0", 0},
+		{"2.5", "2.5.0", 0},
+		{"2.4.1", "2.5.0", -1},
+		{"2.10.0", "2.9.0", 1},
+		{"17.05.0-ce", "1.11.0", 1},
+		{"1.10.3", "1.11.0", -1},
+	}
+
+	for _, test := range tests {
+		if r := compareVersions(test.a, test.b); r != test.expected {
+			t.Errorf("compareVersions(%s, %s) = %d, expected %d", test.a, test.b, r, test.expected)
+		}
+	}
+}
+
+type versionTestDistro struct{}
+
+func (d versionTestDistro) InstallPackages(ctx context.Context, packages []string, logger clogger.CiaoLog) bool {
+	return true
+}
+
+func (d versionTestDistro) installLocalPackages(ctx context.Context, dir string, packages []string, logger clogger.CiaoLog) bool {
+	return true
+}
+
+func (d versionTestDistro) getID() string {
+	return "test"
+}
+
+func writeVersionScript(t *testing.T, dir, name, output string) string {
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\necho \"" + output + "\"\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOutdatedRequirements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osprepare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	qemu := writeVersionScript(t, dir, "qemu", "QEMU emulator version 2.4.1, Copyright (c) 2003-2008")
+	docker := writeVersionScript(t, dir, "docker", "Docker version 17.05.0-ce, build 89658be")
+	broken := writeVersionScript(t, dir, "broken", "no version here")
+
+	if v, err := binaryVersion(context.Background(), qemu); err != nil || v != "2.4.1" {
+		t.Fatalf("Unexpected qemu version %s: %v", v, err)
+	}
+
+	reqs := PackageRequirements{
+		"test": {
+			{BinaryName: qemu, PackageName: "qemu", MinVersion: MinQemuVersion},
+			{BinaryName: docker, PackageName: "docker", MinVersion: MinDockerVersion},
+			{BinaryName: broken, PackageName: "broken", MinVersion: "1.0"},
+			{BinaryName: broken, PackageName: "broken"},
+			{BinaryName: nonExistentFile, PackageName: "missing", MinVersion: "1.0"},
+		},
+	}
+
+	outdated := outdatedRequirements(context.Background(), versionTestDistro{}, reqs)
+	if len(outdated) != 2 {
+		t.Fatalf("Expected 2 outdated requirements, got %v", outdated)
+	}
+	if outdated[0].PackageName != "qemu" || outdated[0].installedVersion != "2.4.1" {
+		t.Errorf("Unexpected outdated requirement %v", outdated[0])
+	}
+	if outdated[1].PackageName != "broken" || outdated[1].installedVersion != "" {
+		t.Errorf("Unexpected outdated requirement %v", outdated[1])
+	}
+}
+
+func TestInstallOutdatedDeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osprepare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	qemu := writeVersionScript(t, dir, "qemu", "QEMU emulator version 2.4.1, Copyright (c) 2003-2008")
+	docker := writeVersionScript(t, dir, "docker", "Docker version 17.05.0-ce, build 89658be")
+
+	install := func(ctx context.Context, d distro, packages []string, logger clogger.CiaoLog) bool {
+		return true
+	}
+
+	reqs := PackageRequirements{
+		"test": {
+			{BinaryName: docker, PackageName: "docker", MinVersion: MinDockerVersion},
+		},
+	}
+	err = installDistroDeps(context.Background(), versionTestDistro{}, reqs, clogger.CiaoNullLogger{}, install)
+	if err != nil {
+		t.Fatalf("Up to date dependencies reported as error: %v", err)
+	}
+
+	reqs["test"] = append(reqs["test"],
+		PackageRequirement{BinaryName: qemu, PackageName: "qemu", MinVersion: MinQemuVersion})
+	err = installDistroDeps(context.Background(), versionTestDistro{}, reqs, clogger.CiaoNullLogger{}, install)
+	if err == nil {
+		t.Fatal("Outdated dependencies not reported as error")
+	}
+}
+
+func TestInstallDepsFailure(t *testing.T) {
+	install := func(ctx context.Context, d distro, packages []string, logger clogger.CiaoLog) bool {
+		return false
+	}
+
+	reqs := PackageRequirements{
+		"test": {
+			{BinaryName: nonExistentFile, PackageName: "missing"},
+		},
+	}
+	err := installDistroDeps(context.Background(), versionTestDistro{}, reqs, clogger.CiaoNullLogger{}, install)
+	if err == nil {
+		t.Fatal("Failed installation not reported as error")
+	}
+}
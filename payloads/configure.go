@@ -44,6 +44,7 @@ type ConfigureScheduler struct {
 // controller service.
 type ConfigureController struct {
 	CiaoPort             int    `yaml:"ciao_port"`
+	CiaoBindAddress      string `yaml:"ciao_bind_address"`
 	HTTPSCACert          string `yaml:"compute_ca"`
 	HTTPSKey             string `yaml:"compute_cert"`
 	CNCIVcpus            int    `yaml:"cnci_vcpus"`
@@ -62,6 +63,8 @@ type ConfigureLauncher struct {
 	DiskLimit         bool     `yaml:"disk_limit"`
 	MemoryLimit       bool     `yaml:"mem_limit"`
 	ChildUser         string   `yaml:"child_user"`
+	StatsInterval     int      `yaml:"stats_interval"`
+	StatsDelta        bool     `yaml:"stats_delta"`
 }
 
 // ConfigureStorage contains the unmarshalled configurations for the
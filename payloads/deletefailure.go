@@ -48,6 +48,9 @@ type ErrorDeleteFailure struct {
 	// Reason provides the reason for the delete failure, e.g.,
 	// DeleteNoInstance.
 	Reason DeleteFailureReason `yaml:"reason"`
+
+	// RequestID is the request ID of the DELETE command that failed.
+	RequestID string `yaml:"request_id,omitempty"`
 }
 
 func (r DeleteFailureReason) String() string {
@@ -0,0 +1,89 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// InstanceLogReason identifies the kind of incident reported by an
+// InstanceLog event.
+type InstanceLogReason string
+
+const (
+	// InstanceExited is reported when an instance exits without having
+	// been asked to.
+	InstanceExited InstanceLogReason = "instance_exited"
+
+	// InstanceOOMKilled is reported when an instance is killed by the
+	// kernel's out of memory killer.
+	InstanceOOMKilled InstanceLogReason = "oom_killed"
+
+	// ImageFetchFailure is reported when the backing image of an
+	// instance cannot be retrieved.
+	ImageFetchFailure InstanceLogReason = "image_fetch_failure"
+
+	// InstanceCrashed is reported when the hypervisor process of an
+	// instance or its guest crashes.  The event carries a crash report.
+	InstanceCrashed InstanceLogReason = "instance_crashed"
+)
+
+func (r InstanceLogReason) String() string {
+	switch r {
+	case InstanceExited:
+		return "exited unexpectedly"
+	case InstanceOOMKilled:
+		return "was killed by the OOM killer"
+	case ImageFetchFailure:
+		return "failed to fetch its image"
+	case InstanceCrashed:
+		return "crashed"
+	}
+
+	return ""
+}
+
+// InstanceCrash describes the artifacts collected by a launcher when an
+// instance crashes, for postmortem debugging.
+type InstanceCrash struct {
+	// ExitStatus describes how the hypervisor process terminated.
+	ExitStatus string `yaml:"exit_status"`
+
+	// Stderr is the tail of the standard error of the hypervisor process.
+	Stderr string `yaml:"stderr,omitempty"`
+
+	// Artifacts is the directory on the node in which the crash
+	// artifacts are stored.
+	Artifacts string `yaml:"artifacts"`
+
+	// MemoryDump is true if a dump of the guest memory is stored in
+	// Artifacts.
+	MemoryDump bool `yaml:"memory_dump,omitempty"`
+}
+
+// InstanceLogEvent describes an incident that has occurred during the
+// lifetime of an instance.
+type InstanceLogEvent struct {
+	InstanceUUID string            `yaml:"instance_uuid"`
+	Reason       InstanceLogReason `yaml:"reason"`
+	Message      string            `yaml:"message"`
+	Crash        *InstanceCrash    `yaml:"crash,omitempty"`
+}
+
+// EventInstanceLog represents the unmarshalled version of the contents of an
+// SSNTP ssntp.InstanceLog event.  This event is sent by ciao-launcher when
+// something significant happens to an instance, so that the controller can
+// record it in the instance tenant's event log.
+type EventInstanceLog struct {
+	InstanceLog InstanceLogEvent `yaml:"instance_log"`
+}
@@ -0,0 +1,91 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/ciao-project/ciao/payloads"
+	"github.com/ciao-project/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestInstanceLogUnmarshal(t *testing.T) {
+	var insLog EventInstanceLog
+	err := yaml.Unmarshal([]byte(testutil.InsLogYaml), &insLog)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if insLog.InstanceLog.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", insLog.InstanceLog.InstanceUUID)
+	}
+
+	if insLog.InstanceLog.Reason != InstanceOOMKilled {
+		t.Errorf("Wrong reason field [%s]", insLog.InstanceLog.Reason)
+	}
+
+	if insLog.InstanceLog.Message != "qemu killed by the OOM killer" {
+		t.Errorf("Wrong message field [%s]", insLog.InstanceLog.Message)
+	}
+}
+
+func TestInstanceLogMarshal(t *testing.T) {
+	var insLog EventInstanceLog
+
+	insLog.InstanceLog.InstanceUUID = testutil.InstanceUUID
+	insLog.InstanceLog.Reason = InstanceOOMKilled
+	insLog.InstanceLog.Message = "qemu killed by the OOM killer"
+
+	y, err := yaml.Marshal(&insLog)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.InsLogYaml {
+		t.Errorf("InstanceLog marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.InsLogYaml)
+	}
+}
+
+func TestInstanceLogCrashMarshal(t *testing.T) {
+	var insLog EventInstanceLog
+
+	insLog.InstanceLog.InstanceUUID = testutil.InstanceUUID
+	insLog.InstanceLog.Reason = InstanceCrashed
+	insLog.InstanceLog.Message = "qemu process was killed by SIGSEGV"
+	insLog.InstanceLog.Crash = &InstanceCrash{
+		ExitStatus: "killed by SIGSEGV",
+		Stderr:     "qemu: internal error",
+		Artifacts:  "/var/lib/ciao/crashes/" + testutil.InstanceUUID + "/20170612T101323Z",
+		MemoryDump: true,
+	}
+
+	y, err := yaml.Marshal(&insLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var crashLog EventInstanceLog
+	err = yaml.Unmarshal(y, &crashLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if crashLog.InstanceLog.Crash == nil || *crashLog.InstanceLog.Crash != *insLog.InstanceLog.Crash {
+		t.Errorf("Crash report not preserved, got %+v", crashLog.InstanceLog.Crash)
+	}
+}
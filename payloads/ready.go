@@ -52,6 +52,21 @@ type Ready struct {
 	// Hostname of the CN/NN
 	NodeHostName string `yaml:"hostname"`
 
+	// Disk IOPS capacity of the CN/NN, 0 if the CN/NN does not limit the
+	// disk IOPS reserved by its instances.
+	DiskIOPSTotal int `yaml:"disk_iops_total,omitempty"`
+
+	// Disk IOPS of the CN/NN not yet reserved by its instances.
+	DiskIOPSAvailable int `yaml:"disk_iops_available,omitempty"`
+
+	// Network bandwidth capacity of the CN/NN in Mbit/s, 0 if the CN/NN
+	// does not limit the bandwidth reserved by its instances.
+	NetBandwidthTotalMbps int `yaml:"net_bandwidth_total_mbps,omitempty"`
+
+	// Network bandwidth of the CN/NN in Mbit/s not yet reserved by its
+	// instances.
+	NetBandwidthAvailableMbps int `yaml:"net_bandwidth_available_mbps,omitempty"`
+
 	// Any changes to this struct should be accompanied by a change to
 	// the ciao-scheduler/scheduler.go:updateNodeStat() function
 }
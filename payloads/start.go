@@ -205,6 +205,24 @@ type WorkloadRequirements struct {
 	// Privileged indicates that this container workload should be run with increased
 	// permissions
 	Privileged bool `yaml:"privileged,omitempty"`
+
+	// DisableNetMultiQueue indicates that the network interface of this
+	// VM workload should have a single queue rather than one per VCPU
+	DisableNetMultiQueue bool `yaml:"disable_net_multiqueue,omitempty"`
+
+	// DiskIOPS specifies the disk I/O operations per second reserved for
+	// this workload
+	DiskIOPS int `yaml:"disk_iops,omitempty"`
+
+	// NetBandwidthMbps specifies the network bandwidth in Mbit/s reserved
+	// for this workload
+	NetBandwidthMbps int `yaml:"net_bandwidth_mbps,omitempty"`
+
+	// ExtraSpecs holds arbitrary key value pairs, e.g.,
+	// hw:cpu_policy=dedicated, that are passed through unchanged to the
+	// scheduler and the launcher.  Keys are namespaced by a prefix
+	// separated from the rest of the key by a colon.
+	ExtraSpecs map[string]string `yaml:"extra_specs,omitempty"`
 }
 
 // StartCmd contains the information needed to start a new instance.
@@ -246,6 +264,15 @@ type StartCmd struct {
 	// Restart is set to true if the payload represents a request to
 	// restart an existing instance on a new node.
 	Restart bool
+
+	// ExcludeNodeID specifies a node the instance must not be scheduled
+	// on, e.g., the node an instance is migrated from.
+	ExcludeNodeID string `yaml:"exclude_node_id,omitempty"`
+
+	// RequestID identifies the API request that caused the instance to
+	// be started.  It is empty if the command was not sent in response
+	// to an API request.
+	RequestID string `yaml:"request_id,omitempty"`
 }
 
 // Start represents the unmarshalled version of the contents of a SSNTP START
@@ -100,6 +100,9 @@ type ErrorStartFailure struct {
 	// Restart is true if the failed start command was attempting to
 	// restart an existing instance.
 	Restart bool
+
+	// RequestID is the request ID of the START command that failed.
+	RequestID string `yaml:"request_id,omitempty"`
 }
 
 func (r StartFailureReason) String() string {
@@ -52,6 +52,46 @@ type InstanceStat struct {
 
 	// List of volumes attached to the instance.
 	Volumes []string `yaml:"volumes"`
+
+	// Number of bytes received by the instance's network interface.
+	// The network and block I/O counters are cumulative, they are reset
+	// when the instance is restarted.  They are -1 if not known.
+	NetRxBytes int64 `yaml:"net_rx_bytes"`
+
+	// Number of bytes transmitted by the instance's network interface.
+	NetTxBytes int64 `yaml:"net_tx_bytes"`
+
+	// Number of packets received by the instance's network interface.
+	NetRxPackets int64 `yaml:"net_rx_packets"`
+
+	// Number of packets transmitted by the instance's network interface.
+	NetTxPackets int64 `yaml:"net_tx_packets"`
+
+	// Number of bytes read from block devices by the instance.
+	BlockReadBytes int64 `yaml:"block_read_bytes"`
+
+	// Number of bytes written to block devices by the instance.
+	BlockWriteBytes int64 `yaml:"block_write_bytes"`
+
+	// Number of connections of the instance's network interface tracked
+	// by the node.  -1 if not known.
+	Connections int `yaml:"connections"`
+
+	// Peers the instance exchanged the most traffic with, busiest first.
+	TopTalkers []TopTalker `yaml:"top_talkers,omitempty"`
+}
+
+// TopTalker describes the traffic between an instance and one of its peers.
+type TopTalker struct {
+	// IP address of the peer
+	IP string `yaml:"ip"`
+
+	// Number of connections between the instance and the peer
+	Connections int `yaml:"connections"`
+
+	// Number of bytes exchanged with the peer in both directions.  0 if
+	// connection tracking accounting is disabled on the node.
+	Bytes int64 `yaml:"bytes"`
 }
 
 // NetworkStat contains information about a single network interface present on
@@ -102,6 +142,13 @@ type Stat struct {
 	// Array containing statistics information for each instance hosted by
 	// the CN/NN
 	Instances []InstanceStat
+
+	// Delta is true if Instances only contains the instances whose
+	// statistics have changed since the previous STATS frame sent by the
+	// CN/NN.  The statistics of the instances that are not listed are
+	// unchanged.  If Delta is false Instances lists all the instances
+	// hosted by the CN/NN.
+	Delta bool `yaml:"delta,omitempty"`
 }
 
 const (
@@ -30,6 +30,11 @@ type StopCmd struct {
 	// In this case the delete command should only delete the instance from
 	// the node to which it is sent and not the entire cluster.
 	Stop bool
+
+	// RequestID identifies the API request that caused the instance to
+	// be stopped or deleted.  It is empty if the command was not sent
+	// in response to an API request.
+	RequestID string `yaml:"request_id,omitempty"`
 }
 
 // Stop represents the unmarshalled version of the contents of a SSNTP STOP
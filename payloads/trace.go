@@ -33,6 +33,7 @@ type FrameTrace struct {
 	Operand        string `yaml:"operand"`
 	StartTimestamp string `yaml:"start_timestamp"`
 	EndTimestamp   string `yaml:"end_timestamp"`
+	InstanceUUID   string `yaml:"instance_uuid,omitempty"`
 	Nodes          []SSNTPNode
 }
 
@@ -29,6 +29,14 @@ const PrivKey key = 0
 // tenant id which is being used in the API call
 const TenantIDKey key = 1
 
+// UserKey is the index of the context map which identifies the user
+// making the API call
+const UserKey key = 2
+
+// RequestIDKey is the index of the context map which holds the ID used
+// to correlate the log entries of an API call across services
+const RequestIDKey key = 3
+
 // GetPrivilege returns the value of PrivKey
 func GetPrivilege(ctx context.Context) bool {
 	privilege, ok := ctx.Value(PrivKey).(bool)
@@ -53,3 +61,27 @@ func GetTenantID(ctx context.Context) (string, error) {
 func SetTenantID(ctx context.Context, tenantID string) context.Context {
 	return context.WithValue(ctx, TenantIDKey, tenantID)
 }
+
+// GetUser returns the value of UserKey or the empty string if the user
+// is not known
+func GetUser(ctx context.Context) string {
+	user, _ := ctx.Value(UserKey).(string)
+	return user
+}
+
+// SetUser sets the value of UserKey
+func SetUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, UserKey, user)
+}
+
+// GetRequestID returns the value of RequestIDKey or the empty string if
+// the request has no ID
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(RequestIDKey).(string)
+	return requestID
+}
+
+// SetRequestID sets the value of RequestIDKey
+func SetRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, requestID)
+}
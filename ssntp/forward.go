@@ -266,16 +266,23 @@ func forwardDestination(destination ForwardDestination, server *Server, frame *F
 		return
 	}
 
+	var disconnected []string
+
 	server.sessionMutex.RLock()
 	for _, uuid := range destination.recipientUUIDs {
 		session := server.sessions[uuid]
 		if session == nil {
+			disconnected = append(disconnected, uuid)
 			continue
 		}
 
 		session.Write(frame)
 	}
 	server.sessionMutex.RUnlock()
+
+	for _, uuid := range disconnected {
+		server.queueFrame(uuid, frame)
+	}
 }
 
 func commandForward(uuid string, f CommandForwarder, cmd Command, server *Server, frame *Frame) {
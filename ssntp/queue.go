@@ -0,0 +1,271 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssntp
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ciao-project/ciao/uuid"
+)
+
+const defaultQueueTTL = time.Hour
+
+// queuedFrame is a command frame waiting for its recipient to reconnect.
+type queuedFrame struct {
+	Frame   Frame
+	Expires time.Time
+}
+
+// commandQueue stores the commands destined to disconnected clients.  The
+// commands of each client are stored in their own file, named after the
+// client UUID, so that they survive a restart of the server.
+type commandQueue struct {
+	sync.Mutex
+	path string
+	ttl  time.Duration
+	log  Logger
+}
+
+func newCommandQueue(config *QueueConfig, log Logger) (*commandQueue, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("Missing command queue path")
+	}
+
+	if err := os.MkdirAll(config.Path, 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create command queue %s: %v", config.Path, err)
+	}
+
+	q := &commandQueue{
+		path: config.Path,
+		ttl:  config.TTL,
+		log:  log,
+	}
+	if q.ttl <= 0 {
+		q.ttl = defaultQueueTTL
+	}
+
+	q.prune()
+
+	return q, nil
+}
+
+func (q *commandQueue) file(dest string) (string, error) {
+	// The UUID is used as a file name so it must not be able to
+	// escape the queue directory.
+	if _, err := uuid.Parse(dest); err != nil {
+		return "", fmt.Errorf("Invalid recipient %s: %v", dest, err)
+	}
+
+	return filepath.Join(q.path, dest), nil
+}
+
+func (q *commandQueue) load(file string) ([]queuedFrame, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var frames []queuedFrame
+	if err := gob.NewDecoder(f).Decode(&frames); err != nil {
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+func (q *commandQueue) store(file string, frames []queuedFrame) error {
+	if len(frames) == 0 {
+		err := os.Remove(file)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	f, err := ioutil.TempFile(q.path, ".queue")
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(f).Encode(frames)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+
+	return err
+}
+
+func unexpired(frames []queuedFrame, now time.Time) []queuedFrame {
+	var live []queuedFrame
+	for _, f := range frames {
+		if now.Before(f.Expires) {
+			live = append(live, f)
+		}
+	}
+
+	return live
+}
+
+// push queues a command frame for the client identified by dest.
+func (q *commandQueue) push(dest string, frame *Frame) error {
+	file, err := q.file(dest)
+	if err != nil {
+		return err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	frames, err := q.load(file)
+	if err != nil {
+		q.log.Errorf("Discarding corrupted command queue of %s: %v\n", dest, err)
+	}
+
+	now := time.Now()
+	frames = append(unexpired(frames, now), queuedFrame{
+		Frame:   *frame,
+		Expires: now.Add(q.ttl),
+	})
+
+	return q.store(file, frames)
+}
+
+// pop removes and returns the unexpired command frames queued for the
+// client identified by dest, oldest first.
+func (q *commandQueue) pop(dest string) ([]*Frame, error) {
+	file, err := q.file(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	frames, err := q.load(file)
+	if rmErr := q.store(file, nil); err == nil {
+		err = rmErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Frame
+	for _, f := range unexpired(frames, time.Now()) {
+		frame := f.Frame
+		pending = append(pending, &frame)
+	}
+
+	return pending, nil
+}
+
+// prune discards the expired commands of all the clients.
+func (q *commandQueue) prune() {
+	q.Lock()
+	defer q.Unlock()
+
+	files, err := ioutil.ReadDir(q.path)
+	if err != nil {
+		q.log.Errorf("Unable to read command queue %s: %v\n", q.path, err)
+		return
+	}
+
+	now := time.Now()
+	for _, fi := range files {
+		file := filepath.Join(q.path, fi.Name())
+		if _, err := uuid.Parse(fi.Name()); err != nil {
+			continue
+		}
+
+		frames, err := q.load(file)
+		if err != nil {
+			q.log.Errorf("Discarding corrupted command queue %s: %v\n", file, err)
+		}
+
+		if err := q.store(file, unexpired(frames, now)); err != nil {
+			q.log.Errorf("Unable to prune command queue %s: %v\n", file, err)
+		}
+	}
+}
+
+// queueFrame stores a command frame forwarded to a disconnected client.
+// Only commands are queued, statuses, events and errors describe the state
+// of the cluster at the time they are sent and would be stale on delivery.
+func (server *Server) queueFrame(dest string, frame *Frame) {
+	if server.queue == nil || frame.Type != COMMAND {
+		return
+	}
+
+	if err := server.queue.push(dest, frame); err != nil {
+		server.log.Errorf("Unable to queue %s for %s: %v\n", (Command)(frame.Operand), dest, err)
+		return
+	}
+
+	server.log.Infof("Queued %s for disconnected client %s\n", (Command)(frame.Operand), dest)
+
+	// The client may have reconnected while the command was being queued
+	if session := server.getSession(dest); session != nil {
+		server.deliverQueuedFrames(session)
+	}
+}
+
+// deliverQueuedFrames sends the commands queued while a client was
+// disconnected.
+func (server *Server) deliverQueuedFrames(session *session) {
+	if server.queue == nil {
+		return
+	}
+
+	dest := session.dest.String()
+	frames, err := server.queue.pop(dest)
+	if err != nil {
+		server.log.Errorf("Unable to retrieve queued commands of %s: %v\n", dest, err)
+		return
+	}
+
+	for i, frame := range frames {
+		server.log.Infof("Delivering queued %s to %s\n", (Command)(frame.Operand), dest)
+		if _, err := session.Write(frame); err != nil {
+			server.log.Errorf("Unable to deliver queued %s to %s: %v\n", (Command)(frame.Operand), dest, err)
+
+			// Keep the undelivered commands for the next connection
+			for _, f := range frames[i:] {
+				if err := server.queue.push(dest, f); err != nil {
+					server.log.Errorf("Unable to queue %s for %s: %v\n", (Command)(f.Operand), dest, err)
+				}
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssntp
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ciao-project/ciao/uuid"
+)
+
+func queuedCommand(cmd Command, payload string) *Frame {
+	return &Frame{
+		Type:          COMMAND,
+		Operand:       (uint8)(cmd),
+		PayloadLength: (uint32)(len(payload)),
+		Payload:       []byte(payload),
+	}
+}
+
+// Test the persistent command queue.
+//
+// Test that commands queued for a client survive the queue being reopened,
+// are returned in order and only once.
+//
+// Test is expected to pass.
+func TestCommandQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssntp-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &QueueConfig{Path: dir}
+	q, err := newCommandQueue(config, errLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := uuid.Generate().String()
+	if err := q.push(agent, queuedCommand(DELETE, "first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.push(agent, queuedCommand(EVACUATE, "second")); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = newCommandQueue(config, errLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := q.pop(agent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 2 ||
+		(Command)(frames[0].Operand) != DELETE || string(frames[0].Payload) != "first" ||
+		(Command)(frames[1].Operand) != EVACUATE || string(frames[1].Payload) != "second" {
+		t.Fatalf("Unexpected queued frames %v", frames)
+	}
+
+	frames, err = q.pop(agent)
+	if err != nil || len(frames) != 0 {
+		t.Fatalf("Expected empty queue, got %v: %v", frames, err)
+	}
+}
+
+// Test the expiry of queued commands.
+//
+// Test that commands are discarded once their TTL has passed.
+//
+// Test is expected to pass.
+func TestCommandQueueTTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssntp-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newCommandQueue(&QueueConfig{Path: dir, TTL: time.Millisecond}, errLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := uuid.Generate().String()
+	if err := q.push(agent, queuedCommand(DELETE, "expired")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	frames, err := q.pop(agent)
+	if err != nil || len(frames) != 0 {
+		t.Fatalf("Expected expired frames to be discarded, got %v: %v", frames, err)
+	}
+}
+
+// Test that commands cannot be queued for invalid client UUIDs.
+//
+// Test is expected to pass.
+func TestCommandQueueInvalidUUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssntp-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newCommandQueue(&QueueConfig{Path: dir}, errLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.push("../../etc/passwd", queuedCommand(DELETE, "")); err == nil {
+		t.Fatal("Expected error queueing a frame for an invalid UUID")
+	}
+
+	if _, err := newCommandQueue(&QueueConfig{}, errLog); err == nil {
+		t.Fatal("Expected error creating a queue without a path")
+	}
+}
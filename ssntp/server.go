@@ -81,6 +81,8 @@ type Server struct {
 	trace *TraceConfig
 
 	configuration clusterConfiguration
+
+	queue *commandQueue
 }
 
 func sendConnectionFailure(conn net.Conn) *session {
@@ -165,6 +167,7 @@ func handleSSNTPClient(server *Server, conn net.Conn) {
 	server.addSession(session, uuidString)
 	server.forwardRules.addForwardDestination(session)
 	server.ntf.ConnectNotify(uuidString, session.destRole)
+	server.deliverQueuedFrames(session)
 
 	for {
 		var frame Frame
@@ -265,6 +268,15 @@ func (server *Server) Serve(config *Config, ntf ServerNotifier) error {
 	server.trace = config.Trace
 	server.stoppedChan = make(chan struct{})
 
+	if config.CommandQueue != nil {
+		server.queue, err = newCommandQueue(config.CommandQueue, server.log)
+		if err != nil {
+			server.log.Errorf("%s", err)
+			config.pushToSyncChannel(err)
+			return err
+		}
+	}
+
 	service := fmt.Sprintf("%s:%d", uri, serverPort)
 	listener, err := tls.Listen(transport, service, server.tls)
 	if err != nil {
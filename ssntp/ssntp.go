@@ -31,6 +31,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ciao-project/ciao/uuid"
 	"github.com/golang/glog"
@@ -61,7 +62,7 @@ type Error uint8
 // Event is the SSNTP Event operand.
 // It can be TenantAdded, TenantRemoval, InstanceDeleted, InstanceStopped,
 // ConcentratorInstanceAdded, PublicIPAssigned, PublicIPUnassigned, TraceReport,
-// NodeConnected or NodeDisconnected
+// NodeConnected, NodeDisconnected or InstanceLog
 type Event uint8
 
 const (
@@ -447,6 +448,20 @@ const (
 	//	|       |       | (0x3) |  (0x2)  |                 | instance information  |
 	//	+---------------------------------------------------------------------------+
 	InstanceStopped
+
+	// InstanceLog is sent by workload agents to notify the Controller of
+	// a significant incident in the life of an instance, e.g., the
+	// instance has been killed by the OOM killer or its image could not
+	// be retrieved.  The Controller records these incidents in the event
+	// log of the instance's tenant.
+	//
+	//					 SSNTP InstanceLog Event frame
+	//
+	//	+---------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted        |
+	//	|       |       | (0x3) |  (0xa)  |                 | incident information  |
+	//	+---------------------------------------------------------------------------+
+	InstanceLog
 )
 
 // SSNTP clients and servers can have one or several roles and are expected to declare their
@@ -629,6 +644,8 @@ func (status Event) String() string {
 		return "Node Connected"
 	case NodeDisconnected:
 		return "Node Disconnected"
+	case InstanceLog:
+		return "Instance Log"
 	}
 
 	return ""
@@ -866,6 +883,21 @@ type Config struct {
 	// used by the underlying TLS session.  If Rand is nil, the default
 	// random number generator for the TLS package will be used.
 	Rand io.Reader
+
+	// CommandQueue optionally enables a persistent queue in which SSNTP
+	// servers store the commands they forward to disconnected clients.
+	// The queued commands are delivered when the clients reconnect.
+	CommandQueue *QueueConfig
+}
+
+// QueueConfig configures the persistent command queue of an SSNTP server.
+type QueueConfig struct {
+	// Path is the directory in which the queued commands are stored.
+	Path string
+
+	// TTL is the time after which a queued command that could not be
+	// delivered is discarded.  The default is one hour.
+	TTL time.Duration
 }
 
 // Logger is an interface for SSNTP users to define their own
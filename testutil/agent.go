@@ -42,8 +42,20 @@ type SsntpTestClient struct {
 	DeleteFailReason       payloads.DeleteFailureReason
 	AttachFail             bool
 	AttachVolumeFailReason payloads.AttachVolumeFailureReason
+	AssignIPFail           bool
+	AssignIPFailReason     payloads.PublicIPFailureReason
+	ReleaseIPFail          bool
+	ReleaseIPFailReason    payloads.PublicIPFailureReason
+	ConfigureFail          bool
+	configuration          *payloads.Configure
+	configurationLock      *sync.Mutex
 	traces                 []*ssntp.Frame
 	tracesLock             *sync.Mutex
+	resources              NodeResources
+	resourcesLock          *sync.Mutex
+	statsTicker            *time.Ticker
+	statsTickerDone        chan struct{}
+	statsTickerLock        *sync.Mutex
 
 	CmdChans        map[ssntp.Command]chan Result
 	CmdChansLock    *sync.Mutex
@@ -55,8 +67,33 @@ type SsntpTestClient struct {
 	StatusChansLock *sync.Mutex
 }
 
+// NodeResources describes the node capacity and utilisation figures an
+// SsntpTestClient reports in its READY and STATS frames.
+type NodeResources struct {
+	MemTotalMB      int
+	MemAvailableMB  int
+	DiskTotalMB     int
+	DiskAvailableMB int
+	Load            int
+	CpusOnline      int
+	Networks        []payloads.NetworkStat
+}
+
+// DefaultNodeResources are the resources reported by an SsntpTestClient
+// which has not been configured otherwise.  They match the values used
+// by the StatsPayload() and ReadyPayload() helpers.
+var DefaultNodeResources = NodeResources{
+	MemTotalMB:      3896,
+	MemAvailableMB:  3896,
+	DiskTotalMB:     500000,
+	DiskAvailableMB: 256000,
+	Load:            0,
+	CpusOnline:      4,
+}
+
 // Shutdown shuts down the testutil.SsntpTestClient and cleans up state
 func (client *SsntpTestClient) Shutdown() {
+	client.StopStatsTicker()
 	closeClientChans(client)
 	client.Ssntp.Close()
 }
@@ -85,6 +122,10 @@ func NewSsntpTestClientConnection(name string, role ssntp.Role, uuid string) (*S
 	openClientChans(client)
 	client.instancesLock = &sync.Mutex{}
 	client.tracesLock = &sync.Mutex{}
+	client.resources = DefaultNodeResources
+	client.resourcesLock = &sync.Mutex{}
+	client.statsTickerLock = &sync.Mutex{}
+	client.configurationLock = &sync.Mutex{}
 
 	config := &ssntp.Config{
 		CAcert: ssntp.DefaultCACert,
@@ -419,6 +460,132 @@ func (client *SsntpTestClient) handleAttachVolume(payload []byte) Result {
 	return result
 }
 
+// handleEvacuate stops all the instances running on the client, as
+// launcher does when its node is evacuated.
+func (client *SsntpTestClient) handleEvacuate(payload []byte) Result {
+	var result Result
+	var cmd payloads.Evacuate
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.NodeUUID = cmd.Evacuate.WorkloadAgentUUID
+
+	client.instancesLock.Lock()
+	instances := client.instances
+	client.instances = nil
+	client.instancesLock.Unlock()
+
+	for _, istat := range instances {
+		err = client.sendStoppedEvent(istat.InstanceUUID)
+		if err != nil {
+			result.Err = err
+		}
+	}
+
+	return result
+}
+
+func publicIPResult(cmd *payloads.PublicIPCommand) Result {
+	return Result{
+		InstanceUUID: cmd.InstanceUUID,
+		TenantUUID:   cmd.TenantUUID,
+		NodeUUID:     cmd.ConcentratorUUID,
+		PublicIP:     cmd.PublicIP,
+	}
+}
+
+func (client *SsntpTestClient) handleAssignPublicIP(payload []byte) Result {
+	var cmd payloads.CommandAssignPublicIP
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	result := publicIPResult(&cmd.AssignIP)
+
+	if client.AssignIPFail == true {
+		result.Err = errors.New(client.AssignIPFailReason.String())
+		client.sendPublicIPFailure(ssntp.AssignPublicIPFailure, &cmd.AssignIP, client.AssignIPFailReason)
+		go client.SendResultAndDelErrorChan(ssntp.AssignPublicIPFailure, result)
+		return result
+	}
+
+	result.Err = client.sendPublicIPEvent(ssntp.PublicIPAssigned, payloads.EventPublicIPAssigned{
+		AssignedIP: publicIPEvent(&cmd.AssignIP),
+	})
+
+	return result
+}
+
+func (client *SsntpTestClient) handleReleasePublicIP(payload []byte) Result {
+	var cmd payloads.CommandReleasePublicIP
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	result := publicIPResult(&cmd.ReleaseIP)
+
+	if client.ReleaseIPFail == true {
+		result.Err = errors.New(client.ReleaseIPFailReason.String())
+		client.sendPublicIPFailure(ssntp.UnassignPublicIPFailure, &cmd.ReleaseIP, client.ReleaseIPFailReason)
+		go client.SendResultAndDelErrorChan(ssntp.UnassignPublicIPFailure, result)
+		return result
+	}
+
+	result.Err = client.sendPublicIPEvent(ssntp.PublicIPUnassigned, payloads.EventPublicIPUnassigned{
+		UnassignedIP: publicIPEvent(&cmd.ReleaseIP),
+	})
+
+	return result
+}
+
+// handleConfigure records the configuration sent to the client.  The
+// configuration is rejected with an InvalidConfiguration error if
+// ConfigureFail is set.
+func (client *SsntpTestClient) handleConfigure(payload []byte) Result {
+	var result Result
+	var cmd payloads.Configure
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if client.ConfigureFail == true {
+		result.Err = errors.New("Invalid configuration")
+		_, err = client.Ssntp.SendError(ssntp.InvalidConfiguration, payload)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		go client.SendResultAndDelErrorChan(ssntp.InvalidConfiguration, result)
+		return result
+	}
+
+	client.configurationLock.Lock()
+	client.configuration = &cmd
+	client.configurationLock.Unlock()
+
+	return result
+}
+
+// Configuration returns the last configuration successfully received by
+// the SsntpTestClient in a CONFIGURE command, or nil if it has not been
+// configured.
+func (client *SsntpTestClient) Configuration() *payloads.Configure {
+	client.configurationLock.Lock()
+	defer client.configurationLock.Unlock()
+
+	return client.configuration
+}
+
 // CommandNotify implements the SSNTP client CommandNotify callback for SsntpTestClient
 func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp.Frame) {
 	payload := frame.Payload
@@ -433,14 +600,6 @@ func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp
 	}
 
 	switch command {
-	/* FIXME: implement
-	case ssntp.CONNECT:
-	case ssntp.STATS:
-	case ssntp.EVACUATE:
-	case ssntp.AssignPublicIP:
-	case ssntp.ReleasePublicIP:
-	case ssntp.CONFIGURE:
-	*/
 	case ssntp.START:
 		result = client.handleStart(payload)
 
@@ -450,6 +609,18 @@ func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp
 	case ssntp.AttachVolume:
 		result = client.handleAttachVolume(payload)
 
+	case ssntp.EVACUATE:
+		result = client.handleEvacuate(payload)
+
+	case ssntp.AssignPublicIP:
+		result = client.handleAssignPublicIP(payload)
+
+	case ssntp.ReleasePublicIP:
+		result = client.handleReleasePublicIP(payload)
+
+	case ssntp.CONFIGURE:
+		result = client.handleConfigure(payload)
+
 	default:
 		fmt.Fprintf(os.Stderr, "client %s unhandled command %s\n", client.Role.String(), command.String())
 	}
@@ -493,24 +664,89 @@ func (client *SsntpTestClient) EventNotify(event ssntp.Event, frame *ssntp.Frame
 func (client *SsntpTestClient) ErrorNotify(error ssntp.Error, frame *ssntp.Frame) {
 }
 
-// SendStatsCmd pushes an ssntp.STATS command frame from the SsntpTestClient
-func (client *SsntpTestClient) SendStatsCmd() {
-	var result Result
+// SetResources changes the node resources reported by the SsntpTestClient
+// in subsequent READY and STATS frames.
+func (client *SsntpTestClient) SetResources(resources NodeResources) {
+	client.resourcesLock.Lock()
+	client.resources = resources
+	client.resourcesLock.Unlock()
+}
+
+// Resources returns the node resources currently reported by the
+// SsntpTestClient.
+func (client *SsntpTestClient) Resources() NodeResources {
+	client.resourcesLock.Lock()
+	defer client.resourcesLock.Unlock()
+
+	return client.resources
+}
+
+func (client *SsntpTestClient) statsPayload() payloads.Stat {
+	r := client.Resources()
 
 	client.instancesLock.Lock()
-	payload := StatsPayload(client.UUID, client.Name, client.instances, nil)
+	instances := make([]payloads.InstanceStat, len(client.instances))
+	copy(instances, client.instances)
 	client.instancesLock.Unlock()
 
-	y, err := yaml.Marshal(payload)
+	return payloads.Stat{
+		NodeUUID:        client.UUID,
+		Status:          ssntp.READY.String(),
+		MemTotalMB:      r.MemTotalMB,
+		MemAvailableMB:  r.MemAvailableMB,
+		DiskTotalMB:     r.DiskTotalMB,
+		DiskAvailableMB: r.DiskAvailableMB,
+		Load:            r.Load,
+		CpusOnline:      r.CpusOnline,
+		NodeHostName:    client.Name,
+		Instances:       instances,
+		Networks:        r.Networks,
+	}
+}
+
+func (client *SsntpTestClient) readyPayload() payloads.Ready {
+	r := client.Resources()
+
+	return payloads.Ready{
+		NodeUUID:        client.UUID,
+		MemTotalMB:      r.MemTotalMB,
+		MemAvailableMB:  r.MemAvailableMB,
+		DiskTotalMB:     r.DiskTotalMB,
+		DiskAvailableMB: r.DiskAvailableMB,
+		Load:            r.Load,
+		CpusOnline:      r.CpusOnline,
+		Networks:        r.Networks,
+		NodeHostName:    client.Name,
+	}
+}
+
+func (client *SsntpTestClient) sendStats() error {
+	y, err := yaml.Marshal(client.statsPayload())
 	if err != nil {
-		result.Err = err
-	} else {
-		_, err = client.Ssntp.SendCommand(ssntp.STATS, y)
-		if err != nil {
-			result.Err = err
-		}
+		return err
 	}
 
+	_, err = client.Ssntp.SendCommand(ssntp.STATS, y)
+	return err
+}
+
+func (client *SsntpTestClient) sendReady() error {
+	y, err := yaml.Marshal(client.readyPayload())
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Ssntp.SendStatus(ssntp.READY, y)
+	return err
+}
+
+// SendStatsCmd pushes an ssntp.STATS command frame from the SsntpTestClient
+// reporting the client's configured node resources
+func (client *SsntpTestClient) SendStatsCmd() {
+	var result Result
+
+	result.Err = client.sendStats()
+
 	go client.SendResultAndDelCmdChan(ssntp.STATS, result)
 }
 
@@ -534,6 +770,63 @@ func (client *SsntpTestClient) SendStatus(memTotal int, memAvail int, networks [
 	go client.SendResultAndDelCmdChan(ssntp.STATS, result)
 }
 
+// SendReadyStatus pushes an ssntp.READY status frame from the SsntpTestClient
+// reporting the client's configured node resources
+func (client *SsntpTestClient) SendReadyStatus() {
+	var result Result
+
+	result.Err = client.sendReady()
+
+	go client.SendResultAndDelStatusChan(ssntp.READY, result)
+}
+
+// StartStatsTicker makes the SsntpTestClient send a READY status frame
+// followed by a STATS command frame every interval, mimicking the periodic
+// reporting of a real launcher.  Any previously started ticker is stopped.
+func (client *SsntpTestClient) StartStatsTicker(interval time.Duration) {
+	client.StopStatsTicker()
+
+	client.statsTickerLock.Lock()
+	defer client.statsTickerLock.Unlock()
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	client.statsTicker = ticker
+	client.statsTickerDone = done
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := client.sendReady(); err != nil {
+					fmt.Fprintf(os.Stderr, "client %s READY error: %v\n", client.Name, err)
+				}
+				if err := client.sendStats(); err != nil {
+					fmt.Fprintf(os.Stderr, "client %s STATS error: %v\n", client.Name, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// StopStatsTicker stops the periodic sender started by StartStatsTicker.
+// It is safe to call even if no ticker is running.
+func (client *SsntpTestClient) StopStatsTicker() {
+	client.statsTickerLock.Lock()
+	defer client.statsTickerLock.Unlock()
+
+	if client.statsTicker == nil {
+		return
+	}
+
+	client.statsTicker.Stop()
+	close(client.statsTickerDone)
+	client.statsTicker = nil
+	client.statsTickerDone = nil
+}
+
 // SendTrace allows an SsntpTestClient to push an ssntp.TraceReport event frame
 func (client *SsntpTestClient) SendTrace() {
 	var result Result
@@ -566,10 +859,7 @@ func (client *SsntpTestClient) SendTrace() {
 	go client.SendResultAndDelEventChan(ssntp.TraceReport, result)
 }
 
-// SendDeleteEvent allows an SsntpTestClient to push an ssntp.InstanceDeleted event frame
-func (client *SsntpTestClient) SendDeleteEvent(uuid string) {
-	var result Result
-
+func (client *SsntpTestClient) sendDeleteEvent(uuid string) error {
 	evt := payloads.InstanceDeletedEvent{
 		InstanceUUID: uuid,
 	}
@@ -580,21 +870,23 @@ func (client *SsntpTestClient) SendDeleteEvent(uuid string) {
 
 	y, err := yaml.Marshal(event)
 	if err != nil {
-		result.Err = err
-	} else {
-		_, err = client.Ssntp.SendEvent(ssntp.InstanceDeleted, y)
-		if err != nil {
-			result.Err = err
-		}
+		return err
 	}
 
-	go client.SendResultAndDelEventChan(ssntp.InstanceDeleted, result)
+	_, err = client.Ssntp.SendEvent(ssntp.InstanceDeleted, y)
+	return err
 }
 
-// SendStoppedEvent allows an SsntpTestClient to push an ssntp.InstanceStopped event frame
-func (client *SsntpTestClient) SendStoppedEvent(uuid string) {
+// SendDeleteEvent allows an SsntpTestClient to push an ssntp.InstanceDeleted event frame
+func (client *SsntpTestClient) SendDeleteEvent(uuid string) {
 	var result Result
 
+	result.Err = client.sendDeleteEvent(uuid)
+
+	go client.SendResultAndDelEventChan(ssntp.InstanceDeleted, result)
+}
+
+func (client *SsntpTestClient) sendStoppedEvent(uuid string) error {
 	evt := payloads.InstanceStoppedEvent{
 		InstanceUUID: uuid,
 	}
@@ -605,14 +897,19 @@ func (client *SsntpTestClient) SendStoppedEvent(uuid string) {
 
 	y, err := yaml.Marshal(event)
 	if err != nil {
-		result.Err = err
-	} else {
-		_, err = client.Ssntp.SendEvent(ssntp.InstanceStopped, y)
-		if err != nil {
-			result.Err = err
-		}
+		return err
 	}
 
+	_, err = client.Ssntp.SendEvent(ssntp.InstanceStopped, y)
+	return err
+}
+
+// SendStoppedEvent allows an SsntpTestClient to push an ssntp.InstanceStopped event frame
+func (client *SsntpTestClient) SendStoppedEvent(uuid string) {
+	var result Result
+
+	result.Err = client.sendStoppedEvent(uuid)
+
 	go client.SendResultAndDelEventChan(ssntp.InstanceStopped, result)
 }
 
@@ -744,3 +1041,44 @@ func (client *SsntpTestClient) sendAttachVolumeFailure(instanceUUID string, volu
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
+
+func publicIPEvent(cmd *payloads.PublicIPCommand) payloads.PublicIPEvent {
+	return payloads.PublicIPEvent{
+		ConcentratorUUID: cmd.ConcentratorUUID,
+		InstanceUUID:     cmd.InstanceUUID,
+		PublicIP:         cmd.PublicIP,
+		PrivateIP:        cmd.PrivateIP,
+	}
+}
+
+func (client *SsntpTestClient) sendPublicIPEvent(event ssntp.Event, payload interface{}) error {
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Ssntp.SendEvent(event, y)
+	return err
+}
+
+func (client *SsntpTestClient) sendPublicIPFailure(error ssntp.Error, cmd *payloads.PublicIPCommand, reason payloads.PublicIPFailureReason) {
+	e := payloads.ErrorPublicIPFailure{
+		ConcentratorUUID: cmd.ConcentratorUUID,
+		TenantUUID:       cmd.TenantUUID,
+		InstanceUUID:     cmd.InstanceUUID,
+		PublicIP:         cmd.PublicIP,
+		PrivateIP:        cmd.PrivateIP,
+		VnicMAC:          cmd.VnicMAC,
+		Reason:           reason,
+	}
+
+	y, err := yaml.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	_, err = client.Ssntp.SendError(error, y)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -167,6 +167,59 @@ func TestSendStats(t *testing.T) {
 	}
 }
 
+func TestSendReadyStatus(t *testing.T) {
+	serverCh := server.AddStatusChan(ssntp.READY)
+	agentCh := agent.AddStatusChan(ssntp.READY)
+
+	go agent.SendReadyStatus()
+
+	_, err := agent.GetStatusChanResult(agentCh, ssntp.READY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.GetStatusChanResult(serverCh, ssntp.READY)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatsTicker(t *testing.T) {
+	defaults := agent.Resources()
+	defer agent.SetResources(defaults)
+
+	resources := NodeResources{
+		MemTotalMB:      65536,
+		MemAvailableMB:  1024,
+		DiskTotalMB:     1000000,
+		DiskAvailableMB: 2048,
+		Load:            7,
+		CpusOnline:      32,
+	}
+	agent.SetResources(resources)
+	if agent.Resources().MemAvailableMB != resources.MemAvailableMB {
+		t.Fatalf("resources not updated: expected %d, got %d",
+			resources.MemAvailableMB, agent.Resources().MemAvailableMB)
+	}
+
+	serverStatusCh := server.AddStatusChan(ssntp.READY)
+	serverCmdCh := server.AddCmdChan(ssntp.STATS)
+
+	agent.StartStatsTicker(100 * time.Millisecond)
+	defer agent.StopStatsTicker()
+
+	_, err := server.GetStatusChanResult(serverStatusCh, ssntp.READY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.GetCmdChanResult(serverCmdCh, ssntp.STATS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent.StopStatsTicker()
+	agent.StopStatsTicker()
+}
+
 func TestStartTraced(t *testing.T) {
 	agentCh := agent.AddCmdChan(ssntp.START)
 	serverCh := server.AddCmdChan(ssntp.START)
@@ -516,6 +569,166 @@ func TestPublicIPAssigned(t *testing.T) {
 	}
 }
 
+func doPublicIP(command ssntp.Command, payload string, fail bool) error {
+	var event ssntp.Event
+	var failure ssntp.Error
+
+	if command == ssntp.AssignPublicIP {
+		event = ssntp.PublicIPAssigned
+		failure = ssntp.AssignPublicIPFailure
+	} else {
+		event = ssntp.PublicIPUnassigned
+		failure = ssntp.UnassignPublicIPFailure
+	}
+
+	cnciAgentCh := cnciAgent.AddCmdChan(command)
+	serverCh := server.AddCmdChan(command)
+
+	var controllerCh chan Result
+	if fail == true {
+		controllerCh = controller.AddErrorChan(failure)
+		fmt.Fprintf(os.Stderr, "Expecting controller to note: \"%s\"\n", failure)
+
+		cnciAgent.AssignIPFail = true
+		cnciAgent.AssignIPFailReason = payloads.PublicIPAssignFailure
+		cnciAgent.ReleaseIPFail = true
+		cnciAgent.ReleaseIPFailReason = payloads.PublicIPReleaseFailure
+
+		defer func() {
+			cnciAgent.AssignIPFail = false
+			cnciAgent.AssignIPFailReason = ""
+			cnciAgent.ReleaseIPFail = false
+			cnciAgent.ReleaseIPFailReason = ""
+		}()
+	} else {
+		controllerCh = controller.AddEventChan(event)
+	}
+
+	go controller.Ssntp.SendCommand(command, []byte(payload))
+
+	result, err := server.GetCmdChanResult(serverCh, command)
+	if err != nil { // server sees the command on its way down to the CNCI
+		return err
+	}
+	if result.InstanceUUID != InstanceUUID || result.PublicIP != InstancePublicIP {
+		return fmt.Errorf("Unexpected server result %+v", result)
+	}
+
+	result, err = cnciAgent.GetCmdChanResult(cnciAgentCh, command)
+	if fail == false && err != nil { // CNCI unexpected fail
+		return err
+	}
+	if fail == true && err == nil { // CNCI unexpected success
+		return errors.New("Success when Failure expected")
+	}
+	if result.NodeUUID != CNCIUUID {
+		return fmt.Errorf("Unexpected CNCI result %+v", result)
+	}
+
+	if fail == true {
+		_, err = controller.GetErrorChanResult(controllerCh, failure)
+	} else {
+		_, err = controller.GetEventChanResult(controllerCh, event)
+	}
+
+	return err
+}
+
+func TestAssignPublicIP(t *testing.T) {
+	err := doPublicIP(ssntp.AssignPublicIP, AssignIPYaml, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssignPublicIPFailure(t *testing.T) {
+	err := doPublicIP(ssntp.AssignPublicIP, AssignIPYaml, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleasePublicIP(t *testing.T) {
+	err := doPublicIP(ssntp.ReleasePublicIP, ReleaseIPYaml, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleasePublicIPFailure(t *testing.T) {
+	err := doPublicIP(ssntp.ReleasePublicIP, ReleaseIPYaml, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	agentCh := agent.AddCmdChan(ssntp.CONFIGURE)
+
+	_, err := server.Ssntp.SendCommand(AgentUUID, ssntp.CONFIGURE, []byte(ConfigureYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = agent.GetCmdChanResult(agentCh, ssntp.CONFIGURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := agent.Configuration()
+	if config == nil || config.Configure.Scheduler.ConfigStorageURI != StorageURI {
+		t.Fatalf("Unexpected configuration %+v", config)
+	}
+}
+
+func TestConfigureFailure(t *testing.T) {
+	agentCh := agent.AddCmdChan(ssntp.CONFIGURE)
+	serverCh := server.AddErrorChan(ssntp.InvalidConfiguration)
+
+	agent.ConfigureFail = true
+	defer func() {
+		agent.ConfigureFail = false
+	}()
+
+	_, err := server.Ssntp.SendCommand(AgentUUID, ssntp.CONFIGURE, []byte(ConfigureYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = agent.GetCmdChanResult(agentCh, ssntp.CONFIGURE)
+	if err == nil {
+		t.Fatal("Success when Failure expected")
+	}
+
+	_, err = server.GetErrorChanResult(serverCh, ssntp.InvalidConfiguration)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvacuate(t *testing.T) {
+	agentCh := agent.AddCmdChan(ssntp.EVACUATE)
+	serverCh := server.AddCmdChan(ssntp.EVACUATE)
+
+	go controller.Ssntp.SendCommand(ssntp.EVACUATE, []byte(EvacuateYaml))
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.EVACUATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NodeUUID != AgentUUID {
+		t.Fatalf("Expected server to note EVACUATE for %s, got %s", AgentUUID, result.NodeUUID)
+	}
+
+	result, err = agent.GetCmdChanResult(agentCh, ssntp.EVACUATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NodeUUID != AgentUUID {
+		t.Fatalf("Expected agent to be evacuated, got %s", result.NodeUUID)
+	}
+}
+
 func TestMain(m *testing.M) {
 	var err error
 
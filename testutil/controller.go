@@ -302,6 +302,13 @@ func (ctl *SsntpTestController) EventNotify(event ssntp.Event, frame *ssntp.Fram
 		if err != nil {
 			result.Err = err
 		}
+	case ssntp.PublicIPUnassigned:
+		var publicIPUnassignedEvent payloads.EventPublicIPUnassigned
+
+		err := yaml.Unmarshal(frame.Payload, &publicIPUnassignedEvent)
+		if err != nil {
+			result.Err = err
+		}
 	case ssntp.InstanceDeleted:
 		var deleteEvent payloads.EventInstanceDeleted
 
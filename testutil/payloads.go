@@ -327,6 +327,7 @@ const ConfigureYaml = `configure:
     ceph_id: ` + ManagementID + `
   controller:
     ciao_port: ` + CiaoPort + `
+    ciao_bind_address: ""
     compute_ca: ` + HTTPSCACert + `
     compute_cert: ` + HTTPSKey + `
     cnci_vcpus: 0
@@ -343,6 +344,8 @@ const ConfigureYaml = `configure:
     disk_limit: false
     mem_limit: false
     child_user: ` + User + `
+    stats_interval: 0
+    stats_delta: false
 `
 
 // DeleteFailureYaml is a sample workload DeleteFailure ssntp.Error payload for test cases
@@ -361,6 +364,13 @@ const InsStopYaml = `instance_stopped:
   instance_uuid: ` + InstanceUUID + `
 `
 
+// InsLogYaml is a sample workload InstanceLog ssntp.Event payload for test cases
+const InsLogYaml = `instance_log:
+  instance_uuid: ` + InstanceUUID + `
+  reason: oom_killed
+  message: qemu killed by the OOM killer
+`
+
 // NodeConnectedYaml is a sample node NodeConnected ssntp.Event payload for test cases
 const NodeConnectedYaml = `node_connected:
   node_uuid: ` + AgentUUID + `
@@ -406,34 +416,62 @@ load: 1
 
 // InstanceStat001 is a sample payloads.InstanceStat
 var InstanceStat001 = payloads.InstanceStat{
-	InstanceUUID:  "fe2970fa-7b36-460b-8b79-9eb4745e62f2",
-	State:         payloads.Running,
-	MemoryUsageMB: 40,
-	DiskUsageMB:   2,
-	CPUUsage:      90,
-	SSHIP:         "",
-	SSHPort:       0,
+	InstanceUUID:    "fe2970fa-7b36-460b-8b79-9eb4745e62f2",
+	State:           payloads.Running,
+	MemoryUsageMB:   40,
+	DiskUsageMB:     2,
+	CPUUsage:        90,
+	SSHIP:           "",
+	SSHPort:         0,
+	NetRxBytes:      1048576,
+	NetTxBytes:      524288,
+	NetRxPackets:    1024,
+	NetTxPackets:    512,
+	BlockReadBytes:  8388608,
+	BlockWriteBytes: 4194304,
+	Connections:     3,
+	TopTalkers: []payloads.TopTalker{
+		{
+			IP:          "10.0.0.3",
+			Connections: 2,
+			Bytes:       1600,
+		},
+	},
 }
 
 // InstanceStat002 is a sample payloads.InstanceStat
 var InstanceStat002 = payloads.InstanceStat{
-	InstanceUUID:  "cbda5bd8-33bd-4d39-9f52-ace8c9f0b99c",
-	State:         payloads.Running,
-	MemoryUsageMB: 50,
-	DiskUsageMB:   10,
-	CPUUsage:      0,
-	SSHIP:         "172.168.2.2",
-	SSHPort:       8768,
+	InstanceUUID:    "cbda5bd8-33bd-4d39-9f52-ace8c9f0b99c",
+	State:           payloads.Running,
+	MemoryUsageMB:   50,
+	DiskUsageMB:     10,
+	CPUUsage:        0,
+	SSHIP:           "172.168.2.2",
+	SSHPort:         8768,
+	NetRxBytes:      0,
+	NetTxBytes:      0,
+	NetRxPackets:    0,
+	NetTxPackets:    0,
+	BlockReadBytes:  0,
+	BlockWriteBytes: 0,
+	Connections:     0,
 }
 
 // InstanceStat003 is a sample payloads.InstanceStat
 var InstanceStat003 = payloads.InstanceStat{
-	InstanceUUID:  "1f5b2fe6-4493-4561-904a-8f4e956218d9",
-	State:         payloads.Exited,
-	MemoryUsageMB: -1,
-	DiskUsageMB:   2,
-	CPUUsage:      -1,
-	Volumes:       []string{VolumeUUID},
+	InstanceUUID:    "1f5b2fe6-4493-4561-904a-8f4e956218d9",
+	State:           payloads.Exited,
+	MemoryUsageMB:   -1,
+	DiskUsageMB:     2,
+	CPUUsage:        -1,
+	Volumes:         []string{VolumeUUID},
+	NetRxBytes:      -1,
+	NetTxBytes:      -1,
+	NetRxPackets:    -1,
+	NetTxPackets:    -1,
+	BlockReadBytes:  -1,
+	BlockWriteBytes: -1,
+	Connections:     -1,
 }
 
 // NetworkStat001 is a sample payloads.NetworkStat
@@ -495,6 +533,17 @@ instances:
   disk_usage_mb: 2
   cpu_usage: 90
   volumes: []
+  net_rx_bytes: 1048576
+  net_tx_bytes: 524288
+  net_rx_packets: 1024
+  net_tx_packets: 512
+  block_read_bytes: 8388608
+  block_write_bytes: 4194304
+  connections: 3
+  top_talkers:
+  - ip: 10.0.0.3
+    connections: 2
+    bytes: 1600
 - instance_uuid: cbda5bd8-33bd-4d39-9f52-ace8c9f0b99c
   state: active
   ssh_ip: 172.168.2.2
@@ -503,6 +552,13 @@ instances:
   disk_usage_mb: 10
   cpu_usage: 0
   volumes: []
+  net_rx_bytes: 0
+  net_tx_bytes: 0
+  net_rx_packets: 0
+  net_tx_packets: 0
+  block_read_bytes: 0
+  block_write_bytes: 0
+  connections: 0
 - instance_uuid: 1f5b2fe6-4493-4561-904a-8f4e956218d9
   state: exited
   ssh_ip: ""
@@ -512,6 +568,13 @@ instances:
   cpu_usage: -1
   volumes:
   - 67d86208-b46c-4465-9018-e14187d4010
+  net_rx_bytes: -1
+  net_tx_bytes: -1
+  net_rx_packets: -1
+  net_tx_packets: -1
+  block_read_bytes: -1
+  block_write_bytes: -1
+  connections: -1
 `
 
 // NodeOnlyStatsYaml is a sample minimal node STATS ssntp.Command payload for test cases
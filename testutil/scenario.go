@@ -0,0 +1,280 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/ciao-project/ciao/payloads"
+	"github.com/ciao-project/ciao/ssntp"
+	"gopkg.in/yaml.v2"
+)
+
+// ScenarioAction identifies the kind of operation performed by a
+// ScenarioStep
+type ScenarioAction string
+
+const (
+	// ScenarioConnect creates a new SsntpTestClient and dials the server
+	ScenarioConnect ScenarioAction = "connect"
+
+	// ScenarioDisconnect shuts down a previously connected agent
+	ScenarioDisconnect ScenarioAction = "disconnect"
+
+	// ScenarioSetResources changes the node resources an agent reports
+	ScenarioSetResources ScenarioAction = "set_resources"
+
+	// ScenarioSendReady makes an agent send a READY status frame
+	ScenarioSendReady ScenarioAction = "send_ready"
+
+	// ScenarioSendStats makes an agent send a STATS command frame
+	ScenarioSendStats ScenarioAction = "send_stats"
+
+	// ScenarioFailStart makes an agent fail subsequent START commands
+	ScenarioFailStart ScenarioAction = "fail_start"
+
+	// ScenarioSucceedStart makes an agent accept subsequent START commands
+	ScenarioSucceedStart ScenarioAction = "succeed_start"
+
+	// ScenarioFailDelete makes an agent fail subsequent DELETE commands
+	ScenarioFailDelete ScenarioAction = "fail_delete"
+
+	// ScenarioSucceedDelete makes an agent accept subsequent DELETE commands
+	ScenarioSucceedDelete ScenarioAction = "succeed_delete"
+
+	// ScenarioInstanceDeleted makes an agent send an InstanceDeleted event
+	ScenarioInstanceDeleted ScenarioAction = "instance_deleted"
+
+	// ScenarioWait pauses the replay for the step's duration
+	ScenarioWait ScenarioAction = "wait"
+)
+
+// ScenarioResources is the YAML representation of NodeResources
+type ScenarioResources struct {
+	MemTotalMB      int `yaml:"mem_total_mb"`
+	MemAvailableMB  int `yaml:"mem_available_mb"`
+	DiskTotalMB     int `yaml:"disk_total_mb"`
+	DiskAvailableMB int `yaml:"disk_available_mb"`
+	Load            int `yaml:"load"`
+	CpusOnline      int `yaml:"cpus_online"`
+}
+
+// ScenarioStep is a single ordered action performed by a named agent
+type ScenarioStep struct {
+	Action    ScenarioAction     `yaml:"action"`
+	Agent     string             `yaml:"agent"`
+	Role      string             `yaml:"role,omitempty"`
+	UUID      string             `yaml:"uuid,omitempty"`
+	Instance  string             `yaml:"instance,omitempty"`
+	Reason    string             `yaml:"reason,omitempty"`
+	Duration  string             `yaml:"duration,omitempty"`
+	Resources *ScenarioResources `yaml:"resources,omitempty"`
+}
+
+// Scenario is an ordered list of agent actions which can be replayed
+// deterministically against an SSNTP server
+type Scenario struct {
+	Name  string         `yaml:"name"`
+	Steps []ScenarioStep `yaml:"steps"`
+}
+
+// ParseScenario unmarshals and validates a YAML scenario description
+func ParseScenario(data []byte) (*Scenario, error) {
+	var s Scenario
+
+	err := yaml.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse scenario: %v", err)
+	}
+
+	for i, step := range s.Steps {
+		err = step.validate()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid scenario step %d: %v", i, err)
+		}
+	}
+
+	return &s, nil
+}
+
+// LoadScenario reads and parses the YAML scenario stored in path
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read scenario %s: %v", path, err)
+	}
+
+	return ParseScenario(data)
+}
+
+func (step *ScenarioStep) validate() error {
+	if step.Action != ScenarioWait && step.Agent == "" {
+		return fmt.Errorf("%s: no agent specified", step.Action)
+	}
+
+	switch step.Action {
+	case ScenarioConnect:
+		if step.UUID == "" {
+			return fmt.Errorf("%s: no uuid specified", step.Action)
+		}
+		var role ssntp.Role
+		if err := role.Set(step.Role); err != nil || role == ssntp.UNKNOWN {
+			return fmt.Errorf("%s: invalid role \"%s\"", step.Action, step.Role)
+		}
+	case ScenarioSetResources:
+		if step.Resources == nil {
+			return fmt.Errorf("%s: no resources specified", step.Action)
+		}
+	case ScenarioFailStart, ScenarioFailDelete:
+		if step.Reason == "" {
+			return fmt.Errorf("%s: no reason specified", step.Action)
+		}
+	case ScenarioInstanceDeleted:
+		if step.Instance == "" {
+			return fmt.Errorf("%s: no instance specified", step.Action)
+		}
+	case ScenarioWait:
+		if _, err := time.ParseDuration(step.Duration); err != nil {
+			return fmt.Errorf("%s: invalid duration \"%s\"", step.Action, step.Duration)
+		}
+	case ScenarioDisconnect, ScenarioSendReady, ScenarioSendStats,
+		ScenarioSucceedStart, ScenarioSucceedDelete:
+	default:
+		return fmt.Errorf("unknown action \"%s\"", step.Action)
+	}
+
+	return nil
+}
+
+// ScenarioRunner replays scenarios, keeping track of the agents they
+// connect so that several scenarios can be chained together
+type ScenarioRunner struct {
+	Agents map[string]*SsntpTestClient
+}
+
+// NewScenarioRunner creates a ScenarioRunner with no connected agents
+func NewScenarioRunner() *ScenarioRunner {
+	return &ScenarioRunner{
+		Agents: make(map[string]*SsntpTestClient),
+	}
+}
+
+// Replay executes the steps of a scenario in order.  Each step completes
+// before the next one starts, so replaying a scenario always generates
+// the same sequence of frames.
+func (runner *ScenarioRunner) Replay(s *Scenario) error {
+	for i, step := range s.Steps {
+		err := runner.replayStep(step)
+		if err != nil {
+			return fmt.Errorf("Scenario %s step %d (%s %s) failed: %v",
+				s.Name, i, step.Action, step.Agent, err)
+		}
+	}
+
+	return nil
+}
+
+// Shutdown disconnects all the agents still connected by the runner
+func (runner *ScenarioRunner) Shutdown() {
+	for name, agent := range runner.Agents {
+		agent.Shutdown()
+		delete(runner.Agents, name)
+	}
+}
+
+func (runner *ScenarioRunner) agent(name string) (*SsntpTestClient, error) {
+	agent, ok := runner.Agents[name]
+	if !ok {
+		return nil, fmt.Errorf("agent %s is not connected", name)
+	}
+
+	return agent, nil
+}
+
+func (runner *ScenarioRunner) replayStep(step ScenarioStep) error {
+	switch step.Action {
+	case ScenarioConnect:
+		return runner.connect(step)
+	case ScenarioWait:
+		d, err := time.ParseDuration(step.Duration)
+		if err != nil {
+			return err
+		}
+		time.Sleep(d)
+		return nil
+	}
+
+	agent, err := runner.agent(step.Agent)
+	if err != nil {
+		return err
+	}
+
+	switch step.Action {
+	case ScenarioDisconnect:
+		agent.Shutdown()
+		delete(runner.Agents, step.Agent)
+	case ScenarioSetResources:
+		r := agent.Resources()
+		r.MemTotalMB = step.Resources.MemTotalMB
+		r.MemAvailableMB = step.Resources.MemAvailableMB
+		r.DiskTotalMB = step.Resources.DiskTotalMB
+		r.DiskAvailableMB = step.Resources.DiskAvailableMB
+		r.Load = step.Resources.Load
+		r.CpusOnline = step.Resources.CpusOnline
+		agent.SetResources(r)
+	case ScenarioSendReady:
+		return agent.sendReady()
+	case ScenarioSendStats:
+		return agent.sendStats()
+	case ScenarioFailStart:
+		agent.StartFail = true
+		agent.StartFailReason = payloads.StartFailureReason(step.Reason)
+	case ScenarioSucceedStart:
+		agent.StartFail = false
+	case ScenarioFailDelete:
+		agent.DeleteFail = true
+		agent.DeleteFailReason = payloads.DeleteFailureReason(step.Reason)
+	case ScenarioSucceedDelete:
+		agent.DeleteFail = false
+	case ScenarioInstanceDeleted:
+		return agent.sendDeleteEvent(step.Instance)
+	}
+
+	return nil
+}
+
+func (runner *ScenarioRunner) connect(step ScenarioStep) error {
+	if _, ok := runner.Agents[step.Agent]; ok {
+		return fmt.Errorf("agent %s is already connected", step.Agent)
+	}
+
+	var role ssntp.Role
+	err := role.Set(step.Role)
+	if err != nil {
+		return err
+	}
+
+	agent, err := NewSsntpTestClientConnection(step.Agent, role, step.UUID)
+	if err != nil {
+		return err
+	}
+
+	runner.Agents[step.Agent] = agent
+	return nil
+}
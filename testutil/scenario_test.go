@@ -0,0 +1,154 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package testutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ciao-project/ciao/ssntp"
+	. "github.com/ciao-project/ciao/testutil"
+)
+
+const scenarioYaml = `name: heterogeneous
+steps:
+- action: connect
+  agent: small
+  role: agent
+  uuid: 2ad6a5c4-2b3c-4b6e-bd25-6b5a3f1d9c01
+- action: set_resources
+  agent: small
+  resources:
+    mem_total_mb: 1024
+    mem_available_mb: 512
+    disk_total_mb: 10000
+    disk_available_mb: 5000
+    load: 3
+    cpus_online: 1
+- action: send_ready
+  agent: small
+- action: send_stats
+  agent: small
+- action: fail_start
+  agent: small
+  reason: full_cn
+- action: wait
+  duration: 10ms
+- action: disconnect
+  agent: small
+`
+
+func TestParseScenario(t *testing.T) {
+	s, err := ParseScenario([]byte(scenarioYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Name != "heterogeneous" {
+		t.Fatalf("wrong scenario name: %s", s.Name)
+	}
+	if len(s.Steps) != 7 {
+		t.Fatalf("expected 7 steps, got %d", len(s.Steps))
+	}
+	if s.Steps[1].Resources == nil || s.Steps[1].Resources.MemAvailableMB != 512 {
+		t.Fatalf("resources not parsed: %v", s.Steps[1].Resources)
+	}
+}
+
+func TestParseScenarioInvalid(t *testing.T) {
+	invalid := []string{
+		"steps:\n- action: explode\n  agent: a\n",
+		"steps:\n- action: connect\n  agent: a\n  role: agent\n",
+		"steps:\n- action: connect\n  agent: a\n  role: bogus\n  uuid: x\n",
+		"steps:\n- action: send_stats\n",
+		"steps:\n- action: set_resources\n  agent: a\n",
+		"steps:\n- action: fail_start\n  agent: a\n",
+		"steps:\n- action: instance_deleted\n  agent: a\n",
+		"steps:\n- action: wait\n  duration: forever\n",
+		"steps: [",
+	}
+
+	for _, y := range invalid {
+		if _, err := ParseScenario([]byte(y)); err == nil {
+			t.Errorf("invalid scenario accepted:\n%s", y)
+		}
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	f, err := ioutil.TempFile("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.WriteString(scenarioYaml)
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadScenario(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadScenario(f.Name() + ".missing")
+	if err == nil {
+		t.Fatal("missing scenario file loaded")
+	}
+}
+
+func TestReplayScenario(t *testing.T) {
+	s, err := ParseScenario([]byte(scenarioYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewScenarioRunner()
+	defer runner.Shutdown()
+
+	serverStatusCh := server.AddStatusChan(ssntp.READY)
+	serverCmdCh := server.AddCmdChan(ssntp.STATS)
+
+	err = runner.Replay(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = server.GetStatusChanResult(serverStatusCh, ssntp.READY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.GetCmdChanResult(serverCmdCh, ssntp.STATS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runner.Agents) != 0 {
+		t.Fatalf("agents still connected after replay: %d", len(runner.Agents))
+	}
+
+	bad := &Scenario{
+		Name:  "bad",
+		Steps: []ScenarioStep{{Action: ScenarioSendStats, Agent: "ghost"}},
+	}
+	if err = runner.Replay(bad); err == nil {
+		t.Fatal("replay with unknown agent succeeded")
+	}
+}
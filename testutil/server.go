@@ -364,12 +364,6 @@ func (server *SsntpTestServer) CommandNotify(uuid string, command ssntp.Command,
 	payload := frame.Payload
 
 	switch command {
-	/*TODO:
-	case CONNECT:
-	case AssignPublicIP:
-	case ReleasePublicIP:
-	case CONFIGURE:
-	*/
 	case ssntp.START:
 		getStartResults(payload, &result)
 
@@ -398,6 +392,22 @@ func (server *SsntpTestServer) CommandNotify(uuid string, command ssntp.Command,
 	case ssntp.AttachVolume:
 		getAttachVolumeResult(payload, &result)
 
+	case ssntp.AssignPublicIP:
+		var assignCmd payloads.CommandAssignPublicIP
+
+		result.Err = yaml.Unmarshal(payload, &assignCmd)
+		if result.Err == nil {
+			result = publicIPResult(&assignCmd.AssignIP)
+		}
+
+	case ssntp.ReleasePublicIP:
+		var releaseCmd payloads.CommandReleasePublicIP
+
+		result.Err = yaml.Unmarshal(payload, &releaseCmd)
+		if result.Err == nil {
+			result = publicIPResult(&releaseCmd.ReleaseIP)
+		}
+
 	default:
 		fmt.Fprintf(os.Stderr, "server unhandled command %s\n", command.String())
 	}
@@ -430,6 +440,10 @@ func (server *SsntpTestServer) EventNotify(uuid string, event ssntp.Event, frame
 		var stopEvent payloads.EventInstanceStopped
 
 		result.Err = yaml.Unmarshal(payload, &stopEvent)
+	case ssntp.InstanceLog:
+		var logEvent payloads.EventInstanceLog
+
+		result.Err = yaml.Unmarshal(payload, &logEvent)
 	case ssntp.ConcentratorInstanceAdded:
 		// forward rule auto-sends to controllers
 	case ssntp.TenantAdded:
@@ -438,6 +452,8 @@ func (server *SsntpTestServer) EventNotify(uuid string, event ssntp.Event, frame
 		// forwards to CNCI via server.EventForward()
 	case ssntp.PublicIPAssigned:
 		// forwards from CNCI Controller(s) via server.EventForward()
+	case ssntp.PublicIPUnassigned:
+		// forward rule auto-sends to controllers
 	default:
 		fmt.Fprintf(os.Stderr, "server unhandled event %s\n", event.String())
 	}
@@ -576,6 +592,52 @@ func (server *SsntpTestServer) handleAttachVolume(payload []byte) ssntp.ForwardD
 	return dest
 }
 
+func (server *SsntpTestServer) handleEvacuate(payload []byte) ssntp.ForwardDestination {
+	var cmd payloads.Evacuate
+	var dest ssntp.ForwardDestination
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		dest.SetDecision(ssntp.Discard)
+		return dest
+	}
+
+	server.clientsLock.Lock()
+	defer server.clientsLock.Unlock()
+
+	for _, c := range server.clients {
+		if c == cmd.Evacuate.WorkloadAgentUUID {
+			dest.AddRecipient(c)
+		}
+	}
+
+	return dest
+}
+
+func (server *SsntpTestServer) handlePublicIP(command ssntp.Command, payload []byte) ssntp.ForwardDestination {
+	var dest ssntp.ForwardDestination
+	var concentratorUUID string
+	var err error
+
+	if command == ssntp.AssignPublicIP {
+		var cmd payloads.CommandAssignPublicIP
+		err = yaml.Unmarshal(payload, &cmd)
+		concentratorUUID = cmd.AssignIP.ConcentratorUUID
+	} else {
+		var cmd payloads.CommandReleasePublicIP
+		err = yaml.Unmarshal(payload, &cmd)
+		concentratorUUID = cmd.ReleaseIP.ConcentratorUUID
+	}
+
+	if err != nil || concentratorUUID == "" {
+		dest.SetDecision(ssntp.Discard)
+		return dest
+	}
+
+	dest.AddRecipient(concentratorUUID)
+	return dest
+}
+
 // CommandForward implements an SSNTP CommandForward callback for SsntpTestServer
 func (server *SsntpTestServer) CommandForward(uuid string, command ssntp.Command, frame *ssntp.Frame) (dest ssntp.ForwardDestination) {
 	payload := frame.Payload
@@ -586,7 +648,11 @@ func (server *SsntpTestServer) CommandForward(uuid string, command ssntp.Command
 	case ssntp.AttachVolume:
 		dest = server.handleAttachVolume(payload)
 	case ssntp.EVACUATE:
+		dest = server.handleEvacuate(payload)
+	case ssntp.AssignPublicIP:
 		fallthrough
+	case ssntp.ReleasePublicIP:
+		dest = server.handlePublicIP(command, payload)
 	case ssntp.DELETE:
 		fallthrough
 	default:
@@ -636,6 +702,10 @@ func StartTestServer() *SsntpTestServer {
 				Operand: ssntp.InstanceStopped,
 				Dest:    ssntp.Controller,
 			},
+			{ // all InstanceLog events go to all Controllers
+				Operand: ssntp.InstanceLog,
+				Dest:    ssntp.Controller,
+			},
 			{ // all ConcentratorInstanceAdded events go to all Controllers
 				Operand: ssntp.ConcentratorInstanceAdded,
 				Dest:    ssntp.Controller,
@@ -656,6 +726,18 @@ func StartTestServer() *SsntpTestServer {
 				Operand: ssntp.PublicIPAssigned,
 				Dest:    ssntp.Controller,
 			},
+			{ // all PublicIPUnassigned events go to all Controllers
+				Operand: ssntp.PublicIPUnassigned,
+				Dest:    ssntp.Controller,
+			},
+			{ // all AssignPublicIPFailure errors go to all Controllers
+				Operand: ssntp.AssignPublicIPFailure,
+				Dest:    ssntp.Controller,
+			},
+			{ // all UnassignPublicIPFailure errors go to all Controllers
+				Operand: ssntp.UnassignPublicIPFailure,
+				Dest:    ssntp.Controller,
+			},
 			{ // all START command are processed by the Command forwarder
 				Operand:        ssntp.START,
 				CommandForward: server,
@@ -680,6 +762,14 @@ func StartTestServer() *SsntpTestServer {
 				Operand:        ssntp.AttachVolume,
 				CommandForward: server,
 			},
+			{ // all AssignPublicIP commands are processed by the Command forwarder
+				Operand:        ssntp.AssignPublicIP,
+				CommandForward: server,
+			},
+			{ // all ReleasePublicIP commands are processed by the Command forwarder
+				Operand:        ssntp.ReleasePublicIP,
+				CommandForward: server,
+			},
 		},
 	}
 
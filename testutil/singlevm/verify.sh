@@ -384,7 +384,7 @@ deleteExternalIPPool
 
 to_delete=`"$ciao_gobin"/ciao list instances -f '{{len .}}'`
 #Now delete all instances
-"$ciao_gobin"/ciao delete instance --all
+"$ciao_gobin"/ciao delete instance --all --force
 exitOnError $?  "Unable to delete instances"
 
 "$ciao_gobin"/ciao list instances
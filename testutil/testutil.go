@@ -26,4 +26,5 @@ type Result struct {
 	TenantUUID   string
 	CNCI         bool
 	VolumeUUID   string
+	PublicIP     string
 }